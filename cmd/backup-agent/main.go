@@ -0,0 +1,242 @@
+// Command backup-agent runs the backup half of vintagestory-restic against a
+// Vintage Story server it doesn't run, so an existing server setup can get
+// restic backups without switching to the launcher.
+//
+// Usage:
+//
+//	backup-agent
+//
+// The agent is configured with the launcher's backup environment variables
+// (BACKUP_INTERVAL, RESTIC_REPOSITORY, ...). Commands such as /genbackup
+// reach the server over RCON (COMMAND_CHANNEL=rcon) or through a named pipe
+// the server reads its console input from (COMMAND_CHANNEL=pipe). Boots,
+// players, autosaves, and finished backups are detected by following the
+// server's log file (SERVER_LOG_FILE).
+//
+// The agent runs the launcher's startup checks and exits with the launcher's
+// exit codes, including for BACKUP_REQUIRED.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/backup"
+	"github.com/renorris/vintagestory-restic/internal/exitcode"
+	"github.com/renorris/vintagestory-restic/internal/logtail"
+	"github.com/renorris/vintagestory-restic/internal/server"
+	"github.com/renorris/vintagestory-restic/internal/startup"
+)
+
+func main() {
+	if len(os.Args) > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: backup-agent (configured through environment variables)")
+		os.Exit(exitcode.ConfigError)
+	}
+
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitcode.For(err))
+	}
+}
+
+func run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	backupConfig, err := backup.LoadConfig()
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, fmt.Errorf("failed to load backup config: %w", err))
+	}
+	if !backupConfig.Enabled {
+		return exitcode.With(exitcode.ConfigError, fmt.Errorf("BACKUP_INTERVAL is not set"))
+	}
+	if backupConfig.PauseServerDuringLiveFileCopy {
+		fmt.Println("Warning: BACKUP_PAUSE_SERVER_DURING_LIVE_FILE_COPY is ignored, since the agent doesn't run the server")
+		backupConfig.PauseServerDuringLiveFileCopy = false
+	}
+	if backupConfig.Required {
+		fmt.Println("Backups are required; the agent exits if backups keep failing.")
+	}
+	if err := startup.ResticEnv(); err != nil {
+		return err
+	}
+
+	commander, err := loadCommander()
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+	defer commander.Close()
+
+	logFile := strings.TrimSpace(os.Getenv("SERVER_LOG_FILE"))
+	if logFile == "" {
+		logFile = logtail.DefaultPath
+	}
+
+	resticVersion, err := startup.Restic(ctx, backupConfig)
+	if err != nil {
+		return err
+	}
+	if !backupConfig.Enabled {
+		return fmt.Errorf("the agent can't back up without restic")
+	}
+
+	playerChecker := &backup.PlayerChecker{}
+	if maxClients, err := backup.ReadMaxClients(backup.DefaultGameDataDir); err != nil {
+		fmt.Printf("Warning: %v; the player count won't be checked against MaxClients\n", err)
+	} else {
+		playerChecker.MaxClients = maxClients
+	}
+	autosaveTracker := &backup.AutosaveTracker{}
+
+	// The log stands in for the server's output, commands go to the channel
+	tail := &logtail.Tail{Path: logFile, Commander: commander}
+	tail.AddOutputListener("player-checker", func(line string) bool {
+		playerChecker.HandleOutput(line)
+		return true
+	})
+	tail.AddOutputListener("autosave", func(line string) bool {
+		autosaveTracker.HandleOutput(line)
+		return true
+	})
+	// The client list only shows up in the log when commands go to the
+	// server's console
+	if _, ok := commander.(*server.PipeCommander); ok {
+		playerChecker.Reconciler = tail
+	}
+	// The agent doesn't back up on every boot as the launcher does, so boots
+	// are when it catches up on backups missed while it was down
+	boots := make(chan struct{}, 1)
+	tail.OnBoot = func() {
+		select {
+		case boots <- struct{}{}:
+		default:
+		}
+	}
+	if err := tail.Start(ctx); err != nil {
+		return err
+	}
+	defer tail.Stop()
+	fmt.Printf("Following the server log %s\n", logFile)
+
+	requiredBackups := startup.NewRequiredBackups(backupConfig)
+	manager, err := backup.NewManager(*backupConfig,
+		backup.WithServer(tail), // Also reports boots and finished backups
+		backup.WithPlayerChecker(playerChecker),
+		backup.WithAutosaveChecker(autosaveTracker),
+		backup.WithResticVersion(resticVersion),
+		backup.WithOnBackupStart(func() {
+			fmt.Println("Starting backup...")
+		}),
+		backup.WithOnBackupComplete(func(err error, duration time.Duration) {
+			requiredBackups.Record(ctx, err)
+			switch {
+			case err == nil:
+				fmt.Printf("Backup completed successfully in %v\n", duration)
+			case errors.Is(err, backup.ErrNoPlayersOnline) || errors.Is(err, backup.ErrServerNotBooted):
+				fmt.Printf("Backup skipped: %v\n", err)
+			case !backup.IsSuppressedFailure(err):
+				fmt.Printf("Backup failed after %v: %v\n", duration, err)
+			}
+		}),
+	)
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, fmt.Errorf("invalid backup config: %w", err))
+	}
+	if err := startup.Paths(manager); err != nil {
+		return err
+	}
+
+	if _, err := manager.CheckStaging(ctx); err != nil {
+		fmt.Printf("WARNING: Failed to check the staging directory: %v\n", err)
+	}
+	// Report mistyped credentials now rather than at the first backup
+	if err := startup.Repository(ctx, backupConfig, manager); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	if err := manager.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start backup manager: %w", err)
+	}
+	fmt.Printf("Backups enabled with interval: %v\n", backupConfig.Interval)
+	if backupConfig.Catchup == backup.CatchupOne {
+		go catchUp(ctx, manager, boots)
+	}
+
+	select {
+	case <-ctx.Done():
+		fmt.Println("Stopping backup manager...")
+		manager.Stop()
+		return nil
+	case err := <-requiredBackups.Fatal():
+		fmt.Printf("Backup failed and BACKUP_REQUIRED is set, shutting down: %v\n", err)
+		manager.Stop()
+		return exitcode.With(exitcode.BackupFatal, fmt.Errorf("required backup failed: %w", err))
+	}
+}
+
+// catchUp runs a backup each time the server boots while the last successful
+// backup is more than one interval old, until ctx is done.
+func catchUp(ctx context.Context, manager *backup.Manager, boots <-chan struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-boots:
+		}
+		if !manager.BackupOverdue(time.Now()) {
+			continue
+		}
+		if last, ok := manager.LastSuccessfulBackup(); ok {
+			fmt.Printf("Last successful backup was %v ago, catching up...\n", time.Since(last).Round(time.Second))
+		} else {
+			fmt.Println("No previous backup recorded, catching up...")
+		}
+		if err := manager.RunBackupNow(ctx, true); err != nil {
+			fmt.Printf("Catch-up backup failed: %v\n", err)
+		}
+	}
+}
+
+// commander is a way to send commands to a server the agent doesn't run.
+type commander interface {
+	backup.ServerCommander
+	Close() error
+}
+
+// loadCommander returns the command channel configured by COMMAND_CHANNEL:
+// RCON at RCON_ADDRESS, or the named pipe at COMMAND_PIPE.
+func loadCommander() (commander, error) {
+	switch channel := strings.ToLower(strings.TrimSpace(os.Getenv("COMMAND_CHANNEL"))); channel {
+	case "rcon":
+		address := strings.TrimSpace(os.Getenv("RCON_ADDRESS"))
+		if address == "" {
+			return nil, fmt.Errorf("COMMAND_CHANNEL is rcon but RCON_ADDRESS is not set")
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return nil, fmt.Errorf("invalid RCON_ADDRESS: %w", err)
+		}
+		fmt.Printf("Sending server commands over RCON to %s.\n", address)
+		return &server.RCONClient{Address: address, Password: os.Getenv("RCON_PASSWORD")}, nil
+	case "pipe":
+		path := strings.TrimSpace(os.Getenv("COMMAND_PIPE"))
+		if path == "" {
+			return nil, fmt.Errorf("COMMAND_CHANNEL is pipe but COMMAND_PIPE is not set")
+		}
+		fmt.Printf("Sending server commands through the pipe %s.\n", path)
+		return &server.PipeCommander{Path: path}, nil
+	case "":
+		return nil, fmt.Errorf("COMMAND_CHANNEL must be set to rcon or pipe, since the agent doesn't run the server")
+	default:
+		return nil, fmt.Errorf("invalid COMMAND_CHANNEL: must be rcon or pipe, got %q", channel)
+	}
+}
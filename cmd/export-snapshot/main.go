@@ -0,0 +1,234 @@
+// Command export-snapshot packages a single snapshot into one encrypted file
+// for offline archival or handing to another admin, without giving them access
+// to the restic repository.
+//
+// Usage:
+//
+//	export-snapshot [--savegames] (--age-recipient <key> | --gpg-recipient <id>)... <snapshot_dir> <output>
+//	export-snapshot [--savegames] (--age-recipient <key> | --gpg-recipient <id>)... --snapshot <id> [--host <host>] [--tag <tags>] [--target <dir>] [--staging <dir>] <output>
+//
+// The archive is a gzip-compressed tar of the snapshot's staging directory,
+// with an export.json manifest and the snapshot's metadata.json, encrypted
+// with age or GnuPG. With --savegames, world trees are combined into .vcdbs
+// savegames that can be loaded directly.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/backup"
+)
+
+// defaultExportTarget is where --snapshot restores to. It is removed when
+// the export finishes.
+const defaultExportTarget = "/backupcache/export"
+
+const usage = `export-snapshot - Package a vintagestory-restic snapshot into one encrypted file
+
+Usage:
+  export-snapshot [--savegames] (--age-recipient <key> | --gpg-recipient <id>)... <snapshot_dir> <output>
+      Archive the snapshot restored at <snapshot_dir>, the staging directory
+      inside the restic restore target, into <output>.
+
+  export-snapshot [--savegames] (--age-recipient <key> | --gpg-recipient <id>)... --snapshot <id>
+         [--host <host>] [--tag <tags>] [--target <dir>] [--staging <dir>] <output>
+      Run restic restore for the snapshot (an ID or "latest") first, then
+      archive it as above.
+
+The archive is a gzip-compressed tar holding export.json (snapshot, worlds,
+server version), the snapshot's metadata.json, the world trees, and the other
+backed up files. It is encrypted for every recipient given, with age or with
+GnuPG, so no restic credentials are needed to open it:
+
+  age --decrypt -i key.txt world.tar.gz.age | tar -xz
+  gpg --decrypt world.tar.gz.gpg | tar -xz
+
+World trees are checked against the digests recorded in the snapshot first.
+
+Options:
+  --age-recipient <key>  age public key to encrypt for; repeatable or comma-separated
+  --gpg-recipient <id>   GnuPG key ID, fingerprint, or email to encrypt for; repeatable
+                         or comma-separated. The keys must be in the keyring.
+  --savegames            Combine world trees into .vcdbs savegames
+  --snapshot <id>        restic snapshot to export from the repository
+  --host <host>          With --snapshot latest, only consider snapshots of this host
+  --tag <tags>           With --snapshot latest, only consider snapshots with these
+                         comma-separated tags, e.g. world=survival
+  --target <dir>         Where restic restores to (default /backupcache/export); removed afterwards
+  --staging <dir>        Staging directory the snapshot was taken of (default /backupcache/staging)
+
+Examples:
+  export-snapshot --snapshot latest --savegames --age-recipient age1... /backupcache/world.tar.gz.age
+`
+
+// recipients is a flag that collects values given several times or
+// comma-separated.
+type recipients []string
+
+func (r *recipients) String() string {
+	return strings.Join(*r, ",")
+}
+
+func (r *recipients) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*r = append(*r, v)
+		}
+	}
+	return nil
+}
+
+func main() {
+	flags := flag.NewFlagSet("export-snapshot", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	var ageRecipients, gpgRecipients recipients
+	flags.Var(&ageRecipients, "age-recipient", "age public key to encrypt for")
+	flags.Var(&gpgRecipients, "gpg-recipient", "GnuPG key to encrypt for")
+	savegames := flags.Bool("savegames", false, "combine world trees into .vcdbs savegames")
+	snapshot := flags.String("snapshot", "", "restic snapshot to export from the repository")
+	target := flags.String("target", defaultExportTarget, "where restic restores to")
+	stagingDir := flags.String("staging", backup.DefaultStagingDir, "staging directory the snapshot was taken of")
+	host := flags.String("host", "", "with --snapshot latest, only consider snapshots of this host")
+	tags := flags.String("tag", "", "with --snapshot latest, only consider snapshots with these tags")
+	flags.Parse(os.Args[1:])
+
+	wantArgs := 2
+	if *snapshot != "" {
+		wantArgs = 1
+	}
+	if flags.NArg() != wantArgs {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+	output := flags.Arg(wantArgs - 1)
+
+	tool, keys := backup.EncryptAge, []string(ageRecipients)
+	switch {
+	case len(ageRecipients) > 0 && len(gpgRecipients) > 0:
+		fmt.Fprintln(os.Stderr, "Error: use either --age-recipient or --gpg-recipient, not both")
+		os.Exit(1)
+	case len(gpgRecipients) > 0:
+		tool, keys = backup.EncryptGPG, gpgRecipients
+	case len(ageRecipients) == 0:
+		fmt.Fprintln(os.Stderr, "Error: exports are always encrypted; give --age-recipient or --gpg-recipient")
+		os.Exit(1)
+	}
+
+	// Cancel long-running operations on Ctrl+C
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	start := time.Now()
+	manifest, err := run(ctx, flags.Arg(0), output, tool, keys, *savegames, *snapshot, *target, *stagingDir, *host, *tags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Exported %s (worlds: %s) to %s in %v\n",
+		manifest.Snapshot, strings.Join(manifest.Worlds, ", "), output, time.Since(start).Round(time.Second))
+}
+
+// run exports snapshotDir, or with snapshot set, restores that snapshot into
+// target first. The restore is unencrypted, so it is removed afterwards
+// whether or not the export succeeded.
+func run(ctx context.Context, snapshotDir, output, tool string, keys []string, savegames bool, snapshot, target, stagingDir, host, tags string) (*backup.ExportManifest, error) {
+	opts := backup.ExportOptions{
+		Snapshot:  snapshotDir,
+		Savegames: savegames,
+		WorkDir:   filepath.Dir(output),
+	}
+	if snapshot != "" {
+		snapshotDir = filepath.Join(target, stagingDir)
+		opts.Snapshot = snapshot
+		var filter []string
+		if host != "" {
+			filter = append(filter, "--host", host)
+		}
+		if tags != "" {
+			filter = append(filter, "--tag", tags)
+		}
+		defer func() {
+			if err := os.RemoveAll(target); err != nil {
+				fmt.Printf("WARNING: failed to remove %s: %v\n", target, err)
+			}
+		}()
+		if err := resticRestore(ctx, snapshot, target, stagingDir, filter); err != nil {
+			return nil, err
+		}
+	}
+	return export(ctx, snapshotDir, output, tool, keys, opts)
+}
+
+// resticRestore restores the staging directory of snapshot into target,
+// showing restic's output. filter selects the snapshot "latest" refers to.
+func resticRestore(ctx context.Context, snapshot, target, stagingDir string, filter []string) error {
+	args := []string{"restore", snapshot, "--target", target, "--include", stagingDir}
+	fmt.Printf("Restoring snapshot %s into %s\n", snapshot, target)
+
+	cmd := exec.CommandContext(ctx, "restic", append(args, filter...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("restic restore failed: %w", err)
+	}
+	return nil
+}
+
+// export writes the encrypted archive of snapshotDir to output. The archive
+// is written next to it first and only moved into place once encryption
+// has finished, so a failed export never leaves a truncated file behind.
+func export(ctx context.Context, snapshotDir, output, tool string, keys []string, opts backup.ExportOptions) (*backup.ExportManifest, error) {
+	name, args, err := backup.EncryptCommand(tool, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp := output + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	defer os.Remove(tmp)
+	defer out.Close()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+
+	manifest, archiveErr := backup.WriteExportArchive(ctx, stdin, snapshotDir, opts)
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		return nil, errors.Join(archiveErr, fmt.Errorf("%s failed: %w", name, err))
+	}
+	if archiveErr != nil {
+		return nil, archiveErr
+	}
+
+	if err := out.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := out.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, output); err != nil {
+		return nil, fmt.Errorf("failed to move export into place: %w", err)
+	}
+	return manifest, nil
+}
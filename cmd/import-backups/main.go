@@ -0,0 +1,127 @@
+// Command import-backups backfills a directory of raw .vcdbs backups, such as
+// those written by the game's own backup system, into the restic repository
+// as dated snapshots, so a server switching to vintagestory-restic keeps its
+// backup history.
+//
+// Usage:
+//
+//	import-backups [--gamedata <dir>] [--save <name>] [--dry-run] <backups_dir>
+//
+// Each backup is split into the staging directory and snapshotted with
+// restic backup --time, oldest first, tagged "imported". The backup settings
+// (BACKUP_WORLD, RESTIC_HOST, BACKUP_TREE_LAYOUT, ...) and the restic
+// environment variables are read as the launcher reads them, so imported
+// snapshots fall under the same retention and restore like any other.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/backup"
+	"github.com/renorris/vintagestory-restic/internal/startup"
+)
+
+const usage = `import-backups - Backfill raw .vcdbs backups into the restic repository
+
+Usage:
+  import-backups [--gamedata <dir>] [--save <name>] [--dry-run] <backups_dir>
+      Split each .vcdbs file in <backups_dir> into the staging directory and
+      snapshot it with restic, oldest first, dated when the backup was taken:
+      the time in its name if the game or LOCAL_KEEP_VCDBS named it, else its
+      modification time. Snapshots are tagged "imported". Backups already
+      imported are skipped, so an interrupted import can be run again.
+
+      Stop the launcher first, and import before its first backup: anything
+      else in the staging directory is included in the snapshots. The backup
+      files are left in place.
+
+Options:
+  --gamedata <dir>  Game data directory holding serverconfig.json (default /gamedata)
+  --save <name>     Save file the backups are of, e.g. default.vcdbs
+                    (default: the save file in serverconfig.json)
+  --dry-run         List the backups and the times they would be imported at
+
+Examples:
+  import-backups /gamedata/Backups
+  import-backups --save survival.vcdbs /mnt/old-backups
+`
+
+func main() {
+	flags := flag.NewFlagSet("import-backups", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	gameDataDir := flags.String("gamedata", backup.DefaultGameDataDir, "game data directory holding serverconfig.json")
+	save := flags.String("save", "", "save file the backups are of")
+	dryRun := flags.Bool("dry-run", false, "list the backups and the times they would be imported at")
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	backups, err := backup.FindImportBackups(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(backups) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no .vcdbs files in %s\n", flags.Arg(0))
+		os.Exit(1)
+	}
+
+	if *dryRun {
+		for _, b := range backups {
+			fmt.Printf("%s  %s\n", b.Time.Format(time.RFC3339), filepath.Base(b.Path))
+		}
+		return
+	}
+
+	// Cancel long-running operations on Ctrl+C
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	m, err := newManager(ctx, *gameDataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	n, err := m.ImportBackups(ctx, backups, *save)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v (%d of %d backups imported)\n", err, n, len(backups))
+		os.Exit(1)
+	}
+	fmt.Printf("Imported %d of %d backups in %v\n", n, len(backups), time.Since(start).Round(time.Second))
+}
+
+// newManager returns a Manager set up from the backup configuration, as far
+// as it affects the snapshots taken.
+func newManager(ctx context.Context, gameDataDir string) (*backup.Manager, error) {
+	cfg, err := backup.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := startup.ResticEnv(); err != nil {
+		return nil, err
+	}
+	_, resticVersion, err := backup.DetectRestic(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The import takes its snapshots itself, with the server stopped
+	cfg.Enabled = false
+	cfg.PauseServerDuringLiveFileCopy = false
+	return backup.NewManager(*cfg,
+		backup.WithGameDataDir(gameDataDir),
+		backup.WithResticVersion(resticVersion),
+	)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/renorris/vintagestory-restic/internal/backup"
+	"github.com/renorris/vintagestory-restic/internal/exitcode"
+	"github.com/renorris/vintagestory-restic/internal/server"
+	"github.com/renorris/vintagestory-restic/internal/startup"
+)
+
+// checkDependencies looks up the external programs the launcher relies on and
+// prints what it found. If restic is missing, backups are disabled, or the
+// launcher refuses to start when they are required. A missing dotnet runtime
+// is always fatal, since the server can't run without it.
+func checkDependencies(ctx context.Context, cfg *backup.Config) (backup.ResticVersion, error) {
+	fmt.Println("Checking dependencies...")
+
+	resticVersion, err := startup.Restic(ctx, cfg)
+	if err != nil {
+		return resticVersion, err
+	}
+
+	path, version, err := server.DetectRuntime(ctx)
+	switch {
+	case err != nil:
+		fmt.Printf("  dotnet: missing (%v)\n", err)
+		return resticVersion, exitcode.With(exitcode.ServerStartFailed, fmt.Errorf("the server can't run without the dotnet runtime: %w", err))
+	case path != "":
+		fmt.Printf("  dotnet: %s (runtime %s)\n", path, version)
+	}
+
+	return resticVersion, nil
+}
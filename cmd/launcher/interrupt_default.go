@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// raiseInterrupt delivers SIGINT to the launcher itself.
+func raiseInterrupt() {
+	syscall.Kill(os.Getpid(), syscall.SIGINT)
+}
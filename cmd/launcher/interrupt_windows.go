@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+// raiseInterrupt sends Ctrl+C to the launcher's console. The server runs in
+// its own process group, which ignores Ctrl+C, so only the launcher sees it.
+func raiseInterrupt() {
+	windows.GenerateConsoleCtrlEvent(windows.CTRL_C_EVENT, 0)
+}
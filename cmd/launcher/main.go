@@ -4,28 +4,45 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/renorris/vintagestory-restic/internal/backup"
+	"github.com/renorris/vintagestory-restic/internal/console"
+	"github.com/renorris/vintagestory-restic/internal/diagnostics"
 	"github.com/renorris/vintagestory-restic/internal/downloader"
+	"github.com/renorris/vintagestory-restic/internal/exitcode"
+	"github.com/renorris/vintagestory-restic/internal/heartbeat"
+	"github.com/renorris/vintagestory-restic/internal/logtime"
+	"github.com/renorris/vintagestory-restic/internal/objstore"
 	"github.com/renorris/vintagestory-restic/internal/server"
+	"github.com/renorris/vintagestory-restic/internal/startup"
 )
 
 const (
 	serverBinariesDir = "/serverbinaries"
-	// gracefulShutdownTimeout is how long to wait for the server to stop
-	// after the first interrupt signal before force killing it.
-	gracefulShutdownTimeout = 30 * time.Second
+	// commandHistoryPath is where interactive console history is persisted.
+	commandHistoryPath = "/gamedata/.launcher_history"
+	// requiredBackupRetryDelay is how long to wait before retrying a failed
+	// boot-time backup when BACKUP_REQUIRED is set.
+	requiredBackupRetryDelay = time.Minute
 )
 
 func main() {
 	// Run the launcher
 	if err := run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitcode.For(err))
 	}
 }
 
@@ -40,17 +57,38 @@ func run() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// A second signal skips the shutdown countdown, if one is running
+	skipCtx, skipCountdown := context.WithCancel(context.Background())
+	defer skipCountdown()
+
 	// Start a goroutine to cancel context on first signal
 	go func() {
 		sig := <-sigChan
 		fmt.Printf("\nReceived %v, cancelling operations...\n", sig)
 		cancel()
+		<-sigChan
+		skipCountdown()
 	}()
 
+	// Route output through timestamps and the console before anything is printed
+	input := console.DetectInput()
+	output, con, err := startOutput(input)
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+	if output != nil {
+		defer output.Stop()
+	}
+
+	// Start optional diagnostics before anything heavy runs
+	if err := startDiagnostics(); err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+
 	// Load backup configuration
 	backupConfig, err := backup.LoadConfig()
 	if err != nil {
-		return fmt.Errorf("failed to load backup config: %w", err)
+		return exitcode.With(exitcode.ConfigError, fmt.Errorf("failed to load backup config: %w", err))
 	}
 
 	if !backupConfig.Enabled {
@@ -66,101 +104,559 @@ func run() error {
 		if backupConfig.PruneRetention != "" {
 			fmt.Printf("Prune retention configured: %s\n", backupConfig.PruneRetention)
 		}
+		if backupConfig.PruneGroupBy != "" {
+			fmt.Printf("Prune groups snapshots by: %s\n", backupConfig.PruneGroupBy)
+		}
+		if backupConfig.ResticHost != "" {
+			fmt.Printf("Snapshots are recorded under host: %s\n", backupConfig.ResticHost)
+		}
+		if backupConfig.World != "" {
+			fmt.Printf("Snapshots are tagged %s%s; prunes only touch this world's snapshots.\n", backup.WorldTag, backupConfig.World)
+		}
+		if backupConfig.BackupWindow != nil {
+			fmt.Printf("Full backups taken in window %s (local time).\n", backupConfig.BackupWindow)
+		}
+		if backupConfig.PruneWindow != nil {
+			fmt.Printf("Prunes and checks restricted to window %s (local time).\n", backupConfig.PruneWindow)
+		}
+		if backupConfig.CheckInterval > 0 {
+			fmt.Printf("Repository will be checked every %v.\n", backupConfig.CheckInterval)
+		}
+		if backupConfig.MaintenanceMaxDefer > 0 {
+			fmt.Printf("Prunes and checks wait for an empty server for up to %v.\n", backupConfig.MaintenanceMaxDefer)
+		}
+		if len(backupConfig.TrimAreas) > 0 {
+			fmt.Printf("Backups restricted to %d area(s); terrain outside them is not backed up.\n", len(backupConfig.TrimAreas))
+		}
+		if backupConfig.WorldWidth > 0 {
+			fmt.Printf("World width: %d blocks\n", backupConfig.WorldWidth)
+		}
+		if backupConfig.TreeLayout != nil {
+			fmt.Printf("Staging tree layout: %s\n", backupConfig.TreeLayout)
+		}
+		if backupConfig.ModsInterval > 0 {
+			fmt.Printf("Mods are backed up as a separate snapshot set every %v.\n", backupConfig.ModsInterval)
+		}
+		for _, dir := range backup.SyncedDirs {
+			if policy, ok := backupConfig.SyncPolicies[dir]; ok {
+				mode := policy.Mode
+				if mode == "" {
+					mode = backup.SyncContent
+				}
+				fmt.Printf("%s is synced into staging by %s", dir, mode)
+				if len(policy.Exclude) > 0 {
+					fmt.Printf(", excluding %s", strings.Join(policy.Exclude, ", "))
+				}
+				fmt.Println(".")
+			}
+		}
+		if backupConfig.DriftInterval > 0 {
+			fmt.Printf("Drift from the last backup will be measured every %v.\n", backupConfig.DriftInterval)
+		}
+		if backupConfig.CacheCleanupInterval > 0 {
+			fmt.Printf("Unused cache entries will be looked for every %v and removed after %v.\n",
+				backupConfig.CacheCleanupInterval, backupConfig.CacheGracePeriod)
+		}
+		if len(backupConfig.CoverageIgnore) > 0 {
+			fmt.Printf("Not reporting as unbacked-up: %s\n", strings.Join(backupConfig.CoverageIgnore, ", "))
+		}
+		if backupConfig.PauseServerDuringLiveFileCopy {
+			fmt.Println("Server will be paused while live files are copied for backups.")
+		}
+		for _, hook := range []struct{ name, path string }{
+			{backup.HookEventPreBackup, backupConfig.Hooks.PreBackup},
+			{backup.HookEventPostBackup, backupConfig.Hooks.PostBackup},
+			{backup.HookEventBackupFailed, backupConfig.Hooks.BackupFailed},
+		} {
+			if hook.path != "" {
+				fmt.Printf("Backup %s hook: %s\n", hook.name, hook.path)
+			}
+		}
+		if backupConfig.Required {
+			fmt.Println("Backups are required; a failed backup will shut the server down.")
+		}
 
-		// Validate that required restic environment variables are set
-		if err := backup.ValidateResticEnv(); err != nil {
+		if err := startup.ResticEnv(); err != nil {
 			return err
 		}
 	}
 
+	// Find restic and dotnet, turning off what can't work without them
+	resticVersion, err := checkDependencies(ctx, backupConfig)
+	if err != nil {
+		return err
+	}
+
+	// Load watchdog configuration
+	watchdogConfig, err := loadWatchdogConfig()
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+
+	// Open the command audit log if enabled
+	auditLog, err := loadAuditLog()
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+	if auditLog != nil {
+		defer auditLog.Close()
+		fmt.Printf("Recording commands sent to the server in %s\n", auditLog.Path)
+	}
+
+	// Restrict what the console and scripts may send, if configured
+	commandPolicies, err := loadCommandPolicies()
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+	for source := range commandPolicies {
+		fmt.Printf("Commands from %s are checked against its command policy.\n", source)
+	}
+
+	// Check the boot script up front, so a typo doesn't go unnoticed until boot
+	bootScript := strings.TrimSpace(os.Getenv("RUN_ON_BOOT_SCRIPT"))
+	if bootScript != "" {
+		if _, err := server.LoadScript(bootScript); err != nil {
+			return exitcode.With(exitcode.ConfigError, fmt.Errorf("invalid RUN_ON_BOOT_SCRIPT: %w", err))
+		}
+		fmt.Printf("Running %s each time the server boots.\n", bootScript)
+	}
+
+	// Warn players before the server is stopped, if configured
+	shutdownCountdown, err := loadShutdownCountdown()
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+	if shutdownCountdown != nil {
+		fmt.Printf("Players are warned %v before the server is stopped.\n", shutdownCountdown[0])
+	}
+
+	// How the server is asked to stop, and how long it gets before it is killed
+	shutdownPolicy, err := loadShutdownPolicy()
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+	if len(shutdownPolicy.Steps) > 0 {
+		fmt.Printf("Server shutdown escalates as %s, then kills it.\n", formatShutdownSteps(shutdownPolicy.Steps))
+	}
+
+	// Check for server updates while running, if configured
+	updateConfig, err := loadUpdateConfig()
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+	if updateConfig.Policy != downloader.UpdateManual {
+		fmt.Printf("Checking for server updates every %v (policy: %s).\n", updateConfig.Interval, updateConfig.Policy)
+	}
+
+	// Report to the operator's monitoring endpoint, if configured
+	heartbeatSender, err := loadHeartbeatSender()
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+	if heartbeatSender != nil {
+		fmt.Printf("Sending heartbeats every %v.\n", heartbeatSender.Interval)
+	}
+
+	// Send commands over RCON instead of stdin, if configured
+	rcon, err := loadRCONClient()
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+	if rcon != nil {
+		fmt.Printf("Sending server commands over RCON to %s.\n", rcon.Address)
+		rcon.OnResponse = func(cmd, response string) {
+			fmt.Println(response)
+		}
+	}
+
+	// Upload raw backup files to object storage, if configured
+	rawUploader, err := loadRawUploader()
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+	if rawUploader != nil {
+		fmt.Printf("Raw backup files are uploaded to bucket %s.\n", rawUploader.Client.Bucket)
+	}
+
+	// Keep recent server output for !tail
+	recentOutputSize := 0
+	if s := os.Getenv("RECENT_OUTPUT_LINES"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return exitcode.With(exitcode.ConfigError, fmt.Errorf("invalid RECENT_OUTPUT_LINES: must be a positive integer, got %q", s))
+		}
+		recentOutputSize = n
+	}
+
+	// Build the console output filter
+	consoleFilter, err := server.NewLineFilter(
+		server.ParsePatternList(os.Getenv("CONSOLE_DROP_PATTERNS")),
+		server.ParsePatternList(os.Getenv("CONSOLE_ALLOW_PATTERNS")),
+	)
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, fmt.Errorf("invalid console filter: %w", err))
+	}
+
+	// A missing server archive URL is a configuration error, not a failed download
+	if _, err := downloader.ResolveServerURL(runtime.GOARCH, os.Getenv); err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+
 	// Stage 1: Download server binaries if needed
 	if err := downloader.DoServerBinaryDownload(ctx, serverBinariesDir); err != nil {
 		if ctx.Err() != nil {
 			// Context was cancelled, exit cleanly
 			return nil
 		}
-		return fmt.Errorf("failed to download server binaries: %w", err)
+		return exitcode.With(exitcode.DownloadFailed, fmt.Errorf("failed to download server binaries: %w", err))
+	}
+
+	// Remember which archive the binaries came from, for snapshot metadata
+	var serverBinaries backup.ServerBinaries
+	if installed, err := downloader.InstalledVersion(serverBinariesDir); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	} else if installed != nil {
+		serverBinaries = backup.ServerBinaries{URL: installed.URL, ETag: installed.ETag, Version: installed.Version}
+		if installed.Version != "" {
+			fmt.Printf("Server archive version: %s\n", installed.Version)
+		}
 	}
 
 	// Stage 2: Create player checker if needed (before server so we can wire up OnOutput)
 	var playerChecker *backup.PlayerChecker
-	if backupConfig.Enabled && backupConfig.PauseWhenNoPlayers {
+	// Backups always get one, so pausing can be turned on with !backup set
+	if backupConfig.Enabled || shutdownCountdown != nil || heartbeatSender != nil {
 		playerChecker = &backup.PlayerChecker{}
 	}
 
+	// Track the game's own autosaves so backups don't overlap with them
+	var autosaveTracker *backup.AutosaveTracker
+	if backupConfig.Enabled {
+		autosaveTracker = &backup.AutosaveTracker{}
+	}
+
+	// Print server output from its own goroutine, so a slow stdout can't
+	// stall output handling
+	outputPrinter := &server.OutputPrinter{}
+	outputPrinter.Start()
+	defer outputPrinter.Stop()
+
 	// Stage 3: Start the Vintage Story server
 	srv := &server.Server{
 		WorkingDir: serverBinariesDir,
 		Args:       []string{"--dataPath", "/gamedata"},
-		OnOutput: func(line string) bool {
-			fmt.Println(line)
-			// Forward output to player checker if enabled
-			if playerChecker != nil {
-				playerChecker.HandleOutput(line)
-			}
-			return true
+		OnReadError: func(err error) {
+			fmt.Printf("WARNING: Server output: %v\n", err)
 		},
+		OnPhase: func(phase server.Phase) {
+			fmt.Printf("Server startup: %s\n", phase.Description())
+		},
+		RecentOutputSize: recentOutputSize,
+	}
+	// Filtering only affects the console; other listeners see every line
+	srv.AddOutputListener("console", func(line string) bool {
+		if consoleFilter.ShouldPrint(line) {
+			outputPrinter.Print(line)
+		}
+		return true
+	})
+	if playerChecker != nil {
+		srv.AddOutputListener("player-checker", func(line string) bool {
+			playerChecker.HandleOutput(line)
+			return true
+		})
+	}
+	if autosaveTracker != nil {
+		srv.AddOutputListener("autosave", func(line string) bool {
+			autosaveTracker.HandleOutput(line)
+			return true
+		})
 	}
 
 	// Stage 4: Create the command queue for rate-limited command submission
 	// This ensures a minimum 100ms delay between all commands sent to the server
+	// Commands go to the server's stdin unless RCON is configured
+	var commandSender server.CommandSender = srv
+	if rcon != nil {
+		commandSender = rcon
+		defer rcon.Close()
+	}
+
 	cmdQueue := &server.CommandQueue{
-		Sender: srv,
+		Sender: commandSender,
 		OnError: func(cmd string, err error) {
 			if err != nil {
 				fmt.Printf("Failed to send command %q: %v\n", cmd, err)
 			}
 		},
+		Audit:    auditLog,
+		Policies: commandPolicies,
 	}
 
+	// Bound the player count by the server's player limit. The client list
+	// only shows up in the server's output when commands go to stdin.
+	if playerChecker != nil {
+		maxClients, err := backup.ReadMaxClients("/gamedata")
+		if err != nil {
+			fmt.Printf("Warning: %v; the player count won't be checked against MaxClients\n", err)
+		}
+		playerChecker.MaxClients = maxClients
+		if rcon == nil {
+			playerChecker.Reconciler = cmdQueue.From(server.SourcePlayerCheck)
+		}
+	}
+
+	// With BACKUP_REQUIRED, repeated backup failures shut the launcher down.
+	// Skipped backups (no players, server still booting) don't count.
+	requiredBackups := startup.NewRequiredBackups(backupConfig)
+
 	// Stage 5: Start backup manager if enabled (create before starting server so we can use OnBoot)
 	var backupManager *backup.Manager
 	if backupConfig.Enabled {
-		backupManager = &backup.Manager{
-			Interval:               backupConfig.Interval,
-			GameDataDir:            "/gamedata",
-			Server:                 cmdQueue, // Use the command queue for rate-limited commands
-			BootChecker:            srv,
-			BackupCompletionWaiter: srv, // Wait for "[Server Notification] Backup complete!" before vacuuming
-			PlayerChecker:          playerChecker,
-			PauseWhenNoPlayers:     backupConfig.PauseWhenNoPlayers,
-			PruneRetention:         backupConfig.PruneRetention,
-			OnBackupStart: func() {
+		opts := []backup.Option{
+			backup.WithGameDataDir("/gamedata"),
+			backup.WithServer(cmdQueue.From(server.SourceBackup)), // Use the command queue for rate-limited commands
+			backup.WithBootChecker(srv),
+			backup.WithBackupCompletionWaiter(srv), // Wait for "[Server Notification] Backup complete!" before vacuuming
+			backup.WithPlayerChecker(playerChecker),
+			backup.WithAutosaveChecker(autosaveTracker),
+			backup.WithProcessPauser(srv),
+			backup.WithGameVersion(srv),
+			backup.WithServerBinaries(serverBinaries),
+			backup.WithResticVersion(resticVersion),
+			backup.WithOnBackupStart(func() {
 				fmt.Println("Starting backup...")
-			},
-			OnBackupComplete: func(err error, duration time.Duration) {
+			}),
+			backup.WithOnBackupComplete(func(err error, duration time.Duration) {
+				requiredBackups.Record(ctx, err)
 				if err != nil {
 					if err == backup.ErrNoPlayersOnline {
-						fmt.Printf("Backup skipped: %v\n", err)
-					} else {
+						if n := backupManager.Status().ConsecutiveSkips; n > 1 {
+							fmt.Printf("Backup skipped (%d in a row): %v\n", n, err)
+						} else {
+							fmt.Printf("Backup skipped: %v\n", err)
+						}
+					} else if !backup.IsSuppressedFailure(err) {
 						fmt.Printf("Backup failed after %v: %v\n", duration, err)
 					}
 				} else {
 					fmt.Printf("Backup completed successfully in %v\n", duration)
 				}
-			},
+			}),
+		}
+		if rawUploader != nil {
+			opts = append(opts, backup.WithRawUploader(rawUploader))
+		}
+		backupManager, err = backup.NewManager(*backupConfig, opts...)
+		if err != nil {
+			return exitcode.With(exitcode.ConfigError, fmt.Errorf("invalid backup config: %w", err))
+		}
+		if backupConfig.LocalKeepVCDBS > 0 {
+			fmt.Printf("Keeping the last %d backup file(s) in %s.\n", backupConfig.LocalKeepVCDBS, backupManager.LocalCopiesDir())
+		}
+	}
+
+	// Count down before planned stops, kicking whoever is left at the end
+	var shutdownNotice *server.ShutdownNotice
+	if shutdownCountdown != nil {
+		shutdownNotice = &server.ShutdownNotice{
+			Sender:    cmdQueue.From(server.SourceShutdown),
+			Players:   playerChecker,
+			Countdown: shutdownCountdown,
+		}
+	}
+
+	// The server outlives the launcher's context, so a signal stops it as
+	// the shutdown policy escalates, after players have been warned
+	serverCtx, stopServer := context.WithCancel(context.Background())
+	defer stopServer()
+
+	restarter := &serverRestarter{srv: srv, ctx: ctx, serverCtx: serverCtx, notice: shutdownNotice, shutdown: shutdownPolicy}
+
+	// Compaction reuses the backup manager's /genbackup handling; when backups
+	// are disabled a bare manager is enough, since Compact doesn't need Start.
+	compactor := backupManager
+	if compactor == nil {
+		compactor, err = backup.NewManager(*backupConfig,
+			backup.WithGameDataDir("/gamedata"),
+			backup.WithServer(cmdQueue.From(server.SourceCompaction)),
+			backup.WithBootChecker(srv),
+			backup.WithBackupCompletionWaiter(srv),
+		)
+		if err != nil {
+			return exitcode.With(exitcode.ConfigError, fmt.Errorf("invalid backup config: %w", err))
+		}
+	}
+	compactor.Restarter = restarter
+
+	updater := &downloader.Updater{
+		TargetDir: serverBinariesDir,
+		Policy:    updateConfig.Policy,
+		Interval:  updateConfig.Interval,
+		OnAvailable: func(u *downloader.Update) {
+			fmt.Printf("Server update available: %s\n", u)
+			if updateConfig.Policy == downloader.UpdateNotify {
+				fmt.Println("Run !update to install it.")
+			}
+		},
+		Apply: func(ctx context.Context, u *downloader.Update) error {
+			return applyUpdate(ctx, u, backupManager, restarter)
+		},
+	}
+
+	// Launcher commands are handled here instead of being sent to the server
+	submit := func(line string) {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == "!script" {
+			if len(fields) != 2 {
+				fmt.Println("Usage: !script <path>")
+				return
+			}
+			go runScript(ctx, cmdQueue, fields[1])
+			return
+		}
+		if len(fields) > 0 && fields[0] == "!tail" {
+			printRecentOutput(srv, fields[1:])
+			return
+		}
+		if len(fields) > 0 && fields[0] == "!rollback" {
+			go runRollback(ctx, compactor, fields[1:])
+			return
+		}
+		if len(fields) > 0 && fields[0] == "!purge-player" {
+			go runPurgePlayer(ctx, compactor, backupManager != nil, fields[1:])
+			return
+		}
+		if len(fields) > 0 && fields[0] == "!backup" {
+			runBackupCommand(ctx, backupManager, fields[1:])
+			return
+		}
+
+		if len(fields) > 0 && fields[0] == "!prune" {
+			go runPruneCommand(ctx, backupManager, fields[1:])
+			return
+		}
+
+		if len(fields) > 0 && fields[0] == "!repo" {
+			go runRepoCommand(ctx, backupManager, fields[1:])
+			return
+		}
+
+		if len(fields) > 0 && fields[0] == "!snapshot" {
+			go runSnapshotCommand(ctx, backupManager, fields[1:])
+			return
+		}
+
+		switch strings.TrimSpace(line) {
+		case "!compact":
+			go func() {
+				fmt.Println("Starting world compaction...")
+				if err := compactor.Compact(ctx); err != nil {
+					fmt.Printf("Compaction failed: %v\n", err)
+					return
+				}
+				fmt.Println("Compaction complete.")
+			}()
+		case "!audit":
+			auditCoverage(backupManager)
+		case "!update":
+			go func() {
+				update, err := downloader.CheckForUpdate(ctx, serverBinariesDir)
+				if err != nil {
+					fmt.Printf("Update failed: %v\n", err)
+					return
+				}
+				if update == nil {
+					fmt.Println("Server binaries are up to date.")
+					return
+				}
+				if err := applyUpdate(ctx, update, backupManager, restarter); err != nil {
+					fmt.Printf("Update failed: %v\n", err)
+				}
+			}()
+		default:
+			cmdQueue.SubmitFrom(server.SourceStdin, line)
 		}
 	}
 
 	// Set up OnBoot callback to always trigger backup-on-start
 	srv.OnBoot = func() {
+		if bootScript != "" {
+			go runScript(ctx, cmdQueue, bootScript)
+		}
+
 		// Always trigger backup-on-start when backups are enabled
 		// This ensures a backup is performed as soon as the server boots,
-		// even if there are no players online.
+		// even if there are no players online. It also catches up on backups
+		// missed while the launcher was down.
 		if backupConfig.Enabled {
 			fmt.Println("Triggering immediate backup on server boot...")
+			if backupConfig.Catchup == backup.CatchupOne && backupManager.BackupOverdue(time.Now()) {
+				if last, ok := backupManager.LastSuccessfulBackup(); ok {
+					fmt.Printf("Last successful backup was %v ago; this backup catches up.\n", time.Since(last).Round(time.Second))
+				} else {
+					fmt.Println("No previous backup recorded; this backup catches up.")
+				}
+			}
 			go func() {
-				// Skip player check for boot-time backup to ensure it always runs
-				if err := backupManager.RunBackupNow(ctx, true); err != nil {
+				// Skip player check for boot-time backup to ensure it always runs.
+				// When backups are required, retry until it succeeds or too many attempts fail.
+				for attempt := 1; ; attempt++ {
+					err := backupManager.RunBackupNow(ctx, true)
+					requiredBackups.Record(ctx, err)
+					if err == nil {
+						return
+					}
 					fmt.Printf("Backup on server start failed: %v\n", err)
+					if !backupConfig.Required || attempt >= backupConfig.RequiredMaxFailures {
+						return
+					}
+					fmt.Printf("Retrying backup in %v...\n", requiredBackupRetryDelay)
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(requiredBackupRetryDelay):
+					}
 				}
 			}()
 		}
 	}
 
+	// Catch staging/gamedata mix-ups before they snowball into recursive backups
+	if err := startup.Paths(compactor); err != nil {
+		return err
+	}
+
+	// Finish a rollback the launcher died in the middle of, before the server
+	// can open a half-swapped world
+	pendingRollback, err := compactor.ResumeRollback()
+	if err != nil {
+		return exitcode.With(exitcode.ServerStartFailed, fmt.Errorf("failed to finish interrupted rollback: %w", err))
+	}
+	if pendingRollback != nil {
+		fmt.Printf("A rollback to snapshot %s is prepared. Run !rollback confirm to swap it in, or !rollback cancel to discard it.\n", pendingRollback.Snapshot)
+	}
+
+	// Don't let a split interrupted by a crash end up in every snapshot
+	if backupManager != nil {
+		if _, err := backupManager.CheckStaging(ctx); err != nil {
+			fmt.Printf("WARNING: Failed to check the staging directory: %v\n", err)
+		}
+	}
+
+	// No backups, no service: make sure the repository works before starting
+	if backupManager != nil {
+		if err := startup.Repository(ctx, backupConfig, backupManager); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+
 	fmt.Println("Starting Vintage Story server...")
-	if err := srv.Start(ctx); err != nil {
-		return fmt.Errorf("failed to start server: %w", err)
+	if err := srv.Start(serverCtx); err != nil {
+		return exitcode.With(exitcode.ServerStartFailed, fmt.Errorf("failed to start server: %w", err))
 	}
 
 	fmt.Printf("Server started with PID %d\n", srv.PID())
@@ -169,59 +665,1102 @@ func run() error {
 	cmdQueue.Start()
 	defer cmdQueue.Stop()
 
+	// Start the watchdog now that the server is running
+	if watchdogConfig.Timeout > 0 || len(watchdogConfig.PhaseTimeouts) > 0 {
+		watchdog := &server.Watchdog{
+			Source:        srv,
+			Sender:        cmdQueue.From(server.SourceWatchdog),
+			Timeout:       watchdogConfig.Timeout,
+			PhaseTimeouts: watchdogConfig.PhaseTimeouts,
+			ProbeInterval: watchdogConfig.ProbeInterval,
+			OnUnhealthy: func(silentFor time.Duration) {
+				fmt.Printf("WARNING: Server has produced no output for %v while %s and appears to be hung.\n",
+					silentFor.Round(time.Second), srv.Phase().Description())
+				if watchdogConfig.KillOnHang {
+					fmt.Println("Watchdog killing hung server...")
+					srv.Kill()
+				}
+			},
+			OnRecovered: func() {
+				fmt.Println("Server is responsive again.")
+			},
+		}
+		watchdog.Start()
+		defer watchdog.Stop()
+		fmt.Printf("Watchdog enabled with timeout: %v\n", watchdogConfig.Timeout)
+		for phase := server.PhaseStarting; phase <= server.PhaseReady; phase++ {
+			if d, ok := watchdogConfig.PhaseTimeouts[phase]; ok {
+				fmt.Printf("Watchdog timeout while %s: %v\n", phase.Description(), d)
+			}
+		}
+	}
+
 	// Start the backup manager after the server has started
 	if backupManager != nil {
 		if err := backupManager.Start(ctx); err != nil {
 			fmt.Printf("WARNING: Failed to start backup manager: %v\n", err)
+			if backupConfig.Required {
+				requiredBackups.Fail(fmt.Errorf("failed to start backup manager: %w", err))
+			}
 		} else {
 			fmt.Println("Backup manager started.")
 			defer backupManager.Stop()
 		}
 	}
 
-	// Start goroutine to read commands from stdin and pipe them to the server
-	go readStdinCommands(ctx, cmdQueue)
+	// Check for server updates in the background
+	if updateConfig.Policy != downloader.UpdateManual {
+		if err := updater.Start(ctx); err != nil {
+			fmt.Printf("WARNING: Failed to start update checks: %v\n", err)
+		} else {
+			defer updater.Stop()
+		}
+	}
 
-	// Wait for either the server to exit or context cancellation (from signal)
-	select {
-	case <-srv.Done():
-		// Server exited on its own
-		if err := srv.ExitError(); err != nil {
-			return fmt.Errorf("server exited with error: %w", err)
+	// Heartbeats report the server from here on, including while it restarts
+	if heartbeatSender != nil {
+		heartbeatSender.Collect = func() heartbeat.Report {
+			return collectHeartbeat(srv, playerChecker, backupManager, resticVersion)
 		}
-		fmt.Println("Server exited cleanly.")
-		return nil
+		if err := heartbeatSender.Start(); err != nil {
+			fmt.Printf("WARNING: Failed to start heartbeats: %v\n", err)
+		} else {
+			defer heartbeatSender.Stop()
+		}
+	}
 
-	case <-ctx.Done():
-		// Context cancelled (signal received) - start graceful shutdown
-		fmt.Println("Initiating graceful shutdown (30s timeout)...")
+	// Read commands from stdin and pipe them to the server.
+	// When attached to a TTY, use the interactive console with line editing and history.
+	// A closed stdin or /dev/null can never deliver a command, so don't read it.
+	switch input {
+	case console.InputNone:
+		fmt.Println("Command input: none (stdin is not connected). Attach stdin, e.g. with docker run -i, to send server commands.")
+	default:
+		fmt.Printf("Command input: %s\n", input)
+	}
 
-		// Wait for either:
-		// 1. Server to exit gracefully
-		// 2. 30 second timeout
-		shutdownTimer := time.NewTimer(gracefulShutdownTimeout)
-		defer shutdownTimer.Stop()
+	switch input {
+	case console.InputTerminal:
+		con.OnLine = submit
+		con.OnInterrupt = func() {
+			// Raw mode swallows Ctrl+C, so raise SIGINT ourselves
+			raiseInterrupt()
+		}
+		if err := con.Start(); err != nil {
+			fmt.Printf("WARNING: Failed to start interactive console, falling back to plain input: %v\n", err)
+			go readStdinCommands(ctx, submit)
+		} else {
+			defer con.Stop()
+		}
+	case console.InputPipe:
+		go readStdinCommands(ctx, submit)
+	}
 
+	// Wait for either the server to exit or context cancellation (from signal)
+	for {
 		select {
 		case <-srv.Done():
-			// Server stopped gracefully
-			fmt.Println("Server shutdown complete.")
+			// A planned stop for maintenance; wait for the restart and keep going
+			if restarting := restarter.pending(); restarting != nil {
+				select {
+				case <-restarting:
+					if err := restarter.err(); err != nil {
+						return exitcode.With(exitcode.ServerStartFailed, err)
+					}
+					continue
+				case <-ctx.Done():
+					fmt.Println("Server is stopped for maintenance, exiting.")
+					return nil
+				}
+			}
+
+			// Server exited on its own
+			if err := srv.ExitError(); err != nil {
+				return exitcode.With(exitcode.ServerCrashed, fmt.Errorf("server exited with error: %w", err))
+			}
+			fmt.Println("Server exited cleanly.")
 			return nil
 
-		case <-shutdownTimer.C:
-			// Timeout elapsed - force kill
-			fmt.Println("Graceful shutdown timeout elapsed, force killing server...")
-			srv.Kill()
-			<-srv.Done() // Wait for process to actually terminate
-			fmt.Println("Server killed.")
+		case err := <-requiredBackups.Fatal():
+			// A required backup failed - stop the server so it doesn't run unprotected
+			fmt.Printf("Backup failed and BACKUP_REQUIRED is set, shutting down: %v\n", err)
+			shutdownServer(srv, shutdownPolicy)
+			return exitcode.With(exitcode.BackupFatal, fmt.Errorf("required backup failed: %w", err))
+
+		case <-ctx.Done():
+			// Context cancelled (signal received) - start graceful shutdown
+			if shutdownNotice != nil && srv.Running() {
+				fmt.Println("Warning players before shutting down; send the signal again to stop right away...")
+				warnPlayers(skipCtx, shutdownNotice, srv, "shutting down")
+			}
+			fmt.Printf("Initiating graceful shutdown (%v timeout)...\n", shutdownPolicy.Timeout())
+			shutdownServer(srv, shutdownPolicy)
 			return nil
 		}
 	}
 }
 
-// readStdinCommands reads commands from stdin and submits them to the command queue.
+// warnPlayers runs the shutdown countdown, ending it early if ctx is
+// cancelled or the server exits on its own.
+func warnPlayers(ctx context.Context, notice *server.ShutdownNotice, srv *server.Server, reason string) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-srv.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := notice.Run(ctx, reason); err != nil {
+		fmt.Println("Shutdown countdown skipped.")
+	}
+}
+
+// shutdownServer stops the server as policy escalates and waits for it to
+// exit.
+func shutdownServer(srv *server.Server, policy *server.ShutdownPolicy) {
+	srv.Shutdown(context.Background(), policy)
+	fmt.Println("Server shutdown complete.")
+}
+
+// loadShutdownPolicy loads how the server is stopped from SHUTDOWN_TIMEOUT
+// or SHUTDOWN_ESCALATION. Without either, the server gets
+// server.DefaultShutdownTimeout to stop.
+func loadShutdownPolicy() (*server.ShutdownPolicy, error) {
+	policy := &server.ShutdownPolicy{
+		OnEscalate: func(step server.ShutdownStep) {
+			if step.Action == server.ShutdownKill {
+				fmt.Println("Graceful shutdown timeout elapsed, force killing server...")
+				return
+			}
+			fmt.Printf("Server still running, escalating shutdown to %s...\n", step.Action)
+		},
+	}
+
+	timeout := strings.TrimSpace(os.Getenv("SHUTDOWN_TIMEOUT"))
+	escalation := strings.TrimSpace(os.Getenv("SHUTDOWN_ESCALATION"))
+	switch {
+	case timeout != "" && escalation != "":
+		return nil, fmt.Errorf("SHUTDOWN_TIMEOUT and SHUTDOWN_ESCALATION can't both be set; give the waits in SHUTDOWN_ESCALATION")
+	case timeout != "":
+		d, err := backup.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %w", err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT: must be positive")
+		}
+		policy.Steps = server.ShutdownTimeoutSteps(d)
+	case escalation != "":
+		steps, err := server.ParseShutdownSteps(escalation)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SHUTDOWN_ESCALATION: %w", err)
+		}
+		policy.Steps = steps
+	}
+	return policy, nil
+}
+
+// formatShutdownSteps formats shutdown steps as SHUTDOWN_ESCALATION takes
+// them, e.g. "stop, sigint:30s".
+func formatShutdownSteps(steps []server.ShutdownStep) string {
+	var parts []string
+	for _, step := range steps {
+		if step.Wait > 0 {
+			parts = append(parts, fmt.Sprintf("%s:%v", step.Action, step.Wait))
+		} else {
+			parts = append(parts, string(step.Action))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// watchdogConfig holds the hung-server watchdog configuration.
+type watchdogConfig struct {
+	// Timeout is how long the server may be silent before it is considered hung.
+	// Zero disables the watchdog.
+	Timeout time.Duration
+
+	// PhaseTimeouts replace Timeout during the given phases of startup.
+	PhaseTimeouts map[server.Phase]time.Duration
+
+	// ProbeInterval is how long the server may be silent before a probe
+	// command is sent to elicit output. Zero disables probing.
+	ProbeInterval time.Duration
+
+	// KillOnHang kills the server when it hangs, so the launcher exits with
+	// an error and the container's restart policy can bring it back up.
+	KillOnHang bool
+}
+
+// loadWatchdogConfig loads the watchdog configuration from environment variables.
+func loadWatchdogConfig() (*watchdogConfig, error) {
+	config := &watchdogConfig{}
+
+	if s := os.Getenv("WATCHDOG_TIMEOUT"); s != "" {
+		timeout, err := backup.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WATCHDOG_TIMEOUT: %w", err)
+		}
+		config.Timeout = timeout
+	}
+
+	if s := os.Getenv("WATCHDOG_PHASE_TIMEOUTS"); s != "" {
+		timeouts, err := server.ParsePhaseTimeouts(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WATCHDOG_PHASE_TIMEOUTS: %w", err)
+		}
+		config.PhaseTimeouts = timeouts
+	}
+
+	if s := os.Getenv("WATCHDOG_PROBE_INTERVAL"); s != "" {
+		interval, err := backup.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WATCHDOG_PROBE_INTERVAL: %w", err)
+		}
+		config.ProbeInterval = interval
+	}
+
+	config.KillOnHang = backup.ParseBoolEnv(os.Getenv("WATCHDOG_KILL_ON_HANG"))
+
+	return config, nil
+}
+
+// loadShutdownCountdown loads the shutdown countdown from SHUTDOWN_COUNTDOWN.
+// Returns nil if players aren't to be warned.
+func loadShutdownCountdown() ([]time.Duration, error) {
+	s := strings.TrimSpace(os.Getenv("SHUTDOWN_COUNTDOWN"))
+	if s == "" {
+		return nil, nil
+	}
+	if backup.ParseBoolEnv(s) {
+		return server.DefaultShutdownCountdown, nil
+	}
+
+	countdown, err := server.ParseShutdownCountdown(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SHUTDOWN_COUNTDOWN: %w", err)
+	}
+	return countdown, nil
+}
+
+// updateConfig holds the server update configuration.
+type updateConfig struct {
+	// Policy selects whether new server archives are ignored, reported, or
+	// installed while the server runs.
+	Policy downloader.UpdatePolicy
+
+	// Interval is the time between update checks.
+	Interval time.Duration
+}
+
+// loadUpdateConfig loads the update configuration from UPDATE_POLICY and
+// UPDATE_CHECK_INTERVAL.
+func loadUpdateConfig() (*updateConfig, error) {
+	policy, err := downloader.ParseUpdatePolicy(os.Getenv("UPDATE_POLICY"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid UPDATE_POLICY: %w", err)
+	}
+	config := &updateConfig{Policy: policy, Interval: downloader.DefaultUpdateCheckInterval}
+
+	if s := os.Getenv("UPDATE_CHECK_INTERVAL"); s != "" {
+		interval, err := backup.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UPDATE_CHECK_INTERVAL: %w", err)
+		}
+		config.Interval = interval
+	}
+
+	return config, nil
+}
+
+// updateMu serializes server updates, from the updater and !update.
+var updateMu sync.Mutex
+
+// applyUpdate installs a new server archive: it backs up the world, warns
+// players and stops the server, downloads the new binaries, and starts the
+// server again. If the backup fails, the server is left running on the old
+// binaries. If the download fails, the old binaries are left untouched and
+// the server is started on them again; the next attempt resumes the
+// download.
+func applyUpdate(ctx context.Context, u *downloader.Update, backupManager *backup.Manager, restarter *serverRestarter) error {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	fmt.Printf("Updating server to %s...\n", u)
+	if backupManager != nil {
+		fmt.Println("Backing up before the update...")
+		if err := backupManager.RunBackupNow(ctx, true); err != nil {
+			return fmt.Errorf("backup before update failed, not updating: %w", err)
+		}
+	}
+
+	if err := restarter.stopFor(ctx, "updating"); err != nil {
+		return fmt.Errorf("failed to stop server for update: %w", err)
+	}
+
+	downloadErr := downloader.DoServerBinaryDownload(ctx, serverBinariesDir)
+	if downloadErr == nil {
+		if installed, err := downloader.InstalledVersion(serverBinariesDir); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		} else if installed != nil && backupManager != nil {
+			backupManager.SetServerBinaries(backup.ServerBinaries{URL: installed.URL, ETag: installed.ETag, Version: installed.Version})
+		}
+	}
+
+	if err := restarter.StartServer(); err != nil {
+		if downloadErr != nil {
+			return fmt.Errorf("failed to download server binaries: %w", downloadErr)
+		}
+		return err
+	}
+	if downloadErr != nil {
+		return fmt.Errorf("failed to download server binaries: %w", downloadErr)
+	}
+	fmt.Printf("Server updated to %s.\n", u)
+	return nil
+}
+
+// loadHeartbeatSender returns the heartbeat sender configured by
+// HEARTBEAT_URL, HEARTBEAT_INTERVAL, HEARTBEAT_SECRET, and HEARTBEAT_ID, without
+// its Collect function. Returns nil if heartbeats are disabled.
+func loadHeartbeatSender() (*heartbeat.Sender, error) {
+	rawURL := strings.TrimSpace(os.Getenv("HEARTBEAT_URL"))
+	if rawURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid HEARTBEAT_URL: must be an http or https URL, got %q", rawURL)
+	}
+
+	sender := &heartbeat.Sender{
+		URL:      rawURL,
+		Interval: heartbeat.DefaultInterval,
+		Secret:   os.Getenv("HEARTBEAT_SECRET"),
+		ID:       strings.TrimSpace(os.Getenv("HEARTBEAT_ID")),
+	}
+	if s := os.Getenv("HEARTBEAT_INTERVAL"); s != "" {
+		interval, err := backup.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HEARTBEAT_INTERVAL: %w", err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("HEARTBEAT_INTERVAL must be positive, got %v", interval)
+		}
+		sender.Interval = interval
+	}
+	return sender, nil
+}
+
+// collectHeartbeat reports the current state of the server for a heartbeat.
+// backupManager is nil when backups are disabled.
+func collectHeartbeat(srv *server.Server, playerChecker *backup.PlayerChecker, backupManager *backup.Manager, resticVersion backup.ResticVersion) heartbeat.Report {
+	report := heartbeat.Report{
+		ServerUp:      srv.Running() && srv.HasBooted(),
+		PlayersOnline: playerChecker.PlayerCount(),
+		Versions:      heartbeat.Versions{Game: srv.GameVersion()},
+	}
+	if !resticVersion.IsZero() {
+		report.Versions.Restic = resticVersion.String()
+	}
+
+	if backupManager != nil {
+		status := backupManager.Status()
+		state := backupManager.State()
+		report.Backup = &heartbeat.BackupReport{
+			State: string(state.State),
+			Stage: string(state.Stage),
+		}
+		if !status.LastAttempt.IsZero() {
+			report.Backup.LastAttempt = &status.LastAttempt
+		}
+		if last, ok := backupManager.LastSuccessfulBackup(); ok {
+			report.Backup.LastSuccess = &last
+		}
+		if status.LastError != nil {
+			report.Backup.LastError = status.LastError.Error()
+		}
+		if status.Drift != nil {
+			total := status.Drift.Total()
+			report.Backup.Drift = &heartbeat.DriftReport{
+				Measured: status.DriftMeasured,
+				Rows:     total.Rows(),
+				Chunks:   status.Drift.Tables["chunk"].Rows(),
+				Bytes:    total.Bytes,
+			}
+		}
+	}
+	return report
+}
+
+// loadRCONClient returns the RCON client configured by COMMAND_CHANNEL,
+// RCON_ADDRESS, and RCON_PASSWORD. Returns nil if commands go to stdin.
+func loadRCONClient() (*server.RCONClient, error) {
+	switch channel := strings.ToLower(strings.TrimSpace(os.Getenv("COMMAND_CHANNEL"))); channel {
+	case "", "stdin":
+		return nil, nil
+	case "rcon":
+	default:
+		return nil, fmt.Errorf("invalid COMMAND_CHANNEL: must be stdin or rcon, got %q", channel)
+	}
+
+	address := strings.TrimSpace(os.Getenv("RCON_ADDRESS"))
+	if address == "" {
+		return nil, fmt.Errorf("COMMAND_CHANNEL is rcon but RCON_ADDRESS is not set")
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, fmt.Errorf("invalid RCON_ADDRESS: %w", err)
+	}
+	return &server.RCONClient{Address: address, Password: os.Getenv("RCON_PASSWORD")}, nil
+}
+
+// loadRawUploader returns the object storage uploader for raw backup files
+// configured by the VCDBS_UPLOAD_* variables. Returns nil if
+// VCDBS_UPLOAD_BUCKET isn't set.
+func loadRawUploader() (*objstore.Uploader, error) {
+	bucket := strings.TrimSpace(os.Getenv("VCDBS_UPLOAD_BUCKET"))
+	if bucket == "" {
+		return nil, nil
+	}
+
+	client := &objstore.Client{
+		Endpoint:        strings.TrimSpace(os.Getenv("VCDBS_UPLOAD_ENDPOINT")),
+		Region:          strings.TrimSpace(os.Getenv("VCDBS_UPLOAD_REGION")),
+		Bucket:          bucket,
+		AccessKeyID:     os.Getenv("VCDBS_UPLOAD_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("VCDBS_UPLOAD_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("VCDBS_UPLOAD_SESSION_TOKEN"),
+		PathStyle:       backup.ParseBoolEnv(os.Getenv("VCDBS_UPLOAD_PATH_STYLE")),
+	}
+	if client.Region == "" {
+		client.Region = objstore.DefaultRegion
+	}
+	if client.Endpoint == "" {
+		client.Endpoint = "https://s3." + client.Region + ".amazonaws.com"
+	}
+	if client.AccessKeyID == "" && client.SecretAccessKey == "" {
+		client.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		client.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if client.SessionToken == "" {
+			client.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+	}
+	if client.AccessKeyID == "" || client.SecretAccessKey == "" {
+		return nil, fmt.Errorf("VCDBS_UPLOAD_BUCKET is set but no access key is configured")
+	}
+	uploader := &objstore.Uploader{Client: client, Prefix: os.Getenv("VCDBS_UPLOAD_PREFIX")}
+	if s := os.Getenv("VCDBS_UPLOAD_KEEP"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid VCDBS_UPLOAD_KEEP: must be a non-negative integer, got %q", s)
+		}
+		uploader.Keep = n
+	}
+	return uploader, nil
+}
+
+// runScript sends the commands in the script file at path to the server,
+// reporting each line that fails.
+func runScript(ctx context.Context, cmdQueue *server.CommandQueue, path string) {
+	lines, err := server.LoadScript(path)
+	if err != nil {
+		fmt.Printf("Script failed: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Running script %s (%d commands)...\n", path, len(lines))
+	failed := cmdQueue.RunScript(ctx, server.SourceScript+":"+path, lines, func(line server.ScriptLine, err error) {
+		fmt.Printf("%s:%d: %s: %v\n", path, line.Line, line.Command, err)
+	})
+	if failed > 0 {
+		fmt.Printf("Script %s finished with %d failed command(s).\n", path, failed)
+		return
+	}
+	fmt.Printf("Script %s finished.\n", path)
+}
+
+// defaultTailLines is how many lines !tail prints without an argument.
+const defaultTailLines = 100
+
+// printRecentOutput prints the server's latest output lines, for the !tail
+// command. args may hold the number of lines.
+func printRecentOutput(srv *server.Server, args []string) {
+	n := defaultTailLines
+	if len(args) > 1 {
+		fmt.Println("Usage: !tail [lines]")
+		return
+	}
+	if len(args) == 1 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n <= 0 {
+			fmt.Println("Usage: !tail [lines]")
+			return
+		}
+	}
+
+	lines := srv.RecentOutput(n)
+	if len(lines) == 0 {
+		fmt.Println("No server output recorded yet.")
+		return
+	}
+	fmt.Printf("--- Last %d lines of server output ---\n", len(lines))
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	fmt.Println("--- End of server output ---")
+}
+
+// runRollback handles the !rollback command: with a snapshot ID (or
+// "latest"), it restores that snapshot's world while the server runs;
+// "confirm" swaps it in and "cancel" discards it. Without arguments, it
+// reports the prepared rollback.
+func runRollback(ctx context.Context, m *backup.Manager, args []string) {
+	const usage = "Usage: !rollback <snapshot|latest> | !rollback confirm | !rollback cancel"
+	if len(args) > 1 {
+		fmt.Println(usage)
+		return
+	}
+
+	if len(args) == 0 {
+		pending, err := m.PendingRollback()
+		switch {
+		case err != nil:
+			fmt.Printf("Rollback failed: %v\n", err)
+		case pending == nil:
+			fmt.Println(usage)
+		default:
+			fmt.Printf("A rollback to snapshot %s was prepared at %s. Run !rollback confirm to swap it in, or !rollback cancel to discard it.\n",
+				pending.Snapshot, pending.Prepared.Format(time.RFC3339))
+		}
+		return
+	}
+
+	switch args[0] {
+	case "confirm":
+		fmt.Println("Rolling back the world...")
+		if err := m.ConfirmRollback(ctx); err != nil {
+			fmt.Printf("Rollback failed: %v\n", err)
+			return
+		}
+		fmt.Println("Rollback complete.")
+	case "cancel":
+		if err := m.CancelRollback(); err != nil {
+			fmt.Printf("Rollback failed: %v\n", err)
+			return
+		}
+		fmt.Println("Prepared rollback discarded.")
+	default:
+		fmt.Printf("Preparing rollback to snapshot %s while the server keeps running...\n", args[0])
+		state, err := m.PrepareRollback(ctx, args[0])
+		if err != nil {
+			fmt.Printf("Rollback failed: %v\n", err)
+			return
+		}
+		fmt.Printf("Rollback to snapshot %s is ready in %s. Run !rollback confirm to swap it in, or !rollback cancel to discard it.\n",
+			state.Snapshot, state.RestoredPath)
+	}
+}
+
+// runPruneCommand handles !prune dry-run, which shows which snapshots a
+// retention policy, the configured one or one given after it, would remove.
+func runPruneCommand(ctx context.Context, backupManager *backup.Manager, args []string) {
+	if len(args) == 0 || args[0] != "dry-run" {
+		fmt.Println("Usage: !prune dry-run [--keep-* options]")
+		return
+	}
+	if backupManager == nil {
+		fmt.Println("Backups are disabled; there is no repository to prune.")
+		return
+	}
+
+	fmt.Println("Asking restic which snapshots would be removed...")
+	preview, err := backupManager.PreviewForget(ctx, strings.Join(args[1:], " "))
+	if err != nil {
+		fmt.Printf("Prune dry run failed: %v\n", err)
+		return
+	}
+	fmt.Println(preview.Format(time.Now()))
+	fmt.Println("Nothing was removed.")
+}
+
+// runPurgePlayer handles !purge-player: on its own it shows the data a
+// player has in the live world, and with "confirm" it removes it, restarting
+// the server. "snapshot" also takes a backup without the player's data.
+func runPurgePlayer(ctx context.Context, m *backup.Manager, backupsEnabled bool, args []string) {
+	const usage = "Usage: !purge-player <name|uid> [confirm [snapshot]]"
+	if len(args) == 0 || len(args) > 3 || (len(args) > 1 && args[1] != "confirm") || (len(args) == 3 && args[2] != "snapshot") {
+		fmt.Println(usage)
+		return
+	}
+	player := args[0]
+	snapshot := len(args) == 3
+	if snapshot && !backupsEnabled {
+		fmt.Println("Backups are disabled; purge without snapshot, or enable backups.")
+		return
+	}
+
+	if len(args) == 1 {
+		found, err := m.PreviewPurge(ctx, player)
+		if err != nil {
+			fmt.Printf("Purge failed: %v\n", err)
+			return
+		}
+		fmt.Printf("Player %s has %d savegame rows and %d entries in Playerdata/playerdata.json.\n",
+			purgePlayerName(found), found.SaveRows, found.PlayerdataEntries)
+		fmt.Printf("Run !purge-player %s confirm to remove them (the server restarts), or !purge-player %s confirm snapshot to also take a snapshot without them.\n",
+			found.PlayerUID, found.PlayerUID)
+		fmt.Println("Older snapshots keep the data until they are removed with restic forget.")
+		return
+	}
+
+	removed, err := m.PurgePlayer(ctx, player, snapshot)
+	if removed != nil {
+		fmt.Printf("Removed %d savegame rows and %d playerdata.json entries of player %s.\n",
+			removed.SaveRows, removed.PlayerdataEntries, purgePlayerName(removed))
+	}
+	if err != nil {
+		fmt.Printf("Purge failed: %v\n", err)
+		return
+	}
+	if removed.Snapshot {
+		fmt.Println("The latest snapshot no longer contains the player's data.")
+	}
+	fmt.Println("Older snapshots, local .vcdbs copies, and Backups still contain it until they are removed.")
+}
+
+// purgePlayerName formats a player for !purge-player output.
+func purgePlayerName(r *backup.PurgeResult) string {
+	if r.PlayerName == "" {
+		return r.PlayerUID
+	}
+	return fmt.Sprintf("%s (%s)", r.PlayerName, r.PlayerUID)
+}
+
+// auditCoverage prints the top-level paths in the game data directory that
+// aren't in the staging tree, for the !audit command.
+func auditCoverage(backupManager *backup.Manager) {
+	if backupManager == nil {
+		fmt.Println("Backups are disabled; nothing in /gamedata is backed up.")
+		return
+	}
+
+	uncovered, err := backupManager.UncoveredPaths()
+	if err != nil {
+		fmt.Printf("Audit failed: %v\n", err)
+		return
+	}
+	if len(uncovered) == 0 {
+		fmt.Printf("Every top-level path in %s is backed up.\n", backupManager.GameDataDir)
+		return
+	}
+	fmt.Printf("Not backed up from %s:\n", backupManager.GameDataDir)
+	for _, name := range uncovered {
+		fmt.Printf("  %s\n", name)
+	}
+}
+
+// runRepoCommand handles !repo, which reports on the restic repository
+// without needing restic or its credentials outside the container.
+func runRepoCommand(ctx context.Context, backupManager *backup.Manager, args []string) {
+	if len(args) != 1 || args[0] != "stats" {
+		fmt.Println("Usage: !repo stats")
+		return
+	}
+	if backupManager == nil {
+		fmt.Println("Backups are disabled; there is no repository to report on.")
+		return
+	}
+
+	fmt.Println("Gathering repository statistics...")
+	stats, err := backupManager.RepositoryStats(ctx)
+	if err != nil {
+		fmt.Printf("Repository stats failed: %v\n", err)
+		return
+	}
+	fmt.Println(stats.Format(time.Now()))
+}
+
+// runSnapshotCommand handles !snapshot, which pins snapshots so pruning
+// never removes them, and unpins them.
+func runSnapshotCommand(ctx context.Context, backupManager *backup.Manager, args []string) {
+	if len(args) != 2 || (args[0] != "pin" && args[0] != "unpin") {
+		fmt.Println("Usage: !snapshot pin <snapshot> | !snapshot unpin <snapshot>")
+		return
+	}
+	if backupManager == nil {
+		fmt.Println("Backups are disabled; there are no snapshots to pin.")
+		return
+	}
+
+	snapshot := args[1]
+	if args[0] == "pin" {
+		if err := backupManager.PinSnapshot(ctx, snapshot); err != nil {
+			fmt.Printf("Pinning snapshot %s failed: %v\n", snapshot, err)
+			return
+		}
+		fmt.Printf("Snapshot %s is pinned and will be kept whatever the retention policy.\n", snapshot)
+		return
+	}
+	if err := backupManager.UnpinSnapshot(ctx, snapshot); err != nil {
+		fmt.Printf("Unpinning snapshot %s failed: %v\n", snapshot, err)
+		return
+	}
+	fmt.Printf("Snapshot %s is unpinned and left to the retention policy.\n", snapshot)
+}
+
+// runBackupCommand handles !backup, which reports what the backup system is
+// doing and changes its settings.
+func runBackupCommand(ctx context.Context, backupManager *backup.Manager, args []string) {
+	const usage = "Usage: !backup status | !backup drift | !backup set interval <duration> | !backup set pause-when-no-players <on|off> | !backup set retention <options|off>"
+	if len(args) == 0 || ((args[0] == "status" || args[0] == "drift") && len(args) != 1) ||
+		(args[0] != "status" && args[0] != "drift" && args[0] != "set") {
+		fmt.Println(usage)
+		return
+	}
+	if backupManager == nil {
+		fmt.Println("Backups are disabled.")
+		return
+	}
+	if args[0] == "set" {
+		if len(args) < 3 {
+			fmt.Println(usage)
+			return
+		}
+		setBackupSetting(backupManager, args[1], strings.Join(args[2:], " "))
+		return
+	}
+	if args[0] == "drift" {
+		go runBackupDrift(ctx, backupManager)
+		return
+	}
+
+	state := backupManager.State()
+	fmt.Printf("Backup state: %s", state)
+	if !state.Since.IsZero() {
+		fmt.Printf(" (for %s)", time.Since(state.Since).Round(time.Second))
+	}
+	fmt.Println()
+	status := backupManager.Status()
+	if !status.LastAttempt.IsZero() {
+		fmt.Printf("Last attempt: %s\n", status.LastAttempt.Format(time.RFC3339))
+	}
+	if last, ok := backupManager.LastSuccessfulBackup(); ok {
+		fmt.Printf("Last success: %s\n", last.Format(time.RFC3339))
+	}
+	settings := backupManager.Settings()
+	retention := settings.PruneRetention
+	if retention == "" {
+		retention = "off"
+	}
+	fmt.Printf("Interval: %v, pause when no players: %v, retention: %s\n",
+		settings.Interval, settings.PauseWhenNoPlayers, retention)
+	if status.Drift != nil {
+		fmt.Printf("Drift from the last backup (%s ago): %s\n",
+			time.Since(status.DriftMeasured).Round(time.Second), status.Drift)
+	}
+	if status.IntegrityMismatch != "" {
+		fmt.Printf("Last snapshot may be incomplete: %s\n", status.IntegrityMismatch)
+	}
+	if stats := status.LastStats; stats != nil {
+		fmt.Printf("Last snapshot: %s\n", stats)
+		fmt.Printf("Staged files changed: %s\n", stats.Staging)
+	}
+}
+
+// runBackupDrift handles !backup drift, reporting how much of the live world
+// has changed since the last backup.
+func runBackupDrift(ctx context.Context, backupManager *backup.Manager) {
+	fmt.Println("Comparing the live world with the last backup...")
+	drift, err := backupManager.MeasureDrift(ctx)
+	if err != nil {
+		fmt.Printf("Drift measurement failed: %v\n", err)
+		return
+	}
+	if drift.Total().Rows() == 0 {
+		fmt.Println("No changes since the last backup.")
+		return
+	}
+	fmt.Printf("Changed since the last backup: %s\n", drift)
+}
+
+// setBackupSetting handles !backup set, changing a backup setting until the
+// launcher restarts.
+func setBackupSetting(backupManager *backup.Manager, name, value string) {
+	switch name {
+	case "interval":
+		interval, err := backup.ParseDuration(value)
+		if err == nil {
+			err = backupManager.SetInterval(interval)
+		}
+		if err != nil {
+			fmt.Printf("Invalid interval: %v\n", err)
+			return
+		}
+		fmt.Printf("Backup interval set to %v; the next backup is in %v.\n", interval, interval)
+	case "pause-when-no-players":
+		var pause bool
+		switch strings.ToLower(value) {
+		case "on", "true":
+			pause = true
+		case "off", "false":
+		default:
+			fmt.Println("Usage: !backup set pause-when-no-players <on|off>")
+			return
+		}
+		backupManager.SetPauseWhenNoPlayers(pause)
+		fmt.Printf("Pause when no players set to %v.\n", pause)
+	case "retention":
+		if strings.EqualFold(value, "off") {
+			value = ""
+		}
+		if err := backupManager.SetPruneRetention(value); err != nil {
+			fmt.Printf("Invalid retention: %v\n", err)
+			return
+		}
+		if value == "" {
+			fmt.Println("Pruning disabled.")
+			return
+		}
+		fmt.Printf("Prune retention set to %s.\n", backupManager.Settings().PruneRetention)
+	default:
+		fmt.Printf("Unknown backup setting %q: expected interval, pause-when-no-players, or retention\n", name)
+		return
+	}
+	fmt.Println("This lasts until the launcher restarts; update the environment variables to keep it.")
+}
+
+// loadAuditLog returns the command audit log configured by COMMAND_AUDIT_LOG,
+// creating its directory. Returns nil if auditing is disabled.
+func loadAuditLog() (*server.AuditLog, error) {
+	path := strings.TrimSpace(os.Getenv("COMMAND_AUDIT_LOG"))
+	if path == "" {
+		return nil, nil
+	}
+
+	auditLog := &server.AuditLog{Path: path}
+	if s := os.Getenv("COMMAND_AUDIT_MAX_FILES"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid COMMAND_AUDIT_MAX_FILES: must be a positive integer, got %q", s)
+		}
+		auditLog.MaxFiles = n
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create command audit log directory: %w", err)
+	}
+	return auditLog, nil
+}
+
+// commandPolicyChannels are the command sources whose commands can be
+// restricted, with the environment variable holding their policy.
+var commandPolicyChannels = []struct{ source, env string }{
+	{server.SourceStdin, "COMMAND_POLICY_STDIN"},
+	{server.SourceScript, "COMMAND_POLICY_SCRIPT"},
+}
+
+// loadCommandPolicies loads the command policies of commandPolicyChannels.
+// Channels without one aren't restricted.
+func loadCommandPolicies() (map[string]*server.CommandPolicy, error) {
+	policies := make(map[string]*server.CommandPolicy)
+	for _, channel := range commandPolicyChannels {
+		s := strings.TrimSpace(os.Getenv(channel.env))
+		if s == "" {
+			continue
+		}
+		policy, err := server.ParseCommandPolicy(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", channel.env, err)
+		}
+		policies[channel.source] = policy
+	}
+	return policies, nil
+}
+
+// startOutput sets up the launcher's output chain: a timestamp in front of
+// each line if LOG_TIMESTAMPS is set, then, when stdin is a terminal, the
+// interactive console, which draws output above its prompt once started.
+// Timestamps are added before lines reach the console, so the prompt it
+// draws isn't stamped. Returns the console unstarted, or nil if input isn't
+// a terminal, and a nil redirect if output goes straight to stdout.
+func startOutput(input console.Input) (*outputRedirect, *console.Console, error) {
+	loc, err := loadTimestampLocation()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var con *console.Console
+	if input == console.InputTerminal {
+		con = &console.Console{HistoryPath: commandHistoryPath, Output: os.Stdout}
+	}
+	if loc == nil && con == nil {
+		return nil, nil, nil
+	}
+
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	if con != nil {
+		stdout, stderr = con, con
+	}
+	if loc != nil {
+		stdout = &logtime.Writer{W: stdout, Location: loc}
+		stderr = &logtime.Writer{W: stderr, Location: loc}
+	}
+
+	output, err := startOutputRedirect(stdout, stderr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to redirect output: %w", err)
+	}
+	return output, con, nil
+}
+
+// loadTimestampLocation returns the timezone output is timestamped in, from
+// LOG_TIMEZONE, or nil if LOG_TIMESTAMPS isn't set.
+func loadTimestampLocation() (*time.Location, error) {
+	if !backup.ParseBoolEnv(os.Getenv("LOG_TIMESTAMPS")) {
+		return nil, nil
+	}
+
+	loc, err := logtime.LoadLocation(os.Getenv("LOG_TIMEZONE"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOG_TIMEZONE: %w", err)
+	}
+	return loc, nil
+}
+
+// startDiagnostics starts the pprof server and runtime stats logger if enabled.
+// Both run until the process exits.
+func startDiagnostics() error {
+	if backup.ParseBoolEnv(os.Getenv("DEBUG_PPROF")) {
+		pprofServer := &diagnostics.PprofServer{}
+		if s := os.Getenv("DEBUG_PPROF_PORT"); s != "" {
+			port, err := strconv.Atoi(s)
+			if err != nil || port <= 0 || port > 65535 {
+				return fmt.Errorf("invalid DEBUG_PPROF_PORT: %q", s)
+			}
+			pprofServer.Port = port
+		}
+		if err := pprofServer.Start(); err != nil {
+			return err
+		}
+		fmt.Printf("pprof endpoints available at http://%s/debug/pprof/\n", pprofServer.Addr())
+	}
+
+	if s := os.Getenv("DEBUG_RUNTIME_STATS_INTERVAL"); s != "" {
+		interval, err := backup.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid DEBUG_RUNTIME_STATS_INTERVAL: %w", err)
+		}
+		statsLogger := &diagnostics.StatsLogger{Interval: interval}
+		if err := statsLogger.Start(); err != nil {
+			return fmt.Errorf("failed to start runtime stats logger: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// serverRestarter implements backup.ServerRestarter for the launcher's server.
+// While the server is deliberately stopped, pending returns a channel so the
+// main loop can tell a planned stop from the server exiting on its own.
+type serverRestarter struct {
+	srv *server.Server
+
+	// ctx is the launcher's context; the server is run under serverCtx.
+	ctx       context.Context
+	serverCtx context.Context
+
+	// notice warns players before the server is stopped. Optional.
+	notice *server.ShutdownNotice
+
+	// shutdown is how the server is stopped.
+	shutdown *server.ShutdownPolicy
+
+	mu         sync.Mutex
+	restarting chan struct{}
+	startErr   error
+}
+
+// StopServer gracefully stops the server, killing it if it doesn't exit in time.
+// Players are warned first if a shutdown countdown is configured; cancelling
+// ctx during the countdown leaves the server running.
+func (r *serverRestarter) StopServer(ctx context.Context) error {
+	return r.stopFor(ctx, "restarting")
+}
+
+// stopFor is StopServer with the reason given in the countdown, e.g. "updating".
+func (r *serverRestarter) stopFor(ctx context.Context, reason string) error {
+	if r.notice != nil {
+		if err := r.notice.Run(ctx, reason); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	r.restarting = make(chan struct{})
+	r.startErr = nil
+	r.mu.Unlock()
+
+	if err := r.srv.Shutdown(ctx, r.shutdown); err != nil {
+		r.finish(err)
+		return err
+	}
+	return nil
+}
+
+// StartServer starts the server again under the launcher's context.
+func (r *serverRestarter) StartServer() error {
+	if err := r.ctx.Err(); err != nil {
+		// The launcher is shutting down; leave the server stopped
+		r.finish(err)
+		return err
+	}
+
+	err := r.srv.Start(r.serverCtx)
+	if err == nil {
+		fmt.Printf("Server restarted with PID %d\n", r.srv.PID())
+	}
+	r.finish(err)
+	return err
+}
+
+// finish ends the planned stop, recording why the server isn't running if err is set.
+func (r *serverRestarter) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.restarting == nil {
+		return
+	}
+	if err != nil {
+		r.startErr = fmt.Errorf("failed to restart server: %w", err)
+	}
+	close(r.restarting)
+	r.restarting = nil
+}
+
+// pending returns a channel that is closed once a planned restart finishes,
+// or nil if no restart is in progress.
+func (r *serverRestarter) pending() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.restarting == nil {
+		return nil
+	}
+	return r.restarting
+}
+
+// err returns the error from the last restart, if it failed.
+func (r *serverRestarter) err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.startErr
+}
+
+// readStdinCommands reads commands from stdin and passes them to submit.
 // This allows users to send commands directly to the Vintage Story server.
-func readStdinCommands(ctx context.Context, cmdQueue *server.CommandQueue) {
+func readStdinCommands(ctx context.Context, submit func(string)) {
 	scanner := bufio.NewScanner(os.Stdin)
 	for {
 		select {
@@ -236,13 +1775,14 @@ func readStdinCommands(ctx context.Context, cmdQueue *server.CommandQueue) {
 		if scanner.Scan() {
 			line := scanner.Text()
 			if line != "" {
-				cmdQueue.Submit(line)
+				submit(line)
 			}
 		} else {
 			// EOF or error - stop reading
 			if err := scanner.Err(); err != nil {
 				fmt.Printf("Error reading stdin: %v\n", err)
 			}
+			fmt.Println("stdin closed; no longer reading server commands.")
 			return
 		}
 	}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// outputFlushTimeout bounds how long stopping the output redirect waits for
+// output still in flight, so a stalled terminal can't hang shutdown.
+const outputFlushTimeout = 2 * time.Second
+
+// outputRedirect routes os.Stdout and os.Stderr, and so everything the
+// launcher and its packages print, into writers while it runs. It is the one
+// place the launcher replaces them: timestamps and the interactive console
+// are writers in the chain it copies into.
+type outputRedirect struct {
+	origStdout *os.File
+	origStderr *os.File
+	pipes      []*os.File
+	copyDone   sync.WaitGroup
+}
+
+// startOutputRedirect redirects os.Stdout into stdout and os.Stderr into
+// stderr. The writers should end at the original os.Stdout and os.Stderr,
+// which are restored by Stop.
+func startOutputRedirect(stdout, stderr io.Writer) (*outputRedirect, error) {
+	r := &outputRedirect{origStdout: os.Stdout, origStderr: os.Stderr}
+
+	stdoutPipe, err := r.pipe(stdout)
+	if err != nil {
+		return nil, err
+	}
+	stderrPipe, err := r.pipe(stderr)
+	if err != nil {
+		r.closePipes()
+		return nil, err
+	}
+
+	os.Stdout = stdoutPipe
+	os.Stderr = stderrPipe
+	return r, nil
+}
+
+// pipe returns the write end of a pipe whose output is copied to dst.
+func (r *outputRedirect) pipe(dst io.Writer) (*os.File, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output pipe: %w", err)
+	}
+	r.pipes = append(r.pipes, pw)
+
+	r.copyDone.Add(1)
+	go func() {
+		defer r.copyDone.Done()
+		io.Copy(dst, pr)
+		pr.Close()
+	}()
+	return pw, nil
+}
+
+// Stop restores the original os.Stdout and os.Stderr, flushing any output
+// still in the pipes first, for up to outputFlushTimeout.
+func (r *outputRedirect) Stop() {
+	os.Stdout = r.origStdout
+	os.Stderr = r.origStderr
+	r.closePipes()
+}
+
+// closePipes closes the write ends and waits for the copies to finish.
+func (r *outputRedirect) closePipes() {
+	for _, pw := range r.pipes {
+		pw.Close()
+	}
+	r.pipes = nil
+
+	flushed := make(chan struct{})
+	go func() {
+		r.copyDone.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(outputFlushTimeout):
+		fmt.Fprintln(r.origStderr, "WARNING: Timed out flushing output")
+	}
+}
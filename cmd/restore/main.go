@@ -0,0 +1,378 @@
+// Command restore puts a snapshot restored with `restic restore` back into a
+// game data directory, reassembling each vcdbtree into a .vcdbs savegame.
+//
+// Usage:
+//
+//	restore [--binaries <dir>] [--force] [--skip-verify] <snapshot_dir> <gamedata_dir>
+//	restore [--binaries <dir>] [--force] [--skip-verify] --snapshot <id> [--host <host>] [--tag <tags>] [--target <dir>] [--staging <dir>] <gamedata_dir>
+//
+// The snapshot directory is the staging directory inside the restic restore
+// target, e.g. /tmp/restore/backupcache/staging. With --snapshot, the tool
+// runs restic restore itself, showing its progress; if it is interrupted,
+// running the same command again resumes it. Before anything is written,
+// the server version recorded in the snapshot is compared against the
+// installed server binaries, and restoring a world saved by a newer server
+// into older binaries is refused unless --force is given, and each world
+// tree is checked against the digest recorded in the snapshot unless
+// --skip-verify is given.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/renorris/vintagestory-restic/internal/backup"
+	"github.com/renorris/vintagestory-restic/internal/downloader"
+	"github.com/renorris/vintagestory-restic/internal/snapshotmeta"
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// defaultRestoreTarget is where --snapshot restores to. It is kept after a
+// failed restore so the next attempt can resume.
+const defaultRestoreTarget = "/backupcache/restore"
+
+// progressLogInterval is how often progress is printed when stdout isn't a
+// terminal.
+const progressLogInterval = 10 * time.Second
+
+// progressBarWidth is the number of characters in the progress bar.
+const progressBarWidth = 30
+
+const usage = `restore - Restore a vintagestory-restic snapshot into a game data directory
+
+Usage:
+  restore [--binaries <dir>] [--force] [--skip-verify] <snapshot_dir> <gamedata_dir>
+      Reassemble each tree under <snapshot_dir>/Saves into a .vcdbs savegame in
+      <gamedata_dir>/Saves, and copy the other backed up files (Playerdata,
+      Mods, config files) into <gamedata_dir>. Stop the server first.
+
+      <snapshot_dir> is the staging directory inside the restic restore target.
+      Existing savegames are never overwritten; move them aside first.
+      Trees are checked against the digests recorded in the snapshot before
+      anything is written.
+
+  restore [--binaries <dir>] [--force] [--skip-verify] --snapshot <id> [--host <host>] [--tag <tags>]
+          [--target <dir>] [--staging <dir>] <gamedata_dir>
+      Run restic restore for the snapshot (an ID or "latest") first, showing
+      its progress, then restore it as above. If the restic restore is
+      interrupted, run the same command again: with restic 0.17 or newer,
+      files already restored are verified by hash and skipped.
+
+Options:
+  --binaries <dir>   Server binaries to check the snapshot against (default /serverbinaries)
+  --force            Restore even if the snapshot was saved by a newer server version
+  --skip-verify      Restore even if a tree doesn't match the digest recorded in the snapshot
+  --snapshot <id>    restic snapshot to restore from the repository
+  --host <host>      With --snapshot latest, only consider snapshots of this host
+  --tag <tags>       With --snapshot latest, only consider snapshots with these
+                     comma-separated tags, e.g. world=survival,snapshot_set=world
+  --target <dir>     Where restic restores to (default /backupcache/restore); removed on success
+  --staging <dir>    Staging directory the snapshot was taken of (default /backupcache/staging)
+
+Examples:
+  restic restore latest --target /tmp/restore
+  restore /tmp/restore/backupcache/staging /gamedata
+
+  restore --snapshot latest --host survival /gamedata
+`
+
+func main() {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	binariesDir := flags.String("binaries", "/serverbinaries", "server binaries to check the snapshot against")
+	force := flags.Bool("force", false, "restore even if the snapshot was saved by a newer server version")
+	skipVerify := flags.Bool("skip-verify", false, "restore even if a tree doesn't match the snapshot's recorded digest")
+	snapshot := flags.String("snapshot", "", "restic snapshot to restore from the repository")
+	target := flags.String("target", defaultRestoreTarget, "where restic restores to")
+	stagingDir := flags.String("staging", backup.DefaultStagingDir, "staging directory the snapshot was taken of")
+	host := flags.String("host", "", "with --snapshot latest, only consider snapshots of this host")
+	tags := flags.String("tag", "", "with --snapshot latest, only consider snapshots with these tags")
+	flags.Parse(os.Args[1:])
+
+	wantArgs := 2
+	if *snapshot != "" {
+		wantArgs = 1
+	}
+	if flags.NArg() != wantArgs {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+	gameDataDir := flags.Arg(wantArgs - 1)
+
+	// Cancel long-running operations on Ctrl+C
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	start := time.Now()
+	snapshotDir := flags.Arg(0)
+	if *snapshot != "" {
+		snapshotDir = filepath.Join(*target, *stagingDir)
+		var filter []string
+		if *host != "" {
+			filter = append(filter, "--host", *host)
+		}
+		if *tags != "" {
+			filter = append(filter, "--tag", *tags)
+		}
+		if err := resticRestore(ctx, *snapshot, *target, *stagingDir, filter); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			if ctx.Err() == nil {
+				fmt.Fprintln(os.Stderr, "Run the same command again to resume the restore.")
+			}
+			os.Exit(1)
+		}
+	}
+
+	if err := checkCompatibility(snapshotDir, *binariesDir, *force); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := restore(ctx, snapshotDir, gameDataDir, *skipVerify); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *snapshot != "" {
+		if err := os.RemoveAll(*target); err != nil {
+			fmt.Printf("Warning: failed to remove %s: %v\n", *target, err)
+		}
+	}
+	fmt.Printf("Restore complete in %v\n", time.Since(start))
+}
+
+// resticRestore restores the staging directory of snapshot into target,
+// reporting progress. filter selects the snapshot "latest" refers to. Files
+// already in target with the right content, from an earlier attempt, are
+// skipped if restic supports it.
+func resticRestore(ctx context.Context, snapshot, target, stagingDir string, filter []string) error {
+	_, version, err := backup.DetectRestic(ctx)
+	if err != nil {
+		return err
+	}
+
+	args, resumable := backup.ResticRestoreArgs(snapshot, target, []string{stagingDir}, version)
+	if !resumable {
+		fmt.Printf("Warning: restic %s can't resume restores or report progress; 0.17 or newer can\n", version)
+	}
+	if _, err := os.Stat(target); err == nil && resumable {
+		fmt.Printf("Resuming restore into %s\n", target)
+	} else {
+		fmt.Printf("Restoring snapshot %s into %s\n", snapshot, target)
+	}
+
+	cmd := exec.CommandContext(ctx, "restic", append(args, filter...)...)
+	cmd.Stderr = os.Stderr
+	if !resumable {
+		cmd.Stdout = os.Stdout
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("restic restore failed: %w", err)
+		}
+		return nil
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to read restic output: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start restic: %w", err)
+	}
+
+	progress := newProgressPrinter()
+	summary, parseErr := backup.ParseResticRestoreOutput(stdout, progress, progress.update)
+	progress.finish()
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("restic restore failed: %w", err)
+	}
+	if parseErr != nil {
+		return fmt.Errorf("failed to read restic output: %w", parseErr)
+	}
+	if summary != nil {
+		fmt.Printf("Restored %s\n", summary)
+	}
+	return nil
+}
+
+// progressPrinter shows restore progress: as a bar redrawn in place on a
+// terminal, and as a line every progressLogInterval otherwise. Other output
+// is written on lines of its own.
+type progressPrinter struct {
+	terminal bool
+	drawn    bool
+	lastLog  time.Time
+}
+
+func newProgressPrinter() *progressPrinter {
+	return &progressPrinter{terminal: term.IsTerminal(int(os.Stdout.Fd()))}
+}
+
+func (p *progressPrinter) update(progress backup.RestoreProgress) {
+	if !p.terminal {
+		if time.Since(p.lastLog) >= progressLogInterval {
+			fmt.Println(progress)
+			p.lastLog = time.Now()
+		}
+		return
+	}
+
+	filled := int(progress.PercentDone * progressBarWidth)
+	filled = max(0, min(filled, progressBarWidth))
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", progressBarWidth-filled)
+	fmt.Printf("\r\033[K[%s] %s", bar, progress)
+	p.drawn = true
+}
+
+// Write prints other output, moving past the progress bar first.
+func (p *progressPrinter) Write(b []byte) (int, error) {
+	p.finish()
+	return os.Stdout.Write(b)
+}
+
+// finish ends the line the progress bar is drawn on.
+func (p *progressPrinter) finish() {
+	if p.drawn {
+		fmt.Println()
+		p.drawn = false
+	}
+}
+
+// checkCompatibility compares the snapshot's server version against the
+// installed binaries. A snapshot from a newer server is refused unless force.
+func checkCompatibility(snapshotDir, binariesDir string, force bool) error {
+	meta, err := snapshotmeta.Read(snapshotDir)
+	if err != nil {
+		return err
+	}
+	if meta == nil || meta.ServerVersion == "" {
+		fmt.Println("Warning: snapshot has no recorded server version; can't check compatibility")
+		return nil
+	}
+	fmt.Printf("Snapshot was saved by server version %s\n", meta.ServerVersion)
+
+	installed, err := downloader.InstalledVersion(binariesDir)
+	if err != nil {
+		return err
+	}
+	if installed == nil || installed.Version == "" {
+		fmt.Printf("Warning: can't tell which server version is installed in %s; can't check compatibility\n", binariesDir)
+		return nil
+	}
+	fmt.Printf("Installed server version is %s\n", installed.Version)
+
+	if err := backup.CheckServerCompatibility(meta, installed.Version); err != nil {
+		if force && errors.Is(err, backup.ErrSnapshotTooNew) {
+			fmt.Printf("Warning: restoring into older server version %s (--force)\n", installed.Version)
+			return nil
+		}
+		return fmt.Errorf("%w; loading it in an older server can corrupt the world. Update the server binaries, or use --force to restore anyway", err)
+	}
+	return nil
+}
+
+// verifyTrees checks each tree under the snapshot's Saves directory against
+// the digest recorded in its metadata, so a restore is known to be
+// bit-identical to what was backed up before anything is combined.
+func verifyTrees(ctx context.Context, snapshotDir string, trees []os.DirEntry, skipVerify bool) error {
+	meta, err := snapshotmeta.Read(snapshotDir)
+	if err != nil {
+		return err
+	}
+	for _, tree := range trees {
+		if !tree.IsDir() {
+			continue
+		}
+		fmt.Printf("Verifying %s...\n", tree.Name())
+		verified, err := backup.VerifyTreeDigest(ctx, meta, tree.Name(), filepath.Join(snapshotDir, "Saves", tree.Name()))
+		switch {
+		case err != nil && skipVerify:
+			fmt.Printf("Warning: %v (--skip-verify)\n", err)
+		case err != nil:
+			return fmt.Errorf("%w. Restore the snapshot again, or use --skip-verify to restore anyway", err)
+		case !verified:
+			fmt.Printf("Warning: snapshot has no recorded digest for %s; can't verify it\n", tree.Name())
+		default:
+			fmt.Printf("%s matches the snapshot's digest\n", tree.Name())
+		}
+	}
+	return nil
+}
+
+// restore combines the snapshot's trees into savegames and copies everything
+// else into gameDataDir. Trees are first checked against the digests in the
+// snapshot's metadata; a mismatch is an error unless skipVerify.
+func restore(ctx context.Context, snapshotDir, gameDataDir string, skipVerify bool) error {
+	entries, err := os.ReadDir(snapshotDir)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	// Check every save up front so a partial restore can't happen
+	savesDir := filepath.Join(snapshotDir, "Saves")
+	trees, err := os.ReadDir(savesDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read saves: %w", err)
+	}
+	for _, tree := range trees {
+		if !tree.IsDir() {
+			continue
+		}
+		outputDB := filepath.Join(gameDataDir, "Saves", tree.Name()+".vcdbs")
+		if _, err := os.Stat(outputDB); err == nil {
+			return fmt.Errorf("%s already exists; move it aside before restoring", outputDB)
+		}
+	}
+	if err := verifyTrees(ctx, snapshotDir, trees, skipVerify); err != nil {
+		return err
+	}
+
+	for _, tree := range trees {
+		if !tree.IsDir() {
+			continue
+		}
+		outputDB := filepath.Join(gameDataDir, "Saves", tree.Name()+".vcdbs")
+		if err := os.MkdirAll(filepath.Dir(outputDB), 0755); err != nil {
+			return fmt.Errorf("failed to create Saves directory: %w", err)
+		}
+
+		fmt.Printf("Combining %s -> %s\n", tree.Name(), outputDB)
+		if err := vcdbtree.CombineContext(ctx, filepath.Join(savesDir, tree.Name()), outputDB, nil); err != nil {
+			return fmt.Errorf("failed to combine %s: %w", tree.Name(), err)
+		}
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == "Saves" || name == backup.MetadataFileName {
+			continue
+		}
+		src := filepath.Join(snapshotDir, name)
+		dst := filepath.Join(gameDataDir, name)
+
+		if entry.IsDir() {
+			written, _, err := vcdbtree.CopyDirIfChanged(src, dst)
+			if err != nil {
+				return fmt.Errorf("failed to restore %s: %w", name, err)
+			}
+			fmt.Printf("Restored %s (%d files changed)\n", name, written)
+			continue
+		}
+		if _, err := vcdbtree.CopyFileIfChanged(src, dst); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", name, err)
+		}
+		fmt.Printf("Restored %s\n", name)
+	}
+
+	return nil
+}
@@ -3,29 +3,40 @@
 //
 // Usage:
 //
-//	vcdbtree split <input.vcdbs> <output_dir>
+//	vcdbtree split [--deterministic] [--world-width <blocks>] [--layout <layout>] [--progress <interval>] <input.vcdbs> <output_dir>
 //	    Convert a .vcdbs SQLite database into a vcdbtree directory structure.
 //
-//	vcdbtree combine <input_dir> <output.vcdbs>
+//	vcdbtree combine [--verify] <input_dir> <output.vcdbs>
 //	    Reconstruct a .vcdbs SQLite database from a vcdbtree directory structure.
 //
+//	vcdbtree trim [--world-width <blocks>] <tree_dir> <x,z,radius>...
+//	    Remove chunks, mapchunks, and mapregions outside the given areas.
+//
+//	vcdbtree scan [--world-width <blocks>] <input.vcdbs>
+//	    Report chunks, mapchunks, and mapregions whose data looks corrupt.
+//
 // The vcdbtree format uses hex-sharded subdirectories for position-based tables
 // (chunk, mapchunk, mapregion) and flat directories for small tables (gamedata,
 // playerdata). This format maximizes Restic's deduplication efficiency.
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/renorris/vintagestory-restic/internal/vcdbtree"
+	"github.com/renorris/vintagestory-restic/internal/snapshotmeta"
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
 )
 
 const usage = `vcdbtree - Convert Vintage Story .vcdbs savegames to/from deduplication-optimized format
 
 Usage:
-  vcdbtree split <input.vcdbs> <output_dir>
+  vcdbtree split [--deterministic] [--world-width <blocks>] [--layout <layout>] [--progress <interval>] <input.vcdbs> <output_dir>
       Convert a .vcdbs SQLite database into a vcdbtree directory structure.
       The output directory will contain:
         - chunks/      2-level hex-sharded directory for chunk table
@@ -33,13 +44,42 @@ Usage:
         - mapregions/  2-level hex-sharded directory for mapregion table
         - gamedata/    flat directory for gamedata table
         - playerdata/  flat directory for playerdata table
+      With --deterministic, identical databases produce byte-identical trees,
+      including file modes and modification times (set to the Unix epoch).
+      --world-width is the world width in blocks (default 1024000), needed to
+      place map chunks and map regions in the right directories.
+      --layout selects how chunks, mapchunks, and mapregions are sharded:
+      geographic (default) by cell coordinates, or hex[:<levels>[:<fanout>]]
+      by a hash of the position, e.g. hex:3:16. Combine detects the layout.
+      Progress (rows/s, MiB/s, and an estimate of the time left) is printed
+      every --progress interval (default 10s); 0 turns it off.
 
-  vcdbtree combine <input_dir> <output.vcdbs>
+  vcdbtree combine [--verify] <input_dir> <output.vcdbs>
       Reconstruct a .vcdbs SQLite database from a vcdbtree directory structure.
+      If the tree was restored from a backup snapshot, the server version that
+      saved it is printed. Use restore to check it against the installed server.
+      With --verify, the database is built next to the output, checked with
+      SQLite's integrity check and against the tree's row counts, and only
+      then moved into place. A failed check leaves any existing output alone.
+
+  vcdbtree trim [--world-width <blocks>] <tree_dir> <x,z,radius>...
+      Remove chunks, mapchunks, and mapregions that lie entirely outside all of
+      the given areas. Areas are circles in absolute block coordinates.
+      --world-width must match the world for map chunks and map regions to be
+      located correctly.
+
+  vcdbtree scan [--world-width <blocks>] <input.vcdbs>
+      Check every chunk, mapchunk, and mapregion in a savegame and list the
+      ones whose data is missing or isn't a well-formed serialized message,
+      with their coordinates, so they can be restored from an earlier
+      snapshot. The savegame is opened read-only. Exits with status 2 if
+      anything suspect is found.
 
 Examples:
   vcdbtree split /gamedata/Backups/backup.vcdbs /tmp/backup-tree
   vcdbtree combine /tmp/backup-tree /gamedata/Saves/restored.vcdbs
+  vcdbtree trim /tmp/backup-tree 512000,512000,5000
+  vcdbtree scan /gamedata/Backups/backup.vcdbs
 `
 
 func main() {
@@ -50,19 +90,43 @@ func main() {
 
 	cmd := os.Args[1]
 
+	// Cancel long-running operations on Ctrl+C
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	switch cmd {
 	case "split":
-		if len(os.Args) != 4 {
-			fmt.Fprintf(os.Stderr, "Usage: vcdbtree split <input.vcdbs> <output_dir>\n")
+		flags := flag.NewFlagSet("split", flag.ExitOnError)
+		deterministic := flags.Bool("deterministic", false, "produce reproducible output with fixed modes and mtimes")
+		worldWidth := flags.Int64("world-width", vcdbtree.DefaultMapSizeX, "world width in blocks")
+		layoutName := flags.String("layout", "geographic", "sharding layout: geographic, or hex[:<levels>[:<fanout>]]")
+		progress := flags.Duration("progress", vcdbtree.DefaultProgressInterval, "how often to print progress, or 0 for never")
+		flags.Parse(os.Args[2:])
+
+		if flags.NArg() != 2 {
+			fmt.Fprintf(os.Stderr, "Usage: vcdbtree split [--deterministic] [--world-width <blocks>] [--layout <layout>] [--progress <interval>] <input.vcdbs> <output_dir>\n")
+			os.Exit(1)
+		}
+		inputDB := flags.Arg(0)
+		outputDir := flags.Arg(1)
+
+		layout, err := vcdbtree.ParseLayout(*layoutName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		inputDB := os.Args[2]
-		outputDir := os.Args[3]
 
 		fmt.Printf("Splitting %s -> %s\n", inputDB, outputDir)
 		start := time.Now()
 
-		if err := vcdbtree.Split(inputDB, outputDir); err != nil {
+		opts := &vcdbtree.Options{Deterministic: *deterministic, MapSizeX: *worldWidth, Layout: &layout}
+		if *progress > 0 {
+			opts.ProgressInterval = *progress
+			opts.OnProgress = func(p vcdbtree.Progress) {
+				fmt.Printf("Progress: %s\n", p)
+			}
+		}
+		if err := vcdbtree.SplitContext(ctx, inputDB, outputDir, opts); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -70,23 +134,100 @@ func main() {
 		fmt.Printf("Split complete in %v\n", time.Since(start))
 
 	case "combine":
-		if len(os.Args) != 4 {
-			fmt.Fprintf(os.Stderr, "Usage: vcdbtree combine <input_dir> <output.vcdbs>\n")
+		flags := flag.NewFlagSet("combine", flag.ExitOnError)
+		verify := flags.Bool("verify", false, "check the result before replacing the output file")
+		flags.Parse(os.Args[2:])
+
+		if flags.NArg() != 2 {
+			fmt.Fprintf(os.Stderr, "Usage: vcdbtree combine [--verify] <input_dir> <output.vcdbs>\n")
+			os.Exit(1)
+		}
+		inputDir := flags.Arg(0)
+		outputDB := flags.Arg(1)
+
+		if err := printServerVersion(inputDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		inputDir := os.Args[2]
-		outputDB := os.Args[3]
 
 		fmt.Printf("Combining %s -> %s\n", inputDir, outputDB)
 		start := time.Now()
 
-		if err := vcdbtree.Combine(inputDir, outputDB); err != nil {
+		combine := vcdbtree.CombineContext
+		if *verify {
+			combine = combineVerified
+		}
+		if err := combine(ctx, inputDir, outputDB, nil); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 
 		fmt.Printf("Combine complete in %v\n", time.Since(start))
 
+	case "trim":
+		flags := flag.NewFlagSet("trim", flag.ExitOnError)
+		worldWidth := flags.Int64("world-width", vcdbtree.DefaultMapSizeX, "world width in blocks")
+		flags.Parse(os.Args[2:])
+
+		if flags.NArg() < 2 {
+			fmt.Fprintf(os.Stderr, "Usage: vcdbtree trim [--world-width <blocks>] <tree_dir> <x,z,radius>...\n")
+			os.Exit(1)
+		}
+		treeDir := flags.Arg(0)
+
+		var areas []vcdbtree.Area
+		for _, arg := range flags.Args()[1:] {
+			area, err := vcdbtree.ParseArea(arg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			areas = append(areas, area)
+		}
+
+		fmt.Printf("Trimming %s to %d area(s)\n", treeDir, len(areas))
+		start := time.Now()
+
+		removed, err := vcdbtree.Trim(ctx, treeDir, vcdbtree.KeepWithinMap(areas, *worldWidth))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Trim complete in %v: %d files removed\n", time.Since(start), removed)
+
+	case "scan":
+		flags := flag.NewFlagSet("scan", flag.ExitOnError)
+		worldWidth := flags.Int64("world-width", vcdbtree.DefaultMapSizeX, "world width in blocks")
+		flags.Parse(os.Args[2:])
+
+		if flags.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "Usage: vcdbtree scan [--world-width <blocks>] <input.vcdbs>\n")
+			os.Exit(1)
+		}
+		inputDB := flags.Arg(0)
+
+		fmt.Printf("Scanning %s\n", inputDB)
+		start := time.Now()
+
+		result, err := vcdbtree.Scan(ctx, inputDB, &vcdbtree.Options{MapSizeX: *worldWidth})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Scanned %d chunks, %d mapchunks, and %d mapregions in %v\n",
+			result.Rows["chunk"], result.Rows["mapchunk"], result.Rows["mapregion"], time.Since(start))
+		if len(result.Problems) == 0 {
+			fmt.Println("No problems found")
+			return
+		}
+		for _, p := range result.Problems {
+			fmt.Println(p)
+		}
+		fmt.Printf("%d suspect rows found\n", len(result.Problems))
+		os.Exit(2)
+
 	case "-h", "--help", "help":
 		fmt.Print(usage)
 
@@ -96,3 +237,39 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// printServerVersion prints the server version recorded in the snapshot the
+// tree was restored from, if any.
+func printServerVersion(treeDir string) error {
+	meta, err := snapshotmeta.Find(treeDir)
+	if err != nil {
+		return err
+	}
+	if meta != nil && meta.ServerVersion != "" {
+		fmt.Printf("Save was written by server version %s\n", meta.ServerVersion)
+	}
+	return nil
+}
+
+// combineVerified combines into a temporary file next to outputDB, verifies
+// it, and only then renames it over outputDB. On failure the temporary file
+// is removed and outputDB is untouched.
+func combineVerified(ctx context.Context, inputDir, outputDB string, opts *vcdbtree.Options) error {
+	tmp := outputDB + ".verify.tmp"
+	defer os.Remove(tmp)
+
+	if err := vcdbtree.CombineContext(ctx, inputDir, tmp, opts); err != nil {
+		return err
+	}
+
+	fmt.Println("Verifying combined database...")
+	if err := vcdbtree.Verify(ctx, inputDir, tmp); err != nil {
+		return fmt.Errorf("%w; %s was not modified", err, outputDB)
+	}
+
+	if err := os.Rename(tmp, outputDB); err != nil {
+		return fmt.Errorf("failed to move verified database into place: %w", err)
+	}
+	fmt.Println("Verification passed")
+	return nil
+}
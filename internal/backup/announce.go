@@ -0,0 +1,127 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultAnnounceCommand is the server command backup announcements are
+// sent with when Announcements.Command isn't set.
+const DefaultAnnounceCommand = "/announce"
+
+// maxAnnounceError is how much of an error message is put into a failure
+// announcement, so a long restic error doesn't flood the chat.
+const maxAnnounceError = 160
+
+// Announcement outcomes, as listed in BACKUP_ANNOUNCE.
+const (
+	AnnounceSuccess = "success"
+	AnnounceFailure = "failure"
+)
+
+// Announcements configures which backup outcomes are announced in the game
+// chat, for players who want to see that backups are flowing. Suppressed
+// repeats of a failure (see FailureReportInterval) and skipped backups are
+// never announced.
+type Announcements struct {
+	// Success announces each successful backup with its snapshot ID, how
+	// much data it added, and how long it took.
+	Success bool
+
+	// Failure announces each failed backup with its error.
+	Failure bool
+
+	// Command is the server command the message is appended to, e.g. a
+	// mod's command that only messages admins. Defaults to
+	// DefaultAnnounceCommand, which messages everyone.
+	Command string
+}
+
+// ParseAnnouncements parses the comma-separated outcomes to announce, such
+// as "success,failure", and the command to announce them with. "all"
+// announces every outcome and "off" or "" none.
+func ParseAnnouncements(outcomes, command string) (Announcements, error) {
+	a := Announcements{Command: strings.TrimSpace(command)}
+	if a.Command != "" && !strings.HasPrefix(a.Command, "/") {
+		return Announcements{}, fmt.Errorf("command must start with /, got %q", a.Command)
+	}
+
+	outcomes = strings.TrimSpace(outcomes)
+	if outcomes == "" || strings.EqualFold(outcomes, "off") {
+		return a, nil
+	}
+	if strings.EqualFold(outcomes, "all") {
+		a.Success, a.Failure = true, true
+		return a, nil
+	}
+	for _, part := range strings.Split(outcomes, ",") {
+		switch strings.ToLower(strings.TrimSpace(part)) {
+		case AnnounceSuccess:
+			a.Success = true
+		case AnnounceFailure:
+			a.Failure = true
+		case "":
+		default:
+			return Announcements{}, fmt.Errorf("unknown outcome %q: must be %s, %s, all, or off", part, AnnounceSuccess, AnnounceFailure)
+		}
+	}
+	return a, nil
+}
+
+// message returns the chat command announcing a backup that took duration
+// and ended with stats or err, or "" if that outcome isn't announced.
+func (a *Announcements) message(stats BackupStats, duration time.Duration, err error) string {
+	var text string
+	switch {
+	case err == nil && a.Success:
+		text = "[backup] "
+		if stats.SnapshotID != "" {
+			text += "snapshot " + shortSnapshotID(stats.SnapshotID) + " "
+		}
+		if stats.BytesAdded >= 0 {
+			text += "(" + formatBytes(stats.BytesAdded) + " new) "
+		}
+		text += "completed in " + duration.Round(time.Second).String()
+	case err != nil && a.Failure:
+		text = fmt.Sprintf("[backup] failed after %s: %s", duration.Round(time.Second), announceError(err))
+	default:
+		return ""
+	}
+
+	command := a.Command
+	if command == "" {
+		command = DefaultAnnounceCommand
+	}
+	return command + " " + text
+}
+
+// shortSnapshotID shortens a snapshot ID the way restic prints it.
+func shortSnapshotID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// announceError flattens err onto one line and shortens it to
+// maxAnnounceError bytes.
+func announceError(err error) string {
+	msg := strings.Join(strings.Fields(err.Error()), " ")
+	if len(msg) > maxAnnounceError {
+		msg = strings.ToValidUTF8(msg[:maxAnnounceError], "") + "..."
+	}
+	return msg
+}
+
+// announce sends the announcement of a backup's outcome to the server.
+// A failure to send it is logged, since the outcome is already decided.
+func (m *Manager) announce(stats BackupStats, duration time.Duration, backupErr error) {
+	msg := m.Announcements.message(stats, duration, backupErr)
+	if msg == "" {
+		return
+	}
+	if err := m.Server.SendCommand(msg); err != nil {
+		fmt.Printf("Warning: failed to announce backup outcome: %v\n", err)
+	}
+}
@@ -0,0 +1,97 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestParseAnnouncements(t *testing.T) {
+	tests := []struct {
+		outcomes, command string
+		want              Announcements
+	}{
+		{"", "", Announcements{}},
+		{"off", "", Announcements{}},
+		{"success", "", Announcements{Success: true}},
+		{" Failure , success", "", Announcements{Success: true, Failure: true}},
+		{"all", "/msgadmins", Announcements{Success: true, Failure: true, Command: "/msgadmins"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseAnnouncements(tt.outcomes, tt.command)
+		if err != nil {
+			t.Errorf("ParseAnnouncements(%q, %q) failed: %v", tt.outcomes, tt.command, err)
+		} else if got != tt.want {
+			t.Errorf("ParseAnnouncements(%q, %q) = %+v, want %+v", tt.outcomes, tt.command, got, tt.want)
+		}
+	}
+
+	if _, err := ParseAnnouncements("skipped", ""); err == nil {
+		t.Error("ParseAnnouncements() expected an error for an unknown outcome")
+	}
+	if _, err := ParseAnnouncements("all", "announce"); err == nil {
+		t.Error("ParseAnnouncements() expected an error for a command without a slash")
+	}
+}
+
+func TestAnnouncements_Message(t *testing.T) {
+	stats := BackupStats{SnapshotID: "1a2b3c4d5e6f", BytesAdded: 2254857830}
+	all := &Announcements{Success: true, Failure: true}
+
+	if got, want := all.message(stats, 94*time.Second, nil), "/announce [backup] snapshot 1a2b3c4d (2.10 GiB new) completed in 1m34s"; got != want {
+		t.Errorf("message() = %q, want %q", got, want)
+	}
+	if got, want := all.message(BackupStats{BytesAdded: -1}, 5*time.Second, nil), "/announce [backup] completed in 5s"; got != want {
+		t.Errorf("message() without stats = %q, want %q", got, want)
+	}
+
+	failure := all.message(BackupStats{}, 12*time.Second, errors.New("restic failed:\n"+strings.Repeat("x", 500)))
+	if !strings.HasPrefix(failure, "/announce [backup] failed after 12s: restic failed: xxx") || strings.Contains(failure, "\n") {
+		t.Errorf("message() for failure = %q", failure)
+	}
+	if len(failure) > 250 {
+		t.Errorf("message() for failure is %d bytes, want it shortened", len(failure))
+	}
+
+	onlyFailures := &Announcements{Failure: true, Command: "/msgadmins"}
+	if got := onlyFailures.message(stats, time.Second, nil); got != "" {
+		t.Errorf("message() for unannounced success = %q, want none", got)
+	}
+	if got := onlyFailures.message(stats, time.Second, errors.New("boom")); got != "/msgadmins [backup] failed after 1s: boom" {
+		t.Errorf("message() with custom command = %q", got)
+	}
+}
+
+func TestManager_PerformBackup_Announces(t *testing.T) {
+	m, _ := setupRetry(t)
+	m.RetryBackoff = []time.Duration{}
+	m.Announcements = Announcements{Success: true}
+
+	if err := m.performBackup(context.Background(), false); err != nil {
+		t.Fatalf("performBackup() failed: %v", err)
+	}
+	cmds := m.Server.(*testsupport.Server).Commands()
+	if last := cmds[len(cmds)-1]; !strings.HasPrefix(last, "/announce [backup] completed in ") {
+		t.Errorf("Last command = %q, want a success announcement", last)
+	}
+}
+
+func TestManager_PerformBackup_SkipDoesNotAnnounce(t *testing.T) {
+	srv := &testsupport.Server{}
+	m := &Manager{
+		Server:        srv,
+		BootChecker:   testsupport.NewBootChecker(false),
+		Announcements: Announcements{Success: true, Failure: true},
+	}
+
+	if err := m.performBackup(context.Background(), true); err != ErrServerNotBooted {
+		t.Fatalf("performBackup() error = %v, want ErrServerNotBooted", err)
+	}
+	if cmds := srv.Commands(); len(cmds) != 0 {
+		t.Errorf("Commands sent for a skipped backup: %v", cmds)
+	}
+}
@@ -0,0 +1,72 @@
+package backup
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/clock"
+)
+
+// autosaveStartPattern and autosaveCompletePattern match the first and last
+// of the lines the server logs around an autosave:
+//
+//	[Server Notification] Autosaving game world. Notifying mods, then systems of upcoming save...
+//	[Server Notification] Mods and systems notified. Now saving...
+//	[Server Notification] Game world saved
+const (
+	autosaveStartPattern    = "Autosaving game world"
+	autosaveCompletePattern = "Game world saved"
+)
+
+// autosaveStaleAfter is how long an autosave may appear to be in progress before
+// the tracker assumes the completion line was missed and resets its state.
+// It is counted from the time logged on the start line, if it has one.
+const autosaveStaleAfter = 10 * time.Minute
+
+// AutosaveTracker tracks whether the game server is currently running its own
+// autosave by watching server output for the start/finish log lines.
+// Sending /genbackup while an autosave is in progress causes long world-save pauses.
+type AutosaveTracker struct {
+	// Clock is used to expire a stale autosave. Defaults to clock.Real.
+	// This is primarily for testing.
+	Clock clock.Clock
+
+	mu         sync.Mutex
+	inProgress bool
+	startedAt  time.Time
+}
+
+// HandleOutput should be called for each line of server output.
+// It detects autosave start/finish events and updates the tracked state.
+func (a *AutosaveTracker) HandleOutput(line string) {
+	// Ignore chat messages so players can't wedge backups by typing the pattern
+	if strings.Contains(line, serverChatPrefix) {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if strings.Contains(line, autosaveStartPattern) {
+		a.inProgress = true
+		a.startedAt = lineTime(line, clock.Or(a.Clock).Now())
+		return
+	}
+
+	if strings.Contains(line, autosaveCompletePattern) {
+		a.inProgress = false
+	}
+}
+
+// AutosaveInProgress returns true if the server is currently autosaving.
+func (a *AutosaveTracker) AutosaveInProgress() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.inProgress && clock.Or(a.Clock).Now().Sub(a.startedAt) > autosaveStaleAfter {
+		// We probably missed the completion line; don't block backups forever
+		a.inProgress = false
+	}
+	return a.inProgress
+}
@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/clock"
+)
+
+func TestAutosaveTracker_HandleOutput_StartAndFinish(t *testing.T) {
+	a := &AutosaveTracker{}
+
+	if a.AutosaveInProgress() {
+		t.Fatal("Expected no autosave in progress initially")
+	}
+
+	a.HandleOutput("15.1.2025 12:00:00 [Server Event] Autosaving game world. Notify clients of upcoming save.")
+	if !a.AutosaveInProgress() {
+		t.Fatal("Expected autosave in progress after start line")
+	}
+
+	a.HandleOutput("15.1.2025 12:00:03 [Server Event] Game world saved")
+	if a.AutosaveInProgress() {
+		t.Error("Expected autosave finished after completion line")
+	}
+}
+
+func TestAutosaveTracker_HandleOutput_ServerLogSequence(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 12, 14, 22, 30, 2, 0, time.Local))
+	a := &AutosaveTracker{Clock: clk}
+
+	lines := []struct {
+		line       string
+		inProgress bool
+	}{
+		{"14.12.2025 22:30:00 [Server Notification] Autosaving game world. Notifying mods, then systems of upcoming save...", true},
+		{"14.12.2025 22:30:00 [Server Notification] Mods and systems notified. Now saving...", true},
+		{"14.12.2025 22:30:01 [Server Event] amoglaswag joins.", true},
+		{"14.12.2025 22:30:02 [Server Notification] Game world saved", false},
+	}
+	for _, tt := range lines {
+		a.HandleOutput(tt.line)
+		if got := a.AutosaveInProgress(); got != tt.inProgress {
+			t.Errorf("after %q: AutosaveInProgress() = %v, want %v", tt.line, got, tt.inProgress)
+		}
+	}
+}
+
+func TestAutosaveTracker_HandleOutput_IgnoresChat(t *testing.T) {
+	a := &AutosaveTracker{}
+
+	a.HandleOutput("[Server Chat] griefer: Autosaving game world")
+	if a.AutosaveInProgress() {
+		t.Error("Chat messages should not start an autosave")
+	}
+}
+
+func TestAutosaveTracker_StaleStateExpires(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	a := &AutosaveTracker{Clock: clk}
+
+	a.HandleOutput("[Server Event] Autosaving game world")
+	if !a.AutosaveInProgress() {
+		t.Fatal("Expected autosave in progress")
+	}
+
+	clk.Advance(autosaveStaleAfter + time.Second)
+	if a.AutosaveInProgress() {
+		t.Error("Expected stale autosave state to be reset")
+	}
+}
+
+func TestAutosaveTracker_StaleFromLoggedTime(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 12, 14, 23, 0, 0, 0, time.Local))
+	a := &AutosaveTracker{Clock: clk}
+
+	// Read back from the log half an hour later, without its completion line
+	a.HandleOutput("14.12.2025 22:30:00 [Server Notification] Autosaving game world. Notifying mods, then systems of upcoming save...")
+	if a.AutosaveInProgress() {
+		t.Error("Expected an autosave logged longer than autosaveStaleAfter ago to be stale")
+	}
+
+	// A server clock running ahead doesn't keep it in progress for longer
+	a.HandleOutput("14.12.2025 23:30:00 [Server Notification] Autosaving game world. Notifying mods, then systems of upcoming save...")
+	clk.Advance(autosaveStaleAfter + time.Second)
+	if a.AutosaveInProgress() {
+		t.Error("Expected an autosave logged in the future to count from now")
+	}
+}
@@ -0,0 +1,171 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultBackupsPollInterval is how often BackupsWatcher rescans the backups
+// directory where the operating system can't notify it of changes.
+const defaultBackupsPollInterval = 500 * time.Millisecond
+
+// BackupFileEvent reports a backup copy written to the backups directory.
+type BackupFileEvent struct {
+	// Path is the path of the backup copy.
+	Path string
+
+	// ModTime and Size are its modification time and size when the event
+	// was sent.
+	ModTime time.Time
+	Size    int64
+}
+
+// stamp returns the version of the file the event reports.
+func (e BackupFileEvent) stamp() backupFileStamp {
+	return backupFileStamp{ModTime: e.ModTime, Size: e.Size}
+}
+
+// backupFileStamp tells versions of a backup copy apart by the file's own
+// metadata, so that comparisons don't depend on the wall clock.
+type backupFileStamp struct {
+	ModTime time.Time
+	Size    int64
+}
+
+// equal reports whether s and o are the same version of a file.
+func (s backupFileStamp) equal(o backupFileStamp) bool {
+	return s.ModTime.Equal(o.ModTime) && s.Size == o.Size
+}
+
+// BackupFileWatcher reports backup copies as they are written. Watch sends
+// an event for each matching file present when it starts and for each one
+// written afterwards, until ctx is done, and then closes the channel.
+type BackupFileWatcher interface {
+	Watch(ctx context.Context) (<-chan BackupFileEvent, error)
+}
+
+// dirNotifier signals that entries of a directory may have changed.
+type dirNotifier interface {
+	// C receives a value after changes; several changes may be coalesced.
+	// It is closed if notifications stop working.
+	C() <-chan struct{}
+	Close() error
+}
+
+// BackupsWatcher is a BackupFileWatcher for a directory. Where the operating
+// system supports it (inotify on Linux), the directory is rescanned only when
+// a file in it is written or moved in; elsewhere, or if notifications can't
+// be set up, it is rescanned every PollInterval.
+type BackupsWatcher struct {
+	// Dir is the directory to watch. It is created if it doesn't exist.
+	Dir string
+
+	// Match selects the file names to report. If nil, every file is reported.
+	Match func(name string) bool
+
+	// PollInterval is the time between rescans when notifications aren't
+	// available. Defaults to 500ms.
+	PollInterval time.Duration
+}
+
+// Watch starts watching Dir. A file is reported again whenever its
+// modification time or size changes.
+func (w *BackupsWatcher) Watch(ctx context.Context) (<-chan BackupFileEvent, error) {
+	if err := os.MkdirAll(w.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backups directory: %w", err)
+	}
+
+	// A nil notifier without an error means the platform has none
+	notifier, err := newDirNotifier(w.Dir)
+	if err != nil {
+		fmt.Printf("WARNING: Can't watch %s for new backups, polling instead: %v\n", w.Dir, err)
+	}
+
+	events := make(chan BackupFileEvent)
+	go w.run(ctx, notifier, events)
+	return events, nil
+}
+
+// run scans Dir once, then again on every notification or poll tick, until
+// ctx is done.
+func (w *BackupsWatcher) run(ctx context.Context, notifier dirNotifier, events chan<- BackupFileEvent) {
+	defer close(events)
+
+	var changed <-chan struct{}
+	var ticks <-chan time.Time
+	if notifier != nil {
+		defer notifier.Close()
+		changed = notifier.C()
+	} else {
+		ticker := time.NewTicker(w.pollInterval())
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	seen := make(map[string]backupFileStamp)
+	for {
+		if !w.scan(ctx, seen, events) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-changed:
+			if !ok {
+				fmt.Printf("WARNING: Lost notifications for %s, polling instead\n", w.Dir)
+				changed = nil
+				ticker := time.NewTicker(w.pollInterval())
+				defer ticker.Stop()
+				ticks = ticker.C
+			}
+		case <-ticks:
+		}
+	}
+}
+
+// pollInterval returns PollInterval, or its default if not set.
+func (w *BackupsWatcher) pollInterval() time.Duration {
+	if w.PollInterval > 0 {
+		return w.PollInterval
+	}
+	return defaultBackupsPollInterval
+}
+
+// scan sends an event for each matching file that is new or whose
+// modification time or size changed since it was last seen. Returns false
+// once ctx is done.
+func (w *BackupsWatcher) scan(ctx context.Context, seen map[string]backupFileStamp, events chan<- BackupFileEvent) bool {
+	entries, err := os.ReadDir(w.Dir)
+	if err != nil {
+		return ctx.Err() == nil // The directory may be recreated
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || (w.Match != nil && !w.Match(entry.Name())) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		event := BackupFileEvent{
+			Path:    filepath.Join(w.Dir, entry.Name()),
+			ModTime: info.ModTime(),
+			Size:    info.Size(),
+		}
+		if last, ok := seen[event.Path]; ok && last.equal(event.stamp()) {
+			continue
+		}
+		seen[event.Path] = event.stamp()
+
+		select {
+		case <-ctx.Done():
+			return false
+		case events <- event:
+		}
+	}
+	return ctx.Err() == nil
+}
@@ -0,0 +1,57 @@
+package backup
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyNotifier is a dirNotifier backed by inotify. The descriptor is
+// non-blocking, so the runtime poller serves reads and Close interrupts a
+// pending one.
+type inotifyNotifier struct {
+	file *os.File
+	c    chan struct{}
+}
+
+// newDirNotifier watches dir for files finished being written or moved in.
+func newDirNotifier(dir string) (dirNotifier, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	if _, err := unix.InotifyAddWatch(fd, dir, unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO); err != nil {
+		unix.Close(fd)
+		return nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+
+	n := &inotifyNotifier{file: os.NewFile(uintptr(fd), "inotify"), c: make(chan struct{}, 1)}
+	go n.read()
+	return n, nil
+}
+
+// read signals C for every batch of events until the notifier is closed or
+// reading fails, and then closes C. The events themselves aren't needed,
+// since the watcher rescans anyway.
+func (n *inotifyNotifier) read() {
+	defer close(n.c)
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		if _, err := n.file.Read(buf); err != nil {
+			return
+		}
+		select {
+		case n.c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (n *inotifyNotifier) C() <-chan struct{} {
+	return n.c
+}
+
+func (n *inotifyNotifier) Close() error {
+	return n.file.Close()
+}
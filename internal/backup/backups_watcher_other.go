@@ -0,0 +1,9 @@
+//go:build !linux
+
+package backup
+
+// newDirNotifier returns no notifier, since directory notifications aren't
+// implemented here, so BackupsWatcher polls.
+func newDirNotifier(dir string) (dirNotifier, error) {
+	return nil, nil
+}
@@ -0,0 +1,230 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBackupsWatcher replays events sent on its channel.
+type fakeBackupsWatcher struct {
+	events chan BackupFileEvent
+}
+
+func (f *fakeBackupsWatcher) Watch(ctx context.Context) (<-chan BackupFileEvent, error) {
+	return f.events, nil
+}
+
+// nextEvent returns the next event, failing the test after a timeout.
+func nextEvent(t *testing.T, events <-chan BackupFileEvent) BackupFileEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("Watcher closed its channel")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a backup file event")
+	}
+	return BackupFileEvent{}
+}
+
+func testBackupsWatcher(t *testing.T, w *BackupsWatcher) {
+	existing := filepath.Join(w.Dir, "existing.vcdbs")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := w.Watch(ctx)
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	// Files already there are reported first
+	if event := nextEvent(t, events); event.Path != existing {
+		t.Errorf("First event = %q, want %q", event.Path, existing)
+	}
+
+	// Files that don't match aren't reported
+	if err := os.WriteFile(filepath.Join(w.Dir, "notes.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(w.Dir, "new.vcdbs")
+	if err := os.WriteFile(created, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, events); event.Path != created {
+		t.Errorf("Event = %q, want %q", event.Path, created)
+	}
+
+	// A replaced file is reported again
+	later := time.Now().Add(time.Minute)
+	tmp := filepath.Join(t.TempDir(), "replacement")
+	if err := os.WriteFile(tmp, []byte("rewritten"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(tmp, later, later)
+	if err := os.Rename(tmp, existing); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, events); event.Path != existing || !event.ModTime.Equal(later) {
+		t.Errorf("Event = %+v, want %q at %v", event, existing, later)
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestBackupsWatcher(t *testing.T) {
+	testBackupsWatcher(t, &BackupsWatcher{
+		Dir:   t.TempDir(),
+		Match: func(name string) bool { return strings.HasSuffix(name, ".vcdbs") },
+	})
+}
+
+func TestBackupsWatcher_Polling(t *testing.T) {
+	w := &BackupsWatcher{
+		Dir:          t.TempDir(),
+		Match:        func(name string) bool { return strings.HasSuffix(name, ".vcdbs") },
+		PollInterval: 10 * time.Millisecond,
+	}
+
+	// Run without notifications, as on platforms that have none
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan BackupFileEvent)
+	go w.run(ctx, nil, events)
+
+	created := filepath.Join(w.Dir, "new.vcdbs")
+	if err := os.WriteFile(created, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, events); event.Path != created {
+		t.Errorf("Event = %q, want %q", event.Path, created)
+	}
+}
+
+func TestBackupsWatcher_CreatesDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Backups")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := (&BackupsWatcher{Dir: dir}).Watch(ctx); err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("Backups directory not created: %v", err)
+	}
+}
+
+func TestManager_WaitForBackupFile_InjectedEvents(t *testing.T) {
+	dir := t.TempDir()
+	oldFile := filepath.Join(dir, "old.vcdbs")
+	newFile := filepath.Join(dir, "new.vcdbs")
+	for _, path := range []string{oldFile, newFile} {
+		if err := os.WriteFile(path, []byte("backup"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	modTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	existing := map[string]backupFileStamp{oldFile: {ModTime: modTime, Size: 6}}
+	watcher := &fakeBackupsWatcher{events: make(chan BackupFileEvent, 2)}
+	watcher.events <- BackupFileEvent{Path: oldFile, ModTime: modTime, Size: 6}
+	watcher.events <- BackupFileEvent{Path: newFile, ModTime: modTime, Size: 6}
+	m := &Manager{GameDataDir: t.TempDir(), BackupsWatcher: watcher}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got, err := m.waitForBackupFile(ctx, existing)
+	if err != nil {
+		t.Fatalf("waitForBackupFile() failed: %v", err)
+	}
+	if got != newFile {
+		t.Errorf("waitForBackupFile() = %q, want %q", got, newFile)
+	}
+}
+
+func TestManager_WaitForBackupFile_WatcherStops(t *testing.T) {
+	watcher := &fakeBackupsWatcher{events: make(chan BackupFileEvent)}
+	close(watcher.events)
+	m := &Manager{GameDataDir: t.TempDir(), BackupsWatcher: watcher}
+
+	if _, err := m.waitForBackupFile(context.Background(), nil); err == nil {
+		t.Error("waitForBackupFile() succeeded after the watcher stopped")
+	}
+}
+
+func TestManager_WaitForBackupFile_ClockSkew(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		// stale is the mtime of the backup already there; fresh is the
+		// mtime the new one gets, and rewrite writes it over the stale one
+		stale, fresh time.Time
+		rewrite      bool
+	}{
+		// NTP stepped the clock back after /genbackup was sent
+		{name: "clock stepped back", stale: now.Add(-2 * time.Hour), fresh: now.Add(-time.Hour)},
+		// The old copy was written while the clock ran ahead
+		{name: "stale copy from the future", stale: now.Add(time.Hour), fresh: now},
+		// The filesystem only keeps whole seconds, so the rewrite keeps the mtime
+		{name: "coarse mtime", stale: now.Truncate(time.Second), fresh: now.Truncate(time.Second), rewrite: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gameDataDir := t.TempDir()
+			backupsDir := filepath.Join(gameDataDir, "Backups")
+			if err := os.MkdirAll(backupsDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			stale := filepath.Join(backupsDir, "stale.vcdbs")
+			if err := os.WriteFile(stale, []byte("stale"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			os.Chtimes(stale, tt.stale, tt.stale)
+
+			m := &Manager{GameDataDir: gameDataDir}
+			existing, err := m.existingBackupFiles()
+			if err != nil {
+				t.Fatalf("existingBackupFiles() failed: %v", err)
+			}
+
+			want := filepath.Join(backupsDir, "fresh.vcdbs")
+			if tt.rewrite {
+				want = stale
+			}
+			tmp := filepath.Join(t.TempDir(), "fresh")
+			if err := os.WriteFile(tmp, []byte("fresh backup"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			os.Chtimes(tmp, tt.fresh, tt.fresh)
+			if err := os.Rename(tmp, want); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			got, err := m.waitForBackupFile(ctx, existing)
+			if err != nil {
+				t.Fatalf("waitForBackupFile() failed: %v", err)
+			}
+			if got != want {
+				t.Errorf("waitForBackupFile() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestManager_ExistingBackupFiles_MissingDir(t *testing.T) {
+	m := &Manager{GameDataDir: t.TempDir()}
+	existing, err := m.existingBackupFiles()
+	if err != nil || len(existing) != 0 {
+		t.Errorf("existingBackupFiles() = %v, %v, want none", existing, err)
+	}
+}
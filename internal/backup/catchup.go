@@ -0,0 +1,88 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Catch-up policies for backups missed while the launcher was down.
+const (
+	// CatchupOne runs a single backup as soon as the server boots if the last
+	// successful backup is more than one interval old.
+	CatchupOne = "one"
+
+	// CatchupNone resumes the normal interval without catching up.
+	CatchupNone = "none"
+)
+
+// lastBackupFileName is the name of the record of the last successful
+// backup in the cache directory. It lives outside the staging directory so it
+// isn't backed up itself.
+const lastBackupFileName = "last-backup"
+
+// ParseCatchupPolicy validates a catch-up policy, defaulting to CatchupOne.
+func ParseCatchupPolicy(s string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(s)); policy {
+	case "":
+		return CatchupOne, nil
+	case CatchupOne, CatchupNone:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown catch-up policy %q: expected %q or %q", s, CatchupOne, CatchupNone)
+	}
+}
+
+// defaultLastBackupFile returns where NewManager keeps the time of the last
+// successful backup: the last-backup file in CacheDir.
+func (m *Manager) defaultLastBackupFile() string {
+	return filepath.Join(m.cacheDir(), lastBackupFileName)
+}
+
+// LastSuccessfulBackup returns the time of the last successful backup, as
+// persisted in LastBackupFile. The bool is false if no backup is recorded.
+func (m *Manager) LastSuccessfulBackup() (time.Time, bool) {
+	if m.LastBackupFile == "" {
+		return time.Time{}, false
+	}
+	data, err := os.ReadFile(m.LastBackupFile)
+	if err != nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// BackupOverdue reports whether more than one Interval has passed since the
+// last successful backup, or no backup has been recorded at all.
+func (m *Manager) BackupOverdue(now time.Time) bool {
+	last, ok := m.LastSuccessfulBackup()
+	return !ok || now.Sub(last) > m.interval()
+}
+
+// recordSuccessfulBackup persists t as the time of the last successful backup.
+// Does nothing if LastBackupFile is empty.
+func (m *Manager) recordSuccessfulBackup(t time.Time) error {
+	path := m.LastBackupFile
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	// Write then rename, so a crash never leaves a truncated timestamp behind
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(t.UTC().Format(time.RFC3339)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", tmp, err)
+	}
+	return nil
+}
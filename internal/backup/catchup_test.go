@@ -0,0 +1,103 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestParseCatchupPolicy(t *testing.T) {
+	tests := []struct {
+		input     string
+		want      string
+		expectErr bool
+	}{
+		{input: "", want: CatchupOne},
+		{input: "one", want: CatchupOne},
+		{input: " NONE ", want: CatchupNone},
+		{input: "all", expectErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCatchupPolicy(tt.input)
+		if tt.expectErr {
+			if err == nil {
+				t.Errorf("ParseCatchupPolicy(%q) expected error", tt.input)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseCatchupPolicy(%q) = %q, %v; want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestManager_BackupOverdue(t *testing.T) {
+	m := &Manager{
+		Interval:       time.Hour,
+		LastBackupFile: filepath.Join(t.TempDir(), "state", "last-backup"),
+	}
+	now := time.Now()
+
+	if !m.BackupOverdue(now) {
+		t.Error("BackupOverdue() = false with no recorded backup, want true")
+	}
+
+	if err := m.recordSuccessfulBackup(now.Add(-30 * time.Minute)); err != nil {
+		t.Fatalf("recordSuccessfulBackup() failed: %v", err)
+	}
+	if m.BackupOverdue(now) {
+		t.Error("BackupOverdue() = true 30 minutes after a backup, want false")
+	}
+	if !m.BackupOverdue(now.Add(45 * time.Minute)) {
+		t.Error("BackupOverdue() = false 75 minutes after a backup, want true")
+	}
+
+	last, ok := m.LastSuccessfulBackup()
+	if !ok || last.Unix() != now.Add(-30*time.Minute).Unix() {
+		t.Errorf("LastSuccessfulBackup() = %v, %v", last, ok)
+	}
+
+	// A corrupt record counts as no backup
+	os.WriteFile(m.LastBackupFile, []byte("garbage"), 0644)
+	if _, ok := m.LastSuccessfulBackup(); ok {
+		t.Error("LastSuccessfulBackup() accepted a corrupt record")
+	}
+}
+
+func TestManager_PerformBackup_RecordsSuccess(t *testing.T) {
+	gameData := testsupport.CreateGameData(t)
+	testsupport.CreateBloatedSave(t, gameData.SavePath, 1)
+
+	resticErr := error(nil)
+	m := &Manager{
+		Interval:       time.Hour,
+		Server:         gameData.Server(),
+		GameDataDir:    gameData.Dir,
+		StagingDir:     t.TempDir(),
+		BackupTimeout:  5 * time.Second,
+		LastBackupFile: filepath.Join(t.TempDir(), "last-backup"),
+		ResticRunner: func(ctx context.Context, stagingDir string) error {
+			return resticErr
+		},
+	}
+
+	resticErr = os.ErrPermission
+	if err := m.performBackup(context.Background(), true); err == nil {
+		t.Fatal("performBackup() expected error")
+	}
+	if _, ok := m.LastSuccessfulBackup(); ok {
+		t.Error("A failed backup must not be recorded")
+	}
+
+	resticErr = nil
+	if err := m.performBackup(context.Background(), true); err != nil {
+		t.Fatalf("performBackup() failed: %v", err)
+	}
+	if last, ok := m.LastSuccessfulBackup(); !ok || time.Since(last) > time.Minute {
+		t.Errorf("LastSuccessfulBackup() = %v, %v after a successful backup", last, ok)
+	}
+}
@@ -0,0 +1,64 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Change detection policies, selecting how restic decides which staged
+// files to read again.
+const (
+	// ChangeDetectionMtime trusts modification time and size alone
+	// (restic --ignore-inode --ignore-ctime). The staging sync only rewrites
+	// files whose content changed, giving them a new modification time, so
+	// nothing is missed, while files whose inode or ctime changed without
+	// their content, e.g. after the staging directory was copied or
+	// remounted, aren't read again.
+	ChangeDetectionMtime = "mtime"
+
+	// ChangeDetectionCtime also reads files whose ctime changed
+	// (restic --ignore-inode).
+	ChangeDetectionCtime = "ctime"
+
+	// ChangeDetectionFull is restic's own default: modification time, size,
+	// ctime, and inode.
+	ChangeDetectionFull = "full"
+
+	// ChangeDetectionRescan reads every file on every backup (restic
+	// --force). Slow, but independent of file metadata.
+	ChangeDetectionRescan = "rescan"
+)
+
+// resticIgnoreCtimeVersion is the first restic release with --ignore-ctime.
+var resticIgnoreCtimeVersion = ResticVersion{0, 10, 0}
+
+// ParseChangeDetection validates a change detection policy, defaulting to
+// ChangeDetectionMtime.
+func ParseChangeDetection(s string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(s)); policy {
+	case "":
+		return ChangeDetectionMtime, nil
+	case ChangeDetectionMtime, ChangeDetectionCtime, ChangeDetectionFull, ChangeDetectionRescan:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown change detection policy %q: expected %q, %q, %q, or %q",
+			s, ChangeDetectionMtime, ChangeDetectionCtime, ChangeDetectionFull, ChangeDetectionRescan)
+	}
+}
+
+// changeDetectionArgs returns the restic backup flags for ChangeDetection.
+// restic releases without --ignore-ctime fall back to --ignore-inode.
+func (m *Manager) changeDetectionArgs() []string {
+	switch m.ChangeDetection {
+	case ChangeDetectionFull:
+		return nil
+	case ChangeDetectionRescan:
+		return []string{"--force"}
+	case ChangeDetectionCtime:
+		return []string{"--ignore-inode"}
+	}
+	if !m.ResticVersion.AtLeast(resticIgnoreCtimeVersion) {
+		return []string{"--ignore-inode"}
+	}
+	return []string{"--ignore-inode", "--ignore-ctime"}
+}
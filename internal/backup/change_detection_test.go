@@ -0,0 +1,46 @@
+package backup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseChangeDetection(t *testing.T) {
+	tests := map[string]string{
+		"":        ChangeDetectionMtime,
+		" MTIME ": ChangeDetectionMtime,
+		"ctime":   ChangeDetectionCtime,
+		"full":    ChangeDetectionFull,
+		"rescan":  ChangeDetectionRescan,
+	}
+	for s, want := range tests {
+		got, err := ParseChangeDetection(s)
+		if err != nil || got != want {
+			t.Errorf("ParseChangeDetection(%q) = %q, %v; want %q", s, got, err, want)
+		}
+	}
+	if _, err := ParseChangeDetection("inode"); err == nil {
+		t.Error("ParseChangeDetection(\"inode\") succeeded, want an error")
+	}
+}
+
+func TestChangeDetectionArgs(t *testing.T) {
+	tests := []struct {
+		policy  string
+		version ResticVersion
+		want    []string
+	}{
+		{"", ResticVersion{}, []string{"--ignore-inode", "--ignore-ctime"}},
+		{ChangeDetectionMtime, ResticVersion{0, 17, 3}, []string{"--ignore-inode", "--ignore-ctime"}},
+		{ChangeDetectionMtime, ResticVersion{0, 9, 6}, []string{"--ignore-inode"}},
+		{ChangeDetectionCtime, ResticVersion{0, 17, 3}, []string{"--ignore-inode"}},
+		{ChangeDetectionFull, ResticVersion{0, 17, 3}, nil},
+		{ChangeDetectionRescan, ResticVersion{0, 17, 3}, []string{"--force"}},
+	}
+	for _, tt := range tests {
+		m := &Manager{ChangeDetection: tt.policy, ResticVersion: tt.version}
+		if got := m.changeDetectionArgs(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("changeDetectionArgs() for %q with restic %v = %v, want %v", tt.policy, tt.version, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DefaultHighChangeThreshold is the fraction of the staged world's files a
+// split must rewrite to count as a high change when HighChangeThreshold
+// isn't set.
+const DefaultHighChangeThreshold = 0.8
+
+// Once highChangeRuns compared splits in a row were high changes, the next
+// split rewrites the tree in bulk instead of comparing each file with it.
+// splitHistorySize is how many compared splits are remembered.
+const (
+	highChangeRuns   = 2
+	splitHistorySize = 5
+)
+
+// splitRun is the outcome of a split that compared each file with the tree.
+type splitRun struct {
+	written, skipped int
+}
+
+// changeRate returns the fraction of the files the split rewrote.
+func (r splitRun) changeRate() float64 {
+	total := r.written + r.skipped
+	if total == 0 {
+		return 0
+	}
+	return float64(r.written) / float64(total)
+}
+
+// ParseHighChangeThreshold parses the change rate that counts as a high
+// change, as a percentage ("80%") or a fraction ("0.8"). "off" disables
+// high change handling and is returned as -1.
+func ParseHighChangeThreshold(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "off") {
+		return -1, nil
+	}
+	f, ok := parseFraction(s)
+	if !ok || f == 0 || f > 1 {
+		return 0, fmt.Errorf("invalid threshold %q: expected a percentage above 0%% and up to 100%%, such as 80%%, or off", s)
+	}
+	return f, nil
+}
+
+// highChangeThreshold returns HighChangeThreshold, or its default if not
+// set. A negative threshold disables high change handling.
+func (m *Manager) highChangeThreshold() float64 {
+	if m.HighChangeThreshold != 0 {
+		return m.HighChangeThreshold
+	}
+	return DefaultHighChangeThreshold
+}
+
+// bulkSplit reports whether the next split should rewrite the tree in bulk:
+// the last highChangeRuns compared splits were high changes, so comparing
+// each file with the tree would mostly be wasted. A bulk split rewrites every
+// file and says nothing about how many changed, so it is always followed by
+// a compared one, which shows whether the changes keep coming.
+func (m *Manager) bulkSplit() bool {
+	threshold := m.highChangeThreshold()
+	if threshold < 0 || m.lastSplitBulk || len(m.splitHistory) < highChangeRuns {
+		return false
+	}
+	for _, run := range m.splitHistory[len(m.splitHistory)-highChangeRuns:] {
+		if run.changeRate() < threshold {
+			return false
+		}
+	}
+	return true
+}
+
+// recordSplit adds a split that wrote and skipped files to the history. A
+// compared split that changed at least the threshold, such as after a world
+// reset or a lost staging cache, is logged and runs the HighChange hook.
+func (m *Manager) recordSplit(ctx context.Context, written, skipped int, bulk bool) {
+	m.lastSplitBulk = bulk
+	if bulk {
+		return
+	}
+
+	run := splitRun{written: written, skipped: skipped}
+	m.splitHistory = append(m.splitHistory, run)
+	if len(m.splitHistory) > splitHistorySize {
+		m.splitHistory = m.splitHistory[len(m.splitHistory)-splitHistorySize:]
+	}
+
+	threshold := m.highChangeThreshold()
+	if threshold < 0 || written == 0 || run.changeRate() < threshold {
+		return
+	}
+	fmt.Printf("High change rate: %d of %d staged world files changed (%.0f%%); the world may have been reset or the staging cache lost\n",
+		written, written+skipped, run.changeRate()*100)
+	m.Hooks.runHighChange(ctx, written, skipped)
+}
@@ -0,0 +1,103 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseHighChangeThreshold(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"80%", 0.8},
+		{"0.5", 0.5},
+		{"100%", 1},
+		{"off", -1},
+	}
+	for _, tt := range tests {
+		got, err := ParseHighChangeThreshold(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseHighChangeThreshold(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "0", "0%", "120%", "1.5", "-10%", "most"} {
+		if _, err := ParseHighChangeThreshold(in); err == nil {
+			t.Errorf("ParseHighChangeThreshold(%q) expected error", in)
+		}
+	}
+}
+
+func TestManager_SplitHistory(t *testing.T) {
+	var counts [2]int
+	m := &Manager{
+		VCDBTreeSplitter: func(string, string) (int, int, error) {
+			return counts[0], counts[1], nil
+		},
+	}
+	split := func(written, skipped int) bool {
+		t.Helper()
+		counts = [2]int{written, skipped}
+		bulk := m.bulkSplit()
+		if _, _, err := m.splitToVCDBTree(context.Background(), "src", "dst", nil); err != nil {
+			t.Fatalf("splitToVCDBTree() failed: %v", err)
+		}
+		return bulk
+	}
+
+	steps := []struct {
+		written, skipped int
+		wantBulk         bool
+	}{
+		{90, 10, false}, // High change
+		{10, 90, false}, // Back to normal
+		{85, 15, false}, // High change
+		{100, 0, false}, // Second in a row
+		{100, 0, true},  // Written in bulk
+		{95, 5, false},  // Compared again after a bulk split
+		{100, 0, true},  // Changes kept coming
+		{5, 95, false},  // Compared again
+		{100, 0, false}, // One high change isn't enough
+	}
+	for i, step := range steps {
+		if bulk := split(step.written, step.skipped); bulk != step.wantBulk {
+			t.Errorf("split %d: bulk = %v, want %v", i+1, bulk, step.wantBulk)
+		}
+	}
+	if len(m.splitHistory) != splitHistorySize {
+		t.Errorf("split history holds %d splits, want %d", len(m.splitHistory), splitHistorySize)
+	}
+
+	m.HighChangeThreshold = -1
+	split(100, 0)
+	if split(100, 0) {
+		t.Error("bulk split with high change handling off")
+	}
+}
+
+func TestManager_RecordSplit_Hook(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	m := &Manager{Hooks: Hooks{
+		HighChange: writeHook(t, dir, "high.sh", fmt.Sprintf(`echo "$BACKUP_EVENT $BACKUP_FILES_WRITTEN $BACKUP_FILES_UNCHANGED" >> %q`, out)),
+	}}
+
+	m.recordSplit(context.Background(), 70, 30, false)
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Error("HighChange hook ran below the threshold")
+	}
+
+	m.recordSplit(context.Background(), 90, 10, false)
+	m.recordSplit(context.Background(), 100, 0, true)
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("HighChange hook didn't run: %v", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "high-change 90 10" {
+		t.Errorf("HighChange hook got %q, want one run for the compared split", got)
+	}
+}
@@ -0,0 +1,198 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// ServerRestarter stops and restarts the server around offline maintenance.
+type ServerRestarter interface {
+	// StopServer stops the server and blocks until its process has exited.
+	StopServer(ctx context.Context) error
+
+	// StartServer starts the server again after StopServer.
+	StartServer() error
+}
+
+// ErrRestarterRequired is returned by Compact when no ServerRestarter is configured.
+var ErrRestarterRequired = errors.New("compaction requires a server restarter")
+
+// preCompactSuffix is appended to the original save file kept after compaction.
+const preCompactSuffix = ".pre-compact"
+
+// Compact rebuilds the live savegame into a fresh, vacuumed .vcdbs and swaps
+// it in, reclaiming the free pages that accumulate in long-running worlds.
+//
+// While the server is running, a /genbackup copy is converted to vcdbtree
+// format. The server is then stopped, the tree is refreshed from the live
+// save so no progress made since /genbackup is lost, and the tree is combined
+// into a new database. The original save is kept next to it with a
+// ".pre-compact" suffix, and the server is always restarted, even if the swap
+// fails.
+func (m *Manager) Compact(ctx context.Context) error {
+	if m.Restarter == nil {
+		return ErrRestarterRequired
+	}
+	if m.Server == nil {
+		return fmt.Errorf("server is required")
+	}
+	if m.BootChecker != nil && !m.BootChecker.HasBooted() {
+		return ErrServerNotBooted
+	}
+
+	// Don't let a scheduled backup run against a stopped server
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+
+	savePath, err := m.getSaveFilePath()
+	if err != nil {
+		return fmt.Errorf("failed to get save file path: %w", err)
+	}
+
+	before, err := os.Stat(savePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat save file: %w", err)
+	}
+
+	treeDir := filepath.Join(m.compactDir(), "tree")
+	if err := os.RemoveAll(treeDir); err != nil {
+		return fmt.Errorf("failed to clear compaction work directory: %w", err)
+	}
+	defer os.RemoveAll(treeDir)
+
+	// Step 1: Convert a /genbackup copy while the server keeps running, so the
+	// offline step only has to pick up what changed since.
+	if err := m.waitForAutosave(ctx); err != nil {
+		return fmt.Errorf("failed waiting for autosave to finish: %w", err)
+	}
+
+	existingBackups, err := m.existingBackupFiles()
+	if err != nil {
+		return err
+	}
+	if err := m.Server.SendCommand(m.genBackupCommand()); err != nil {
+		return fmt.Errorf("failed to send genbackup command: %w", err)
+	}
+
+	backupCtx, cancel := m.stageContext(ctx, StageGenBackup)
+	defer cancel()
+
+	backupFile, err := m.waitForBackupFile(backupCtx, existingBackups)
+	if err != nil {
+		return fmt.Errorf("failed to wait for backup file: %w", stageError(backupCtx, err))
+	}
+
+	fmt.Printf("Compaction: converting %s to vcdbtree\n", backupFile)
+	if _, _, err := vcdbtree.SplitWithCacheContext(ctx, backupFile, treeDir, m.withSplitProgress(&vcdbtree.Options{})); err != nil {
+		return fmt.Errorf("failed to split backup to vcdbtree: %w", err)
+	}
+	if err := os.Remove(backupFile); err != nil {
+		return fmt.Errorf("failed to remove backup file: %w", err)
+	}
+
+	// Step 2: Stop the server. From here on it must be restarted no matter what.
+	fmt.Println("Compaction: stopping server to swap the save file...")
+	if err := m.Restarter.StopServer(ctx); err != nil {
+		return fmt.Errorf("failed to stop server: %w", err)
+	}
+
+	swapErr := m.rebuildSaveFile(ctx, savePath, treeDir)
+
+	fmt.Println("Compaction: restarting server...")
+	if err := m.Restarter.StartServer(); err != nil {
+		return errors.Join(swapErr, fmt.Errorf("failed to restart server: %w", err))
+	}
+	if swapErr != nil {
+		return swapErr
+	}
+
+	if after, err := os.Stat(savePath); err == nil {
+		fmt.Printf("Compaction: %s reduced from %.1f MiB to %.1f MiB\n", filepath.Base(savePath),
+			float64(before.Size())/(1<<20), float64(after.Size())/(1<<20))
+	}
+
+	return nil
+}
+
+// rebuildSaveFile refreshes treeDir from the stopped server's save file,
+// combines it into a new database, and swaps that in place of the save.
+func (m *Manager) rebuildSaveFile(ctx context.Context, savePath, treeDir string) error {
+	// A leftover journal means the server didn't shut down cleanly, and the
+	// save file on its own may not hold the latest state
+	for _, suffix := range []string{"-wal", "-journal"} {
+		if info, err := os.Stat(savePath + suffix); err == nil && info.Size() > 0 {
+			return fmt.Errorf("save file has a pending %s file, refusing to compact", suffix)
+		}
+	}
+
+	fmt.Println("Compaction: refreshing vcdbtree from the live save...")
+	if _, _, err := vcdbtree.SplitWithCacheContext(ctx, savePath, treeDir, m.withSplitProgress(&vcdbtree.Options{})); err != nil {
+		return fmt.Errorf("failed to refresh vcdbtree from save file: %w", err)
+	}
+
+	// Build next to the save so the final rename stays on one filesystem
+	compactPath := savePath + ".compact"
+	fmt.Printf("Compaction: combining vcdbtree into %s\n", compactPath)
+	if err := vcdbtree.CombineContext(ctx, treeDir, compactPath, nil); err != nil {
+		os.Remove(compactPath)
+		return fmt.Errorf("failed to combine vcdbtree: %w", err)
+	}
+
+	return SwapSaveFile(savePath, compactPath)
+}
+
+// SwapSaveFile replaces savePath with newPath, keeping the original save as
+// savePath+".pre-compact". Any previous .pre-compact file is overwritten.
+// The server must not be running.
+func SwapSaveFile(savePath, newPath string) error {
+	keepPath := savePath + preCompactSuffix
+
+	if err := os.Rename(savePath, keepPath); err != nil {
+		return fmt.Errorf("failed to move original save file aside: %w", err)
+	}
+
+	if err := os.Rename(newPath, savePath); err != nil {
+		// Put the original back so the server starts with its old world
+		if restoreErr := os.Rename(keepPath, savePath); restoreErr != nil {
+			return fmt.Errorf("failed to install compacted save file: %w (and failed to restore original: %v)", err, restoreErr)
+		}
+		return fmt.Errorf("failed to install compacted save file: %w", err)
+	}
+
+	return nil
+}
+
+// getSaveFilePath returns the absolute path of the live save file.
+func (m *Manager) getSaveFilePath() (string, error) {
+	location, err := m.getSaveFileLocation()
+	if err != nil {
+		return "", err
+	}
+	if filepath.IsAbs(location) {
+		return location, nil
+	}
+	return filepath.Join(m.GameDataDir, "Saves", location), nil
+}
+
+// compactDir returns CompactDir, or the compact directory in the cache if
+// not set.
+func (m *Manager) compactDir() string {
+	if m.CompactDir != "" {
+		return m.CompactDir
+	}
+	return filepath.Join(m.cacheDir(), "compact")
+}
+
+// backupTimeout returns BackupTimeout, or its default if not set.
+func (m *Manager) backupTimeout() time.Duration {
+	if m.BackupTimeout > 0 {
+		return m.BackupTimeout
+	}
+	return 5 * time.Minute
+}
@@ -0,0 +1,247 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+// mockRestarter implements ServerRestarter for testing.
+type mockRestarter struct {
+	mu       sync.Mutex
+	calls    []string
+	onStop   func()
+	startErr error
+}
+
+func (m *mockRestarter) StopServer(ctx context.Context) error {
+	m.mu.Lock()
+	m.calls = append(m.calls, "stop")
+	onStop := m.onStop
+	m.mu.Unlock()
+	if onStop != nil {
+		onStop()
+	}
+	return nil
+}
+
+func (m *mockRestarter) StartServer() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, "start")
+	return m.startErr
+}
+
+func (m *mockRestarter) getCalls() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string{}, m.calls...)
+}
+
+// countChunks returns the number of rows in the chunk table of a savegame.
+func countChunks(t *testing.T, path string) int {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", path+"?mode=ro")
+	if err != nil {
+		t.Fatalf("Failed to open save: %v", err)
+	}
+	defer db.Close()
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM chunk").Scan(&n); err != nil {
+		t.Fatalf("Failed to count chunks: %v", err)
+	}
+	return n
+}
+
+// setupCompaction creates a game data directory with a bloated save and a
+// server mock that answers /genbackup by copying the save into Backups.
+func setupCompaction(t *testing.T) (m *Manager, savePath string, restarter *mockRestarter) {
+	t.Helper()
+
+	gameData := testsupport.CreateGameData(t)
+	testsupport.CreateBloatedSave(t, gameData.SavePath, 10)
+
+	restarter = &mockRestarter{}
+	m = &Manager{
+		GameDataDir:   gameData.Dir,
+		CompactDir:    filepath.Join(t.TempDir(), "compact"),
+		Server:        gameData.Server(),
+		Restarter:     restarter,
+		BackupTimeout: 5 * time.Second,
+	}
+	return m, gameData.SavePath, restarter
+}
+
+func TestManager_Compact(t *testing.T) {
+	m, savePath, restarter := setupCompaction(t)
+
+	before, err := os.Stat(savePath)
+	if err != nil {
+		t.Fatalf("Failed to stat save: %v", err)
+	}
+
+	// Simulate progress made between /genbackup and the server stopping
+	restarter.onStop = func() {
+		db, err := sql.Open("sqlite3", savePath)
+		if err != nil {
+			t.Errorf("Failed to open save: %v", err)
+			return
+		}
+		defer db.Close()
+		if _, err := db.Exec("INSERT INTO chunk (position, data) VALUES (100, 'late')"); err != nil {
+			t.Errorf("Failed to insert late chunk: %v", err)
+		}
+	}
+
+	if err := m.Compact(context.Background()); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	if calls := restarter.getCalls(); len(calls) != 2 || calls[0] != "stop" || calls[1] != "start" {
+		t.Errorf("Restarter calls = %v, want [stop start]", calls)
+	}
+
+	after, err := os.Stat(savePath)
+	if err != nil {
+		t.Fatalf("Compacted save missing: %v", err)
+	}
+	if after.Size() >= before.Size() {
+		t.Errorf("Compacted save is %d bytes, expected less than %d", after.Size(), before.Size())
+	}
+
+	if n := countChunks(t, savePath); n != 11 {
+		t.Errorf("Compacted save has %d chunks, want 11 (including the late one)", n)
+	}
+	if n := countChunks(t, savePath+".pre-compact"); n != 11 {
+		t.Errorf("Original save kept with %d chunks, want 11", n)
+	}
+
+	if _, err := os.Stat(filepath.Join(m.GameDataDir, "Backups", "genbackup.vcdbs")); !os.IsNotExist(err) {
+		t.Error("Backup file should be removed after compaction")
+	}
+	if _, err := os.Stat(filepath.Join(m.CompactDir, "tree")); !os.IsNotExist(err) {
+		t.Error("Compaction work tree should be removed")
+	}
+}
+
+func TestManager_Compact_RestartsAfterFailedSwap(t *testing.T) {
+	m, savePath, restarter := setupCompaction(t)
+
+	// A leftover journal makes the offline step refuse to continue
+	restarter.onStop = func() {
+		os.WriteFile(savePath+"-wal", []byte("pending"), 0644)
+	}
+
+	if err := m.Compact(context.Background()); err == nil {
+		t.Fatal("Compact should fail with a pending WAL file")
+	}
+
+	if calls := restarter.getCalls(); len(calls) != 2 || calls[1] != "start" {
+		t.Errorf("Server should be restarted after a failed swap, calls = %v", calls)
+	}
+	if _, err := os.Stat(savePath + ".pre-compact"); !os.IsNotExist(err) {
+		t.Error("Original save should not have been moved")
+	}
+}
+
+func TestManager_Compact_RestartFailure(t *testing.T) {
+	m, _, restarter := setupCompaction(t)
+	restarter.startErr = errors.New("boom")
+
+	err := m.Compact(context.Background())
+	if err == nil || !errors.Is(err, restarter.startErr) {
+		t.Errorf("Compact error = %v, want restart failure", err)
+	}
+}
+
+func TestManager_Compact_Validation(t *testing.T) {
+	m := &Manager{Server: &testsupport.Server{}}
+	if err := m.Compact(context.Background()); !errors.Is(err, ErrRestarterRequired) {
+		t.Errorf("Compact without restarter = %v, want ErrRestarterRequired", err)
+	}
+
+	m.Restarter = &mockRestarter{}
+	m.BootChecker = testsupport.NewBootChecker(false)
+	if err := m.Compact(context.Background()); !errors.Is(err, ErrServerNotBooted) {
+		t.Errorf("Compact before boot = %v, want ErrServerNotBooted", err)
+	}
+}
+
+func TestSwapSaveFile(t *testing.T) {
+	dir := t.TempDir()
+	savePath := filepath.Join(dir, "world.vcdbs")
+	newPath := filepath.Join(dir, "world.vcdbs.compact")
+
+	os.WriteFile(savePath, []byte("old"), 0644)
+	os.WriteFile(savePath+".pre-compact", []byte("older"), 0644)
+	os.WriteFile(newPath, []byte("new"), 0644)
+
+	if err := SwapSaveFile(savePath, newPath); err != nil {
+		t.Fatalf("SwapSaveFile failed: %v", err)
+	}
+
+	if data, _ := os.ReadFile(savePath); string(data) != "new" {
+		t.Errorf("Save file = %q, want new", data)
+	}
+	if data, _ := os.ReadFile(savePath + ".pre-compact"); string(data) != "old" {
+		t.Errorf("Pre-compact file = %q, want old", data)
+	}
+
+	t.Run("missing new file restores original", func(t *testing.T) {
+		if err := SwapSaveFile(savePath, filepath.Join(dir, "missing")); err == nil {
+			t.Fatal("SwapSaveFile should fail for a missing new file")
+		}
+		if data, _ := os.ReadFile(savePath); string(data) != "new" {
+			t.Errorf("Save file = %q after failed swap, want it restored", data)
+		}
+	})
+}
+
+func TestManager_CompactDirDefault(t *testing.T) {
+	m := &Manager{CacheDir: "/srv/cache"}
+	if got, want := m.compactDir(), filepath.Join("/srv/cache", "compact"); got != want {
+		t.Errorf("compactDir() = %q, want %q", got, want)
+	}
+
+	m.CompactDir = "/work/compact"
+	if got := m.compactDir(); got != "/work/compact" {
+		t.Errorf("compactDir() = %q, want CompactDir", got)
+	}
+}
+
+func TestManager_CacheSubdirDefaults(t *testing.T) {
+	m := &Manager{CacheDir: "/srv/cache"}
+	dirs := []struct {
+		name string
+		dir  func() string
+		want string
+	}{
+		{"localDir", m.localDir, filepath.Join("/srv/cache", "local")},
+		{"rollbackDir", m.rollbackDir, filepath.Join("/srv/cache", "rollback")},
+		{"quarantineDir", m.quarantineDir, filepath.Join("/srv/cache", "quarantine")},
+	}
+	for _, d := range dirs {
+		if got := d.dir(); got != d.want {
+			t.Errorf("%s() = %q, want %q", d.name, got, d.want)
+		}
+	}
+
+	m.LocalDir = "/work/local"
+	m.RollbackDir = "/work/rollback"
+	m.QuarantineDir = "/work/quarantine"
+	for _, d := range dirs {
+		if got, want := d.dir(), "/work/"+filepath.Base(d.want); got != want {
+			t.Errorf("%s() = %q, want %q", d.name, got, want)
+		}
+	}
+}
@@ -3,11 +3,16 @@ package backup
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
 )
 
-// Config holds the backup configuration parsed from environment variables.
+// Config holds the backup configuration. LoadConfig parses it from
+// environment variables; programs embedding the Manager can also fill it in
+// and pass it to NewManager, which checks it the same way.
 type Config struct {
 	// Enabled indicates whether backups are enabled.
 	Enabled bool
@@ -15,6 +20,31 @@ type Config struct {
 	// Interval is the time between backups.
 	Interval time.Duration
 
+	// FixedRate schedules backups Interval apart by start time.
+	FixedRate bool
+
+	// ChangeDetection selects how restic finds changed staged files.
+	ChangeDetection string
+
+	// StagingStrategy selects how backups update the staging directory.
+	StagingStrategy string
+
+	// GenBackupCommand, BackupsDir, and BackupFilePattern override how the
+	// server is asked for a backup copy and where it is found. They are set
+	// even when backups are disabled, since compaction uses them too.
+	GenBackupCommand  string
+	BackupsDir        string
+	BackupFilePattern string
+
+	// Required indicates that backups are mandatory: the launcher refuses to
+	// start the server if the repository can't be reached, and shuts it down
+	// after RequiredMaxFailures consecutive failed backups.
+	Required bool
+
+	// RequiredMaxFailures is how many consecutive backups may fail before a
+	// required backup is considered fatal. Defaults to 3.
+	RequiredMaxFailures int
+
 	// BackupOnServerStart indicates whether a backup should be performed
 	// immediately when the server finishes booting.
 	BackupOnServerStart bool
@@ -27,14 +57,165 @@ type Config struct {
 	// If set, runs `restic forget <options> --prune` after each backup.
 	// Example: "--keep-daily 7 --keep-weekly 4 --keep-monthly 12"
 	PruneRetention string
+
+	// PruneGroupBy is passed to restic forget as --group-by.
+	// If empty, restic's default grouping is used.
+	PruneGroupBy string
+
+	// ResticHost is the host name recorded in snapshots. If empty, the
+	// Manager derives one from World or the save file name.
+	ResticHost string
+
+	// World names the world in a restic repository shared by several
+	// servers. Empty if the repository holds one world.
+	World string
+
+	// BackupWindow is a daily local-time window in which one full backup is
+	// taken. If nil, every backup is incremental.
+	BackupWindow *TimeWindow
+
+	// CheckInterval is how often restic check runs. Zero disables it.
+	CheckInterval time.Duration
+
+	// MaintenanceMaxDefer is how long prunes and checks may be held off while
+	// players are online. Zero disables deferring.
+	MaintenanceMaxDefer time.Duration
+
+	// PruneWindow restricts prunes and checks to a daily local-time window.
+	// If nil, every backup prunes.
+	PruneWindow *TimeWindow
+
+	// Catchup is the policy for backups missed while the backup agent was
+	// down: CatchupOne (default) or CatchupNone. The launcher backs up on
+	// every boot, which catches up regardless.
+	Catchup string
+
+	// AutosaveMaxWait is the maximum time to delay a backup while the server
+	// is running its own autosave. Zero means the Manager default is used.
+	AutosaveMaxWait time.Duration
+
+	// PauseServerDuringLiveFileCopy indicates whether the server process should be
+	// suspended while live files are copied into staging.
+	PauseServerDuringLiveFileCopy bool
+
+	// MaxServerPause is the maximum time the server may be suspended.
+	// Zero means the Manager default is used.
+	MaxServerPause time.Duration
+
+	// SyncWorkers is how many files are copied at once when syncing live
+	// files into staging. Zero means the Manager default is used.
+	SyncWorkers int
+
+	// WriteRateLimit caps staging writes in bytes per second. Zero means
+	// unlimited.
+	WriteRateLimit int64
+
+	// WriteSyncBytes flushes staging writes to disk every this many bytes.
+	// Zero leaves it to the system.
+	WriteSyncBytes int64
+
+	// ResticIOPriority is the ionice class restic runs with. Empty leaves
+	// its priority alone.
+	ResticIOPriority string
+
+	// SyncPolicies sets how each synced directory is synced into staging.
+	SyncPolicies map[string]SyncPolicy
+
+	// CompressLogs stores rotated logs gzip-compressed in staging.
+	CompressLogs bool
+
+	// SkipTreeDigest leaves tree digests out of snapshot metadata.
+	SkipTreeDigest bool
+
+	// Hooks configures executables run before and after each backup.
+	Hooks Hooks
+
+	// Announcements configures which backup outcomes are announced in-game.
+	Announcements Announcements
+
+	// TrimAreas restricts backed-up terrain to these areas (block coordinates).
+	// If empty, the whole world is backed up.
+	TrimAreas []vcdbtree.Area
+
+	// WorldWidth is the world width in blocks, used to locate map chunks and
+	// map regions. Zero means the Manager default is used.
+	WorldWidth int64
+
+	// TreeLayout is the vcdbtree layout of the staging tree. If nil, the
+	// layout the tree already has is kept.
+	TreeLayout *vcdbtree.Layout
+
+	// LocalKeepVCDBS is how many processed .vcdbs files to keep locally as
+	// quick-restore copies. Zero keeps none.
+	LocalKeepVCDBS int
+
+	// ModsInterval backs up Mods as a separate, less frequent snapshot set.
+	// Zero keeps Mods in every snapshot.
+	ModsInterval time.Duration
+
+	// DriftInterval is how often the live save is compared with the last
+	// backup. Zero only measures drift on request.
+	DriftInterval time.Duration
+
+	// CacheCleanupInterval is how often the cache volume is audited for
+	// entries the configuration no longer uses. Zero disables the audit.
+	CacheCleanupInterval time.Duration
+
+	// CacheGracePeriod is how long an unused cache entry is kept.
+	CacheGracePeriod time.Duration
+
+	// CoverageIgnore lists top-level game data entries that aren't reported
+	// as missing from backups.
+	CoverageIgnore []string
+
+	// FailureReportInterval is how often a repeating backup failure is
+	// reported.
+	FailureReportInterval time.Duration
+
+	// IntegrityTolerance is how far restic's file and byte counts may differ
+	// from the staging tree's, as a fraction. Negative disables the check.
+	IntegrityTolerance float64
+
+	// HighChangeThreshold is the fraction of the staged world's files a
+	// backup must rewrite to count as a high change. Negative disables
+	// high change handling.
+	HighChangeThreshold float64
+
+	// SplitProgressInterval is how often the progress of a long split is
+	// logged.
+	SplitProgressInterval time.Duration
+
+	// StageTimeouts overrides the timeouts of backup stages.
+	StageTimeouts map[Stage]time.Duration
+
+	// RetryBackoff is the wait before each retry of a backup that failed
+	// transiently. Nil means the Manager default is used.
+	RetryBackoff []time.Duration
 }
 
 // LoadConfig loads backup configuration from environment variables.
 // Returns a Config with Enabled=false if BACKUP_INTERVAL is not set.
 func LoadConfig() (*Config, error) {
+	required := ParseBoolEnv(os.Getenv("BACKUP_REQUIRED"))
+
+	genBackupCommand := strings.TrimSpace(os.Getenv("BACKUP_GENBACKUP_COMMAND"))
+	backupsDir := strings.TrimSpace(os.Getenv("BACKUP_BACKUPS_DIR"))
+	backupFilePattern, err := ParseBackupFilePattern(os.Getenv("BACKUP_FILE_PATTERN"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BACKUP_FILE_PATTERN: %w", err)
+	}
+
 	intervalStr := os.Getenv("BACKUP_INTERVAL")
 	if intervalStr == "" {
-		return &Config{Enabled: false}, nil
+		if required {
+			return nil, fmt.Errorf("BACKUP_REQUIRED is set but BACKUP_INTERVAL is not")
+		}
+		return &Config{
+			Enabled:           false,
+			GenBackupCommand:  genBackupCommand,
+			BackupsDir:        backupsDir,
+			BackupFilePattern: backupFilePattern,
+		}, nil
 	}
 
 	interval, err := ParseDuration(intervalStr)
@@ -46,34 +227,335 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("BACKUP_INTERVAL must be positive, got %v", interval)
 	}
 
-	backupOnStart := parseBoolEnv(os.Getenv("DO_BACKUP_ON_SERVER_START"))
-	pauseWhenNoPlayers := parseBoolEnv(os.Getenv("BACKUP_PAUSE_WHEN_NO_PLAYERS"))
+	fixedRate := ParseBoolEnv(os.Getenv("BACKUP_FIXED_RATE"))
+	backupOnStart := ParseBoolEnv(os.Getenv("DO_BACKUP_ON_SERVER_START"))
+	pauseWhenNoPlayers := ParseBoolEnv(os.Getenv("BACKUP_PAUSE_WHEN_NO_PLAYERS"))
 	pruneRetention := strings.TrimSpace(os.Getenv("PRUNE_RESTIC_RETENTION"))
 
+	pruneGroupBy, err := ParseGroupBy(os.Getenv("PRUNE_GROUP_BY"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PRUNE_GROUP_BY: %w", err)
+	}
+	resticHost := strings.TrimSpace(os.Getenv("RESTIC_HOST"))
+
+	world, err := ParseWorldName(os.Getenv("BACKUP_WORLD"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BACKUP_WORLD: %w", err)
+	}
+
+	catchup, err := ParseCatchupPolicy(os.Getenv("BACKUP_CATCHUP"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BACKUP_CATCHUP: %w", err)
+	}
+
+	changeDetection, err := ParseChangeDetection(os.Getenv("BACKUP_CHANGE_DETECTION"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BACKUP_CHANGE_DETECTION: %w", err)
+	}
+
+	stagingStrategy, err := ParseStagingStrategy(os.Getenv("BACKUP_STAGING_STRATEGY"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BACKUP_STAGING_STRATEGY: %w", err)
+	}
+
+	var autosaveMaxWait time.Duration
+	if s := os.Getenv("BACKUP_AUTOSAVE_MAX_WAIT"); s != "" {
+		autosaveMaxWait, err = ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BACKUP_AUTOSAVE_MAX_WAIT: %w", err)
+		}
+	}
+
+	var checkInterval time.Duration
+	if s := os.Getenv("RESTIC_CHECK_INTERVAL"); s != "" {
+		checkInterval, err = ParseDuration(s)
+		if err != nil || checkInterval <= 0 {
+			return nil, fmt.Errorf("invalid RESTIC_CHECK_INTERVAL: must be a positive duration, got %q", s)
+		}
+	}
+
+	var maintenanceMaxDefer time.Duration
+	if s := os.Getenv("MAINTENANCE_MAX_DEFER"); s != "" {
+		maintenanceMaxDefer, err = ParseDuration(s)
+		if err != nil || maintenanceMaxDefer <= 0 {
+			return nil, fmt.Errorf("invalid MAINTENANCE_MAX_DEFER: must be a positive duration, got %q", s)
+		}
+	}
+
+	pauseServerDuringLiveFileCopy := ParseBoolEnv(os.Getenv("BACKUP_PAUSE_SERVER_DURING_LIVE_FILE_COPY"))
+	compressLogs := ParseBoolEnv(os.Getenv("BACKUP_COMPRESS_LOGS"))
+
+	// Digests are on unless explicitly disabled
+	skipTreeDigest := false
+	if s := os.Getenv("BACKUP_TREE_DIGEST"); s != "" {
+		skipTreeDigest = !ParseBoolEnv(s)
+	}
+
+	var maxServerPause time.Duration
+	if s := os.Getenv("BACKUP_MAX_SERVER_PAUSE"); s != "" {
+		maxServerPause, err = ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BACKUP_MAX_SERVER_PAUSE: %w", err)
+		}
+	}
+
+	var syncWorkers int
+	if s := os.Getenv("BACKUP_SYNC_WORKERS"); s != "" {
+		syncWorkers, err = strconv.Atoi(s)
+		if err != nil || syncWorkers < 1 {
+			return nil, fmt.Errorf("invalid BACKUP_SYNC_WORKERS: must be a positive integer, got %q", s)
+		}
+	}
+
+	var writeRateLimit int64
+	if s := os.Getenv("BACKUP_WRITE_RATE_LIMIT"); s != "" {
+		writeRateLimit, err = ParseByteSize(s)
+		if err != nil || writeRateLimit <= 0 {
+			return nil, fmt.Errorf("invalid BACKUP_WRITE_RATE_LIMIT: must be a positive size per second, got %q", s)
+		}
+	}
+
+	var writeSyncBytes int64
+	if s := os.Getenv("BACKUP_WRITE_SYNC_BYTES"); s != "" {
+		writeSyncBytes, err = ParseByteSize(s)
+		if err != nil || writeSyncBytes <= 0 {
+			return nil, fmt.Errorf("invalid BACKUP_WRITE_SYNC_BYTES: must be a positive size, got %q", s)
+		}
+	}
+
+	resticIOPriority, err := ParseIOPriority(os.Getenv("RESTIC_IONICE"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RESTIC_IONICE: %w", err)
+	}
+
+	syncPolicies, err := ParseSyncPolicies(os.Getenv("BACKUP_SYNC_POLICIES"), os.Getenv("BACKUP_SYNC_EXCLUDE"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BACKUP_SYNC_POLICIES or BACKUP_SYNC_EXCLUDE: %w", err)
+	}
+
+	requiredMaxFailures := 3
+	if s := os.Getenv("BACKUP_REQUIRED_MAX_FAILURES"); s != "" {
+		requiredMaxFailures, err = strconv.Atoi(s)
+		if err != nil || requiredMaxFailures < 1 {
+			return nil, fmt.Errorf("invalid BACKUP_REQUIRED_MAX_FAILURES: must be a positive integer, got %q", s)
+		}
+	}
+
+	var backupWindow *TimeWindow
+	if s := os.Getenv("BACKUP_WINDOW"); s != "" {
+		backupWindow, err = ParseTimeWindow(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BACKUP_WINDOW: %w", err)
+		}
+	}
+
+	var pruneWindow *TimeWindow
+	if s := os.Getenv("PRUNE_WINDOW"); s != "" {
+		pruneWindow, err = ParseTimeWindow(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PRUNE_WINDOW: %w", err)
+		}
+	}
+
+	hooks := Hooks{
+		PreBackup:    strings.TrimSpace(os.Getenv("HOOK_PRE_BACKUP")),
+		PostBackup:   strings.TrimSpace(os.Getenv("HOOK_POST_BACKUP")),
+		BackupFailed: strings.TrimSpace(os.Getenv("HOOK_BACKUP_FAILED")),
+		HighChange:   strings.TrimSpace(os.Getenv("HOOK_HIGH_CHANGE")),
+	}
+	for name, path := range map[string]string{
+		"HOOK_PRE_BACKUP":    hooks.PreBackup,
+		"HOOK_POST_BACKUP":   hooks.PostBackup,
+		"HOOK_BACKUP_FAILED": hooks.BackupFailed,
+		"HOOK_HIGH_CHANGE":   hooks.HighChange,
+	} {
+		if path == "" {
+			continue
+		}
+		if err := validateHook(path); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	if s := os.Getenv("HOOK_TIMEOUT"); s != "" {
+		hooks.Timeout, err = ParseDuration(s)
+		if err != nil || hooks.Timeout <= 0 {
+			return nil, fmt.Errorf("invalid HOOK_TIMEOUT: must be a positive duration, got %q", s)
+		}
+	}
+
+	announcements, err := ParseAnnouncements(os.Getenv("BACKUP_ANNOUNCE"), os.Getenv("BACKUP_ANNOUNCE_COMMAND"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BACKUP_ANNOUNCE or BACKUP_ANNOUNCE_COMMAND: %w", err)
+	}
+
+	trimAreas, err := vcdbtree.ParseAreas(os.Getenv("BACKUP_TRIM_AREAS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BACKUP_TRIM_AREAS: %w", err)
+	}
+
+	var worldWidth int64
+	if s := os.Getenv("BACKUP_WORLD_WIDTH"); s != "" {
+		worldWidth, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || worldWidth < 1 {
+			return nil, fmt.Errorf("invalid BACKUP_WORLD_WIDTH: must be a positive integer, got %q", s)
+		}
+	}
+
+	var treeLayout *vcdbtree.Layout
+	if s := os.Getenv("BACKUP_TREE_LAYOUT"); s != "" {
+		layout, err := vcdbtree.ParseLayout(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BACKUP_TREE_LAYOUT: %w", err)
+		}
+		treeLayout = &layout
+	}
+
+	var localKeepVCDBS int
+	if s := os.Getenv("LOCAL_KEEP_VCDBS"); s != "" {
+		localKeepVCDBS, err = strconv.Atoi(s)
+		if err != nil || localKeepVCDBS < 0 {
+			return nil, fmt.Errorf("invalid LOCAL_KEEP_VCDBS: must be a non-negative integer, got %q", s)
+		}
+	}
+
+	var modsInterval time.Duration
+	if s := os.Getenv("BACKUP_MODS_INTERVAL"); s != "" {
+		modsInterval, err = ParseDuration(s)
+		if err != nil || modsInterval <= 0 {
+			return nil, fmt.Errorf("invalid BACKUP_MODS_INTERVAL: must be a positive duration, got %q", s)
+		}
+	}
+
+	var driftInterval time.Duration
+	if s := os.Getenv("BACKUP_DRIFT_INTERVAL"); s != "" {
+		driftInterval, err = ParseDuration(s)
+		if err != nil || driftInterval <= 0 {
+			return nil, fmt.Errorf("invalid BACKUP_DRIFT_INTERVAL: must be a positive duration, got %q", s)
+		}
+	}
+
+	var cacheCleanupInterval time.Duration
+	if s := os.Getenv("BACKUP_CACHE_CLEANUP_INTERVAL"); s != "" {
+		cacheCleanupInterval, err = ParseDuration(s)
+		if err != nil || cacheCleanupInterval <= 0 {
+			return nil, fmt.Errorf("invalid BACKUP_CACHE_CLEANUP_INTERVAL: must be a positive duration, got %q", s)
+		}
+	}
+
+	cacheGracePeriod := DefaultCacheGracePeriod
+	if s := os.Getenv("BACKUP_CACHE_CLEANUP_GRACE"); s != "" {
+		cacheGracePeriod, err = ParseDuration(s)
+		if err != nil || cacheGracePeriod <= 0 {
+			return nil, fmt.Errorf("invalid BACKUP_CACHE_CLEANUP_GRACE: must be a positive duration, got %q", s)
+		}
+	}
+
+	failureReportInterval := DefaultFailureReportInterval
+	if s := os.Getenv("BACKUP_FAILURE_REPORT_INTERVAL"); s != "" {
+		failureReportInterval, err = ParseDuration(s)
+		if err != nil || failureReportInterval <= 0 {
+			return nil, fmt.Errorf("invalid BACKUP_FAILURE_REPORT_INTERVAL: must be a positive duration, got %q", s)
+		}
+	}
+
+	integrityTolerance := DefaultIntegrityTolerance
+	if s := os.Getenv("BACKUP_INTEGRITY_TOLERANCE"); s != "" {
+		integrityTolerance, err = ParseIntegrityTolerance(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BACKUP_INTEGRITY_TOLERANCE: %w", err)
+		}
+	}
+
+	highChangeThreshold := DefaultHighChangeThreshold
+	if s := os.Getenv("BACKUP_HIGH_CHANGE_THRESHOLD"); s != "" {
+		highChangeThreshold, err = ParseHighChangeThreshold(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BACKUP_HIGH_CHANGE_THRESHOLD: %w", err)
+		}
+	}
+
+	splitProgressInterval := DefaultSplitProgressInterval
+	if s := os.Getenv("BACKUP_SPLIT_PROGRESS_INTERVAL"); s != "" {
+		splitProgressInterval, err = ParseDuration(s)
+		if err != nil || splitProgressInterval <= 0 {
+			return nil, fmt.Errorf("invalid BACKUP_SPLIT_PROGRESS_INTERVAL: must be a positive duration, got %q", s)
+		}
+	}
+
+	stageTimeouts, err := ParseStageTimeouts(os.Getenv("BACKUP_STAGE_TIMEOUTS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BACKUP_STAGE_TIMEOUTS: %w", err)
+	}
+
+	var retryBackoff []time.Duration
+	if s := os.Getenv("BACKUP_RETRY_BACKOFF"); s != "" {
+		if retryBackoff, err = ParseRetryBackoff(s); err != nil {
+			return nil, fmt.Errorf("invalid BACKUP_RETRY_BACKOFF: %w", err)
+		}
+	}
+
+	var coverageIgnore []string
+	for _, name := range strings.Split(os.Getenv("BACKUP_COVERAGE_IGNORE"), ",") {
+		if name = strings.Trim(strings.TrimSpace(name), "/"); name != "" {
+			coverageIgnore = append(coverageIgnore, name)
+		}
+	}
+
 	return &Config{
-		Enabled:             true,
-		Interval:            interval,
-		BackupOnServerStart: backupOnStart,
-		PauseWhenNoPlayers:  pauseWhenNoPlayers,
-		PruneRetention:      pruneRetention,
+		Enabled:                       true,
+		Interval:                      interval,
+		FixedRate:                     fixedRate,
+		GenBackupCommand:              genBackupCommand,
+		BackupsDir:                    backupsDir,
+		BackupFilePattern:             backupFilePattern,
+		Required:                      required,
+		RequiredMaxFailures:           requiredMaxFailures,
+		BackupOnServerStart:           backupOnStart,
+		PauseWhenNoPlayers:            pauseWhenNoPlayers,
+		PruneRetention:                pruneRetention,
+		PruneGroupBy:                  pruneGroupBy,
+		ResticHost:                    resticHost,
+		World:                         world,
+		Catchup:                       catchup,
+		ChangeDetection:               changeDetection,
+		StagingStrategy:               stagingStrategy,
+		BackupWindow:                  backupWindow,
+		PruneWindow:                   pruneWindow,
+		CheckInterval:                 checkInterval,
+		MaintenanceMaxDefer:           maintenanceMaxDefer,
+		AutosaveMaxWait:               autosaveMaxWait,
+		PauseServerDuringLiveFileCopy: pauseServerDuringLiveFileCopy,
+		MaxServerPause:                maxServerPause,
+		SyncWorkers:                   syncWorkers,
+		SyncPolicies:                  syncPolicies,
+		WriteRateLimit:                writeRateLimit,
+		WriteSyncBytes:                writeSyncBytes,
+		ResticIOPriority:              resticIOPriority,
+		CompressLogs:                  compressLogs,
+		SkipTreeDigest:                skipTreeDigest,
+		Hooks:                         hooks,
+		Announcements:                 announcements,
+		TrimAreas:                     trimAreas,
+		WorldWidth:                    worldWidth,
+		TreeLayout:                    treeLayout,
+		LocalKeepVCDBS:                localKeepVCDBS,
+		ModsInterval:                  modsInterval,
+		DriftInterval:                 driftInterval,
+		CacheCleanupInterval:          cacheCleanupInterval,
+		CacheGracePeriod:              cacheGracePeriod,
+		CoverageIgnore:                coverageIgnore,
+		FailureReportInterval:         failureReportInterval,
+		IntegrityTolerance:            integrityTolerance,
+		HighChangeThreshold:           highChangeThreshold,
+		SplitProgressInterval:         splitProgressInterval,
+		StageTimeouts:                 stageTimeouts,
+		RetryBackoff:                  retryBackoff,
 	}, nil
 }
 
-// parseBoolEnv parses a boolean from an environment variable string.
+// ParseBoolEnv parses a boolean from an environment variable string.
 // Returns true for "true", "1", "yes" (case-insensitive), false otherwise.
-func parseBoolEnv(s string) bool {
+func ParseBoolEnv(s string) bool {
 	s = strings.ToLower(strings.TrimSpace(s))
 	return s == "true" || s == "1" || s == "yes"
 }
-
-// ValidateResticEnv validates that required restic environment variables are set
-// when backups are enabled. Returns an error if any required variables are missing.
-func ValidateResticEnv() error {
-	if os.Getenv("RESTIC_REPOSITORY") == "" {
-		return fmt.Errorf("FATAL: BACKUP_INTERVAL is set but RESTIC_REPOSITORY is not set. Backups require RESTIC_REPOSITORY to be configured")
-	}
-	if os.Getenv("RESTIC_PASSWORD") == "" {
-		return fmt.Errorf("FATAL: BACKUP_INTERVAL is set but RESTIC_PASSWORD is not set. Backups require RESTIC_PASSWORD to be configured")
-	}
-	return nil
-}
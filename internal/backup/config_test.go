@@ -2,7 +2,6 @@ package backup
 
 import (
 	"os"
-	"strings"
 	"testing"
 	"time"
 )
@@ -219,9 +218,9 @@ func TestParseBoolEnv(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			result := parseBoolEnv(tt.input)
+			result := ParseBoolEnv(tt.input)
 			if result != tt.expected {
-				t.Errorf("parseBoolEnv(%q) = %v, want %v", tt.input, result, tt.expected)
+				t.Errorf("ParseBoolEnv(%q) = %v, want %v", tt.input, result, tt.expected)
 			}
 		})
 	}
@@ -346,75 +345,820 @@ func TestLoadConfig_PruneRetention(t *testing.T) {
 	}
 }
 
-func TestValidateResticEnv(t *testing.T) {
-	tests := []struct {
-		name           string
-		repository     string
-		password       string
-		expectErr      bool
-		expectedErrMsg string
-	}{
-		{
-			name:       "both set",
-			repository: "s3:s3.amazonaws.com/bucket",
-			password:   "secret123",
-			expectErr:  false,
-		},
-		{
-			name:           "repository missing",
-			repository:     "",
-			password:       "secret123",
-			expectErr:      true,
-			expectedErrMsg: "RESTIC_REPOSITORY",
-		},
-		{
-			name:           "password missing",
-			repository:     "s3:s3.amazonaws.com/bucket",
-			password:       "",
-			expectErr:      true,
-			expectedErrMsg: "RESTIC_PASSWORD",
-		},
-		{
-			name:           "both missing",
-			repository:     "",
-			password:       "",
-			expectErr:      true,
-			expectedErrMsg: "RESTIC_REPOSITORY", // Should fail on first check
-		},
+func TestLoadConfig_AutosaveMaxWait(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	t.Run("not set", func(t *testing.T) {
+		os.Unsetenv("BACKUP_AUTOSAVE_MAX_WAIT")
+
+		config, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig() unexpected error: %v", err)
+		}
+		if config.AutosaveMaxWait != 0 {
+			t.Errorf("LoadConfig().AutosaveMaxWait = %v, want 0", config.AutosaveMaxWait)
+		}
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		os.Setenv("BACKUP_AUTOSAVE_MAX_WAIT", "90s")
+		defer os.Unsetenv("BACKUP_AUTOSAVE_MAX_WAIT")
+
+		config, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig() unexpected error: %v", err)
+		}
+		if config.AutosaveMaxWait != 90*time.Second {
+			t.Errorf("LoadConfig().AutosaveMaxWait = %v, want 90s", config.AutosaveMaxWait)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		os.Setenv("BACKUP_AUTOSAVE_MAX_WAIT", "soon")
+		defer os.Unsetenv("BACKUP_AUTOSAVE_MAX_WAIT")
+
+		if _, err := LoadConfig(); err == nil {
+			t.Error("LoadConfig() expected error for invalid BACKUP_AUTOSAVE_MAX_WAIT")
+		}
+	})
+}
+
+func TestLoadConfig_PauseServerDuringLiveFileCopy(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	os.Setenv("BACKUP_PAUSE_SERVER_DURING_LIVE_FILE_COPY", "true")
+	defer os.Unsetenv("BACKUP_PAUSE_SERVER_DURING_LIVE_FILE_COPY")
+	os.Setenv("BACKUP_MAX_SERVER_PAUSE", "10s")
+	defer os.Unsetenv("BACKUP_MAX_SERVER_PAUSE")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if !config.PauseServerDuringLiveFileCopy {
+		t.Error("LoadConfig().PauseServerDuringLiveFileCopy = false, want true")
+	}
+	if config.MaxServerPause != 10*time.Second {
+		t.Errorf("LoadConfig().MaxServerPause = %v, want 10s", config.MaxServerPause)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Set or unset environment variables
-			if tt.repository == "" {
-				os.Unsetenv("RESTIC_REPOSITORY")
-			} else {
-				os.Setenv("RESTIC_REPOSITORY", tt.repository)
-			}
-			defer os.Unsetenv("RESTIC_REPOSITORY")
+	os.Setenv("BACKUP_MAX_SERVER_PAUSE", "forever")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for invalid BACKUP_MAX_SERVER_PAUSE")
+	}
+}
 
-			if tt.password == "" {
-				os.Unsetenv("RESTIC_PASSWORD")
-			} else {
-				os.Setenv("RESTIC_PASSWORD", tt.password)
-			}
-			defer os.Unsetenv("RESTIC_PASSWORD")
+func TestLoadConfig_ResticHostAndGroupBy(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+	os.Setenv("RESTIC_HOST", "survival")
+	defer os.Unsetenv("RESTIC_HOST")
+	os.Setenv("PRUNE_GROUP_BY", "host,tags")
+	defer os.Unsetenv("PRUNE_GROUP_BY")
 
-			err := ValidateResticEnv()
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.ResticHost != "survival" {
+		t.Errorf("LoadConfig().ResticHost = %q, want survival", config.ResticHost)
+	}
+	if config.PruneGroupBy != "host,tags" {
+		t.Errorf("LoadConfig().PruneGroupBy = %q, want host,tags", config.PruneGroupBy)
+	}
 
-			if tt.expectErr {
-				if err == nil {
-					t.Error("ValidateResticEnv() expected error, got nil")
-					return
-				}
-				if tt.expectedErrMsg != "" && !strings.Contains(err.Error(), tt.expectedErrMsg) {
-					t.Errorf("ValidateResticEnv() error message should contain %q, got %q", tt.expectedErrMsg, err.Error())
-				}
-			} else {
-				if err != nil {
-					t.Errorf("ValidateResticEnv() unexpected error: %v", err)
-				}
-			}
-		})
+	os.Setenv("PRUNE_GROUP_BY", "hostname")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for invalid PRUNE_GROUP_BY")
+	}
+}
+
+func TestLoadConfig_FixedRate(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.FixedRate {
+		t.Error("LoadConfig().FixedRate = true by default, want false")
+	}
+
+	os.Setenv("BACKUP_FIXED_RATE", "true")
+	defer os.Unsetenv("BACKUP_FIXED_RATE")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if !config.FixedRate {
+		t.Error("LoadConfig().FixedRate = false, want true")
+	}
+}
+
+func TestLoadConfig_TreeDigest(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.SkipTreeDigest {
+		t.Error("LoadConfig().SkipTreeDigest = true by default, want false")
+	}
+
+	os.Setenv("BACKUP_TREE_DIGEST", "false")
+	defer os.Unsetenv("BACKUP_TREE_DIGEST")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if !config.SkipTreeDigest {
+		t.Error("LoadConfig().SkipTreeDigest = false with BACKUP_TREE_DIGEST=false, want true")
+	}
+}
+
+func TestLoadConfig_GenBackup(t *testing.T) {
+	os.Setenv("BACKUP_GENBACKUP_COMMAND", "/moddedbackup")
+	defer os.Unsetenv("BACKUP_GENBACKUP_COMMAND")
+	os.Setenv("BACKUP_BACKUPS_DIR", "ModBackups")
+	defer os.Unsetenv("BACKUP_BACKUPS_DIR")
+	os.Setenv("BACKUP_FILE_PATTERN", "*.bak")
+	defer os.Unsetenv("BACKUP_FILE_PATTERN")
+
+	// Compaction needs them even with backups disabled
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.Enabled {
+		t.Fatal("LoadConfig().Enabled = true without BACKUP_INTERVAL")
+	}
+	if config.GenBackupCommand != "/moddedbackup" || config.BackupsDir != "ModBackups" || config.BackupFilePattern != "*.bak" {
+		t.Errorf("LoadConfig() = %q, %q, %q", config.GenBackupCommand, config.BackupsDir, config.BackupFilePattern)
+	}
+
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.GenBackupCommand != "/moddedbackup" || config.BackupsDir != "ModBackups" || config.BackupFilePattern != "*.bak" {
+		t.Errorf("LoadConfig() = %q, %q, %q", config.GenBackupCommand, config.BackupsDir, config.BackupFilePattern)
+	}
+
+	os.Setenv("BACKUP_FILE_PATTERN", "[")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for invalid BACKUP_FILE_PATTERN")
+	}
+}
+
+func TestLoadConfig_ChangeDetection(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.ChangeDetection != ChangeDetectionMtime {
+		t.Errorf("LoadConfig().ChangeDetection = %q, want %q by default", config.ChangeDetection, ChangeDetectionMtime)
+	}
+
+	os.Setenv("BACKUP_CHANGE_DETECTION", "rescan")
+	defer os.Unsetenv("BACKUP_CHANGE_DETECTION")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.ChangeDetection != ChangeDetectionRescan {
+		t.Errorf("LoadConfig().ChangeDetection = %q, want rescan", config.ChangeDetection)
+	}
+
+	os.Setenv("BACKUP_CHANGE_DETECTION", "sometimes")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for invalid BACKUP_CHANGE_DETECTION")
+	}
+}
+
+func TestLoadConfig_World(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+	os.Setenv("BACKUP_WORLD", " creative-2 ")
+	defer os.Unsetenv("BACKUP_WORLD")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.World != "creative-2" {
+		t.Errorf("LoadConfig().World = %q, want creative-2", config.World)
+	}
+
+	os.Setenv("BACKUP_WORLD", "../survival")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for invalid BACKUP_WORLD")
+	}
+}
+
+func TestLoadConfig_SyncWorkers(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.SyncWorkers != 0 {
+		t.Errorf("LoadConfig().SyncWorkers = %d, want 0 (Manager default)", config.SyncWorkers)
+	}
+
+	os.Setenv("BACKUP_SYNC_WORKERS", "16")
+	defer os.Unsetenv("BACKUP_SYNC_WORKERS")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.SyncWorkers != 16 {
+		t.Errorf("LoadConfig().SyncWorkers = %d, want 16", config.SyncWorkers)
+	}
+
+	for _, bad := range []string{"0", "-2", "many"} {
+		os.Setenv("BACKUP_SYNC_WORKERS", bad)
+		if _, err := LoadConfig(); err == nil {
+			t.Errorf("LoadConfig() expected error for BACKUP_SYNC_WORKERS=%q", bad)
+		}
+	}
+}
+
+func TestLoadConfig_SyncPolicies(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	os.Setenv("BACKUP_SYNC_POLICIES", "Logs=mtime,Mods=skip")
+	defer os.Unsetenv("BACKUP_SYNC_POLICIES")
+	os.Setenv("BACKUP_SYNC_EXCLUDE", "Logs/*.txt")
+	defer os.Unsetenv("BACKUP_SYNC_EXCLUDE")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if logs := config.SyncPolicies["Logs"]; logs.Mode != SyncMtime || len(logs.Exclude) != 1 {
+		t.Errorf("LoadConfig().SyncPolicies[Logs] = %+v", logs)
+	}
+	if mods := config.SyncPolicies["Mods"]; mods.Mode != SyncSkip {
+		t.Errorf("LoadConfig().SyncPolicies[Mods] = %+v", mods)
+	}
+
+	os.Setenv("BACKUP_SYNC_EXCLUDE", "Saves/*.vcdbs")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for BACKUP_SYNC_EXCLUDE outside the synced directories")
+	}
+}
+
+func TestLoadConfig_TrimAreas(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	os.Setenv("BACKUP_TRIM_AREAS", "512000,512000,5000; 530000,498000,1000")
+	defer os.Unsetenv("BACKUP_TRIM_AREAS")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if len(config.TrimAreas) != 2 || config.TrimAreas[1].Radius != 1000 {
+		t.Errorf("LoadConfig().TrimAreas = %+v", config.TrimAreas)
+	}
+
+	os.Setenv("BACKUP_TRIM_AREAS", "512000,512000")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for invalid BACKUP_TRIM_AREAS")
+	}
+}
+
+func TestLoadConfig_ModsInterval(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	os.Setenv("BACKUP_MODS_INTERVAL", "1d")
+	defer os.Unsetenv("BACKUP_MODS_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.ModsInterval != 24*time.Hour {
+		t.Errorf("LoadConfig().ModsInterval = %v, want 24h", config.ModsInterval)
+	}
+
+	os.Setenv("BACKUP_MODS_INTERVAL", "0s")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for zero BACKUP_MODS_INTERVAL")
+	}
+}
+
+func TestLoadConfig_DriftInterval(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.DriftInterval != 0 {
+		t.Errorf("LoadConfig().DriftInterval = %v, want 0 by default", config.DriftInterval)
+	}
+
+	os.Setenv("BACKUP_DRIFT_INTERVAL", "15m")
+	defer os.Unsetenv("BACKUP_DRIFT_INTERVAL")
+	if config, err = LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.DriftInterval != 15*time.Minute {
+		t.Errorf("LoadConfig().DriftInterval = %v, want 15m", config.DriftInterval)
+	}
+
+	os.Setenv("BACKUP_DRIFT_INTERVAL", "soon")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for invalid BACKUP_DRIFT_INTERVAL")
+	}
+}
+
+func TestLoadConfig_CacheCleanup(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.CacheCleanupInterval != 0 || config.CacheGracePeriod != DefaultCacheGracePeriod {
+		t.Errorf("LoadConfig() cache cleanup = every %v after %v, want off after %v by default",
+			config.CacheCleanupInterval, config.CacheGracePeriod, DefaultCacheGracePeriod)
+	}
+
+	os.Setenv("BACKUP_CACHE_CLEANUP_INTERVAL", "1d")
+	defer os.Unsetenv("BACKUP_CACHE_CLEANUP_INTERVAL")
+	os.Setenv("BACKUP_CACHE_CLEANUP_GRACE", "3d")
+	defer os.Unsetenv("BACKUP_CACHE_CLEANUP_GRACE")
+	if config, err = LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.CacheCleanupInterval != 24*time.Hour || config.CacheGracePeriod != 72*time.Hour {
+		t.Errorf("LoadConfig() cache cleanup = every %v after %v, want every 24h after 72h",
+			config.CacheCleanupInterval, config.CacheGracePeriod)
+	}
+
+	os.Setenv("BACKUP_CACHE_CLEANUP_GRACE", "0s")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for zero BACKUP_CACHE_CLEANUP_GRACE")
+	}
+}
+
+func TestLoadConfig_IntegrityTolerance(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.IntegrityTolerance != DefaultIntegrityTolerance {
+		t.Errorf("LoadConfig().IntegrityTolerance = %v, want %v by default", config.IntegrityTolerance, DefaultIntegrityTolerance)
+	}
+
+	os.Setenv("BACKUP_INTEGRITY_TOLERANCE", "off")
+	defer os.Unsetenv("BACKUP_INTEGRITY_TOLERANCE")
+	if config, err = LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.IntegrityTolerance >= 0 {
+		t.Errorf("LoadConfig().IntegrityTolerance = %v, want negative for off", config.IntegrityTolerance)
+	}
+
+	os.Setenv("BACKUP_INTEGRITY_TOLERANCE", "some")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for invalid BACKUP_INTEGRITY_TOLERANCE")
+	}
+}
+
+func TestLoadConfig_CoverageIgnore(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	os.Setenv("BACKUP_COVERAGE_IGNORE", "WorldEdit, Macros/ ,,")
+	defer os.Unsetenv("BACKUP_COVERAGE_IGNORE")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if len(config.CoverageIgnore) != 2 || config.CoverageIgnore[0] != "WorldEdit" || config.CoverageIgnore[1] != "Macros" {
+		t.Errorf("LoadConfig().CoverageIgnore = %q", config.CoverageIgnore)
+	}
+}
+
+func TestLoadConfig_FailureReportInterval(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.FailureReportInterval != DefaultFailureReportInterval {
+		t.Errorf("default FailureReportInterval = %v, want %v", config.FailureReportInterval, DefaultFailureReportInterval)
+	}
+
+	os.Setenv("BACKUP_FAILURE_REPORT_INTERVAL", "1d")
+	defer os.Unsetenv("BACKUP_FAILURE_REPORT_INTERVAL")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.FailureReportInterval != 24*time.Hour {
+		t.Errorf("LoadConfig().FailureReportInterval = %v, want 24h", config.FailureReportInterval)
+	}
+
+	os.Setenv("BACKUP_FAILURE_REPORT_INTERVAL", "soon")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for invalid BACKUP_FAILURE_REPORT_INTERVAL")
+	}
+}
+
+func TestLoadConfig_SplitProgressInterval(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.SplitProgressInterval != DefaultSplitProgressInterval {
+		t.Errorf("default SplitProgressInterval = %v, want %v", config.SplitProgressInterval, DefaultSplitProgressInterval)
+	}
+
+	os.Setenv("BACKUP_SPLIT_PROGRESS_INTERVAL", "5m")
+	defer os.Unsetenv("BACKUP_SPLIT_PROGRESS_INTERVAL")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.SplitProgressInterval != 5*time.Minute {
+		t.Errorf("LoadConfig().SplitProgressInterval = %v, want 5m", config.SplitProgressInterval)
+	}
+
+	os.Setenv("BACKUP_SPLIT_PROGRESS_INTERVAL", "0s")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for non-positive BACKUP_SPLIT_PROGRESS_INTERVAL")
+	}
+}
+
+func TestLoadConfig_StageTimeouts(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	os.Setenv("BACKUP_STAGE_TIMEOUTS", "restic-backup=4h,check=off")
+	defer os.Unsetenv("BACKUP_STAGE_TIMEOUTS")
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.StageTimeouts[StageResticBackup] != 4*time.Hour || config.StageTimeouts[StageCheck] != 0 || len(config.StageTimeouts) != 2 {
+		t.Errorf("LoadConfig().StageTimeouts = %v", config.StageTimeouts)
+	}
+
+	os.Setenv("BACKUP_STAGE_TIMEOUTS", "vacuum=1h")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for an unknown stage in BACKUP_STAGE_TIMEOUTS")
+	}
+}
+
+func TestLoadConfig_RetryBackoff(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.RetryBackoff != nil {
+		t.Errorf("LoadConfig().RetryBackoff = %v, want nil (Manager default)", config.RetryBackoff)
+	}
+
+	os.Setenv("BACKUP_RETRY_BACKOFF", "off")
+	defer os.Unsetenv("BACKUP_RETRY_BACKOFF")
+	if config, err = LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.RetryBackoff == nil || len(config.RetryBackoff) != 0 {
+		t.Errorf("LoadConfig().RetryBackoff = %#v, want retries off", config.RetryBackoff)
+	}
+
+	os.Setenv("BACKUP_RETRY_BACKOFF", "1m,never")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for invalid BACKUP_RETRY_BACKOFF")
+	}
+}
+
+func TestLoadConfig_WorldWidth(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.WorldWidth != 0 {
+		t.Errorf("LoadConfig().WorldWidth = %d, want 0 by default", config.WorldWidth)
+	}
+
+	os.Setenv("BACKUP_WORLD_WIDTH", "256000")
+	defer os.Unsetenv("BACKUP_WORLD_WIDTH")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.WorldWidth != 256000 {
+		t.Errorf("LoadConfig().WorldWidth = %d, want 256000", config.WorldWidth)
+	}
+
+	for _, bad := range []string{"0", "-1", "wide"} {
+		os.Setenv("BACKUP_WORLD_WIDTH", bad)
+		if _, err := LoadConfig(); err == nil {
+			t.Errorf("LoadConfig() expected error for BACKUP_WORLD_WIDTH=%q", bad)
+		}
+	}
+}
+
+func TestLoadConfig_Maintenance(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	os.Setenv("RESTIC_CHECK_INTERVAL", "7d")
+	defer os.Unsetenv("RESTIC_CHECK_INTERVAL")
+	os.Setenv("MAINTENANCE_MAX_DEFER", "12h")
+	defer os.Unsetenv("MAINTENANCE_MAX_DEFER")
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.CheckInterval != 7*24*time.Hour || config.MaintenanceMaxDefer != 12*time.Hour {
+		t.Errorf("LoadConfig() = %v, %v; want 168h, 12h", config.CheckInterval, config.MaintenanceMaxDefer)
+	}
+
+	for _, name := range []string{"RESTIC_CHECK_INTERVAL", "MAINTENANCE_MAX_DEFER"} {
+		os.Setenv(name, "0")
+		if _, err := LoadConfig(); err == nil {
+			t.Errorf("LoadConfig() expected error for %s=0", name)
+		}
+		os.Setenv(name, "1h")
+	}
+}
+
+func TestLoadConfig_LocalKeepVCDBS(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	os.Setenv("LOCAL_KEEP_VCDBS", "3")
+	defer os.Unsetenv("LOCAL_KEEP_VCDBS")
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.LocalKeepVCDBS != 3 {
+		t.Errorf("LoadConfig().LocalKeepVCDBS = %d, want 3", config.LocalKeepVCDBS)
+	}
+
+	for _, bad := range []string{"-1", "two"} {
+		os.Setenv("LOCAL_KEEP_VCDBS", bad)
+		if _, err := LoadConfig(); err == nil {
+			t.Errorf("LoadConfig() expected error for LOCAL_KEEP_VCDBS=%q", bad)
+		}
+	}
+}
+
+func TestLoadConfig_TreeLayout(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.TreeLayout != nil {
+		t.Errorf("LoadConfig().TreeLayout = %v, want nil by default", config.TreeLayout)
+	}
+
+	os.Setenv("BACKUP_TREE_LAYOUT", "hex:3:16")
+	defer os.Unsetenv("BACKUP_TREE_LAYOUT")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.TreeLayout == nil || config.TreeLayout.String() != "hex:3:16" {
+		t.Errorf("LoadConfig().TreeLayout = %v, want hex:3:16", config.TreeLayout)
+	}
+
+	os.Setenv("BACKUP_TREE_LAYOUT", "spiral")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for BACKUP_TREE_LAYOUT=spiral")
+	}
+}
+
+func TestLoadConfig_Windows(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.BackupWindow != nil || config.PruneWindow != nil {
+		t.Errorf("LoadConfig() windows = %v, %v; want nil by default", config.BackupWindow, config.PruneWindow)
+	}
+
+	os.Setenv("BACKUP_WINDOW", "22:00-04:00")
+	defer os.Unsetenv("BACKUP_WINDOW")
+	os.Setenv("PRUNE_WINDOW", "02:00-06:00")
+	defer os.Unsetenv("PRUNE_WINDOW")
+
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.BackupWindow.String() != "22:00-04:00" || config.PruneWindow.String() != "02:00-06:00" {
+		t.Errorf("LoadConfig() windows = %v, %v", config.BackupWindow, config.PruneWindow)
+	}
+
+	os.Setenv("PRUNE_WINDOW", "nightly")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for invalid PRUNE_WINDOW")
+	}
+}
+
+func TestLoadConfig_Hooks(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	hook := writeHook(t, t.TempDir(), "notify.sh", "true")
+	os.Setenv("HOOK_POST_BACKUP", hook)
+	defer os.Unsetenv("HOOK_POST_BACKUP")
+	os.Setenv("HOOK_TIMEOUT", "30s")
+	defer os.Unsetenv("HOOK_TIMEOUT")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.Hooks.PostBackup != hook || config.Hooks.Timeout != 30*time.Second {
+		t.Errorf("LoadConfig().Hooks = %+v", config.Hooks)
+	}
+
+	os.Setenv("HOOK_TIMEOUT", "0s")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for zero HOOK_TIMEOUT")
+	}
+	os.Unsetenv("HOOK_TIMEOUT")
+
+	os.Setenv("HOOK_BACKUP_FAILED", "/nonexistent/hook.sh")
+	defer os.Unsetenv("HOOK_BACKUP_FAILED")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for missing HOOK_BACKUP_FAILED")
+	}
+}
+
+func TestLoadConfig_Catchup(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.Catchup != CatchupOne {
+		t.Errorf("LoadConfig().Catchup = %q, want %q by default", config.Catchup, CatchupOne)
+	}
+
+	os.Setenv("BACKUP_CATCHUP", "none")
+	defer os.Unsetenv("BACKUP_CATCHUP")
+	config, err = LoadConfig()
+	if err != nil || config.Catchup != CatchupNone {
+		t.Errorf("LoadConfig().Catchup = %v, %v; want %q", config, err, CatchupNone)
+	}
+
+	os.Setenv("BACKUP_CATCHUP", "always")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for invalid BACKUP_CATCHUP")
+	}
+}
+
+func TestLoadConfig_Required(t *testing.T) {
+	os.Setenv("BACKUP_REQUIRED", "true")
+	defer os.Unsetenv("BACKUP_REQUIRED")
+
+	t.Run("without interval", func(t *testing.T) {
+		os.Unsetenv("BACKUP_INTERVAL")
+
+		if _, err := LoadConfig(); err == nil {
+			t.Error("LoadConfig() expected error when BACKUP_REQUIRED is set without BACKUP_INTERVAL")
+		}
+	})
+
+	t.Run("with interval", func(t *testing.T) {
+		os.Setenv("BACKUP_INTERVAL", "1h")
+		defer os.Unsetenv("BACKUP_INTERVAL")
+
+		config, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig() unexpected error: %v", err)
+		}
+		if !config.Required {
+			t.Error("LoadConfig().Required = false, want true")
+		}
+		if config.RequiredMaxFailures != 3 {
+			t.Errorf("LoadConfig().RequiredMaxFailures = %d, want default 3", config.RequiredMaxFailures)
+		}
+	})
+
+	t.Run("max failures", func(t *testing.T) {
+		os.Setenv("BACKUP_INTERVAL", "1h")
+		defer os.Unsetenv("BACKUP_INTERVAL")
+		os.Setenv("BACKUP_REQUIRED_MAX_FAILURES", "5")
+		defer os.Unsetenv("BACKUP_REQUIRED_MAX_FAILURES")
+
+		config, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig() unexpected error: %v", err)
+		}
+		if config.RequiredMaxFailures != 5 {
+			t.Errorf("LoadConfig().RequiredMaxFailures = %d, want 5", config.RequiredMaxFailures)
+		}
+
+		os.Setenv("BACKUP_REQUIRED_MAX_FAILURES", "0")
+		if _, err := LoadConfig(); err == nil {
+			t.Error("LoadConfig() expected error for BACKUP_REQUIRED_MAX_FAILURES=0")
+		}
+	})
+}
+
+func TestLoadConfig_HighChangeThreshold(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.HighChangeThreshold != DefaultHighChangeThreshold {
+		t.Errorf("LoadConfig().HighChangeThreshold = %v, want %v by default", config.HighChangeThreshold, DefaultHighChangeThreshold)
+	}
+
+	os.Setenv("BACKUP_HIGH_CHANGE_THRESHOLD", "95%")
+	defer os.Unsetenv("BACKUP_HIGH_CHANGE_THRESHOLD")
+	if config, err = LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.HighChangeThreshold != 0.95 {
+		t.Errorf("LoadConfig().HighChangeThreshold = %v, want 0.95", config.HighChangeThreshold)
+	}
+
+	os.Setenv("BACKUP_HIGH_CHANGE_THRESHOLD", "150%")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for invalid BACKUP_HIGH_CHANGE_THRESHOLD")
+	}
+}
+
+func TestLoadConfig_StagingStrategy(t *testing.T) {
+	os.Setenv("BACKUP_INTERVAL", "1h")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.StagingStrategy != StagingInPlace {
+		t.Errorf("LoadConfig().StagingStrategy = %q, want %q by default", config.StagingStrategy, StagingInPlace)
+	}
+
+	os.Setenv("BACKUP_STAGING_STRATEGY", "generations")
+	defer os.Unsetenv("BACKUP_STAGING_STRATEGY")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if config.StagingStrategy != StagingGenerations {
+		t.Errorf("LoadConfig().StagingStrategy = %q, want generations", config.StagingStrategy)
+	}
+
+	os.Setenv("BACKUP_STAGING_STRATEGY", "copy")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() expected error for invalid BACKUP_STAGING_STRATEGY")
 	}
 }
@@ -0,0 +1,77 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// coverageSkipped are top-level entries of the game data directory that
+// backups deliberately leave out, so they aren't reported as uncovered.
+var coverageSkipped = []string{
+	"Backups",           // /genbackup output, converted into Saves
+	"Cache",             // rebuilt by the server
+	".launcher_history", // console history
+}
+
+// UncoveredPaths returns the names of the top-level entries of GameDataDir
+// that have no counterpart in the staging tree, and so aren't backed up,
+// sorted. Entries backups deliberately skip (Backups, Cache, directories
+// with SyncSkip) and those in CoverageIgnore aren't reported. It fails if
+// nothing has been staged yet.
+func (m *Manager) UncoveredPaths() ([]string, error) {
+	m.applyPathDefaults()
+
+	if _, err := os.Stat(m.StagingDir); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("nothing has been staged yet; run a backup first")
+		}
+		return nil, fmt.Errorf("failed to stat staging directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(m.GameDataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read game data directory: %w", err)
+	}
+
+	var uncovered []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if slices.Contains(coverageSkipped, name) || slices.Contains(m.CoverageIgnore, name) || name == m.backupsEntry() ||
+			m.SyncPolicies[name].Mode == SyncSkip {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(m.StagingDir, name)); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to stat staged %s: %w", name, err)
+		}
+		uncovered = append(uncovered, name)
+	}
+	sort.Strings(uncovered)
+	return uncovered, nil
+}
+
+// reportCoverage warns about entries of GameDataDir that aren't backed up.
+// The warning is only repeated when the list changes. Must be called with
+// opMu held.
+func (m *Manager) reportCoverage() {
+	uncovered, err := m.UncoveredPaths()
+	if err != nil {
+		fmt.Printf("WARNING: Failed to check backup coverage: %v\n", err)
+		return
+	}
+	if slices.Equal(uncovered, m.lastUncovered) {
+		return
+	}
+	m.lastUncovered = uncovered
+
+	if len(uncovered) == 0 {
+		return
+	}
+	fmt.Printf("WARNING: These paths in %s are not backed up: %s\n", m.GameDataDir, strings.Join(uncovered, ", "))
+	fmt.Println("Add them to BACKUP_COVERAGE_IGNORE to silence this warning.")
+}
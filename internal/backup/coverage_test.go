@@ -0,0 +1,71 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestManager_UncoveredPaths(t *testing.T) {
+	gameDataDir := t.TempDir()
+	stagingDir := filepath.Join(t.TempDir(), "staging")
+	m := &Manager{GameDataDir: gameDataDir, StagingDir: stagingDir, CoverageIgnore: []string{"WorldEdit"}}
+
+	if _, err := m.UncoveredPaths(); err == nil {
+		t.Error("UncoveredPaths() expected error before anything was staged")
+	}
+
+	for _, dir := range []string{"Logs", "Mods", "ModConfig", "Backups", "Cache", "WorldEdit", "Macros"} {
+		if err := os.MkdirAll(filepath.Join(gameDataDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"serverconfig.json", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(gameDataDir, file), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, dir := range []string{"Logs", "Mods"} {
+		if err := os.MkdirAll(filepath.Join(stagingDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(stagingDir, "serverconfig.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	uncovered, err := m.UncoveredPaths()
+	if err != nil {
+		t.Fatalf("UncoveredPaths() failed: %v", err)
+	}
+	want := []string{"Macros", "ModConfig", "notes.txt"}
+	if !slices.Equal(uncovered, want) {
+		t.Errorf("UncoveredPaths() = %v, want %v", uncovered, want)
+	}
+}
+
+func TestManager_ReportCoverage_OnlyOnChange(t *testing.T) {
+	gameDataDir := t.TempDir()
+	stagingDir := t.TempDir()
+	m := &Manager{GameDataDir: gameDataDir, StagingDir: stagingDir}
+
+	if err := os.Mkdir(filepath.Join(gameDataDir, "ModConfig"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	m.reportCoverage()
+	if !slices.Equal(m.lastUncovered, []string{"ModConfig"}) {
+		t.Errorf("lastUncovered = %v, want [ModConfig]", m.lastUncovered)
+	}
+
+	// Once it is staged, nothing is left to report
+	if err := os.Mkdir(filepath.Join(stagingDir, "ModConfig"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	m.reportCoverage()
+	if len(m.lastUncovered) != 0 {
+		t.Errorf("lastUncovered = %v, want none", m.lastUncovered)
+	}
+}
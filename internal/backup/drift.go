@@ -0,0 +1,82 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// ErrOperationInProgress is returned by MeasureDrift while a backup,
+// compaction, or rollback is running.
+var ErrOperationInProgress = errors.New("a backup operation is in progress")
+
+// MeasureDrift compares the live save with its staging tree and records the
+// result in Status. The staging tree holds what the last backup
+// snapshotted, so the drift is how much of the world would be lost if the
+// live save were lost now. Only what the server has saved to disk counts,
+// and if the last backup failed after its split the drift is understated.
+//
+// The live save is only read, so the server keeps running. Fails with
+// ErrOperationInProgress rather than wait for a backup, compaction, or
+// rollback, which change the save or the tree.
+func (m *Manager) MeasureDrift(ctx context.Context) (*vcdbtree.Drift, error) {
+	if !m.opMu.TryLock() {
+		return nil, ErrOperationInProgress
+	}
+	defer m.opMu.Unlock()
+	m.applyPathDefaults()
+
+	if err := m.checkStagingComplete(); err != nil {
+		return nil, err
+	}
+	savePath, err := m.getSaveFilePath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get save file path: %w", err)
+	}
+	saveBaseName := strings.TrimSuffix(filepath.Base(savePath), ".vcdbs")
+	treeDir := filepath.Join(m.StagingDir, "Saves", saveBaseName)
+
+	// Compare as the split would have written the tree
+	opts := &vcdbtree.Options{MapSizeX: m.WorldWidth}
+	if len(m.TrimAreas) > 0 {
+		opts.Filter = vcdbtree.KeepWithinMap(m.TrimAreas, opts.MapSizeX)
+	}
+	drift, err := vcdbtree.Compare(ctx, savePath, treeDir, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare live save with staging tree: %w", err)
+	}
+
+	m.statusMu.Lock()
+	m.status.Drift = drift
+	m.status.DriftMeasured = m.clock().Now()
+	m.statusMu.Unlock()
+	return drift, nil
+}
+
+// runDriftLoop measures drift every DriftInterval until ctx is done.
+// Measurements that would overlap a backup are skipped, as are those
+// before the first backup has staged the world.
+func (m *Manager) runDriftLoop(ctx context.Context) {
+	defer m.wg.Done()
+
+	ticker := m.clock().NewTicker(m.DriftInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			_, err := m.MeasureDrift(ctx)
+			if err != nil && ctx.Err() == nil && !errors.Is(err, ErrOperationInProgress) &&
+				!errors.Is(err, ErrStagingIncomplete) && !errors.Is(err, fs.ErrNotExist) {
+				fmt.Printf("WARNING: Failed to measure drift from the last backup: %v\n", err)
+			}
+		}
+	}
+}
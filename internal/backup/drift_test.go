@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/clock"
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+// setupDrift stages the sample save as the world "default" and puts the
+// same save in place as the live world, returning its path.
+func setupDrift(t *testing.T) (m *Manager, savePath string) {
+	t.Helper()
+	m, _ = setupStagedTree(t)
+	if err := os.WriteFile(filepath.Join(m.GameDataDir, "serverconfig.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	savePath = filepath.Join(m.GameDataDir, "Saves", "default.vcdbs")
+	if err := os.MkdirAll(filepath.Dir(savePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	testsupport.CreateSave(t, savePath)
+	return m, savePath
+}
+
+func TestManager_MeasureDrift(t *testing.T) {
+	m, savePath := setupDrift(t)
+	measured := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	m.Clock = clock.NewFake(measured)
+
+	drift, err := m.MeasureDrift(context.Background())
+	if err != nil {
+		t.Fatalf("MeasureDrift() failed: %v", err)
+	}
+	if drift.Total().Rows() != 0 {
+		t.Errorf("MeasureDrift() of an unchanged world = %v, want no changes", drift)
+	}
+
+	db, err := sql.Open("sqlite3", savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO chunk (position, data) VALUES (7, X'0102')"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	drift, err = m.MeasureDrift(context.Background())
+	if err != nil {
+		t.Fatalf("MeasureDrift() failed: %v", err)
+	}
+	if got := drift.Tables["chunk"]; got.Added != 1 || got.Bytes != 2 {
+		t.Errorf("MeasureDrift() chunk = %+v, want 1 added of 2 bytes", got)
+	}
+	status := m.Status()
+	if status.Drift != drift || !status.DriftMeasured.Equal(measured) {
+		t.Errorf("Status() drift = %v at %v, want the measurement at %v", status.Drift, status.DriftMeasured, measured)
+	}
+
+	// A successful backup catches up with the live world
+	m.recordAttempt(nil, measured.Add(time.Hour))
+	if status := m.Status(); status.Drift == nil || status.Drift.Total().Rows() != 0 {
+		t.Errorf("Status() drift after a backup = %v, want no changes", status.Drift)
+	}
+}
+
+func TestManager_MeasureDrift_Busy(t *testing.T) {
+	m, _ := setupDrift(t)
+	m.opMu.Lock()
+	_, err := m.MeasureDrift(context.Background())
+	m.opMu.Unlock()
+	if !errors.Is(err, ErrOperationInProgress) {
+		t.Errorf("MeasureDrift() during a backup = %v, want ErrOperationInProgress", err)
+	}
+}
+
+func TestManager_MeasureDrift_StagingIncomplete(t *testing.T) {
+	m, _ := setupDrift(t)
+	if err := m.requireResplit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.MeasureDrift(context.Background()); !errors.Is(err, ErrStagingIncomplete) {
+		t.Errorf("MeasureDrift() = %v, want ErrStagingIncomplete", err)
+	}
+}
+
+func TestManager_DriftLoop(t *testing.T) {
+	m, _ := setupDrift(t)
+	fake := clock.NewFake(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	m.Clock = fake
+	m.DriftInterval = 15 * time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.wg.Add(1)
+	go m.runDriftLoop(ctx)
+	defer func() {
+		cancel()
+		m.wg.Wait()
+	}()
+
+	fake.BlockUntil(1)
+	if m.Status().Drift != nil {
+		t.Fatal("drift measured before the first interval")
+	}
+	fake.Advance(15 * time.Minute)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Status().Drift == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("drift wasn't measured after the interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if measured := m.Status().DriftMeasured; !measured.Equal(fake.Now()) {
+		t.Errorf("DriftMeasured = %v, want %v", measured, fake.Now())
+	}
+}
@@ -0,0 +1,233 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/snapshotmeta"
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// ExportManifestName is the name of the file at the root of an export
+// archive that describes it.
+const ExportManifestName = "export.json"
+
+// GameDateUnavailable is the game date recorded in export manifests.
+// Snapshots don't record the in-game calendar, and reading it from a world
+// would mean decoding the savegame's game data, so it is never known.
+const GameDateUnavailable = "unavailable"
+
+// Encryption tools exports can be encrypted with.
+const (
+	EncryptAge = "age"
+	EncryptGPG = "gpg"
+)
+
+// ExportManifest describes an export archive.
+type ExportManifest struct {
+	// Snapshot is the restic snapshot the export was made from.
+	Snapshot string `json:"snapshot"`
+
+	// ExportedAt is when the archive was written.
+	ExportedAt time.Time `json:"exported_at"`
+
+	// Worlds lists the worlds in the archive by name.
+	Worlds []string `json:"worlds"`
+
+	// Savegames is true if worlds are stored as Saves/<name>.vcdbs, ready to
+	// load, rather than as vcdbtree directories.
+	Savegames bool `json:"savegames"`
+
+	// ServerVersion is the game version that saved the worlds, if known.
+	ServerVersion string `json:"server_version,omitempty"`
+
+	// GameDate is the in-game date of the worlds. It is always
+	// GameDateUnavailable, and is kept so the manifest says so rather than
+	// leaving the date out.
+	GameDate string `json:"game_date"`
+}
+
+// ExportOptions configures WriteExportArchive.
+type ExportOptions struct {
+	// Snapshot is recorded in the manifest.
+	Snapshot string
+
+	// Savegames combines each world tree into a .vcdbs savegame.
+	Savegames bool
+
+	// WorkDir holds savegames while they are added. Defaults to the
+	// system's temporary directory.
+	WorkDir string
+}
+
+// EncryptCommand returns the command that encrypts its stdin to its stdout
+// for recipients with tool, EncryptAge or EncryptGPG. Recipients are age
+// public keys, or GnuPG key IDs, fingerprints, or email addresses.
+func EncryptCommand(tool string, recipients []string) (name string, args []string, err error) {
+	if len(recipients) == 0 {
+		return "", nil, fmt.Errorf("no recipients to encrypt the export for")
+	}
+	switch tool {
+	case EncryptAge:
+		for _, r := range recipients {
+			args = append(args, "--recipient", r)
+		}
+		return "age", append([]string{"--encrypt"}, args...), nil
+	case EncryptGPG:
+		// Recipients are named explicitly, so keys needn't be certified
+		args = []string{"--batch", "--yes", "--trust-model", "always", "--encrypt"}
+		for _, r := range recipients {
+			args = append(args, "--recipient", r)
+		}
+		return "gpg", args, nil
+	}
+	return "", nil, fmt.Errorf("unknown encryption tool %q: must be %s or %s", tool, EncryptAge, EncryptGPG)
+}
+
+// WriteExportArchive writes the snapshot restored at snapshotDir to w as a
+// gzip-compressed tar, with an ExportManifest at its root, and returns the
+// manifest. World trees are checked against the digests in the snapshot's
+// metadata first, so a damaged restore isn't archived.
+func WriteExportArchive(ctx context.Context, w io.Writer, snapshotDir string, opts ExportOptions) (*ExportManifest, error) {
+	meta, err := snapshotmeta.Read(snapshotDir)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &ExportManifest{
+		Snapshot:   opts.Snapshot,
+		ExportedAt: time.Now().UTC().Truncate(time.Second),
+		Savegames:  opts.Savegames,
+		GameDate:   GameDateUnavailable,
+	}
+	if meta != nil {
+		manifest.ServerVersion = meta.ServerVersion
+	}
+
+	savesDir := filepath.Join(snapshotDir, "Saves")
+	trees, err := os.ReadDir(savesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read saves: %w", err)
+	}
+	for _, tree := range trees {
+		if !tree.IsDir() {
+			continue
+		}
+		if _, err := VerifyTreeDigest(ctx, meta, tree.Name(), filepath.Join(savesDir, tree.Name())); err != nil {
+			return nil, err
+		}
+		manifest.Worlds = append(manifest.Worlds, tree.Name())
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal export manifest: %w", err)
+	}
+	data = append(data, '\n')
+	hdr := &tar.Header{Name: ExportManifestName, Mode: 0644, Size: int64(len(data)), ModTime: manifest.ExportedAt}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, fmt.Errorf("failed to write export archive: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to write export archive: %w", err)
+	}
+
+	err = filepath.WalkDir(snapshotDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(snapshotDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		// Worlds are Saves/<name>; combine them if asked
+		if opts.Savegames && d.IsDir() && filepath.Dir(rel) == "Saves" {
+			return exportSavegame(ctx, tw, path, name+".vcdbs", opts.WorkDir)
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		return addToArchive(tw, path, name)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write export archive: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write export archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write export archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// exportSavegame combines the tree at treeDir into a savegame in workDir and
+// adds it to the archive as name. Returns fs.SkipDir so the tree itself
+// isn't added.
+func exportSavegame(ctx context.Context, tw *tar.Writer, treeDir, name, workDir string) error {
+	tmpDir, err := os.MkdirTemp(workDir, "export-")
+	if err != nil {
+		return fmt.Errorf("failed to create savegame: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	savegame := filepath.Join(tmpDir, filepath.Base(name))
+
+	fmt.Printf("Combining %s\n", strings.TrimSuffix(filepath.Base(name), ".vcdbs"))
+	if err := vcdbtree.CombineContext(ctx, treeDir, savegame, nil); err != nil {
+		return fmt.Errorf("failed to combine %s: %w", treeDir, err)
+	}
+	if err := addToArchive(tw, savegame, name); err != nil {
+		return err
+	}
+	return fs.SkipDir
+}
+
+// addToArchive adds the file or directory at path to the archive as name.
+func addToArchive(tw *tar.Writer, path, name string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	// Owners on the server mean nothing where the archive is unpacked
+	hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
@@ -0,0 +1,193 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+func TestEncryptCommand(t *testing.T) {
+	for _, tt := range []struct {
+		tool       string
+		recipients []string
+		wantName   string
+		wantArgs   []string
+		wantErr    bool
+	}{
+		{
+			tool:       EncryptAge,
+			recipients: []string{"age1a", "age1b"},
+			wantName:   "age",
+			wantArgs:   []string{"--encrypt", "--recipient", "age1a", "--recipient", "age1b"},
+		},
+		{
+			tool:       EncryptGPG,
+			recipients: []string{"admin@example.com"},
+			wantName:   "gpg",
+			wantArgs:   []string{"--batch", "--yes", "--trust-model", "always", "--encrypt", "--recipient", "admin@example.com"},
+		},
+		{tool: EncryptAge, wantErr: true},
+		{tool: "zip", recipients: []string{"x"}, wantErr: true},
+	} {
+		name, args, err := EncryptCommand(tt.tool, tt.recipients)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("EncryptCommand(%q, %v) succeeded, want error", tt.tool, tt.recipients)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("EncryptCommand(%q, %v) failed: %v", tt.tool, tt.recipients, err)
+		}
+		if name != tt.wantName || !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("EncryptCommand(%q, %v) = %s %v, want %s %v", tt.tool, tt.recipients, name, args, tt.wantName, tt.wantArgs)
+		}
+	}
+}
+
+// setupExport stages a snapshot with one world tree and a digest for it, as
+// restic would restore it, and returns its directory and tree.
+func setupExport(t *testing.T) (snapshotDir, treeDir string) {
+	t.Helper()
+	dir := t.TempDir()
+	save := filepath.Join(dir, "world.vcdbs")
+	testsupport.CreateSave(t, save)
+
+	snapshotDir = filepath.Join(dir, "staging")
+	treeDir = filepath.Join(snapshotDir, "Saves", "world")
+	if err := vcdbtree.Split(save, treeDir); err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(snapshotDir, "serverconfig.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := vcdbtree.Digest(context.Background(), treeDir)
+	if err != nil {
+		t.Fatalf("Digest failed: %v", err)
+	}
+	staged := &Manager{StagingDir: snapshotDir}
+	meta := SnapshotMetadata{ServerVersion: "1.21.6", TreeDigests: map[string]string{"world": digest}}
+	if err := staged.writeMetadata(meta); err != nil {
+		t.Fatalf("writeMetadata failed: %v", err)
+	}
+	return snapshotDir, treeDir
+}
+
+// readArchive returns the names of the entries of a gzip-compressed tar in
+// order, and the content of each file.
+func readArchive(t *testing.T, data []byte) ([]string, map[string][]byte) {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to read gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read tar: %v", err)
+		}
+		names = append(names, hdr.Name)
+		if hdr.Typeflag == tar.TypeReg {
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[hdr.Name] = content
+		}
+	}
+	return names, files
+}
+
+func TestWriteExportArchive(t *testing.T) {
+	snapshotDir, _ := setupExport(t)
+
+	var buf bytes.Buffer
+	manifest, err := WriteExportArchive(context.Background(), &buf, snapshotDir, ExportOptions{Snapshot: "abc123"})
+	if err != nil {
+		t.Fatalf("WriteExportArchive failed: %v", err)
+	}
+	if manifest.Snapshot != "abc123" || manifest.ServerVersion != "1.21.6" || manifest.GameDate != GameDateUnavailable ||
+		!reflect.DeepEqual(manifest.Worlds, []string{"world"}) {
+		t.Errorf("unexpected manifest: %+v", manifest)
+	}
+
+	names, files := readArchive(t, buf.Bytes())
+	if len(names) == 0 || names[0] != ExportManifestName {
+		t.Fatalf("expected %s first, got %v", ExportManifestName, names)
+	}
+	var got ExportManifest
+	if err := json.Unmarshal(files[ExportManifestName], &got); err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	if !reflect.DeepEqual(&got, manifest) {
+		t.Errorf("archived manifest = %+v, want %+v", got, *manifest)
+	}
+	for _, name := range []string{MetadataFileName, "serverconfig.json", "Saves/world/gamedata/1.bin"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected %s in archive, got %v", name, names)
+		}
+	}
+}
+
+func TestWriteExportArchive_Savegames(t *testing.T) {
+	snapshotDir, _ := setupExport(t)
+	workDir := t.TempDir()
+
+	var buf bytes.Buffer
+	_, err := WriteExportArchive(context.Background(), &buf, snapshotDir, ExportOptions{Savegames: true, WorkDir: workDir})
+	if err != nil {
+		t.Fatalf("WriteExportArchive failed: %v", err)
+	}
+
+	names, files := readArchive(t, buf.Bytes())
+	for _, name := range names {
+		if filepath.Dir(name) == "Saves/world" || name == "Saves/world/" {
+			t.Errorf("expected the tree to be replaced by a savegame, found %s", name)
+		}
+	}
+	savegame, ok := files["Saves/world.vcdbs"]
+	if !ok {
+		t.Fatalf("expected Saves/world.vcdbs in archive, got %v", names)
+	}
+	if !bytes.HasPrefix(savegame, []byte("SQLite format 3\x00")) {
+		t.Error("expected Saves/world.vcdbs to be a SQLite database")
+	}
+
+	// The combined savegame is only kept while it is added
+	if entries, _ := os.ReadDir(workDir); len(entries) != 0 {
+		t.Errorf("expected work directory to be empty, got %d entries", len(entries))
+	}
+}
+
+func TestWriteExportArchive_DigestMismatch(t *testing.T) {
+	snapshotDir, treeDir := setupExport(t)
+	if err := os.WriteFile(filepath.Join(treeDir, "gamedata", "1.bin"), []byte("flipped"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	_, err := WriteExportArchive(context.Background(), &buf, snapshotDir, ExportOptions{})
+	if !errors.Is(err, vcdbtree.ErrDigestMismatch) {
+		t.Fatalf("WriteExportArchive error = %v, want %v", err, vcdbtree.ErrDigestMismatch)
+	}
+	if buf.Len() != 0 {
+		t.Error("expected nothing to be written for a damaged snapshot")
+	}
+}
@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultFailureReportInterval is how often a backup failure that keeps
+// repeating is reported when FailureReportInterval isn't set.
+const DefaultFailureReportInterval = 6 * time.Hour
+
+// RepeatedFailureError wraps a backup error that is the same as the one the
+// previous backup failed with. Suppressed repeats aren't reported: the
+// failure hook doesn't run and the launcher doesn't print them. Once every
+// FailureReportInterval, a repeat is reported with a count instead.
+type RepeatedFailureError struct {
+	// Err is the error the backup failed with.
+	Err error
+
+	// Count is how many backups in a row have failed with this error.
+	Count int
+
+	// Since is when the first of them failed.
+	Since time.Time
+
+	// Suppressed is true if this repeat isn't to be reported.
+	Suppressed bool
+
+	// now is when this repeat happened, for Error.
+	now time.Time
+}
+
+func (e *RepeatedFailureError) Error() string {
+	return fmt.Sprintf("same error, %d occurrences in the last %s: %v", e.Count, formatSpan(e.now.Sub(e.Since)), e.Err)
+}
+
+func (e *RepeatedFailureError) Unwrap() error {
+	return e.Err
+}
+
+// IsSuppressedFailure reports whether err is a repeated backup failure that
+// shouldn't be reported again yet.
+func IsSuppressedFailure(err error) bool {
+	var repeated *RepeatedFailureError
+	return errors.As(err, &repeated) && repeated.Suppressed
+}
+
+// failureTracker remembers the error backups are currently failing with.
+type failureTracker struct {
+	fingerprint  string
+	count        int
+	since        time.Time
+	lastReported time.Time
+}
+
+// digitRuns matches the parts of an error message, like durations, ports, and
+// temporary file names, that change between otherwise identical failures.
+var digitRuns = regexp.MustCompile(`[0-9]+`)
+
+// failureFingerprint identifies an error regardless of the numbers in it.
+func failureFingerprint(err error) string {
+	return digitRuns.ReplaceAllString(err.Error(), "#")
+}
+
+// throttleFailure records the outcome of a backup that ran at now and returns
+// err, wrapped in a RepeatedFailureError if the previous backup failed the
+// same way. Success or a different error starts over. Must be called with
+// opMu held.
+func (m *Manager) throttleFailure(err error, now time.Time) error {
+	t := &m.failures
+	if err == nil {
+		if t.count > 1 {
+			fmt.Printf("Backups are succeeding again after %d failures in a row.\n", t.count)
+		}
+		*t = failureTracker{}
+		return nil
+	}
+
+	fingerprint := failureFingerprint(err)
+	if fingerprint != t.fingerprint {
+		*t = failureTracker{fingerprint: fingerprint, count: 1, since: now, lastReported: now}
+		return err
+	}
+
+	t.count++
+	repeated := &RepeatedFailureError{Err: err, Count: t.count, Since: t.since, now: now}
+	if now.Sub(t.lastReported) < m.failureReportInterval() {
+		repeated.Suppressed = true
+	} else {
+		t.lastReported = now
+	}
+	return repeated
+}
+
+func (m *Manager) failureReportInterval() time.Duration {
+	if m.FailureReportInterval > 0 {
+		return m.FailureReportInterval
+	}
+	return DefaultFailureReportInterval
+}
+
+// formatSpan formats a duration for a failure summary, e.g. "6h" or "1h30m".
+func formatSpan(d time.Duration) string {
+	if d >= time.Minute {
+		d = d.Round(time.Minute)
+	} else {
+		d = d.Round(time.Second)
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,96 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestManager_ThrottleFailure(t *testing.T) {
+	m := &Manager{FailureReportInterval: 6 * time.Hour}
+	start := time.Date(2025, 12, 14, 12, 0, 0, 0, time.UTC)
+	unreachable := func(port int) error {
+		return fmt.Errorf("dial tcp 10.0.0.5:%d: connection refused", port)
+	}
+
+	// The first failure is reported as is
+	if err := m.throttleFailure(unreachable(1), start); err == nil || IsSuppressedFailure(err) {
+		t.Fatalf("first failure: got %v", err)
+	} else if _, ok := err.(*RepeatedFailureError); ok {
+		t.Errorf("first failure should not be wrapped: %v", err)
+	}
+
+	// Repeats differing only in numbers are suppressed until the interval passes
+	for i := 1; i < 6; i++ {
+		err := m.throttleFailure(unreachable(i+1), start.Add(time.Duration(i)*time.Hour))
+		if !IsSuppressedFailure(err) {
+			t.Errorf("repeat %d: expected suppressed, got %v", i, err)
+		}
+	}
+
+	err := m.throttleFailure(unreachable(7), start.Add(6*time.Hour))
+	var repeated *RepeatedFailureError
+	if !errors.As(err, &repeated) || repeated.Suppressed {
+		t.Fatalf("after the interval: expected a reported repeat, got %v", err)
+	}
+	if repeated.Count != 7 || !repeated.Since.Equal(start) {
+		t.Errorf("repeat = %+v, want Count 7 since %v", repeated, start)
+	}
+	if want := "same error, 7 occurrences in the last 6h: dial tcp 10.0.0.5:7: connection refused"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	// The next repeat is suppressed again
+	if err := m.throttleFailure(unreachable(8), start.Add(7*time.Hour)); !IsSuppressedFailure(err) {
+		t.Errorf("expected suppressed after a report, got %v", err)
+	}
+}
+
+func TestManager_ThrottleFailure_Resets(t *testing.T) {
+	m := &Manager{}
+	now := time.Date(2025, 12, 14, 12, 0, 0, 0, time.UTC)
+	failure := errors.New("restic failed")
+
+	m.throttleFailure(failure, now)
+	if err := m.throttleFailure(failure, now.Add(time.Hour)); !IsSuppressedFailure(err) {
+		t.Fatalf("expected suppressed repeat, got %v", err)
+	}
+
+	// A different error is reported right away
+	other := errors.New("staging directory is full")
+	if err := m.throttleFailure(other, now.Add(2*time.Hour)); err != other {
+		t.Errorf("different error: got %v, want %v", err, other)
+	}
+
+	// So is the first failure after a success
+	m.throttleFailure(nil, now.Add(3*time.Hour))
+	if err := m.throttleFailure(other, now.Add(4*time.Hour)); err != other {
+		t.Errorf("after success: got %v, want %v", err, other)
+	}
+}
+
+func TestRepeatedFailureError_Unwrap(t *testing.T) {
+	failure := errors.New("restic failed")
+	err := &RepeatedFailureError{Err: failure, Count: 2}
+	if !errors.Is(err, failure) {
+		t.Error("RepeatedFailureError should unwrap to the original error")
+	}
+}
+
+func TestFormatSpan(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{6 * time.Hour, "6h"},
+		{90 * time.Minute, "1h30m"},
+		{10 * time.Minute, "10m"},
+		{45 * time.Second, "45s"},
+	}
+	for _, tt := range tests {
+		if got := formatSpan(tt.d); got != tt.want {
+			t.Errorf("formatSpan(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ForgetPreview is what restic forget would do with a retention policy, as
+// reported by `!prune dry-run`.
+type ForgetPreview struct {
+	// Retention is the policy that was previewed.
+	Retention string
+
+	// Groups are the groups of snapshots the policy is applied to
+	// separately; see PruneGroupBy.
+	Groups []ForgetGroup
+}
+
+// ForgetGroup is a group of snapshots restic forget applies the policy to.
+type ForgetGroup struct {
+	// Host, Tags, and Paths are what the group's snapshots have in common,
+	// as far as they are grouped by them.
+	Host  string
+	Tags  []string
+	Paths []string
+
+	// Keep and Remove are the snapshots that would be kept and removed,
+	// newest first.
+	Keep   []ForgetSnapshot
+	Remove []ForgetSnapshot
+}
+
+// ForgetSnapshot is a snapshot in a ForgetPreview.
+type ForgetSnapshot struct {
+	ID   string
+	Time time.Time
+	Tags []string
+
+	// Reasons says which rules of the policy keep the snapshot, such as
+	// "daily snapshot". Empty for removed snapshots.
+	Reasons []string
+}
+
+// Kept returns how many snapshots would be kept, in every group.
+func (p *ForgetPreview) Kept() int {
+	n := 0
+	for _, g := range p.Groups {
+		n += len(g.Keep)
+	}
+	return n
+}
+
+// Removed returns how many snapshots would be removed, in every group.
+func (p *ForgetPreview) Removed() int {
+	n := 0
+	for _, g := range p.Groups {
+		n += len(g.Remove)
+	}
+	return n
+}
+
+// Format describes the preview, one snapshot per line grouped as restic
+// groups them, with ages relative to now.
+func (p *ForgetPreview) Format(now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Retention %s would keep %d snapshot(s) and remove %d", p.Retention, p.Kept(), p.Removed())
+	for _, g := range p.Groups {
+		fmt.Fprintf(&b, "\n%s: keep %d, remove %d", g.label(), len(g.Keep), len(g.Remove))
+		for _, s := range g.Keep {
+			fmt.Fprintf(&b, "\n  keep   %s", s.format(now))
+			if len(s.Reasons) > 0 {
+				fmt.Fprintf(&b, " (%s)", strings.Join(s.Reasons, ", "))
+			}
+		}
+		for _, s := range g.Remove {
+			fmt.Fprintf(&b, "\n  remove %s", s.format(now))
+		}
+	}
+	return b.String()
+}
+
+// label names the group by what its snapshots share.
+func (g ForgetGroup) label() string {
+	var parts []string
+	if g.Host != "" {
+		parts = append(parts, "host "+g.Host)
+	}
+	if len(g.Tags) > 0 {
+		parts = append(parts, "tags "+strings.Join(g.Tags, ","))
+	}
+	if len(g.Paths) > 0 {
+		parts = append(parts, "paths "+strings.Join(g.Paths, ","))
+	}
+	if len(parts) == 0 {
+		return "All snapshots"
+	}
+	return "Snapshots with " + strings.Join(parts, ", ")
+}
+
+// format describes the snapshot with its age relative to now and its tags.
+func (s ForgetSnapshot) format(now time.Time) string {
+	line := fmt.Sprintf("%s  %s  %s old", s.ID, s.Time.UTC().Format("2006-01-02 15:04"), formatAge(now.Sub(s.Time)))
+	if len(s.Tags) > 0 {
+		line += "  [" + strings.Join(s.Tags, " ") + "]"
+	}
+	return line
+}
+
+// resticForgetGroup is an entry of `restic forget --json` output.
+type resticForgetGroup struct {
+	Host    string                 `json:"host"`
+	Tags    []string               `json:"tags"`
+	Paths   []string               `json:"paths"`
+	Keep    []resticForgetSnapshot `json:"keep"`
+	Remove  []resticForgetSnapshot `json:"remove"`
+	Reasons []struct {
+		Snapshot resticForgetSnapshot `json:"snapshot"`
+		Matches  []string             `json:"matches"`
+	} `json:"reasons"`
+}
+
+// resticForgetSnapshot is the part of a snapshot in `restic forget --json`
+// output used here.
+type resticForgetSnapshot struct {
+	ID      string    `json:"id"`
+	ShortID string    `json:"short_id"`
+	Time    time.Time `json:"time"`
+	Tags    []string  `json:"tags"`
+}
+
+// PreviewForget runs restic forget with --dry-run to show which of this
+// server's snapshots retention would keep and remove, without removing any.
+// An empty retention previews the current PruneRetention.
+func (m *Manager) PreviewForget(ctx context.Context, retention string) (*ForgetPreview, error) {
+	retention, err := ParsePruneRetention(retention)
+	if err != nil {
+		return nil, err
+	}
+	if retention == "" {
+		retention = m.pruneRetention()
+	}
+	if retention == "" {
+		return nil, fmt.Errorf("no retention policy is configured; give one to preview, e.g. --keep-daily 7")
+	}
+
+	var groups []resticForgetGroup
+	args := append(m.forgetPolicyArgs(retention), "--dry-run", "--json")
+	if err := m.runResticJSON(ctx, &groups, args...); err != nil {
+		return nil, err
+	}
+
+	preview := &ForgetPreview{Retention: retention}
+	for _, g := range groups {
+		reasons := make(map[string][]string)
+		for _, r := range g.Reasons {
+			reasons[r.Snapshot.ID] = r.Matches
+		}
+		group := ForgetGroup{Host: g.Host, Tags: g.Tags, Paths: g.Paths}
+		for _, s := range g.Keep {
+			group.Keep = append(group.Keep, s.preview(reasons[s.ID]))
+		}
+		for _, s := range g.Remove {
+			group.Remove = append(group.Remove, s.preview(nil))
+		}
+		sortNewestFirst(group.Keep)
+		sortNewestFirst(group.Remove)
+		preview.Groups = append(preview.Groups, group)
+	}
+	return preview, nil
+}
+
+// preview converts a snapshot from restic's output.
+func (s resticForgetSnapshot) preview(reasons []string) ForgetSnapshot {
+	id := s.ShortID
+	if id == "" && len(s.ID) >= 8 {
+		id = s.ID[:8]
+	}
+	return ForgetSnapshot{ID: id, Time: s.Time, Tags: s.Tags, Reasons: reasons}
+}
+
+// sortNewestFirst sorts snapshots by time, newest first.
+func sortNewestFirst(snapshots []ForgetSnapshot) {
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.After(snapshots[j].Time)
+	})
+}
@@ -0,0 +1,118 @@
+package backup
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// forgetDryRunOutput is `restic forget --dry-run --json` output for two
+// groups, trimmed to the fields restic reports.
+const forgetDryRunOutput = `[
+  {
+    "tags": ["snapshot_set=world"],
+    "host": "survival",
+    "paths": ["/backupcache/staging"],
+    "keep": [
+      {"time": "2025-01-02T12:00:00Z", "tags": ["snapshot_set=world"], "id": "bbbbbbbb11111111", "short_id": "bbbbbbbb"},
+      {"time": "2025-01-03T12:00:00Z", "tags": ["snapshot_set=world"], "id": "cccccccc11111111", "short_id": "cccccccc"}
+    ],
+    "remove": [
+      {"time": "2025-01-01T12:00:00Z", "tags": ["snapshot_set=world"], "id": "aaaaaaaa11111111", "short_id": "aaaaaaaa"}
+    ],
+    "reasons": [
+      {"snapshot": {"time": "2025-01-03T12:00:00Z", "id": "cccccccc11111111"}, "matches": ["last snapshot", "daily snapshot"]},
+      {"snapshot": {"time": "2025-01-02T12:00:00Z", "id": "bbbbbbbb11111111"}, "matches": ["daily snapshot"]}
+    ]
+  },
+  {
+    "tags": ["snapshot_set=mods"],
+    "host": "survival",
+    "paths": ["/backupcache/staging/Mods"],
+    "keep": [
+      {"time": "2025-01-03T00:00:00Z", "tags": ["snapshot_set=mods"], "id": "dddddddd11111111", "short_id": "dddddddd"}
+    ],
+    "remove": null,
+    "reasons": [
+      {"snapshot": {"time": "2025-01-03T00:00:00Z", "id": "dddddddd11111111"}, "matches": ["last snapshot"]}
+    ]
+  }
+]`
+
+func TestManager_PreviewForget(t *testing.T) {
+	var calls [][]string
+	m := &Manager{
+		ResticHost:     "survival",
+		PruneGroupBy:   "host,tags",
+		PruneRetention: "--keep-last 1",
+		OutputRunner: func(ctx context.Context, args ...string) ([]byte, error) {
+			calls = append(calls, args)
+			return []byte(forgetDryRunOutput), nil
+		},
+	}
+
+	preview, err := m.PreviewForget(context.Background(), "--keep-daily 2")
+	if err != nil {
+		t.Fatalf("PreviewForget failed: %v", err)
+	}
+
+	// The given policy is previewed, never pruned
+	want := [][]string{{"forget", "--host", "survival", "--group-by", "host,tags", "--keep-daily", "2", "--keep-tag", "pinned", "--dry-run", "--json"}}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("restic calls = %v, want %v", calls, want)
+	}
+
+	if preview.Kept() != 3 || preview.Removed() != 1 || len(preview.Groups) != 2 {
+		t.Fatalf("preview keeps %d and removes %d in %d groups, want 3, 1, 2", preview.Kept(), preview.Removed(), len(preview.Groups))
+	}
+	world := preview.Groups[0]
+	if world.Keep[0].ID != "cccccccc" || !reflect.DeepEqual(world.Keep[0].Reasons, []string{"last snapshot", "daily snapshot"}) {
+		t.Errorf("expected the newest snapshot first with its reasons, got %+v", world.Keep[0])
+	}
+	if world.Remove[0].ID != "aaaaaaaa" || len(world.Remove[0].Reasons) != 0 {
+		t.Errorf("unexpected removed snapshot %+v", world.Remove[0])
+	}
+
+	out := preview.Format(time.Date(2025, 1, 4, 12, 0, 0, 0, time.UTC))
+	for _, part := range []string{
+		"Retention --keep-daily 2 would keep 3 snapshot(s) and remove 1",
+		"Snapshots with host survival, tags snapshot_set=world, paths /backupcache/staging: keep 2, remove 1",
+		"keep   cccccccc  2025-01-03 12:00  24h0m0s old  [snapshot_set=world] (last snapshot, daily snapshot)",
+		"remove aaaaaaaa  2025-01-01 12:00  3d0h old",
+		"tags snapshot_set=mods, paths /backupcache/staging/Mods: keep 1, remove 0",
+	} {
+		if !strings.Contains(out, part) {
+			t.Errorf("Format() = %q, missing %q", out, part)
+		}
+	}
+}
+
+func TestManager_PreviewForget_Retention(t *testing.T) {
+	var got []string
+	m := &Manager{
+		ResticHost: "survival",
+		OutputRunner: func(ctx context.Context, args ...string) ([]byte, error) {
+			got = args
+			return []byte("[]"), nil
+		},
+	}
+
+	if _, err := m.PreviewForget(context.Background(), ""); err == nil {
+		t.Error("expected an error without a retention policy to preview")
+	}
+	if _, err := m.PreviewForget(context.Background(), "--keep-daily"); err == nil {
+		t.Error("expected an error for an invalid retention policy")
+	}
+
+	// Without a policy, the configured one is previewed
+	m.PruneRetention = "--keep-within 30d"
+	preview, err := m.PreviewForget(context.Background(), "")
+	if err != nil {
+		t.Fatalf("PreviewForget failed: %v", err)
+	}
+	if preview.Retention != "--keep-within 30d" || !reflect.DeepEqual(got[3:], []string{"--keep-within", "30d", "--keep-tag", "pinned", "--dry-run", "--json"}) {
+		t.Errorf("previewed %q with %v", preview.Retention, got)
+	}
+}
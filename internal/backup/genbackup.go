@@ -0,0 +1,83 @@
+package backup
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DefaultGenBackupCommand is the server command that writes a backup copy
+	// of the savegame.
+	DefaultGenBackupCommand = "/genbackup"
+
+	// DefaultBackupsDir is where the server writes backup copies, relative to
+	// the game data directory.
+	DefaultBackupsDir = "Backups"
+
+	// DefaultBackupFilePattern matches the names of backup copies.
+	DefaultBackupFilePattern = "*.vcdbs"
+)
+
+// genBackupCommand returns GenBackupCommand, or its default if not set.
+func (m *Manager) genBackupCommand() string {
+	if m.GenBackupCommand != "" {
+		return m.GenBackupCommand
+	}
+	return DefaultGenBackupCommand
+}
+
+// backupsDir returns the directory the server writes backup copies to:
+// BackupsDir, or its default, resolved against GameDataDir if relative.
+func (m *Manager) backupsDir() string {
+	dir := m.BackupsDir
+	if dir == "" {
+		dir = DefaultBackupsDir
+	}
+	if filepath.IsAbs(dir) {
+		return filepath.Clean(dir)
+	}
+	return filepath.Join(m.GameDataDir, dir)
+}
+
+// backupFilePattern returns BackupFilePattern, or its default if not set.
+func (m *Manager) backupFilePattern() string {
+	if m.BackupFilePattern != "" {
+		return m.BackupFilePattern
+	}
+	return DefaultBackupFilePattern
+}
+
+// isBackupFile reports whether name is the name of a backup copy.
+func (m *Manager) isBackupFile(name string) bool {
+	ok, _ := filepath.Match(m.backupFilePattern(), name)
+	return ok
+}
+
+// backupsEntry returns the top-level entry of GameDataDir that holds the
+// backups directory, or "" if it lies elsewhere.
+func (m *Manager) backupsEntry() string {
+	rel, err := filepath.Rel(m.GameDataDir, m.backupsDir())
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return strings.SplitN(rel, string(filepath.Separator), 2)[0]
+}
+
+// ParseBackupFilePattern validates a shell pattern, as understood by
+// filepath.Match, for the names of backup copies. Patterns can't contain path
+// separators, since only the backups directory itself is searched. An empty
+// pattern selects the default.
+func ParseBackupFilePattern(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(s, `/\`) {
+		return "", fmt.Errorf("pattern %q must match file names, not paths", s)
+	}
+	if _, err := filepath.Match(s, ""); err != nil {
+		return "", fmt.Errorf("pattern %q: %w", s, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,122 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestManager_WaitForBackupFile_CustomDirAndPattern(t *testing.T) {
+	gameDataDir := t.TempDir()
+	backupsDir := filepath.Join(gameDataDir, "ModData", "snapshots")
+	if err := os.MkdirAll(backupsDir, 0755); err != nil {
+		t.Fatalf("Failed to create backups dir: %v", err)
+	}
+
+	m := &Manager{
+		Server:            &testsupport.Server{},
+		GameDataDir:       gameDataDir,
+		BackupsDir:        filepath.Join("ModData", "snapshots"),
+		BackupFilePattern: "world-*.bak",
+	}
+
+	existing, err := m.existingBackupFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the default name nor another extension is taken
+	for _, name := range []string{"world.vcdbs", "world-1.tmp"} {
+		if err := os.WriteFile(filepath.Join(backupsDir, name), []byte("other"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := filepath.Join(backupsDir, "world-1.bak")
+	if err := os.WriteFile(want, []byte("backup"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got, err := m.waitForBackupFile(ctx, existing)
+	if err != nil {
+		t.Fatalf("waitForBackupFile() failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("waitForBackupFile() = %q, want %q", got, want)
+	}
+}
+
+func TestManager_GenBackupCommand(t *testing.T) {
+	m := &Manager{}
+	if got := m.genBackupCommand(); got != DefaultGenBackupCommand {
+		t.Errorf("genBackupCommand() = %q, want %q", got, DefaultGenBackupCommand)
+	}
+	m.GenBackupCommand = "/moddedbackup now"
+	if got := m.genBackupCommand(); got != "/moddedbackup now" {
+		t.Errorf("genBackupCommand() = %q, want the configured command", got)
+	}
+}
+
+func TestManager_BackupsDir(t *testing.T) {
+	gameDataDir := filepath.Join(string(filepath.Separator), "gamedata")
+	abs := filepath.Join(string(filepath.Separator), "mnt", "backups")
+	tests := []struct {
+		dir       string
+		wantDir   string
+		wantEntry string
+	}{
+		{"", filepath.Join(gameDataDir, "Backups"), "Backups"},
+		{filepath.Join("ModData", "snapshots"), filepath.Join(gameDataDir, "ModData", "snapshots"), "ModData"},
+		{abs, abs, ""},
+		{filepath.Join(gameDataDir, "Custom"), filepath.Join(gameDataDir, "Custom"), "Custom"},
+	}
+	for _, tt := range tests {
+		m := &Manager{GameDataDir: gameDataDir, BackupsDir: tt.dir}
+		if got := m.backupsDir(); got != tt.wantDir {
+			t.Errorf("backupsDir() with %q = %q, want %q", tt.dir, got, tt.wantDir)
+		}
+		if got := m.backupsEntry(); got != tt.wantEntry {
+			t.Errorf("backupsEntry() with %q = %q, want %q", tt.dir, got, tt.wantEntry)
+		}
+	}
+}
+
+func TestParseBackupFilePattern(t *testing.T) {
+	for _, s := range []string{"", " *.vcdbs ", "world-*.bak", "[a-z]*.vcdbs"} {
+		if _, err := ParseBackupFilePattern(s); err != nil {
+			t.Errorf("ParseBackupFilePattern(%q) failed: %v", s, err)
+		}
+	}
+	for _, s := range []string{"[", "sub/*.vcdbs", `sub\*.vcdbs`} {
+		if _, err := ParseBackupFilePattern(s); err == nil {
+			t.Errorf("ParseBackupFilePattern(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestUncoveredPaths_SkipsCustomBackupsDir(t *testing.T) {
+	gameDataDir := t.TempDir()
+	stagingDir := t.TempDir()
+	for _, name := range []string{"Backups", "ModBackups", "Saves"} {
+		if err := os.MkdirAll(filepath.Join(gameDataDir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(stagingDir, "Saves"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manager{GameDataDir: gameDataDir, StagingDir: stagingDir, BackupsDir: "ModBackups"}
+	uncovered, err := m.UncoveredPaths()
+	if err != nil {
+		t.Fatalf("UncoveredPaths failed: %v", err)
+	}
+	if len(uncovered) != 0 {
+		t.Errorf("UncoveredPaths() = %v, want none", uncovered)
+	}
+}
@@ -0,0 +1,188 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Staging strategies, selecting how a backup updates the staging directory.
+const (
+	// StagingInPlace updates the staging directory in place: changed files
+	// are rewritten, unchanged ones are left alone and compared again by the
+	// next backup.
+	StagingInPlace = "in-place"
+
+	// StagingGenerations builds each update as a new generation next to the
+	// staging directory. Its files start out as reflinks of the current
+	// generation's where the filesystem supports them (btrfs, XFS, ZFS with
+	// block cloning), or else as hard links, so nothing is copied; changed
+	// files are then written as new files. The new generation takes the
+	// staging directory's place once it is complete, so restic always
+	// snapshots the same path, and a failed update leaves the last
+	// generation untouched.
+	StagingGenerations = "generations"
+)
+
+// A generation is built in the directory named by the staging directory and
+// nextGenerationSuffix, and the current one is moved to the name with
+// prevGenerationSuffix while the two are swapped.
+const (
+	nextGenerationSuffix = ".next"
+	prevGenerationSuffix = ".prev"
+)
+
+// ParseStagingStrategy validates a staging strategy, defaulting to
+// StagingInPlace.
+func ParseStagingStrategy(s string) (string, error) {
+	switch strategy := strings.ToLower(strings.TrimSpace(s)); strategy {
+	case "":
+		return StagingInPlace, nil
+	case StagingInPlace, StagingGenerations:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown staging strategy %q: expected %q or %q", s, StagingInPlace, StagingGenerations)
+	}
+}
+
+// stagingTarget returns the directory a staging update writes to: the
+// generation being built, or else StagingDir.
+func (m *Manager) stagingTarget() string {
+	if m.generation != "" {
+		return m.generation
+	}
+	return m.StagingDir
+}
+
+// stageGeneration runs stageBackup against a new generation of the staging
+// directory, cloned from the current one, and swaps the new generation in
+// once it is complete. If the update fails, the new generation is removed
+// and the staging directory is left as the last backup staged it.
+func (m *Manager) stageGeneration(ctx context.Context, backupFile, saveFileName string, churn *churnTracker) (written, skipped int, err error) {
+	if err := recoverGeneration(m.StagingDir); err != nil {
+		return 0, 0, err
+	}
+	if err := os.MkdirAll(m.StagingDir, 0755); err != nil {
+		return 0, 0, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	next := m.StagingDir + nextGenerationSuffix
+	reflinked, linked, err := cloneTree(m.StagingDir, next)
+	if err != nil {
+		os.RemoveAll(next)
+		return 0, 0, fmt.Errorf("failed to clone the staging directory into a new generation: %w", err)
+	}
+	fmt.Printf("Staging generation: %d files reflinked, %d hard-linked from the last backup\n", reflinked, linked)
+
+	m.generation = next
+	written, skipped, err = m.stageBackup(ctx, backupFile, saveFileName, churn)
+	m.generation = ""
+	if err != nil {
+		os.RemoveAll(next)
+		return 0, 0, err
+	}
+
+	if err := swapGeneration(m.StagingDir); err != nil {
+		return 0, 0, err
+	}
+	return written, skipped, nil
+}
+
+// cloneTree recreates the tree at src in dst, which must not exist, without
+// copying file contents: regular files are reflinked, or hard-linked once
+// the filesystem turns out not to support reflinks. Reflinked files keep
+// their modification times, and hard links share them, so restic doesn't
+// read unchanged files again. Returns how many files were reflinked and how
+// many hard-linked.
+func cloneTree(src, dst string) (reflinked, linked int, err error) {
+	useReflinks := true
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.Mkdir(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case !d.Type().IsRegular():
+			return nil
+		}
+
+		if useReflinks {
+			if err := reflinkFile(path, target, info.Mode().Perm()); err == nil {
+				reflinked++
+				return os.Chtimes(target, info.ModTime(), info.ModTime())
+			}
+			useReflinks = false
+		}
+		if err := os.Link(path, target); err != nil {
+			return err
+		}
+		linked++
+		return nil
+	})
+	return reflinked, linked, err
+}
+
+// swapGeneration moves the generation built next to stagingDir into its
+// place. The old generation is moved aside first and removed afterwards, so
+// a crash in between leaves one of them for recoverGeneration to put back.
+func swapGeneration(stagingDir string) error {
+	next := stagingDir + nextGenerationSuffix
+	prev := stagingDir + prevGenerationSuffix
+	if err := os.RemoveAll(prev); err != nil {
+		return fmt.Errorf("failed to clear %s: %w", prev, err)
+	}
+	if err := os.Rename(stagingDir, prev); err != nil {
+		return fmt.Errorf("failed to move the last staging generation aside: %w", err)
+	}
+	if err := os.Rename(next, stagingDir); err != nil {
+		os.Rename(prev, stagingDir)
+		return fmt.Errorf("failed to move the new staging generation into place: %w", err)
+	}
+	syncDir(filepath.Dir(stagingDir))
+
+	// The new generation is in place; a leftover is removed by the next update
+	if err := os.RemoveAll(prev); err != nil {
+		fmt.Printf("WARNING: Failed to remove the last staging generation: %v\n", err)
+	}
+	return nil
+}
+
+// recoverGeneration cleans up after a generation update of stagingDir that
+// was interrupted. If it was interrupted while the generations were being
+// swapped, the last complete one is put back.
+func recoverGeneration(stagingDir string) error {
+	prev := stagingDir + prevGenerationSuffix
+	if _, err := os.Stat(prev); err == nil {
+		if _, err := os.Stat(stagingDir); os.IsNotExist(err) {
+			if err := os.Rename(prev, stagingDir); err != nil {
+				return fmt.Errorf("failed to restore the staging directory from an interrupted update: %w", err)
+			}
+		}
+	}
+	for _, dir := range []string{prev, stagingDir + nextGenerationSuffix} {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to clean up an interrupted staging generation: %w", err)
+		}
+	}
+	return nil
+}
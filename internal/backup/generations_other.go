@@ -0,0 +1,14 @@
+//go:build !linux
+
+package backup
+
+import (
+	"errors"
+	"os"
+)
+
+// reflinkFile always fails, since reflinks aren't implemented here, so
+// staging generations are hard-linked.
+func reflinkFile(src, dst string, perm os.FileMode) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,177 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestParseStagingStrategy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", StagingInPlace, false},
+		{"in-place", StagingInPlace, false},
+		{" Generations ", StagingGenerations, false},
+		{"copy", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseStagingStrategy(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseStagingStrategy(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// generationManager returns a manager staging generations in stagingDir,
+// whose staged world holds chunk.bin from the last backup, with split as
+// its splitter.
+func generationManager(t *testing.T, stagingDir string, split VCDBTreeSplitter) (m *Manager, backupFile string) {
+	t.Helper()
+	gameDataDir := t.TempDir()
+	os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), []byte("{}"), 0644)
+	backupFile = filepath.Join(gameDataDir, "backup.vcdbs")
+	os.WriteFile(backupFile, []byte("backup data"), 0644)
+
+	treeDir := filepath.Join(stagingDir, "Saves", "default")
+	os.MkdirAll(treeDir, 0755)
+	os.WriteFile(filepath.Join(treeDir, "chunk.bin"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(treeDir, "region.bin"), []byte("unchanged"), 0644)
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(filepath.Join(treeDir, "region.bin"), old, old)
+
+	return &Manager{
+		Server:           &testsupport.Server{},
+		GameDataDir:      gameDataDir,
+		StagingDir:       stagingDir,
+		StagingStrategy:  StagingGenerations,
+		SkipTreeDigest:   true,
+		VCDBTreeSplitter: split,
+	}, backupFile
+}
+
+func TestUpdateStagingDirectory_Generations(t *testing.T) {
+	stagingDir := filepath.Join(t.TempDir(), "staging")
+	var splitDst string
+	m, backupFile := generationManager(t, stagingDir, func(srcPath, dstDir string) (int, int, error) {
+		splitDst = dstDir
+		path := filepath.Join(dstDir, "chunk.bin")
+		if err := os.Remove(path); err != nil {
+			return 0, 0, err
+		}
+		return 1, 1, os.WriteFile(path, []byte("new"), 0644)
+	})
+	regionInfo, _ := os.Stat(filepath.Join(stagingDir, "Saves", "default", "region.bin"))
+
+	if _, _, err := m.updateStagingDirectory(context.Background(), backupFile, "default.vcdbs", nil); err != nil {
+		t.Fatalf("updateStagingDirectory() error: %v", err)
+	}
+
+	if want := filepath.Join(stagingDir+nextGenerationSuffix, "Saves", "default"); splitDst != want {
+		t.Errorf("split into %q, want the new generation %q", splitDst, want)
+	}
+	treeDir := filepath.Join(stagingDir, "Saves", "default")
+	if data, _ := os.ReadFile(filepath.Join(treeDir, "chunk.bin")); string(data) != "new" {
+		t.Errorf("chunk.bin = %q, want the new generation's", data)
+	}
+	info, err := os.Stat(filepath.Join(treeDir, "region.bin"))
+	if err != nil || !info.ModTime().Equal(regionInfo.ModTime()) {
+		t.Errorf("unchanged region.bin lost its modification time: %v, %v", info, err)
+	}
+	if _, err := os.Stat(filepath.Join(stagingDir, MetadataFileName)); err != nil {
+		t.Errorf("metadata not written to the new generation: %v", err)
+	}
+	if err := m.checkStagingComplete(); err != nil {
+		t.Errorf("checkStagingComplete() = %v", err)
+	}
+	for _, suffix := range []string{nextGenerationSuffix, prevGenerationSuffix} {
+		if _, err := os.Stat(stagingDir + suffix); !os.IsNotExist(err) {
+			t.Errorf("%s left behind: %v", stagingDir+suffix, err)
+		}
+	}
+	if _, err := os.Stat(backupFile); !os.IsNotExist(err) {
+		t.Error("backup file not disposed of after the update")
+	}
+}
+
+func TestUpdateStagingDirectory_GenerationFailureKeepsStaging(t *testing.T) {
+	stagingDir := filepath.Join(t.TempDir(), "staging")
+	m, backupFile := generationManager(t, stagingDir, func(srcPath, dstDir string) (int, int, error) {
+		path := filepath.Join(dstDir, "chunk.bin")
+		os.Remove(path)
+		os.WriteFile(path, []byte("partial"), 0644)
+		return 0, 0, errors.New("simulated split failure")
+	})
+
+	if _, _, err := m.updateStagingDirectory(context.Background(), backupFile, "default.vcdbs", nil); err == nil {
+		t.Fatal("updateStagingDirectory() expected error when the split fails")
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(stagingDir, "Saves", "default", "chunk.bin")); string(data) != "old" {
+		t.Errorf("chunk.bin = %q, want the last backup's", data)
+	}
+	if err := m.checkStagingComplete(); err != nil {
+		t.Errorf("checkStagingComplete() = %v, want the last generation to stay complete", err)
+	}
+	if _, err := os.Stat(stagingDir + nextGenerationSuffix); !os.IsNotExist(err) {
+		t.Errorf("failed generation left behind: %v", err)
+	}
+	if _, err := os.Stat(backupFile); err != nil {
+		t.Errorf("backup file removed after a failed update: %v", err)
+	}
+}
+
+func TestCloneTree(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "a", "b"), 0755)
+	os.WriteFile(filepath.Join(src, "a", "b", "file.bin"), []byte("data"), 0644)
+	os.WriteFile(filepath.Join(src, "top.json"), []byte("{}"), 0644)
+	os.Symlink("top.json", filepath.Join(src, "link"))
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(filepath.Join(src, "top.json"), old, old)
+
+	dst := filepath.Join(t.TempDir(), "clone")
+	reflinked, linked, err := cloneTree(src, dst)
+	if err != nil {
+		t.Fatalf("cloneTree() error: %v", err)
+	}
+	if reflinked+linked != 2 {
+		t.Errorf("cloneTree() cloned %d reflinked + %d linked files, want 2", reflinked, linked)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "a", "b", "file.bin")); string(data) != "data" {
+		t.Errorf("file.bin = %q, want data", data)
+	}
+	if info, err := os.Stat(filepath.Join(dst, "top.json")); err != nil || !info.ModTime().Equal(old) {
+		t.Errorf("top.json lost its modification time: %v, %v", info, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "link")); err != nil || target != "top.json" {
+		t.Errorf("link = %q, %v; want top.json", target, err)
+	}
+}
+
+func TestRecoverGeneration(t *testing.T) {
+	stagingDir := filepath.Join(t.TempDir(), "staging")
+	os.MkdirAll(stagingDir+prevGenerationSuffix, 0755)
+	os.WriteFile(filepath.Join(stagingDir+prevGenerationSuffix, "file"), []byte("last"), 0644)
+	os.MkdirAll(stagingDir+nextGenerationSuffix, 0755)
+
+	// Interrupted between moving the last generation aside and the new one in
+	if err := recoverGeneration(stagingDir); err != nil {
+		t.Fatalf("recoverGeneration() error: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(stagingDir, "file")); string(data) != "last" {
+		t.Errorf("staging file = %q, want the last generation restored", data)
+	}
+	for _, suffix := range []string{nextGenerationSuffix, prevGenerationSuffix} {
+		if _, err := os.Stat(stagingDir + suffix); !os.IsNotExist(err) {
+			t.Errorf("%s left behind: %v", stagingDir+suffix, err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultHookTimeout is how long a hook may run when Hooks.Timeout is unset.
+const defaultHookTimeout = time.Minute
+
+// Hook event names, passed to hooks as BACKUP_EVENT.
+const (
+	HookEventPreBackup    = "pre-backup"
+	HookEventPostBackup   = "post-backup"
+	HookEventBackupFailed = "backup-failed"
+	HookEventHighChange   = "high-change"
+)
+
+// Hooks configures user-provided executables that run at backup lifecycle
+// points. Each hook receives the launcher's environment plus:
+//
+//	BACKUP_EVENT             pre-backup, post-backup, backup-failed, or high-change
+//	BACKUP_SNAPSHOT_ID       the restic snapshot ID (post-backup, if known)
+//	BACKUP_DURATION_SECONDS  how long the backup took (post-backup and backup-failed)
+//	BACKUP_ERROR             the error message (backup-failed)
+//	BACKUP_FILES_WRITTEN     staged world files rewritten (high-change)
+//	BACKUP_FILES_UNCHANGED   staged world files left as they were (high-change)
+//
+// Hook output is copied into the launcher log.
+type Hooks struct {
+	// PreBackup runs before a backup starts. If it fails, the backup is
+	// aborted and counts as failed.
+	PreBackup string
+
+	// PostBackup runs after a successful backup. Its failure is logged but
+	// does not fail the backup.
+	PostBackup string
+
+	// BackupFailed runs after a backup fails, including when PreBackup failed.
+	BackupFailed string
+
+	// HighChange runs when a backup finds most of the staged world changed,
+	// e.g. after a world reset. Its failure is logged but does not fail the
+	// backup.
+	HighChange string
+
+	// Timeout is the maximum time a hook may run before it is killed.
+	// Defaults to one minute.
+	Timeout time.Duration
+}
+
+// run executes the hook at path for event with the given extra environment.
+// Does nothing if path is empty.
+func (h *Hooks) run(ctx context.Context, event, path string, env map[string]string) error {
+	if path == "" {
+		return nil
+	}
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = append(os.Environ(), "BACKUP_EVENT="+event)
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	// Interleave stdout and stderr into the log, one line at a time
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	// Don't hang on background processes that inherited the output pipe
+	cmd.WaitDelay = 5 * time.Second
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			fmt.Printf("[hook %s] %s\n", event, scanner.Text())
+		}
+		io.Copy(io.Discard, pr)
+	}()
+
+	err := cmd.Run()
+	pw.Close()
+	wg.Wait()
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s hook timed out after %v", event, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s hook failed: %w", event, err)
+	}
+	return nil
+}
+
+// runPreBackup runs the PreBackup hook.
+func (h *Hooks) runPreBackup(ctx context.Context) error {
+	return h.run(ctx, HookEventPreBackup, h.PreBackup, nil)
+}
+
+// runAfterBackup runs PostBackup or BackupFailed depending on backupErr.
+// Hook failures are logged, since the backup outcome is already decided.
+func (h *Hooks) runAfterBackup(ctx context.Context, snapshotID string, duration time.Duration, backupErr error) {
+	env := map[string]string{
+		"BACKUP_DURATION_SECONDS": strconv.FormatFloat(duration.Seconds(), 'f', 1, 64),
+	}
+
+	event, path := HookEventPostBackup, h.PostBackup
+	if backupErr != nil {
+		event, path = HookEventBackupFailed, h.BackupFailed
+		env["BACKUP_ERROR"] = backupErr.Error()
+	} else {
+		env["BACKUP_SNAPSHOT_ID"] = snapshotID
+	}
+
+	if err := h.run(ctx, event, path, env); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// runHighChange runs the HighChange hook for a split that wrote and
+// skipped files. A hook failure is logged, since the backup goes on.
+func (h *Hooks) runHighChange(ctx context.Context, written, skipped int) {
+	env := map[string]string{
+		"BACKUP_FILES_WRITTEN":   strconv.Itoa(written),
+		"BACKUP_FILES_UNCHANGED": strconv.Itoa(skipped),
+	}
+	if err := h.run(ctx, HookEventHighChange, h.HighChange, env); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// validateHook checks that a hook path points at an executable file.
+func validateHook(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat hook %s: %w", path, err)
+	}
+	if info.IsDir() || info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("hook %s is not an executable file", path)
+	}
+	return nil
+}
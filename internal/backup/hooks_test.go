@@ -0,0 +1,157 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+// writeHook creates an executable shell script in dir and returns its path.
+func writeHook(t *testing.T, dir, name, script string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write hook: %v", err)
+	}
+	return path
+}
+
+func TestHooks_Run(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+
+	t.Run("passes event and environment", func(t *testing.T) {
+		hook := writeHook(t, dir, "env.sh", fmt.Sprintf(`echo "$BACKUP_EVENT $BACKUP_SNAPSHOT_ID $BACKUP_DURATION_SECONDS" > %q`, out))
+		h := &Hooks{PostBackup: hook}
+
+		h.runAfterBackup(context.Background(), "abc123", 1500*time.Millisecond, nil)
+
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("Hook did not run: %v", err)
+		}
+		if got := strings.TrimSpace(string(data)); got != "post-backup abc123 1.5" {
+			t.Errorf("Hook environment = %q, want %q", got, "post-backup abc123 1.5")
+		}
+	})
+
+	t.Run("runs failure hook with error", func(t *testing.T) {
+		hook := writeHook(t, dir, "failed.sh", fmt.Sprintf(`echo "$BACKUP_EVENT $BACKUP_ERROR" > %q`, out))
+		h := &Hooks{PostBackup: "/nonexistent", BackupFailed: hook}
+
+		h.runAfterBackup(context.Background(), "", time.Second, errors.New("restic exploded"))
+
+		data, _ := os.ReadFile(out)
+		if got := strings.TrimSpace(string(data)); got != "backup-failed restic exploded" {
+			t.Errorf("Hook output = %q, want %q", got, "backup-failed restic exploded")
+		}
+	})
+
+	t.Run("reports non-zero exit", func(t *testing.T) {
+		h := &Hooks{PreBackup: writeHook(t, dir, "fail.sh", "echo nope; exit 3")}
+		err := h.runPreBackup(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "pre-backup hook failed") {
+			t.Errorf("runPreBackup() error = %v, want hook failure", err)
+		}
+	})
+
+	t.Run("kills hook after timeout", func(t *testing.T) {
+		h := &Hooks{PreBackup: writeHook(t, dir, "slow.sh", "exec sleep 10"), Timeout: 100 * time.Millisecond}
+
+		start := time.Now()
+		err := h.runPreBackup(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("runPreBackup() error = %v, want timeout", err)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("Hook was not killed promptly")
+		}
+	})
+
+	t.Run("empty path does nothing", func(t *testing.T) {
+		h := &Hooks{}
+		if err := h.runPreBackup(context.Background()); err != nil {
+			t.Errorf("runPreBackup() unexpected error: %v", err)
+		}
+	})
+}
+
+func TestValidateHook(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := validateHook(writeHook(t, dir, "ok.sh", "true")); err != nil {
+		t.Errorf("validateHook() unexpected error: %v", err)
+	}
+
+	notExec := filepath.Join(dir, "plain.sh")
+	os.WriteFile(notExec, []byte("true"), 0644)
+	if err := validateHook(notExec); err == nil {
+		t.Error("validateHook() expected error for non-executable file")
+	}
+
+	if err := validateHook(filepath.Join(dir, "missing")); err == nil {
+		t.Error("validateHook() expected error for missing file")
+	}
+}
+
+func TestManager_PerformBackup_PreBackupHookVeto(t *testing.T) {
+	dir := t.TempDir()
+	failedOut := filepath.Join(dir, "failed")
+
+	commandSent := false
+	m := &Manager{
+		Server: &testsupport.Server{
+			OnCommand: func(cmd string) error {
+				commandSent = true
+				return nil
+			},
+		},
+		GameDataDir: dir,
+		Hooks: Hooks{
+			PreBackup:    writeHook(t, dir, "pre.sh", "exit 1"),
+			BackupFailed: writeHook(t, dir, "failed.sh", fmt.Sprintf(`echo "$BACKUP_ERROR" > %q`, failedOut)),
+		},
+	}
+
+	err := m.performBackup(context.Background(), true)
+	if err == nil || !strings.Contains(err.Error(), "pre-backup hook failed") {
+		t.Fatalf("performBackup() error = %v, want pre-backup hook failure", err)
+	}
+	if commandSent {
+		t.Error("/genbackup should not be sent when the pre-backup hook fails")
+	}
+
+	data, err := os.ReadFile(failedOut)
+	if err != nil {
+		t.Fatalf("Failure hook did not run: %v", err)
+	}
+	if !strings.Contains(string(data), "pre-backup hook failed") {
+		t.Errorf("BACKUP_ERROR = %q, want the pre-backup hook error", data)
+	}
+}
+
+func TestManager_PerformBackup_SkipDoesNotRunHooks(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	hook := writeHook(t, dir, "hook.sh", fmt.Sprintf(`echo ran > %q`, out))
+
+	m := &Manager{
+		Server:      &testsupport.Server{},
+		BootChecker: testsupport.NewBootChecker(false),
+		Hooks:       Hooks{PreBackup: hook, PostBackup: hook, BackupFailed: hook},
+	}
+
+	if err := m.performBackup(context.Background(), true); err != ErrServerNotBooted {
+		t.Fatalf("performBackup() error = %v, want ErrServerNotBooted", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Error("Hooks should not run for skipped backups")
+	}
+}
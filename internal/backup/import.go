@@ -0,0 +1,199 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// ImportedTag is the restic tag of snapshots backfilled by ImportBackups,
+// so they can be told apart from backups this system took itself.
+const ImportedTag = "imported"
+
+// gameBackupTimestamp matches the time in the name of a backup the game
+// wrote itself, as in "default-2024-03-01_14-22-05.vcdbs".
+var gameBackupTimestamp = regexp.MustCompile(`(\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2})\.vcdbs$`)
+
+// ImportBackup is a raw .vcdbs backup to import, and when it was taken.
+type ImportBackup struct {
+	// Path is the backup file.
+	Path string
+
+	// Time is when the backup was taken, and becomes the snapshot time.
+	Time time.Time
+}
+
+// FindImportBackups lists the .vcdbs files in dir, oldest first. The time
+// of each is read from its name if the game or LocalKeepVCDBS named it, and
+// is its modification time otherwise.
+func FindImportBackups(dir string) ([]ImportBackup, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	var backups []ImportBackup
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasSuffix(name, ".vcdbs") {
+			continue
+		}
+		t, ok := backupNameTime(name)
+		if !ok {
+			info, err := entry.Info()
+			if err != nil {
+				return nil, fmt.Errorf("failed to stat %s: %w", name, err)
+			}
+			t = info.ModTime()
+		}
+		backups = append(backups, ImportBackup{Path: filepath.Join(dir, name), Time: t.Truncate(time.Second)})
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].Time.Before(backups[j].Time)
+	})
+	return backups, nil
+}
+
+// backupNameTime returns the time in the name of a backup written by the
+// game, in local time, or by keepLocalCopy, in UTC.
+func backupNameTime(name string) (time.Time, bool) {
+	if t, err := time.Parse(localCopyLayout, strings.TrimSuffix(name, ".vcdbs")); err == nil {
+		return t, true
+	}
+	if match := gameBackupTimestamp.FindStringSubmatch(name); match != nil {
+		if t, err := time.ParseInLocation("2006-01-02_15-04-05", match[1], time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ImportBackups backfills backups, oldest first, into the repository as
+// snapshots of the world saveFileName dated at their Time and tagged
+// ImportedTag. Each is split into the staging directory and snapshotted
+// like a regular backup, so retention and restores treat them alike.
+// Backups whose time matches an imported snapshot already in the
+// repository are skipped, so an interrupted import can be run again.
+// The backup files themselves are left in place. If saveFileName is empty,
+// the save file in serverconfig.json is used. Returns the number of backups
+// imported.
+//
+// Anything else in the staging directory is included in the snapshots, so
+// import before the first backup, with the launcher stopped.
+func (m *Manager) ImportBackups(ctx context.Context, backups []ImportBackup, saveFileName string) (int, error) {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	m.applyPathDefaults()
+
+	if saveFileName == "" {
+		var err error
+		if saveFileName, err = m.getSaveFileName(); err != nil {
+			return 0, fmt.Errorf("failed to get save file name: %w", err)
+		}
+	}
+
+	if m.ResticRunner == nil {
+		if !m.repositoryConfigured() {
+			return 0, fmt.Errorf("RESTIC_REPOSITORY environment variable is not set")
+		}
+		if err := m.ensureRepoInitialized(ctx); err != nil {
+			return 0, fmt.Errorf("failed to initialize restic repository: %w", err)
+		}
+	}
+
+	imported, err := m.importedTimes(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i, b := range backups {
+		if imported[b.Time.Unix()] {
+			fmt.Printf("Skipping %s: already imported\n", filepath.Base(b.Path))
+			continue
+		}
+		fmt.Printf("Importing %s (%d of %d) as a snapshot at %s\n",
+			filepath.Base(b.Path), i+1, len(backups), b.Time.Format(time.RFC3339))
+		if err := m.importBackup(ctx, b, saveFileName); err != nil {
+			return count, fmt.Errorf("failed to import %s: %w", b.Path, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// importedTimes returns the times, as Unix seconds, of this server's
+// snapshots tagged ImportedTag.
+func (m *Manager) importedTimes(ctx context.Context) (map[int64]bool, error) {
+	if m.ResticRunner != nil && m.OutputRunner == nil {
+		return nil, nil
+	}
+
+	args := []string{"snapshots", "--json", "--host", m.snapshotHost(), "--tag", ImportedTag}
+	var snapshots []resticSnapshot
+	if err := m.runResticJSON(ctx, &snapshots, append(args, m.worldFilter()...)...); err != nil {
+		return nil, err
+	}
+	times := make(map[int64]bool, len(snapshots))
+	for _, s := range snapshots {
+		times[s.Time.Unix()] = true
+	}
+	return times, nil
+}
+
+// importBackup splits one backup into the staging directory and snapshots
+// it. Must be called with opMu held.
+func (m *Manager) importBackup(ctx context.Context, b ImportBackup, saveFileName string) error {
+	if err := os.MkdirAll(m.StagingDir, 0755); err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	if err := m.beginStagingUpdate(b.Path); err != nil {
+		return err
+	}
+
+	saveBaseName := strings.TrimSuffix(saveFileName, ".vcdbs")
+	savesDir := filepath.Join(m.StagingDir, "Saves", saveBaseName)
+	if err := os.MkdirAll(savesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create Saves directory: %w", err)
+	}
+	written, skipped, err := m.splitToVCDBTree(ctx, b.Path, savesDir, &churnTracker{})
+	if err != nil {
+		return fmt.Errorf("failed to split backup to vcdbtree: %w", err)
+	}
+	fmt.Printf("vcdbtree: %d files written, %d files unchanged\n", written, skipped)
+
+	// The server version that wrote an old backup isn't known
+	var meta SnapshotMetadata
+	if !m.SkipTreeDigest {
+		digest, err := vcdbtree.Digest(ctx, savesDir)
+		if err != nil {
+			return fmt.Errorf("failed to compute tree digest: %w", err)
+		}
+		meta.TreeDigests = map[string]string{saveBaseName: digest}
+	}
+	if err := m.writeMetadata(meta); err != nil {
+		return err
+	}
+	if err := m.commitStagingUpdate(); err != nil {
+		return err
+	}
+
+	// restic reads --time in local time
+	extra := []string{"--time", b.Time.Local().Format("2006-01-02 15:04:05"), "--tag", ImportedTag}
+	summary, err := m.runResticArgs(ctx, extra)
+	if err != nil {
+		return fmt.Errorf("failed to run restic backup: %w", err)
+	}
+	if summary != nil {
+		fmt.Printf("Imported snapshot %s (%s added to repository)\n", shortSnapshotID(summary.SnapshotID), formatBytes(summary.DataAdded))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/snapshotmeta"
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestFindImportBackups(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"default-2024-03-01_14-22-05.vcdbs",
+		"2023-12-31T23-00-00Z.vcdbs",
+		"manual.vcdbs",
+		"notes.txt",
+	} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "old.vcdbs"), 0755)
+	mtime := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(dir, "manual.vcdbs"), mtime, mtime)
+
+	backups, err := FindImportBackups(dir)
+	if err != nil {
+		t.Fatalf("FindImportBackups() failed: %v", err)
+	}
+
+	want := []struct {
+		name string
+		time time.Time
+	}{
+		{"2023-12-31T23-00-00Z.vcdbs", time.Date(2023, 12, 31, 23, 0, 0, 0, time.UTC)},
+		{"default-2024-03-01_14-22-05.vcdbs", time.Date(2024, 3, 1, 14, 22, 5, 0, time.Local)},
+		{"manual.vcdbs", mtime},
+	}
+	if len(backups) != len(want) {
+		t.Fatalf("FindImportBackups() = %v, want %d backups", backups, len(want))
+	}
+	for i, w := range want {
+		if filepath.Base(backups[i].Path) != w.name || !backups[i].Time.Equal(w.time) {
+			t.Errorf("backups[%d] = %s at %v, want %s at %v", i, filepath.Base(backups[i].Path), backups[i].Time, w.name, w.time)
+		}
+	}
+}
+
+func TestManager_ImportBackups(t *testing.T) {
+	backupsDir := t.TempDir()
+	first := filepath.Join(backupsDir, "default-2024-03-01_14-22-05.vcdbs")
+	second := filepath.Join(backupsDir, "default-2024-03-02_14-22-05.vcdbs")
+	testsupport.CreateBloatedSave(t, first, 1)
+	testsupport.CreateBloatedSave(t, second, 2)
+
+	backups, err := FindImportBackups(backupsDir)
+	if err != nil {
+		t.Fatalf("FindImportBackups() failed: %v", err)
+	}
+
+	var snapshotted []string
+	var snapshotsArgs []string
+	stagingDir := t.TempDir()
+	m := &Manager{
+		StagingDir: stagingDir,
+		ResticHost: "default",
+		ResticRunner: func(ctx context.Context, dir string) error {
+			snapshotted = append(snapshotted, dir)
+			return nil
+		},
+		OutputRunner: func(ctx context.Context, args ...string) ([]byte, error) {
+			snapshotsArgs = args
+			// The first backup was imported before
+			return []byte(`[{"time": "` + backups[0].Time.Format(time.RFC3339Nano) + `"}]`), nil
+		},
+	}
+
+	n, err := m.ImportBackups(context.Background(), backups, "default.vcdbs")
+	if err != nil {
+		t.Fatalf("ImportBackups() failed: %v", err)
+	}
+	if n != 1 || len(snapshotted) != 1 || snapshotted[0] != stagingDir {
+		t.Errorf("ImportBackups() imported %d, snapshotted %v, want only the second backup", n, snapshotted)
+	}
+	if got := strings.Join(snapshotsArgs, " "); !strings.Contains(got, "--host default --tag "+ImportedTag) {
+		t.Errorf("restic snapshots args = %q, want this host's imported snapshots", got)
+	}
+
+	if _, err := os.Stat(filepath.Join(stagingDir, "Saves", "default")); err != nil {
+		t.Errorf("Backup was not split into the staging tree: %v", err)
+	}
+	meta, err := snapshotmeta.Read(stagingDir)
+	if err != nil || meta == nil || meta.TreeDigests["default"] == "" {
+		t.Errorf("snapshotmeta.Read() = %+v, %v, want a tree digest", meta, err)
+	}
+	for _, path := range []string{first, second} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Backup file %s was not left in place: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package backup
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultIntegrityTolerance is how far restic's file and byte counts may
+// differ from the staging tree's when IntegrityTolerance isn't set.
+const DefaultIntegrityTolerance = 0.01
+
+// stagingInventory counts the files a restic backup is expected to see.
+type stagingInventory struct {
+	Files int
+	Bytes int64
+}
+
+// ParseIntegrityTolerance parses an integrity check tolerance as a
+// percentage ("2%") or a fraction ("0.02"). "off" disables the check and is
+// returned as -1.
+func ParseIntegrityTolerance(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "off") {
+		return -1, nil
+	}
+	f, ok := parseFraction(s)
+	if !ok {
+		return 0, fmt.Errorf("invalid tolerance %q: expected a percentage such as 1%%, or off", s)
+	}
+	return f, nil
+}
+
+// parseFraction parses a non-negative percentage ("2%") or fraction
+// ("0.02"), and reports whether s was one.
+func parseFraction(s string) (float64, bool) {
+	percent := strings.HasSuffix(s, "%")
+	f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "%")), 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, false
+	}
+	if percent {
+		f /= 100
+	}
+	return f, true
+}
+
+// integrityTolerance returns IntegrityTolerance, or its default if not set.
+// A negative tolerance disables the check.
+func (m *Manager) integrityTolerance() float64 {
+	if m.IntegrityTolerance != 0 {
+		return m.IntegrityTolerance
+	}
+	return DefaultIntegrityTolerance
+}
+
+// inventory counts the regular files under the paths set backs up, and
+// their size.
+func (set snapshotSet) inventory() (stagingInventory, error) {
+	paths := set.files
+	if len(paths) == 0 {
+		paths = []string{set.path}
+	}
+
+	var inv stagingInventory
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			inv.Files++
+			inv.Bytes += info.Size()
+			return nil
+		})
+		if err != nil {
+			return stagingInventory{}, fmt.Errorf("failed to count staged files: %w", err)
+		}
+	}
+	return inv, nil
+}
+
+// checkIntegrity compares the files restic reports having seen with the
+// staging tree's inventory, taken just before restic ran. Nothing writes to
+// the staging tree meanwhile, so a difference beyond the tolerance means
+// files were changed or excluded behind the backup's back. A difference is
+// logged as a warning and returned; the snapshot itself is kept.
+func (m *Manager) checkIntegrity(set snapshotSet, inv stagingInventory, summary *resticSummary) string {
+	tolerance := m.integrityTolerance()
+	if tolerance < 0 || summary == nil {
+		return ""
+	}
+
+	var mismatch string
+	switch {
+	case diverges(int64(inv.Files), int64(summary.TotalFilesProcessed), tolerance):
+		mismatch = fmt.Sprintf("restic saw %d files, the staging tree has %d", summary.TotalFilesProcessed, inv.Files)
+	case diverges(inv.Bytes, summary.TotalBytesProcessed, tolerance):
+		mismatch = fmt.Sprintf("restic saw %s, the staging tree has %s",
+			formatBytes(summary.TotalBytesProcessed), formatBytes(inv.Bytes))
+	default:
+		return ""
+	}
+	if set.name != "" {
+		mismatch = fmt.Sprintf("snapshot set %s: %s", set.name, mismatch)
+	}
+	fmt.Printf("WARNING: Snapshot %s may be incomplete: %s\n", shortSnapshotID(summary.SnapshotID), mismatch)
+	return mismatch
+}
+
+// recordIntegrity records the differences checkIntegrity found in the
+// snapshots of a backup in Status, until a backup matches again.
+func (m *Manager) recordIntegrity(mismatches []string) {
+	m.statusMu.Lock()
+	previous := m.status.IntegrityMismatch
+	m.status.IntegrityMismatch = strings.Join(mismatches, "; ")
+	m.statusMu.Unlock()
+
+	if previous != "" && len(mismatches) == 0 {
+		fmt.Println("Snapshot file counts match the staging tree again.")
+	}
+}
+
+// diverges reports whether got differs from want by more than tolerance,
+// as a fraction of want.
+func diverges(want, got int64, tolerance float64) bool {
+	diff := math.Abs(float64(got - want))
+	return diff > tolerance*float64(want)
+}
@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseIntegrityTolerance(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"1%", 0.01},
+		{" 2.5 % ", 0.025},
+		{"0.05", 0.05},
+		{"0", 0},
+		{"off", -1},
+	}
+	for _, tt := range tests {
+		got, err := ParseIntegrityTolerance(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseIntegrityTolerance(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "-1%", "lots"} {
+		if _, err := ParseIntegrityTolerance(in); err == nil {
+			t.Errorf("ParseIntegrityTolerance(%q) expected error", in)
+		}
+	}
+}
+
+func TestSnapshotSet_Inventory(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "Saves", "default"), 0755)
+	os.MkdirAll(filepath.Join(dir, "Mods"), 0755)
+	os.WriteFile(filepath.Join(dir, "Saves", "default", "meta.bin"), make([]byte, 100), 0644)
+	os.WriteFile(filepath.Join(dir, "serverconfig.json"), make([]byte, 20), 0644)
+	os.WriteFile(filepath.Join(dir, "Mods", "mod.zip"), make([]byte, 1000), 0644)
+
+	inv, err := snapshotSet{path: dir}.inventory()
+	if err != nil || inv != (stagingInventory{Files: 3, Bytes: 1120}) {
+		t.Errorf("inventory() of the staging directory = %+v, %v; want 3 files, 1120 bytes", inv, err)
+	}
+
+	set := snapshotSet{name: SnapshotSetWorld, files: []string{filepath.Join(dir, "Saves"), filepath.Join(dir, "serverconfig.json")}}
+	inv, err = set.inventory()
+	if err != nil || inv != (stagingInventory{Files: 2, Bytes: 120}) {
+		t.Errorf("inventory() of the world set = %+v, %v; want 2 files, 120 bytes", inv, err)
+	}
+}
+
+func TestManager_CheckIntegrity(t *testing.T) {
+	inv := stagingInventory{Files: 1000, Bytes: 1 << 30}
+	tests := []struct {
+		name      string
+		tolerance float64
+		summary   *resticSummary
+		mismatch  bool
+	}{
+		{"match", 0, &resticSummary{TotalFilesProcessed: 1000, TotalBytesProcessed: 1 << 30}, false},
+		{"within tolerance", 0, &resticSummary{TotalFilesProcessed: 995, TotalBytesProcessed: 1 << 30}, false},
+		{"files missing", 0, &resticSummary{TotalFilesProcessed: 400, TotalBytesProcessed: 1 << 30}, true},
+		{"bytes missing", 0, &resticSummary{TotalFilesProcessed: 1000, TotalBytesProcessed: 1 << 20}, true},
+		{"disabled", -1, &resticSummary{TotalFilesProcessed: 400}, false},
+		{"no summary", 0, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{IntegrityTolerance: tt.tolerance}
+			mismatch := m.checkIntegrity(snapshotSet{}, inv, tt.summary)
+			if (mismatch != "") != tt.mismatch {
+				t.Errorf("checkIntegrity() = %q, want mismatch %v", mismatch, tt.mismatch)
+			}
+		})
+	}
+}
+
+func TestManager_RecordIntegrity(t *testing.T) {
+	m := &Manager{}
+	m.recordIntegrity([]string{"restic saw 1 files, the staging tree has 2"})
+	if got := m.Status().IntegrityMismatch; got != "restic saw 1 files, the staging tree has 2" {
+		t.Errorf("Status().IntegrityMismatch = %q after a mismatch", got)
+	}
+	m.recordIntegrity(nil)
+	if got := m.Status().IntegrityMismatch; got != "" {
+		t.Errorf("Status().IntegrityMismatch = %q after a match, want it cleared", got)
+	}
+}
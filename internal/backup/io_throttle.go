@@ -0,0 +1,100 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// I/O scheduling classes restic can be run with, as in ResticIOPriority.
+const (
+	IOPriorityIdle       = "idle"
+	IOPriorityBestEffort = "best-effort"
+)
+
+// ParseIOPriority validates an I/O scheduling class for restic: "idle",
+// "best-effort", or "best-effort:<level>" with a level from 0 (highest) to
+// 7 (lowest). An empty string or "off" leaves restic's priority alone and
+// is returned as "".
+func ParseIOPriority(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "off" {
+		return "", nil
+	}
+	if _, err := ioniceArgs(s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+// ioniceArgs returns the ionice arguments that select priority.
+func ioniceArgs(priority string) ([]string, error) {
+	class, level, hasLevel := strings.Cut(priority, ":")
+	switch {
+	case class == IOPriorityIdle && !hasLevel:
+		return []string{"-c", "3"}, nil
+	case class == IOPriorityBestEffort && !hasLevel:
+		return []string{"-c", "2"}, nil
+	case class == IOPriorityBestEffort:
+		n, err := strconv.Atoi(level)
+		if err != nil || n < 0 || n > 7 {
+			return nil, fmt.Errorf("best-effort level must be 0-7, got %q", level)
+		}
+		return []string{"-c", "2", "-n", level}, nil
+	}
+	return nil, fmt.Errorf("unknown I/O priority %q: must be %s, %s, or %s:<0-7>", priority, IOPriorityIdle, IOPriorityBestEffort, IOPriorityBestEffort)
+}
+
+// ParseByteSize parses a size in bytes with an optional binary unit, such as
+// "512", "64KiB", "20M", or "1GiB". Units are powers of 1024.
+func ParseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	upper := strings.ToUpper(s)
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{
+		{"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+		{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSpace(strings.TrimSuffix(upper, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: expected a number of bytes, optionally with KiB, MiB, or GiB", s)
+	}
+	return n * multiplier, nil
+}
+
+// throttle returns the Throttle shared by the splits and syncs of this
+// manager, or nil if WriteRateLimit and WriteSyncBytes are both unset.
+func (m *Manager) throttle() *vcdbtree.Throttle {
+	if m.WriteRateLimit <= 0 && m.WriteSyncBytes <= 0 {
+		return nil
+	}
+	m.throttleOnce.Do(func() {
+		m.writeThrottle = &vcdbtree.Throttle{BytesPerSecond: m.WriteRateLimit, SyncBytes: m.WriteSyncBytes}
+	})
+	return m.writeThrottle
+}
+
+// heavyResticCommand returns the command running restic with args for a
+// disk-heavy operation (backup, prune, check), under ionice if
+// ResticIOPriority is set.
+func (m *Manager) heavyResticCommand(ctx context.Context, args ...string) *exec.Cmd {
+	if m.ResticIOPriority != "" {
+		if ionice, err := ioniceArgs(m.ResticIOPriority); err == nil {
+			return exec.CommandContext(ctx, "ionice", append(append(ionice, "restic"), args...)...)
+		}
+	}
+	return exec.CommandContext(ctx, "restic", args...)
+}
@@ -0,0 +1,56 @@
+package backup
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseIOPriority(t *testing.T) {
+	for in, want := range map[string]string{"": "", "off": "", "Idle": "idle", "best-effort": "best-effort", " best-effort:7 ": "best-effort:7"} {
+		if got, err := ParseIOPriority(in); err != nil || got != want {
+			t.Errorf("ParseIOPriority(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"realtime", "idle:3", "best-effort:8", "best-effort:x"} {
+		if _, err := ParseIOPriority(bad); err == nil {
+			t.Errorf("ParseIOPriority(%q) expected an error", bad)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for in, want := range map[string]int64{"512": 512, "64KiB": 64 << 10, "20M": 20 << 20, "1 GiB": 1 << 30, "100b": 100} {
+		if got, err := ParseByteSize(in); err != nil || got != want {
+			t.Errorf("ParseByteSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "fast", "-1", "1TiB"} {
+		if _, err := ParseByteSize(bad); err == nil {
+			t.Errorf("ParseByteSize(%q) expected an error", bad)
+		}
+	}
+}
+
+func TestManager_HeavyResticCommand(t *testing.T) {
+	m := &Manager{}
+	if args := m.heavyResticCommand(context.Background(), "check").Args; !reflect.DeepEqual(args, []string{"restic", "check"}) {
+		t.Errorf("Args = %v, want restic without ionice", args)
+	}
+
+	m.ResticIOPriority = "best-effort:7"
+	want := []string{"ionice", "-c", "2", "-n", "7", "restic", "check"}
+	if args := m.heavyResticCommand(context.Background(), "check").Args; !reflect.DeepEqual(args, want) {
+		t.Errorf("Args = %v, want %v", args, want)
+	}
+}
+
+func TestManager_Throttle(t *testing.T) {
+	if (&Manager{}).throttle() != nil {
+		t.Error("throttle() should be nil without limits")
+	}
+	m := &Manager{WriteRateLimit: 1 << 20}
+	if th := m.throttle(); th == nil || th != m.throttle() || th.BytesPerSecond != 1<<20 {
+		t.Errorf("throttle() = %+v, want one shared Throttle at 1 MiB/s", th)
+	}
+}
@@ -0,0 +1,243 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultCacheDir is the persistent cache volume CleanCache audits when
+// CacheDir is empty.
+const DefaultCacheDir = "/backupcache"
+
+// DefaultCacheGracePeriod is how long an unused cache entry is kept when
+// CacheGracePeriod isn't set.
+const DefaultCacheGracePeriod = 7 * 24 * time.Hour
+
+// scratchDirs are the work directories in the cache that the restore and
+// export-snapshot tools leave behind when they fail.
+var scratchDirs = []string{"restore", "export"}
+
+// CacheCleanup is an unused entry CleanCache found in the cache.
+type CacheCleanup struct {
+	// Path is the unused file or directory.
+	Path string
+
+	// Reason says why it is no longer used.
+	Reason string
+
+	// LastModified is the newest modification time within it.
+	LastModified time.Time
+
+	// Removed is true if it was past the grace period and was removed.
+	Removed bool
+
+	// since is when it became unused, if known.
+	since time.Time
+}
+
+// CleanCache audits CacheDir for entries the current configuration no
+// longer uses and removes those that haven't been modified for
+// CacheGracePeriod: staging directories of other worlds or of the unnamed
+// world, work directories left by failed restores, exports, and
+// compactions, quarantined trees, and local copies beyond LocalKeepVCDBS.
+// Anything else in the cache is left alone. Entries still in their grace
+// period are logged once, when first found. Fails with
+// ErrOperationInProgress rather than wait for a backup, compaction, or
+// rollback.
+func (m *Manager) CleanCache(ctx context.Context) ([]CacheCleanup, error) {
+	if !m.opMu.TryLock() {
+		return nil, ErrOperationInProgress
+	}
+	defer m.opMu.Unlock()
+	m.applyPathDefaults()
+
+	candidates, err := m.unusedCacheEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.clock().Now()
+	var found []CacheCleanup
+	for _, c := range candidates {
+		if err := ctx.Err(); err != nil {
+			return found, err
+		}
+		if c.LastModified, err = lastModified(c.Path); err != nil {
+			return found, fmt.Errorf("failed to inspect %s: %w", c.Path, err)
+		}
+		if c.since.After(c.LastModified) {
+			c.LastModified = c.since
+		}
+
+		if now.Sub(c.LastModified) < m.cacheGracePeriod() {
+			if !m.cacheNoticed[c.Path] {
+				fmt.Printf("Cache: %s is unused (%s); removing it after %s unless it is modified\n",
+					c.Path, c.Reason, c.LastModified.Add(m.cacheGracePeriod()).Format(time.RFC3339))
+				if m.cacheNoticed == nil {
+					m.cacheNoticed = make(map[string]bool)
+				}
+				m.cacheNoticed[c.Path] = true
+			}
+			found = append(found, c)
+			continue
+		}
+
+		if err := os.RemoveAll(c.Path); err != nil {
+			return found, fmt.Errorf("failed to remove %s: %w", c.Path, err)
+		}
+		c.Removed = true
+		delete(m.cacheNoticed, c.Path)
+		fmt.Printf("Cache: removed %s (%s, last modified %s)\n", c.Path, c.Reason, c.LastModified.Format(time.RFC3339))
+		found = append(found, c)
+	}
+	return found, nil
+}
+
+// unusedCacheEntries lists the entries of CacheDir that the current
+// configuration doesn't use. Must be called with opMu held.
+func (m *Manager) unusedCacheEntries() ([]CacheCleanup, error) {
+	cacheDir := m.cacheDir()
+	stagingDir, err := filepath.Abs(m.StagingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []CacheCleanup
+	add := func(path, reason string, since time.Time) error {
+		if _, err := os.Lstat(path); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		// Never touch the staging directory in use, or anything holding it
+		if isWithin(stagingDir, abs) || isWithin(abs, stagingDir) {
+			return nil
+		}
+		entries = append(entries, CacheCleanup{Path: path, Reason: reason, since: since})
+		return nil
+	}
+
+	if err := add(filepath.Join(cacheDir, "staging"), "staging directory no longer in use", time.Time{}); err != nil {
+		return nil, err
+	}
+	worlds, err := os.ReadDir(m.worldsDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to list staged worlds: %w", err)
+	}
+	for _, world := range worlds {
+		if err := add(filepath.Join(m.worldsDir(), world.Name()), "staging directory of another world", time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range scratchDirs {
+		if err := add(filepath.Join(cacheDir, name), "left by an unfinished "+name, time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+	if err := add(m.compactDir(), "left by an unfinished compaction", time.Time{}); err != nil {
+		return nil, err
+	}
+
+	quarantineDir := m.quarantineDir()
+	quarantined, err := os.ReadDir(quarantineDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to list quarantined trees: %w", err)
+	}
+	for _, tree := range quarantined {
+		// Moving a tree into quarantine keeps its modification times, so
+		// the grace period runs from the time in its name
+		name := tree.Name()
+		quarantinedAt, _ := time.Parse("20060102-150405", name[max(len(name)-len("20060102-150405"), 0):])
+		if err := add(filepath.Join(quarantineDir, name), "quarantined staging tree", quarantinedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	copies, err := m.LocalCopies()
+	if err != nil {
+		return nil, err
+	}
+	for len(copies) > m.LocalKeepVCDBS {
+		if err := add(copies[0], "local copy beyond LOCAL_KEEP_VCDBS", time.Time{}); err != nil {
+			return nil, err
+		}
+		copies = copies[1:]
+	}
+	return entries, nil
+}
+
+// lastModified returns the newest modification time of path or anything
+// under it.
+func lastModified(path string) (time.Time, error) {
+	var latest time.Time
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest, err
+}
+
+// cacheDir returns CacheDir, or DefaultCacheDir if not set.
+func (m *Manager) cacheDir() string {
+	if m.CacheDir != "" {
+		return m.CacheDir
+	}
+	return DefaultCacheDir
+}
+
+// quarantineDir returns QuarantineDir, or the quarantine directory in the
+// cache if not set.
+func (m *Manager) quarantineDir() string {
+	if m.QuarantineDir != "" {
+		return m.QuarantineDir
+	}
+	return filepath.Join(m.cacheDir(), "quarantine")
+}
+
+// cacheGracePeriod returns CacheGracePeriod, or DefaultCacheGracePeriod if
+// not set.
+func (m *Manager) cacheGracePeriod() time.Duration {
+	if m.CacheGracePeriod > 0 {
+		return m.CacheGracePeriod
+	}
+	return DefaultCacheGracePeriod
+}
+
+// runCacheCleanupLoop runs CleanCache every CacheCleanupInterval.
+func (m *Manager) runCacheCleanupLoop(ctx context.Context) {
+	defer m.wg.Done()
+
+	ticker := m.clock().NewTicker(m.CacheCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if _, err := m.CleanCache(ctx); err != nil && ctx.Err() == nil && !errors.Is(err, ErrOperationInProgress) {
+				fmt.Printf("WARNING: Failed to clean up the backup cache: %v\n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/clock"
+)
+
+func TestManager_CleanCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-10 * 24 * time.Hour)
+	recent := now.Add(-time.Hour)
+
+	create := func(rel string, mtime time.Time) string {
+		path := filepath.Join(cacheDir, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("data"), 0644)
+		for p := path; p != cacheDir; p = filepath.Dir(p) {
+			os.Chtimes(p, mtime, mtime)
+		}
+		return path
+	}
+	current := create("worlds/current/Saves/default/meta.bin", old)
+	otherWorld := create("worlds/other/Saves/default/meta.bin", old)
+	unnamed := create("staging/Saves/default/meta.bin", recent)
+	restore := create("restore/Saves/default.vcdbs", old)
+	quarantined := create("quarantine/current-20250101-120000/meta.bin", old)
+	requarantined := create("quarantine/current-20250301-110000/meta.bin", old)
+	oldCopy := create("local/2025-02-01T12-00-00Z.vcdbs", old)
+	keptCopy := create("local/2025-02-28T12-00-00Z.vcdbs", old)
+	userFile := create("notes/todo.txt", old)
+
+	m := &Manager{
+		CacheDir:       cacheDir,
+		StagingDir:     filepath.Join(cacheDir, "worlds", "current"),
+		CompactDir:     filepath.Join(cacheDir, "compact"),
+		QuarantineDir:  filepath.Join(cacheDir, "quarantine"),
+		LocalDir:       filepath.Join(cacheDir, "local"),
+		LocalKeepVCDBS: 1,
+		Clock:          clock.NewFake(now),
+	}
+
+	found, err := m.CleanCache(context.Background())
+	if err != nil {
+		t.Fatalf("CleanCache() failed: %v", err)
+	}
+
+	removed := map[string]bool{}
+	for _, c := range found {
+		removed[c.Path] = c.Removed
+	}
+	for _, path := range []string{otherWorld, restore, quarantined, oldCopy} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s was not removed", path)
+		}
+	}
+	for _, path := range []string{current, unnamed, requarantined, keptCopy, userFile} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s was removed: %v", path, err)
+		}
+	}
+	if removed, ok := removed[filepath.Join(cacheDir, "staging")]; !ok || removed {
+		t.Errorf("CleanCache() = %+v, want the recently used unnamed staging directory found but kept", found)
+	}
+	if len(found) != 6 {
+		t.Errorf("CleanCache() found %d entries, want 6: %+v", len(found), found)
+	}
+}
+
+func TestManager_CleanCache_OperationInProgress(t *testing.T) {
+	m := &Manager{CacheDir: t.TempDir()}
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+
+	if _, err := m.CleanCache(context.Background()); !errors.Is(err, ErrOperationInProgress) {
+		t.Errorf("CleanCache() error = %v, want ErrOperationInProgress", err)
+	}
+}
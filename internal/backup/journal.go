@@ -0,0 +1,130 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stagingJournalName is the file in the staging directory that marks an
+// update in progress. It is removed once the update completes, so a snapshot
+// never sees it.
+const stagingJournalName = ".staging-update"
+
+// ErrStagingIncomplete is returned when a snapshot is attempted while the
+// staging directory is partway through an update.
+var ErrStagingIncomplete = errors.New("staging directory update did not complete")
+
+// stagingJournal records an update of the staging directory in progress.
+type stagingJournal struct {
+	// Started is when the update began.
+	Started time.Time `json:"started"`
+
+	// Source is the backup file the update is built from.
+	Source string `json:"source"`
+}
+
+// journalPath returns the path of the staging journal.
+func (m *Manager) journalPath() string {
+	return filepath.Join(m.stagingTarget(), stagingJournalName)
+}
+
+// readStagingJournal returns the journal of an update that hasn't completed,
+// or nil if the staging directory is consistent.
+func (m *Manager) readStagingJournal() (*stagingJournal, error) {
+	data, err := os.ReadFile(m.journalPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read staging journal: %w", err)
+	}
+
+	var j stagingJournal
+	if err := json.Unmarshal(data, &j); err != nil {
+		// A journal torn by a crash still means the update didn't finish
+		return &stagingJournal{}, nil
+	}
+	return &j, nil
+}
+
+// beginStagingUpdate records that the staging directory is about to be
+// updated from source. If a previous update was interrupted, it is reported
+// and this update rolls it forward: every staged file is compared against the
+// new backup, so whatever the interrupted update left behind is replaced.
+func (m *Manager) beginStagingUpdate(source string) error {
+	prev, err := m.readStagingJournal()
+	if err != nil {
+		return err
+	}
+
+	if prev != nil {
+		fmt.Printf("WARNING: Previous staging update (started %s) did not complete; rolling it forward\n",
+			prev.Started.Format(time.RFC3339))
+	}
+
+	data, err := json.Marshal(stagingJournal{Started: time.Now(), Source: source})
+	if err != nil {
+		return fmt.Errorf("failed to marshal staging journal: %w", err)
+	}
+	if err := writeFileSync(m.journalPath(), data); err != nil {
+		return fmt.Errorf("failed to write staging journal: %w", err)
+	}
+	return nil
+}
+
+// commitStagingUpdate marks the staging update as complete.
+func (m *Manager) commitStagingUpdate() error {
+	if err := os.Remove(m.journalPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove staging journal: %w", err)
+	}
+	syncDir(m.stagingTarget())
+	return nil
+}
+
+// checkStagingComplete returns ErrStagingIncomplete if the staging directory
+// is partway through an update.
+func (m *Manager) checkStagingComplete() error {
+	j, err := m.readStagingJournal()
+	if err != nil {
+		return err
+	}
+	if j != nil {
+		return fmt.Errorf("%w (started %s); skipping snapshot until the next backup rolls it forward",
+			ErrStagingIncomplete, j.Started.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// writeFileSync writes data to path and flushes it to disk before returning.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// syncDir flushes a directory's entries to disk. Errors are ignored, since
+// not every platform supports syncing directories.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
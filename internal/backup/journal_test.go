@@ -0,0 +1,130 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestStagingJournal(t *testing.T) {
+	m := &Manager{StagingDir: t.TempDir()}
+
+	if err := m.checkStagingComplete(); err != nil {
+		t.Fatalf("empty staging directory should be complete: %v", err)
+	}
+
+	if err := m.beginStagingUpdate("/gamedata/Backups/a.vcdbs"); err != nil {
+		t.Fatalf("beginStagingUpdate() error: %v", err)
+	}
+	err := m.checkStagingComplete()
+	if !errors.Is(err, ErrStagingIncomplete) {
+		t.Fatalf("checkStagingComplete() during update = %v, want ErrStagingIncomplete", err)
+	}
+
+	j, err := m.readStagingJournal()
+	if err != nil || j == nil {
+		t.Fatalf("readStagingJournal() = %v, %v", j, err)
+	}
+	if j.Source != "/gamedata/Backups/a.vcdbs" {
+		t.Errorf("journal Source = %q", j.Source)
+	}
+
+	if err := m.commitStagingUpdate(); err != nil {
+		t.Fatalf("commitStagingUpdate() error: %v", err)
+	}
+	if err := m.checkStagingComplete(); err != nil {
+		t.Errorf("checkStagingComplete() after commit = %v", err)
+	}
+}
+
+func TestStagingJournal_TornJournalCountsAsIncomplete(t *testing.T) {
+	m := &Manager{StagingDir: t.TempDir()}
+	os.WriteFile(m.journalPath(), []byte(`{"started":`), 0644)
+
+	if err := m.checkStagingComplete(); !errors.Is(err, ErrStagingIncomplete) {
+		t.Errorf("checkStagingComplete() = %v, want ErrStagingIncomplete", err)
+	}
+}
+
+func TestRunRestic_RefusesIncompleteStaging(t *testing.T) {
+	restic := &testsupport.ResticRunner{}
+	m := &Manager{StagingDir: t.TempDir(), ResticRunner: restic.Run}
+
+	if err := m.beginStagingUpdate("backup.vcdbs"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.runRestic(context.Background()); !errors.Is(err, ErrStagingIncomplete) {
+		t.Errorf("runRestic() error = %v, want ErrStagingIncomplete", err)
+	}
+	if runs := restic.Runs(); len(runs) != 0 {
+		t.Errorf("restic ran on an incomplete staging directory: %v", runs)
+	}
+}
+
+func TestPerformBackup_RollsForwardInterruptedUpdate(t *testing.T) {
+	gameDataDir := t.TempDir()
+	stagingDir := t.TempDir()
+	backupsDir := filepath.Join(gameDataDir, "Backups")
+	os.MkdirAll(backupsDir, 0755)
+	os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), []byte("{}"), 0644)
+
+	failSplit := true
+	restic := &testsupport.ResticRunner{}
+	m := &Manager{
+		Interval:      time.Second,
+		Server:        &testsupport.Server{},
+		GameDataDir:   gameDataDir,
+		StagingDir:    stagingDir,
+		BackupTimeout: 5 * time.Second,
+		ResticRunner:  restic.Run,
+		VCDBTreeSplitter: func(srcPath, dstDir string) (int, int, error) {
+			if failSplit {
+				// Leave a partial tree behind, as a crash mid-split would
+				os.MkdirAll(filepath.Join(dstDir, "chunks"), 0755)
+				os.WriteFile(filepath.Join(dstDir, "chunks", "partial.bin"), []byte("par"), 0644)
+				return 0, 0, fmt.Errorf("simulated crash during split")
+			}
+			os.RemoveAll(filepath.Join(dstDir, "chunks"))
+			return 1, 0, nil
+		},
+	}
+
+	backup := func(name string) error {
+		backupFile := filepath.Join(backupsDir, name)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			os.WriteFile(backupFile, []byte("backup data"), 0644)
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return m.performBackup(ctx, true)
+	}
+
+	if err := backup("first.vcdbs"); err == nil {
+		t.Fatal("performBackup() expected to fail when the split fails")
+	}
+	if len(restic.Runs()) != 0 {
+		t.Fatal("restic should not run after a failed staging update")
+	}
+	if err := m.checkStagingComplete(); !errors.Is(err, ErrStagingIncomplete) {
+		t.Fatalf("staging should be marked incomplete, got %v", err)
+	}
+
+	failSplit = false
+	if err := backup("second.vcdbs"); err != nil {
+		t.Fatalf("performBackup() after interrupted update: %v", err)
+	}
+	if len(restic.Runs()) != 1 {
+		t.Errorf("restic runs = %d, want 1", len(restic.Runs()))
+	}
+	if err := m.checkStagingComplete(); err != nil {
+		t.Errorf("staging should be complete after a successful update: %v", err)
+	}
+}
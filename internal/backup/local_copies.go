@@ -0,0 +1,175 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// localCopyLayout names local copies after the UTC time they were kept, so
+// they sort chronologically.
+const localCopyLayout = "2006-01-02T15-04-05Z"
+
+// localDir returns LocalDir, or the local directory in the cache if not set.
+func (m *Manager) localDir() string {
+	if m.LocalDir != "" {
+		return m.LocalDir
+	}
+	return filepath.Join(m.cacheDir(), "local")
+}
+
+// LocalCopiesDir returns the directory local copies are kept in.
+func (m *Manager) LocalCopiesDir() string {
+	return m.localDir()
+}
+
+// disposeBackupFile gets rid of a backup file once it has been split into the
+// staging directory: it is kept as a local copy if LocalKeepVCDBS is set, and
+// removed otherwise. Failing to keep a copy isn't fatal; the file is removed
+// so the Backups directory doesn't fill up.
+func (m *Manager) disposeBackupFile(backupFile string) error {
+	if m.LocalKeepVCDBS > 0 {
+		kept, err := m.keepLocalCopy(backupFile, time.Now())
+		if err == nil {
+			fmt.Printf("Kept local copy of backup: %s\n", kept)
+			return nil
+		}
+		fmt.Printf("WARNING: Failed to keep local copy of backup: %v\n", err)
+	}
+
+	if err := os.Remove(backupFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove original backup file: %w", err)
+	}
+	return nil
+}
+
+// RawBackupUploader stores raw backup files somewhere besides the restic
+// repository. *objstore.Uploader implements it.
+type RawBackupUploader interface {
+	// UploadBackup uploads the file at path under name and returns where
+	// it was stored.
+	UploadBackup(ctx context.Context, path, name string) (string, error)
+}
+
+// uploadBackupFile uploads the raw backup file, if RawUploader is set, as
+// "<save>/<UTC time>.vcdbs". Failing to upload isn't fatal to the backup.
+func (m *Manager) uploadBackupFile(ctx context.Context, backupFile, saveFileName string, now time.Time) {
+	if m.RawUploader == nil {
+		return
+	}
+
+	name := strings.TrimSuffix(saveFileName, ".vcdbs") + "/" + now.UTC().Format(localCopyLayout) + ".vcdbs"
+	fmt.Println("Uploading raw backup file...")
+	location, err := m.RawUploader.UploadBackup(ctx, backupFile, name)
+	if err != nil {
+		fmt.Printf("WARNING: Failed to upload raw backup file: %v\n", err)
+		return
+	}
+	fmt.Printf("Uploaded raw backup file to %s\n", location)
+}
+
+// keepLocalCopy moves backupFile into the local copies directory, named after
+// now, and removes the oldest copies beyond LocalKeepVCDBS.
+func (m *Manager) keepLocalCopy(backupFile string, now time.Time) (string, error) {
+	dir := m.localDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create local copies directory: %w", err)
+	}
+
+	dst := filepath.Join(dir, now.UTC().Format(localCopyLayout)+".vcdbs")
+	if err := moveFile(backupFile, dst); err != nil {
+		return "", err
+	}
+
+	if err := m.rotateLocalCopies(); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+// rotateLocalCopies removes the oldest local copies until at most
+// LocalKeepVCDBS remain. Files not named by keepLocalCopy are left alone.
+func (m *Manager) rotateLocalCopies() error {
+	copies, err := m.LocalCopies()
+	if err != nil {
+		return err
+	}
+
+	for len(copies) > m.LocalKeepVCDBS {
+		if err := os.Remove(copies[0]); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove old local copy: %w", err)
+		}
+		copies = copies[1:]
+	}
+	return nil
+}
+
+// LocalCopies returns the paths of the kept backup files, oldest first.
+func (m *Manager) LocalCopies() ([]string, error) {
+	dir := m.localDir()
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local copies directory: %w", err)
+	}
+
+	var copies []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasSuffix(name, ".vcdbs") {
+			continue
+		}
+		if _, err := time.Parse(localCopyLayout, strings.TrimSuffix(name, ".vcdbs")); err != nil {
+			continue
+		}
+		copies = append(copies, filepath.Join(dir, name))
+	}
+	sort.Strings(copies)
+	return copies, nil
+}
+
+// moveFile moves src to dst. If they are on different filesystems, src is
+// copied to a temporary file next to dst, renamed into place, and removed.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to move %s into place: %w", dst, err)
+	}
+
+	in.Close()
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", src, err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManager_KeepLocalCopy_Rotates(t *testing.T) {
+	backupsDir := t.TempDir()
+	localDir := filepath.Join(t.TempDir(), "local")
+	m := &Manager{LocalKeepVCDBS: 2, LocalDir: localDir}
+
+	// A file the rotation must not touch
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	foreign := filepath.Join(localDir, "handmade.vcdbs")
+	if err := os.WriteFile(foreign, []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		src := filepath.Join(backupsDir, "backup.vcdbs")
+		if err := os.WriteFile(src, []byte{byte(i)}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.keepLocalCopy(src, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("keepLocalCopy() failed: %v", err)
+		}
+		if _, err := os.Stat(src); !os.IsNotExist(err) {
+			t.Errorf("backup file still exists after keepLocalCopy()")
+		}
+	}
+
+	copies, err := m.LocalCopies()
+	if err != nil {
+		t.Fatalf("LocalCopies() failed: %v", err)
+	}
+	want := []string{
+		filepath.Join(localDir, "2024-03-01T13-00-00Z.vcdbs"),
+		filepath.Join(localDir, "2024-03-01T14-00-00Z.vcdbs"),
+	}
+	if len(copies) != len(want) || copies[0] != want[0] || copies[1] != want[1] {
+		t.Errorf("LocalCopies() = %v, want %v", copies, want)
+	}
+	if data, err := os.ReadFile(want[1]); err != nil || string(data) != "\x02" {
+		t.Errorf("newest copy = %q, %v; want the last backup", data, err)
+	}
+	if _, err := os.Stat(foreign); err != nil {
+		t.Errorf("rotation removed an unrelated file: %v", err)
+	}
+}
+
+func TestManager_DisposeBackupFile(t *testing.T) {
+	t.Run("removes when not keeping copies", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "backup.vcdbs")
+		os.WriteFile(src, []byte("data"), 0644)
+		localDir := filepath.Join(t.TempDir(), "local")
+
+		m := &Manager{LocalDir: localDir}
+		if err := m.disposeBackupFile(src); err != nil {
+			t.Fatalf("disposeBackupFile() failed: %v", err)
+		}
+		if _, err := os.Stat(src); !os.IsNotExist(err) {
+			t.Error("backup file was not removed")
+		}
+		if _, err := os.Stat(localDir); !os.IsNotExist(err) {
+			t.Error("local copies directory created although no copies are kept")
+		}
+	})
+
+	t.Run("removes when the copy fails", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "backup.vcdbs")
+		os.WriteFile(src, []byte("data"), 0644)
+		blocker := filepath.Join(t.TempDir(), "file")
+		os.WriteFile(blocker, nil, 0644)
+
+		m := &Manager{LocalKeepVCDBS: 1, LocalDir: filepath.Join(blocker, "local")}
+		if err := m.disposeBackupFile(src); err != nil {
+			t.Fatalf("disposeBackupFile() failed: %v", err)
+		}
+		if _, err := os.Stat(src); !os.IsNotExist(err) {
+			t.Error("backup file was not removed after a failed copy")
+		}
+	})
+}
+
+// fakeRawUploader records uploads for testing.
+type fakeRawUploader struct {
+	paths []string
+	names []string
+	err   error
+}
+
+func (u *fakeRawUploader) UploadBackup(ctx context.Context, path, name string) (string, error) {
+	u.paths = append(u.paths, path)
+	u.names = append(u.names, name)
+	return "bucket/" + name, u.err
+}
+
+func TestManager_UploadBackupFile(t *testing.T) {
+	uploader := &fakeRawUploader{}
+	m := &Manager{RawUploader: uploader}
+	now := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	m.uploadBackupFile(context.Background(), "/gamedata/Backups/x.vcdbs", "default.vcdbs", now)
+	if len(uploader.names) != 1 || uploader.names[0] != "default/2024-03-01T12-30-00Z.vcdbs" {
+		t.Errorf("uploaded names = %q", uploader.names)
+	}
+	if uploader.paths[0] != "/gamedata/Backups/x.vcdbs" {
+		t.Errorf("uploaded path = %q", uploader.paths[0])
+	}
+
+	// A failed upload is only a warning
+	uploader.err = errors.New("bucket unreachable")
+	m.uploadBackupFile(context.Background(), "/gamedata/Backups/y.vcdbs", "default.vcdbs", now)
+	if len(uploader.names) != 2 {
+		t.Errorf("expected a second upload attempt, got %d", len(uploader.names))
+	}
+}
@@ -0,0 +1,158 @@
+package backup
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// compressedLogSuffix is appended to rotated logs compressed into staging.
+const compressedLogSuffix = ".gz"
+
+// alreadyCompressed lists extensions of log archives that aren't compressed
+// again.
+var alreadyCompressed = map[string]bool{".gz": true, ".zip": true, ".zst": true, ".xz": true, ".7z": true}
+
+// syncLogs syncs the Logs directory into staging as policy says. Without
+// CompressLogs it is mirrored as-is. With it, rotated logs are stored
+// gzip-compressed with a ".gz" suffix and the live logs are copied
+// unchanged, since the server keeps appending to them. A compressed log is
+// only rewritten when its source's modification time changes. Returns how
+// many staged logs were written, already up to date, and removed.
+func (m *Manager) syncLogs(srcDir, dstDir string, policy SyncPolicy) (vcdbtree.FileCounts, error) {
+	var files vcdbtree.FileCounts
+	if !m.CompressLogs {
+		var err error
+		files.Written, files.Skipped, files.Removed, err = vcdbtree.SyncDirOptions(srcDir, dstDir, policy.syncOptions(m.SyncWorkers, m.throttle()))
+		return files, err
+	}
+
+	expected := make(map[string]bool)
+	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dstDir, rel), 0755)
+		}
+		if vcdbtree.IsTransientFile(path) || policy.excluded(rel) {
+			return nil
+		}
+
+		if isLiveLog(rel) || alreadyCompressed[strings.ToLower(filepath.Ext(rel))] {
+			dst := filepath.Join(dstDir, rel)
+			expected[dst] = true
+			written, err := policy.copyFile(path, dst)
+			if written {
+				files.Written++
+			} else {
+				files.Skipped++
+			}
+			return err
+		}
+
+		dst := filepath.Join(dstDir, rel+compressedLogSuffix)
+		expected[dst] = true
+		if dstInfo, err := os.Stat(dst); err == nil && dstInfo.ModTime().Equal(info.ModTime()) {
+			files.Skipped++
+			return nil
+		}
+		files.Written++
+		return compressLog(path, dst, info)
+	})
+	if err != nil {
+		return files, err
+	}
+
+	files.Removed, err = removeUnexpected(dstDir, expected)
+	return files, err
+}
+
+// isLiveLog reports whether rel, a path relative to Logs, may still be
+// written to: a .log file at the top of Logs. Logs in subdirectories, such as
+// the server's Archive, and rotated names like "command-audit.log.1" are
+// finished.
+func isLiveLog(rel string) bool {
+	return filepath.Dir(rel) == "." && strings.HasSuffix(rel, ".log")
+}
+
+// compressLog writes src gzip-compressed to dst, through a temporary file,
+// and gives dst the modification time of src. The gzip header holds no name
+// or time, so the same log always compresses to the same bytes.
+func compressLog(src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	defer os.Remove(tmp)
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to compress %s: %w", src, err)
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to compress %s: %w", src, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+
+	if err := os.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("failed to set modification time of %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", dst, err)
+	}
+	return nil
+}
+
+// removeUnexpected removes the files under dir that aren't in expected, then
+// any directories left empty. Returns the number of files removed.
+func removeUnexpected(dir string, expected map[string]bool) (removed int, err error) {
+	var dirs []string
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if !expected[path] {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, err
+	}
+
+	// Deepest first, so parents empty out; non-empty directories stay
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+	return removed, nil
+}
@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// readGzip returns the decompressed contents of a .gz file.
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Failed to read gzip header of %s: %v", path, err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Failed to decompress %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func writeTestLog(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestSyncLogs_Compressed(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "Logs")
+	dstDir := filepath.Join(t.TempDir(), "Logs")
+
+	writeTestLog(t, filepath.Join(srcDir, "server-main.log"), "live main log")
+	writeTestLog(t, filepath.Join(srcDir, "command-audit.log.1"), "rotated audit log")
+	writeTestLog(t, filepath.Join(srcDir, "Archive", "server-main.log"), "archived main log")
+	writeTestLog(t, filepath.Join(srcDir, "Archive", "old.zip"), "zip data")
+
+	m := &Manager{CompressLogs: true}
+	if _, err := m.syncLogs(srcDir, dstDir, SyncPolicy{}); err != nil {
+		t.Fatalf("syncLogs failed: %v", err)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dstDir, "server-main.log")); err != nil || string(data) != "live main log" {
+		t.Errorf("Live log = %q, %v; want it copied as-is", data, err)
+	}
+	if got := readGzip(t, filepath.Join(dstDir, "command-audit.log.1.gz")); got != "rotated audit log" {
+		t.Errorf("Rotated audit log = %q", got)
+	}
+	if got := readGzip(t, filepath.Join(dstDir, "Archive", "server-main.log.gz")); got != "archived main log" {
+		t.Errorf("Archived log = %q", got)
+	}
+	if data, err := os.ReadFile(filepath.Join(dstDir, "Archive", "old.zip")); err != nil || string(data) != "zip data" {
+		t.Errorf("Zip archive = %q, %v; want it copied as-is", data, err)
+	}
+	for _, name := range []string{"command-audit.log.1", filepath.Join("Archive", "server-main.log")} {
+		if _, err := os.Stat(filepath.Join(dstDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Uncompressed %s exists in staging: %v", name, err)
+		}
+	}
+}
+
+func TestSyncLogs_UnchangedNotRewritten(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "Logs")
+	dstDir := filepath.Join(t.TempDir(), "Logs")
+	src := filepath.Join(srcDir, "Archive", "server-main.log")
+	dst := filepath.Join(dstDir, "Archive", "server-main.log.gz")
+	writeTestLog(t, src, "archived main log")
+
+	m := &Manager{CompressLogs: true}
+	if _, err := m.syncLogs(srcDir, dstDir, SyncPolicy{}); err != nil {
+		t.Fatalf("syncLogs failed: %v", err)
+	}
+	first, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("Failed to read compressed log: %v", err)
+	}
+
+	// Mark the staged copy; an unchanged source must leave it alone
+	if err := os.WriteFile(dst, []byte("marker"), 0644); err != nil {
+		t.Fatalf("Failed to write marker: %v", err)
+	}
+	info, _ := os.Stat(src)
+	os.Chtimes(dst, info.ModTime(), info.ModTime())
+	files, err := m.syncLogs(srcDir, dstDir, SyncPolicy{})
+	if err != nil {
+		t.Fatalf("syncLogs failed: %v", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "marker" {
+		t.Error("Compressed log was rewritten although its source didn't change")
+	}
+	if files != (vcdbtree.FileCounts{Skipped: 1}) {
+		t.Errorf("syncLogs() counts = %+v, want 1 unchanged", files)
+	}
+
+	// A new modification time recompresses it, to the same bytes as before
+	later := info.ModTime().Add(time.Minute)
+	os.Chtimes(src, later, later)
+	files, err = m.syncLogs(srcDir, dstDir, SyncPolicy{})
+	if err != nil {
+		t.Fatalf("syncLogs failed: %v", err)
+	}
+	if files != (vcdbtree.FileCounts{Written: 1}) {
+		t.Errorf("syncLogs() counts = %+v, want 1 written", files)
+	}
+	if data, _ := os.ReadFile(dst); !bytes.Equal(data, first) {
+		t.Error("Recompressed log differs from the first compression")
+	}
+}
+
+func TestSyncLogs_RemovesStale(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "Logs")
+	dstDir := filepath.Join(t.TempDir(), "Logs")
+	writeTestLog(t, filepath.Join(srcDir, "server-main.log"), "live")
+	writeTestLog(t, filepath.Join(srcDir, "Archive", "server-main.log"), "archived")
+
+	// Staged without compression first
+	m := &Manager{}
+	if _, err := m.syncLogs(srcDir, dstDir, SyncPolicy{}); err != nil {
+		t.Fatalf("syncLogs failed: %v", err)
+	}
+
+	m.CompressLogs = true
+	if err := os.RemoveAll(filepath.Join(srcDir, "Archive")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestLog(t, filepath.Join(srcDir, "server-debug.log.1"), "rotated")
+	if _, err := m.syncLogs(srcDir, dstDir, SyncPolicy{}); err != nil {
+		t.Fatalf("syncLogs failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dstDir, "Archive")); !os.IsNotExist(err) {
+		t.Errorf("Archive directory still in staging: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "server-debug.log.1.gz")); err != nil {
+		t.Errorf("Rotated log not compressed into staging: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "server-main.log")); err != nil {
+		t.Errorf("Live log missing from staging: %v", err)
+	}
+}
+
+func TestIsLiveLog(t *testing.T) {
+	tests := map[string]bool{
+		"server-main.log":                      true,
+		"command-audit.log":                    true,
+		"command-audit.log.1":                  false,
+		filepath.Join("Archive", "server.log"): false,
+		"notes.txt":                            false,
+	}
+	for rel, want := range tests {
+		if got := isLiveLog(rel); got != want {
+			t.Errorf("isLiveLog(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
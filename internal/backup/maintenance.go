@@ -0,0 +1,156 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// PlayerCounter reports how many players are online. A PlayerChecker that
+// also implements it lets MaintenanceMaxDefer hold off prunes and checks
+// while the server is in use. *PlayerChecker implements it.
+type PlayerCounter interface {
+	PlayerCount() int
+}
+
+// CheckRunner is a function type for running restic check.
+// This allows for testing without actually running restic.
+type CheckRunner func(ctx context.Context) error
+
+// deferForPlayers reports whether a maintenance task should be put off because
+// players are online. since tracks when the task was first put off; once it
+// has waited MaintenanceMaxDefer, the task runs anyway. Must be called with
+// opMu held.
+func (m *Manager) deferForPlayers(task string, since *time.Time, now time.Time) bool {
+	if m.MaintenanceMaxDefer <= 0 {
+		return false
+	}
+	counter, ok := m.PlayerChecker.(PlayerCounter)
+	if !ok {
+		return false
+	}
+
+	players := counter.PlayerCount()
+	if players == 0 {
+		return false
+	}
+
+	if since.IsZero() {
+		*since = now
+	}
+	if waited := now.Sub(*since); waited >= m.MaintenanceMaxDefer {
+		fmt.Printf("%d player(s) online, but %s has been deferred for %v; running it now\n", players, task, waited.Round(time.Minute))
+		return false
+	}
+
+	fmt.Printf("%d player(s) online, %s deferred until the server is empty (at most until %s)\n",
+		players, task, since.Add(m.MaintenanceMaxDefer).Format(time.DateTime))
+	return true
+}
+
+// runResticPrune runs restic forget with the configured retention options and --prune.
+// This removes old snapshots according to the retention policy.
+func (m *Manager) runResticPrune(ctx context.Context) error {
+	if m.pruneRetention() == "" {
+		return nil // No pruning configured
+	}
+
+	// Prunes are heavy, so with a window only the first backup inside it prunes
+	if m.PruneWindow != nil {
+		now := m.clock().Now()
+		opened, ok := m.PruneWindow.openedAt(now)
+		if !ok {
+			fmt.Printf("Prune deferred until prune window %s\n", m.PruneWindow)
+			return nil
+		}
+		if !m.lastPrune.Before(opened) {
+			return nil // Already pruned in this window
+		}
+	}
+
+	if m.deferForPlayers("prune", &m.pruneDeferredSince, m.clock().Now()) {
+		return nil
+	}
+
+	if err := m.runPrune(ctx); err != nil {
+		return err
+	}
+	m.lastPrune = m.clock().Now()
+	m.pruneDeferredSince = time.Time{}
+	return nil
+}
+
+// runPrune runs restic forget --prune with the configured retention options.
+func (m *Manager) runPrune(ctx context.Context) error {
+	retention := m.pruneRetention()
+
+	// Use custom runner if provided (for testing)
+	if m.PruneRunner != nil {
+		return m.PruneRunner(ctx, retention)
+	}
+
+	fmt.Printf("Running restic forget with retention: %s\n", retention)
+
+	// Build the command: restic forget --host <host> [--group-by <fields>] <options> --prune
+	cmd := m.heavyResticCommand(ctx, m.forgetArgs()...)
+	cmd.Env = m.resticEnv()
+	cmd.Stdout = os.Stdout
+
+	return runResticCommand(cmd, "forget --prune")
+}
+
+// runResticCheck runs restic check if CheckInterval has passed since the last
+// successful check. The first backup after startup always checks. With
+// PruneWindow, checks that are due wait for the window.
+func (m *Manager) runResticCheck(ctx context.Context) error {
+	if m.CheckInterval <= 0 {
+		return nil
+	}
+
+	now := m.clock().Now()
+	if !m.lastCheck.IsZero() && now.Sub(m.lastCheck) < m.CheckInterval {
+		return nil
+	}
+	if !m.PruneWindow.Contains(now) {
+		fmt.Printf("restic check deferred until prune window %s\n", m.PruneWindow)
+		return nil
+	}
+	if m.deferForPlayers("restic check", &m.checkDeferredSince, now) {
+		return nil
+	}
+
+	if err := m.runCheck(ctx); err != nil {
+		return err
+	}
+	m.lastCheck = m.clock().Now()
+	m.checkDeferredSince = time.Time{}
+	return nil
+}
+
+// runCheck runs restic check.
+func (m *Manager) runCheck(ctx context.Context) error {
+	// Use custom runner if provided (for testing)
+	if m.CheckRunner != nil {
+		return m.CheckRunner(ctx)
+	}
+
+	fmt.Println("Running restic check")
+
+	cmd := m.heavyResticCommand(ctx, "check")
+	cmd.Env = m.resticEnv()
+	cmd.Stdout = os.Stdout
+
+	return runResticCommand(cmd, "check")
+}
+
+// fullBackupDue reports whether the next restic backup should be a full one
+// for BackupWindow: the first backup inside each occurrence of the window.
+// Must be called with opMu held.
+func (m *Manager) fullBackupDue() bool {
+	if m.BackupWindow == nil || m.ChangeDetection == ChangeDetectionRescan {
+		return false
+	}
+	opened, ok := m.BackupWindow.openedAt(m.clock().Now())
+	return ok && m.lastFullBackup.Before(opened)
+}
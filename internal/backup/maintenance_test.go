@@ -0,0 +1,190 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/clock"
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestManager_DeferForPlayers(t *testing.T) {
+	players := testsupport.NewPlayerChecker(true)
+	m := &Manager{PlayerChecker: players, MaintenanceMaxDefer: time.Hour}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var since time.Time
+
+	if m.deferForPlayers("prune", &since, start) {
+		t.Error("deferForPlayers() = true with an empty server")
+	}
+
+	players.SetPlayerCount(2)
+	if !m.deferForPlayers("prune", &since, start) {
+		t.Error("deferForPlayers() = false with players online")
+	}
+	if !since.Equal(start) {
+		t.Errorf("since = %v, want %v", since, start)
+	}
+	if !m.deferForPlayers("prune", &since, start.Add(59*time.Minute)) {
+		t.Error("deferForPlayers() = false before MaintenanceMaxDefer elapsed")
+	}
+	if m.deferForPlayers("prune", &since, start.Add(time.Hour)) {
+		t.Error("deferForPlayers() = true after MaintenanceMaxDefer elapsed")
+	}
+
+	// Disabled, or without a player count, nothing is deferred
+	m.MaintenanceMaxDefer = 0
+	if m.deferForPlayers("prune", &since, start) {
+		t.Error("deferForPlayers() = true with MaintenanceMaxDefer unset")
+	}
+	m = &Manager{PlayerChecker: shouldBackupOnly{}, MaintenanceMaxDefer: time.Hour}
+	if m.deferForPlayers("prune", &since, start) {
+		t.Error("deferForPlayers() = true for a PlayerChecker without PlayerCount")
+	}
+}
+
+// shouldBackupOnly is a PlayerCheckerInterface that can't count players.
+type shouldBackupOnly struct{}
+
+func (shouldBackupOnly) ShouldBackup() bool { return true }
+
+func TestManager_RunResticPrune_DefersForPlayers(t *testing.T) {
+	players := testsupport.NewPlayerChecker(true)
+	players.SetPlayerCount(1)
+	prunes := 0
+	m := &Manager{
+		PruneRetention:      "--keep-last 3",
+		PlayerChecker:       players,
+		MaintenanceMaxDefer: time.Hour,
+		PruneRunner: func(ctx context.Context, retentionOptions string) error {
+			prunes++
+			return nil
+		},
+	}
+
+	if err := m.runResticPrune(context.Background()); err != nil {
+		t.Fatalf("runResticPrune() unexpected error: %v", err)
+	}
+	if prunes != 0 {
+		t.Errorf("prune ran %d times with players online, want 0", prunes)
+	}
+
+	players.SetPlayerCount(0)
+	if err := m.runResticPrune(context.Background()); err != nil {
+		t.Fatalf("runResticPrune() unexpected error: %v", err)
+	}
+	if prunes != 1 {
+		t.Errorf("prune ran %d times once the server was empty, want 1", prunes)
+	}
+	if !m.pruneDeferredSince.IsZero() {
+		t.Error("pruneDeferredSince not reset after a successful prune")
+	}
+}
+
+func TestManager_RunResticCheck(t *testing.T) {
+	checks := 0
+	checkErr := error(nil)
+	m := &Manager{
+		CheckInterval: 24 * time.Hour,
+		CheckRunner: func(ctx context.Context) error {
+			checks++
+			return checkErr
+		},
+	}
+	ctx := context.Background()
+
+	if err := m.runResticCheck(ctx); err != nil {
+		t.Fatalf("runResticCheck() unexpected error: %v", err)
+	}
+	if err := m.runResticCheck(ctx); err != nil {
+		t.Fatalf("runResticCheck() unexpected error: %v", err)
+	}
+	if checks != 1 {
+		t.Errorf("check ran %d times within CheckInterval, want 1", checks)
+	}
+
+	// Once due, a failed check is retried by the next backup
+	m.lastCheck = time.Now().Add(-25 * time.Hour)
+	checkErr = errors.New("repository damaged")
+	if err := m.runResticCheck(ctx); !errors.Is(err, checkErr) {
+		t.Errorf("runResticCheck() error = %v, want %v", err, checkErr)
+	}
+	checkErr = nil
+	if err := m.runResticCheck(ctx); err != nil {
+		t.Fatalf("runResticCheck() unexpected error: %v", err)
+	}
+	if checks != 3 {
+		t.Errorf("check ran %d times, want 3", checks)
+	}
+
+	// Disabled by default
+	m = &Manager{CheckRunner: func(ctx context.Context) error {
+		t.Error("check ran with CheckInterval unset")
+		return nil
+	}}
+	if err := m.runResticCheck(ctx); err != nil {
+		t.Fatalf("runResticCheck() unexpected error: %v", err)
+	}
+}
+
+func TestManager_RunResticCheck_PruneWindow(t *testing.T) {
+	checks := 0
+	m := &Manager{
+		CheckInterval: time.Hour,
+		PruneWindow:   windowAwayFrom(time.Now()),
+		CheckRunner: func(ctx context.Context) error {
+			checks++
+			return nil
+		},
+	}
+
+	if err := m.runResticCheck(context.Background()); err != nil {
+		t.Fatalf("runResticCheck() unexpected error: %v", err)
+	}
+	if checks != 0 {
+		t.Errorf("check ran %d times outside PruneWindow, want 0", checks)
+	}
+
+	m.PruneWindow = windowAround(time.Now())
+	if err := m.runResticCheck(context.Background()); err != nil {
+		t.Fatalf("runResticCheck() unexpected error: %v", err)
+	}
+	if checks != 1 {
+		t.Errorf("check ran %d times inside PruneWindow, want 1", checks)
+	}
+}
+
+func TestManager_FullBackupDue(t *testing.T) {
+	window, _ := ParseTimeWindow("02:00-06:00")
+	fake := clock.NewFake(time.Date(2025, 3, 1, 1, 0, 0, 0, time.Local))
+	m := &Manager{BackupWindow: window, Clock: fake}
+
+	if m.fullBackupDue() {
+		t.Error("fullBackupDue() = true before the window")
+	}
+
+	fake.Advance(2 * time.Hour)
+	if !m.fullBackupDue() {
+		t.Fatal("fullBackupDue() = false for the first backup in the window")
+	}
+	m.lastFullBackup = fake.Now()
+
+	fake.Advance(time.Hour)
+	if m.fullBackupDue() {
+		t.Error("fullBackupDue() = true after a full backup in the same window")
+	}
+
+	// The next day's window takes a full backup again
+	fake.Advance(24 * time.Hour)
+	if !m.fullBackupDue() {
+		t.Error("fullBackupDue() = false in the next day's window")
+	}
+
+	// Every backup is already full with the rescan policy
+	m.ChangeDetection = ChangeDetectionRescan
+	if m.fullBackupDue() {
+		t.Error("fullBackupDue() = true with ChangeDetectionRescan")
+	}
+}
@@ -3,17 +3,21 @@ package backup
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
+	"github.com/renorris/vintagestory-restic/internal/clock"
+	"github.com/renorris/vintagestory-restic/internal/filelock"
 	"github.com/renorris/vintagestory-restic/internal/server"
-	"github.com/renorris/vintagestory-restic/internal/vcdbtree"
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
 )
 
 // ServerCommander is an interface for sending commands to the server.
@@ -34,7 +38,9 @@ type BootChecker interface {
 var ErrServerNotBooted = fmt.Errorf("server has not fully booted yet")
 
 // ResticRunner is a function type for running restic backups.
-// This allows for testing without actually running restic.
+// This allows for testing without actually running restic. With
+// ModsInterval set, it is called once per snapshot set, with the staging
+// directory for the world set and the Mods directory for the Mods set.
 type ResticRunner func(ctx context.Context, stagingDir string) error
 
 // PruneRunner is a function type for running restic forget --prune.
@@ -46,6 +52,12 @@ type PruneRunner func(ctx context.Context, retentionOptions string) error
 // Returns the exit code and any error.
 type CommandRunner func(ctx context.Context, name string, args ...string) (exitCode int, err error)
 
+// OutputRunner is a function type for running restic commands whose output
+// is read, such as restic snapshots --json.
+// This allows for testing without actually running restic.
+// Returns restic's standard output.
+type OutputRunner func(ctx context.Context, args ...string) ([]byte, error)
+
 // VCDBTreeSplitter is a function type for splitting a .vcdbs file into vcdbtree format.
 // This allows for testing without actually running the split operation.
 // srcPath is the source .vcdbs file, dstDir is the destination directory.
@@ -64,6 +76,20 @@ type PlayerCheckerInterface interface {
 // ErrNoPlayersOnline is returned when a backup is skipped because no players are online.
 var ErrNoPlayersOnline = fmt.Errorf("no players online, backup skipped")
 
+// AutosaveChecker is an interface for checking whether the game server is
+// currently running its own autosave. This allows for testing without a real tracker.
+type AutosaveChecker interface {
+	// AutosaveInProgress returns true while the server is autosaving.
+	AutosaveInProgress() bool
+}
+
+// ProcessPauser is an interface for suspending and resuming the server process.
+// This is satisfied by *server.Server.
+type ProcessPauser interface {
+	Pause() error
+	Resume() error
+}
+
 // BackupCompletionWaiter is an interface for waiting for the server to signal backup completion.
 // The server sends "[Server Notification] Backup complete!" when the backup is finished.
 type BackupCompletionWaiter interface {
@@ -80,14 +106,25 @@ type Manager struct {
 	// Interval is the time between backups.
 	Interval time.Duration
 
+	// FixedRate schedules each backup Interval after the previous one
+	// started rather than after it finished. Slots missed while a backup
+	// overran are skipped, so backups never run back to back.
+	FixedRate bool
+
 	// GameDataDir is the path to the game data directory (e.g., /gamedata).
 	GameDataDir string
 
 	// StagingDir is the path to the persistent staging directory.
 	// This directory persists between backups to optimize for Restic efficiency.
-	// If empty, defaults to /backupcache/staging.
+	// If empty, defaults to /backupcache/staging, or worlds/<World> in
+	// CacheDir if World is set.
 	StagingDir string
 
+	// StagingStrategy selects how backups update StagingDir: one of the
+	// Staging constants. Empty means StagingInPlace. Validate it with
+	// ParseStagingStrategy.
+	StagingStrategy string
+
 	// Server is the Vintage Story server to send backup commands to.
 	Server ServerCommander
 
@@ -108,6 +145,69 @@ type Manager struct {
 	// message before attempting to split the backup file into vcdbtree format.
 	BackupCompletionWaiter BackupCompletionWaiter
 
+	// AutosaveChecker is used to check if the server is autosaving.
+	// If set, /genbackup is delayed until the autosave finishes (or AutosaveMaxWait elapses).
+	AutosaveChecker AutosaveChecker
+
+	// AutosaveMaxWait is the maximum time to delay a backup for an in-progress autosave.
+	// Defaults to 2 minutes if not set.
+	AutosaveMaxWait time.Duration
+
+	// ProcessPauser is used to suspend the server while live files (logs, player
+	// files, mods, configs) are copied into staging, giving a consistent snapshot.
+	// If nil, files are copied while the server keeps running.
+	ProcessPauser ProcessPauser
+
+	// MaxServerPause is the maximum time the server may be suspended. The server
+	// is resumed automatically once this elapses, even if copying hasn't finished.
+	// Defaults to 30 seconds if not set.
+	MaxServerPause time.Duration
+
+	// SkipTreeDigest leaves the world tree's vcdbtree.Digest out of each
+	// snapshot's metadata, saving a read of the whole tree per backup.
+	// Restores then can't check the tree came back intact.
+	SkipTreeDigest bool
+
+	// CompressLogs stores rotated logs gzip-compressed in the staging
+	// directory, with a ".gz" suffix. The live logs at the top of Logs are
+	// copied as-is.
+	CompressLogs bool
+
+	// SyncWorkers is how many files are copied at once when syncing Logs,
+	// Playerdata, and Mods into staging. Defaults to GOMAXPROCS if not set.
+	SyncWorkers int
+
+	// WriteRateLimit is the most bytes per second written while splitting
+	// savegames into the staging tree and syncing live files into it, so
+	// the write burst doesn't lag a server on slow or shared storage. Zero
+	// means unlimited.
+	WriteRateLimit int64
+
+	// WriteSyncBytes flushes the files written to staging to disk each time
+	// this many bytes have been written, instead of leaving the system to
+	// write them back in one large burst. Zero leaves it to the system.
+	WriteSyncBytes int64
+
+	// ResticIOPriority runs restic backup, forget, and check under ionice
+	// with this I/O scheduling class, "idle" or "best-effort[:<0-7>]".
+	// Validate it with ParseIOPriority. If empty, restic runs with the
+	// launcher's priority.
+	ResticIOPriority string
+
+	// SyncPolicies sets how each of SyncedDirs is synced into staging, by
+	// name. Directories without a policy have their files compared by
+	// content.
+	SyncPolicies map[string]SyncPolicy
+
+	// OnStateChange is called with the new state whenever State changes,
+	// including each stage of a backup. Optional.
+	OnStateChange func(ManagerState)
+
+	// Clock is the source of time for scheduling backups and maintenance,
+	// backup windows, and waits within a backup. Defaults to clock.Real.
+	// This is primarily for testing.
+	Clock clock.Clock
+
 	// OnBackupStart is called when a backup starts. Optional.
 	OnBackupStart func()
 
@@ -115,10 +215,54 @@ type Manager struct {
 	// The error parameter is nil on success.
 	OnBackupComplete func(err error, duration time.Duration)
 
+	// SplitProgressInterval is how often the progress of a long split into
+	// the staging tree is logged. Defaults to DefaultSplitProgressInterval.
+	SplitProgressInterval time.Duration
+
+	// FailureReportInterval is how often a backup failure that keeps
+	// repeating is reported. Repeats in between are passed to
+	// OnBackupComplete as a suppressed RepeatedFailureError, and the failure
+	// hook doesn't run for them.
+	// Defaults to DefaultFailureReportInterval if not set.
+	FailureReportInterval time.Duration
+
+	// OnBackupStats is called after each successful backup with statistics
+	// about what changed since the previous one. Optional; the stats are
+	// always logged.
+	OnBackupStats func(stats BackupStats)
+
+	// StatsTopRegions is how many of the busiest map regions are reported
+	// in BackupStats. Defaults to 5 if not set.
+	StatsTopRegions int
+
 	// BackupTimeout is the maximum time to wait for a backup file to appear.
 	// Defaults to 5 minutes if not set.
 	BackupTimeout time.Duration
 
+	// StageTimeouts overrides the timeouts of the stages of a backup, from
+	// DefaultStageTimeouts and, for StageGenBackup, BackupTimeout. A zero
+	// timeout removes the limit. A stage that runs out of time fails the
+	// backup with a StageTimeoutError.
+	StageTimeouts map[Stage]time.Duration
+
+	// GenBackupCommand is the server command that writes a backup copy of
+	// the savegame. Defaults to DefaultGenBackupCommand if empty.
+	GenBackupCommand string
+
+	// BackupsDir is the directory the server writes backup copies to,
+	// relative to GameDataDir unless absolute. Defaults to DefaultBackupsDir.
+	BackupsDir string
+
+	// BackupFilePattern matches the file names of backup copies in
+	// BackupsDir, as understood by filepath.Match. Defaults to
+	// DefaultBackupFilePattern. Validate it with ParseBackupFilePattern.
+	BackupFilePattern string
+
+	// BackupsWatcher reports backup copies written to the backups directory.
+	// If nil, a BackupsWatcher on BackupsDir matching BackupFilePattern is
+	// used. This is primarily for testing.
+	BackupsWatcher BackupFileWatcher
+
 	// ResticRunner is a custom function to run restic backup.
 	// If nil, the default restic backup command is used.
 	// This is primarily for testing.
@@ -129,11 +273,32 @@ type Manager struct {
 	// This is primarily for testing.
 	PruneRunner PruneRunner
 
+	// CheckRunner is a custom function to run restic check.
+	// If nil, the default restic check command is used.
+	// This is primarily for testing.
+	CheckRunner CheckRunner
+
+	// ChangeDetection selects how restic decides which staged files to read
+	// again: one of the ChangeDetection constants. Empty means
+	// ChangeDetectionMtime. Validate it with ParseChangeDetection.
+	ChangeDetection string
+
+	// ResticEnv is the environment restic is run with, as "KEY=value" pairs.
+	// If nil, restic gets the launcher's environment filtered by
+	// ResticEnviron, so unrelated settings and credentials stay out of it.
+	ResticEnv []string
+
 	// CommandRunner is a custom function to run shell commands.
 	// If nil, the default exec.Command is used.
 	// This is primarily for testing.
 	CommandRunner CommandRunner
 
+	// OutputRunner is a custom function to run restic commands whose output
+	// is read.
+	// If nil, restic is run directly.
+	// This is primarily for testing.
+	OutputRunner OutputRunner
+
 	// VCDBTreeSplitter is a custom function to split .vcdbs into vcdbtree format.
 	// If nil, the default vcdbtree.Split is used.
 	// This is primarily for testing.
@@ -144,14 +309,246 @@ type Manager struct {
 	// Example: "--keep-daily 7 --keep-weekly 4 --keep-monthly 12"
 	PruneRetention string
 
+	// PruneGroupBy is passed to restic forget as --group-by, e.g. "host,paths".
+	// If empty, restic's default grouping is used.
+	PruneGroupBy string
+
+	// ResticHost is the host name recorded in snapshots and used to select
+	// them for forget. If empty, World or else the save file name is used.
+	ResticHost string
+
+	// World names this server's world, for repositories shared by several
+	// servers. If set, snapshots are tagged WorldTag+World, forget and
+	// rollbacks only select snapshots with that tag, and the staging
+	// directory defaults to one of the world's own, so snapshot paths don't
+	// collide either. Validate it with ParseWorldName.
+	World string
+
+	// BackupWindow is a daily time window for full backups, which have
+	// restic reread every staged file (restic backup --force). The first
+	// backup inside each occurrence of the window is a full one; all other
+	// backups stay incremental and keep to Interval. If nil, or if
+	// ChangeDetection is already ChangeDetectionRescan, no extra full backups
+	// are taken.
+	BackupWindow *TimeWindow
+
+	// Hooks configures executables run before and after each backup.
+	Hooks Hooks
+
+	// Announcements configures which backup outcomes are announced in the
+	// game chat. The zero value announces nothing.
+	Announcements Announcements
+
+	// GameVersion reports the running server's game version, which is
+	// recorded in each snapshot. Optional.
+	GameVersion GameVersionReporter
+
+	// ServerBinaries describes the downloaded server archive, which is
+	// recorded in each snapshot. Optional. Once the manager is started,
+	// change it with SetServerBinaries.
+	ServerBinaries ServerBinaries
+
+	// ResticVersion is the version of the restic binary, from DetectRestic.
+	// It selects how restic's exit codes are interpreted. If zero, a current
+	// release is assumed.
+	ResticVersion ResticVersion
+
+	// PruneWindow restricts prunes and restic checks to a daily time window.
+	// Inside the window, the first backup prunes and later ones in the same
+	// window don't, and a check that is due runs. If nil, every backup
+	// prunes, and checks run whenever they are due.
+	PruneWindow *TimeWindow
+
+	// CheckInterval is how often restic check runs after a backup. The first
+	// backup after startup, inside PruneWindow if set, always checks. If
+	// zero, restic check never runs.
+	CheckInterval time.Duration
+
+	// MaintenanceMaxDefer holds off prunes and checks while players are
+	// online, according to a PlayerChecker that implements PlayerCounter, for
+	// at most this long before running them anyway. If zero, they run
+	// regardless of players.
+	MaintenanceMaxDefer time.Duration
+
+	// TrimAreas restricts the backed-up world to these areas. If set, chunks,
+	// mapchunks, and mapregions outside all areas are left out of the staging
+	// tree. The live world is never modified.
+	TrimAreas []vcdbtree.Area
+
+	// WorldWidth is the world width in blocks. Map chunk and map region
+	// positions can only be decoded knowing it, for sharding the staging tree
+	// and for TrimAreas. Defaults to vcdbtree.DefaultMapSizeX.
+	WorldWidth int64
+
+	// TreeLayout is the vcdbtree layout of the staging tree. Changing it
+	// moves existing files rather than rewriting them. If nil, the layout the
+	// tree already has is kept, geographic for a new tree.
+	TreeLayout *vcdbtree.Layout
+
+	// Restarter stops and restarts the server for Compact. Optional; Compact
+	// fails with ErrRestarterRequired if not set.
+	Restarter ServerRestarter
+
+	// LastBackupFile is where the time of the last successful backup is
+	// persisted, so missed backups can be caught up after downtime.
+	// If empty, nothing is persisted.
+	LastBackupFile string
+
+	// CompactDir is the work directory used by Compact.
+	// If empty, defaults to the compact directory in CacheDir.
+	CompactDir string
+
+	// RollbackDir is the work directory used by PrepareRollback, where the
+	// state of a rollback in progress is kept. If empty, defaults to
+	// the rollback directory in CacheDir.
+	RollbackDir string
+
+	// QuarantineDir is where CheckStaging moves staged trees it can't
+	// repair. If empty, defaults to the quarantine directory in CacheDir.
+	QuarantineDir string
+
+	// LocalKeepVCDBS is how many processed .vcdbs backup files to keep in
+	// LocalDir as quick-restore copies, newest first. If zero, each backup
+	// file is removed once it has been split.
+	LocalKeepVCDBS int
+
+	// LocalDir is where local copies are kept.
+	// If empty, defaults to the local directory in CacheDir.
+	LocalDir string
+
+	// RawUploader, if set, receives a copy of each raw .vcdbs backup file
+	// before it is split, e.g. for object storage. Optional.
+	RawUploader RawBackupUploader
+
+	// ModsInterval, if set, backs up the Mods directory as a separate
+	// snapshot set (tagged SnapshotSetTag+SnapshotSetMods) at most this often,
+	// while everything else is snapshotted on every backup as
+	// SnapshotSetWorld. If zero, each backup is one snapshot of the whole
+	// staging directory.
+	ModsInterval time.Duration
+
+	// RetryBackoff is how long a backup that failed transiently (see
+	// IsTransient) waits before each retry, within the same cycle. Only the
+	// final outcome is reported. If nil, DefaultRetryBackoff is used; an
+	// empty slice disables retries.
+	RetryBackoff []time.Duration
+
+	// DriftInterval is how often MeasureDrift compares the live save with
+	// the last backup while the manager runs. If zero, drift is only
+	// measured when MeasureDrift is called.
+	DriftInterval time.Duration
+
+	// CacheDir is the cache volume CleanCache audits for entries the
+	// current configuration no longer uses. If empty, defaults to
+	// DefaultCacheDir.
+	CacheDir string
+
+	// CacheCleanupInterval is how often CleanCache runs while the manager
+	// runs. If zero, the cache is only cleaned when CleanCache is called.
+	CacheCleanupInterval time.Duration
+
+	// CacheGracePeriod is how long an unused cache entry must go unmodified
+	// before CleanCache removes it. If zero, defaults to
+	// DefaultCacheGracePeriod.
+	CacheGracePeriod time.Duration
+
+	// IntegrityTolerance is how far the file and byte counts restic reports
+	// for a snapshot may differ from the staging tree's, as a fraction,
+	// before a warning is logged. If zero, DefaultIntegrityTolerance is
+	// used; a negative tolerance disables the check.
+	IntegrityTolerance float64
+
+	// HighChangeThreshold is the fraction of the staged world's files a
+	// split must rewrite to count as a high change, which is logged and
+	// runs the HighChange hook. After highChangeRuns of them in a row, the
+	// next split rewrites the tree in bulk instead of comparing each file.
+	// If zero, DefaultHighChangeThreshold is used; a negative threshold
+	// disables high change handling.
+	HighChangeThreshold float64
+
+	// StagingPopulators add files of their own to the staging directory
+	// before each snapshot, in order. Optional.
+	StagingPopulators []StagingPopulator
+
+	// CoverageIgnore lists top-level entries of GameDataDir that are known
+	// not to need backing up, so UncoveredPaths doesn't report them.
+	CoverageIgnore []string
+
 	done   chan struct{}
 	wg     sync.WaitGroup
 	cancel context.CancelFunc
 	mu     sync.Mutex
+
+	// opMu serializes backups, compaction, and rollbacks so they never overlap.
+	opMu sync.Mutex
+
+	// rollbackMu serializes rollback operations. It is taken before opMu.
+	rollbackMu sync.Mutex
+
+	// lastPrune and lastCheck are when the last successful prune and check
+	// finished; pruneDeferredSince and checkDeferredSince are when a pending
+	// one was first deferred for players. Guarded by opMu.
+	lastPrune          time.Time
+	lastCheck          time.Time
+	pruneDeferredSince time.Time
+	checkDeferredSince time.Time
+
+	// lastFullBackup is when the last full backup for BackupWindow
+	// succeeded. Guarded by opMu.
+	lastFullBackup time.Time
+
+	// lastModsSnapshot is when the Mods set was last backed up. Guarded by
+	// opMu.
+	lastModsSnapshot time.Time
+
+	// splitHistory holds the last compared splits, oldest first, and
+	// lastSplitBulk whether the last split was a bulk one. Guarded by opMu.
+	splitHistory  []splitRun
+	lastSplitBulk bool
+
+	// stagingWork counts what the current or last staging update did with
+	// each synced directory and world table. Guarded by opMu.
+	stagingWork StagingWork
+
+	// generation is the staging generation being built, which staging
+	// updates write to instead of StagingDir. Guarded by opMu.
+	generation string
+
+	// lastUncovered is what reportCoverage last reported. Guarded by opMu.
+	lastUncovered []string
+
+	// failures tracks repeats of the last backup error. Guarded by opMu.
+	failures failureTracker
+
+	// cacheNoticed holds the unused cache entries CleanCache has already
+	// logged. Guarded by opMu.
+	cacheNoticed map[string]bool
+
+	// writeThrottle paces staging writes; see throttle.
+	throttleOnce  sync.Once
+	writeThrottle *vcdbtree.Throttle
+
+	// settingsMu guards Interval, PauseWhenNoPlayers, and PruneRetention,
+	// which can be changed while the manager runs. intervalChanged wakes
+	// the backup loop when Interval changes.
+	settingsMu      sync.Mutex
+	intervalChanged chan struct{}
+
+	// state is guarded by stateMu so State never blocks on a backup.
+	stateMu sync.Mutex
+	state   ManagerState
+
+	// status and lastSkipSummary are guarded by statusMu, not opMu, so
+	// Status doesn't block while a backup is running.
+	statusMu        sync.Mutex
+	status          Status
+	lastSkipSummary time.Time
 }
 
-// serverConfig represents the structure of serverconfig.json for extracting save file location.
+// serverConfig represents the parts of serverconfig.json the launcher reads:
+// the save file location and the player limit.
 type serverConfig struct {
+	MaxClients  int `json:"MaxClients"`
 	WorldConfig struct {
 		SaveFileLocation string `json:"SaveFileLocation"`
 	} `json:"WorldConfig"`
@@ -167,7 +564,7 @@ func (m *Manager) Start(ctx context.Context) error {
 		return fmt.Errorf("backup manager already started")
 	}
 
-	if m.Interval <= 0 {
+	if m.interval() <= 0 {
 		return fmt.Errorf("backup interval must be positive")
 	}
 
@@ -175,13 +572,7 @@ func (m *Manager) Start(ctx context.Context) error {
 		return fmt.Errorf("server is required")
 	}
 
-	if m.GameDataDir == "" {
-		m.GameDataDir = "/gamedata"
-	}
-
-	if m.StagingDir == "" {
-		m.StagingDir = "/backupcache/staging"
-	}
+	m.applyPathDefaults()
 
 	if m.BackupTimeout <= 0 {
 		m.BackupTimeout = 5 * time.Minute
@@ -193,6 +584,16 @@ func (m *Manager) Start(ctx context.Context) error {
 	m.wg.Add(1)
 	go m.runLoop(ctx)
 
+	if m.DriftInterval > 0 {
+		m.wg.Add(1)
+		go m.runDriftLoop(ctx)
+	}
+
+	if m.CacheCleanupInterval > 0 {
+		m.wg.Add(1)
+		go m.runCacheCleanupLoop(ctx)
+	}
+
 	return nil
 }
 
@@ -225,37 +626,83 @@ func (m *Manager) runLoop(ctx context.Context) {
 	defer m.wg.Done()
 	defer close(m.done)
 
-	ticker := time.NewTicker(m.Interval)
+	if m.FixedRate {
+		m.runFixedRateLoop(ctx)
+		return
+	}
+
+	ticker := m.clock().NewTicker(m.interval())
 	defer ticker.Stop()
+	intervalChanged := m.intervalChanges()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-intervalChanged:
+			ticker.Reset(m.interval())
+		case <-ticker.C():
 			m.runBackup(ctx)
 		}
 	}
 }
 
+// clock returns Clock, or the real clock if not set.
+func (m *Manager) clock() clock.Clock {
+	return clock.Or(m.Clock)
+}
+
 // runBackup performs a single backup operation.
 func (m *Manager) runBackup(ctx context.Context) {
-	startTime := time.Now()
+	startTime := m.clock().Now()
 
 	if m.OnBackupStart != nil {
 		m.OnBackupStart()
 	}
 
 	err := m.performBackup(ctx, false) // Normal periodic backups respect player check
+	m.recordAttempt(err, m.clock().Now())
 
 	if m.OnBackupComplete != nil {
-		m.OnBackupComplete(err, time.Since(startTime))
+		m.OnBackupComplete(err, m.clock().Now().Sub(startTime))
 	}
 }
 
-// performBackup executes the full backup workflow.
-// skipPlayerCheck, if true, bypasses the player check and always runs the backup.
+// performBackup executes the full backup workflow, retrying transient
+// failures as RetryBackoff says. skipPlayerCheck, if true, bypasses the
+// player check and always runs the backup.
 func (m *Manager) performBackup(ctx context.Context, skipPlayerCheck bool) error {
+	backoff := m.retryBackoff()
+	start := m.clock().Now()
+	for attempt := 0; ; attempt++ {
+		err := m.attemptBackup(ctx, skipPlayerCheck, start, attempt < len(backoff))
+		var retry *retryError
+		if !errors.As(err, &retry) {
+			return err
+		}
+
+		delay := backoff[attempt]
+		fmt.Printf("Backup failed with a transient error (attempt %d of %d), retrying in %v: %v\n",
+			attempt+1, len(backoff)+1, delay, retry.err)
+		m.setState(StateRetrying, "", retry.err)
+		select {
+		case <-ctx.Done():
+			return retry.err
+		case <-m.clock().After(delay):
+		}
+
+		// The backup was due; players leaving meanwhile doesn't cancel it
+		skipPlayerCheck = true
+	}
+}
+
+// attemptBackup makes one attempt at the backup performBackup started at
+// start. If canRetry, a transient failure is returned as a retryError
+// without being reported, for performBackup to try again.
+func (m *Manager) attemptBackup(ctx context.Context, skipPlayerCheck bool, start time.Time, canRetry bool) error {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+
 	// Step 0a: Check if server has booted (if BootChecker is configured)
 	if m.BootChecker != nil && !m.BootChecker.HasBooted() {
 		return ErrServerNotBooted
@@ -265,58 +712,145 @@ func (m *Manager) performBackup(ctx context.Context, skipPlayerCheck bool) error
 	// ShouldBackup() returns true if players are online, OR if players
 	// were online previously but have now all logged off (final backup).
 	// Skip this check if skipPlayerCheck is true (e.g., for boot-time backups).
-	if !skipPlayerCheck && m.PauseWhenNoPlayers && m.PlayerChecker != nil {
+	if !skipPlayerCheck && m.pauseWhenNoPlayers() && m.PlayerChecker != nil {
 		if !m.PlayerChecker.ShouldBackup() {
 			return ErrNoPlayersOnline
 		}
 	}
 
+	m.setStage(StagePreBackupHook)
+	stats, err := m.backupToRestic(ctx)
+	if err != nil && canRetry && ctx.Err() == nil && IsTransient(err) {
+		return &retryError{err}
+	}
+	if err == nil {
+		if err := m.recordSuccessfulBackup(m.clock().Now()); err != nil {
+			fmt.Printf("Warning: failed to record backup time: %v\n", err)
+		}
+	}
+	if ctx.Err() == nil {
+		err = m.throttleFailure(err, m.clock().Now())
+		if !IsSuppressedFailure(err) {
+			m.setStage(StagePostBackupHook)
+			duration := m.clock().Now().Sub(start)
+			m.Hooks.runAfterBackup(ctx, stats.SnapshotID, duration, err)
+			m.announce(stats, duration, err)
+		}
+	}
+	return err
+}
+
+// backupToRestic runs the backup itself once performBackup has decided it
+// should happen. Returns the statistics of the backup.
+func (m *Manager) backupToRestic(ctx context.Context) (BackupStats, error) {
+	// Step 0c: Give the pre-backup hook a chance to veto the backup
+	if err := m.Hooks.runPreBackup(ctx); err != nil {
+		return BackupStats{}, err
+	}
+
 	// Step 1: Get the save file name from serverconfig.json
 	saveFileName, err := m.getSaveFileName()
 	if err != nil {
-		return fmt.Errorf("failed to get save file name: %w", err)
+		return BackupStats{}, fmt.Errorf("failed to get save file name: %w", err)
+	}
+
+	// Step 1b: Don't overlap /genbackup with the game's own autosave
+	m.setStage(StageWaitingForAutosave)
+	if err := m.waitForAutosave(ctx); err != nil {
+		return BackupStats{}, fmt.Errorf("failed waiting for autosave to finish: %w", err)
 	}
+	stageCtx, cancel := m.beginStage(ctx, StageGenBackup)
 
-	// Step 2: Record the current time before sending genbackup
-	beforeGenbackup := time.Now()
+	// Step 2: List the backup copies already there before sending genbackup
+	existingBackups, err := m.existingBackupFiles()
+	if err != nil {
+		cancel()
+		return BackupStats{}, err
+	}
 
 	// Step 3: Send /genbackup command to the server
-	if err := m.Server.SendCommand("/genbackup"); err != nil {
-		return fmt.Errorf("failed to send genbackup command: %w", err)
+	if err := m.Server.SendCommand(m.genBackupCommand()); err != nil {
+		cancel()
+		return BackupStats{}, fmt.Errorf("failed to send genbackup command: %w", err)
 	}
 
 	// Step 4: Wait for new backup file to appear
-	backupCtx, cancel := context.WithTimeout(ctx, m.BackupTimeout)
-	defer cancel()
-
-	backupFile, err := m.waitForBackupFile(backupCtx, beforeGenbackup)
+	backupFile, err := m.waitForBackupFile(stageCtx, existingBackups)
+	cancel()
 	if err != nil {
-		return fmt.Errorf("failed to wait for backup file: %w", err)
+		return BackupStats{}, fmt.Errorf("failed to wait for backup file: %w", stageError(stageCtx, err))
 	}
 
+	// Step 4b: Upload the raw backup file, if configured
+	m.uploadBackupFile(ctx, backupFile, saveFileName, m.clock().Now())
+
 	// Step 5: Update persistent staging directory with changed files only
-	if err := m.updateStagingDirectory(backupFile, saveFileName); err != nil {
-		return fmt.Errorf("failed to update staging directory: %w", err)
+	stageCtx, cancel = m.beginStage(ctx, StageStaging)
+	churn := &churnTracker{}
+	written, skipped, err := m.updateStagingDirectory(stageCtx, backupFile, saveFileName, churn)
+	cancel()
+	if err != nil {
+		return BackupStats{}, fmt.Errorf("failed to update staging directory: %w", stageError(stageCtx, err))
 	}
 
+	// Step 5b: Point out game data that the staging tree doesn't include
+	m.reportCoverage()
+
 	// Step 6: Run restic backup on the staging directory
-	if err := m.runRestic(ctx); err != nil {
-		return fmt.Errorf("failed to run restic backup: %w", err)
+	stageCtx, cancel = m.beginStage(ctx, StageResticBackup)
+	full := m.fullBackupDue()
+	var extra []string
+	if full {
+		fmt.Printf("Taking the full backup of backup window %s; restic rereads every staged file\n", m.BackupWindow)
+		extra = []string{"--force"}
+	}
+	summary, err := m.runResticArgs(stageCtx, extra)
+	cancel()
+	if err != nil {
+		return BackupStats{}, fmt.Errorf("failed to run restic backup: %w", stageError(stageCtx, err))
 	}
+	if full {
+		m.lastFullBackup = m.clock().Now()
+	}
+
+	stats := m.reportStats(written, skipped, churn, summary)
 
 	// Step 7: Run restic forget --prune if retention is configured
-	if err := m.runResticPrune(ctx); err != nil {
-		return fmt.Errorf("failed to run restic prune: %w", err)
+	stageCtx, cancel = m.beginStage(ctx, StagePrune)
+	err = m.runResticPrune(stageCtx)
+	cancel()
+	if err != nil {
+		return BackupStats{}, fmt.Errorf("failed to run restic prune: %w", stageError(stageCtx, err))
+	}
+
+	// Step 8: Run restic check if it's due
+	stageCtx, cancel = m.beginStage(ctx, StageCheck)
+	err = m.runResticCheck(stageCtx)
+	cancel()
+	if err != nil {
+		return BackupStats{}, fmt.Errorf("failed to run restic check: %w", stageError(stageCtx, err))
 	}
 
 	// Note: The staging directory is persistent and not cleaned up after backup.
 	// This preserves file metadata for unchanged files, optimizing Restic efficiency.
 
-	return nil
+	return stats, nil
 }
 
 // getSaveFileName reads serverconfig.json and extracts the save file name.
 func (m *Manager) getSaveFileName() (string, error) {
+	location, err := m.getSaveFileLocation()
+	if err != nil {
+		return "", err
+	}
+
+	// Extract just the filename from the path
+	return filepath.Base(location), nil
+}
+
+// getSaveFileLocation reads serverconfig.json and returns the configured save
+// file location, falling back to "default.vcdbs" if none is set.
+func (m *Manager) getSaveFileLocation() (string, error) {
 	configPath := filepath.Join(m.GameDataDir, "serverconfig.json")
 	data, err := os.ReadFile(configPath)
 	if err != nil {
@@ -333,14 +867,82 @@ func (m *Manager) getSaveFileName() (string, error) {
 		return "default.vcdbs", nil // fallback
 	}
 
-	// Extract just the filename from the path
-	return filepath.Base(saveLocation), nil
+	return saveLocation, nil
+}
+
+// autosaveMaxWait returns AutosaveMaxWait, or its default if not set.
+func (m *Manager) autosaveMaxWait() time.Duration {
+	if m.AutosaveMaxWait > 0 {
+		return m.AutosaveMaxWait
+	}
+	return 2 * time.Minute
+}
+
+// waitForAutosave blocks while the server is autosaving, up to AutosaveMaxWait.
+// If the autosave is still running when the wait expires, the backup proceeds anyway.
+func (m *Manager) waitForAutosave(ctx context.Context) error {
+	if m.AutosaveChecker == nil || !m.AutosaveChecker.AutosaveInProgress() {
+		return nil
+	}
+
+	fmt.Println("Server autosave in progress, delaying backup...")
+
+	deadline := m.clock().After(m.autosaveMaxWait())
+
+	ticker := m.clock().NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			fmt.Printf("Autosave still in progress after %v, proceeding with backup\n", m.autosaveMaxWait())
+			return nil
+		case <-ticker.C():
+			if !m.AutosaveChecker.AutosaveInProgress() {
+				return nil
+			}
+		}
+	}
 }
 
-// waitForBackupFile waits for a new .vcdbs file to appear in the Backups directory.
+// existingBackupFiles lists the backup copies in the backups directory, so
+// waitForBackupFile can tell the one /genbackup writes next from them.
+func (m *Manager) existingBackupFiles() (map[string]backupFileStamp, error) {
+	dir := m.backupsDir()
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups directory: %w", err)
+	}
+
+	existing := make(map[string]backupFileStamp, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !m.isBackupFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed since it was listed
+		}
+		existing[filepath.Join(dir, entry.Name())] = backupFileStamp{ModTime: info.ModTime(), Size: info.Size()}
+	}
+	return existing, nil
+}
+
+// waitForBackupFile waits for a new backup copy matching BackupFilePattern to
+// appear in the backups directory.
 // It first waits for the server to send the "[Server Notification] Backup complete!" message
 // (if BackupCompletionWaiter is configured), then waits for the file to appear and be unlocked.
-func (m *Manager) waitForBackupFile(ctx context.Context, afterTime time.Time) (string, error) {
+//
+// A file is new if it isn't in existing, as listed by existingBackupFiles
+// before /genbackup was sent, or its modification time or size has changed
+// since. Comparing against the wall clock instead would miss files or pick
+// up stale ones when the clock is stepped or mtimes are coarse.
+func (m *Manager) waitForBackupFile(ctx context.Context, existing map[string]backupFileStamp) (string, error) {
 	// First, wait for the server to signal that the backup is complete.
 	// This ensures we don't try to access the file while the server is still writing to it.
 	if m.BackupCompletionWaiter != nil {
@@ -349,55 +951,59 @@ func (m *Manager) waitForBackupFile(ctx context.Context, afterTime time.Time) (s
 		}
 	}
 
-	backupsDir := filepath.Join(m.GameDataDir, "Backups")
-
-	// Ensure the backups directory exists
-	if err := os.MkdirAll(backupsDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create backups directory: %w", err)
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+	events, err := m.backupsWatcher().Watch(watchCtx)
+	if err != nil {
+		return "", err
 	}
 
-	ticker := time.NewTicker(500 * time.Millisecond)
+	// Files still locked by the server are checked again until they aren't;
+	// unlocking a file doesn't produce an event
+	var locked []string
+	ticker := m.clock().NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return "", ctx.Err()
-		case <-ticker.C:
-			entries, err := os.ReadDir(backupsDir)
-			if err != nil {
-				continue // Directory might not exist yet
-			}
-
-			for _, entry := range entries {
-				if entry.IsDir() {
-					continue
-				}
-
-				if !strings.HasSuffix(entry.Name(), ".vcdbs") {
-					continue
-				}
-
-				info, err := entry.Info()
-				if err != nil {
-					continue
+		case event, ok := <-events:
+			if !ok {
+				if err := ctx.Err(); err != nil {
+					return "", err
 				}
-
-				// Check if the file was created after we sent /genbackup
-				if info.ModTime().After(afterTime) {
-					filePath := filepath.Join(backupsDir, entry.Name())
-
-					// Wait until the file is ready (no write locks held by other processes)
-					if m.isFileUnlocked(filePath) {
-						return filePath, nil
-					}
-					// File exists but is still being written to, continue waiting
+				return "", fmt.Errorf("stopped watching %s", m.backupsDir())
+			}
+			// Only files written after we sent /genbackup are new
+			if stamp, ok := existing[event.Path]; ok && stamp.equal(event.stamp()) {
+				continue
+			}
+			if m.isFileUnlocked(event.Path) {
+				return event.Path, nil
+			}
+			if !slices.Contains(locked, event.Path) {
+				locked = append(locked, event.Path)
+			}
+		case <-ticker.C():
+			for _, path := range locked {
+				if m.isFileUnlocked(path) {
+					return path, nil
 				}
 			}
 		}
 	}
 }
 
+// backupsWatcher returns BackupsWatcher, or a BackupsWatcher on the backups
+// directory if not set.
+func (m *Manager) backupsWatcher() BackupFileWatcher {
+	if m.BackupsWatcher != nil {
+		return m.BackupsWatcher
+	}
+	return &BackupsWatcher{Dir: m.backupsDir(), Match: m.isBackupFile}
+}
+
 // isFileUnlocked checks if a file can be safely read by verifying no write locks are held on it.
 // Returns true if the file can be exclusively locked (meaning no other process has it locked).
 func (m *Manager) isFileUnlocked(path string) bool {
@@ -409,72 +1015,193 @@ func (m *Manager) isFileUnlocked(path string) bool {
 
 	// Try to acquire an exclusive lock non-blocking.
 	// If successful, no other process holds a lock on this file.
-	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
-	if err != nil {
+	if err := filelock.TryLock(file); err != nil {
 		return false // File is locked by another process
 	}
 
 	// Release the lock immediately
-	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	filelock.Unlock(file)
 	return true
 }
 
 // updateStagingDirectory updates the persistent staging directory with changed files only.
 // The savegame is converted to vcdbtree format (a directory tree optimized for deduplication).
 // Files that haven't changed preserve their metadata (mtime), optimizing Restic efficiency.
-func (m *Manager) updateStagingDirectory(backupFile, saveFileName string) error {
-	// Ensure the staging directory exists
-	if err := os.MkdirAll(m.StagingDir, 0755); err != nil {
-		return fmt.Errorf("failed to create staging directory: %w", err)
+// Changed chunks are recorded in churn. Returns the number of vcdbtree files
+// written and skipped. With StagingGenerations, the update is built in a new
+// generation of the staging directory; see stageGeneration.
+func (m *Manager) updateStagingDirectory(ctx context.Context, backupFile, saveFileName string, churn *churnTracker) (written, skipped int, err error) {
+	stage := m.stageBackup
+	if m.StagingStrategy == StagingGenerations {
+		stage = m.stageGeneration
+	}
+	written, skipped, err = stage(ctx, backupFile, saveFileName, churn)
+	if err != nil {
+		return 0, 0, err
 	}
 
-	// Sync directories: Logs, Playerdata, Mods
-	// Only changed files are written, preserving metadata for unchanged files
-	dirsToSync := []string{"Logs", "Playerdata", "Mods"}
-	for _, dir := range dirsToSync {
-		srcDir := filepath.Join(m.GameDataDir, dir)
-		dstDir := filepath.Join(m.StagingDir, dir)
+	// The original backup file has been processed; keep it locally or remove it
+	if err := m.disposeBackupFile(backupFile); err != nil {
+		return 0, 0, err
+	}
 
-		if _, err := os.Stat(srcDir); err == nil {
-			if _, _, _, err := vcdbtree.SyncDir(srcDir, dstDir); err != nil {
-				return fmt.Errorf("failed to sync %s: %w", dir, err)
-			}
-		} else if !os.IsNotExist(err) {
-			return fmt.Errorf("failed to stat %s: %w", dir, err)
-		}
+	return written, skipped, nil
+}
+
+// stageBackup stages backupFile and the live files in stagingTarget, under
+// the staging journal.
+func (m *Manager) stageBackup(ctx context.Context, backupFile, saveFileName string, churn *churnTracker) (written, skipped int, err error) {
+	m.stagingWork = StagingWork{}
+
+	// Ensure the staging directory exists
+	if err := os.MkdirAll(m.stagingTarget(), 0755); err != nil {
+		return 0, 0, fmt.Errorf("failed to create staging directory: %w", err)
 	}
 
-	// Sync config files
-	configFiles := []string{"serverconfig.json", "servermagicnumbers.json"}
-	for _, file := range configFiles {
-		srcFile := filepath.Join(m.GameDataDir, file)
-		dstFile := filepath.Join(m.StagingDir, file)
+	// Journal the update so an interrupted one is never snapshotted
+	if err := m.beginStagingUpdate(backupFile); err != nil {
+		return 0, 0, err
+	}
 
-		if _, _, err := vcdbtree.SyncFile(srcFile, dstFile); err != nil {
-			return fmt.Errorf("failed to sync %s: %w", file, err)
-		}
+	// Sync live files from the game data directory, pausing the server if configured
+	if err := m.syncLiveFilesPaused(); err != nil {
+		return 0, 0, err
 	}
 
 	// Create the Saves directory for the vcdbtree output
 	// The saveFileName (without .vcdbs extension) becomes the directory name
 	saveBaseName := strings.TrimSuffix(saveFileName, ".vcdbs")
-	savesDir := filepath.Join(m.StagingDir, "Saves", saveBaseName)
+	savesDir := filepath.Join(m.stagingTarget(), "Saves", saveBaseName)
 	if err := os.MkdirAll(savesDir, 0755); err != nil {
-		return fmt.Errorf("failed to create Saves directory: %w", err)
+		return 0, 0, fmt.Errorf("failed to create Saves directory: %w", err)
 	}
 
 	// Split the backup file into vcdbtree format with caching.
 	// Only writes files that have changed, preserving metadata for unchanged files.
 	// This optimizes Restic's deduplication - unchanged files show zero diff.
-	written, skipped, err := m.splitToVCDBTree(backupFile, savesDir)
+	written, skipped, err = m.splitToVCDBTree(ctx, backupFile, savesDir, churn)
 	if err != nil {
-		return fmt.Errorf("failed to split backup to vcdbtree: %w", err)
+		return 0, 0, fmt.Errorf("failed to split backup to vcdbtree: %w", err)
 	}
 	fmt.Printf("vcdbtree: %d files written, %d files unchanged\n", written, skipped)
 
-	// Remove the original backup file since we've processed it
-	if err := os.Remove(backupFile); err != nil {
-		return fmt.Errorf("failed to remove original backup file: %w", err)
+	// Record which server version produced this snapshot, and what the tree
+	// must look like when restored
+	meta := m.snapshotMetadata()
+	if !m.SkipTreeDigest {
+		digest, err := vcdbtree.Digest(ctx, savesDir)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to compute tree digest: %w", err)
+		}
+		meta.TreeDigests = map[string]string{saveBaseName: digest}
+	}
+	if err := m.writeMetadata(meta); err != nil {
+		return 0, 0, err
+	}
+
+	// Let extensions add their own files to the snapshot
+	if err := m.runStagingPopulators(ctx); err != nil {
+		return 0, 0, err
+	}
+
+	if err := m.commitStagingUpdate(); err != nil {
+		return 0, 0, err
+	}
+
+	return written, skipped, nil
+}
+
+// syncLiveFilesPaused runs syncLiveFiles with the server suspended, if a
+// ProcessPauser is configured. The server is always resumed, either when
+// syncing finishes or when MaxServerPause elapses, whichever comes first.
+func (m *Manager) syncLiveFilesPaused() error {
+	if m.ProcessPauser == nil {
+		return m.syncLiveFiles()
+	}
+
+	if err := m.ProcessPauser.Pause(); err != nil {
+		fmt.Printf("WARNING: Failed to pause server, copying live files anyway: %v\n", err)
+		return m.syncLiveFiles()
+	}
+
+	var resumeOnce sync.Once
+	resume := func() {
+		resumeOnce.Do(func() {
+			if err := m.ProcessPauser.Resume(); err != nil {
+				fmt.Printf("WARNING: Failed to resume server: %v\n", err)
+			}
+		})
+	}
+
+	timer := time.AfterFunc(m.maxServerPause(), func() {
+		fmt.Printf("WARNING: Server paused for %v, resuming before copy finished\n", m.maxServerPause())
+		resume()
+	})
+	defer timer.Stop()
+	defer resume()
+
+	return m.syncLiveFiles()
+}
+
+// maxServerPause returns MaxServerPause, or its default if not set.
+func (m *Manager) maxServerPause() time.Duration {
+	if m.MaxServerPause > 0 {
+		return m.MaxServerPause
+	}
+	return 30 * time.Second
+}
+
+// syncLiveFiles copies the directories and config files the server writes to
+// while running into the staging directory.
+// Only changed files are written, preserving metadata for unchanged files.
+func (m *Manager) syncLiveFiles() error {
+	// Sync directories: Logs, Playerdata, Mods
+	for _, dir := range SyncedDirs {
+		srcDir := filepath.Join(m.GameDataDir, dir)
+		dstDir := filepath.Join(m.stagingTarget(), dir)
+		policy := m.syncPolicy(dir)
+
+		if policy.Mode == SyncSkip {
+			if err := os.RemoveAll(dstDir); err != nil {
+				return fmt.Errorf("failed to remove skipped %s from staging: %w", dir, err)
+			}
+			continue
+		}
+
+		if _, err := os.Stat(srcDir); err == nil {
+			var files vcdbtree.FileCounts
+			if dir == "Logs" {
+				files, err = m.syncLogs(srcDir, dstDir, policy)
+			} else {
+				files.Written, files.Skipped, files.Removed, err = vcdbtree.SyncDirOptions(srcDir, dstDir, policy.syncOptions(m.SyncWorkers, m.throttle()))
+			}
+			if err != nil {
+				return fmt.Errorf("failed to sync %s: %w", dir, err)
+			}
+			m.stagingWork.recordDir(dir, files)
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to stat %s: %w", dir, err)
+		}
+	}
+
+	// Sync config files
+	configFiles := []string{"serverconfig.json", "servermagicnumbers.json"}
+	for _, file := range configFiles {
+		srcFile := filepath.Join(m.GameDataDir, file)
+		dstFile := filepath.Join(m.stagingTarget(), file)
+
+		written, removed, err := vcdbtree.SyncFile(srcFile, dstFile)
+		if err != nil {
+			return fmt.Errorf("failed to sync %s: %w", file, err)
+		}
+		files := vcdbtree.FileCounts{Written: written, Removed: removed}
+		if written == 0 && removed == 0 {
+			if _, err := os.Stat(srcFile); err != nil {
+				continue
+			}
+			files.Skipped = 1
+		}
+		m.stagingWork.recordDir(file, files)
 	}
 
 	return nil
@@ -482,8 +1209,22 @@ func (m *Manager) updateStagingDirectory(backupFile, saveFileName string) error
 
 // splitToVCDBTree converts a .vcdbs SQLite database into vcdbtree format with caching.
 // Only writes files that have changed, preserving metadata for unchanged files.
+// Changed chunks are recorded in churn, which may be nil.
 // Returns the number of files written (changed) and skipped (unchanged).
-func (m *Manager) splitToVCDBTree(srcPath, dstDir string) (written, skipped int, err error) {
+// Recent splits that rewrote most of the tree make this one rewrite it in
+// bulk; see bulkSplit.
+func (m *Manager) splitToVCDBTree(ctx context.Context, srcPath, dstDir string, churn *churnTracker) (written, skipped int, err error) {
+	bulk := m.bulkSplit()
+	written, skipped, err = m.runSplit(ctx, srcPath, dstDir, churn, bulk)
+	if err == nil {
+		m.recordSplit(ctx, written, skipped, bulk)
+	}
+	return written, skipped, err
+}
+
+// runSplit runs the split for splitToVCDBTree, rebuilding the tree without
+// comparing files if bulk is set.
+func (m *Manager) runSplit(ctx context.Context, srcPath, dstDir string, churn *churnTracker, bulk bool) (written, skipped int, err error) {
 	// Use custom splitter if provided (for testing)
 	if m.VCDBTreeSplitter != nil {
 		fmt.Printf("Splitting vcdbs to vcdbtree (cached): %s -> %s\n", srcPath, dstDir)
@@ -491,73 +1232,216 @@ func (m *Manager) splitToVCDBTree(srcPath, dstDir string) (written, skipped int,
 	}
 
 	fmt.Printf("Splitting vcdbs to vcdbtree (cached): %s -> %s\n", srcPath, dstDir)
+	if bulk {
+		fmt.Printf("The last %d splits rewrote most of the staging tree; rewriting it in bulk without comparing files\n", highChangeRuns)
+	}
 
-	return vcdbtree.SplitWithCache(srcPath, dstDir)
+	opts := &vcdbtree.Options{OnRowWritten: churn.record, OnTableFiles: m.stagingWork.recordTable,
+		MapSizeX: m.WorldWidth, Layout: m.TreeLayout, Throttle: m.throttle(), Rebuild: bulk}
+	opts.OnRebuild = func(reason string) {
+		fmt.Printf("Rebuilding the staging tree from scratch: %s\n", reason)
+	}
+	if len(m.TrimAreas) > 0 {
+		opts.Filter = vcdbtree.KeepWithinMap(m.TrimAreas, opts.MapSizeX)
+	}
+
+	return vcdbtree.SplitWithCacheContext(ctx, srcPath, dstDir, m.withSplitProgress(opts))
+}
+
+// DefaultSplitProgressInterval is how often the progress of a split is
+// logged when SplitProgressInterval isn't set.
+const DefaultSplitProgressInterval = 30 * time.Second
+
+// withSplitProgress makes opts log the progress of the split every
+// SplitProgressInterval, and returns it.
+func (m *Manager) withSplitProgress(opts *vcdbtree.Options) *vcdbtree.Options {
+	opts.ProgressInterval = m.SplitProgressInterval
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = DefaultSplitProgressInterval
+	}
+	opts.OnProgress = func(p vcdbtree.Progress) {
+		fmt.Printf("[vcdbtree] %s\n", p)
+	}
+	return opts
 }
 
-// runRestic runs restic backup on the staging directory.
-func (m *Manager) runRestic(ctx context.Context) error {
+// runRestic runs restic backup on the staging directory, as one snapshot or
+// as the snapshot sets chosen by snapshotSets.
+// Returns restic's backup summary of the first snapshot, or nil if it isn't
+// available.
+func (m *Manager) runRestic(ctx context.Context) (*resticSummary, error) {
+	return m.runResticArgs(ctx, nil)
+}
+
+// runResticArgs runs restic backup as runRestic does, passing extra to each
+// restic backup, e.g. --time for an imported backup.
+func (m *Manager) runResticArgs(ctx context.Context, extra []string) (*resticSummary, error) {
+	// Never snapshot a half-updated staging directory
+	if err := m.checkStagingComplete(); err != nil {
+		return nil, err
+	}
+
+	now := m.clock().Now()
+	sets, err := m.snapshotSets(now)
+	if err != nil {
+		return nil, err
+	}
+
 	// Use custom runner if provided (for testing)
 	if m.ResticRunner != nil {
-		return m.ResticRunner(ctx, m.StagingDir)
+		for _, set := range sets {
+			if err := m.ResticRunner(ctx, set.runnerPath(m.StagingDir)); err != nil {
+				return nil, err
+			}
+		}
+		m.recordSnapshotSets(sets, now)
+		return nil, nil
 	}
 
 	// Check that required environment variables are set
-	if os.Getenv("RESTIC_REPOSITORY") == "" {
-		return fmt.Errorf("RESTIC_REPOSITORY environment variable is not set")
+	if !m.repositoryConfigured() {
+		return nil, fmt.Errorf("RESTIC_REPOSITORY environment variable is not set")
 	}
 
 	// Ensure the repository is initialized before running backup
 	if err := m.ensureRepoInitialized(ctx); err != nil {
-		return fmt.Errorf("failed to initialize restic repository: %w", err)
+		return nil, fmt.Errorf("failed to initialize restic repository: %w", err)
 	}
 
-	// Run restic backup
-	cmd := exec.CommandContext(ctx, "restic", "backup", m.StagingDir)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("restic backup failed: %w", err)
+	var summary *resticSummary
+	var mismatches []string
+	for i, set := range sets {
+		setSummary, mismatch, err := m.runResticSet(ctx, set, extra)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			summary = setSummary
+		}
+		if mismatch != "" {
+			mismatches = append(mismatches, mismatch)
+		}
 	}
+	m.recordSnapshotSets(sets, now)
+	m.recordIntegrity(mismatches)
 
-	return nil
+	return summary, nil
+}
+
+// recordSnapshotSets notes when the Mods set was last backed up.
+func (m *Manager) recordSnapshotSets(sets []snapshotSet, now time.Time) {
+	for _, set := range sets {
+		if set.name == SnapshotSetMods {
+			m.lastModsSnapshot = now
+		}
+	}
 }
 
-// runResticPrune runs restic forget with the configured retention options and --prune.
-// This removes old snapshots according to the retention policy.
-func (m *Manager) runResticPrune(ctx context.Context) error {
-	if m.PruneRetention == "" {
-		return nil // No pruning configured
+// runResticSet runs restic backup for one snapshot set, with extra
+// arguments. Returns restic's summary, and how what restic saw differed
+// from the staging tree, if it did.
+func (m *Manager) runResticSet(ctx context.Context, set snapshotSet, extra []string) (*resticSummary, string, error) {
+	var filesFrom string
+	if len(set.files) > 0 {
+		var err error
+		if filesFrom, err = set.writeFileList(); err != nil {
+			return nil, "", err
+		}
+		defer os.Remove(filesFrom)
+	}
+	if set.name != "" {
+		fmt.Printf("Backing up snapshot set %s\n", set.name)
 	}
 
-	// Use custom runner if provided (for testing)
-	if m.PruneRunner != nil {
-		return m.PruneRunner(ctx, m.PruneRetention)
+	// Take stock of the set first, to check what restic saw against it
+	inv, invErr := set.inventory()
+	if invErr != nil {
+		fmt.Printf("WARNING: Not checking the snapshot against the staging tree: %v\n", invErr)
 	}
 
-	fmt.Printf("Running restic forget with retention: %s\n", m.PruneRetention)
+	// Run restic backup with JSON output so the summary can be parsed
+	args := append(m.backupArgs(), extra...)
+	cmd := m.heavyResticCommand(ctx, append(args, set.args(filesFrom, m.ResticVersion)...)...)
+	cmd.Env = m.resticEnv()
+	stderr := &tailBuffer{max: resticStderrTail}
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
 
-	// Parse the retention options string into arguments
-	// Split on whitespace to get individual arguments
-	args := strings.Fields(m.PruneRetention)
-	// Always add --prune at the end
-	args = append(args, "--prune")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create restic stdout pipe: %w", err)
+	}
 
-	// Build the command: restic forget <options> --prune
-	cmd := exec.CommandContext(ctx, "restic", append([]string{"forget"}, args...)...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, "", fmt.Errorf("failed to start restic backup: %w", err)
+	}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("restic forget --prune failed: %w", err)
+	summary, parseErr := parseResticBackupOutput(stdout, os.Stdout)
+	if parseErr != nil {
+		// Keep draining so restic doesn't block on a full pipe
+		io.Copy(io.Discard, stdout)
 	}
 
-	return nil
+	if err := waitResticCommand(cmd, "backup", stderr); err != nil {
+		return nil, "", err
+	}
+
+	if parseErr != nil {
+		fmt.Printf("WARNING: Failed to parse restic output: %v\n", parseErr)
+	}
+	var mismatch string
+	if invErr == nil {
+		mismatch = m.checkIntegrity(set, inv, summary)
+	}
+
+	return summary, mismatch, nil
+}
+
+// reportStats logs the statistics of a completed backup, records them in
+// Status, passes them to OnBackupStats, and returns them.
+func (m *Manager) reportStats(written, skipped int, churn *churnTracker, summary *resticSummary) BackupStats {
+	topN := m.StatsTopRegions
+	if topN <= 0 {
+		topN = defaultTopRegions
+	}
+
+	stats := BackupStats{
+		FilesWritten:   written,
+		FilesUnchanged: skipped,
+		ChunksChanged:  churn.chunks,
+		BytesAdded:     -1,
+		TopRegions:     churn.top(topN),
+		Staging:        m.stagingWork,
+	}
+	if summary != nil {
+		stats.BytesAdded = summary.DataAdded
+		stats.SnapshotID = summary.SnapshotID
+	}
+
+	fmt.Printf("Backup stats: %s\n", stats)
+	fmt.Printf("Staging changes: %s\n", stats.Staging)
+
+	m.statusMu.Lock()
+	m.status.LastStats = &stats
+	m.statusMu.Unlock()
+
+	if m.OnBackupStats != nil {
+		m.OnBackupStats(stats)
+	}
+
+	return stats
+}
+
+// CheckRepository verifies that the restic repository is reachable with the
+// configured credentials, initializing it if it doesn't exist yet.
+func (m *Manager) CheckRepository(ctx context.Context) error {
+	if m.ResticRunner == nil && !m.repositoryConfigured() {
+		return fmt.Errorf("RESTIC_REPOSITORY environment variable is not set")
+	}
+	return m.ensureRepoInitialized(ctx)
 }
 
 // ensureRepoInitialized checks if the restic repository is initialized and initializes it if not.
-// Uses "restic cat config" to check - exit code 10 means uninitialized (since restic 0.17.0).
+// Uses "restic cat config" to check; see repositoryMissing for how the result is read.
 func (m *Manager) ensureRepoInitialized(ctx context.Context) error {
 	exitCode, output, err := m.runCommandWithOutput(ctx, "restic", "cat", "config")
 
@@ -566,8 +1450,7 @@ func (m *Manager) ensureRepoInitialized(ctx context.Context) error {
 		return nil
 	}
 
-	// Exit code 10 means repository is not initialized (restic 0.17.0+)
-	if exitCode == 10 {
+	if repositoryMissing(m.ResticVersion, exitCode, output) {
 		initExitCode, _, initErr := m.runCommandWithOutput(ctx, "restic", "init")
 		if initErr != nil {
 			return fmt.Errorf("restic init failed: %v", initErr)
@@ -579,13 +1462,11 @@ func (m *Manager) ensureRepoInitialized(ctx context.Context) error {
 	}
 
 	// Any other exit code is an error (e.g., wrong password, network error)
-	if err != nil {
-		return fmt.Errorf("restic cat config failed (exit code %d): %v\nOutput: %s", exitCode, err, output)
-	}
-	return fmt.Errorf("restic cat config failed with exit code %d\nOutput: %s", exitCode, output)
+	return &ResticError{Command: "cat config", ExitCode: exitCode, Output: output, Err: err}
 }
 
-// runCommandWithOutput runs a command and returns its exit code and combined output.
+// runCommandWithOutput runs a restic command with restic's environment and
+// returns its exit code and combined output.
 func (m *Manager) runCommandWithOutput(ctx context.Context, name string, args ...string) (int, string, error) {
 	// Use custom runner if provided (for testing)
 	if m.CommandRunner != nil {
@@ -594,6 +1475,7 @@ func (m *Manager) runCommandWithOutput(ctx context.Context, name string, args ..
 	}
 
 	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = m.resticEnv()
 	output, err := cmd.CombinedOutput()
 	if err == nil {
 		return 0, string(output), nil
@@ -611,7 +1493,9 @@ func (m *Manager) runCommandWithOutput(ctx context.Context, name string, args ..
 // skipPlayerCheck, if true, bypasses the player check and always runs the backup.
 // This is useful for boot-time backups that should run regardless of player status.
 func (m *Manager) RunBackupNow(ctx context.Context, skipPlayerCheck bool) error {
-	return m.performBackup(ctx, skipPlayerCheck)
+	err := m.performBackup(ctx, skipPlayerCheck)
+	m.recordAttempt(err, m.clock().Now())
+	return err
 }
 
 // Ensure Server implements ServerCommander at compile time.
@@ -622,3 +1506,9 @@ var _ BootChecker = (*server.Server)(nil)
 
 // Ensure Server implements BackupCompletionWaiter at compile time.
 var _ BackupCompletionWaiter = (*server.Server)(nil)
+
+// Ensure Server implements ProcessPauser at compile time.
+var _ ProcessPauser = (*server.Server)(nil)
+
+// Ensure Server implements GameVersionReporter at compile time.
+var _ GameVersionReporter = (*server.Server)(nil)
@@ -8,51 +8,14 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
-	"syscall"
 	"testing"
 	"time"
-)
-
-// mockServer implements ServerCommander for testing.
-type mockServer struct {
-	mu        sync.Mutex
-	commands  []string
-	onCommand func(cmd string) error
-}
-
-// mockBootChecker implements BootChecker for testing.
-type mockBootChecker struct {
-	mu        sync.Mutex
-	hasBooted bool
-}
 
-func (m *mockBootChecker) HasBooted() bool {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	return m.hasBooted
-}
-
-func (m *mockBootChecker) SetBooted(booted bool) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.hasBooted = booted
-}
-
-func (m *mockServer) SendCommand(cmd string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.commands = append(m.commands, cmd)
-	if m.onCommand != nil {
-		return m.onCommand(cmd)
-	}
-	return nil
-}
-
-func (m *mockServer) getCommands() []string {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	return append([]string{}, m.commands...)
-}
+	"github.com/renorris/vintagestory-restic/internal/clock"
+	"github.com/renorris/vintagestory-restic/internal/filelock"
+	"github.com/renorris/vintagestory-restic/internal/snapshotmeta"
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
 
 func TestManager_Start_Validation(t *testing.T) {
 	t.Run("missing server", func(t *testing.T) {
@@ -69,7 +32,7 @@ func TestManager_Start_Validation(t *testing.T) {
 	t.Run("zero interval", func(t *testing.T) {
 		m := &Manager{
 			Interval: 0,
-			Server:   &mockServer{},
+			Server:   &testsupport.Server{},
 		}
 		ctx := context.Background()
 		err := m.Start(ctx)
@@ -81,7 +44,7 @@ func TestManager_Start_Validation(t *testing.T) {
 	t.Run("negative interval", func(t *testing.T) {
 		m := &Manager{
 			Interval: -time.Second,
-			Server:   &mockServer{},
+			Server:   &testsupport.Server{},
 		}
 		ctx := context.Background()
 		err := m.Start(ctx)
@@ -93,7 +56,7 @@ func TestManager_Start_Validation(t *testing.T) {
 	t.Run("already started", func(t *testing.T) {
 		m := &Manager{
 			Interval:    time.Hour, // Long interval so it doesn't trigger
-			Server:      &mockServer{},
+			Server:      &testsupport.Server{},
 			GameDataDir: t.TempDir(),
 		}
 		ctx, cancel := context.WithCancel(context.Background())
@@ -113,7 +76,7 @@ func TestManager_Start_Validation(t *testing.T) {
 func TestManager_StartStop(t *testing.T) {
 	m := &Manager{
 		Interval:    time.Hour, // Long interval so it doesn't trigger
-		Server:      &mockServer{},
+		Server:      &testsupport.Server{},
 		GameDataDir: t.TempDir(),
 	}
 
@@ -137,7 +100,7 @@ func TestManager_StartStop(t *testing.T) {
 func TestManager_ContextCancellation(t *testing.T) {
 	m := &Manager{
 		Interval:    time.Hour,
-		Server:      &mockServer{},
+		Server:      &testsupport.Server{},
 		GameDataDir: t.TempDir(),
 	}
 
@@ -175,7 +138,7 @@ func TestManager_GetSaveFileName(t *testing.T) {
 
 	m := &Manager{
 		Interval:    time.Second,
-		Server:      &mockServer{},
+		Server:      &testsupport.Server{},
 		GameDataDir: tmpDir,
 	}
 
@@ -203,7 +166,7 @@ func TestManager_GetSaveFileName_Default(t *testing.T) {
 
 	m := &Manager{
 		Interval:    time.Second,
-		Server:      &mockServer{},
+		Server:      &testsupport.Server{},
 		GameDataDir: tmpDir,
 	}
 
@@ -226,14 +189,16 @@ func TestManager_WaitForBackupFile(t *testing.T) {
 
 	m := &Manager{
 		Interval:      time.Second,
-		Server:        &mockServer{},
+		Server:        &testsupport.Server{},
 		GameDataDir:   tmpDir,
 		BackupTimeout: 5 * time.Second,
 	}
 
-	// Record time before creating the file
-	beforeCreate := time.Now()
-	time.Sleep(10 * time.Millisecond)
+	// List the backups before creating the file
+	existing, err := m.existingBackupFiles()
+	if err != nil {
+		t.Fatalf("existingBackupFiles() failed: %v", err)
+	}
 
 	// Create a backup file
 	backupFileName := "2024-01-01_12-00-00.vcdbs"
@@ -245,7 +210,7 @@ func TestManager_WaitForBackupFile(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	foundFile, err := m.waitForBackupFile(ctx, beforeCreate)
+	foundFile, err := m.waitForBackupFile(ctx, existing)
 	if err != nil {
 		t.Fatalf("waitForBackupFile() failed: %v", err)
 	}
@@ -264,7 +229,7 @@ func TestManager_WaitForBackupFile_Timeout(t *testing.T) {
 
 	m := &Manager{
 		Interval:      time.Second,
-		Server:        &mockServer{},
+		Server:        &testsupport.Server{},
 		GameDataDir:   tmpDir,
 		BackupTimeout: time.Second,
 	}
@@ -273,7 +238,7 @@ func TestManager_WaitForBackupFile_Timeout(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
 	defer cancel()
 
-	_, err := m.waitForBackupFile(ctx, time.Now())
+	_, err := m.waitForBackupFile(ctx, nil)
 	if err != context.DeadlineExceeded {
 		t.Errorf("waitForBackupFile() error = %v, want context.DeadlineExceeded", err)
 	}
@@ -292,17 +257,16 @@ func TestManager_WaitForBackupFile_IgnoresOldFiles(t *testing.T) {
 		t.Fatalf("Failed to write old backup file: %v", err)
 	}
 
-	// Wait a moment to ensure time difference
-	time.Sleep(50 * time.Millisecond)
-	afterOldFile := time.Now()
-	time.Sleep(50 * time.Millisecond)
-
 	m := &Manager{
 		Interval:      time.Second,
-		Server:        &mockServer{},
+		Server:        &testsupport.Server{},
 		GameDataDir:   tmpDir,
 		BackupTimeout: 5 * time.Second,
 	}
+	existing, err := m.existingBackupFiles()
+	if err != nil {
+		t.Fatalf("existingBackupFiles() failed: %v", err)
+	}
 
 	// Create a new backup file in a goroutine
 	newBackupPath := filepath.Join(backupsDir, "new-backup.vcdbs")
@@ -314,7 +278,7 @@ func TestManager_WaitForBackupFile_IgnoresOldFiles(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	foundFile, err := m.waitForBackupFile(ctx, afterOldFile)
+	foundFile, err := m.waitForBackupFile(ctx, existing)
 	if err != nil {
 		t.Fatalf("waitForBackupFile() failed: %v", err)
 	}
@@ -366,7 +330,7 @@ func TestManager_CreateStagingDirectory(t *testing.T) {
 
 	m := &Manager{
 		Interval:    time.Second,
-		Server:      &mockServer{},
+		Server:      &testsupport.Server{},
 		GameDataDir: gameDataDir,
 		StagingDir:  stagingDir,
 		// Mock VCDBTreeSplitter to create a marker file (simulates vcdbtree.Split)
@@ -383,7 +347,7 @@ func TestManager_CreateStagingDirectory(t *testing.T) {
 	}
 
 	// Update staging directory
-	if err := m.updateStagingDirectory(backupFile, "default.vcdbs"); err != nil {
+	if _, _, err := m.updateStagingDirectory(context.Background(), backupFile, "default.vcdbs", nil); err != nil {
 		t.Fatalf("updateStagingDirectory() failed: %v", err)
 	}
 
@@ -415,6 +379,15 @@ func TestManager_CreateStagingDirectory(t *testing.T) {
 		t.Error("Expected vcdbtree gamedata marker to exist")
 	}
 
+	// Verify the metadata records the tree's digest
+	meta, err := snapshotmeta.Read(stagingDir)
+	if err != nil || meta == nil {
+		t.Fatalf("snapshotmeta.Read() = %v, %v", meta, err)
+	}
+	if verified, err := VerifyTreeDigest(context.Background(), meta, "default", vcdbtreeDir); !verified || err != nil {
+		t.Errorf("VerifyTreeDigest() = %v, %v; want the recorded digest to match", verified, err)
+	}
+
 	// Verify the original backup file was removed after split
 	if _, err := os.Stat(backupFile); !os.IsNotExist(err) {
 		t.Error("Expected original backup file to be removed after split")
@@ -436,7 +409,7 @@ func TestManager_SendsGenbackupCommand(t *testing.T) {
 	configData, _ := json.Marshal(config)
 	os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), configData, 0644)
 
-	server := &mockServer{}
+	server := &testsupport.Server{}
 
 	m := &Manager{
 		Interval:      time.Second,
@@ -462,7 +435,7 @@ func TestManager_SendsGenbackupCommand(t *testing.T) {
 	// performBackup will fail at the restic step, but we can verify the command was sent
 	_ = m.performBackup(ctx, false)
 
-	commands := server.getCommands()
+	commands := server.Commands()
 	found := false
 	for _, cmd := range commands {
 		if cmd == "/genbackup" {
@@ -479,7 +452,7 @@ func TestManager_SendsGenbackupCommand(t *testing.T) {
 func TestManager_Done_BeforeStart(t *testing.T) {
 	m := &Manager{
 		Interval: time.Second,
-		Server:   &mockServer{},
+		Server:   &testsupport.Server{},
 	}
 
 	// Done should return a closed channel before Start is called
@@ -513,7 +486,7 @@ func TestManager_Callbacks(t *testing.T) {
 
 	m := &Manager{
 		Interval:      time.Second,
-		Server:        &mockServer{},
+		Server:        &testsupport.Server{},
 		GameDataDir:   gameDataDir,
 		StagingDir:    stagingDir,
 		BackupTimeout: 2 * time.Second,
@@ -578,7 +551,7 @@ func TestManager_IsFileUnlocked_UnlockedFile(t *testing.T) {
 
 	m := &Manager{
 		Interval: time.Second,
-		Server:   &mockServer{},
+		Server:   &testsupport.Server{},
 	}
 
 	if !m.isFileUnlocked(filePath) {
@@ -602,14 +575,14 @@ func TestManager_IsFileUnlocked_LockedFile(t *testing.T) {
 	}
 	defer file.Close()
 
-	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+	if err := filelock.Lock(file); err != nil {
 		t.Fatalf("Failed to lock file: %v", err)
 	}
-	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	defer filelock.Unlock(file)
 
 	m := &Manager{
 		Interval: time.Second,
-		Server:   &mockServer{},
+		Server:   &testsupport.Server{},
 	}
 
 	if m.isFileUnlocked(filePath) {
@@ -620,7 +593,7 @@ func TestManager_IsFileUnlocked_LockedFile(t *testing.T) {
 func TestManager_IsFileUnlocked_NonExistentFile(t *testing.T) {
 	m := &Manager{
 		Interval: time.Second,
-		Server:   &mockServer{},
+		Server:   &testsupport.Server{},
 	}
 
 	if m.isFileUnlocked("/nonexistent/path/file.txt") {
@@ -637,14 +610,16 @@ func TestManager_WaitForBackupFile_WaitsForUnlock(t *testing.T) {
 
 	m := &Manager{
 		Interval:      time.Second,
-		Server:        &mockServer{},
+		Server:        &testsupport.Server{},
 		GameDataDir:   tmpDir,
 		BackupTimeout: 5 * time.Second,
 	}
 
-	// Record time before creating the file
-	beforeCreate := time.Now()
-	time.Sleep(10 * time.Millisecond)
+	// List the backups before creating the file
+	existing, err := m.existingBackupFiles()
+	if err != nil {
+		t.Fatalf("existingBackupFiles() failed: %v", err)
+	}
 
 	// Create a backup file and lock it
 	backupFileName := "2024-01-01_12-00-00.vcdbs"
@@ -659,7 +634,7 @@ func TestManager_WaitForBackupFile_WaitsForUnlock(t *testing.T) {
 		t.Fatalf("Failed to open file for locking: %v", err)
 	}
 
-	if err := syscall.Flock(int(lockedFile.Fd()), syscall.LOCK_EX); err != nil {
+	if err := filelock.Lock(lockedFile); err != nil {
 		lockedFile.Close()
 		t.Fatalf("Failed to lock file: %v", err)
 	}
@@ -667,7 +642,7 @@ func TestManager_WaitForBackupFile_WaitsForUnlock(t *testing.T) {
 	// Unlock the file after a short delay in a goroutine
 	go func() {
 		time.Sleep(600 * time.Millisecond)
-		syscall.Flock(int(lockedFile.Fd()), syscall.LOCK_UN)
+		filelock.Unlock(lockedFile)
 		lockedFile.Close()
 	}()
 
@@ -675,7 +650,7 @@ func TestManager_WaitForBackupFile_WaitsForUnlock(t *testing.T) {
 	defer cancel()
 
 	startTime := time.Now()
-	foundFile, err := m.waitForBackupFile(ctx, beforeCreate)
+	foundFile, err := m.waitForBackupFile(ctx, existing)
 	elapsed := time.Since(startTime)
 
 	if err != nil {
@@ -710,7 +685,7 @@ func TestManager_PerformBackup_CleansUpBackupFile(t *testing.T) {
 
 	m := &Manager{
 		Interval:      time.Second,
-		Server:        &mockServer{},
+		Server:        &testsupport.Server{},
 		GameDataDir:   gameDataDir,
 		StagingDir:    stagingDir,
 		BackupTimeout: 2 * time.Second,
@@ -771,7 +746,7 @@ func TestManager_PerformBackup_PersistsStagingOnResticFailure(t *testing.T) {
 
 	m := &Manager{
 		Interval:      time.Second,
-		Server:        &mockServer{},
+		Server:        &testsupport.Server{},
 		GameDataDir:   gameDataDir,
 		StagingDir:    stagingDir,
 		BackupTimeout: 2 * time.Second,
@@ -819,11 +794,11 @@ func TestManager_PerformBackup_BootCheckGuard(t *testing.T) {
 	t.Run("backup fails when server not booted", func(t *testing.T) {
 		gameDataDir := t.TempDir()
 
-		bootChecker := &mockBootChecker{hasBooted: false}
+		bootChecker := testsupport.NewBootChecker(false)
 
 		m := &Manager{
 			Interval:    time.Second,
-			Server:      &mockServer{},
+			Server:      &testsupport.Server{},
 			BootChecker: bootChecker,
 			GameDataDir: gameDataDir,
 		}
@@ -851,11 +826,11 @@ func TestManager_PerformBackup_BootCheckGuard(t *testing.T) {
 		configData, _ := json.Marshal(config)
 		os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), configData, 0644)
 
-		bootChecker := &mockBootChecker{hasBooted: true}
+		bootChecker := testsupport.NewBootChecker(true)
 
 		m := &Manager{
 			Interval:      time.Second,
-			Server:        &mockServer{},
+			Server:        &testsupport.Server{},
 			BootChecker:   bootChecker,
 			GameDataDir:   gameDataDir,
 			StagingDir:    stagingDir,
@@ -906,7 +881,7 @@ func TestManager_PerformBackup_BootCheckGuard(t *testing.T) {
 		// No BootChecker set
 		m := &Manager{
 			Interval:      time.Second,
-			Server:        &mockServer{},
+			Server:        &testsupport.Server{},
 			GameDataDir:   gameDataDir,
 			StagingDir:    stagingDir,
 			BackupTimeout: 2 * time.Second,
@@ -939,12 +914,6 @@ func TestManager_PerformBackup_BootCheckGuard(t *testing.T) {
 	})
 }
 
-// mockPlayerChecker implements PlayerCheckerInterface for testing.
-type mockPlayerChecker struct {
-	mu           sync.Mutex
-	shouldBackup bool
-}
-
 // mockBackupCompletionWaiter implements BackupCompletionWaiter for testing.
 type mockBackupCompletionWaiter struct {
 	mu            sync.Mutex
@@ -1005,28 +974,16 @@ func (m *mockBackupCompletionWaiter) SetWaitCompleted(ch chan struct{}) {
 	m.waitCompleted = ch
 }
 
-func (m *mockPlayerChecker) ShouldBackup() bool {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	return m.shouldBackup
-}
-
-func (m *mockPlayerChecker) SetShouldBackup(shouldBackup bool) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.shouldBackup = shouldBackup
-}
-
 func TestManager_PerformBackup_PlayerCheckGuard(t *testing.T) {
 	t.Run("backup skips when no players online and PauseWhenNoPlayers enabled", func(t *testing.T) {
 		gameDataDir := t.TempDir()
 
-		playerChecker := &mockPlayerChecker{shouldBackup: false}
-		bootChecker := &mockBootChecker{hasBooted: true}
+		playerChecker := testsupport.NewPlayerChecker(false)
+		bootChecker := testsupport.NewBootChecker(true)
 
 		m := &Manager{
 			Interval:           time.Second,
-			Server:             &mockServer{},
+			Server:             &testsupport.Server{},
 			BootChecker:        bootChecker,
 			PlayerChecker:      playerChecker,
 			PauseWhenNoPlayers: true,
@@ -1056,12 +1013,12 @@ func TestManager_PerformBackup_PlayerCheckGuard(t *testing.T) {
 		configData, _ := json.Marshal(config)
 		os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), configData, 0644)
 
-		playerChecker := &mockPlayerChecker{shouldBackup: true}
-		bootChecker := &mockBootChecker{hasBooted: true}
+		playerChecker := testsupport.NewPlayerChecker(true)
+		bootChecker := testsupport.NewBootChecker(true)
 
 		m := &Manager{
 			Interval:           time.Second,
-			Server:             &mockServer{},
+			Server:             &testsupport.Server{},
 			BootChecker:        bootChecker,
 			PlayerChecker:      playerChecker,
 			PauseWhenNoPlayers: true,
@@ -1112,12 +1069,12 @@ func TestManager_PerformBackup_PlayerCheckGuard(t *testing.T) {
 		os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), configData, 0644)
 
 		// Player checker says no backup needed, but PauseWhenNoPlayers is false
-		playerChecker := &mockPlayerChecker{shouldBackup: false}
-		bootChecker := &mockBootChecker{hasBooted: true}
+		playerChecker := testsupport.NewPlayerChecker(false)
+		bootChecker := testsupport.NewBootChecker(true)
 
 		m := &Manager{
 			Interval:           time.Second,
-			Server:             &mockServer{},
+			Server:             &testsupport.Server{},
 			BootChecker:        bootChecker,
 			PlayerChecker:      playerChecker,
 			PauseWhenNoPlayers: false, // Disabled
@@ -1167,11 +1124,11 @@ func TestManager_PerformBackup_PlayerCheckGuard(t *testing.T) {
 		configData, _ := json.Marshal(config)
 		os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), configData, 0644)
 
-		bootChecker := &mockBootChecker{hasBooted: true}
+		bootChecker := testsupport.NewBootChecker(true)
 
 		m := &Manager{
 			Interval:           time.Second,
-			Server:             &mockServer{},
+			Server:             &testsupport.Server{},
 			BootChecker:        bootChecker,
 			PlayerChecker:      nil, // No player checker
 			PauseWhenNoPlayers: true,
@@ -1221,12 +1178,12 @@ func TestManager_PerformBackup_PlayerCheckGuard(t *testing.T) {
 		configData, _ := json.Marshal(config)
 		os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), configData, 0644)
 
-		playerChecker := &mockPlayerChecker{shouldBackup: true}
-		bootChecker := &mockBootChecker{hasBooted: true}
+		playerChecker := testsupport.NewPlayerChecker(true)
+		bootChecker := testsupport.NewBootChecker(true)
 
 		m := &Manager{
 			Interval:           time.Second,
-			Server:             &mockServer{},
+			Server:             &testsupport.Server{},
 			BootChecker:        bootChecker,
 			PlayerChecker:      playerChecker,
 			PauseWhenNoPlayers: true,
@@ -1294,12 +1251,12 @@ func TestManager_PerformBackup_PlayerCheckGuard(t *testing.T) {
 		os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), configData, 0644)
 
 		// Player checker says no backup needed
-		playerChecker := &mockPlayerChecker{shouldBackup: false}
-		bootChecker := &mockBootChecker{hasBooted: true}
+		playerChecker := testsupport.NewPlayerChecker(false)
+		bootChecker := testsupport.NewBootChecker(true)
 
 		m := &Manager{
 			Interval:           time.Second,
-			Server:             &mockServer{},
+			Server:             &testsupport.Server{},
 			BootChecker:        bootChecker,
 			PlayerChecker:      playerChecker,
 			PauseWhenNoPlayers: true,
@@ -1339,7 +1296,7 @@ func TestManager_PerformBackup_PlayerCheckGuard(t *testing.T) {
 func TestManager_EnsureRepoInitialized_AlreadyInitialized(t *testing.T) {
 	m := &Manager{
 		Interval: time.Second,
-		Server:   &mockServer{},
+		Server:   &testsupport.Server{},
 		CommandRunner: func(ctx context.Context, name string, args ...string) (int, error) {
 			// Simulate "restic cat config" succeeding (repo already initialized)
 			if name == "restic" && len(args) >= 2 && args[0] == "cat" && args[1] == "config" {
@@ -1361,7 +1318,7 @@ func TestManager_EnsureRepoInitialized_NeedsInit(t *testing.T) {
 
 	m := &Manager{
 		Interval: time.Second,
-		Server:   &mockServer{},
+		Server:   &testsupport.Server{},
 		CommandRunner: func(ctx context.Context, name string, args ...string) (int, error) {
 			if name == "restic" {
 				if len(args) >= 2 && args[0] == "cat" && args[1] == "config" {
@@ -1391,7 +1348,7 @@ func TestManager_EnsureRepoInitialized_NeedsInit(t *testing.T) {
 func TestManager_EnsureRepoInitialized_InitFails(t *testing.T) {
 	m := &Manager{
 		Interval: time.Second,
-		Server:   &mockServer{},
+		Server:   &testsupport.Server{},
 		CommandRunner: func(ctx context.Context, name string, args ...string) (int, error) {
 			if name == "restic" {
 				if len(args) >= 2 && args[0] == "cat" && args[1] == "config" {
@@ -1417,7 +1374,7 @@ func TestManager_EnsureRepoInitialized_InitFails(t *testing.T) {
 func TestManager_EnsureRepoInitialized_OtherExitCodeIsError(t *testing.T) {
 	m := &Manager{
 		Interval: time.Second,
-		Server:   &mockServer{},
+		Server:   &testsupport.Server{},
 		CommandRunner: func(ctx context.Context, name string, args ...string) (int, error) {
 			if name == "restic" && len(args) >= 2 && args[0] == "cat" && args[1] == "config" {
 				// Exit code 1 = error (wrong password, etc.)
@@ -1434,10 +1391,52 @@ func TestManager_EnsureRepoInitialized_OtherExitCodeIsError(t *testing.T) {
 	}
 }
 
+func TestManager_CheckRepository(t *testing.T) {
+	t.Run("missing repository", func(t *testing.T) {
+		os.Unsetenv("RESTIC_REPOSITORY")
+		os.Unsetenv("RESTIC_REPOSITORY_FILE")
+
+		m := &Manager{Server: &testsupport.Server{}}
+		if err := m.CheckRepository(context.Background()); err == nil {
+			t.Error("CheckRepository() expected error without RESTIC_REPOSITORY")
+		}
+	})
+
+	t.Run("unreachable repository", func(t *testing.T) {
+		os.Setenv("RESTIC_REPOSITORY", "/srv/restic")
+		defer os.Unsetenv("RESTIC_REPOSITORY")
+
+		m := &Manager{
+			Server: &testsupport.Server{},
+			CommandRunner: func(ctx context.Context, name string, args ...string) (int, error) {
+				return 1, nil // Wrong password, network error, etc.
+			},
+		}
+		if err := m.CheckRepository(context.Background()); err == nil {
+			t.Error("CheckRepository() expected error for unreachable repository")
+		}
+	})
+
+	t.Run("reachable repository", func(t *testing.T) {
+		os.Setenv("RESTIC_REPOSITORY", "/srv/restic")
+		defer os.Unsetenv("RESTIC_REPOSITORY")
+
+		m := &Manager{
+			Server: &testsupport.Server{},
+			CommandRunner: func(ctx context.Context, name string, args ...string) (int, error) {
+				return 0, nil
+			},
+		}
+		if err := m.CheckRepository(context.Background()); err != nil {
+			t.Errorf("CheckRepository() unexpected error: %v", err)
+		}
+	})
+}
+
 func TestManager_RunCommandWithOutput(t *testing.T) {
 	m := &Manager{
 		Interval: time.Second,
-		Server:   &mockServer{},
+		Server:   &testsupport.Server{},
 	}
 
 	ctx := context.Background()
@@ -1480,7 +1479,7 @@ func TestManager_SplitToVCDBTree(t *testing.T) {
 
 		m := &Manager{
 			Interval: time.Second,
-			Server:   &mockServer{},
+			Server:   &testsupport.Server{},
 			VCDBTreeSplitter: func(srcPath, dstDir string) (int, int, error) {
 				splitterCalled = true
 				capturedSrc = srcPath
@@ -1489,7 +1488,7 @@ func TestManager_SplitToVCDBTree(t *testing.T) {
 			},
 		}
 
-		_, _, err := m.splitToVCDBTree("/src/path.vcdbs", "/dst/path")
+		_, _, err := m.splitToVCDBTree(context.Background(), "/src/path.vcdbs", "/dst/path", nil)
 		if err != nil {
 			t.Fatalf("splitToVCDBTree() failed: %v", err)
 		}
@@ -1510,13 +1509,13 @@ func TestManager_SplitToVCDBTree(t *testing.T) {
 
 		m := &Manager{
 			Interval: time.Second,
-			Server:   &mockServer{},
+			Server:   &testsupport.Server{},
 			VCDBTreeSplitter: func(srcPath, dstDir string) (int, int, error) {
 				return 0, 0, expectedErr
 			},
 		}
 
-		_, _, err := m.splitToVCDBTree("/src/path.vcdbs", "/dst/path")
+		_, _, err := m.splitToVCDBTree(context.Background(), "/src/path.vcdbs", "/dst/path", nil)
 		if err != expectedErr {
 			t.Errorf("splitToVCDBTree() error = %v, want %v", err, expectedErr)
 		}
@@ -1550,7 +1549,7 @@ func TestManager_CreateStagingDirectory_SplitsToVCDBTree(t *testing.T) {
 
 	m := &Manager{
 		Interval:    time.Second,
-		Server:      &mockServer{},
+		Server:      &testsupport.Server{},
 		GameDataDir: gameDataDir,
 		StagingDir:  stagingDir,
 		VCDBTreeSplitter: func(srcPath, dstDir string) (int, int, error) {
@@ -1567,7 +1566,7 @@ func TestManager_CreateStagingDirectory_SplitsToVCDBTree(t *testing.T) {
 	}
 
 	// Create staging directory
-	if err := m.updateStagingDirectory(backupFile, "default.vcdbs"); err != nil {
+	if _, _, err := m.updateStagingDirectory(context.Background(), backupFile, "default.vcdbs", nil); err != nil {
 		t.Fatalf("updateStagingDirectory() failed: %v", err)
 	}
 
@@ -1612,7 +1611,7 @@ func TestManager_CreateStagingDirectory_SplitFailure(t *testing.T) {
 
 	m := &Manager{
 		Interval:    time.Second,
-		Server:      &mockServer{},
+		Server:      &testsupport.Server{},
 		GameDataDir: gameDataDir,
 		StagingDir:  stagingDir,
 		VCDBTreeSplitter: func(srcPath, dstDir string) (int, int, error) {
@@ -1620,7 +1619,7 @@ func TestManager_CreateStagingDirectory_SplitFailure(t *testing.T) {
 		},
 	}
 
-	err := m.updateStagingDirectory(backupFile, "default.vcdbs")
+	_, _, err := m.updateStagingDirectory(context.Background(), backupFile, "default.vcdbs", nil)
 	if err == nil {
 		t.Error("updateStagingDirectory() expected error when split fails")
 	}
@@ -1639,7 +1638,7 @@ func TestManager_RunBackup_BootCheckGuard(t *testing.T) {
 	t.Run("runBackup skips when server not booted", func(t *testing.T) {
 		gameDataDir := t.TempDir()
 
-		bootChecker := &mockBootChecker{hasBooted: false}
+		bootChecker := testsupport.NewBootChecker(false)
 
 		var completeCalled bool
 		var completeErr error
@@ -1647,7 +1646,7 @@ func TestManager_RunBackup_BootCheckGuard(t *testing.T) {
 
 		m := &Manager{
 			Interval:    time.Second,
-			Server:      &mockServer{},
+			Server:      &testsupport.Server{},
 			BootChecker: bootChecker,
 			GameDataDir: gameDataDir,
 			OnBackupComplete: func(err error, duration time.Duration) {
@@ -1691,11 +1690,11 @@ func TestManager_WaitForBackupFile_WaitsForBackupCompletionNotification(t *testi
 		os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), configData, 0644)
 
 		completionWaiter := &mockBackupCompletionWaiter{}
-		bootChecker := &mockBootChecker{hasBooted: true}
+		bootChecker := testsupport.NewBootChecker(true)
 
 		m := &Manager{
 			Interval:               time.Second,
-			Server:                 &mockServer{},
+			Server:                 &testsupport.Server{},
 			BootChecker:            bootChecker,
 			BackupCompletionWaiter: completionWaiter,
 			GameDataDir:            gameDataDir,
@@ -1752,11 +1751,11 @@ func TestManager_WaitForBackupFile_WaitsForBackupCompletionNotification(t *testi
 		waitCompleted := make(chan struct{})
 		completionWaiter := &mockBackupCompletionWaiter{}
 		completionWaiter.SetWaitCompleted(waitCompleted)
-		bootChecker := &mockBootChecker{hasBooted: true}
+		bootChecker := testsupport.NewBootChecker(true)
 
 		m := &Manager{
 			Interval:               time.Second,
-			Server:                 &mockServer{},
+			Server:                 &testsupport.Server{},
 			BootChecker:            bootChecker,
 			BackupCompletionWaiter: completionWaiter,
 			GameDataDir:            gameDataDir,
@@ -1792,11 +1791,11 @@ func TestManager_WaitForBackupFile_WaitsForBackupCompletionNotification(t *testi
 
 		completionWaiter := &mockBackupCompletionWaiter{}
 		completionWaiter.SetError(fmt.Errorf("server exited unexpectedly"))
-		bootChecker := &mockBootChecker{hasBooted: true}
+		bootChecker := testsupport.NewBootChecker(true)
 
 		m := &Manager{
 			Interval:               time.Second,
-			Server:                 &mockServer{},
+			Server:                 &testsupport.Server{},
 			BootChecker:            bootChecker,
 			BackupCompletionWaiter: completionWaiter,
 			GameDataDir:            gameDataDir,
@@ -1831,11 +1830,11 @@ func TestManager_WaitForBackupFile_WaitsForBackupCompletionNotification(t *testi
 		configData, _ := json.Marshal(config)
 		os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), configData, 0644)
 
-		bootChecker := &mockBootChecker{hasBooted: true}
+		bootChecker := testsupport.NewBootChecker(true)
 
 		m := &Manager{
 			Interval:               time.Second,
-			Server:                 &mockServer{},
+			Server:                 &testsupport.Server{},
 			BootChecker:            bootChecker,
 			BackupCompletionWaiter: nil, // No waiter configured
 			GameDataDir:            gameDataDir,
@@ -1888,11 +1887,11 @@ func TestManager_WaitForBackupFile_WaitsForBackupCompletionNotification(t *testi
 		var order []string
 
 		completionWaiter := &mockBackupCompletionWaiter{}
-		bootChecker := &mockBootChecker{hasBooted: true}
+		bootChecker := testsupport.NewBootChecker(true)
 
 		m := &Manager{
 			Interval:               time.Second,
-			Server:                 &mockServer{},
+			Server:                 &testsupport.Server{},
 			BootChecker:            bootChecker,
 			BackupCompletionWaiter: completionWaiter,
 			GameDataDir:            gameDataDir,
@@ -1913,7 +1912,7 @@ func TestManager_WaitForBackupFile_WaitsForBackupCompletionNotification(t *testi
 			},
 		}
 
-		// Create backup file after a short delay (after beforeGenbackup timestamp is recorded)
+		// Create backup file after a short delay (after the existing backups are listed)
 		go func() {
 			time.Sleep(100 * time.Millisecond)
 			backupFile := filepath.Join(backupsDir, "backup.vcdbs")
@@ -1949,7 +1948,7 @@ func TestManager_RunResticPrune(t *testing.T) {
 
 		m := &Manager{
 			Interval:       time.Second,
-			Server:         &mockServer{},
+			Server:         &testsupport.Server{},
 			PruneRetention: "",
 			PruneRunner: func(ctx context.Context, retentionOptions string) error {
 				pruneCalled = true
@@ -1974,7 +1973,7 @@ func TestManager_RunResticPrune(t *testing.T) {
 
 		m := &Manager{
 			Interval:       time.Second,
-			Server:         &mockServer{},
+			Server:         &testsupport.Server{},
 			PruneRetention: "--keep-daily 7 --keep-weekly 4",
 			PruneRunner: func(ctx context.Context, retentionOptions string) error {
 				pruneCalled = true
@@ -2003,7 +2002,7 @@ func TestManager_RunResticPrune(t *testing.T) {
 
 		m := &Manager{
 			Interval:       time.Second,
-			Server:         &mockServer{},
+			Server:         &testsupport.Server{},
 			PruneRetention: "--keep-daily 7",
 			PruneRunner: func(ctx context.Context, retentionOptions string) error {
 				return expectedErr
@@ -2016,6 +2015,105 @@ func TestManager_RunResticPrune(t *testing.T) {
 			t.Errorf("runResticPrune() error = %v, want %v", err, expectedErr)
 		}
 	})
+
+	t.Run("defers prune outside PruneWindow", func(t *testing.T) {
+		pruneCalls := 0
+
+		m := &Manager{
+			Interval:       time.Second,
+			Server:         &testsupport.Server{},
+			PruneRetention: "--keep-daily 7",
+			PruneWindow:    windowAwayFrom(time.Now()),
+			PruneRunner: func(ctx context.Context, retentionOptions string) error {
+				pruneCalls++
+				return nil
+			},
+		}
+
+		if err := m.runResticPrune(context.Background()); err != nil {
+			t.Errorf("runResticPrune() unexpected error: %v", err)
+		}
+		if pruneCalls != 0 {
+			t.Errorf("PruneRunner called %d times outside the window, want 0", pruneCalls)
+		}
+	})
+
+	t.Run("prunes once per PruneWindow", func(t *testing.T) {
+		pruneCalls := 0
+		failPrune := true
+
+		m := &Manager{
+			Interval:       time.Second,
+			Server:         &testsupport.Server{},
+			PruneRetention: "--keep-daily 7",
+			PruneWindow:    windowAround(time.Now()),
+			PruneRunner: func(ctx context.Context, retentionOptions string) error {
+				pruneCalls++
+				if failPrune {
+					failPrune = false
+					return fmt.Errorf("simulated prune failure")
+				}
+				return nil
+			},
+		}
+
+		ctx := context.Background()
+
+		// A failed prune is retried on the next backup
+		if err := m.runResticPrune(ctx); err == nil {
+			t.Error("runResticPrune() expected error from first prune")
+		}
+		for i := 0; i < 3; i++ {
+			if err := m.runResticPrune(ctx); err != nil {
+				t.Errorf("runResticPrune() unexpected error: %v", err)
+			}
+		}
+		if pruneCalls != 2 {
+			t.Errorf("PruneRunner called %d times, want 2 (one failure, one success)", pruneCalls)
+		}
+
+		// A prune from a previous occurrence of the window doesn't count
+		m.lastPrune = time.Now().Add(-25 * time.Hour)
+		if err := m.runResticPrune(ctx); err != nil {
+			t.Errorf("runResticPrune() unexpected error: %v", err)
+		}
+		if pruneCalls != 3 {
+			t.Errorf("PruneRunner called %d times, want 3 after the window reopened", pruneCalls)
+		}
+	})
+}
+
+func TestManager_RunBackup_OutsideBackupWindow(t *testing.T) {
+	gameData := testsupport.CreateGameData(t)
+	testsupport.CreateBloatedSave(t, gameData.SavePath, 1)
+
+	resticRuns := 0
+	completeErr := fmt.Errorf("OnBackupComplete not called")
+	m := &Manager{
+		Interval:      time.Second,
+		BackupWindow:  windowAwayFrom(time.Now()),
+		Server:        gameData.Server(),
+		GameDataDir:   gameData.Dir,
+		StagingDir:    t.TempDir(),
+		BackupTimeout: 5 * time.Second,
+		ResticRunner: func(ctx context.Context, stagingDir string) error {
+			resticRuns++
+			return nil
+		},
+		OnBackupComplete: func(err error, duration time.Duration) {
+			completeErr = err
+		},
+	}
+
+	m.runBackup(context.Background())
+
+	// Incremental backups keep to the interval; the window only holds full ones
+	if completeErr != nil || resticRuns != 1 {
+		t.Errorf("runBackup() = %v with %d restic runs, want a backup outside the window", completeErr, resticRuns)
+	}
+	if !m.lastFullBackup.IsZero() {
+		t.Error("Full backup taken outside the backup window")
+	}
 }
 
 func TestManager_PerformBackup_RunsPruneAfterBackup(t *testing.T) {
@@ -2039,7 +2137,7 @@ func TestManager_PerformBackup_RunsPruneAfterBackup(t *testing.T) {
 
 		m := &Manager{
 			Interval:       time.Second,
-			Server:         &mockServer{},
+			Server:         &testsupport.Server{},
 			GameDataDir:    gameDataDir,
 			StagingDir:     stagingDir,
 			BackupTimeout:  2 * time.Second,
@@ -2113,7 +2211,7 @@ func TestManager_PerformBackup_RunsPruneAfterBackup(t *testing.T) {
 
 		m := &Manager{
 			Interval:       time.Second,
-			Server:         &mockServer{},
+			Server:         &testsupport.Server{},
 			GameDataDir:    gameDataDir,
 			StagingDir:     stagingDir,
 			BackupTimeout:  2 * time.Second,
@@ -2172,7 +2270,7 @@ func TestManager_PerformBackup_RunsPruneAfterBackup(t *testing.T) {
 
 		m := &Manager{
 			Interval:       time.Second,
-			Server:         &mockServer{},
+			Server:         &testsupport.Server{},
 			GameDataDir:    gameDataDir,
 			StagingDir:     stagingDir,
 			BackupTimeout:  2 * time.Second,
@@ -2213,3 +2311,240 @@ func TestManager_PerformBackup_RunsPruneAfterBackup(t *testing.T) {
 		}
 	})
 }
+
+// mockAutosaveChecker implements AutosaveChecker for testing.
+type mockAutosaveChecker struct {
+	mu         sync.Mutex
+	inProgress bool
+}
+
+func (m *mockAutosaveChecker) AutosaveInProgress() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.inProgress
+}
+
+func (m *mockAutosaveChecker) SetInProgress(inProgress bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inProgress = inProgress
+}
+
+func TestManager_WaitForAutosave(t *testing.T) {
+	t.Run("returns immediately when no autosave", func(t *testing.T) {
+		m := &Manager{AutosaveChecker: &mockAutosaveChecker{}}
+
+		start := time.Now()
+		if err := m.waitForAutosave(context.Background()); err != nil {
+			t.Fatalf("waitForAutosave() unexpected error: %v", err)
+		}
+		if time.Since(start) > 100*time.Millisecond {
+			t.Error("waitForAutosave() should not block when no autosave is running")
+		}
+	})
+
+	t.Run("waits until autosave finishes", func(t *testing.T) {
+		clk := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+		checker := &mockAutosaveChecker{inProgress: true}
+		m := &Manager{AutosaveChecker: checker, AutosaveMaxWait: 10 * time.Second, Clock: clk}
+
+		done := make(chan error, 1)
+		go func() { done <- m.waitForAutosave(context.Background()) }()
+
+		// Waiting on the max wait and the poll ticker
+		clk.BlockUntil(2)
+		clk.Advance(time.Second)
+		select {
+		case <-done:
+			t.Fatal("waitForAutosave() returned while the autosave was running")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		checker.SetInProgress(false)
+		clk.Advance(500 * time.Millisecond)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("waitForAutosave() unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("waitForAutosave() didn't return once the autosave finished")
+		}
+	})
+
+	t.Run("proceeds after max wait", func(t *testing.T) {
+		clk := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+		m := &Manager{
+			AutosaveChecker: &mockAutosaveChecker{inProgress: true},
+			AutosaveMaxWait: 2 * time.Minute,
+			Clock:           clk,
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- m.waitForAutosave(context.Background()) }()
+
+		clk.BlockUntil(2)
+		clk.Advance(2 * time.Minute)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("waitForAutosave() unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("waitForAutosave() didn't proceed after the max wait")
+		}
+	})
+
+	t.Run("defaults max wait when unset", func(t *testing.T) {
+		clk := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+		m := &Manager{
+			AutosaveChecker: &mockAutosaveChecker{inProgress: true},
+			Clock:           clk,
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- m.waitForAutosave(context.Background()) }()
+
+		clk.BlockUntil(2)
+		clk.Advance(time.Minute)
+		select {
+		case <-done:
+			t.Fatal("waitForAutosave() returned before the default max wait")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		clk.Advance(time.Minute)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("waitForAutosave() unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("waitForAutosave() didn't proceed after the default max wait")
+		}
+	})
+
+	t.Run("returns context error", func(t *testing.T) {
+		m := &Manager{
+			AutosaveChecker: &mockAutosaveChecker{inProgress: true},
+			AutosaveMaxWait: time.Minute,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		if err := m.waitForAutosave(ctx); err == nil {
+			t.Error("waitForAutosave() expected context error")
+		}
+	})
+}
+
+// mockProcessPauser implements ProcessPauser for testing.
+type mockProcessPauser struct {
+	mu       sync.Mutex
+	paused   bool
+	events   []string
+	pauseErr error
+}
+
+func (m *mockProcessPauser) Pause() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, "pause")
+	if m.pauseErr != nil {
+		return m.pauseErr
+	}
+	m.paused = true
+	return nil
+}
+
+func (m *mockProcessPauser) Resume() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, "resume")
+	m.paused = false
+	return nil
+}
+
+func (m *mockProcessPauser) IsPaused() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.paused
+}
+
+func (m *mockProcessPauser) getEvents() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string{}, m.events...)
+}
+
+func TestManager_SyncLiveFilesPaused(t *testing.T) {
+	t.Run("pauses around sync and resumes", func(t *testing.T) {
+		gameDataDir := t.TempDir()
+		os.MkdirAll(filepath.Join(gameDataDir, "Logs"), 0755)
+		os.WriteFile(filepath.Join(gameDataDir, "Logs", "server-main.log"), []byte("log"), 0644)
+
+		pauser := &mockProcessPauser{}
+		m := &Manager{
+			GameDataDir:    gameDataDir,
+			StagingDir:     t.TempDir(),
+			ProcessPauser:  pauser,
+			MaxServerPause: time.Minute,
+		}
+
+		if err := m.syncLiveFilesPaused(); err != nil {
+			t.Fatalf("syncLiveFilesPaused() unexpected error: %v", err)
+		}
+
+		if events := pauser.getEvents(); len(events) != 2 || events[0] != "pause" || events[1] != "resume" {
+			t.Errorf("Expected [pause resume], got %v", events)
+		}
+		if _, err := os.Stat(filepath.Join(m.StagingDir, "Logs", "server-main.log")); err != nil {
+			t.Errorf("Expected log file to be synced: %v", err)
+		}
+	})
+
+	t.Run("keeps the server paused when MaxServerPause is unset", func(t *testing.T) {
+		gameDataDir := t.TempDir()
+		os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), []byte("{}"), 0644)
+
+		pauser := &mockProcessPauser{}
+		m := &Manager{
+			GameDataDir:   gameDataDir,
+			StagingDir:    t.TempDir(),
+			ProcessPauser: pauser,
+		}
+
+		if got := m.maxServerPause(); got != 30*time.Second {
+			t.Errorf("maxServerPause() = %v, want 30s", got)
+		}
+		if err := m.syncLiveFilesPaused(); err != nil {
+			t.Fatalf("syncLiveFilesPaused() unexpected error: %v", err)
+		}
+		if events := pauser.getEvents(); len(events) != 2 || events[0] != "pause" || events[1] != "resume" {
+			t.Errorf("Expected [pause resume], got %v", events)
+		}
+	})
+
+	t.Run("copies anyway when pause fails", func(t *testing.T) {
+		gameDataDir := t.TempDir()
+		os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), []byte("{}"), 0644)
+
+		pauser := &mockProcessPauser{pauseErr: fmt.Errorf("no such process")}
+		m := &Manager{
+			GameDataDir:   gameDataDir,
+			StagingDir:    t.TempDir(),
+			ProcessPauser: pauser,
+		}
+
+		if err := m.syncLiveFilesPaused(); err != nil {
+			t.Fatalf("syncLiveFilesPaused() unexpected error: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(m.StagingDir, "serverconfig.json")); err != nil {
+			t.Errorf("Expected config to be synced: %v", err)
+		}
+		if events := pauser.getEvents(); len(events) != 1 {
+			t.Errorf("Resume should not be called when pause failed, got %v", events)
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/renorris/vintagestory-restic/internal/snapshotmeta"
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// MetadataFileName is the name of the file at the root of the staging
+// directory, and so of every snapshot, that describes what produced it.
+const MetadataFileName = snapshotmeta.FileName
+
+// ServerVersionTag is the restic tag prefix for the server version, as in
+// "server_version=1.21.6". Snapshots can be filtered with
+// `restic snapshots --tag server_version=1.21.6`.
+const ServerVersionTag = "server_version="
+
+// GameVersionReporter reports the game version of the running server.
+// This is satisfied by *server.Server.
+type GameVersionReporter interface {
+	// GameVersion returns the version from the server's startup banner,
+	// or "" if it isn't known yet.
+	GameVersion() string
+}
+
+// ServerBinaries describes the server archive the running binaries came from.
+type ServerBinaries struct {
+	URL     string
+	ETag    string
+	Version string
+}
+
+// SnapshotMetadata is written to MetadataFileName in each snapshot.
+type SnapshotMetadata = snapshotmeta.Metadata
+
+// SetServerBinaries records a newly installed server archive, for snapshots
+// taken from now on. It waits for a running backup to finish.
+func (m *Manager) SetServerBinaries(b ServerBinaries) {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	m.ServerBinaries = b
+}
+
+// snapshotMetadata describes the server the next snapshot is taken from.
+func (m *Manager) snapshotMetadata() SnapshotMetadata {
+	meta := SnapshotMetadata{
+		ArchiveURL:     m.ServerBinaries.URL,
+		ArchiveETag:    m.ServerBinaries.ETag,
+		ArchiveVersion: m.ServerBinaries.Version,
+	}
+	if m.GameVersion != nil {
+		meta.ServerVersion = m.GameVersion.GameVersion()
+	}
+	if meta.ServerVersion == "" {
+		meta.ServerVersion = meta.ArchiveVersion
+	}
+	return meta
+}
+
+// writeMetadata writes the snapshot metadata to the staging directory. The
+// file is only rewritten when its content changes, so restic sees it as
+// unchanged between snapshots of the same server version.
+func (m *Manager) writeMetadata(meta SnapshotMetadata) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot metadata: %w", err)
+	}
+	data = append(data, '\n')
+
+	path := filepath.Join(m.stagingTarget(), MetadataFileName)
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	// Replace rather than truncate the file, which may be a hard link into
+	// the last staging generation
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to replace snapshot metadata: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot metadata: %w", err)
+	}
+	return nil
+}
+
+// resticTags returns the tags for a snapshot described by meta.
+func resticTags(meta SnapshotMetadata) []string {
+	if meta.ServerVersion == "" {
+		return nil
+	}
+	// restic splits --tag values on commas
+	return []string{ServerVersionTag + strings.ReplaceAll(meta.ServerVersion, ",", "_")}
+}
+
+// ErrSnapshotTooNew is returned by CheckServerCompatibility when a snapshot
+// was written by a newer server than the one it would be restored into.
+var ErrSnapshotTooNew = errors.New("snapshot was written by a newer server version")
+
+// CheckServerCompatibility returns an error wrapping ErrSnapshotTooNew if meta
+// records a newer server version than serverVersion. Loading a world in an
+// older server than the one that saved it can corrupt it. If either version
+// is unknown, nothing can be checked and nil is returned.
+func CheckServerCompatibility(meta *SnapshotMetadata, serverVersion string) error {
+	if meta == nil || meta.ServerVersion == "" || serverVersion == "" {
+		return nil
+	}
+
+	cmp, err := CompareGameVersions(meta.ServerVersion, serverVersion)
+	if err != nil {
+		return fmt.Errorf("failed to compare server versions: %w", err)
+	}
+	if cmp > 0 {
+		return fmt.Errorf("%w: saved by %s, restoring into %s", ErrSnapshotTooNew, meta.ServerVersion, serverVersion)
+	}
+	return nil
+}
+
+// VerifyTreeDigest checks a restored tree against the digest meta records
+// for the world named saveName. It returns false without error if no digest
+// was recorded, as for snapshots from before digests or with
+// BACKUP_TREE_DIGEST disabled.
+func VerifyTreeDigest(ctx context.Context, meta *SnapshotMetadata, saveName, treeDir string) (bool, error) {
+	if meta == nil || meta.TreeDigests[saveName] == "" {
+		return false, nil
+	}
+	if err := vcdbtree.VerifyDigest(ctx, treeDir, meta.TreeDigests[saveName]); err != nil {
+		return true, fmt.Errorf("restored world %s doesn't match the snapshot: %w", saveName, err)
+	}
+	return true, nil
+}
+
+// CompareGameVersions compares two game versions such as "1.21.6" or
+// "1.22.0-rc.2", returning -1, 0, or 1. A pre-release sorts before the
+// release it precedes; pre-release labels are compared as plain strings.
+func CompareGameVersions(a, b string) (int, error) {
+	aNums, aPre, err := splitGameVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	bNums, bPre, err := splitGameVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range aNums {
+		switch {
+		case aNums[i] < bNums[i]:
+			return -1, nil
+		case aNums[i] > bNums[i]:
+			return 1, nil
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0, nil
+	case aPre == "":
+		return 1, nil
+	case bPre == "":
+		return -1, nil
+	case aPre < bPre:
+		return -1, nil
+	default:
+		return 1, nil
+	}
+}
+
+// splitGameVersion splits a version into its three numbers and pre-release label.
+func splitGameVersion(v string) (nums [3]int, pre string, err error) {
+	core := strings.TrimPrefix(v, "v")
+	if i := strings.IndexByte(core, '-'); i >= 0 {
+		core, pre = core[:i], core[i+1:]
+	}
+
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return nums, "", fmt.Errorf("invalid game version %q: want MAJOR.MINOR.PATCH", v)
+	}
+	for i, part := range parts {
+		nums[i], err = strconv.Atoi(part)
+		if err != nil || nums[i] < 0 {
+			return nums, "", fmt.Errorf("invalid game version %q", v)
+		}
+	}
+	return nums, pre, nil
+}
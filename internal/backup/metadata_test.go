@@ -0,0 +1,176 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/snapshotmeta"
+)
+
+// fakeGameVersion implements GameVersionReporter for testing.
+type fakeGameVersion string
+
+func (v fakeGameVersion) GameVersion() string { return string(v) }
+
+func TestSnapshotMetadata(t *testing.T) {
+	binaries := ServerBinaries{
+		URL:     "https://example.com/vs_server_linux-x64_1.21.5.tar.gz",
+		ETag:    "abc",
+		Version: "1.21.5",
+	}
+
+	t.Run("banner version preferred", func(t *testing.T) {
+		m := &Manager{GameVersion: fakeGameVersion("1.21.6"), ServerBinaries: binaries}
+		meta := m.snapshotMetadata()
+		if meta.ServerVersion != "1.21.6" {
+			t.Errorf("ServerVersion = %q, want 1.21.6", meta.ServerVersion)
+		}
+		if meta.ArchiveVersion != "1.21.5" || meta.ArchiveURL != binaries.URL || meta.ArchiveETag != "abc" {
+			t.Errorf("archive fields not copied: %+v", meta)
+		}
+	})
+
+	t.Run("falls back to archive version", func(t *testing.T) {
+		m := &Manager{GameVersion: fakeGameVersion(""), ServerBinaries: binaries}
+		if got := m.snapshotMetadata().ServerVersion; got != "1.21.5" {
+			t.Errorf("ServerVersion = %q, want 1.21.5", got)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		m := &Manager{}
+		meta := m.snapshotMetadata()
+		if !reflect.DeepEqual(meta, SnapshotMetadata{}) {
+			t.Errorf("expected empty metadata, got %+v", meta)
+		}
+		if tags := resticTags(meta); tags != nil {
+			t.Errorf("expected no tags, got %v", tags)
+		}
+	})
+}
+
+func TestResticTags(t *testing.T) {
+	tags := resticTags(SnapshotMetadata{ServerVersion: "1.21.6"})
+	if len(tags) != 1 || tags[0] != "server_version=1.21.6" {
+		t.Errorf("resticTags() = %v", tags)
+	}
+}
+
+func TestWriteMetadata(t *testing.T) {
+	stagingDir := t.TempDir()
+	m := &Manager{StagingDir: stagingDir}
+	path := filepath.Join(stagingDir, MetadataFileName)
+
+	meta := SnapshotMetadata{ServerVersion: "1.21.6", TreeDigests: map[string]string{"world": "sha256:00"}}
+	if err := m.writeMetadata(meta); err != nil {
+		t.Fatalf("writeMetadata() error: %v", err)
+	}
+
+	// Unchanged metadata must not touch the file, so restic sees no change
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Chtimes() error: %v", err)
+	}
+	if err := m.writeMetadata(meta); err != nil {
+		t.Fatalf("writeMetadata() error: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error: %v", err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("unchanged metadata was rewritten")
+	}
+
+	got, err := snapshotmeta.Read(stagingDir)
+	if err != nil {
+		t.Fatalf("snapshotmeta.Read() error: %v", err)
+	}
+	if got == nil || !reflect.DeepEqual(*got, meta) {
+		t.Errorf("snapshotmeta.Read() = %+v, want %+v", got, meta)
+	}
+
+	meta.ServerVersion = "1.21.7"
+	if err := m.writeMetadata(meta); err != nil {
+		t.Fatalf("writeMetadata() error: %v", err)
+	}
+	got, _ = snapshotmeta.Read(stagingDir)
+	if got == nil || got.ServerVersion != "1.21.7" {
+		t.Errorf("changed metadata not written: %+v", got)
+	}
+}
+
+func TestCompareGameVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.21.6", "1.21.6", 0},
+		{"1.21.6", "1.21.5", 1},
+		{"1.20.12", "1.21.0", -1},
+		{"1.21.10", "1.21.9", 1},
+		{"v1.21.6", "1.21.6", 0},
+		{"1.22.0-rc.2", "1.22.0", -1},
+		{"1.22.0", "1.22.0-rc.2", 1},
+		{"1.22.0-rc.1", "1.22.0-rc.2", -1},
+		{"1.22.0-pre.1", "1.21.6", 1},
+	}
+
+	for _, tt := range tests {
+		got, err := CompareGameVersions(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("CompareGameVersions(%q, %q) error: %v", tt.a, tt.b, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CompareGameVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "1.21", "1.21.x", "latest"} {
+		if _, err := CompareGameVersions(bad, "1.21.6"); err == nil {
+			t.Errorf("CompareGameVersions(%q) expected error", bad)
+		}
+	}
+}
+
+func TestCheckServerCompatibility(t *testing.T) {
+	meta := &SnapshotMetadata{ServerVersion: "1.21.6"}
+
+	if err := CheckServerCompatibility(meta, "1.21.6"); err != nil {
+		t.Errorf("same version: unexpected error: %v", err)
+	}
+	if err := CheckServerCompatibility(meta, "1.22.0"); err != nil {
+		t.Errorf("newer server: unexpected error: %v", err)
+	}
+	if err := CheckServerCompatibility(meta, "1.21.5"); !errors.Is(err, ErrSnapshotTooNew) {
+		t.Errorf("older server: error = %v, want ErrSnapshotTooNew", err)
+	}
+
+	// Unknown versions can't be checked
+	if err := CheckServerCompatibility(nil, "1.21.5"); err != nil {
+		t.Errorf("no metadata: unexpected error: %v", err)
+	}
+	if err := CheckServerCompatibility(&SnapshotMetadata{}, "1.21.5"); err != nil {
+		t.Errorf("no recorded version: unexpected error: %v", err)
+	}
+	if err := CheckServerCompatibility(meta, ""); err != nil {
+		t.Errorf("no installed version: unexpected error: %v", err)
+	}
+
+	if err := CheckServerCompatibility(&SnapshotMetadata{ServerVersion: "garbage"}, "1.21.5"); err == nil || errors.Is(err, ErrSnapshotTooNew) {
+		t.Errorf("unparseable version: error = %v, want a comparison error", err)
+	}
+}
+
+func TestSetServerBinaries(t *testing.T) {
+	m := &Manager{ServerBinaries: ServerBinaries{Version: "1.21.5"}}
+	m.SetServerBinaries(ServerBinaries{URL: "https://example.com/vs_server_linux-x64_1.21.6.tar.gz", ETag: "def", Version: "1.21.6"})
+	if got := m.snapshotMetadata().ArchiveVersion; got != "1.21.6" {
+		t.Errorf("ArchiveVersion = %q, want 1.21.6", got)
+	}
+}
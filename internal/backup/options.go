@@ -0,0 +1,353 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/clock"
+)
+
+// Option configures a Manager built by NewManager with something Config
+// doesn't describe, such as the server it backs up or a replacement for the
+// way it runs restic.
+type Option func(*Manager)
+
+// NewManager returns a Manager configured by cfg and opts, for use outside
+// the launcher. cfg is checked the way LoadConfig checks the environment, so
+// a Config built by hand can't hold values LoadConfig would reject.
+//
+// When backups are enabled, a server is required (WithServer). If the
+// server also reports booting, finished backups, or the game version, it is
+// used for those unless another checker is given. Pausing the server during
+// syncs requires WithProcessPauser. GameDataDir defaults to
+// DefaultGameDataDir, and the time of the last backup is kept in the
+// last-backup file of the cache directory when backups are enabled.
+//
+// Settings Config leaves at zero take the Manager's own defaults, as they
+// would in a Manager literal. Call Start to begin periodic backups.
+func NewManager(cfg Config, opts ...Option) (*Manager, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		Interval:              cfg.Interval,
+		FixedRate:             cfg.FixedRate,
+		ChangeDetection:       cfg.ChangeDetection,
+		StagingStrategy:       cfg.StagingStrategy,
+		GenBackupCommand:      cfg.GenBackupCommand,
+		BackupsDir:            cfg.BackupsDir,
+		BackupFilePattern:     cfg.BackupFilePattern,
+		PauseWhenNoPlayers:    cfg.PauseWhenNoPlayers,
+		PruneRetention:        cfg.PruneRetention,
+		PruneGroupBy:          cfg.PruneGroupBy,
+		ResticHost:            cfg.ResticHost,
+		World:                 cfg.World,
+		BackupWindow:          cfg.BackupWindow,
+		PruneWindow:           cfg.PruneWindow,
+		CheckInterval:         cfg.CheckInterval,
+		MaintenanceMaxDefer:   cfg.MaintenanceMaxDefer,
+		AutosaveMaxWait:       cfg.AutosaveMaxWait,
+		MaxServerPause:        cfg.MaxServerPause,
+		SyncWorkers:           cfg.SyncWorkers,
+		SyncPolicies:          cfg.SyncPolicies,
+		WriteRateLimit:        cfg.WriteRateLimit,
+		WriteSyncBytes:        cfg.WriteSyncBytes,
+		ResticIOPriority:      cfg.ResticIOPriority,
+		CompressLogs:          cfg.CompressLogs,
+		SkipTreeDigest:        cfg.SkipTreeDigest,
+		TrimAreas:             cfg.TrimAreas,
+		WorldWidth:            cfg.WorldWidth,
+		TreeLayout:            cfg.TreeLayout,
+		LocalKeepVCDBS:        cfg.LocalKeepVCDBS,
+		ModsInterval:          cfg.ModsInterval,
+		DriftInterval:         cfg.DriftInterval,
+		CacheCleanupInterval:  cfg.CacheCleanupInterval,
+		CacheGracePeriod:      cfg.CacheGracePeriod,
+		CoverageIgnore:        cfg.CoverageIgnore,
+		FailureReportInterval: cfg.FailureReportInterval,
+		IntegrityTolerance:    cfg.IntegrityTolerance,
+		HighChangeThreshold:   cfg.HighChangeThreshold,
+		SplitProgressInterval: cfg.SplitProgressInterval,
+		StageTimeouts:         cfg.StageTimeouts,
+		RetryBackoff:          cfg.RetryBackoff,
+		Hooks:                 cfg.Hooks,
+		Announcements:         cfg.Announcements,
+		GameDataDir:           DefaultGameDataDir,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if cfg.Enabled && m.LastBackupFile == "" {
+		m.LastBackupFile = m.defaultLastBackupFile()
+	}
+
+	// The server often reports more than it is asked to
+	if m.BootChecker == nil {
+		m.BootChecker, _ = m.Server.(BootChecker)
+	}
+	if m.BackupCompletionWaiter == nil {
+		m.BackupCompletionWaiter, _ = m.Server.(BackupCompletionWaiter)
+	}
+	if m.GameVersion == nil {
+		m.GameVersion, _ = m.Server.(GameVersionReporter)
+	}
+
+	switch {
+	case cfg.Enabled && m.Server == nil:
+		return nil, errors.New("backups are enabled but no server is set (use WithServer)")
+	case cfg.PauseServerDuringLiveFileCopy && m.ProcessPauser == nil:
+		return nil, errors.New("PauseServerDuringLiveFileCopy is set but nothing can pause the server (use WithProcessPauser)")
+	case !cfg.PauseServerDuringLiveFileCopy:
+		m.ProcessPauser = nil
+	}
+	return m, nil
+}
+
+// validate checks cfg the way LoadConfig checks the environment.
+func (cfg *Config) validate() error {
+	if cfg.Enabled && cfg.Interval <= 0 {
+		return fmt.Errorf("Interval must be positive, got %v", cfg.Interval)
+	}
+
+	parsers := []struct {
+		name  string
+		value string
+		parse func(string) (string, error)
+	}{
+		{"ChangeDetection", cfg.ChangeDetection, ParseChangeDetection},
+		{"StagingStrategy", cfg.StagingStrategy, ParseStagingStrategy},
+		{"BackupFilePattern", cfg.BackupFilePattern, ParseBackupFilePattern},
+		{"PruneGroupBy", cfg.PruneGroupBy, ParseGroupBy},
+		{"World", cfg.World, ParseWorldName},
+		{"Catchup", cfg.Catchup, ParseCatchupPolicy},
+		{"ResticIOPriority", cfg.ResticIOPriority, ParseIOPriority},
+	}
+	for _, p := range parsers {
+		if _, err := p.parse(p.value); err != nil {
+			return fmt.Errorf("invalid %s: %w", p.name, err)
+		}
+	}
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"CheckInterval", cfg.CheckInterval},
+		{"MaintenanceMaxDefer", cfg.MaintenanceMaxDefer},
+		{"AutosaveMaxWait", cfg.AutosaveMaxWait},
+		{"MaxServerPause", cfg.MaxServerPause},
+		{"ModsInterval", cfg.ModsInterval},
+		{"DriftInterval", cfg.DriftInterval},
+		{"CacheCleanupInterval", cfg.CacheCleanupInterval},
+		{"CacheGracePeriod", cfg.CacheGracePeriod},
+		{"FailureReportInterval", cfg.FailureReportInterval},
+		{"SplitProgressInterval", cfg.SplitProgressInterval},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %v", d.name, d.value)
+		}
+	}
+	for stage, d := range cfg.StageTimeouts {
+		if d < 0 {
+			return fmt.Errorf("timeout of stage %s must not be negative, got %v", stage, d)
+		}
+	}
+	for _, d := range cfg.RetryBackoff {
+		if d < 0 {
+			return fmt.Errorf("RetryBackoff must not hold negative waits, got %v", d)
+		}
+	}
+
+	if cfg.HighChangeThreshold > 1 {
+		return fmt.Errorf("HighChangeThreshold must be at most 1, got %v", cfg.HighChangeThreshold)
+	}
+
+	counts := []struct {
+		name  string
+		value int64
+	}{
+		{"RequiredMaxFailures", int64(cfg.RequiredMaxFailures)},
+		{"SyncWorkers", int64(cfg.SyncWorkers)},
+		{"WriteRateLimit", cfg.WriteRateLimit},
+		{"WriteSyncBytes", cfg.WriteSyncBytes},
+		{"WorldWidth", cfg.WorldWidth},
+		{"LocalKeepVCDBS", int64(cfg.LocalKeepVCDBS)},
+	}
+	for _, c := range counts {
+		if c.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %d", c.name, c.value)
+		}
+	}
+	return nil
+}
+
+// WithServer sets the server backups are taken from. Commands such as
+// /genbackup are sent to it.
+func WithServer(s ServerCommander) Option {
+	return func(m *Manager) { m.Server = s }
+}
+
+// WithBootChecker sets what reports whether the server has booted, when the
+// server passed to WithServer doesn't.
+func WithBootChecker(b BootChecker) Option {
+	return func(m *Manager) { m.BootChecker = b }
+}
+
+// WithBackupCompletionWaiter sets what waits for the server to finish a
+// backup copy, when the server passed to WithServer doesn't.
+func WithBackupCompletionWaiter(w BackupCompletionWaiter) Option {
+	return func(m *Manager) { m.BackupCompletionWaiter = w }
+}
+
+// WithPlayerChecker sets what counts the players online.
+func WithPlayerChecker(p PlayerCheckerInterface) Option {
+	return func(m *Manager) { m.PlayerChecker = p }
+}
+
+// WithAutosaveChecker sets what reports whether the server is autosaving.
+func WithAutosaveChecker(a AutosaveChecker) Option {
+	return func(m *Manager) { m.AutosaveChecker = a }
+}
+
+// WithProcessPauser sets what suspends the server while live files are
+// synced. It is only used if Config.PauseServerDuringLiveFileCopy is set.
+func WithProcessPauser(p ProcessPauser) Option {
+	return func(m *Manager) { m.ProcessPauser = p }
+}
+
+// WithGameDataDir sets the server's data directory.
+func WithGameDataDir(dir string) Option {
+	return func(m *Manager) { m.GameDataDir = dir }
+}
+
+// WithStagingDir sets the directory restic backs up.
+func WithStagingDir(dir string) Option {
+	return func(m *Manager) { m.StagingDir = dir }
+}
+
+// WithCacheDir sets the cache volume audited for unused entries.
+func WithCacheDir(dir string) Option {
+	return func(m *Manager) { m.CacheDir = dir }
+}
+
+// WithLastBackupFile sets where the time of the last backup is kept, instead
+// of the last-backup file in the cache directory.
+func WithLastBackupFile(path string) Option {
+	return func(m *Manager) { m.LastBackupFile = path }
+}
+
+// WithClock sets the clock backups are scheduled by.
+func WithClock(c clock.Clock) Option {
+	return func(m *Manager) { m.Clock = c }
+}
+
+// WithResticRunner replaces how restic backup is run.
+func WithResticRunner(r ResticRunner) Option {
+	return func(m *Manager) { m.ResticRunner = r }
+}
+
+// WithPruneRunner replaces how restic forget --prune is run.
+func WithPruneRunner(r PruneRunner) Option {
+	return func(m *Manager) { m.PruneRunner = r }
+}
+
+// WithCheckRunner replaces how restic check is run.
+func WithCheckRunner(r CheckRunner) Option {
+	return func(m *Manager) { m.CheckRunner = r }
+}
+
+// WithCommandRunner replaces how shell commands are run.
+func WithCommandRunner(r CommandRunner) Option {
+	return func(m *Manager) { m.CommandRunner = r }
+}
+
+// WithOutputRunner replaces how restic commands whose output is read are
+// run.
+func WithOutputRunner(r OutputRunner) Option {
+	return func(m *Manager) { m.OutputRunner = r }
+}
+
+// WithVCDBTreeSplitter replaces how save files are split into the staging
+// tree.
+func WithVCDBTreeSplitter(s VCDBTreeSplitter) Option {
+	return func(m *Manager) { m.VCDBTreeSplitter = s }
+}
+
+// WithBackupsWatcher replaces how new backup copies are noticed.
+func WithBackupsWatcher(w BackupFileWatcher) Option {
+	return func(m *Manager) { m.BackupsWatcher = w }
+}
+
+// WithResticEnv sets the environment restic runs with, as "KEY=value"
+// pairs, instead of the filtered environment of the process.
+func WithResticEnv(env []string) Option {
+	return func(m *Manager) { m.ResticEnv = env }
+}
+
+// WithResticVersion sets the restic version found by DetectRestic.
+func WithResticVersion(v ResticVersion) Option {
+	return func(m *Manager) { m.ResticVersion = v }
+}
+
+// WithGameVersion sets what reports the game version recorded in
+// snapshots, when the server passed to WithServer doesn't.
+func WithGameVersion(g GameVersionReporter) Option {
+	return func(m *Manager) { m.GameVersion = g }
+}
+
+// WithServerBinaries sets the server archive recorded in snapshots. Once
+// the Manager is started, change it with SetServerBinaries.
+func WithServerBinaries(b ServerBinaries) Option {
+	return func(m *Manager) { m.ServerBinaries = b }
+}
+
+// WithRestarter sets what stops and restarts the server for Compact.
+func WithRestarter(r ServerRestarter) Option {
+	return func(m *Manager) { m.Restarter = r }
+}
+
+// WithRawUploader sets what receives a copy of each raw .vcdbs backup
+// file before it is split.
+func WithRawUploader(u RawBackupUploader) Option {
+	return func(m *Manager) { m.RawUploader = u }
+}
+
+// WithStagingPopulators adds populators that put files of their own in
+// the staging directory before each snapshot, in order.
+func WithStagingPopulators(p ...StagingPopulator) Option {
+	return func(m *Manager) { m.StagingPopulators = append(m.StagingPopulators, p...) }
+}
+
+// WithBackupTimeout sets how long to wait for a backup file to appear.
+func WithBackupTimeout(d time.Duration) Option {
+	return func(m *Manager) { m.BackupTimeout = d }
+}
+
+// WithOnStateChange sets a function called when the Manager's state
+// changes.
+func WithOnStateChange(fn func(ManagerState)) Option {
+	return func(m *Manager) { m.OnStateChange = fn }
+}
+
+// WithOnBackupStart sets a function called when a backup starts.
+func WithOnBackupStart(fn func()) Option {
+	return func(m *Manager) { m.OnBackupStart = fn }
+}
+
+// WithOnBackupComplete sets a function called when a backup finishes or is
+// skipped.
+func WithOnBackupComplete(fn func(err error, duration time.Duration)) Option {
+	return func(m *Manager) { m.OnBackupComplete = fn }
+}
+
+// WithOnBackupStats sets a function called with the statistics of each
+// backup, which report the topRegions busiest map regions.
+func WithOnBackupStats(fn func(stats BackupStats), topRegions int) Option {
+	return func(m *Manager) {
+		m.OnBackupStats = fn
+		m.StatsTopRegions = topRegions
+	}
+}
@@ -0,0 +1,156 @@
+package backup
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+// bootingServer is a server that also reports booting and finished backups,
+// as server.Server does.
+type bootingServer struct {
+	testsupport.Server
+	testsupport.BootChecker
+	mockBackupCompletionWaiter
+}
+
+func TestNewManager(t *testing.T) {
+	cfg := Config{
+		Enabled:         true,
+		Interval:        time.Hour,
+		ChangeDetection: ChangeDetectionCtime,
+		PruneRetention:  "--keep-daily 7",
+		LocalKeepVCDBS:  2,
+	}
+	srv := &testsupport.Server{}
+	runner := &testsupport.ResticRunner{}
+
+	m, err := NewManager(cfg, WithServer(srv), WithResticRunner(runner.Run), WithStagingDir("/tmp/staging"))
+	if err != nil {
+		t.Fatalf("NewManager() error: %v", err)
+	}
+	if m.Interval != time.Hour || m.ChangeDetection != ChangeDetectionCtime ||
+		m.PruneRetention != "--keep-daily 7" || m.LocalKeepVCDBS != 2 {
+		t.Errorf("NewManager() didn't copy the config: %+v", m)
+	}
+	if m.Server != srv || m.ResticRunner == nil || m.StagingDir != "/tmp/staging" {
+		t.Error("NewManager() didn't apply the options")
+	}
+	if m.GameDataDir != DefaultGameDataDir {
+		t.Errorf("GameDataDir = %q, want %q", m.GameDataDir, DefaultGameDataDir)
+	}
+	if want := filepath.Join(DefaultCacheDir, "last-backup"); m.LastBackupFile != want {
+		t.Errorf("LastBackupFile = %q, want %q", m.LastBackupFile, want)
+	}
+	if m.BootChecker != nil || m.BackupCompletionWaiter != nil {
+		t.Error("NewManager() set checkers the server doesn't implement")
+	}
+}
+
+func TestNewManager_Disabled(t *testing.T) {
+	m, err := NewManager(Config{GenBackupCommand: "/genbackup"})
+	if err != nil {
+		t.Fatalf("NewManager() error: %v", err)
+	}
+	if m.GenBackupCommand != "/genbackup" {
+		t.Errorf("GenBackupCommand = %q, want /genbackup", m.GenBackupCommand)
+	}
+	if m.LastBackupFile != "" {
+		t.Errorf("LastBackupFile = %q, want none when backups are disabled", m.LastBackupFile)
+	}
+}
+
+func TestNewManager_LastBackupFileInCacheDir(t *testing.T) {
+	cfg := Config{Enabled: true, Interval: time.Hour}
+	m, err := NewManager(cfg, WithServer(&testsupport.Server{}), WithCacheDir("/srv/cache"))
+	if err != nil {
+		t.Fatalf("NewManager() error: %v", err)
+	}
+	if want := "/srv/cache/last-backup"; m.LastBackupFile != want {
+		t.Errorf("LastBackupFile = %q, want %q", m.LastBackupFile, want)
+	}
+
+	m, err = NewManager(cfg, WithServer(&testsupport.Server{}), WithLastBackupFile("/data/last"))
+	if err != nil {
+		t.Fatalf("NewManager() error: %v", err)
+	}
+	if m.LastBackupFile != "/data/last" {
+		t.Errorf("LastBackupFile = %q, want /data/last", m.LastBackupFile)
+	}
+}
+
+func TestNewManager_ServerCheckers(t *testing.T) {
+	cfg := Config{Enabled: true, Interval: time.Hour}
+	srv := &bootingServer{}
+
+	m, err := NewManager(cfg, WithServer(srv))
+	if err != nil {
+		t.Fatalf("NewManager() error: %v", err)
+	}
+	if m.BootChecker != srv || m.BackupCompletionWaiter != srv {
+		t.Error("NewManager() didn't use the server's own checkers")
+	}
+
+	booted := testsupport.NewBootChecker(true)
+	m, err = NewManager(cfg, WithServer(srv), WithBootChecker(booted))
+	if err != nil {
+		t.Fatalf("NewManager() error: %v", err)
+	}
+	if m.BootChecker != booted {
+		t.Error("NewManager() replaced the boot checker given")
+	}
+}
+
+func TestNewManager_ProcessPauser(t *testing.T) {
+	pauser := &mockProcessPauser{}
+	srv := WithServer(&testsupport.Server{})
+
+	m, err := NewManager(Config{Enabled: true, Interval: time.Hour}, srv, WithProcessPauser(pauser))
+	if err != nil {
+		t.Fatalf("NewManager() error: %v", err)
+	}
+	if m.ProcessPauser != nil {
+		t.Error("ProcessPauser set without PauseServerDuringLiveFileCopy")
+	}
+
+	cfg := Config{Enabled: true, Interval: time.Hour, PauseServerDuringLiveFileCopy: true}
+	m, err = NewManager(cfg, srv, WithProcessPauser(pauser))
+	if err != nil {
+		t.Fatalf("NewManager() error: %v", err)
+	}
+	if m.ProcessPauser != pauser {
+		t.Error("ProcessPauser not set with PauseServerDuringLiveFileCopy")
+	}
+
+	if _, err := NewManager(cfg, srv); err == nil {
+		t.Error("NewManager() expected error for PauseServerDuringLiveFileCopy without a pauser")
+	}
+}
+
+func TestNewManager_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"no interval", Config{Enabled: true}, "Interval"},
+		{"no server", Config{Enabled: true, Interval: time.Hour}, "no server"},
+		{"change detection", Config{ChangeDetection: "sometimes"}, "ChangeDetection"},
+		{"world", Config{World: "../other"}, "World"},
+		{"group by", Config{PruneGroupBy: "colour"}, "PruneGroupBy"},
+		{"negative duration", Config{CheckInterval: -time.Hour}, "CheckInterval"},
+		{"negative stage timeout", Config{StageTimeouts: map[Stage]time.Duration{StagePrune: -time.Second}}, "stage"},
+		{"negative count", Config{SyncWorkers: -1}, "SyncWorkers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewManager(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewManager() error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DefaultGameDataDir is the game data directory used when GameDataDir is empty.
+	DefaultGameDataDir = "/gamedata"
+
+	// DefaultStagingDir is the staging directory used when StagingDir is empty.
+	DefaultStagingDir = "/backupcache/staging"
+)
+
+// ValidatePaths canonicalizes GameDataDir, StagingDir, CompactDir, RollbackDir,
+// and LocalDir and makes sure they don't overlap. A staging directory inside the game data directory
+// (or the other way around) would make every backup include the previous one.
+//
+// On success the fields are replaced with their canonical form, with symlinks
+// resolved. The returned warnings describe setups that work but are likely
+// mistakes, such as a default path that isn't backed by a mounted volume.
+func (m *Manager) ValidatePaths() (warnings []string, err error) {
+	m.applyPathDefaults()
+
+	gameDataDir, err := canonicalPath(m.GameDataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve game data directory: %w", err)
+	}
+	info, err := os.Stat(gameDataDir)
+	if err != nil {
+		return nil, fmt.Errorf("game data directory %s is not accessible: %w", m.GameDataDir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("game data directory %s is not a directory", m.GameDataDir)
+	}
+
+	stagingDir, err := canonicalPath(m.StagingDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve staging directory: %w", err)
+	}
+
+	// Backups may be a symlink to another volume, so resolve it separately
+	backupsDir, err := canonicalPath(m.backupsDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve backups directory: %w", err)
+	}
+
+	compactDir, err := canonicalPath(m.compactDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve compaction directory: %w", err)
+	}
+
+	rollbackDir, err := canonicalPath(m.rollbackDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve rollback directory: %w", err)
+	}
+
+	localDir, err := canonicalPath(m.localDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve local copies directory: %w", err)
+	}
+
+	dirs := []struct{ name, path string }{
+		{"game data directory", gameDataDir},
+		{"staging directory", stagingDir},
+		{"backups directory", backupsDir},
+		{"compaction directory", compactDir},
+		{"rollback directory", rollbackDir},
+	}
+	if m.LocalKeepVCDBS > 0 {
+		dirs = append(dirs, struct{ name, path string }{"local copies directory", localDir})
+	}
+	for i, a := range dirs {
+		for _, b := range dirs[i+1:] {
+			// Backups lives inside the game data directory by design
+			if a.path == gameDataDir && b.path == backupsDir {
+				continue
+			}
+			if err := checkNoOverlap(a.name, a.path, b.name, b.path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if m.GameDataDir == DefaultGameDataDir && onRootFilesystem(gameDataDir) {
+		warnings = append(warnings, fmt.Sprintf("%s is not a mounted volume; the world will be lost when the container is removed", DefaultGameDataDir))
+	}
+	if m.StagingDir == m.defaultStagingDir() && onRootFilesystem(stagingDir) {
+		warnings = append(warnings, fmt.Sprintf("%s is not on a mounted volume; the staging cache will be rebuilt from scratch after every container restart", m.StagingDir))
+	}
+
+	m.GameDataDir = gameDataDir
+	m.StagingDir = stagingDir
+	m.CompactDir = compactDir
+	m.RollbackDir = rollbackDir
+	m.LocalDir = localDir
+
+	return warnings, nil
+}
+
+// applyPathDefaults fills in the default game data and staging directories.
+func (m *Manager) applyPathDefaults() {
+	if m.GameDataDir == "" {
+		m.GameDataDir = DefaultGameDataDir
+	}
+	if m.StagingDir == "" {
+		m.StagingDir = m.defaultStagingDir()
+	}
+}
+
+// defaultStagingDir returns the staging directory used when StagingDir is
+// empty: DefaultStagingDir, or the world's own directory if World is set.
+func (m *Manager) defaultStagingDir() string {
+	if m.World != "" {
+		return filepath.Join(m.worldsDir(), m.World)
+	}
+	return DefaultStagingDir
+}
+
+// canonicalPath returns the absolute form of path with symlinks resolved.
+// The path doesn't need to exist: symlinks are resolved for the longest
+// existing prefix and the rest is appended as-is.
+func canonicalPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	existing := abs
+	var rest []string
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return abs, nil
+		}
+		rest = append([]string{filepath.Base(existing)}, rest...)
+		existing = parent
+	}
+}
+
+// isWithin reports whether path is dir or a descendant of it.
+// Both paths must be clean and absolute.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// checkNoOverlap returns an error if either directory contains the other.
+func checkNoOverlap(aName, a, bName, b string) error {
+	switch {
+	case a == b:
+		return fmt.Errorf("%s and %s are the same directory (%s)", aName, bName, a)
+	case isWithin(b, a):
+		return fmt.Errorf("%s (%s) must not be inside the %s (%s)", bName, b, aName, a)
+	case isWithin(a, b):
+		return fmt.Errorf("%s (%s) must not be inside the %s (%s)", aName, a, bName, b)
+	}
+	return nil
+}
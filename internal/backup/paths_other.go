@@ -0,0 +1,8 @@
+//go:build !unix
+
+package backup
+
+// onRootFilesystem always reports false where mount points can't be detected.
+func onRootFilesystem(path string) bool {
+	return false
+}
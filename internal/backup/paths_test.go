@@ -0,0 +1,158 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalPath(t *testing.T) {
+	dir := t.TempDir()
+	realDir := filepath.Join(dir, "real")
+	os.MkdirAll(realDir, 0755)
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(realDir, link); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	resolvedReal, _ := filepath.EvalSymlinks(realDir)
+
+	got, err := canonicalPath(filepath.Join(link, "missing", "child"))
+	if err != nil {
+		t.Fatalf("canonicalPath() unexpected error: %v", err)
+	}
+	if want := filepath.Join(resolvedReal, "missing", "child"); got != want {
+		t.Errorf("canonicalPath() = %q, want %q", got, want)
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	tests := []struct {
+		path, dir string
+		want      bool
+	}{
+		{"/gamedata", "/gamedata", true},
+		{"/gamedata/staging", "/gamedata", true},
+		{"/gamedata2", "/gamedata", false},
+		{"/gamedata/..staging", "/gamedata", true},
+		{"/", "/gamedata", false},
+		{"/backupcache/staging", "/gamedata", false},
+	}
+	for _, tt := range tests {
+		if got := isWithin(tt.path, tt.dir); got != tt.want {
+			t.Errorf("isWithin(%q, %q) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestManager_ValidatePaths(t *testing.T) {
+	t.Run("accepts separate directories", func(t *testing.T) {
+		base := t.TempDir()
+		gameDataDir := filepath.Join(base, "gamedata")
+		os.MkdirAll(gameDataDir, 0755)
+
+		m := &Manager{
+			GameDataDir: gameDataDir + "/",
+			StagingDir:  filepath.Join(base, "cache", "staging"),
+			CompactDir:  filepath.Join(base, "cache", "compact"),
+		}
+		if _, err := m.ValidatePaths(); err != nil {
+			t.Fatalf("ValidatePaths() unexpected error: %v", err)
+		}
+		if strings.HasSuffix(m.GameDataDir, "/") || !filepath.IsAbs(m.StagingDir) {
+			t.Errorf("ValidatePaths() did not canonicalize paths: %q, %q", m.GameDataDir, m.StagingDir)
+		}
+	})
+
+	t.Run("rejects staging inside gamedata", func(t *testing.T) {
+		gameDataDir := t.TempDir()
+		m := &Manager{
+			GameDataDir: gameDataDir,
+			StagingDir:  filepath.Join(gameDataDir, "staging"),
+			CompactDir:  filepath.Join(t.TempDir(), "compact"),
+		}
+		_, err := m.ValidatePaths()
+		if err == nil || !strings.Contains(err.Error(), "staging directory") {
+			t.Errorf("ValidatePaths() error = %v, want staging overlap error", err)
+		}
+	})
+
+	t.Run("rejects gamedata inside staging", func(t *testing.T) {
+		stagingDir := t.TempDir()
+		gameDataDir := filepath.Join(stagingDir, "gamedata")
+		os.MkdirAll(gameDataDir, 0755)
+
+		m := &Manager{
+			GameDataDir: gameDataDir,
+			StagingDir:  stagingDir,
+			CompactDir:  filepath.Join(t.TempDir(), "compact"),
+		}
+		if _, err := m.ValidatePaths(); err == nil {
+			t.Error("ValidatePaths() expected error for gamedata inside staging")
+		}
+	})
+
+	t.Run("rejects staging reached through a symlink into gamedata", func(t *testing.T) {
+		gameDataDir := t.TempDir()
+		os.MkdirAll(filepath.Join(gameDataDir, "Cache"), 0755)
+		link := filepath.Join(t.TempDir(), "cache")
+		if err := os.Symlink(filepath.Join(gameDataDir, "Cache"), link); err != nil {
+			t.Fatalf("Symlink failed: %v", err)
+		}
+
+		m := &Manager{
+			GameDataDir: gameDataDir,
+			StagingDir:  filepath.Join(link, "staging"),
+			CompactDir:  filepath.Join(t.TempDir(), "compact"),
+		}
+		if _, err := m.ValidatePaths(); err == nil {
+			t.Error("ValidatePaths() expected error for staging symlinked into gamedata")
+		}
+	})
+
+	t.Run("rejects Backups symlinked into staging", func(t *testing.T) {
+		gameDataDir := t.TempDir()
+		stagingDir := t.TempDir()
+		os.MkdirAll(filepath.Join(stagingDir, "Backups"), 0755)
+		if err := os.Symlink(filepath.Join(stagingDir, "Backups"), filepath.Join(gameDataDir, "Backups")); err != nil {
+			t.Fatalf("Symlink failed: %v", err)
+		}
+
+		m := &Manager{
+			GameDataDir: gameDataDir,
+			StagingDir:  stagingDir,
+			CompactDir:  filepath.Join(t.TempDir(), "compact"),
+		}
+		_, err := m.ValidatePaths()
+		if err == nil || !strings.Contains(err.Error(), "backups directory") {
+			t.Errorf("ValidatePaths() error = %v, want backups overlap error", err)
+		}
+	})
+
+	t.Run("rejects local copies inside staging", func(t *testing.T) {
+		stagingDir := t.TempDir()
+		m := &Manager{
+			GameDataDir:    t.TempDir(),
+			StagingDir:     stagingDir,
+			CompactDir:     filepath.Join(t.TempDir(), "compact"),
+			LocalKeepVCDBS: 2,
+			LocalDir:       filepath.Join(stagingDir, "local"),
+		}
+		_, err := m.ValidatePaths()
+		if err == nil || !strings.Contains(err.Error(), "local copies directory") {
+			t.Errorf("ValidatePaths() error = %v, want local copies overlap error", err)
+		}
+	})
+
+	t.Run("rejects missing gamedata", func(t *testing.T) {
+		m := &Manager{
+			GameDataDir: filepath.Join(t.TempDir(), "missing"),
+			StagingDir:  t.TempDir(),
+			CompactDir:  filepath.Join(t.TempDir(), "compact"),
+		}
+		if _, err := m.ValidatePaths(); err == nil {
+			t.Error("ValidatePaths() expected error for missing gamedata")
+		}
+	})
+}
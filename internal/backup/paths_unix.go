@@ -0,0 +1,27 @@
+//go:build unix
+
+package backup
+
+import (
+	"path/filepath"
+	"syscall"
+)
+
+// onRootFilesystem reports whether path (or its nearest existing parent) is on
+// the same filesystem as /, i.e. not on a separately mounted volume.
+func onRootFilesystem(path string) bool {
+	for {
+		var st, root syscall.Stat_t
+		if err := syscall.Stat(path, &st); err == nil {
+			if err := syscall.Stat("/", &root); err != nil {
+				return false
+			}
+			return st.Dev == root.Dev
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,55 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// PinnedTag is the restic tag of pinned snapshots. Pruning always keeps
+// them, whatever the retention policy.
+const PinnedTag = "pinned"
+
+// PinSnapshot tags snapshot, an ID from `restic snapshots` or "latest" for
+// this server's latest, as PinnedTag, so no retention policy removes it. Use
+// it before risky changes, such as big mod updates or world edits.
+func (m *Manager) PinSnapshot(ctx context.Context, snapshot string) error {
+	return m.tagSnapshot(ctx, snapshot, "--add")
+}
+
+// UnpinSnapshot removes PinnedTag from snapshot, leaving it to the retention
+// policy again.
+func (m *Manager) UnpinSnapshot(ctx context.Context, snapshot string) error {
+	return m.tagSnapshot(ctx, snapshot, "--remove")
+}
+
+// tagSnapshot adds or removes PinnedTag, as op is "--add" or "--remove". It
+// waits for a running backup, compaction, or rollback, since restic can't
+// change tags while the repository is locked.
+func (m *Manager) tagSnapshot(ctx context.Context, snapshot, op string) error {
+	if snapshot == "" || strings.HasPrefix(snapshot, "-") {
+		return fmt.Errorf("invalid snapshot %q", snapshot)
+	}
+
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+
+	args := []string{"tag", op, PinnedTag}
+	if snapshot == "latest" {
+		args = append(args, "--host", m.snapshotHost())
+		args = append(args, m.worldFilter()...)
+		if m.ModsInterval > 0 {
+			args = append(args, "--tag", SnapshotSetTag+SnapshotSetWorld)
+		}
+	}
+	args = append(args, snapshot)
+
+	exitCode, output, err := m.runCommandWithOutput(ctx, "restic", args...)
+	if err != nil {
+		return fmt.Errorf("restic tag failed: %w", err)
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("restic tag failed with exit code %d\nOutput: %s", exitCode, output)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package backup
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestManager_PinSnapshot(t *testing.T) {
+	var calls [][]string
+	exitCode := 0
+	m := &Manager{
+		ResticHost: "survival",
+		World:      "creative",
+		CommandRunner: func(ctx context.Context, name string, args ...string) (int, error) {
+			calls = append(calls, append([]string{name}, args...))
+			return exitCode, nil
+		},
+	}
+
+	if err := m.PinSnapshot(context.Background(), "1a2b3c4d"); err != nil {
+		t.Fatalf("PinSnapshot failed: %v", err)
+	}
+	// Only the latest snapshot needs selecting as this server's
+	if err := m.UnpinSnapshot(context.Background(), "latest"); err != nil {
+		t.Fatalf("UnpinSnapshot failed: %v", err)
+	}
+	want := [][]string{
+		{"restic", "tag", "--add", "pinned", "1a2b3c4d"},
+		{"restic", "tag", "--remove", "pinned", "--host", "survival", "--tag", "world=creative", "latest"},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("restic calls = %v, want %v", calls, want)
+	}
+
+	exitCode = 1
+	if err := m.PinSnapshot(context.Background(), "1a2b3c4d"); err == nil {
+		t.Error("PinSnapshot expected an error when restic fails")
+	}
+	for _, snapshot := range []string{"", "--remove"} {
+		if err := m.PinSnapshot(context.Background(), snapshot); err == nil {
+			t.Errorf("PinSnapshot(%q) expected an error", snapshot)
+		}
+	}
+}
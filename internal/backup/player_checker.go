@@ -1,47 +1,133 @@
 package backup
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/server"
 )
 
 // playerJoinPattern matches when a player joins the server.
 // Format: [Server Event] playername joins.
 // The playername can contain any characters including whitespace.
-var playerJoinPattern = regexp.MustCompile(`\[Server Event\].*joins\.$`)
+var playerJoinPattern = regexp.MustCompile(`\[Server Event\] ?(.*) joins\.$`)
 
 // playerLeavePattern matches when a player leaves the server.
 // Format: [Server Event] playername left.
 // The playername can contain any characters including whitespace.
-var playerLeavePattern = regexp.MustCompile(`\[Server Event\].*left\.$`)
+var playerLeavePattern = regexp.MustCompile(`\[Server Event\] ?(.*) left\.$`)
+
+// playerDisconnectPatterns match the other ways a player can drop off the
+// server without a "left." line: kicks, bans, and lost connections. They are
+// matched against the text following the [Server Event] or [Server Notification]
+// marker, and capture the player name.
+//
+// Formats:
+//
+//	Player playername got kicked. Reason: ...
+//	playername has been kicked by admin. Reason: ...
+//	Player playername got banned. Reason: ...
+//	Player playername timed out.
+//	Player playername disconnected (timeout)
+//	Client 3 (playername) disconnected: Lost connection
+var playerDisconnectPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(?:Player )?(.+?) (?:got|has been|was) (?:kicked|banned)\b`),
+	regexp.MustCompile(`^(?:Player )?(.+?) (?:timed out|lost connection)\b`),
+	regexp.MustCompile(`^Player (.+?) disconnected\b`),
+	regexp.MustCompile(`^Client \d+ \((.+)\) disconnected\b`),
+}
+
+// anonymousDisconnectPattern matches a dropped connection that doesn't name
+// the player, e.g. "Client disconnected (timeout)" or "Client 3 disconnected: Lost connection".
+var anonymousDisconnectPattern = regexp.MustCompile(`^Client (?:\d+ )?disconnected\b`)
 
 // serverEventMarker is the exact string we count to ensure only one instance exists.
 const serverEventMarker = "[Server Event]"
 
+// serverNotificationMarker precedes kick and connection-loss messages.
+const serverNotificationMarker = "[Server Notification]"
+
 // serverChatPrefix is the prefix for chat messages, which should be ignored
 // to prevent players from injecting fake join/leave events via chat.
 const serverChatPrefix = "[Server Chat]"
 
-// PlayerChecker tracks the number of online players by watching server output
-// for join/leave events. It maintains a counter that increments when players
-// join and decrements when players leave.
+// playerCountStaleAfter is how long the online players may go without any
+// join or disconnect line before the checker checks them against the server's
+// client list, in case it missed a disconnect.
+const playerCountStaleAfter = 12 * time.Hour
+
+// clientListHeader starts the server's answer to /list clients, which is
+// followed by one unprefixed line per client.
+const clientListHeader = "[Notification] List of online Players"
+
+// clientListEntryPattern matches a client in the answer to /list clients,
+// e.g. "[2] playername [::ffff:10.88.0.79]:47300", capturing the name.
+var clientListEntryPattern = regexp.MustCompile(`^\[\d+\] (.+) (?:\[[0-9A-Fa-f:.]+\]|[0-9.]+):\d+$`)
+
+// reconcileTimeout is how long an answer to /list clients is waited for.
+// An answer that started but has had no entries for clientListGrace is
+// taken as complete, so an empty list is applied even if no line follows it.
+const (
+	reconcileTimeout = 30 * time.Second
+	clientListGrace  = 2 * time.Second
+)
+
+// PlayerChecker tracks the online players by watching server output for join,
+// leave, kick, and disconnect events. Players are tracked by name, so a
+// disconnect reported by more than one log line is only counted once.
+//
+// Disconnect lines the server doesn't attach a name to can't always be
+// attributed. If the online players haven't changed for playerCountStaleAfter,
+// or more players are tracked than MaxClients allows, the count may have
+// drifted or been spoofed. The checker then asks the server for its client
+// list through Reconciler and replaces the tracked players with the answer.
+// The answer is only accepted while such a request is outstanding. Going
+// stale alone never clears the players: without Reconciler, they stay online
+// until a disconnect is seen, so an idle player doesn't pause backups.
 //
 // It also tracks whether players were online at the previous backup check,
 // allowing a "final backup" to be triggered when all players log off.
 type PlayerChecker struct {
-	mu          sync.Mutex
-	playerCount int
+	// MaxClients is the server's player limit, from ReadMaxClients. Zero
+	// means unknown, and the count isn't checked against it.
+	MaxClients int
+
+	// Reconciler sends /list clients when the count exceeds MaxClients.
+	// Optional; without it the excess is only logged.
+	Reconciler ServerCommander
+
+	mu        sync.Mutex
+	online    map[string]struct{}
+	lastEvent time.Time
+
+	// reconcileUntil is when an outstanding /list clients request expires;
+	// zero if none is. listing is set while its answer is being read, into
+	// listed, and listUpdated is when the answer last grew.
+	reconcileUntil time.Time
+	listing        bool
+	listed         map[string]struct{}
+	listUpdated    time.Time
 
 	// playersOnlineAtLastCheck tracks whether any players were online
 	// when ShouldBackup() was last called. This is used to trigger
 	// a final backup when all players log off.
 	playersOnlineAtLastCheck bool
+
+	// now returns the current time. Defaults to time.Now; overridable in tests.
+	now func() time.Time
 }
 
 // HandleOutput should be called for each line of server output.
-// It detects player join/leave events and updates the player count.
-// For security, it only counts lines that contain exactly one [Server Event] marker
+// It detects player join/leave/disconnect events and updates the online players.
+// For security, it only counts lines that contain exactly one server marker
 // and ignores chat messages.
 func (p *PlayerChecker) HandleOutput(line string) {
 	// Security check: ignore chat messages to prevent injection attacks.
@@ -50,42 +136,247 @@ func (p *PlayerChecker) HandleOutput(line string) {
 		return
 	}
 
-	// Security check: ensure exactly one [Server Event] marker exists.
+	if p.handleClientList(line) {
+		return
+	}
+
+	// Security check: ensure exactly one server marker exists.
 	// This prevents attack vectors where someone could inject fake events
-	// through messages containing multiple [Server Event] strings.
-	if strings.Count(line, serverEventMarker) != 1 {
+	// through messages containing multiple marker strings.
+	events := strings.Count(line, serverEventMarker)
+	notifications := strings.Count(line, serverNotificationMarker)
+	if events+notifications != 1 {
 		return
 	}
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	at := lineTime(line, p.currentTime())
+
+	if events == 1 {
+		if match := playerJoinPattern.FindStringSubmatch(line); match != nil {
+			p.join(match[1], at)
+			return
+		}
+		if match := playerLeavePattern.FindStringSubmatch(line); match != nil {
+			p.leave(match[1], at)
+			return
+		}
+	}
 
-	if playerJoinPattern.MatchString(line) {
-		p.playerCount++
+	marker := serverEventMarker
+	if notifications == 1 {
+		marker = serverNotificationMarker
+	}
+	_, message, _ := strings.Cut(line, marker)
+	message = strings.TrimSpace(message)
+
+	for _, pattern := range playerDisconnectPatterns {
+		if match := pattern.FindStringSubmatch(message); match != nil {
+			p.leave(match[1], at)
+			return
+		}
+	}
+
+	if anonymousDisconnectPattern.MatchString(message) {
+		p.lastEvent = at
+		// With a single player online there's only one person it can be.
+		// Otherwise leave the count alone: overcounting keeps backups running,
+		// and the stale check reconciles it eventually.
+		if len(p.online) == 1 {
+			clear(p.online)
+		}
+	}
+}
+
+// join records name as online as of at. Must be called with mu held.
+func (p *PlayerChecker) join(name string, at time.Time) {
+	if p.online == nil {
+		p.online = make(map[string]struct{})
+	}
+	p.online[name] = struct{}{}
+	p.lastEvent = at
+
+	if p.MaxClients > 0 && len(p.online) > p.MaxClients && !p.reconciling() {
+		fmt.Printf("WARNING: %d players tracked online but the server allows %d; the count has drifted or been spoofed\n",
+			len(p.online), p.MaxClients)
+		p.reconcile()
+	}
+}
+
+// reconciling reports whether a /list clients request is outstanding.
+// Must be called with mu held.
+func (p *PlayerChecker) reconciling() bool {
+	return p.currentTime().Before(p.reconcileUntil)
+}
+
+// reconcile asks the server for its client list, unless a request is
+// already outstanding or there is no Reconciler. Must be called with mu held.
+func (p *PlayerChecker) reconcile() {
+	if p.Reconciler == nil || p.reconciling() {
 		return
 	}
+	now := p.currentTime()
+
+	p.reconcileUntil = now.Add(reconcileTimeout)
+	p.listing = false
+	reconciler := p.Reconciler
+	// Commands may be queued behind others; don't hold up output handling
+	go func() {
+		if err := reconciler.SendCommand("/list clients"); err != nil {
+			fmt.Printf("WARNING: Failed to request the client list: %v\n", err)
+		}
+	}()
+}
+
+// handleClientList reads the answer to an outstanding /list clients request.
+// It reports whether line was part of it.
+func (p *PlayerChecker) handleClientList(line string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.reconcileUntil.IsZero() {
+		return false
+	}
+	now := p.currentTime()
+
+	if strings.Contains(line, clientListHeader) && strings.Count(line, "[") == 1 {
+		p.listing = true
+		p.listed = make(map[string]struct{})
+		p.listUpdated = now
+		return true
+	}
+	if !p.listing {
+		return false
+	}
+	if match := clientListEntryPattern.FindStringSubmatch(line); match != nil {
+		p.listed[match[1]] = struct{}{}
+		p.listUpdated = now
+		return true
+	}
+
+	// Anything else ends the list
+	p.applyClientList()
+	return false
+}
+
+// applyClientList replaces the online players with the answer to /list
+// clients. Must be called with mu held.
+func (p *PlayerChecker) applyClientList() {
+	if len(p.listed) != len(p.online) {
+		fmt.Printf("Player count reconciled with the server's client list: %d online, was %d\n", len(p.listed), len(p.online))
+	}
+	p.online = p.listed
+	p.listed = nil
+	p.listing = false
+	p.reconcileUntil = time.Time{}
+	p.lastEvent = p.currentTime()
+}
+
+// leave records name as offline as of at. Must be called with mu held.
+func (p *PlayerChecker) leave(name string, at time.Time) {
+	delete(p.online, name)
+	p.lastEvent = at
+}
+
+// count returns the number of online players, asking the server for its
+// client list if they have gone stale. Must be called with mu held.
+func (p *PlayerChecker) count() int {
+	if !p.reconcileUntil.IsZero() {
+		now := p.currentTime()
+		switch {
+		case p.listing && now.Sub(p.listUpdated) > clientListGrace:
+			p.applyClientList()
+		case now.After(p.reconcileUntil):
+			fmt.Printf("WARNING: The server didn't answer /list clients within %v\n", reconcileTimeout)
+			p.reconcileUntil = time.Time{}
+			p.listing = false
+		}
+	}
 
-	if playerLeavePattern.MatchString(line) {
-		p.playerCount--
-		// Ensure we don't go negative (shouldn't happen, but be safe)
-		if p.playerCount < 0 {
-			p.playerCount = 0
+	if len(p.online) > 0 && p.currentTime().Sub(p.lastEvent) > playerCountStaleAfter && !p.reconciling() {
+		// Check again after another playerCountStaleAfter if nothing changes
+		p.lastEvent = p.currentTime()
+		if p.Reconciler == nil {
+			fmt.Printf("No player joined or left in %v; still counting %d online player(s) until they leave\n",
+				playerCountStaleAfter, len(p.online))
+		} else {
+			fmt.Printf("No player joined or left in %v; checking %d online player(s) against the server's client list\n",
+				playerCountStaleAfter, len(p.online))
+			p.reconcile()
 		}
 	}
+	return len(p.online)
+}
+
+// ReadMaxClients returns the MaxClients setting from serverconfig.json in
+// gameDataDir, for PlayerChecker.MaxClients. Returns 0 without error if the
+// file doesn't exist yet, as on a first start, or doesn't set a limit.
+func ReadMaxClients(gameDataDir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(gameDataDir, "serverconfig.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read serverconfig.json: %w", err)
+	}
+
+	var config serverConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return 0, fmt.Errorf("failed to parse serverconfig.json: %w", err)
+	}
+	if config.MaxClients < 0 {
+		return 0, nil
+	}
+	return config.MaxClients, nil
+}
+
+// lineTime returns when the server logged line, from the timestamp at its
+// start, or now if it has none. Lines read back from a log file, as by the
+// backup agent, may be hours old. A timestamp later than now, from a server
+// clock running ahead, is taken as now.
+func lineTime(line string, now time.Time) time.Time {
+	t, _, ok := server.ParseLogTime(line, nil)
+	if !ok || t.After(now) {
+		return now
+	}
+	return t
+}
+
+// currentTime returns the current time using the configured clock.
+func (p *PlayerChecker) currentTime() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
 }
 
 // PlayersOnline returns true if there are any players currently online.
 func (p *PlayerChecker) PlayersOnline() bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	return p.playerCount > 0
+	return p.count() > 0
 }
 
 // PlayerCount returns the current number of online players.
 func (p *PlayerChecker) PlayerCount() int {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	return p.playerCount
+	return p.count()
+}
+
+// Players returns the names of the online players, sorted.
+func (p *PlayerChecker) Players() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.count()
+
+	names := make([]string, 0, len(p.online))
+	for name := range p.online {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // ShouldBackup checks if a backup should run based on player status.
@@ -100,7 +391,7 @@ func (p *PlayerChecker) ShouldBackup() bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	playersOnlineNow := p.playerCount > 0
+	playersOnlineNow := p.count() > 0
 	werePlayersOnlineBefore := p.playersOnlineAtLastCheck
 
 	// Update state for next check
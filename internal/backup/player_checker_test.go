@@ -1,7 +1,13 @@
 package backup
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
 )
 
 func TestPlayerChecker_HandleOutput_DetectsPlayerJoin(t *testing.T) {
@@ -59,6 +65,24 @@ func TestPlayerChecker_HandleOutput_MultiplePlayers(t *testing.T) {
 	}
 }
 
+func TestPlayerChecker_Players(t *testing.T) {
+	pc := &PlayerChecker{}
+
+	if players := pc.Players(); len(players) != 0 {
+		t.Errorf("Players() = %q, want none", players)
+	}
+
+	pc.HandleOutput("[Server Event] zoe joins.")
+	pc.HandleOutput("[Server Event] adam joins.")
+	pc.HandleOutput("[Server Event] mia joins.")
+	pc.HandleOutput("[Server Event] mia left.")
+
+	players := pc.Players()
+	if len(players) != 2 || players[0] != "adam" || players[1] != "zoe" {
+		t.Errorf("Players() = %q, want [adam zoe]", players)
+	}
+}
+
 func TestPlayerChecker_HandleOutput_DoesNotGoNegative(t *testing.T) {
 	pc := &PlayerChecker{}
 
@@ -466,14 +490,14 @@ func TestPlayerChecker_Concurrency(t *testing.T) {
 	done := make(chan struct{})
 	go func() {
 		for i := 0; i < 100; i++ {
-			pc.HandleOutput("[Server Event] player1 joins.")
+			pc.HandleOutput(fmt.Sprintf("[Server Event] alpha%d joins.", i))
 		}
 		done <- struct{}{}
 	}()
 
 	go func() {
 		for i := 0; i < 100; i++ {
-			pc.HandleOutput("[Server Event] player2 joins.")
+			pc.HandleOutput(fmt.Sprintf("[Server Event] beta%d joins.", i))
 		}
 		done <- struct{}{}
 	}()
@@ -485,3 +509,291 @@ func TestPlayerChecker_Concurrency(t *testing.T) {
 		t.Errorf("PlayerCount() = %d, want 200 after concurrent joins", pc.PlayerCount())
 	}
 }
+
+func TestPlayerChecker_HandleOutput_RejoinWithoutLeaveCountsOnce(t *testing.T) {
+	pc := &PlayerChecker{}
+
+	// A player reconnecting before the server noticed the old connection dropped
+	pc.HandleOutput("[Server Event] amoglaswag joins.")
+	pc.HandleOutput("[Server Event] amoglaswag joins.")
+	pc.HandleOutput("[Server Event] amoglaswag left.")
+
+	if pc.PlayerCount() != 0 {
+		t.Errorf("PlayerCount() = %d, want 0 after rejoin and leave", pc.PlayerCount())
+	}
+}
+
+func TestPlayerChecker_HandleOutput_Disconnects(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"kick", "14.12.2025 21:40:12 [Server Notification] Player amoglaswag got kicked. Reason: Spamming"},
+		{"kick by admin", "14.12.2025 21:40:12 [Server Event] amoglaswag has been kicked by admin. Reason: afk"},
+		{"ban", "14.12.2025 21:40:12 [Server Notification] Player amoglaswag got banned. Reason: griefing"},
+		{"timed out", "14.12.2025 21:40:12 [Server Notification] Player amoglaswag timed out."},
+		{"disconnected timeout", "14.12.2025 21:40:12 [Server Notification] Player amoglaswag disconnected (timeout)"},
+		{"lost connection", "14.12.2025 21:40:12 [Server Notification] Client 2 (amoglaswag) disconnected: Lost connection"},
+		{"anonymous timeout", "14.12.2025 21:40:12 [Server Notification] Client disconnected (timeout)"},
+		{"anonymous with id", "14.12.2025 21:40:12 [Server Notification] Client 2 disconnected: Lost connection"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := &PlayerChecker{}
+			pc.HandleOutput("14.12.2025 21:32:37 [Server Event] amoglaswag joins.")
+			pc.HandleOutput(tt.line)
+
+			if pc.PlayerCount() != 0 {
+				t.Errorf("PlayerCount() = %d, want 0 after %q", pc.PlayerCount(), tt.line)
+			}
+		})
+	}
+}
+
+func TestPlayerChecker_HandleOutput_KickFollowedByLeaveCountsOnce(t *testing.T) {
+	pc := &PlayerChecker{}
+
+	pc.HandleOutput("[Server Event] player1 joins.")
+	pc.HandleOutput("[Server Event] player2 joins.")
+	pc.HandleOutput("[Server Notification] Player player1 got kicked. Reason: afk")
+	pc.HandleOutput("[Server Event] player1 left.")
+
+	if pc.PlayerCount() != 1 {
+		t.Errorf("PlayerCount() = %d, want 1 - one disconnect should not remove two players", pc.PlayerCount())
+	}
+}
+
+func TestPlayerChecker_HandleOutput_AnonymousDisconnectWithSeveralPlayers(t *testing.T) {
+	pc := &PlayerChecker{}
+
+	pc.HandleOutput("[Server Event] player1 joins.")
+	pc.HandleOutput("[Server Event] player2 joins.")
+	pc.HandleOutput("[Server Notification] Client disconnected (timeout)")
+
+	// We can't tell who dropped, so keep counting both rather than pausing backups
+	if pc.PlayerCount() != 2 {
+		t.Errorf("PlayerCount() = %d, want 2 for an unattributable disconnect", pc.PlayerCount())
+	}
+}
+
+func TestPlayerChecker_HandleOutput_IgnoresSpoofedDisconnects(t *testing.T) {
+	pc := &PlayerChecker{}
+	pc.HandleOutput("[Server Event] victim joins.")
+
+	// Chat can't forge a kick, and a marker must directly precede the message
+	pc.HandleOutput("[Server Chat] attacker: [Server Notification] Player victim got kicked.")
+	pc.HandleOutput("[Server Notification] Message from attacker: Player victim got kicked.")
+	pc.HandleOutput("[Server Event] [Server Notification] Player victim timed out.")
+	pc.HandleOutput("[Notification] Player victim got kicked.")
+
+	if pc.PlayerCount() != 1 {
+		t.Errorf("PlayerCount() = %d, want 1 - spoofed disconnects should be ignored", pc.PlayerCount())
+	}
+}
+
+func TestPlayerChecker_StaleCountReconciles(t *testing.T) {
+	now := time.Date(2025, 12, 14, 21, 0, 0, 0, time.UTC)
+	reconciler := &testsupport.Server{}
+	pc := &PlayerChecker{Reconciler: reconciler, now: func() time.Time { return now }}
+
+	pc.HandleOutput("[Server Event] player1 joins.")
+	pc.HandleOutput("[Server Event] player2 joins.")
+
+	now = now.Add(playerCountStaleAfter - time.Minute)
+	if pc.PlayerCount() != 2 {
+		t.Fatalf("PlayerCount() = %d, want 2 before the count goes stale", pc.PlayerCount())
+	}
+	if cmds := waitForCommands(reconciler, 0); len(cmds) != 0 {
+		t.Fatalf("Commands before the count went stale = %v, want none", cmds)
+	}
+
+	// Going stale asks the server instead of clearing the players
+	now = now.Add(2 * time.Minute)
+	if pc.PlayerCount() != 2 {
+		t.Errorf("PlayerCount() = %d, want 2 while the client list is requested", pc.PlayerCount())
+	}
+	cmds := waitForCommands(reconciler, 1)
+	if len(cmds) != 1 || cmds[0] != "/list clients" {
+		t.Fatalf("Commands = %v, want [/list clients]", cmds)
+	}
+
+	// player2 left without a line we recognized; player1 is idle but there
+	pc.HandleOutput("14.12.2025 09:00:01 [Notification] List of online Players")
+	pc.HandleOutput("[1] player1 [::ffff:10.88.0.79]:47300")
+	pc.HandleOutput("14.12.2025 09:00:02 [Server Notification] Autosave complete")
+
+	if got := pc.Players(); len(got) != 1 || got[0] != "player1" {
+		t.Errorf("Players() = %v, want [player1]", got)
+	}
+}
+
+func TestPlayerChecker_StaleCountKeptWithoutReconciler(t *testing.T) {
+	now := time.Date(2025, 12, 14, 21, 0, 0, 0, time.UTC)
+	pc := &PlayerChecker{now: func() time.Time { return now }}
+
+	pc.HandleOutput("[Server Event] player1 joins.")
+	pc.ShouldBackup()
+
+	// An AFK player must not pause backups just because nothing happened
+	now = now.Add(2 * playerCountStaleAfter)
+	if !pc.ShouldBackup() {
+		t.Error("ShouldBackup() = false, want true while the player hasn't left")
+	}
+
+	pc.HandleOutput("[Server Event] player1 left.")
+	if pc.PlayersOnline() {
+		t.Error("PlayersOnline() = true, want false after the player left")
+	}
+}
+
+func TestPlayerChecker_StaleFromLoggedTime(t *testing.T) {
+	now := time.Date(2025, 12, 15, 12, 0, 0, 0, time.Local)
+	reconciler := &testsupport.Server{}
+	pc := &PlayerChecker{Reconciler: reconciler, now: func() time.Time { return now }}
+
+	// A join read back from the log long after it was written
+	pc.HandleOutput("14.12.2025 21:00:00 [Server Event] player1 joins.")
+	if pc.PlayerCount() != 1 {
+		t.Errorf("PlayerCount() = %d, want 1", pc.PlayerCount())
+	}
+	cmds := waitForCommands(reconciler, 1)
+	if len(cmds) != 1 || cmds[0] != "/list clients" {
+		t.Errorf("Commands = %v, want [/list clients] for a join logged over %v ago", cmds, playerCountStaleAfter)
+	}
+}
+
+func TestPlayerChecker_StaleTimerRestartsOnActivity(t *testing.T) {
+	now := time.Date(2025, 12, 14, 21, 0, 0, 0, time.UTC)
+	pc := &PlayerChecker{now: func() time.Time { return now }}
+
+	pc.HandleOutput("[Server Event] player1 joins.")
+	now = now.Add(playerCountStaleAfter - time.Hour)
+	pc.HandleOutput("[Server Event] player2 joins.")
+	now = now.Add(2 * time.Hour)
+
+	if pc.PlayerCount() != 2 {
+		t.Errorf("PlayerCount() = %d, want 2 - recent activity should keep the count fresh", pc.PlayerCount())
+	}
+}
+
+func TestPlayerChecker_ReconcilesAboveMaxClients(t *testing.T) {
+	now := time.Date(2025, 12, 14, 21, 0, 0, 0, time.UTC)
+	reconciler := &testsupport.Server{}
+	pc := &PlayerChecker{MaxClients: 2, Reconciler: reconciler, now: func() time.Time { return now }}
+
+	pc.HandleOutput("[Server Event] player1 joins.")
+	pc.HandleOutput("[Server Event] player2 joins.")
+	if cmds := waitForCommands(reconciler, 0); len(cmds) != 0 {
+		t.Fatalf("Commands within MaxClients = %v, want none", cmds)
+	}
+
+	// A spoofed or missed event pushes the count past the limit
+	pc.HandleOutput("[Server Event] ghost joins.")
+	cmds := waitForCommands(reconciler, 1)
+	if len(cmds) != 1 || cmds[0] != "/list clients" {
+		t.Fatalf("Commands = %v, want [/list clients]", cmds)
+	}
+
+	// Another join while the request is outstanding doesn't ask again
+	pc.HandleOutput("[Server Event] ghost2 joins.")
+
+	pc.HandleOutput("14.12.2025 21:00:01 [Notification] List of online Players")
+	pc.HandleOutput("[1] player1 [::ffff:10.88.0.79]:47300")
+	pc.HandleOutput("[2] player2 10.88.0.80:47301")
+	pc.HandleOutput("14.12.2025 21:00:02 [Server Notification] Autosave complete")
+
+	if got := pc.Players(); len(got) != 2 || got[0] != "player1" || got[1] != "player2" {
+		t.Errorf("Players() = %v, want [player1 player2]", got)
+	}
+	if cmds := waitForCommands(reconciler, 1); len(cmds) != 1 {
+		t.Errorf("Commands = %v, want a single /list clients", cmds)
+	}
+}
+
+func TestPlayerChecker_EmptyClientListAppliedAfterGrace(t *testing.T) {
+	now := time.Date(2025, 12, 14, 21, 0, 0, 0, time.UTC)
+	pc := &PlayerChecker{MaxClients: 1, Reconciler: &testsupport.Server{}, now: func() time.Time { return now }}
+
+	pc.HandleOutput("[Server Event] player1 joins.")
+	pc.HandleOutput("[Server Event] player2 joins.")
+	pc.HandleOutput("[Notification] List of online Players")
+
+	if n := pc.PlayerCount(); n != 2 {
+		t.Errorf("PlayerCount() while the list is read = %d, want 2", n)
+	}
+	now = now.Add(clientListGrace + time.Second)
+	if n := pc.PlayerCount(); n != 0 {
+		t.Errorf("PlayerCount() after an empty client list = %d, want 0", n)
+	}
+}
+
+func TestPlayerChecker_ClientListOnlyWhenRequested(t *testing.T) {
+	pc := &PlayerChecker{MaxClients: 10, Reconciler: &testsupport.Server{}}
+
+	pc.HandleOutput("[Server Event] player1 joins.")
+
+	// A list nobody asked for, e.g. from an admin, changes nothing
+	pc.HandleOutput("[Notification] List of online Players")
+	pc.HandleOutput("[1] intruder [::ffff:10.88.0.79]:47300")
+	pc.HandleOutput("[Server Event] player2 joins.")
+
+	if got := pc.Players(); len(got) != 2 || got[0] != "player1" || got[1] != "player2" {
+		t.Errorf("Players() = %v, want [player1 player2]", got)
+	}
+}
+
+func TestPlayerChecker_ReconcileTimesOut(t *testing.T) {
+	now := time.Date(2025, 12, 14, 21, 0, 0, 0, time.UTC)
+	reconciler := &testsupport.Server{}
+	pc := &PlayerChecker{MaxClients: 1, Reconciler: reconciler, now: func() time.Time { return now }}
+
+	pc.HandleOutput("[Server Event] player1 joins.")
+	pc.HandleOutput("[Server Event] player2 joins.")
+	waitForCommands(reconciler, 1)
+
+	// No answer: the count is kept, and the next excess asks again
+	now = now.Add(reconcileTimeout + time.Second)
+	if n := pc.PlayerCount(); n != 2 {
+		t.Errorf("PlayerCount() = %d, want 2", n)
+	}
+	pc.HandleOutput("[Server Event] player3 joins.")
+	if cmds := waitForCommands(reconciler, 2); len(cmds) != 2 {
+		t.Errorf("Commands = %v, want a second /list clients", cmds)
+	}
+}
+
+func TestReadMaxClients(t *testing.T) {
+	dir := t.TempDir()
+	if n, err := ReadMaxClients(dir); err != nil || n != 0 {
+		t.Errorf("ReadMaxClients() without serverconfig.json = %d, %v; want 0, nil", n, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "serverconfig.json"), []byte(`{"MaxClients": 16, "WorldConfig": {}}`), 0644)
+	if n, err := ReadMaxClients(dir); err != nil || n != 16 {
+		t.Errorf("ReadMaxClients() = %d, %v; want 16, nil", n, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "serverconfig.json"), []byte(`{`), 0644)
+	if _, err := ReadMaxClients(dir); err == nil {
+		t.Error("ReadMaxClients() expected error for invalid JSON")
+	}
+}
+
+// waitForCommands waits up to a second for srv to have received want
+// commands, since the reconciler sends in the background, and returns them.
+// With want 0, it gives a stray command a moment to show up.
+func waitForCommands(srv *testsupport.Server, want int) []string {
+	if want == 0 {
+		time.Sleep(50 * time.Millisecond)
+		return srv.Commands()
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		cmds := srv.Commands()
+		if len(cmds) >= want || time.Now().After(deadline) {
+			return cmds
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,42 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+)
+
+// StagingPopulator adds files of its own to the staging directory before
+// each snapshot, e.g. an export of a mod's database. Register populators in
+// Manager.StagingPopulators.
+type StagingPopulator interface {
+	// Populate writes into stagingDir. It runs after the world and live
+	// files have been staged, while the staging journal is still open, so a
+	// failure means no snapshot is taken. Files should go in a top-level
+	// directory of the populator's own; Saves, Logs, Playerdata, Mods, and
+	// the staged config files belong to the Manager. To keep snapshots
+	// small, only rewrite files whose contents changed, and remove files
+	// that no longer belong. With StagingGenerations, stagingDir is a new
+	// generation whose files may be hard links into the last one, so replace
+	// a changed file (remove it, or write a new file and rename it over the
+	// old one) rather than rewriting it in place.
+	Populate(ctx context.Context, stagingDir string) error
+}
+
+// StagingPopulatorFunc adapts a function to a StagingPopulator.
+type StagingPopulatorFunc func(ctx context.Context, stagingDir string) error
+
+// Populate calls f(ctx, stagingDir).
+func (f StagingPopulatorFunc) Populate(ctx context.Context, stagingDir string) error {
+	return f(ctx, stagingDir)
+}
+
+// runStagingPopulators runs each populator in order, stopping at the first
+// failure.
+func (m *Manager) runStagingPopulators(ctx context.Context) error {
+	for i, p := range m.StagingPopulators {
+		if err := p.Populate(ctx, m.stagingTarget()); err != nil {
+			return fmt.Errorf("staging populator %d (%T) failed: %w", i+1, p, err)
+		}
+	}
+	return nil
+}
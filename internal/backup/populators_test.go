@@ -0,0 +1,108 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+// setupPopulatorStaging returns a manager whose staging update needs nothing
+// but a backup file, and the path of that file.
+func setupPopulatorStaging(t *testing.T) (*Manager, string) {
+	t.Helper()
+
+	gameDataDir := t.TempDir()
+	backupFile := filepath.Join(gameDataDir, "Backups", "backup.vcdbs")
+	os.MkdirAll(filepath.Dir(backupFile), 0755)
+	if err := os.WriteFile(backupFile, []byte("backup data"), 0644); err != nil {
+		t.Fatalf("Failed to write backup file: %v", err)
+	}
+
+	m := &Manager{
+		Interval:    time.Second,
+		Server:      &testsupport.Server{},
+		GameDataDir: gameDataDir,
+		StagingDir:  t.TempDir(),
+		VCDBTreeSplitter: func(srcPath, dstDir string) (int, int, error) {
+			return 0, 0, nil
+		},
+	}
+	return m, backupFile
+}
+
+func TestManager_StagingPopulators(t *testing.T) {
+	m, backupFile := setupPopulatorStaging(t)
+
+	var order []string
+	m.StagingPopulators = []StagingPopulator{
+		StagingPopulatorFunc(func(ctx context.Context, stagingDir string) error {
+			order = append(order, "economy")
+
+			// The world is staged, and the update not yet committed
+			if _, err := os.Stat(filepath.Join(stagingDir, "Saves", "default")); err != nil {
+				t.Errorf("Saves not staged before populators ran: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(stagingDir, stagingJournalName)); err != nil {
+				t.Errorf("Staging journal not open while populators ran: %v", err)
+			}
+
+			dir := filepath.Join(stagingDir, "Economy")
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			return os.WriteFile(filepath.Join(dir, "balances.json"), []byte("{}"), 0644)
+		}),
+		StagingPopulatorFunc(func(ctx context.Context, stagingDir string) error {
+			order = append(order, "moddb")
+			return nil
+		}),
+	}
+
+	if _, _, err := m.updateStagingDirectory(context.Background(), backupFile, "default.vcdbs", nil); err != nil {
+		t.Fatalf("updateStagingDirectory() failed: %v", err)
+	}
+
+	if len(order) != 2 || order[0] != "economy" || order[1] != "moddb" {
+		t.Errorf("Populators ran in order %v, want [economy moddb]", order)
+	}
+	if _, err := os.Stat(filepath.Join(m.StagingDir, "Economy", "balances.json")); err != nil {
+		t.Errorf("Populated file missing from staging: %v", err)
+	}
+	if j, _ := m.readStagingJournal(); j != nil {
+		t.Error("Staging journal left open after a successful update")
+	}
+}
+
+func TestManager_StagingPopulatorFails(t *testing.T) {
+	m, backupFile := setupPopulatorStaging(t)
+
+	errExport := errors.New("export failed")
+	ran := false
+	m.StagingPopulators = []StagingPopulator{
+		StagingPopulatorFunc(func(ctx context.Context, stagingDir string) error {
+			return errExport
+		}),
+		StagingPopulatorFunc(func(ctx context.Context, stagingDir string) error {
+			ran = true
+			return nil
+		}),
+	}
+
+	_, _, err := m.updateStagingDirectory(context.Background(), backupFile, "default.vcdbs", nil)
+	if !errors.Is(err, errExport) {
+		t.Fatalf("updateStagingDirectory() error = %v, want the populator's error", err)
+	}
+	if ran {
+		t.Error("Populator after the failed one ran")
+	}
+
+	// The update stays journaled, so no snapshot is taken of it
+	if err := m.checkStagingComplete(); !errors.Is(err, ErrStagingIncomplete) {
+		t.Errorf("checkStagingComplete() = %v, want ErrStagingIncomplete", err)
+	}
+}
@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ProbeRepository gives each restic cat config probeTimeout to answer, and
+// tries probeAttempts times, probeRetryWait apart, while failures look
+// transient.
+const (
+	probeTimeout   = 30 * time.Second
+	probeAttempts  = 3
+	probeRetryWait = 5 * time.Second
+)
+
+// ErrRepositoryNotInitialized is returned by ProbeRepository when the
+// credentials work but there is no repository yet. The first backup
+// initializes it.
+var ErrRepositoryNotInitialized = errors.New("restic repository is not initialized yet; the first backup initializes it")
+
+// ProbeRepository checks that the restic repository can be reached with the
+// configured credentials, so a mistyped key or password shows up at startup
+// rather than when the first backup fails. Unlike CheckRepository, it never
+// initializes the repository and only reads its config file, without
+// locking it, so it is cheap enough to run on every start.
+func (m *Manager) ProbeRepository(ctx context.Context) error {
+	if m.ResticRunner == nil && !m.repositoryConfigured() {
+		return fmt.Errorf("RESTIC_REPOSITORY environment variable is not set")
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := m.probeRepositoryOnce(ctx)
+		if err == nil || !retry || attempt >= probeAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.clock().After(probeRetryWait):
+		}
+	}
+}
+
+// probeRepositoryOnce runs restic cat config once, and reports whether a
+// failure is worth another try.
+func (m *Manager) probeRepositoryOnce(ctx context.Context) (retry bool, err error) {
+	probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	exitCode, output, runErr := m.runCommandWithOutput(probeCtx, "restic", "cat", "config", "--no-lock")
+	switch {
+	case ctx.Err() != nil:
+		return false, ctx.Err()
+	case probeCtx.Err() != nil:
+		return true, &ResticError{Command: "cat config", ExitCode: -1, Err: fmt.Errorf("no answer within %v", probeTimeout)}
+	case exitCode == 0:
+		return false, nil
+	case repositoryMissing(m.ResticVersion, exitCode, output):
+		return false, ErrRepositoryNotInitialized
+	}
+	resticErr := &ResticError{Command: "cat config", ExitCode: exitCode, Output: output, Err: runErr}
+	return resticErr.Transient(), resticErr
+}
@@ -0,0 +1,84 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/clock"
+)
+
+// probeManager returns a Manager whose restic commands exit with the codes
+// in exits, in turn, and records their arguments in calls.
+func probeManager(calls *[][]string, exits ...int) *Manager {
+	return &Manager{
+		ResticRunner:  func(context.Context, string) error { return nil },
+		ResticVersion: ResticVersion{0, 17, 3},
+		CommandRunner: func(_ context.Context, name string, args ...string) (int, error) {
+			*calls = append(*calls, args)
+			exit := exits[0]
+			if len(exits) > 1 {
+				exits = exits[1:]
+			}
+			return exit, nil
+		},
+	}
+}
+
+func TestManager_ProbeRepository(t *testing.T) {
+	t.Run("reachable", func(t *testing.T) {
+		var calls [][]string
+		m := probeManager(&calls, 0)
+		if err := m.ProbeRepository(context.Background()); err != nil {
+			t.Fatalf("ProbeRepository() error: %v", err)
+		}
+		if len(calls) != 1 || !slices.Equal(calls[0], []string{"cat", "config", "--no-lock"}) {
+			t.Errorf("ProbeRepository() ran %v, want one restic cat config --no-lock", calls)
+		}
+	})
+
+	t.Run("not initialized", func(t *testing.T) {
+		var calls [][]string
+		m := probeManager(&calls, 10)
+		if err := m.ProbeRepository(context.Background()); !errors.Is(err, ErrRepositoryNotInitialized) {
+			t.Errorf("ProbeRepository() error = %v, want ErrRepositoryNotInitialized", err)
+		}
+		if len(calls) != 1 {
+			t.Errorf("ProbeRepository() ran %v, want no restic init", calls)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		var calls [][]string
+		m := probeManager(&calls, 12)
+		var resticErr *ResticError
+		if err := m.ProbeRepository(context.Background()); !errors.As(err, &resticErr) || resticErr.ExitCode != 12 {
+			t.Errorf("ProbeRepository() error = %v, want restic's exit code 12", err)
+		}
+		if len(calls) != 1 {
+			t.Errorf("ProbeRepository() ran restic %d times, want no retries", len(calls))
+		}
+	})
+
+	t.Run("transient failures", func(t *testing.T) {
+		var calls [][]string
+		m := probeManager(&calls, resticExitLockFailed, resticExitLockFailed, resticExitLockFailed, 0)
+		fake := clock.NewFake(time.Now())
+		m.Clock = fake
+
+		done := make(chan error, 1)
+		go func() { done <- m.ProbeRepository(context.Background()) }()
+		for range probeAttempts - 1 {
+			fake.BlockUntil(1)
+			fake.Advance(probeRetryWait)
+		}
+		if err := <-done; err == nil {
+			t.Error("ProbeRepository() succeeded after the last attempt failed")
+		}
+		if len(calls) != probeAttempts {
+			t.Errorf("ProbeRepository() ran restic %d times, want %d", len(calls), probeAttempts)
+		}
+	})
+}
@@ -0,0 +1,290 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// playerdataFile is the game's list of every player who has joined, with
+// their roles and privileges, in the Playerdata directory.
+const playerdataFile = "playerdata.json"
+
+// purgeBootTimeout bounds how long PurgePlayer waits for the server to boot
+// again before taking the snapshot that leaves the player out.
+const purgeBootTimeout = 10 * time.Minute
+
+// ErrPlayerNotFound is returned when a player to purge has no data.
+var ErrPlayerNotFound = errors.New("player not found")
+
+// PurgeResult describes a player's data, found by PreviewPurge or removed by
+// PurgePlayer.
+type PurgeResult struct {
+	// PlayerUID is the player's UID, as the game stores it.
+	PlayerUID string
+
+	// PlayerName is the player's last known name, if recorded.
+	PlayerName string
+
+	// SaveRows is how many rows of the savegame's playerdata table belong
+	// to the player.
+	SaveRows int
+
+	// PlayerdataEntries is how many entries of Playerdata/playerdata.json
+	// belong to the player.
+	PlayerdataEntries int
+
+	// Snapshot is true if a snapshot without the player's data was taken.
+	Snapshot bool
+}
+
+// PreviewPurge finds the data PurgePlayer would remove for player, a UID or
+// last known player name, without changing anything.
+func (m *Manager) PreviewPurge(ctx context.Context, player string) (*PurgeResult, error) {
+	m.applyPathDefaults()
+	result, err := m.findPlayer(player)
+	if err != nil {
+		return nil, err
+	}
+
+	savePath, err := m.getSaveFilePath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get save file path: %w", err)
+	}
+	if result.SaveRows, err = vcdbtree.CountPlayerRows(ctx, savePath, result.PlayerUID); err != nil {
+		return nil, err
+	}
+	if result.SaveRows == 0 && result.PlayerdataEntries == 0 {
+		return nil, fmt.Errorf("%w: no data for %q", ErrPlayerNotFound, player)
+	}
+	return result, nil
+}
+
+// PurgePlayer removes a player's data from the live world, for deletion
+// requests: the savegame's playerdata rows and the player's entry in
+// Playerdata/playerdata.json. player is a UID or last known player name. The
+// server is stopped while the data is removed, and always restarted.
+//
+// With snapshot, a backup is taken once the server has booted again, so the
+// latest snapshot no longer holds the player's data. Older snapshots still
+// do until they are removed with restic forget.
+func (m *Manager) PurgePlayer(ctx context.Context, player string, snapshot bool) (*PurgeResult, error) {
+	if m.Restarter == nil {
+		return nil, ErrRestarterRequired
+	}
+	result, err := m.PreviewPurge(ctx, player)
+	if err != nil {
+		return nil, err
+	}
+	savePath, err := m.getSaveFilePath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get save file path: %w", err)
+	}
+
+	if err := m.removePlayer(ctx, savePath, result); err != nil {
+		return nil, err
+	}
+	if !snapshot {
+		return result, nil
+	}
+
+	fmt.Println("Purge: waiting for the server to boot before taking a snapshot...")
+	if err := m.waitForBoot(ctx, purgeBootTimeout); err != nil {
+		return result, fmt.Errorf("player data removed, but no snapshot was taken: %w", err)
+	}
+	if err := m.RunBackupNow(ctx, true); err != nil {
+		return result, fmt.Errorf("player data removed, but the snapshot failed: %w", err)
+	}
+	result.Snapshot = true
+	return result, nil
+}
+
+// removePlayer stops the server, removes the player's data, and starts the
+// server again.
+func (m *Manager) removePlayer(ctx context.Context, savePath string, result *PurgeResult) error {
+	// Don't let a backup run against a stopped server
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+
+	fmt.Printf("Purge: stopping server to remove the data of player %s...\n", result.PlayerUID)
+	if err := m.Restarter.StopServer(ctx); err != nil {
+		return fmt.Errorf("failed to stop server: %w", err)
+	}
+
+	purgeErr := m.removePlayerData(ctx, savePath, result)
+
+	fmt.Println("Purge: restarting server...")
+	if err := m.Restarter.StartServer(); err != nil {
+		return errors.Join(purgeErr, fmt.Errorf("failed to restart server: %w", err))
+	}
+	return purgeErr
+}
+
+// removePlayerData removes the player's rows and playerdata.json entries,
+// updating result with what was removed.
+func (m *Manager) removePlayerData(ctx context.Context, savePath string, result *PurgeResult) error {
+	// A leftover journal means the save file on its own isn't the whole world
+	for _, suffix := range []string{"-wal", "-journal"} {
+		if info, err := os.Stat(savePath + suffix); err == nil && info.Size() > 0 {
+			return fmt.Errorf("save file has a pending %s file, refusing to purge", suffix)
+		}
+	}
+
+	rows, err := vcdbtree.DeletePlayer(ctx, savePath, result.PlayerUID)
+	if err != nil {
+		return fmt.Errorf("failed to remove player from save file: %w", err)
+	}
+	result.SaveRows = rows
+
+	entries, err := m.rewritePlayerdata(result.PlayerUID)
+	if err != nil {
+		return err
+	}
+	result.PlayerdataEntries = entries
+	return nil
+}
+
+// findPlayer looks player up in playerdata.json by UID or, ignoring case,
+// by last known name. A player who isn't listed is taken to be a UID.
+func (m *Manager) findPlayer(player string) (*PurgeResult, error) {
+	player = strings.TrimSpace(player)
+	if player == "" {
+		return nil, fmt.Errorf("%w: no player given", ErrPlayerNotFound)
+	}
+
+	entries, err := m.readPlayerdata()
+	if err != nil {
+		return nil, err
+	}
+	var matches []*PurgeResult
+	for _, e := range entries {
+		if e.uid == player || (e.name != "" && strings.EqualFold(e.name, player)) {
+			matches = append(matches, &PurgeResult{PlayerUID: e.uid, PlayerName: e.name})
+		}
+	}
+	if len(matches) == 0 {
+		return &PurgeResult{PlayerUID: player}, nil
+	}
+
+	// The same name may have been used by different accounts over time
+	for _, match := range matches[1:] {
+		if match.PlayerUID != matches[0].PlayerUID {
+			return nil, fmt.Errorf("%q matches more than one player; give the UID instead", player)
+		}
+	}
+	result := matches[0]
+	for _, e := range entries {
+		if e.uid == result.PlayerUID {
+			result.PlayerdataEntries++
+		}
+	}
+	return result, nil
+}
+
+// playerdataEntry is an entry of playerdata.json. The raw fields are kept so
+// other entries are written back unchanged.
+type playerdataEntry struct {
+	uid  string
+	name string
+	raw  json.RawMessage
+}
+
+// readPlayerdata returns the entries of playerdata.json, or none if it
+// doesn't exist.
+func (m *Manager) readPlayerdata() ([]playerdataEntry, error) {
+	path := filepath.Join(m.GameDataDir, "Playerdata", playerdataFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	entries := make([]playerdataEntry, 0, len(raws))
+	for _, raw := range raws {
+		var fields struct {
+			PlayerUID           string `json:"PlayerUID"`
+			LastKnownPlayername string `json:"LastKnownPlayername"`
+		}
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		entries = append(entries, playerdataEntry{uid: fields.PlayerUID, name: fields.LastKnownPlayername, raw: raw})
+	}
+	return entries, nil
+}
+
+// rewritePlayerdata removes the entries for uid from playerdata.json and
+// returns how many there were.
+func (m *Manager) rewritePlayerdata(uid string) (int, error) {
+	entries, err := m.readPlayerdata()
+	if err != nil {
+		return 0, err
+	}
+	var kept []json.RawMessage
+	for _, e := range entries {
+		if e.uid != uid {
+			kept = append(kept, e.raw)
+		}
+	}
+	removed := len(entries) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	if kept == nil {
+		kept = []json.RawMessage{}
+	}
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode %s: %w", playerdataFile, err)
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return 0, fmt.Errorf("failed to encode %s: %w", playerdataFile, err)
+	}
+
+	// Write then rename, so a crash never leaves a truncated file behind
+	path := filepath.Join(m.GameDataDir, "Playerdata", playerdataFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, fmt.Errorf("failed to rename %s: %w", tmp, err)
+	}
+	return removed, nil
+}
+
+// waitForBoot waits until the server has booted, or timeout passes.
+func (m *Manager) waitForBoot(ctx context.Context, timeout time.Duration) error {
+	if m.BootChecker == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for !m.BootChecker.HasBooted() {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("server didn't boot: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
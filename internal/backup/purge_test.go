@@ -0,0 +1,154 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// setupPurge creates a world with the sample players, two of them listed in
+// playerdata.json.
+func setupPurge(t *testing.T) (m *Manager, savePath string, restarter *mockRestarter) {
+	t.Helper()
+
+	gameData := testsupport.CreateGameData(t)
+	gameDataDir := gameData.Dir
+	savePath = gameData.SavePath
+	testsupport.CreateSave(t, savePath)
+
+	playerdata := fmt.Sprintf(`[
+  {"PlayerUID": %q, "RoleCode": "suplayer", "LastKnownPlayername": "Alice"},
+  {"PlayerUID": %q, "RoleCode": "admin", "LastKnownPlayername": "Bob", "CustomPlayerData": {"x": 1}}
+]`, testsupport.SamplePlayers[0].UID, testsupport.SamplePlayers[1].UID)
+	if err := os.MkdirAll(filepath.Join(gameDataDir, "Playerdata"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(gameDataDir, "Playerdata", playerdataFile), []byte(playerdata), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	restarter = &mockRestarter{}
+	m = &Manager{
+		GameDataDir: gameDataDir,
+		StagingDir:  t.TempDir(),
+		Server:      &testsupport.Server{},
+		Restarter:   restarter,
+	}
+	return m, savePath, restarter
+}
+
+func TestManager_PreviewPurge(t *testing.T) {
+	m, savePath, _ := setupPurge(t)
+
+	for _, player := range []string{"alice", testsupport.SamplePlayers[0].UID} {
+		found, err := m.PreviewPurge(context.Background(), player)
+		if err != nil {
+			t.Fatalf("PreviewPurge(%q) failed: %v", player, err)
+		}
+		want := PurgeResult{PlayerUID: testsupport.SamplePlayers[0].UID, PlayerName: "Alice", SaveRows: 1, PlayerdataEntries: 1}
+		if *found != want {
+			t.Errorf("PreviewPurge(%q) = %+v, want %+v", player, *found, want)
+		}
+	}
+
+	// Players missing from playerdata.json are found by UID in the save
+	found, err := m.PreviewPurge(context.Background(), "SimplePlayer")
+	if err != nil || found.SaveRows != 1 || found.PlayerdataEntries != 0 {
+		t.Errorf("PreviewPurge(SimplePlayer) = %+v, %v, want one savegame row", found, err)
+	}
+
+	if _, err := m.PreviewPurge(context.Background(), "Carol"); !errors.Is(err, ErrPlayerNotFound) {
+		t.Errorf("PreviewPurge(Carol) error = %v, want ErrPlayerNotFound", err)
+	}
+
+	// Previewing changes nothing
+	if n, _ := vcdbtree.CountPlayerRows(context.Background(), savePath, testsupport.SamplePlayers[0].UID); n != 1 {
+		t.Errorf("expected the player's row to be kept, got %d", n)
+	}
+}
+
+func TestManager_PurgePlayer(t *testing.T) {
+	m, savePath, restarter := setupPurge(t)
+	uid := testsupport.SamplePlayers[1].UID
+
+	// The data must only be removed while the server is stopped
+	restarter.onStop = func() {
+		if n, _ := vcdbtree.CountPlayerRows(context.Background(), savePath, uid); n != 1 {
+			t.Errorf("player removed before the server stopped")
+		}
+	}
+
+	removed, err := m.PurgePlayer(context.Background(), "Bob", false)
+	if err != nil {
+		t.Fatalf("PurgePlayer failed: %v", err)
+	}
+	if removed.PlayerUID != uid || removed.SaveRows != 1 || removed.PlayerdataEntries != 1 || removed.Snapshot {
+		t.Errorf("PurgePlayer = %+v", *removed)
+	}
+	if calls := restarter.getCalls(); len(calls) != 2 || calls[0] != "stop" || calls[1] != "start" {
+		t.Errorf("Restarter calls = %v, want [stop start]", calls)
+	}
+
+	if n, _ := vcdbtree.CountPlayerRows(context.Background(), savePath, uid); n != 0 {
+		t.Errorf("expected the player's rows to be removed, %d left", n)
+	}
+	data, err := os.ReadFile(filepath.Join(m.GameDataDir, "Playerdata", playerdataFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []map[string]any
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("playerdata.json is no longer valid: %v", err)
+	}
+	if len(entries) != 1 || entries[0]["LastKnownPlayername"] != "Alice" || entries[0]["RoleCode"] != "suplayer" {
+		t.Errorf("playerdata.json = %s, want only Alice's entry, unchanged", data)
+	}
+}
+
+func TestManager_PurgePlayer_RestartsOnFailure(t *testing.T) {
+	m, savePath, restarter := setupPurge(t)
+	// The server didn't shut down cleanly
+	restarter.onStop = func() {
+		if err := os.WriteFile(savePath+"-wal", []byte("pending"), 0644); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err := m.PurgePlayer(context.Background(), "Alice", false); err == nil {
+		t.Fatal("expected PurgePlayer to refuse a save with a pending WAL")
+	}
+	if calls := restarter.getCalls(); len(calls) != 2 || calls[1] != "start" {
+		t.Errorf("Restarter calls = %v, want the server restarted", calls)
+	}
+}
+
+func TestManager_PurgePlayer_Snapshot(t *testing.T) {
+	m, _, _ := setupPurge(t)
+	m.BootChecker = testsupport.NewBootChecker(true)
+	// Fail the backup early, after it has started
+	m.BackupsDir = filepath.Join(t.TempDir(), "missing")
+	m.BackupTimeout = 1
+
+	removed, err := m.PurgePlayer(context.Background(), "Alice", true)
+	if err == nil {
+		t.Fatal("expected the failed snapshot to be reported")
+	}
+	if removed == nil || removed.SaveRows != 1 || removed.Snapshot {
+		t.Errorf("PurgePlayer = %+v, want the data removed without a snapshot", removed)
+	}
+}
+
+func TestManager_PurgePlayer_RequiresRestarter(t *testing.T) {
+	m, _, _ := setupPurge(t)
+	m.Restarter = nil
+	if _, err := m.PurgePlayer(context.Background(), "Alice", false); !errors.Is(err, ErrRestarterRequired) {
+		t.Errorf("PurgePlayer error = %v, want ErrRestarterRequired", err)
+	}
+}
@@ -0,0 +1,170 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RepoStats summarizes the restic repository, as reported by `!repo stats`.
+type RepoStats struct {
+	// RepoSize is the space the snapshots' data takes in the repository,
+	// after deduplication and compression.
+	RepoSize int64
+
+	// UncompressedSize is RepoSize before compression.
+	UncompressedSize int64
+
+	// StagingSize is the current size of the staging tree, roughly what
+	// each snapshot holds.
+	StagingSize int64
+
+	// Snapshots is the number of snapshots.
+	Snapshots int
+
+	// Oldest and Newest are when the oldest and newest snapshots were taken.
+	// Both are zero if there are no snapshots.
+	Oldest, Newest time.Time
+}
+
+// DedupRatio estimates how many times larger the snapshots would be if each
+// stored a full copy of the staging tree: the staging size times the number
+// of snapshots, over RepoSize. It is 0 if either is unknown.
+func (s RepoStats) DedupRatio() float64 {
+	if s.RepoSize <= 0 || s.StagingSize <= 0 || s.Snapshots == 0 {
+		return 0
+	}
+	return float64(s.StagingSize) * float64(s.Snapshots) / float64(s.RepoSize)
+}
+
+// Format describes the stats in one line, with snapshot ages relative to now.
+func (s RepoStats) Format(now time.Time) string {
+	line := fmt.Sprintf("Repository: %s stored (%s uncompressed), %d snapshot(s)",
+		formatBytes(s.RepoSize), formatBytes(s.UncompressedSize), s.Snapshots)
+	if s.Snapshots > 0 {
+		line += fmt.Sprintf(", oldest %s ago, newest %s ago",
+			formatAge(now.Sub(s.Oldest)), formatAge(now.Sub(s.Newest)))
+	}
+	if s.StagingSize > 0 {
+		line += fmt.Sprintf("; staging is %s", formatBytes(s.StagingSize))
+		if ratio := s.DedupRatio(); ratio > 0 {
+			line += fmt.Sprintf(", about %.1fx deduplication", ratio)
+		}
+	}
+	return line
+}
+
+// formatAge formats a duration for humans: days and hours from two days up,
+// minutes otherwise.
+func formatAge(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	if d >= 48*time.Hour {
+		return fmt.Sprintf("%dd%dh", d/(24*time.Hour), d%(24*time.Hour)/time.Hour)
+	}
+	return d.Round(time.Minute).String()
+}
+
+// resticRawDataStats is the part of `restic stats --mode raw-data --json`
+// output used here.
+type resticRawDataStats struct {
+	TotalSize             int64 `json:"total_size"`
+	TotalUncompressedSize int64 `json:"total_uncompressed_size"`
+}
+
+// resticSnapshot is the part of a `restic snapshots --json` entry used here.
+type resticSnapshot struct {
+	Time time.Time `json:"time"`
+}
+
+// RepositoryStats reports the size of the repository and its snapshots. Only
+// this server's snapshots are counted, selected as for a rollback to
+// "latest", so servers sharing a repository each see their own.
+func (m *Manager) RepositoryStats(ctx context.Context) (*RepoStats, error) {
+	m.applyPathDefaults()
+
+	filter := append([]string{"--host", m.snapshotHost()}, m.worldFilter()...)
+
+	var raw resticRawDataStats
+	if err := m.runResticJSON(ctx, &raw, append([]string{"stats", "--mode", "raw-data", "--json"}, filter...)...); err != nil {
+		return nil, err
+	}
+	var snapshots []resticSnapshot
+	if err := m.runResticJSON(ctx, &snapshots, append([]string{"snapshots", "--json"}, filter...)...); err != nil {
+		return nil, err
+	}
+
+	stats := &RepoStats{
+		RepoSize:         raw.TotalSize,
+		UncompressedSize: raw.TotalUncompressedSize,
+		Snapshots:        len(snapshots),
+	}
+	// Repositories in the version 1 format aren't compressed
+	if stats.UncompressedSize == 0 {
+		stats.UncompressedSize = stats.RepoSize
+	}
+	for _, s := range snapshots {
+		if stats.Oldest.IsZero() || s.Time.Before(stats.Oldest) {
+			stats.Oldest = s.Time
+		}
+		if s.Time.After(stats.Newest) {
+			stats.Newest = s.Time
+		}
+	}
+
+	size, err := dirSize(m.StagingDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to measure staging directory: %w", err)
+	}
+	stats.StagingSize = size
+	return stats, nil
+}
+
+// runResticJSON runs restic and decodes its standard output as JSON into v.
+func (m *Manager) runResticJSON(ctx context.Context, v any, args ...string) error {
+	var output []byte
+	if m.OutputRunner != nil {
+		var err error
+		if output, err = m.OutputRunner(ctx, args...); err != nil {
+			return fmt.Errorf("restic %s failed: %w", args[0], err)
+		}
+	} else {
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "restic", args...)
+		cmd.Env = m.resticEnv()
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("restic %s failed: %w\nOutput: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		output = out
+	}
+
+	if err := json.Unmarshal(output, v); err != nil {
+		return fmt.Errorf("failed to parse restic %s output: %w", args[0], err)
+	}
+	return nil
+}
+
+// dirSize returns the total size of the regular files under dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
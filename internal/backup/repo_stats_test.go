@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepositoryStats(t *testing.T) {
+	stagingDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(stagingDir, "serverconfig.json"), make([]byte, 3000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(stagingDir, "Saves"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stagingDir, "Saves", "chunk"), make([]byte, 7000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls [][]string
+	m := &Manager{
+		GameDataDir: t.TempDir(),
+		StagingDir:  stagingDir,
+		ResticHost:  "survival",
+		World:       "survival",
+		OutputRunner: func(ctx context.Context, args ...string) ([]byte, error) {
+			calls = append(calls, args)
+			if args[0] == "stats" {
+				return []byte(`{"total_size":5000,"total_uncompressed_size":12000,"snapshots_count":3}`), nil
+			}
+			return []byte(`[
+				{"time":"2025-01-02T12:00:00Z","short_id":"b"},
+				{"time":"2025-01-01T12:00:00Z","short_id":"a"},
+				{"time":"2025-01-03T12:00:00Z","short_id":"c"}
+			]`), nil
+		},
+	}
+
+	stats, err := m.RepositoryStats(context.Background())
+	if err != nil {
+		t.Fatalf("RepositoryStats failed: %v", err)
+	}
+
+	want := [][]string{
+		{"stats", "--mode", "raw-data", "--json", "--host", "survival", "--tag", "world=survival"},
+		{"snapshots", "--json", "--host", "survival", "--tag", "world=survival"},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("restic calls = %v, want %v", calls, want)
+	}
+
+	if stats.RepoSize != 5000 || stats.UncompressedSize != 12000 {
+		t.Errorf("sizes = %d/%d, want 5000/12000", stats.RepoSize, stats.UncompressedSize)
+	}
+	if stats.StagingSize != 10000 {
+		t.Errorf("StagingSize = %d, want 10000", stats.StagingSize)
+	}
+	if stats.Snapshots != 3 {
+		t.Errorf("Snapshots = %d, want 3", stats.Snapshots)
+	}
+	if want := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC); !stats.Oldest.Equal(want) {
+		t.Errorf("Oldest = %v, want %v", stats.Oldest, want)
+	}
+	if want := time.Date(2025, 1, 3, 12, 0, 0, 0, time.UTC); !stats.Newest.Equal(want) {
+		t.Errorf("Newest = %v, want %v", stats.Newest, want)
+	}
+	if ratio := stats.DedupRatio(); ratio != 6 {
+		t.Errorf("DedupRatio() = %v, want 6", ratio)
+	}
+
+	line := stats.Format(time.Date(2025, 1, 4, 13, 0, 0, 0, time.UTC))
+	for _, part := range []string{"4.88 KiB stored", "3 snapshot(s)", "oldest 3d1h ago", "newest 25h0m0s ago", "about 6.0x deduplication"} {
+		if !strings.Contains(line, part) {
+			t.Errorf("Format() = %q, missing %q", line, part)
+		}
+	}
+}
+
+func TestRepositoryStats_Empty(t *testing.T) {
+	m := &Manager{
+		GameDataDir: t.TempDir(),
+		StagingDir:  filepath.Join(t.TempDir(), "staging"),
+		ResticHost:  "survival",
+		OutputRunner: func(ctx context.Context, args ...string) ([]byte, error) {
+			if args[0] == "stats" {
+				return []byte(`{"total_size":0}`), nil
+			}
+			return []byte(`[]`), nil
+		},
+	}
+
+	stats, err := m.RepositoryStats(context.Background())
+	if err != nil {
+		t.Fatalf("RepositoryStats failed: %v", err)
+	}
+	if stats.Snapshots != 0 || stats.StagingSize != 0 || stats.DedupRatio() != 0 {
+		t.Errorf("stats = %+v, want an empty repository", stats)
+	}
+	if line := stats.Format(time.Now()); strings.Contains(line, "oldest") {
+		t.Errorf("Format() = %q, want no snapshot ages", line)
+	}
+}
+
+func TestRepositoryStats_ResticFails(t *testing.T) {
+	m := &Manager{
+		GameDataDir: t.TempDir(),
+		StagingDir:  t.TempDir(),
+		ResticHost:  "survival",
+		OutputRunner: func(ctx context.Context, args ...string) ([]byte, error) {
+			return nil, errors.New("repository locked")
+		},
+	}
+	if _, err := m.RepositoryStats(context.Background()); err == nil || !strings.Contains(err.Error(), "repository locked") {
+		t.Errorf("RepositoryStats error = %v, want the restic failure", err)
+	}
+
+	m.OutputRunner = func(ctx context.Context, args ...string) ([]byte, error) {
+		return []byte("not json"), nil
+	}
+	if _, err := m.RepositoryStats(context.Background()); err == nil {
+		t.Error("RepositoryStats succeeded on unparsable output")
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	tests := map[time.Duration]string{
+		-time.Minute:                  "0s",
+		90 * time.Second:              "2m0s",
+		30 * time.Hour:                "30h0m0s",
+		50*time.Hour + 20*time.Minute: "2d2h",
+	}
+	for d, want := range tests {
+		if got := formatAge(d); got != want {
+			t.Errorf("formatAge(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
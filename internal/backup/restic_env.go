@@ -0,0 +1,223 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DefaultSecretsDir is where Docker mounts secrets. Kubernetes secrets can be
+// mounted anywhere; set RESTIC_SECRETS_DIR to point at them.
+const DefaultSecretsDir = "/run/secrets"
+
+// resticSecretFiles maps secret file names to the restic variable that
+// should point at them.
+var resticSecretFiles = []struct {
+	file    string
+	envVar  string
+	current []string // variables that, if set, mean the secret isn't needed
+}{
+	{"restic_repository", "RESTIC_REPOSITORY_FILE", []string{"RESTIC_REPOSITORY", "RESTIC_REPOSITORY_FILE"}},
+	{"restic_password", "RESTIC_PASSWORD_FILE", []string{"RESTIC_PASSWORD", "RESTIC_PASSWORD_FILE", "RESTIC_PASSWORD_COMMAND"}},
+}
+
+// ApplyResticSecrets points restic at repository and password files found in
+// the secrets directory (RESTIC_SECRETS_DIR, default /run/secrets), for any
+// setting not already configured through the environment. The file paths
+// are exported as RESTIC_REPOSITORY_FILE and RESTIC_PASSWORD_FILE, so the
+// password itself never ends up in an environment variable.
+// Returns the variables that were set.
+func ApplyResticSecrets() ([]string, error) {
+	dir := os.Getenv("RESTIC_SECRETS_DIR")
+	if dir == "" {
+		dir = DefaultSecretsDir
+	}
+
+	var applied []string
+	for _, secret := range resticSecretFiles {
+		if anyEnvSet(secret.current...) {
+			continue
+		}
+
+		path := filepath.Join(dir, secret.file)
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return applied, fmt.Errorf("failed to stat secret %s: %w", path, err)
+		}
+		if info.IsDir() {
+			continue
+		}
+
+		if err := os.Setenv(secret.envVar, path); err != nil {
+			return applied, fmt.Errorf("failed to set %s: %w", secret.envVar, err)
+		}
+		applied = append(applied, secret.envVar)
+	}
+
+	return applied, nil
+}
+
+// ValidateResticEnv validates that required restic environment variables are set
+// when backups are enabled. Returns an error if any required variables are missing.
+//
+// The repository may be given as RESTIC_REPOSITORY or RESTIC_REPOSITORY_FILE, and
+// the password as RESTIC_PASSWORD, RESTIC_PASSWORD_FILE, or RESTIC_PASSWORD_COMMAND.
+// Referenced files must be readable.
+func ValidateResticEnv() error {
+	if !resticRepositoryConfigured() {
+		return fmt.Errorf("FATAL: BACKUP_INTERVAL is set but RESTIC_REPOSITORY is not set. Backups require RESTIC_REPOSITORY (or RESTIC_REPOSITORY_FILE) to be configured")
+	}
+	if !anyEnvSet("RESTIC_PASSWORD", "RESTIC_PASSWORD_FILE", "RESTIC_PASSWORD_COMMAND") {
+		return fmt.Errorf("FATAL: BACKUP_INTERVAL is set but RESTIC_PASSWORD is not set. Backups require RESTIC_PASSWORD, RESTIC_PASSWORD_FILE, or RESTIC_PASSWORD_COMMAND to be configured")
+	}
+
+	for _, name := range []string{"RESTIC_REPOSITORY_FILE", "RESTIC_PASSWORD_FILE"} {
+		path := os.Getenv(name)
+		if path == "" {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("FATAL: %s is set but cannot be read: %w", name, err)
+		}
+		f.Close()
+	}
+
+	return nil
+}
+
+// resticRepositoryConfigured reports whether restic has a repository to use.
+func resticRepositoryConfigured() bool {
+	return anyEnvSet("RESTIC_REPOSITORY", "RESTIC_REPOSITORY_FILE")
+}
+
+// anyEnvSet reports whether any of the given environment variables is non-empty.
+func anyEnvSet(names ...string) bool {
+	for _, name := range names {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// resticEnvPrefixes select the variables always passed through to restic by
+// prefix: restic's own settings and the locale.
+var resticEnvPrefixes = []string{
+	"RESTIC_",
+	"LC_", // locale categories, as LANG
+}
+
+// resticBackendEnvPrefixes map the repository schemes of restic's backends to
+// the prefixes of the variables their credentials are read from. Only the
+// credentials of the backend the repository uses are passed to restic.
+var resticBackendEnvPrefixes = map[string][]string{
+	"s3":     {"AWS_"},
+	"b2":     {"B2_"},
+	"azure":  {"AZURE_"},
+	"gs":     {"GOOGLE_"},
+	"swift":  {"OS_", "ST_"}, // Keystone and v1 auth
+	"rclone": {"RCLONE_"},
+}
+
+// resticEnvNames are the other variables restic, or the ssh and rclone
+// processes it starts, need to run.
+var resticEnvNames = []string{
+	"PATH", "HOME", "USER", "TMPDIR", "TZ", "LANG",
+	"SSH_AUTH_SOCK",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY",
+	"SSL_CERT_FILE", "SSL_CERT_DIR",
+	"XDG_CACHE_HOME",
+	"GOMAXPROCS", "GOGC", "GOMEMLIMIT",
+	// Windows
+	"SYSTEMROOT", "APPDATA", "LOCALAPPDATA", "USERPROFILE", "TEMP", "TMP",
+}
+
+// ResticEnviron returns the subset of environ restic is run with: restic's
+// own settings, the credentials of the repository's backend, and the basics
+// needed to run a process. Everything else the launcher was started with,
+// such as game server or hook settings, or another backend's credentials, is
+// left out. overrides, in "KEY=value" form, are added last and take
+// precedence, including in choosing the backend.
+func ResticEnviron(environ []string, overrides ...string) []string {
+	backend := resticBackendEnvPrefixes[repositoryScheme(append(environ[:len(environ):len(environ)], overrides...))]
+
+	var env []string
+	for _, kv := range environ {
+		name, _, ok := strings.Cut(kv, "=")
+		if ok && resticEnvAllowed(name, backend) {
+			env = append(env, kv)
+		}
+	}
+	return append(env, overrides...)
+}
+
+// repositoryScheme returns the backend scheme of the repository env names,
+// such as "s3" for "s3:s3.amazonaws.com/bucket", read from RESTIC_REPOSITORY
+// or the file RESTIC_REPOSITORY_FILE points at. Returns "" for a local
+// repository, or if the repository can't be read.
+func repositoryScheme(env []string) string {
+	repo := lookupEnv(env, "RESTIC_REPOSITORY")
+	if repo == "" {
+		if path := lookupEnv(env, "RESTIC_REPOSITORY_FILE"); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return ""
+			}
+			repo, _, _ = strings.Cut(string(data), "\n")
+		}
+	}
+	scheme, _, ok := strings.Cut(strings.TrimSpace(repo), ":")
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(scheme)
+}
+
+// resticEnvAllowed reports whether the variable name is passed to restic,
+// given the prefixes of the repository backend's credentials. Names are
+// compared case-insensitively, as on Windows, and to also allow the
+// lowercase proxy variables.
+func resticEnvAllowed(name string, backend []string) bool {
+	upper := strings.ToUpper(name)
+	for _, prefix := range slices.Concat(resticEnvPrefixes, backend) {
+		if strings.HasPrefix(upper, prefix) {
+			return true
+		}
+	}
+	for _, allowed := range resticEnvNames {
+		if upper == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupEnv returns the last value of name in env, which is the one exec uses.
+func lookupEnv(env []string, name string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if k, v, ok := strings.Cut(env[i], "="); ok && k == name {
+			return v
+		}
+	}
+	return ""
+}
+
+// resticEnv returns the environment restic is run with.
+func (m *Manager) resticEnv() []string {
+	if m.ResticEnv != nil {
+		return m.ResticEnv
+	}
+	return ResticEnviron(os.Environ())
+}
+
+// repositoryConfigured reports whether restic's environment names a repository.
+func (m *Manager) repositoryConfigured() bool {
+	env := m.resticEnv()
+	return lookupEnv(env, "RESTIC_REPOSITORY") != "" || lookupEnv(env, "RESTIC_REPOSITORY_FILE") != ""
+}
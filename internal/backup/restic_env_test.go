@@ -0,0 +1,307 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateResticEnv(t *testing.T) {
+	tests := []struct {
+		name           string
+		repository     string
+		password       string
+		expectErr      bool
+		expectedErrMsg string
+	}{
+		{
+			name:       "both set",
+			repository: "s3:s3.amazonaws.com/bucket",
+			password:   "secret123",
+			expectErr:  false,
+		},
+		{
+			name:           "repository missing",
+			repository:     "",
+			password:       "secret123",
+			expectErr:      true,
+			expectedErrMsg: "RESTIC_REPOSITORY",
+		},
+		{
+			name:           "password missing",
+			repository:     "s3:s3.amazonaws.com/bucket",
+			password:       "",
+			expectErr:      true,
+			expectedErrMsg: "RESTIC_PASSWORD",
+		},
+		{
+			name:           "both missing",
+			repository:     "",
+			password:       "",
+			expectErr:      true,
+			expectedErrMsg: "RESTIC_REPOSITORY", // Should fail on first check
+		},
+	}
+
+	for _, name := range []string{"RESTIC_REPOSITORY_FILE", "RESTIC_PASSWORD_FILE", "RESTIC_PASSWORD_COMMAND"} {
+		os.Unsetenv(name)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set or unset environment variables
+			if tt.repository == "" {
+				os.Unsetenv("RESTIC_REPOSITORY")
+			} else {
+				os.Setenv("RESTIC_REPOSITORY", tt.repository)
+			}
+			defer os.Unsetenv("RESTIC_REPOSITORY")
+
+			if tt.password == "" {
+				os.Unsetenv("RESTIC_PASSWORD")
+			} else {
+				os.Setenv("RESTIC_PASSWORD", tt.password)
+			}
+			defer os.Unsetenv("RESTIC_PASSWORD")
+
+			err := ValidateResticEnv()
+
+			if tt.expectErr {
+				if err == nil {
+					t.Error("ValidateResticEnv() expected error, got nil")
+					return
+				}
+				if tt.expectedErrMsg != "" && !strings.Contains(err.Error(), tt.expectedErrMsg) {
+					t.Errorf("ValidateResticEnv() error message should contain %q, got %q", tt.expectedErrMsg, err.Error())
+				}
+			} else {
+				if err != nil {
+					t.Errorf("ValidateResticEnv() unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateResticEnv_Alternatives(t *testing.T) {
+	for _, name := range []string{"RESTIC_REPOSITORY", "RESTIC_REPOSITORY_FILE", "RESTIC_PASSWORD", "RESTIC_PASSWORD_FILE", "RESTIC_PASSWORD_COMMAND"} {
+		os.Unsetenv(name)
+		defer os.Unsetenv(name)
+	}
+
+	dir := t.TempDir()
+	repoFile := filepath.Join(dir, "repo")
+	passwordFile := filepath.Join(dir, "password")
+	os.WriteFile(repoFile, []byte("s3:s3.amazonaws.com/bucket\n"), 0600)
+	os.WriteFile(passwordFile, []byte("secret\n"), 0600)
+
+	t.Run("files", func(t *testing.T) {
+		os.Setenv("RESTIC_REPOSITORY_FILE", repoFile)
+		os.Setenv("RESTIC_PASSWORD_FILE", passwordFile)
+		defer os.Unsetenv("RESTIC_REPOSITORY_FILE")
+		defer os.Unsetenv("RESTIC_PASSWORD_FILE")
+
+		if err := ValidateResticEnv(); err != nil {
+			t.Errorf("ValidateResticEnv() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("password command", func(t *testing.T) {
+		os.Setenv("RESTIC_REPOSITORY", "/srv/restic")
+		os.Setenv("RESTIC_PASSWORD_COMMAND", "cat /run/secrets/pw")
+		defer os.Unsetenv("RESTIC_REPOSITORY")
+		defer os.Unsetenv("RESTIC_PASSWORD_COMMAND")
+
+		if err := ValidateResticEnv(); err != nil {
+			t.Errorf("ValidateResticEnv() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("unreadable password file", func(t *testing.T) {
+		os.Setenv("RESTIC_REPOSITORY", "/srv/restic")
+		os.Setenv("RESTIC_PASSWORD_FILE", filepath.Join(dir, "missing"))
+		defer os.Unsetenv("RESTIC_REPOSITORY")
+		defer os.Unsetenv("RESTIC_PASSWORD_FILE")
+
+		err := ValidateResticEnv()
+		if err == nil || !strings.Contains(err.Error(), "RESTIC_PASSWORD_FILE") {
+			t.Errorf("ValidateResticEnv() error = %v, want RESTIC_PASSWORD_FILE error", err)
+		}
+	})
+}
+
+func TestApplyResticSecrets(t *testing.T) {
+	for _, name := range []string{"RESTIC_REPOSITORY", "RESTIC_REPOSITORY_FILE", "RESTIC_PASSWORD", "RESTIC_PASSWORD_FILE", "RESTIC_PASSWORD_COMMAND"} {
+		os.Unsetenv(name)
+		defer os.Unsetenv(name)
+	}
+
+	dir := t.TempDir()
+	os.Setenv("RESTIC_SECRETS_DIR", dir)
+	defer os.Unsetenv("RESTIC_SECRETS_DIR")
+
+	t.Run("no secrets", func(t *testing.T) {
+		applied, err := ApplyResticSecrets()
+		if err != nil || len(applied) != 0 {
+			t.Errorf("ApplyResticSecrets() = %v, %v; want nothing applied", applied, err)
+		}
+	})
+
+	os.WriteFile(filepath.Join(dir, "restic_repository"), []byte("/srv/restic"), 0600)
+	os.WriteFile(filepath.Join(dir, "restic_password"), []byte("secret"), 0600)
+
+	t.Run("env takes precedence", func(t *testing.T) {
+		os.Setenv("RESTIC_PASSWORD_COMMAND", "echo secret")
+		defer os.Unsetenv("RESTIC_PASSWORD_COMMAND")
+		defer os.Unsetenv("RESTIC_REPOSITORY_FILE")
+
+		applied, err := ApplyResticSecrets()
+		if err != nil {
+			t.Fatalf("ApplyResticSecrets() unexpected error: %v", err)
+		}
+		if len(applied) != 1 || applied[0] != "RESTIC_REPOSITORY_FILE" {
+			t.Errorf("ApplyResticSecrets() applied %v, want only RESTIC_REPOSITORY_FILE", applied)
+		}
+		if os.Getenv("RESTIC_PASSWORD_FILE") != "" {
+			t.Error("RESTIC_PASSWORD_FILE should not be set when RESTIC_PASSWORD_COMMAND is configured")
+		}
+	})
+
+	t.Run("secrets applied", func(t *testing.T) {
+		applied, err := ApplyResticSecrets()
+		if err != nil {
+			t.Fatalf("ApplyResticSecrets() unexpected error: %v", err)
+		}
+		if len(applied) != 2 {
+			t.Errorf("ApplyResticSecrets() applied %v, want both secrets", applied)
+		}
+		if got := os.Getenv("RESTIC_PASSWORD_FILE"); got != filepath.Join(dir, "restic_password") {
+			t.Errorf("RESTIC_PASSWORD_FILE = %q", got)
+		}
+		if err := ValidateResticEnv(); err != nil {
+			t.Errorf("ValidateResticEnv() after applying secrets: %v", err)
+		}
+	})
+}
+
+func TestResticEnviron(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin",
+		"HOME=/root",
+		"RESTIC_REPOSITORY=s3:example.com/bucket",
+		"RESTIC_PASSWORD_FILE=/run/secrets/restic_password",
+		"AWS_ACCESS_KEY_ID=key",
+		"B2_ACCOUNT_KEY=b2key",
+		"https_proxy=http://proxy:3128",
+		"VS_SERVER_TARGZ_URL=https://cdn.example.com/vs.tar.gz",
+		"BACKUP_INTERVAL=1h",
+		"DISCORD_WEBHOOK=https://example.com/secret",
+		"LC_ALL=C.UTF-8",
+		"MALFORMED",
+	}
+
+	// The override moves the repository to B2, so S3 credentials stay behind
+	got := ResticEnviron(environ, "RESTIC_REPOSITORY=b2:other")
+
+	want := []string{
+		"PATH=/usr/bin",
+		"HOME=/root",
+		"RESTIC_REPOSITORY=s3:example.com/bucket",
+		"RESTIC_PASSWORD_FILE=/run/secrets/restic_password",
+		"B2_ACCOUNT_KEY=b2key",
+		"https_proxy=http://proxy:3128",
+		"LC_ALL=C.UTF-8",
+		"RESTIC_REPOSITORY=b2:other",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ResticEnviron() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if v := lookupEnv(got, "RESTIC_REPOSITORY"); v != "b2:other" {
+		t.Errorf("lookupEnv(RESTIC_REPOSITORY) = %q, want the override", v)
+	}
+}
+
+func TestResticEnviron_BackendCredentials(t *testing.T) {
+	repoFile := filepath.Join(t.TempDir(), "restic_repository")
+	if err := os.WriteFile(repoFile, []byte("swift:container:/restic\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	credentials := []string{
+		"AWS_SECRET_ACCESS_KEY=aws",
+		"B2_ACCOUNT_KEY=b2",
+		"AZURE_ACCOUNT_KEY=azure",
+		"GOOGLE_APPLICATION_CREDENTIALS=/gcs.json",
+		"OS_PASSWORD=swift",
+		"ST_KEY=swift1",
+		"RCLONE_CONFIG=/rclone.conf",
+	}
+
+	tests := []struct {
+		repo []string
+		want []string
+	}{
+		{[]string{"RESTIC_REPOSITORY=s3:s3.amazonaws.com/bucket"}, []string{"AWS_SECRET_ACCESS_KEY=aws"}},
+		{[]string{"RESTIC_REPOSITORY=gs:bucket:/"}, []string{"GOOGLE_APPLICATION_CREDENTIALS=/gcs.json"}},
+		{[]string{"RESTIC_REPOSITORY_FILE=" + repoFile}, []string{"OS_PASSWORD=swift", "ST_KEY=swift1"}},
+		{[]string{"RESTIC_REPOSITORY=/srv/restic"}, nil},
+		{[]string{"RESTIC_REPOSITORY=sftp:user@host:/srv/restic"}, nil},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		got := ResticEnviron(append(slices.Clone(tt.repo), credentials...))
+		want := append(slices.Clone(tt.repo), tt.want...)
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("ResticEnviron(%v) =\n%s\nwant\n%s", tt.repo, strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
+
+func TestManager_RepositoryConfigured_UsesResticEnv(t *testing.T) {
+	os.Unsetenv("RESTIC_REPOSITORY")
+	os.Unsetenv("RESTIC_REPOSITORY_FILE")
+
+	m := &Manager{ResticEnv: []string{"RESTIC_REPOSITORY=/srv/restic"}}
+	if !m.repositoryConfigured() {
+		t.Error("repositoryConfigured() = false, want true from ResticEnv")
+	}
+
+	m = &Manager{ResticEnv: []string{}}
+	os.Setenv("RESTIC_REPOSITORY", "/srv/restic")
+	defer os.Unsetenv("RESTIC_REPOSITORY")
+	if m.repositoryConfigured() {
+		t.Error("repositoryConfigured() = true, want false: an explicit ResticEnv replaces the process environment")
+	}
+}
+
+func TestManager_ResticRunsWithFilteredEnv(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "env")
+	writeHook(t, dir, "restic", "env > "+out)
+
+	origPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+origPath)
+	defer os.Setenv("PATH", origPath)
+	os.Setenv("VS_UNRELATED_SECRET", "hunter2")
+	defer os.Unsetenv("VS_UNRELATED_SECRET")
+
+	m := &Manager{ResticEnv: ResticEnviron(os.Environ(), "RESTIC_REPOSITORY=/srv/restic")}
+	if _, _, err := m.runCommandWithOutput(context.Background(), "restic", "cat", "config"); err != nil {
+		t.Fatalf("runCommandWithOutput() error = %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("fake restic did not run: %v", err)
+	}
+	env := string(data)
+	if !strings.Contains(env, "RESTIC_REPOSITORY=/srv/restic") {
+		t.Errorf("restic environment is missing RESTIC_REPOSITORY:\n%s", env)
+	}
+	if strings.Contains(env, "VS_UNRELATED_SECRET") {
+		t.Errorf("restic environment leaked an unrelated variable:\n%s", env)
+	}
+}
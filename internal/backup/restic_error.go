@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// resticExitLockFailed is restic's exit code, since 0.17, when it couldn't
+// lock the repository.
+const resticExitLockFailed = 11
+
+// ResticError is returned when a restic command fails.
+type ResticError struct {
+	// Command is the restic command that failed, e.g. "backup" or
+	// "forget --prune".
+	Command string
+
+	// ExitCode is restic's exit code, or -1 if it didn't run or was killed.
+	ExitCode int
+
+	// Output is what restic printed, if it isn't shown elsewhere. It is
+	// part of the error message.
+	Output string
+
+	// Err is the error the command failed with, if any besides its exit
+	// code.
+	Err error
+
+	// stderr is the end of what restic printed to stderr while it was
+	// shown on the console, for Transient.
+	stderr string
+}
+
+func (e *ResticError) Error() string {
+	msg := fmt.Sprintf("restic %s failed", e.Command)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	} else {
+		msg += fmt.Sprintf(" with exit code %d", e.ExitCode)
+	}
+	if e.Output != "" {
+		msg += "\nOutput: " + e.Output
+	}
+	return msg
+}
+
+func (e *ResticError) Unwrap() error {
+	return e.Err
+}
+
+// transientResticMessages are parts of restic's messages for failures that
+// usually go away by themselves: a repository locked by another process, and
+// network or storage backend hiccups.
+var transientResticMessages = []string{
+	"unable to create lock",
+	"repository is already locked",
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"no such host",
+	"temporary failure in name resolution",
+	"network is unreachable",
+	"unexpected eof",
+	"500 internal server error",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+	"slowdown",
+	"requesttimeout",
+	"too many requests",
+}
+
+// Transient reports whether the failure is likely to go away by itself soon,
+// so the command is worth running again: the repository was locked, or
+// restic couldn't reach its storage backend.
+func (e *ResticError) Transient() bool {
+	if e.ExitCode == resticExitLockFailed {
+		return true
+	}
+	text := strings.ToLower(e.Output + "\n" + e.stderr)
+	for _, msg := range transientResticMessages {
+		if strings.Contains(text, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTransient reports whether err is a failure that is likely to go away by
+// itself soon, such as a locked repository or a network problem reaching
+// it, rather than one that needs fixing. A stage that timed out isn't transient, whatever restic said as it was
+// stopped.
+func IsTransient(err error) bool {
+	var timeout *StageTimeoutError
+	if errors.As(err, &timeout) {
+		return false
+	}
+	var resticErr *ResticError
+	return errors.As(err, &resticErr) && resticErr.Transient()
+}
+
+// resticStderrTail is how much of restic's stderr is kept for Transient.
+const resticStderrTail = 4096
+
+// runResticCommand runs cmd, a restic command, with its stderr shown on the
+// console, and returns a ResticError for command if it fails.
+func runResticCommand(cmd *exec.Cmd, command string) error {
+	tail := &tailBuffer{max: resticStderrTail}
+	cmd.Stderr = io.MultiWriter(os.Stderr, tail)
+	if err := cmd.Start(); err != nil {
+		return &ResticError{Command: command, ExitCode: -1, Err: err}
+	}
+	return waitResticCommand(cmd, command, tail)
+}
+
+// waitResticCommand waits for cmd, started with tail receiving its stderr,
+// and returns a ResticError for command if it fails.
+func waitResticCommand(cmd *exec.Cmd, command string, tail *tailBuffer) error {
+	err := cmd.Wait()
+	if err == nil {
+		return nil
+	}
+	exitCode := -1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	}
+	return &ResticError{Command: command, ExitCode: exitCode, Err: err, stderr: tail.String()}
+}
+
+// tailBuffer is an io.Writer that keeps the last max bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.max; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
@@ -0,0 +1,65 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"lock failed exit code", &ResticError{Command: "backup", ExitCode: 11}, true},
+		{"locked message", &ResticError{Command: "forget --prune", ExitCode: 1,
+			stderr: "unable to create lock in backend: repository is already locked by PID 12"}, true},
+		{"network", &ResticError{Command: "cat config", ExitCode: 1,
+			Output: "Fatal: unable to open config file: Get \"https://s3/\": dial tcp: lookup s3: no such host"}, true},
+		{"backend unavailable", fmt.Errorf("failed to run restic backup: %w",
+			&ResticError{Command: "backup", ExitCode: 1, stderr: "Save(<data/1234>) returned error: 503 Service Unavailable"}), true},
+		{"wrong password", &ResticError{Command: "backup", ExitCode: 12, stderr: "Fatal: wrong password or no key found"}, false},
+		{"stage timed out", &StageTimeoutError{Stage: StageResticBackup, Timeout: time.Hour,
+			Err: &ResticError{Command: "backup", ExitCode: -1, stderr: "i/o timeout"}}, false},
+		{"not restic", errors.New("connection reset by peer"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResticError_Error(t *testing.T) {
+	err := &ResticError{Command: "cat config", ExitCode: 1, Output: "Fatal: nope"}
+	if got, want := err.Error(), "restic cat config failed with exit code 1\nOutput: Fatal: nope"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	wrapped := errors.New("exit status 3")
+	err = &ResticError{Command: "backup", ExitCode: 3, Err: wrapped, stderr: "not shown"}
+	if got := err.Error(); got != "restic backup failed: exit status 3" {
+		t.Errorf("Error() = %q", got)
+	}
+	if !errors.Is(err, wrapped) {
+		t.Error("ResticError doesn't unwrap to its cause")
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: 8}
+	b.Write([]byte("hello "))
+	b.Write([]byte("world"))
+	if got := b.String(); got != "lo world" {
+		t.Errorf("String() = %q, want %q", got, "lo world")
+	}
+	b.Write([]byte(strings.Repeat("x", 20)))
+	if got := b.String(); got != strings.Repeat("x", 8) {
+		t.Errorf("String() = %q", got)
+	}
+}
@@ -0,0 +1,126 @@
+package backup
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// defaultResticHost is the snapshot host name used when neither ResticHost
+// nor the save file name is available.
+const defaultResticHost = "vintagestory"
+
+// WorldTag is the restic tag prefix naming the world a snapshot belongs to
+// when World is set, as in "world=survival".
+const WorldTag = "world="
+
+// worldsDirName is the directory in the cache where the staging directories
+// of named worlds are kept.
+const worldsDirName = "worlds"
+
+// worldsDir returns where the staging directories of named worlds are kept,
+// one per world, so each world's snapshots have paths of their own.
+func (m *Manager) worldsDir() string {
+	return filepath.Join(m.cacheDir(), worldsDirName)
+}
+
+// snapshotHost returns the host name recorded in snapshots and used to select
+// them for forget. Containers get a new random hostname whenever they are
+// recreated, which would split the snapshot history into one group per
+// container, so a stable name is used instead: ResticHost if set, otherwise
+// World, otherwise the save file name (e.g. "default" for default.vcdbs).
+func (m *Manager) snapshotHost() string {
+	if m.ResticHost != "" {
+		return m.ResticHost
+	}
+	if m.World != "" {
+		return m.World
+	}
+	if name, err := m.getSaveFileName(); err == nil {
+		if host := strings.TrimSuffix(name, ".vcdbs"); host != "" {
+			return host
+		}
+	}
+	return defaultResticHost
+}
+
+// backupArgs returns the arguments for restic backup, without the path.
+func (m *Manager) backupArgs() []string {
+	args := []string{"backup", "--json", "--host", m.snapshotHost()}
+	for _, tag := range resticTags(m.snapshotMetadata()) {
+		args = append(args, "--tag", tag)
+	}
+	args = append(args, m.worldFilter()...)
+	return append(args, m.changeDetectionArgs()...)
+}
+
+// forgetArgs returns the arguments for restic forget --prune. Only snapshots
+// of this server's host, and of its world if World is set, are considered.
+func (m *Manager) forgetArgs() []string {
+	return append(m.forgetPolicyArgs(m.pruneRetention()), "--prune")
+}
+
+// forgetPolicyArgs returns the arguments for restic forget with retention,
+// selecting snapshots as forgetArgs does. Pinned snapshots are always kept.
+func (m *Manager) forgetPolicyArgs(retention string) []string {
+	args := []string{"forget", "--host", m.snapshotHost()}
+	args = append(args, m.worldFilter()...)
+	if m.PruneGroupBy != "" {
+		args = append(args, "--group-by", m.PruneGroupBy)
+	}
+	args = append(args, strings.Fields(retention)...)
+	return append(args, "--keep-tag", PinnedTag)
+}
+
+// validGroupByFields are the fields restic forget can group snapshots by.
+var validGroupByFields = map[string]bool{"host": true, "paths": true, "tags": true}
+
+// ParseGroupBy validates a restic --group-by value such as "host,paths".
+// An empty string is returned unchanged and leaves restic's default in place.
+func ParseGroupBy(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+
+	fields := strings.Split(s, ",")
+	for i, f := range fields {
+		f = strings.TrimSpace(f)
+		if !validGroupByFields[f] {
+			return "", fmt.Errorf("unknown group-by field %q: must be a comma-separated list of host, paths, and tags", f)
+		}
+		fields[i] = f
+	}
+	return strings.Join(fields, ","), nil
+}
+
+// worldFilter returns the restic arguments tagging or selecting the snapshots
+// of World, or nothing if World isn't set.
+func (m *Manager) worldFilter() []string {
+	if m.World == "" {
+		return nil
+	}
+	return []string{"--tag", WorldTag + m.World}
+}
+
+// ParseWorldName validates a world name for World. It ends up in a directory
+// name and a restic tag, so only letters, digits, '.', '-', and '_' are
+// allowed. An empty string is returned unchanged.
+func ParseWorldName(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	if s == "." || s == ".." {
+		return "", fmt.Errorf("%q is not a valid world name", s)
+	}
+	for _, ch := range s {
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '.', ch == '-', ch == '_':
+		default:
+			return "", fmt.Errorf("invalid character %q in world name %q: only letters, digits, '.', '-', and '_' are allowed", ch, s)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,161 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotHost(t *testing.T) {
+	t.Run("explicit host", func(t *testing.T) {
+		m := &Manager{ResticHost: "survival", GameDataDir: t.TempDir()}
+		if got := m.snapshotHost(); got != "survival" {
+			t.Errorf("snapshotHost() = %q, want survival", got)
+		}
+	})
+
+	t.Run("world", func(t *testing.T) {
+		m := &Manager{World: "creative", GameDataDir: t.TempDir()}
+		if got := m.snapshotHost(); got != "creative" {
+			t.Errorf("snapshotHost() = %q, want creative", got)
+		}
+	})
+
+	t.Run("save file name", func(t *testing.T) {
+		gameDataDir := t.TempDir()
+		os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"),
+			[]byte(`{"WorldConfig": {"SaveFileLocation": "/gamedata/Saves/myworld.vcdbs"}}`), 0644)
+
+		m := &Manager{GameDataDir: gameDataDir}
+		if got := m.snapshotHost(); got != "myworld" {
+			t.Errorf("snapshotHost() = %q, want myworld", got)
+		}
+	})
+
+	t.Run("default save", func(t *testing.T) {
+		gameDataDir := t.TempDir()
+		os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), []byte(`{}`), 0644)
+
+		m := &Manager{GameDataDir: gameDataDir}
+		if got := m.snapshotHost(); got != "default" {
+			t.Errorf("snapshotHost() = %q, want default", got)
+		}
+	})
+
+	t.Run("no server config", func(t *testing.T) {
+		m := &Manager{GameDataDir: t.TempDir()}
+		if got := m.snapshotHost(); got != defaultResticHost {
+			t.Errorf("snapshotHost() = %q, want %q", got, defaultResticHost)
+		}
+	})
+}
+
+func TestBackupArgs(t *testing.T) {
+	m := &Manager{
+		ResticHost:     "survival",
+		ServerBinaries: ServerBinaries{Version: "1.21.6"},
+	}
+	want := []string{"backup", "--json", "--host", "survival", "--tag", "server_version=1.21.6", "--ignore-inode", "--ignore-ctime"}
+	if got := m.backupArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("backupArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestForgetArgs(t *testing.T) {
+	m := &Manager{
+		ResticHost:     "survival",
+		PruneRetention: "--keep-daily 7 --keep-weekly 4",
+	}
+	want := []string{"forget", "--host", "survival", "--keep-daily", "7", "--keep-weekly", "4", "--keep-tag", "pinned", "--prune"}
+	if got := m.forgetArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("forgetArgs() = %v, want %v", got, want)
+	}
+
+	m.PruneGroupBy = "host,tags"
+	want = []string{"forget", "--host", "survival", "--group-by", "host,tags", "--keep-daily", "7", "--keep-weekly", "4", "--keep-tag", "pinned", "--prune"}
+	if got := m.forgetArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("forgetArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestWorldArgs(t *testing.T) {
+	m := &Manager{World: "creative", PruneRetention: "--keep-daily 7"}
+
+	want := []string{"backup", "--json", "--host", "creative", "--tag", "world=creative", "--ignore-inode", "--ignore-ctime"}
+	if got := m.backupArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("backupArgs() = %v, want %v", got, want)
+	}
+
+	// Another world's snapshots under the same host are never pruned
+	m.ResticHost = "shared"
+	want = []string{"forget", "--host", "shared", "--tag", "world=creative", "--keep-daily", "7", "--keep-tag", "pinned", "--prune"}
+	if got := m.forgetArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("forgetArgs() = %v, want %v", got, want)
+	}
+
+	m.applyPathDefaults()
+	if want := "/backupcache/worlds/creative"; m.StagingDir != want {
+		t.Errorf("StagingDir = %q, want %q", m.StagingDir, want)
+	}
+
+	m.StagingDir = ""
+	m.CacheDir = "/cache"
+	m.applyPathDefaults()
+	if want := "/cache/worlds/creative"; m.StagingDir != want {
+		t.Errorf("StagingDir with CacheDir = %q, want %q", m.StagingDir, want)
+	}
+}
+
+func TestParseWorldName(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{" survival ", "survival", false},
+		{"Creative_2.old-1", "Creative_2.old-1", false},
+		{"..", "", true},
+		{"a/b", "", true},
+		{"my world", "", true},
+		{"a,b", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseWorldName(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseWorldName(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseWorldName(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseGroupBy(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"host", "host", false},
+		{"host,paths", "host,paths", false},
+		{" host , tags ", "host,tags", false},
+		{"hostname", "", true},
+		{"host,", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseGroupBy(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseGroupBy(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseGroupBy(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ResticVersion is a restic release version. The zero value means the
+// version is unknown, in which case the newest behavior is assumed.
+type ResticVersion struct {
+	Major, Minor, Patch int
+}
+
+// resticExitCodesVersion is the first restic release that exits with code 10
+// when the repository doesn't exist.
+var resticExitCodesVersion = ResticVersion{0, 17, 0}
+
+var resticVersionPattern = regexp.MustCompile(`^restic (\d+)\.(\d+)\.(\d+)`)
+
+// ParseResticVersion parses the output of `restic version`, for example
+// "restic 0.17.3 compiled with go1.23.1 on linux/amd64".
+func ParseResticVersion(output string) (ResticVersion, error) {
+	m := resticVersionPattern.FindStringSubmatch(strings.TrimSpace(output))
+	if m == nil {
+		return ResticVersion{}, fmt.Errorf("unrecognized restic version output: %q", strings.TrimSpace(output))
+	}
+
+	var v ResticVersion
+	for i, field := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return ResticVersion{}, fmt.Errorf("invalid restic version %q: %w", m[0], err)
+		}
+		*field = n
+	}
+	return v, nil
+}
+
+// IsZero reports whether the version is unknown.
+func (v ResticVersion) IsZero() bool {
+	return v == ResticVersion{}
+}
+
+// AtLeast reports whether v is other or newer. An unknown version is assumed
+// to be new enough.
+func (v ResticVersion) AtLeast(other ResticVersion) bool {
+	if v.IsZero() {
+		return true
+	}
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor > other.Minor
+	}
+	return v.Patch >= other.Patch
+}
+
+func (v ResticVersion) String() string {
+	if v.IsZero() {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// DetectRestic finds the restic binary on PATH and returns its path and version.
+func DetectRestic(ctx context.Context) (path string, version ResticVersion, err error) {
+	path, err = exec.LookPath("restic")
+	if err != nil {
+		return "", ResticVersion{}, fmt.Errorf("restic not found on PATH: %w", err)
+	}
+
+	output, err := exec.CommandContext(ctx, path, "version").Output()
+	if err != nil {
+		return path, ResticVersion{}, fmt.Errorf("failed to run restic version: %w", err)
+	}
+
+	version, err = ParseResticVersion(string(output))
+	if err != nil {
+		return path, ResticVersion{}, err
+	}
+	return path, version, nil
+}
+
+// repositoryMissing reports whether a failed `restic cat config` means the
+// repository doesn't exist yet, as opposed to being unreachable or locked
+// with a different password. Since 0.17 restic says so with exit code 10;
+// older releases exit with 1 and only the message tells the cases apart.
+func repositoryMissing(version ResticVersion, exitCode int, output string) bool {
+	if version.AtLeast(resticExitCodesVersion) {
+		return exitCode == 10
+	}
+	return exitCode == 1 && strings.Contains(output, "Is there a repository at the following location?")
+}
@@ -0,0 +1,100 @@
+package backup
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseResticVersion(t *testing.T) {
+	tests := []struct {
+		output  string
+		want    ResticVersion
+		wantErr bool
+	}{
+		{"restic 0.17.3 compiled with go1.23.1 on linux/amd64\n", ResticVersion{0, 17, 3}, false},
+		{"restic 0.16.0 (v0.16.0-0-gabcdef) compiled with go1.20.6 on linux/arm64", ResticVersion{0, 16, 0}, false},
+		{"restic 1.0.0", ResticVersion{1, 0, 0}, false},
+		{"rustic 0.7.0", ResticVersion{}, true},
+		{"", ResticVersion{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseResticVersion(tt.output)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseResticVersion(%q) error = %v, wantErr %v", tt.output, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseResticVersion(%q) = %v, want %v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestResticVersion_AtLeast(t *testing.T) {
+	tests := []struct {
+		v, other ResticVersion
+		want     bool
+	}{
+		{ResticVersion{0, 17, 0}, ResticVersion{0, 17, 0}, true},
+		{ResticVersion{0, 17, 3}, ResticVersion{0, 17, 0}, true},
+		{ResticVersion{0, 18, 0}, ResticVersion{0, 17, 5}, true},
+		{ResticVersion{1, 0, 0}, ResticVersion{0, 17, 0}, true},
+		{ResticVersion{0, 16, 4}, ResticVersion{0, 17, 0}, false},
+		{ResticVersion{0, 17, 0}, ResticVersion{0, 17, 1}, false},
+		{ResticVersion{}, ResticVersion{0, 17, 0}, true}, // Unknown is assumed current
+	}
+
+	for _, tt := range tests {
+		if got := tt.v.AtLeast(tt.other); got != tt.want {
+			t.Errorf("%v.AtLeast(%v) = %v, want %v", tt.v, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestRepositoryMissing(t *testing.T) {
+	const oldMissingOutput = "Fatal: unable to open config file: stat /repo/config: no such file or directory\nIs there a repository at the following location?\n/repo\n"
+
+	tests := []struct {
+		name     string
+		version  ResticVersion
+		exitCode int
+		output   string
+		want     bool
+	}{
+		{"current, exit 10", ResticVersion{0, 17, 0}, 10, "", true},
+		{"current, wrong password", ResticVersion{0, 17, 0}, 12, "", false},
+		{"unknown version, exit 10", ResticVersion{}, 10, "", true},
+		{"old, missing repository", ResticVersion{0, 16, 4}, 1, oldMissingOutput, true},
+		{"old, wrong password", ResticVersion{0, 16, 4}, 1, "Fatal: wrong password or no key found\n", false},
+		{"old, exit 10 means nothing", ResticVersion{0, 16, 4}, 10, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := repositoryMissing(tt.version, tt.exitCode, tt.output); got != tt.want {
+				t.Errorf("repositoryMissing() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureRepoInitialized_OldResticIgnoresExitCode10(t *testing.T) {
+	initCalled := false
+	m := &Manager{
+		ResticVersion: ResticVersion{0, 16, 4},
+		CommandRunner: func(ctx context.Context, name string, args ...string) (int, error) {
+			if len(args) >= 1 && args[0] == "init" {
+				initCalled = true
+				return 0, nil
+			}
+			return 10, nil
+		},
+	}
+
+	if err := m.ensureRepoInitialized(context.Background()); err == nil {
+		t.Error("ensureRepoInitialized() expected error for exit code 10 on restic 0.16")
+	}
+	if initCalled {
+		t.Error("restic init should not run when the repository state is unclear")
+	}
+}
@@ -0,0 +1,104 @@
+package backup
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// resticResumableRestoreVersion is the first restic release whose restore
+// reports progress as JSON and can skip files that are already restored
+// (--overwrite if-changed), which makes an interrupted restore resumable.
+var resticResumableRestoreVersion = ResticVersion{0, 17, 0}
+
+// RestoreProgress is a progress update or the summary of `restic restore`.
+// Skipped files were already in the target with the right content, e.g.
+// from an interrupted restore.
+type RestoreProgress struct {
+	SecondsElapsed float64 `json:"seconds_elapsed"`
+	PercentDone    float64 `json:"percent_done"`
+	TotalFiles     int64   `json:"total_files"`
+	FilesRestored  int64   `json:"files_restored"`
+	FilesSkipped   int64   `json:"files_skipped"`
+	TotalBytes     int64   `json:"total_bytes"`
+	BytesRestored  int64   `json:"bytes_restored"`
+	BytesSkipped   int64   `json:"bytes_skipped"`
+}
+
+// String formats the progress as a single line.
+func (p RestoreProgress) String() string {
+	line := fmt.Sprintf("%5.1f%% %s of %s, %d of %d files",
+		p.PercentDone*100, formatBytes(p.BytesRestored+p.BytesSkipped), formatBytes(p.TotalBytes),
+		p.FilesRestored+p.FilesSkipped, p.TotalFiles)
+	if p.FilesSkipped > 0 {
+		line += fmt.Sprintf(" (%d already restored)", p.FilesSkipped)
+	}
+	return line
+}
+
+// resticRestoreMessage is a line of `restic restore --json` output.
+type resticRestoreMessage struct {
+	MessageType string `json:"message_type"`
+	RestoreProgress
+
+	// Set on errors
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+	Item string `json:"item"`
+}
+
+// ResticRestoreArgs returns the arguments for restoring snapshot into
+// target, limited to the include paths. restic releases that support it
+// report progress as JSON and skip files already restored with the right
+// content, so running the same restore again resumes it; resumable reports
+// whether that's the case.
+func ResticRestoreArgs(snapshot, target string, include []string, version ResticVersion) (args []string, resumable bool) {
+	args = []string{"restore", snapshot, "--target", target}
+	for _, path := range include {
+		args = append(args, "--include", path)
+	}
+	if !version.AtLeast(resticResumableRestoreVersion) {
+		return args, false
+	}
+	return append(args, "--json", "--overwrite", "if-changed"), true
+}
+
+// ParseResticRestoreOutput reads the output of `restic restore --json`,
+// calling onProgress with each progress update, and returns the summary.
+// Errors about single files are written to w, as is anything that isn't
+// JSON.
+func ParseResticRestoreOutput(r io.Reader, w io.Writer, onProgress func(RestoreProgress)) (*RestoreProgress, error) {
+	var summary *RestoreProgress
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		var msg resticRestoreMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			fmt.Fprintf(w, "%s\n", line)
+			continue
+		}
+
+		switch msg.MessageType {
+		case "status":
+			if onProgress != nil {
+				onProgress(msg.RestoreProgress)
+			}
+		case "summary":
+			progress := msg.RestoreProgress
+			summary = &progress
+		case "error":
+			fmt.Fprintf(w, "restic: %s: %s\n", msg.Item, msg.Error.Message)
+		case "verbose_status":
+			// Per-file actions are only printed with restic -v
+		default:
+			fmt.Fprintf(w, "%s\n", line)
+		}
+	}
+
+	return summary, scanner.Err()
+}
@@ -0,0 +1,62 @@
+package backup
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResticRestoreArgs(t *testing.T) {
+	args, resumable := ResticRestoreArgs("latest", "/backupcache/restore", []string{"/backupcache/staging"}, ResticVersion{0, 17, 3})
+	want := []string{"restore", "latest", "--target", "/backupcache/restore", "--include", "/backupcache/staging", "--json", "--overwrite", "if-changed"}
+	if !reflect.DeepEqual(args, want) || !resumable {
+		t.Errorf("ResticRestoreArgs() = %v, %v; want %v, true", args, resumable, want)
+	}
+
+	args, resumable = ResticRestoreArgs("abc123", "/tmp/r", nil, ResticVersion{0, 16, 4})
+	want = []string{"restore", "abc123", "--target", "/tmp/r"}
+	if !reflect.DeepEqual(args, want) || resumable {
+		t.Errorf("ResticRestoreArgs() for 0.16 = %v, %v; want %v, false", args, resumable, want)
+	}
+}
+
+func TestParseResticRestoreOutput(t *testing.T) {
+	output := strings.Join([]string{
+		`{"message_type":"status","seconds_elapsed":1,"percent_done":0.25,"total_files":4,"files_restored":0,"files_skipped":1,"total_bytes":4096,"bytes_restored":0,"bytes_skipped":1024}`,
+		`{"message_type":"verbose_status","action":"restored","item":"/backupcache/staging/serverconfig.json"}`,
+		`{"message_type":"error","error":{"message":"permission denied"},"during":"restore","item":"/backupcache/staging/Mods/a.zip"}`,
+		`not json`,
+		`{"message_type":"status","seconds_elapsed":2,"percent_done":0.5,"total_files":4,"files_restored":1,"files_skipped":1,"total_bytes":4096,"bytes_restored":1024,"bytes_skipped":1024}`,
+		`{"message_type":"summary","seconds_elapsed":3,"total_files":4,"files_restored":3,"files_skipped":1,"total_bytes":4096,"bytes_restored":3072,"bytes_skipped":1024}`,
+	}, "\n")
+
+	var updates []RestoreProgress
+	var w bytes.Buffer
+	summary, err := ParseResticRestoreOutput(strings.NewReader(output), &w, func(p RestoreProgress) {
+		updates = append(updates, p)
+	})
+	if err != nil {
+		t.Fatalf("ParseResticRestoreOutput failed: %v", err)
+	}
+
+	if len(updates) != 2 || updates[1].PercentDone != 0.5 || updates[0].FilesSkipped != 1 {
+		t.Errorf("updates = %+v", updates)
+	}
+	if summary == nil || summary.FilesRestored != 3 || summary.BytesSkipped != 1024 {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	want := "restic: /backupcache/staging/Mods/a.zip: permission denied\nnot json\n"
+	if w.String() != want {
+		t.Errorf("other output = %q, want %q", w.String(), want)
+	}
+}
+
+func TestRestoreProgress_String(t *testing.T) {
+	p := RestoreProgress{PercentDone: 0.5, TotalFiles: 4, FilesRestored: 1, FilesSkipped: 1, TotalBytes: 4096, BytesRestored: 1024, BytesSkipped: 1024}
+	want := " 50.0% 2.00 KiB of 4.00 KiB, 2 of 4 files (1 already restored)"
+	if got := p.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,59 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultRetryBackoff is how long a backup that failed transiently waits
+// before each retry when RetryBackoff isn't set.
+var DefaultRetryBackoff = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// retryError is a transient failure of a backup attempt that will be
+// retried.
+type retryError struct {
+	err error
+}
+
+func (e *retryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryError) Unwrap() error {
+	return e.err
+}
+
+// ParseRetryBackoff parses comma-separated durations to wait before each
+// retry of a backup that failed transiently, such as "1m,5m,15m". "off"
+// disables retries.
+func ParseRetryBackoff(s string) ([]time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "off") {
+		return []time.Duration{}, nil
+	}
+	var backoff []time.Duration
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, err := ParseDuration(part)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("expected positive durations or off, got %q", part)
+		}
+		backoff = append(backoff, d)
+	}
+	if len(backoff) == 0 {
+		return nil, fmt.Errorf("expected positive durations or off, got %q", s)
+	}
+	return backoff, nil
+}
+
+// retryBackoff returns RetryBackoff, or DefaultRetryBackoff if not set.
+func (m *Manager) retryBackoff() []time.Duration {
+	if m.RetryBackoff == nil {
+		return DefaultRetryBackoff
+	}
+	return m.RetryBackoff
+}
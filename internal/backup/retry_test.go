@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestParseRetryBackoff(t *testing.T) {
+	backoff, err := ParseRetryBackoff("30s, 2m,1h")
+	if err != nil {
+		t.Fatalf("ParseRetryBackoff() failed: %v", err)
+	}
+	if want := []time.Duration{30 * time.Second, 2 * time.Minute, time.Hour}; !reflect.DeepEqual(backoff, want) {
+		t.Errorf("ParseRetryBackoff() = %v, want %v", backoff, want)
+	}
+
+	if backoff, err := ParseRetryBackoff("OFF"); err != nil || backoff == nil || len(backoff) != 0 {
+		t.Errorf("ParseRetryBackoff(off) = %#v, %v, want an empty slice", backoff, err)
+	}
+
+	for _, bad := range []string{"", "soon", "1m,0s", ","} {
+		if _, err := ParseRetryBackoff(bad); err == nil {
+			t.Errorf("ParseRetryBackoff(%q) expected an error", bad)
+		}
+	}
+}
+
+// setupRetry returns a Manager whose backups succeed up to restic, which
+// fails with the errors in failures in turn and then succeeds. The number
+// of restic runs is counted in runs.
+func setupRetry(t *testing.T, failures ...error) (m *Manager, runs *int) {
+	t.Helper()
+	gameData := testsupport.CreateGameData(t)
+	testsupport.CreateBloatedSave(t, gameData.SavePath, 1)
+
+	runs = new(int)
+	m = &Manager{
+		Interval:       time.Hour,
+		Server:         gameData.Server(),
+		GameDataDir:    gameData.Dir,
+		StagingDir:     t.TempDir(),
+		BackupTimeout:  5 * time.Second,
+		LastBackupFile: filepath.Join(t.TempDir(), "last-backup"),
+		RetryBackoff:   []time.Duration{time.Millisecond, time.Millisecond},
+		ResticRunner: func(ctx context.Context, stagingDir string) error {
+			*runs++
+			if *runs <= len(failures) {
+				return failures[*runs-1]
+			}
+			return nil
+		},
+	}
+	return m, runs
+}
+
+func TestManager_PerformBackup_RetriesTransientFailures(t *testing.T) {
+	locked := &ResticError{Command: "backup", ExitCode: resticExitLockFailed}
+	m, runs := setupRetry(t, locked, locked)
+
+	if err := m.performBackup(context.Background(), false); err != nil {
+		t.Fatalf("performBackup() failed: %v", err)
+	}
+	if *runs != 3 {
+		t.Errorf("restic ran %d times, want 3", *runs)
+	}
+	if _, ok := m.LastSuccessfulBackup(); !ok {
+		t.Error("the successful retry wasn't recorded")
+	}
+	if m.failures.count != 0 {
+		t.Errorf("retried failures were counted as %d failed backups", m.failures.count)
+	}
+}
+
+func TestManager_PerformBackup_RetriesExhausted(t *testing.T) {
+	locked := &ResticError{Command: "backup", ExitCode: resticExitLockFailed}
+	m, runs := setupRetry(t, locked, locked, locked)
+
+	err := m.performBackup(context.Background(), false)
+	if !errors.Is(err, locked) {
+		t.Fatalf("performBackup() = %v, want the last transient failure", err)
+	}
+	if *runs != 3 {
+		t.Errorf("restic ran %d times, want 3", *runs)
+	}
+	if m.failures.count != 1 {
+		t.Errorf("failure count = %d, want the cycle counted once", m.failures.count)
+	}
+}
+
+func TestManager_PerformBackup_NoRetryForPermanentFailures(t *testing.T) {
+	m, runs := setupRetry(t, &ResticError{Command: "backup", ExitCode: 1, stderr: "Fatal: wrong password or no key found"})
+
+	if err := m.performBackup(context.Background(), false); err == nil {
+		t.Fatal("performBackup() expected an error")
+	}
+	if *runs != 1 {
+		t.Errorf("restic ran %d times, want 1", *runs)
+	}
+
+	// Retries can be turned off
+	m, runs = setupRetry(t, &ResticError{Command: "backup", ExitCode: resticExitLockFailed})
+	m.RetryBackoff = []time.Duration{}
+	if err := m.performBackup(context.Background(), false); err == nil {
+		t.Fatal("performBackup() expected an error")
+	}
+	if *runs != 1 {
+		t.Errorf("restic ran %d times with retries off, want 1", *runs)
+	}
+}
+
+func TestManager_PerformBackup_RetryWaitCancelled(t *testing.T) {
+	locked := &ResticError{Command: "backup", ExitCode: resticExitLockFailed}
+	m, runs := setupRetry(t, locked)
+	m.RetryBackoff = []time.Duration{time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.performBackup(ctx, false) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.State().State != StateRetrying {
+		if time.Now().After(deadline) {
+			t.Fatalf("state = %v, want %s", m.State(), StateRetrying)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, locked) {
+			t.Errorf("performBackup() = %v, want the transient failure", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("performBackup() kept waiting after cancellation")
+	}
+	if *runs != 1 {
+		t.Errorf("restic ran %d times, want 1", *runs)
+	}
+}
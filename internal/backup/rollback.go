@@ -0,0 +1,375 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/snapshotmeta"
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// rollbackStateName is the file in the rollback work directory recording a
+// rollback in progress.
+const rollbackStateName = "rollback.json"
+
+// preRollbackSuffix is appended to the save file replaced by a rollback.
+const preRollbackSuffix = ".pre-rollback"
+
+// Rollback phases, as recorded in the state file.
+const (
+	// rollbackPrepared means the snapshot's world is ready to be swapped in.
+	rollbackPrepared = "prepared"
+
+	// rollbackSwapping means the server is being stopped, or has been, to
+	// swap the world. An interrupted swap is finished by ResumeRollback.
+	rollbackSwapping = "swapping"
+)
+
+// ErrNoRollback is returned by ConfirmRollback and CancelRollback when no
+// rollback has been prepared.
+var ErrNoRollback = errors.New("no rollback prepared")
+
+// Rollback describes a rollback in progress.
+type Rollback struct {
+	// Snapshot is the restic snapshot the world is rolled back to.
+	Snapshot string `json:"snapshot"`
+
+	// SavePath is the live save file that will be replaced.
+	SavePath string `json:"save_path"`
+
+	// RestoredPath is the snapshot's world, next to the live save.
+	RestoredPath string `json:"restored_path"`
+
+	// Phase is rollbackPrepared or rollbackSwapping.
+	Phase string `json:"phase"`
+
+	// Prepared is when the restored world was ready.
+	Prepared time.Time `json:"prepared"`
+}
+
+// PrepareRollback restores the world of a snapshot ("latest" or a snapshot
+// ID) next to the live save while the server keeps running, so the server
+// only has to be down for the swap. Call ConfirmRollback to swap it in, or
+// CancelRollback to discard it. A rollback already prepared for another
+// snapshot is replaced.
+func (m *Manager) PrepareRollback(ctx context.Context, snapshot string) (*Rollback, error) {
+	if snapshot == "" || strings.HasPrefix(snapshot, "-") {
+		return nil, fmt.Errorf("invalid snapshot %q", snapshot)
+	}
+
+	m.rollbackMu.Lock()
+	defer m.rollbackMu.Unlock()
+
+	m.applyPathDefaults()
+
+	state, err := m.readRollbackState()
+	if err != nil {
+		return nil, err
+	}
+	if state != nil {
+		if state.Phase == rollbackSwapping {
+			return nil, fmt.Errorf("a rollback to %s is being swapped in", state.Snapshot)
+		}
+		if err := m.discardRollback(state); err != nil {
+			return nil, err
+		}
+	}
+
+	savePath, err := m.getSaveFilePath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get save file path: %w", err)
+	}
+	saveBaseName := strings.TrimSuffix(filepath.Base(savePath), ".vcdbs")
+
+	// Only the world and its metadata are needed; restic restores them under
+	// their original paths
+	restoreDir := filepath.Join(m.rollbackDir(), "restore")
+	if err := os.RemoveAll(restoreDir); err != nil {
+		return nil, fmt.Errorf("failed to clear rollback work directory: %w", err)
+	}
+	defer os.RemoveAll(restoreDir)
+
+	treeInSnapshot := filepath.Join(m.StagingDir, "Saves", saveBaseName)
+	metadataInSnapshot := filepath.Join(m.StagingDir, MetadataFileName)
+	args := []string{"restore", snapshot, "--target", restoreDir,
+		"--include", treeInSnapshot, "--include", metadataInSnapshot}
+	if snapshot == "latest" {
+		args = append(args, "--host", m.snapshotHost())
+		args = append(args, m.worldFilter()...)
+		if m.ModsInterval > 0 {
+			args = append(args, "--tag", SnapshotSetTag+SnapshotSetWorld)
+		}
+	}
+
+	fmt.Printf("Rollback: restoring %s from snapshot %s\n", saveBaseName, snapshot)
+	exitCode, output, err := m.runCommandWithOutput(ctx, "restic", args...)
+	if err != nil {
+		return nil, fmt.Errorf("restic restore failed: %w", err)
+	}
+	if exitCode != 0 {
+		return nil, fmt.Errorf("restic restore failed with exit code %d\nOutput: %s", exitCode, output)
+	}
+
+	treeDir := filepath.Join(restoreDir, treeInSnapshot)
+	if _, err := os.Stat(treeDir); err != nil {
+		return nil, fmt.Errorf("snapshot %s has no world named %s: %w", snapshot, saveBaseName, err)
+	}
+
+	meta, err := snapshotmeta.Read(filepath.Join(restoreDir, m.StagingDir))
+	if err != nil {
+		return nil, err
+	}
+	verified, err := VerifyTreeDigest(ctx, meta, saveBaseName, treeDir)
+	if err != nil {
+		return nil, err
+	}
+	if verified {
+		fmt.Println("Rollback: restored world matches the snapshot's tree digest")
+	}
+
+	// Build in a second Saves directory on the same filesystem as the live
+	// save, so the swap is a rename
+	restoredPath := filepath.Join(filepath.Dir(savePath), "rollback", filepath.Base(savePath))
+	if err := os.MkdirAll(filepath.Dir(restoredPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create rollback directory: %w", err)
+	}
+	tmpPath := restoredPath + ".tmp"
+	os.Remove(tmpPath)
+
+	fmt.Printf("Rollback: combining vcdbtree into %s\n", restoredPath)
+	if err := vcdbtree.CombineContext(ctx, treeDir, tmpPath, nil); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to combine vcdbtree: %w", err)
+	}
+	if err := os.Rename(tmpPath, restoredPath); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to move restored world into place: %w", err)
+	}
+
+	state = &Rollback{
+		Snapshot:     snapshot,
+		SavePath:     savePath,
+		RestoredPath: restoredPath,
+		Phase:        rollbackPrepared,
+		Prepared:     time.Now(),
+	}
+	if err := m.writeRollbackState(state); err != nil {
+		os.Remove(restoredPath)
+		return nil, err
+	}
+	return state, nil
+}
+
+// PendingRollback returns the rollback in progress, or nil if there is none.
+func (m *Manager) PendingRollback() (*Rollback, error) {
+	m.rollbackMu.Lock()
+	defer m.rollbackMu.Unlock()
+	return m.readRollbackState()
+}
+
+// ConfirmRollback swaps the prepared world in: it announces the rollback in
+// game, stops the server through the Restarter, moves the live save aside
+// with a ".pre-rollback" suffix, moves the restored world into its place, and
+// starts the server again. The server is always restarted, even if the swap
+// fails. If the launcher dies after the server was stopped, ResumeRollback
+// finishes the swap.
+func (m *Manager) ConfirmRollback(ctx context.Context) error {
+	if m.Restarter == nil {
+		return ErrRestarterRequired
+	}
+
+	m.rollbackMu.Lock()
+	defer m.rollbackMu.Unlock()
+
+	state, err := m.readRollbackState()
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return ErrNoRollback
+	}
+	if _, err := os.Stat(state.RestoredPath); err != nil {
+		return fmt.Errorf("restored world is missing, prepare the rollback again: %w", err)
+	}
+
+	// Don't let a backup run against a stopped server, or snapshot the
+	// world halfway through the swap
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+
+	state.Phase = rollbackSwapping
+	if err := m.writeRollbackState(state); err != nil {
+		return err
+	}
+
+	if m.Server != nil {
+		if err := m.Server.SendCommand("/announce The world is being rolled back to an earlier backup"); err != nil {
+			fmt.Printf("WARNING: Failed to announce rollback: %v\n", err)
+		}
+	}
+
+	fmt.Printf("Rollback: stopping server to roll back to snapshot %s...\n", state.Snapshot)
+	if err := m.Restarter.StopServer(ctx); err != nil {
+		// The server is still running the current world
+		state.Phase = rollbackPrepared
+		return errors.Join(fmt.Errorf("failed to stop server: %w", err), m.writeRollbackState(state))
+	}
+
+	swapErr := m.finishRollback(state)
+
+	fmt.Println("Rollback: restarting server...")
+	if err := m.Restarter.StartServer(); err != nil {
+		return errors.Join(swapErr, fmt.Errorf("failed to restart server: %w", err))
+	}
+	return swapErr
+}
+
+// CancelRollback discards a prepared rollback. A rollback that is being
+// swapped in can't be cancelled.
+func (m *Manager) CancelRollback() error {
+	m.rollbackMu.Lock()
+	defer m.rollbackMu.Unlock()
+
+	state, err := m.readRollbackState()
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return ErrNoRollback
+	}
+	if state.Phase == rollbackSwapping {
+		return fmt.Errorf("the rollback to %s is being swapped in", state.Snapshot)
+	}
+	return m.discardRollback(state)
+}
+
+// ResumeRollback finishes a rollback that was interrupted after the server
+// was stopped for it. It must be called before the server starts. A rollback
+// that was only prepared is left waiting for ConfirmRollback and returned,
+// so it can be reported; nil means none is pending.
+func (m *Manager) ResumeRollback() (*Rollback, error) {
+	m.rollbackMu.Lock()
+	defer m.rollbackMu.Unlock()
+
+	m.applyPathDefaults()
+
+	state, err := m.readRollbackState()
+	if err != nil || state == nil {
+		return nil, err
+	}
+	if state.Phase != rollbackSwapping {
+		return state, nil
+	}
+
+	fmt.Printf("Rollback: finishing the interrupted rollback to snapshot %s\n", state.Snapshot)
+	if err := m.finishRollback(state); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// finishRollback swaps the restored world in and clears the state. Each step
+// can be repeated, so an interrupted swap is finished by running it again.
+// The server must not be running.
+func (m *Manager) finishRollback(state *Rollback) error {
+	if _, err := os.Stat(state.RestoredPath); err == nil {
+		keepPath := state.SavePath + preRollbackSuffix
+		if _, err := os.Stat(state.SavePath); err == nil {
+			if err := os.Rename(state.SavePath, keepPath); err != nil {
+				return fmt.Errorf("failed to move current save file aside: %w", err)
+			}
+		}
+
+		// Journals left by a crash belong to the old world and would be
+		// replayed into the restored one
+		for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+			if _, err := os.Stat(state.SavePath + suffix); err == nil {
+				if err := os.Rename(state.SavePath+suffix, keepPath+suffix); err != nil {
+					return fmt.Errorf("failed to move %s file aside: %w", suffix, err)
+				}
+			}
+		}
+
+		if err := os.Rename(state.RestoredPath, state.SavePath); err != nil {
+			return fmt.Errorf("failed to move restored world into place: %w", err)
+		}
+		syncDir(filepath.Dir(state.SavePath))
+	}
+
+	os.Remove(filepath.Dir(state.RestoredPath))
+	if err := os.Remove(m.rollbackStatePath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove rollback state: %w", err)
+	}
+	fmt.Printf("Rollback: rolled back to snapshot %s; the previous world is %s\n", state.Snapshot, state.SavePath+preRollbackSuffix)
+	return nil
+}
+
+// discardRollback removes a prepared world and the state.
+func (m *Manager) discardRollback(state *Rollback) error {
+	if err := os.Remove(state.RestoredPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove restored world: %w", err)
+	}
+	os.Remove(filepath.Dir(state.RestoredPath))
+	if err := os.Remove(m.rollbackStatePath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove rollback state: %w", err)
+	}
+	return nil
+}
+
+// readRollbackState returns the rollback in progress, or nil if there is none.
+func (m *Manager) readRollbackState() (*Rollback, error) {
+	data, err := os.ReadFile(m.rollbackStatePath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read rollback state: %w", err)
+	}
+
+	var state Rollback
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse rollback state: %w", err)
+	}
+	return &state, nil
+}
+
+// writeRollbackState records state, flushing it to disk.
+func (m *Manager) writeRollbackState(state *Rollback) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rollback state: %w", err)
+	}
+	if err := os.MkdirAll(m.rollbackDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create rollback work directory: %w", err)
+	}
+	// Replace the state in one step, so a crash leaves the old or the new one
+	tmpPath := m.rollbackStatePath() + ".tmp"
+	if err := writeFileSync(tmpPath, data); err != nil {
+		return fmt.Errorf("failed to write rollback state: %w", err)
+	}
+	if err := os.Rename(tmpPath, m.rollbackStatePath()); err != nil {
+		return fmt.Errorf("failed to write rollback state: %w", err)
+	}
+	syncDir(m.rollbackDir())
+	return nil
+}
+
+// rollbackStatePath returns the path of the rollback state file.
+func (m *Manager) rollbackStatePath() string {
+	return filepath.Join(m.rollbackDir(), rollbackStateName)
+}
+
+// rollbackDir returns RollbackDir, or the rollback directory in the cache if
+// not set.
+func (m *Manager) rollbackDir() string {
+	if m.RollbackDir != "" {
+		return m.RollbackDir
+	}
+	return filepath.Join(m.cacheDir(), "rollback")
+}
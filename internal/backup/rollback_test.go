@@ -0,0 +1,293 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// setupRollback creates a game data directory with a 10-chunk save and a
+// restic mock whose snapshots hold a 3-chunk version of it.
+func setupRollback(t *testing.T) (m *Manager, savePath string, restarter *mockRestarter, resticArgs *[]string) {
+	t.Helper()
+
+	gameData := testsupport.CreateGameData(t)
+	savePath = gameData.SavePath
+	testsupport.CreateBloatedSave(t, savePath, 10)
+
+	oldSave := filepath.Join(t.TempDir(), "world.vcdbs")
+	testsupport.CreateBloatedSave(t, oldSave, 3)
+
+	stagingDir := filepath.Join(t.TempDir(), "staging")
+	resticArgs = new([]string)
+	restarter = &mockRestarter{}
+	m = &Manager{
+		GameDataDir: gameData.Dir,
+		StagingDir:  stagingDir,
+		RollbackDir: filepath.Join(t.TempDir(), "rollback"),
+		Server:      &testsupport.Server{},
+		Restarter:   restarter,
+		CommandRunner: func(ctx context.Context, name string, args ...string) (int, error) {
+			*resticArgs = args
+			target := ""
+			for i, arg := range args {
+				if arg == "--target" {
+					target = args[i+1]
+				}
+			}
+			treeDir := filepath.Join(target, stagingDir, "Saves", "world")
+			if err := vcdbtree.Split(oldSave, treeDir); err != nil {
+				return 1, err
+			}
+			return 0, nil
+		},
+	}
+	return m, savePath, restarter, resticArgs
+}
+
+func TestManager_Rollback(t *testing.T) {
+	m, savePath, restarter, resticArgs := setupRollback(t)
+
+	state, err := m.PrepareRollback(context.Background(), "latest")
+	if err != nil {
+		t.Fatalf("PrepareRollback failed: %v", err)
+	}
+
+	wantArgs := []string{"restore", "latest", "--target", filepath.Join(m.RollbackDir, "restore"),
+		"--include", filepath.Join(m.StagingDir, "Saves", "world"),
+		"--include", filepath.Join(m.StagingDir, MetadataFileName), "--host", "world"}
+	if !reflect.DeepEqual(*resticArgs, wantArgs) {
+		t.Errorf("restic args = %v, want %v", *resticArgs, wantArgs)
+	}
+
+	// The server keeps running the live world until the rollback is confirmed
+	if calls := restarter.getCalls(); len(calls) != 0 {
+		t.Errorf("Restarter calls before confirming = %v, want none", calls)
+	}
+	if n := countChunks(t, savePath); n != 10 {
+		t.Errorf("Live save has %d chunks before confirming, want 10", n)
+	}
+	if n := countChunks(t, state.RestoredPath); n != 3 {
+		t.Errorf("Restored world has %d chunks, want 3", n)
+	}
+	if _, err := os.Stat(filepath.Join(m.RollbackDir, "restore")); !os.IsNotExist(err) {
+		t.Errorf("Restore directory still exists: %v", err)
+	}
+
+	if err := m.ConfirmRollback(context.Background()); err != nil {
+		t.Fatalf("ConfirmRollback failed: %v", err)
+	}
+
+	if calls := restarter.getCalls(); !reflect.DeepEqual(calls, []string{"stop", "start"}) {
+		t.Errorf("Restarter calls = %v, want [stop start]", calls)
+	}
+	commands := m.Server.(*testsupport.Server).Commands()
+	if len(commands) != 1 || !strings.HasPrefix(commands[0], "/announce ") {
+		t.Errorf("Commands = %v, want an announcement", commands)
+	}
+	if n := countChunks(t, savePath); n != 3 {
+		t.Errorf("Live save has %d chunks after rollback, want 3", n)
+	}
+	if n := countChunks(t, savePath+preRollbackSuffix); n != 10 {
+		t.Errorf("Previous world has %d chunks, want 10", n)
+	}
+	if pending, err := m.PendingRollback(); err != nil || pending != nil {
+		t.Errorf("PendingRollback() = %v, %v; want nil", pending, err)
+	}
+	if _, err := os.Stat(filepath.Dir(state.RestoredPath)); !os.IsNotExist(err) {
+		t.Errorf("Rollback Saves directory still exists: %v", err)
+	}
+}
+
+func TestManager_RollbackSnapshotFilters(t *testing.T) {
+	m, _, _, resticArgs := setupRollback(t)
+	m.ModsInterval = 1
+	m.World = "creative"
+
+	if _, err := m.PrepareRollback(context.Background(), "latest"); err != nil {
+		t.Fatalf("PrepareRollback failed: %v", err)
+	}
+	args := strings.Join(*resticArgs, " ")
+	if !strings.Contains(args, "--tag "+WorldTag+"creative") {
+		t.Errorf("restic args = %v, want the world's snapshots", *resticArgs)
+	}
+	if !strings.Contains(args, "--tag "+SnapshotSetTag+SnapshotSetWorld) {
+		t.Errorf("restic args = %v, want the world snapshot set", *resticArgs)
+	}
+
+	// A snapshot ID selects exactly one snapshot
+	if _, err := m.PrepareRollback(context.Background(), "1a2b3c4d"); err != nil {
+		t.Fatalf("PrepareRollback failed: %v", err)
+	}
+	if args := strings.Join(*resticArgs, " "); strings.Contains(args, "--host") || strings.Contains(args, "--tag") {
+		t.Errorf("restic args = %v, want no filters for a snapshot ID", *resticArgs)
+	}
+}
+
+func TestManager_RollbackVerifiesTreeDigest(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		tamper  bool
+		wantErr error
+	}{
+		{name: "intact"},
+		{name: "tampered", tamper: true, wantErr: vcdbtree.ErrDigestMismatch},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, _, _ := setupRollback(t)
+			restore := m.CommandRunner
+			m.CommandRunner = func(ctx context.Context, name string, args ...string) (int, error) {
+				code, err := restore(ctx, name, args...)
+				if err != nil {
+					return code, err
+				}
+				// Record the digest of the tree as restored, then change it
+				target := args[slices.Index(args, "--target")+1]
+				snapshotDir := filepath.Join(target, m.StagingDir)
+				treeDir := filepath.Join(snapshotDir, "Saves", "world")
+				digest, err := vcdbtree.Digest(ctx, treeDir)
+				if err != nil {
+					return 1, err
+				}
+				staged := &Manager{StagingDir: snapshotDir}
+				if err := staged.writeMetadata(SnapshotMetadata{TreeDigests: map[string]string{"world": digest}}); err != nil {
+					return 1, err
+				}
+				if tt.tamper {
+					if err := os.WriteFile(filepath.Join(treeDir, "gamedata", "1.bin"), []byte("flipped"), 0644); err != nil {
+						return 1, err
+					}
+				}
+				return 0, nil
+			}
+
+			_, err := m.PrepareRollback(context.Background(), "latest")
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("PrepareRollback failed: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PrepareRollback error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManager_RollbackInvalidSnapshot(t *testing.T) {
+	m, _, _, _ := setupRollback(t)
+
+	for _, snapshot := range []string{"", "--help"} {
+		if _, err := m.PrepareRollback(context.Background(), snapshot); err == nil {
+			t.Errorf("PrepareRollback(%q) succeeded, want error", snapshot)
+		}
+	}
+}
+
+func TestManager_RollbackRestoreFails(t *testing.T) {
+	m, savePath, _, _ := setupRollback(t)
+	m.CommandRunner = func(ctx context.Context, name string, args ...string) (int, error) {
+		return 1, nil
+	}
+
+	if _, err := m.PrepareRollback(context.Background(), "latest"); err == nil {
+		t.Fatal("PrepareRollback succeeded, want error")
+	}
+	if pending, _ := m.PendingRollback(); pending != nil {
+		t.Errorf("PendingRollback() = %v, want nil", pending)
+	}
+	if n := countChunks(t, savePath); n != 10 {
+		t.Errorf("Live save has %d chunks, want 10", n)
+	}
+}
+
+func TestManager_CancelRollback(t *testing.T) {
+	m, savePath, restarter, _ := setupRollback(t)
+
+	if err := m.CancelRollback(); !errors.Is(err, ErrNoRollback) {
+		t.Errorf("CancelRollback() without a rollback = %v, want ErrNoRollback", err)
+	}
+
+	state, err := m.PrepareRollback(context.Background(), "latest")
+	if err != nil {
+		t.Fatalf("PrepareRollback failed: %v", err)
+	}
+	if err := m.CancelRollback(); err != nil {
+		t.Fatalf("CancelRollback failed: %v", err)
+	}
+	if _, err := os.Stat(state.RestoredPath); !os.IsNotExist(err) {
+		t.Errorf("Restored world still exists: %v", err)
+	}
+
+	if err := m.ConfirmRollback(context.Background()); !errors.Is(err, ErrNoRollback) {
+		t.Errorf("ConfirmRollback() after cancelling = %v, want ErrNoRollback", err)
+	}
+	if calls := restarter.getCalls(); len(calls) != 0 {
+		t.Errorf("Restarter calls = %v, want none", calls)
+	}
+	if n := countChunks(t, savePath); n != 10 {
+		t.Errorf("Live save has %d chunks, want 10", n)
+	}
+}
+
+func TestManager_ResumeRollback(t *testing.T) {
+	m, savePath, _, _ := setupRollback(t)
+
+	state, err := m.PrepareRollback(context.Background(), "latest")
+	if err != nil {
+		t.Fatalf("PrepareRollback failed: %v", err)
+	}
+
+	// A prepared rollback waits for confirmation
+	pending, err := m.ResumeRollback()
+	if err != nil {
+		t.Fatalf("ResumeRollback failed: %v", err)
+	}
+	if pending == nil || pending.Snapshot != "latest" {
+		t.Fatalf("ResumeRollback() = %v, want the prepared rollback", pending)
+	}
+	if n := countChunks(t, savePath); n != 10 {
+		t.Errorf("Live save has %d chunks, want 10", n)
+	}
+
+	// Simulate the launcher dying after the live save was moved aside, with
+	// a journal left behind by the server
+	state.Phase = rollbackSwapping
+	if err := m.writeRollbackState(state); err != nil {
+		t.Fatalf("Failed to write state: %v", err)
+	}
+	if err := os.Rename(savePath, savePath+preRollbackSuffix); err != nil {
+		t.Fatalf("Failed to move save: %v", err)
+	}
+	if err := os.WriteFile(savePath+"-wal", []byte("old"), 0644); err != nil {
+		t.Fatalf("Failed to write journal: %v", err)
+	}
+
+	pending, err = m.ResumeRollback()
+	if err != nil {
+		t.Fatalf("ResumeRollback failed: %v", err)
+	}
+	if pending != nil {
+		t.Errorf("ResumeRollback() = %v, want nil once finished", pending)
+	}
+	if n := countChunks(t, savePath); n != 3 {
+		t.Errorf("Live save has %d chunks after resuming, want 3", n)
+	}
+	if n := countChunks(t, savePath+preRollbackSuffix); n != 10 {
+		t.Errorf("Previous world has %d chunks, want 10", n)
+	}
+	if _, err := os.Stat(savePath + "-wal"); !os.IsNotExist(err) {
+		t.Errorf("Old journal is still next to the restored world: %v", err)
+	}
+
+	// Nothing is left to resume
+	if pending, err := m.ResumeRollback(); err != nil || pending != nil {
+		t.Errorf("ResumeRollback() = %v, %v; want nil", pending, err)
+	}
+}
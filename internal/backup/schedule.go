@@ -0,0 +1,58 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// runFixedRateLoop runs periodic backups at fixed times, Interval apart from
+// the first one, however long each takes. A backup that overruns its slot
+// makes the loop skip the slots it ran through, rather than start the next
+// backup as soon as it finishes. Changing the interval starts the schedule
+// over from then.
+func (m *Manager) runFixedRateLoop(ctx context.Context) {
+	clk := m.clock()
+	interval := m.interval()
+	next := clk.Now().Add(interval)
+	wait := clk.After(interval)
+	intervalChanged := m.intervalChanges()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-intervalChanged:
+			interval = m.interval()
+			next = clk.Now().Add(interval)
+			wait = clk.After(interval)
+			continue
+		case <-wait:
+		}
+
+		start := next
+		m.runBackup(ctx)
+
+		var skipped int
+		interval = m.interval()
+		now := clk.Now()
+		next, skipped = nextFixedRateStart(start, now, interval)
+		if skipped > 0 {
+			fmt.Printf("WARNING: Backup ran past its interval of %v; skipping %d scheduled backup(s)\n", interval, skipped)
+		}
+		wait = clk.After(next.Sub(now))
+	}
+}
+
+// nextFixedRateStart returns when the backup scheduled after one scheduled
+// at start should run, given the time now: the first start+n*interval after
+// now. skipped is how many slots passed while the backup ran.
+func nextFixedRateStart(start, now time.Time, interval time.Duration) (next time.Time, skipped int) {
+	next = start.Add(interval)
+	if !next.After(now) {
+		missed := int(now.Sub(next)/interval) + 1
+		next = next.Add(time.Duration(missed) * interval)
+		skipped = missed
+	}
+	return next, skipped
+}
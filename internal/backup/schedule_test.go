@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/clock"
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestNextFixedRateStart(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		took        time.Duration
+		wantNext    time.Duration
+		wantSkipped int
+	}{
+		{"finished early", 10 * time.Minute, time.Hour, 0},
+		{"finished on the next slot", time.Hour, 2 * time.Hour, 1},
+		{"overran one slot", 70 * time.Minute, 2 * time.Hour, 1},
+		{"overran several slots", 200 * time.Minute, 4 * time.Hour, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, skipped := nextFixedRateStart(start, start.Add(tt.took), time.Hour)
+			if want := start.Add(tt.wantNext); !next.Equal(want) {
+				t.Errorf("next = %v, want %v", next, want)
+			}
+			if skipped != tt.wantSkipped {
+				t.Errorf("skipped = %d, want %d", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestManager_FixedRateLoop_SkipsOverrunSlots(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	starts := make(chan time.Time, 2)
+	m := &Manager{
+		Interval:    time.Hour,
+		FixedRate:   true,
+		Clock:       clk,
+		Server:      &testsupport.Server{},
+		BootChecker: testsupport.NewBootChecker(false), // Fail fast
+		GameDataDir: t.TempDir(),
+		StagingDir:  t.TempDir(),
+		OnBackupStart: func() {
+			now := clk.Now()
+			starts <- now
+			if now.Equal(start.Add(time.Hour)) {
+				// The first backup runs through the next two slots
+				clk.Advance(150 * time.Minute)
+			}
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := m.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer m.Stop()
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Hour)
+	if got := <-starts; !got.Equal(start.Add(time.Hour)) {
+		t.Fatalf("first backup at %v, want %v", got, start.Add(time.Hour))
+	}
+
+	// Next is the first slot after the overrun, not right away
+	clk.BlockUntil(1)
+	clk.Advance(29 * time.Minute)
+	select {
+	case got := <-starts:
+		t.Fatalf("backup at %v, before the next slot", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+	clk.Advance(time.Minute)
+	select {
+	case got := <-starts:
+		if want := start.Add(4 * time.Hour); !got.Equal(want) {
+			t.Errorf("second backup at %v, want %v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a backup at the next slot")
+	}
+}
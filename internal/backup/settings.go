@@ -0,0 +1,118 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Settings are the Manager options that can be changed while it runs.
+type Settings struct {
+	Interval           time.Duration
+	PauseWhenNoPlayers bool
+	PruneRetention     string
+}
+
+// Settings returns the current Interval, PauseWhenNoPlayers, and
+// PruneRetention.
+func (m *Manager) Settings() Settings {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	return Settings{
+		Interval:           m.Interval,
+		PauseWhenNoPlayers: m.PauseWhenNoPlayers,
+		PruneRetention:     m.PruneRetention,
+	}
+}
+
+// SetInterval changes the time between periodic backups. The next backup is
+// rescheduled for one new interval from now.
+func (m *Manager) SetInterval(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("backup interval must be positive")
+	}
+	m.settingsMu.Lock()
+	m.Interval = interval
+	m.settingsMu.Unlock()
+
+	select {
+	case m.intervalChanges() <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SetPauseWhenNoPlayers changes whether periodic backups are skipped while
+// nobody is online, from the next backup on. It needs a PlayerChecker.
+func (m *Manager) SetPauseWhenNoPlayers(pause bool) {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	m.PauseWhenNoPlayers = pause
+}
+
+// SetPruneRetention changes the retention options for restic forget --prune,
+// from the next prune on. An empty retention disables pruning.
+func (m *Manager) SetPruneRetention(retention string) error {
+	retention, err := ParsePruneRetention(retention)
+	if err != nil {
+		return err
+	}
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	m.PruneRetention = retention
+	return nil
+}
+
+// ParsePruneRetention validates restic forget retention options such as
+// "--keep-daily 7 --keep-weekly 4", so a typo typed into the console isn't
+// only noticed when the next prune fails. Every option must be a --keep-*
+// option with a value.
+func ParsePruneRetention(s string) (string, error) {
+	fields := strings.Fields(s)
+	for i := 0; i < len(fields); i++ {
+		name, _, hasValue := strings.Cut(fields[i], "=")
+		if !strings.HasPrefix(name, "--keep-") {
+			return "", fmt.Errorf("unexpected %q in retention: expected a --keep-* option", fields[i])
+		}
+		if hasValue {
+			continue
+		}
+		if i+1 == len(fields) || strings.HasPrefix(fields[i+1], "-") {
+			return "", fmt.Errorf("retention option %s needs a value", name)
+		}
+		i++
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// interval returns Interval.
+func (m *Manager) interval() time.Duration {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	return m.Interval
+}
+
+// pauseWhenNoPlayers returns PauseWhenNoPlayers.
+func (m *Manager) pauseWhenNoPlayers() bool {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	return m.PauseWhenNoPlayers
+}
+
+// pruneRetention returns PruneRetention.
+func (m *Manager) pruneRetention() string {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	return m.PruneRetention
+}
+
+// intervalChanges returns the channel SetInterval signals the backup loop
+// on, creating it on first use.
+func (m *Manager) intervalChanges() chan struct{} {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	if m.intervalChanged == nil {
+		m.intervalChanged = make(chan struct{}, 1)
+	}
+	return m.intervalChanged
+}
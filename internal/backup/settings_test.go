@@ -0,0 +1,150 @@
+package backup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/clock"
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestManager_SetInterval_Reschedules(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		fixedRate bool
+	}{
+		{name: "ticker"},
+		{name: "fixed rate", fixedRate: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+			started := make(chan struct{}, 1)
+			m := &Manager{
+				Interval:    time.Hour,
+				FixedRate:   tt.fixedRate,
+				Clock:       clk,
+				Server:      &testsupport.Server{},
+				BootChecker: testsupport.NewBootChecker(false), // Fail fast
+				GameDataDir: t.TempDir(),
+				StagingDir:  t.TempDir(),
+				OnBackupStart: func() {
+					select {
+					case started <- struct{}{}:
+					default:
+					}
+				},
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if err := m.Start(ctx); err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			defer m.Stop()
+			clk.BlockUntil(1)
+
+			if err := m.SetInterval(time.Minute); err != nil {
+				t.Fatalf("SetInterval failed: %v", err)
+			}
+
+			// The loop picks the change up on its own goroutine; a backup
+			// must follow within a few minutes, long before the old hour
+			for i := 0; ; i++ {
+				if i == 5 {
+					t.Fatal("expected a backup at the new interval")
+				}
+				clk.Advance(time.Minute)
+				select {
+				case <-started:
+				case <-time.After(100 * time.Millisecond):
+					continue
+				}
+				break
+			}
+			if got := m.Settings().Interval; got != time.Minute {
+				t.Errorf("Interval = %v, want 1m", got)
+			}
+		})
+	}
+}
+
+func TestManager_SetInterval_Invalid(t *testing.T) {
+	m := &Manager{Interval: time.Hour}
+	if err := m.SetInterval(0); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+	if got := m.Settings().Interval; got != time.Hour {
+		t.Errorf("Interval = %v, want it unchanged", got)
+	}
+}
+
+func TestManager_SetPauseWhenNoPlayers(t *testing.T) {
+	m := &Manager{
+		Server:        &testsupport.Server{},
+		PlayerChecker: testsupport.NewPlayerChecker(false),
+		GameDataDir:   t.TempDir(),
+	}
+	m.SetPauseWhenNoPlayers(true)
+	if err := m.performBackup(context.Background(), false); err != ErrNoPlayersOnline {
+		t.Errorf("performBackup error = %v, want ErrNoPlayersOnline", err)
+	}
+	if !m.Settings().PauseWhenNoPlayers {
+		t.Error("expected PauseWhenNoPlayers to be reported as set")
+	}
+}
+
+func TestManager_SetPruneRetention(t *testing.T) {
+	var got string
+	m := &Manager{
+		PruneRetention: "--keep-last 1",
+		PruneRunner: func(ctx context.Context, retention string) error {
+			got = retention
+			return nil
+		},
+	}
+	if err := m.SetPruneRetention("  --keep-daily 7   --keep-weekly=4 "); err != nil {
+		t.Fatalf("SetPruneRetention failed: %v", err)
+	}
+	if err := m.runResticPrune(context.Background()); err != nil {
+		t.Fatalf("runResticPrune failed: %v", err)
+	}
+	if want := "--keep-daily 7 --keep-weekly=4"; got != want {
+		t.Errorf("prune ran with %q, want %q", got, want)
+	}
+
+	if err := m.SetPruneRetention("--keep-daily"); err == nil {
+		t.Error("expected an error for an option without a value")
+	}
+	if err := m.SetPruneRetention(""); err != nil {
+		t.Fatalf("SetPruneRetention failed: %v", err)
+	}
+	got = ""
+	if err := m.runResticPrune(context.Background()); err != nil || got != "" {
+		t.Errorf("expected no prune with retention cleared, ran with %q (err %v)", got, err)
+	}
+}
+
+func TestParsePruneRetention(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "", want: ""},
+		{in: "--keep-last 10", want: "--keep-last 10"},
+		{in: "--keep-within 30d --keep-tag=important", want: "--keep-within 30d --keep-tag=important"},
+		{in: "--keep-daily", wantErr: true},
+		{in: "--keep-daily --keep-weekly 4", wantErr: true},
+		{in: "--prune", wantErr: true},
+		{in: "7", wantErr: true},
+	} {
+		got, err := ParsePruneRetention(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePruneRetention(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParsePruneRetention(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotSetTag is the restic tag prefix naming the set a snapshot belongs
+// to when ModsInterval splits Mods into a snapshot set of its own, as in
+// "snapshot_set=mods".
+const SnapshotSetTag = "snapshot_set="
+
+// Snapshot sets used when ModsInterval is set.
+const (
+	// SnapshotSetWorld holds everything in the staging directory except Mods.
+	SnapshotSetWorld = "world"
+
+	// SnapshotSetMods holds the Mods directory.
+	SnapshotSetMods = "mods"
+)
+
+// modsDirName is the staging directory backed up as SnapshotSetMods.
+const modsDirName = "Mods"
+
+// resticFilesFromVerbatimVersion is the first restic release with
+// --files-from-verbatim, which doesn't treat file names as patterns.
+var resticFilesFromVerbatimVersion = ResticVersion{0, 12, 0}
+
+// snapshotSet is one restic backup of (part of) the staging directory.
+type snapshotSet struct {
+	// name is the set's name, or "" for a backup of the whole staging
+	// directory.
+	name string
+
+	// path is backed up if files is empty.
+	path string
+
+	// files are backed up through a generated --files-from list.
+	files []string
+}
+
+// snapshotSets returns the restic backups to run now. Without ModsInterval,
+// that is a single backup of the staging directory. With it, everything but
+// Mods is backed up as SnapshotSetWorld, listed by top-level entry, and Mods
+// is backed up as SnapshotSetMods if ModsInterval has passed since it last
+// was. The first backup after startup always includes Mods. Must be called
+// with opMu held.
+func (m *Manager) snapshotSets(now time.Time) ([]snapshotSet, error) {
+	if m.ModsInterval <= 0 {
+		return []snapshotSet{{path: m.StagingDir}}, nil
+	}
+
+	entries, err := os.ReadDir(m.StagingDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read staging directory: %w", err)
+	}
+	world := snapshotSet{name: SnapshotSetWorld}
+	for _, entry := range entries {
+		if name := entry.Name(); name != modsDirName && name != stagingJournalName {
+			world.files = append(world.files, filepath.Join(m.StagingDir, name))
+		}
+	}
+	sort.Strings(world.files)
+	sets := []snapshotSet{world}
+
+	modsDir := filepath.Join(m.StagingDir, modsDirName)
+	if _, err := os.Stat(modsDir); err != nil {
+		if os.IsNotExist(err) {
+			return sets, nil
+		}
+		return nil, fmt.Errorf("failed to stat %s: %w", modsDir, err)
+	}
+	if m.lastModsSnapshot.IsZero() || now.Sub(m.lastModsSnapshot) >= m.ModsInterval {
+		sets = append(sets, snapshotSet{name: SnapshotSetMods, path: modsDir})
+	}
+	return sets, nil
+}
+
+// args returns the arguments selecting what to back up, after the rest of
+// backupArgs. filesFrom is the path of the generated file list, if any.
+func (s snapshotSet) args(filesFrom string, version ResticVersion) []string {
+	var args []string
+	if s.name != "" {
+		args = append(args, "--tag", SnapshotSetTag+s.name)
+	}
+	if len(s.files) == 0 {
+		return append(args, s.path)
+	}
+	if version.AtLeast(resticFilesFromVerbatimVersion) {
+		return append(args, "--files-from-verbatim", filesFrom)
+	}
+	return append(args, "--files-from", filesFrom)
+}
+
+// writeFileList writes the set's files, one per line, to a temporary file
+// for restic --files-from, and returns its path. The caller removes it.
+func (s snapshotSet) writeFileList() (string, error) {
+	f, err := os.CreateTemp("", "restic-files-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create restic file list: %w", err)
+	}
+	_, err = f.WriteString(strings.Join(s.files, "\n") + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write restic file list: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// runnerPath is the path passed to ResticRunner for the set.
+func (s snapshotSet) runnerPath(stagingDir string) string {
+	if s.path != "" {
+		return s.path
+	}
+	return stagingDir
+}
@@ -0,0 +1,133 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+// createStagingEntries creates top-level entries in a staging directory.
+func createStagingEntries(t *testing.T, stagingDir string, dirs, files []string) {
+	t.Helper()
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(stagingDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(stagingDir, file), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestManager_SnapshotSets_Disabled(t *testing.T) {
+	stagingDir := t.TempDir()
+	m := &Manager{StagingDir: stagingDir}
+
+	sets, err := m.snapshotSets(time.Now())
+	if err != nil {
+		t.Fatalf("snapshotSets() failed: %v", err)
+	}
+	if len(sets) != 1 || sets[0].name != "" || sets[0].path != stagingDir || len(sets[0].files) != 0 {
+		t.Errorf("snapshotSets() = %+v, want one backup of the staging directory", sets)
+	}
+	if args := sets[0].args("", ResticVersion{}); !slices.Equal(args, []string{stagingDir}) {
+		t.Errorf("args() = %v, want just the staging directory", args)
+	}
+}
+
+func TestManager_SnapshotSets_ModsInterval(t *testing.T) {
+	stagingDir := t.TempDir()
+	createStagingEntries(t, stagingDir, []string{"Saves", "Logs", "Mods"}, []string{"serverconfig.json"})
+	m := &Manager{StagingDir: stagingDir, ModsInterval: 24 * time.Hour}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	sets, err := m.snapshotSets(now)
+	if err != nil {
+		t.Fatalf("snapshotSets() failed: %v", err)
+	}
+	if len(sets) != 2 || sets[0].name != SnapshotSetWorld || sets[1].name != SnapshotSetMods {
+		t.Fatalf("snapshotSets() = %+v, want world and mods sets", sets)
+	}
+
+	wantFiles := []string{
+		filepath.Join(stagingDir, "Logs"),
+		filepath.Join(stagingDir, "Saves"),
+		filepath.Join(stagingDir, "serverconfig.json"),
+	}
+	if !slices.Equal(sets[0].files, wantFiles) {
+		t.Errorf("world files = %v, want %v", sets[0].files, wantFiles)
+	}
+	if sets[1].path != filepath.Join(stagingDir, "Mods") {
+		t.Errorf("mods path = %q", sets[1].path)
+	}
+
+	// Mods aren't due again until ModsInterval has passed
+	m.recordSnapshotSets(sets, now)
+	if sets, _ := m.snapshotSets(now.Add(time.Hour)); len(sets) != 1 {
+		t.Errorf("snapshotSets() an hour later = %d sets, want only world", len(sets))
+	}
+	if sets, _ := m.snapshotSets(now.Add(24 * time.Hour)); len(sets) != 2 {
+		t.Errorf("snapshotSets() a day later = %d sets, want world and mods", len(sets))
+	}
+}
+
+func TestSnapshotSet_Args(t *testing.T) {
+	set := snapshotSet{name: SnapshotSetWorld, files: []string{"/staging/Saves"}}
+
+	args := set.args("/tmp/list.txt", ResticVersion{0, 16, 4})
+	want := []string{"--tag", "snapshot_set=world", "--files-from-verbatim", "/tmp/list.txt"}
+	if !slices.Equal(args, want) {
+		t.Errorf("args() = %v, want %v", args, want)
+	}
+
+	args = set.args("/tmp/list.txt", ResticVersion{0, 11, 0})
+	want = []string{"--tag", "snapshot_set=world", "--files-from", "/tmp/list.txt"}
+	if !slices.Equal(args, want) {
+		t.Errorf("args() for restic 0.11 = %v, want %v", args, want)
+	}
+}
+
+func TestSnapshotSet_WriteFileList(t *testing.T) {
+	set := snapshotSet{files: []string{"/staging/Logs", "/staging/Saves"}}
+
+	path, err := set.writeFileList()
+	if err != nil {
+		t.Fatalf("writeFileList() failed: %v", err)
+	}
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Split(strings.TrimSpace(string(data)), "\n"); !slices.Equal(got, set.files) {
+		t.Errorf("file list = %q, want %q", got, set.files)
+	}
+}
+
+func TestManager_RunRestic_ModsSet(t *testing.T) {
+	stagingDir := t.TempDir()
+	createStagingEntries(t, stagingDir, []string{"Saves", "Mods"}, nil)
+	restic := &testsupport.ResticRunner{}
+	m := &Manager{StagingDir: stagingDir, ModsInterval: time.Hour, ResticRunner: restic.Run}
+
+	for range 2 {
+		if _, err := m.runRestic(context.Background()); err != nil {
+			t.Fatalf("runRestic() failed: %v", err)
+		}
+	}
+
+	// Mods are only backed up by the first run
+	want := []string{stagingDir, filepath.Join(stagingDir, "Mods"), stagingDir}
+	if runs := restic.Runs(); !slices.Equal(runs, want) {
+		t.Errorf("restic runs = %v, want %v", runs, want)
+	}
+}
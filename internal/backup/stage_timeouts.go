@@ -0,0 +1,119 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultStageTimeouts bounds the stages of a backup that have no other
+// limit, so a hung stage fails the backup instead of stalling every backup
+// after it. The genbackup stage defaults to BackupTimeout instead. Waiting
+// for an autosave is bounded by AutosaveMaxWait, and hooks by Hooks.Timeout.
+var DefaultStageTimeouts = map[Stage]time.Duration{
+	StageStaging:      2 * time.Hour,
+	StageResticBackup: 12 * time.Hour,
+	StagePrune:        6 * time.Hour,
+	StageCheck:        12 * time.Hour,
+}
+
+// StageTimeoutError is returned when a stage of a backup runs longer than
+// its timeout.
+type StageTimeoutError struct {
+	// Stage is the stage that timed out.
+	Stage Stage
+
+	// Timeout is the stage's timeout.
+	Timeout time.Duration
+
+	// Err is the error the stage failed with once its context expired.
+	Err error
+}
+
+func (e *StageTimeoutError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("stage %s timed out after %v", e.Stage, e.Timeout)
+	}
+	return fmt.Sprintf("stage %s timed out after %v: %v", e.Stage, e.Timeout, e.Err)
+}
+
+// Unwrap makes a StageTimeoutError match its cause and
+// context.DeadlineExceeded.
+func (e *StageTimeoutError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{context.DeadlineExceeded}
+	}
+	return []error{e.Err, context.DeadlineExceeded}
+}
+
+// ParseStageTimeouts parses a comma-separated list of stage=duration pairs,
+// such as "restic-backup=4h,check=1d", for the stages DefaultStageTimeouts
+// and genbackup. A duration of "off" removes the stage's timeout.
+func ParseStageTimeouts(s string) (map[Stage]time.Duration, error) {
+	timeouts := make(map[Stage]time.Duration)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected stage=duration, got %q", pair)
+		}
+		stage := Stage(strings.TrimSpace(name))
+		if _, ok := DefaultStageTimeouts[stage]; !ok && stage != StageGenBackup {
+			return nil, fmt.Errorf("unknown stage %q (expected genbackup, staging, restic-backup, prune, or check)", stage)
+		}
+		value = strings.TrimSpace(value)
+		if strings.EqualFold(value, "off") {
+			timeouts[stage] = 0
+			continue
+		}
+		d, err := ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid timeout for stage %s: must be a positive duration or off, got %q", stage, value)
+		}
+		timeouts[stage] = d
+	}
+	return timeouts, nil
+}
+
+// stageTimeout returns the timeout of stage, or 0 if it has none.
+func (m *Manager) stageTimeout(stage Stage) time.Duration {
+	if d, ok := m.StageTimeouts[stage]; ok {
+		return d
+	}
+	if stage == StageGenBackup {
+		return m.backupTimeout()
+	}
+	return DefaultStageTimeouts[stage]
+}
+
+// beginStage moves a running backup on to stage, and returns the stage's
+// context from stageContext.
+func (m *Manager) beginStage(ctx context.Context, stage Stage) (context.Context, context.CancelFunc) {
+	m.setStage(stage)
+	return m.stageContext(ctx, stage)
+}
+
+// stageContext returns a context that expires when stage has run for its
+// timeout. Pass errors from the stage through stageError.
+func (m *Manager) stageContext(ctx context.Context, stage Stage) (context.Context, context.CancelFunc) {
+	timeout := m.stageTimeout(stage)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, timeout, &StageTimeoutError{Stage: stage, Timeout: timeout})
+}
+
+// stageError returns err as a StageTimeoutError if the stage's context from
+// beginStage expired, so the failure names the stage that hung.
+func stageError(stageCtx context.Context, err error) error {
+	var timeout *StageTimeoutError
+	if err == nil || !errors.As(context.Cause(stageCtx), &timeout) {
+		return err
+	}
+	return &StageTimeoutError{Stage: timeout.Stage, Timeout: timeout.Timeout, Err: err}
+}
@@ -0,0 +1,118 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestParseStageTimeouts(t *testing.T) {
+	got, err := ParseStageTimeouts(" restic-backup=4h, check=1d,genbackup=off ")
+	if err != nil {
+		t.Fatalf("ParseStageTimeouts failed: %v", err)
+	}
+	want := map[Stage]time.Duration{StageResticBackup: 4 * time.Hour, StageCheck: 24 * time.Hour, StageGenBackup: 0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseStageTimeouts = %v, want %v", got, want)
+	}
+
+	if got, err := ParseStageTimeouts(""); err != nil || len(got) != 0 {
+		t.Errorf("ParseStageTimeouts(\"\") = %v, %v, want none", got, err)
+	}
+
+	for _, s := range []string{"restic-backup", "restic-backup=", "restic-backup=0", "restic-backup=-1m", "prune-hook=1h", "post-backup-hook=1m"} {
+		if _, err := ParseStageTimeouts(s); err == nil {
+			t.Errorf("ParseStageTimeouts(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestManager_StageTimeout(t *testing.T) {
+	m := &Manager{BackupTimeout: time.Minute, StageTimeouts: map[Stage]time.Duration{StagePrune: time.Hour, StageCheck: 0}}
+
+	for stage, want := range map[Stage]time.Duration{
+		StageGenBackup:    time.Minute,
+		StageStaging:      DefaultStageTimeouts[StageStaging],
+		StageResticBackup: DefaultStageTimeouts[StageResticBackup],
+		StagePrune:        time.Hour,
+		StageCheck:        0,
+	} {
+		if got := m.stageTimeout(stage); got != want {
+			t.Errorf("stageTimeout(%s) = %v, want %v", stage, got, want)
+		}
+	}
+}
+
+func TestManager_PerformBackup_StageTimeout(t *testing.T) {
+	gameDataDir := t.TempDir()
+	backupsDir := filepath.Join(gameDataDir, "Backups")
+	if err := os.MkdirAll(backupsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := `{"WorldConfig": {"SaveFileLocation": "/gamedata/Saves/test.vcdbs"}}`
+	if err := os.WriteFile(filepath.Join(gameDataDir, "serverconfig.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manager{
+		Interval:      time.Second,
+		Server:        &testsupport.Server{},
+		GameDataDir:   gameDataDir,
+		StagingDir:    t.TempDir(),
+		BackupTimeout: 2 * time.Second,
+		StageTimeouts: map[Stage]time.Duration{StageResticBackup: 50 * time.Millisecond},
+		// restic hangs until it is cancelled
+		ResticRunner: func(ctx context.Context, stagingDir string) error {
+			<-ctx.Done()
+			return errors.New("signal: killed")
+		},
+		VCDBTreeSplitter: func(srcPath, dstDir string) (int, int, error) {
+			return 0, 0, nil
+		},
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		os.WriteFile(filepath.Join(backupsDir, "backup.vcdbs"), []byte("backup data"), 0644)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := m.performBackup(ctx, false)
+	var timeout *StageTimeoutError
+	if !errors.As(err, &timeout) {
+		t.Fatalf("performBackup() error = %v, want a StageTimeoutError", err)
+	}
+	if timeout.Stage != StageResticBackup || timeout.Timeout != 50*time.Millisecond {
+		t.Errorf("StageTimeoutError = %+v, want restic-backup after 50ms", timeout)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "stage restic-backup timed out after 50ms: signal: killed") {
+		t.Errorf("performBackup() error = %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Error("the backup's own context expired; the stage timeout wasn't applied")
+	}
+}
+
+func TestStageError_OnlyForTimeouts(t *testing.T) {
+	m := &Manager{}
+	ctx, cancel := m.stageContext(context.Background(), StagePrune)
+	cancel()
+
+	// A stage cancelled from outside didn't time out
+	err := errors.New("failed")
+	if got := stageError(ctx, err); got != err {
+		t.Errorf("stageError() = %v, want %v", got, err)
+	}
+	if stageError(ctx, nil) != nil {
+		t.Error("stageError(nil) != nil")
+	}
+}
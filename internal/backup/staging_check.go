@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// StagingCheck is what CheckStaging found in one world's tree.
+type StagingCheck struct {
+	// Tree is the tree's path relative to the staging directory, such as
+	// "Saves/default".
+	Tree string
+
+	// Problems are the signs of a partly written tree that were found.
+	Problems *vcdbtree.TreeProblems
+
+	// Quarantined is where the tree was moved because it couldn't be
+	// repaired, or "" if it was repaired in place.
+	Quarantined string
+}
+
+// CheckStaging scans the world trees in the staging directory for signs
+// that a split was interrupted, such as empty row files, leftover temporary
+// files, or a missing FormatFile, and repairs what it finds, so a damaged
+// tree isn't snapshotted backup after backup. Stray and empty files are
+// removed, and no snapshot is taken until the next backup has split the
+// world again. A tree whose FormatFile can't be used is moved to
+// QuarantineDir instead, so the next backup splits the world from scratch.
+// Findings are logged; only trees with problems are returned. Run it at
+// startup, before backups start.
+func (m *Manager) CheckStaging(ctx context.Context) ([]StagingCheck, error) {
+	m.applyPathDefaults()
+
+	entries, err := os.ReadDir(filepath.Join(m.StagingDir, "Saves"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list staged worlds: %w", err)
+	}
+
+	var found []StagingCheck
+	resplit := false
+	for _, entry := range entries {
+		// Left over from an interrupted rebuild, cleaned up by the next split
+		if !entry.IsDir() || strings.HasSuffix(entry.Name(), vcdbtree.RebuildSuffix) ||
+			strings.HasSuffix(entry.Name(), vcdbtree.ReplacedSuffix) {
+			continue
+		}
+		tree := filepath.Join("Saves", entry.Name())
+		treeDir := filepath.Join(m.StagingDir, tree)
+		problems, err := vcdbtree.CheckTree(ctx, treeDir)
+		if err != nil {
+			return found, fmt.Errorf("failed to check staged tree %s: %w", tree, err)
+		}
+		if problems.OK() {
+			continue
+		}
+
+		check := StagingCheck{Tree: tree, Problems: problems}
+		fmt.Printf("WARNING: Staged tree %s looks partly written: %s\n", tree, problems)
+		if problems.BadFormat != nil {
+			if check.Quarantined, err = m.quarantineTree(treeDir, entry.Name()); err != nil {
+				return found, err
+			}
+			fmt.Printf("Moved %s to %s; the next backup splits the world from scratch\n", tree, check.Quarantined)
+		} else {
+			if err := removeTreeFiles(treeDir, problems.StrayFiles, problems.EmptyFiles); err != nil {
+				return found, err
+			}
+			fmt.Printf("Removed the damaged files of %s; the next backup splits the world again before taking a snapshot\n", tree)
+		}
+		found = append(found, check)
+		resplit = true
+	}
+
+	if resplit {
+		if err := m.requireResplit(); err != nil {
+			return found, err
+		}
+	}
+	return found, nil
+}
+
+// quarantineTree moves the tree at treeDir out of the staging directory into
+// the quarantine directory, and returns where it went.
+func (m *Manager) quarantineTree(treeDir, name string) (string, error) {
+	dir := m.quarantineDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	dst := filepath.Join(dir, name+"-"+time.Now().UTC().Format("20060102-150405"))
+	if err := os.Rename(treeDir, dst); err != nil {
+		return "", fmt.Errorf("failed to quarantine staged tree: %w", err)
+	}
+	return dst, nil
+}
+
+// removeTreeFiles removes files from the tree at treeDir, given relative to
+// it.
+func removeTreeFiles(treeDir string, lists ...[]string) error {
+	for _, files := range lists {
+		for _, rel := range files {
+			if err := os.Remove(filepath.Join(treeDir, rel)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", rel, err)
+			}
+		}
+	}
+	return nil
+}
+
+// requireResplit marks the staging directory as partway through an update,
+// so no snapshot is taken until the next backup has rolled it forward by
+// splitting the world again.
+func (m *Manager) requireResplit() error {
+	data, err := json.Marshal(stagingJournal{Started: time.Now(), Source: "staging check"})
+	if err != nil {
+		return fmt.Errorf("failed to marshal staging journal: %w", err)
+	}
+	if err := writeFileSync(m.journalPath(), data); err != nil {
+		return fmt.Errorf("failed to write staging journal: %w", err)
+	}
+	return nil
+}
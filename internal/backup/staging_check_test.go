@@ -0,0 +1,113 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// setupStagedTree splits the sample save into the staging directory as the
+// world "default".
+func setupStagedTree(t *testing.T) (m *Manager, treeDir string) {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "default.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	m = &Manager{StagingDir: t.TempDir(), GameDataDir: t.TempDir(), QuarantineDir: t.TempDir()}
+	treeDir = filepath.Join(m.StagingDir, "Saves", "default")
+	if _, _, err := vcdbtree.SplitWithCache(dbPath, treeDir); err != nil {
+		t.Fatal(err)
+	}
+	return m, treeDir
+}
+
+func TestManager_CheckStaging_Consistent(t *testing.T) {
+	m, _ := setupStagedTree(t)
+
+	found, err := m.CheckStaging(context.Background())
+	if err != nil || len(found) != 0 {
+		t.Fatalf("CheckStaging() = %v, %v, want nothing found", found, err)
+	}
+	if err := m.checkStagingComplete(); err != nil {
+		t.Errorf("a consistent tree held back the next snapshot: %v", err)
+	}
+}
+
+func TestManager_CheckStaging_SkipsRebuildLeftovers(t *testing.T) {
+	m, treeDir := setupStagedTree(t)
+	// A rebuild interrupted before the new tree was complete
+	if err := os.MkdirAll(filepath.Join(treeDir+vcdbtree.RebuildSuffix, "chunks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := m.CheckStaging(context.Background())
+	if err != nil || len(found) != 0 {
+		t.Fatalf("CheckStaging() = %v, %v, want the leftover left to the next split", found, err)
+	}
+}
+
+func TestManager_CheckStaging_Repairs(t *testing.T) {
+	m, treeDir := setupStagedTree(t)
+	empty := filepath.Join(treeDir, "gamedata", "1.bin")
+	stray := filepath.Join(treeDir, "gamedata", "2.bin.tmp")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stray, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := m.CheckStaging(context.Background())
+	if err != nil {
+		t.Fatalf("CheckStaging() failed: %v", err)
+	}
+	if len(found) != 1 || found[0].Tree != filepath.Join("Saves", "default") || found[0].Quarantined != "" {
+		t.Fatalf("CheckStaging() = %+v, want the tree repaired in place", found)
+	}
+	for _, path := range []string{empty, stray} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s wasn't removed", path)
+		}
+	}
+
+	// No snapshot until the world is split again
+	if err := m.checkStagingComplete(); !errors.Is(err, ErrStagingIncomplete) {
+		t.Errorf("checkStagingComplete() = %v, want ErrStagingIncomplete", err)
+	}
+}
+
+func TestManager_CheckStaging_QuarantinesBadFormat(t *testing.T) {
+	m, treeDir := setupStagedTree(t)
+	if err := os.WriteFile(filepath.Join(treeDir, vcdbtree.FormatFile), []byte(`{"version": 99}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := m.CheckStaging(context.Background())
+	if err != nil {
+		t.Fatalf("CheckStaging() failed: %v", err)
+	}
+	if len(found) != 1 || found[0].Quarantined == "" {
+		t.Fatalf("CheckStaging() = %+v, want the tree quarantined", found)
+	}
+	if _, err := os.Stat(treeDir); !os.IsNotExist(err) {
+		t.Error("quarantined tree is still in the staging directory")
+	}
+	if _, err := os.Stat(filepath.Join(found[0].Quarantined, vcdbtree.FormatFile)); err != nil {
+		t.Errorf("quarantined tree is missing: %v", err)
+	}
+	if err := m.checkStagingComplete(); !errors.Is(err, ErrStagingIncomplete) {
+		t.Errorf("checkStagingComplete() = %v, want ErrStagingIncomplete", err)
+	}
+}
+
+func TestManager_CheckStaging_NoStagedWorlds(t *testing.T) {
+	m := &Manager{StagingDir: t.TempDir()}
+	if found, err := m.CheckStaging(context.Background()); err != nil || found != nil {
+		t.Errorf("CheckStaging() = %v, %v, want nothing", found, err)
+	}
+}
@@ -0,0 +1,135 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// State is what the backup system is doing.
+type State string
+
+const (
+	// StateIdle means no backup is running and the last one succeeded, or
+	// none has been attempted yet.
+	StateIdle State = "idle"
+
+	// StateWaitingForServer means the last backup couldn't start because
+	// the server hadn't finished booting.
+	StateWaitingForServer State = "waiting-for-server"
+
+	// StateBackingUp means a backup is running; the Stage says which part.
+	StateBackingUp State = "backing-up"
+
+	// StatePaused means backups are being skipped, e.g. because nobody is
+	// online or it is outside the backup window.
+	StatePaused State = "paused"
+
+	// StateFailed means the last backup failed.
+	StateFailed State = "failed"
+
+	// StateRetrying means a backup failed transiently and will be retried
+	// shortly.
+	StateRetrying State = "retrying"
+)
+
+// Stage is the part of a backup that is running.
+type Stage string
+
+const (
+	StagePreBackupHook      Stage = "pre-backup-hook"
+	StageWaitingForAutosave Stage = "waiting-for-autosave"
+	StageGenBackup          Stage = "genbackup"
+	StageStaging            Stage = "staging"
+	StageResticBackup       Stage = "restic-backup"
+	StagePrune              Stage = "prune"
+	StageCheck              Stage = "check"
+	StagePostBackupHook     Stage = "post-backup-hook"
+)
+
+// ManagerState describes what the backup system is doing right now.
+type ManagerState struct {
+	// State is the current state.
+	State State
+
+	// Stage is the running part of a backup in StateBackingUp, else "".
+	Stage Stage
+
+	// Since is when the state (or stage) was entered.
+	Since time.Time
+
+	// Reason explains StateWaitingForServer, StatePaused, StateFailed, and
+	// StateRetrying.
+	Reason error
+}
+
+// String formats the state as "backing-up (staging)" or "paused: <reason>".
+func (s ManagerState) String() string {
+	line := string(s.State)
+	if s.State == "" {
+		line = string(StateIdle)
+	}
+	if s.Stage != "" {
+		line += fmt.Sprintf(" (%s)", s.Stage)
+	}
+	if s.Reason != nil {
+		line += ": " + s.Reason.Error()
+	}
+	return line
+}
+
+// State returns what the backup system is doing right now.
+func (m *Manager) State() ManagerState {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if m.state.State == "" {
+		return ManagerState{State: StateIdle, Since: m.state.Since}
+	}
+	return m.state
+}
+
+// setState enters a state, calling OnStateChange if it changed.
+func (m *Manager) setState(state State, stage Stage, reason error) {
+	m.stateMu.Lock()
+	prev := m.state
+	if prev.State == state && prev.Stage == stage && errorText(prev.Reason) == errorText(reason) {
+		m.stateMu.Unlock()
+		return
+	}
+	m.state = ManagerState{State: state, Stage: stage, Since: m.clock().Now(), Reason: reason}
+	next := m.state
+	m.stateMu.Unlock()
+
+	if m.OnStateChange != nil {
+		m.OnStateChange(next)
+	}
+}
+
+// setStage moves a running backup on to its next stage.
+func (m *Manager) setStage(stage Stage) {
+	m.setState(StateBackingUp, stage, nil)
+}
+
+// finishState leaves StateBackingUp for the state the outcome of an attempt
+// calls for.
+func (m *Manager) finishState(err error) {
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		m.setState(StateIdle, "", nil)
+	case errors.Is(err, ErrServerNotBooted):
+		m.setState(StateWaitingForServer, "", err)
+	case isSkip(err):
+		m.setState(StatePaused, "", err)
+	default:
+		m.setState(StateFailed, "", err)
+	}
+}
+
+// errorText returns err's message, or "" if err is nil.
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,103 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestManagerState_String(t *testing.T) {
+	tests := []struct {
+		state ManagerState
+		want  string
+	}{
+		{ManagerState{}, "idle"},
+		{ManagerState{State: StateBackingUp, Stage: StageStaging}, "backing-up (staging)"},
+		{ManagerState{State: StatePaused, Reason: ErrNoPlayersOnline}, "paused: " + ErrNoPlayersOnline.Error()},
+	}
+	for _, tt := range tests {
+		if got := tt.state.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.state, got, tt.want)
+		}
+	}
+}
+
+func TestManager_State_DefaultsToIdle(t *testing.T) {
+	m := &Manager{}
+	if got := m.State(); got.State != StateIdle || got.Stage != "" {
+		t.Errorf("State() = %v, want idle", got)
+	}
+}
+
+func TestManager_FinishState(t *testing.T) {
+	failure := errors.New("restic failed")
+	tests := []struct {
+		err  error
+		want State
+	}{
+		{nil, StateIdle},
+		{context.Canceled, StateIdle},
+		{ErrServerNotBooted, StateWaitingForServer},
+		{ErrNoPlayersOnline, StatePaused},
+		{failure, StateFailed},
+	}
+	for _, tt := range tests {
+		m := &Manager{}
+		m.setStage(StageResticBackup)
+		m.finishState(tt.err)
+
+		got := m.State()
+		if got.State != tt.want || got.Stage != "" {
+			t.Errorf("after %v: State() = %v, want %s", tt.err, got, tt.want)
+		}
+		if tt.want != StateIdle && !errors.Is(got.Reason, tt.err) {
+			t.Errorf("after %v: Reason = %v", tt.err, got.Reason)
+		}
+	}
+}
+
+func TestManager_SetState_CallsOnStateChangeOnlyOnChange(t *testing.T) {
+	var changes []ManagerState
+	m := &Manager{OnStateChange: func(s ManagerState) { changes = append(changes, s) }}
+
+	before := time.Now()
+	m.setStage(StageGenBackup)
+	m.setStage(StageGenBackup)
+	m.setStage(StageStaging)
+	m.finishState(ErrNoPlayersOnline)
+	m.finishState(ErrNoPlayersOnline)
+
+	want := []ManagerState{
+		{State: StateBackingUp, Stage: StageGenBackup},
+		{State: StateBackingUp, Stage: StageStaging},
+		{State: StatePaused, Reason: ErrNoPlayersOnline},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d state changes %v, want %d", len(changes), changes, len(want))
+	}
+	for i := range want {
+		if changes[i].State != want[i].State || changes[i].Stage != want[i].Stage || changes[i].Reason != want[i].Reason {
+			t.Errorf("change %d = %v, want %v", i, changes[i], want[i])
+		}
+		if changes[i].Since.Before(before) {
+			t.Errorf("change %d Since = %v, before the change", i, changes[i].Since)
+		}
+	}
+}
+
+func TestManager_RunBackupNow_PausesWhenNoPlayers(t *testing.T) {
+	m := &Manager{
+		Server:             &testsupport.Server{},
+		PlayerChecker:      testsupport.NewPlayerChecker(false),
+		PauseWhenNoPlayers: true,
+	}
+
+	_ = m.RunBackupNow(context.Background(), false)
+
+	if got := m.State(); got.State != StatePaused || !errors.Is(got.Reason, ErrNoPlayersOnline) {
+		t.Errorf("State() = %v, want paused for no players", got)
+	}
+}
@@ -0,0 +1,281 @@
+package backup
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// regionSizeChunks is the width of a map region in chunks (512 blocks / 32).
+const regionSizeChunks = 16
+
+// defaultTopRegions is how many high-churn regions are reported by default.
+const defaultTopRegions = 5
+
+// BackupStats summarizes how much a backup changed compared to the previous one.
+type BackupStats struct {
+	// FilesWritten is the number of vcdbtree files written because their content changed.
+	FilesWritten int
+
+	// FilesUnchanged is the number of vcdbtree files that were already up to date.
+	FilesUnchanged int
+
+	// ChunksChanged is the number of chunk files that changed.
+	ChunksChanged int
+
+	// BytesAdded is the amount of new data restic added to the repository,
+	// or -1 if unknown (e.g. a custom ResticRunner is used).
+	BytesAdded int64
+
+	// SnapshotID is the ID of the snapshot restic created, if known.
+	SnapshotID string
+
+	// TopRegions lists the map regions with the most changed chunks, busiest first.
+	TopRegions []RegionChurn
+
+	// Staging counts the files the staging update wrote, found up to date,
+	// and removed, per synced directory and per world table.
+	Staging StagingWork
+}
+
+// StagingWork counts what a staging update did with the files of each
+// synced directory and each table of the staged world's tree.
+type StagingWork struct {
+	// Dirs holds the counts of each synced directory (Logs, Playerdata,
+	// Mods) and config file, by name. Directories skipped by their sync
+	// policy or missing from the game data directory aren't listed.
+	Dirs map[string]vcdbtree.FileCounts
+
+	// Tables holds the counts of each table of the world's tree, such as
+	// "chunk". Empty if a custom VCDBTreeSplitter is used.
+	Tables map[string]vcdbtree.FileCounts
+}
+
+// recordDir records the counts of a synced directory or config file.
+func (w *StagingWork) recordDir(name string, files vcdbtree.FileCounts) {
+	if w.Dirs == nil {
+		w.Dirs = make(map[string]vcdbtree.FileCounts)
+	}
+	w.Dirs[name] = files
+}
+
+// recordTable records the counts of a table of the world's tree.
+func (w *StagingWork) recordTable(table string, files vcdbtree.FileCounts) {
+	if w.Tables == nil {
+		w.Tables = make(map[string]vcdbtree.FileCounts)
+	}
+	w.Tables[table] = files
+}
+
+// String lists the tables, then the directories, whose files were written
+// or removed, as "chunk: 1243 written, 12 removed; Logs: 2 written", or
+// "no changes".
+func (w StagingWork) String() string {
+	var parts []string
+	for _, counts := range []map[string]vcdbtree.FileCounts{w.Tables, w.Dirs} {
+		names := make([]string, 0, len(counts))
+		for name := range counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			files := counts[name]
+			var changes []string
+			if files.Written > 0 {
+				changes = append(changes, fmt.Sprintf("%d written", files.Written))
+			}
+			if files.Removed > 0 {
+				changes = append(changes, fmt.Sprintf("%d removed", files.Removed))
+			}
+			if len(changes) > 0 {
+				parts = append(parts, name+": "+strings.Join(changes, ", "))
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// RegionChurn counts the changed chunks within one map region.
+type RegionChurn struct {
+	// RegionX and RegionZ are the map region coordinates (512x512 blocks each).
+	RegionX, RegionZ int32
+
+	// Chunks is the number of changed chunks in the region.
+	Chunks int
+
+	// Bytes is the total size of the changed chunks.
+	Bytes int64
+}
+
+// String formats the stats as a single log line.
+func (s BackupStats) String() string {
+	added := "unknown"
+	if s.BytesAdded >= 0 {
+		added = formatBytes(s.BytesAdded)
+	}
+
+	line := fmt.Sprintf("%d chunks changed, %d files written, %d unchanged, %s added to repository",
+		s.ChunksChanged, s.FilesWritten, s.FilesUnchanged, added)
+
+	if len(s.TopRegions) > 0 {
+		parts := make([]string, len(s.TopRegions))
+		for i, r := range s.TopRegions {
+			parts[i] = fmt.Sprintf("%d,%d (%d chunks, %s)", r.RegionX, r.RegionZ, r.Chunks, formatBytes(r.Bytes))
+		}
+		line += "; busiest regions: " + strings.Join(parts, ", ")
+	}
+
+	return line
+}
+
+// formatBytes formats a byte count using binary units.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.2f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.2f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// churnTracker counts changed chunks per map region. A nil *churnTracker
+// ignores all records.
+type churnTracker struct {
+	mu      sync.Mutex
+	chunks  int
+	regions map[[2]int32]*RegionChurn
+}
+
+// record counts a written row; only rows of the chunk table are tracked.
+func (c *churnTracker) record(table string, position int64, size int) {
+	if c == nil || table != "chunk" {
+		return
+	}
+
+	x, z := vcdbtree.ChunkCoords(position)
+	key := [2]int32{floorDiv(x, regionSizeChunks), floorDiv(z, regionSizeChunks)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.regions == nil {
+		c.regions = make(map[[2]int32]*RegionChurn)
+	}
+	r, ok := c.regions[key]
+	if !ok {
+		r = &RegionChurn{RegionX: key[0], RegionZ: key[1]}
+		c.regions[key] = r
+	}
+	r.Chunks++
+	r.Bytes += int64(size)
+	c.chunks++
+}
+
+// top returns the n regions with the most changed chunks.
+func (c *churnTracker) top(n int) []RegionChurn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	all := make([]RegionChurn, 0, len(c.regions))
+	for _, r := range c.regions {
+		all = append(all, *r)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		if a.Chunks != b.Chunks {
+			return a.Chunks > b.Chunks
+		}
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		if a.RegionZ != b.RegionZ {
+			return a.RegionZ < b.RegionZ
+		}
+		return a.RegionX < b.RegionX
+	})
+
+	if len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+// floorDiv divides rounding towards negative infinity, so negative chunk
+// coordinates land in the correct region.
+func floorDiv(a, b int32) int32 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+// resticSummary holds the fields of restic's JSON backup summary that we report.
+type resticSummary struct {
+	MessageType     string `json:"message_type"`
+	FilesNew        int    `json:"files_new"`
+	FilesChanged    int    `json:"files_changed"`
+	FilesUnmodified int    `json:"files_unmodified"`
+	DataAdded       int64  `json:"data_added"`
+	SnapshotID      string `json:"snapshot_id"`
+
+	TotalFilesProcessed int     `json:"total_files_processed"`
+	TotalBytesProcessed int64   `json:"total_bytes_processed"`
+	TotalDuration       float64 `json:"total_duration"`
+}
+
+// String summarizes the backup the way restic does without --json.
+func (s *resticSummary) String() string {
+	duration := time.Duration(s.TotalDuration * float64(time.Second)).Round(time.Millisecond)
+	return fmt.Sprintf("snapshot %s saved: %d new, %d changed, %d unmodified files, %s added to the repository; processed %d files, %s in %s",
+		shortSnapshotID(s.SnapshotID), s.FilesNew, s.FilesChanged, s.FilesUnmodified, formatBytes(s.DataAdded),
+		s.TotalFilesProcessed, formatBytes(s.TotalBytesProcessed), duration)
+}
+
+// parseResticBackupOutput reads the output of `restic backup --json`, returning
+// the summary message. Progress messages are dropped, the summary is written
+// to w in the form restic prints it without --json, and anything else is
+// copied to w.
+func parseResticBackupOutput(r io.Reader, w io.Writer) (*resticSummary, error) {
+	var summary *resticSummary
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		var msg resticSummary
+		if err := json.Unmarshal(line, &msg); err != nil {
+			fmt.Fprintf(w, "%s\n", line)
+			continue
+		}
+
+		switch msg.MessageType {
+		case "status":
+			// Progress updates are too noisy for the log
+		case "summary":
+			summary = &msg
+			fmt.Fprintf(w, "restic: %s\n", summary)
+		default:
+			fmt.Fprintf(w, "%s\n", line)
+		}
+	}
+
+	return summary, scanner.Err()
+}
@@ -0,0 +1,177 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+func TestFloorDiv(t *testing.T) {
+	tests := []struct {
+		a, b, want int32
+	}{
+		{0, 16, 0},
+		{15, 16, 0},
+		{16, 16, 1},
+		{-1, 16, -1},
+		{-16, 16, -1},
+		{-17, 16, -2},
+	}
+	for _, tt := range tests {
+		if got := floorDiv(tt.a, tt.b); got != tt.want {
+			t.Errorf("floorDiv(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestChurnTracker_Top(t *testing.T) {
+	c := &churnTracker{}
+
+	// chunkPos packs non-negative chunk coordinates into a position value
+	chunkPos := func(x, z int64) int64 { return z<<27 | x }
+
+	// Region 0,0 gets three changes, region 1,0 gets one, region 0,2 gets two
+	c.record("chunk", chunkPos(0, 0), 100)
+	c.record("chunk", chunkPos(5, 5), 100)
+	c.record("chunk", chunkPos(15, 15), 100)
+	c.record("chunk", chunkPos(16, 0), 100)
+	c.record("chunk", chunkPos(0, 32), 50)
+	c.record("chunk", chunkPos(1, 33), 50)
+	c.record("mapchunk", chunkPos(16, 0), 100) // Not counted
+
+	top := c.top(2)
+	if len(top) != 2 {
+		t.Fatalf("top(2) returned %d regions", len(top))
+	}
+	if top[0] != (RegionChurn{RegionX: 0, RegionZ: 0, Chunks: 3, Bytes: 300}) {
+		t.Errorf("top[0] = %+v", top[0])
+	}
+	if top[1] != (RegionChurn{RegionX: 0, RegionZ: 2, Chunks: 2, Bytes: 100}) {
+		t.Errorf("top[1] = %+v", top[1])
+	}
+	if c.chunks != 6 {
+		t.Errorf("chunks = %d, want 6", c.chunks)
+	}
+
+	var nilTracker *churnTracker
+	nilTracker.record("chunk", 0, 1) // Should not panic
+}
+
+func TestBackupStats_String(t *testing.T) {
+	s := BackupStats{
+		FilesWritten:   12,
+		FilesUnchanged: 3000,
+		ChunksChanged:  10,
+		BytesAdded:     3 << 20,
+		TopRegions:     []RegionChurn{{RegionX: 1000, RegionZ: -2, Chunks: 7, Bytes: 2048}},
+	}
+
+	got := s.String()
+	for _, want := range []string{"10 chunks changed", "12 files written", "3.00 MiB added", "1000,-2 (7 chunks, 2.00 KiB)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("String() = %q, missing %q", got, want)
+		}
+	}
+
+	s.BytesAdded = -1
+	if !strings.Contains(s.String(), "unknown added") {
+		t.Errorf("String() = %q, expected unknown bytes added", s.String())
+	}
+}
+
+func TestStagingWork_String(t *testing.T) {
+	var w StagingWork
+	if got := w.String(); got != "no changes" {
+		t.Errorf("String() = %q, want no changes", got)
+	}
+
+	w.recordTable("chunk", vcdbtree.FileCounts{Written: 1243, Skipped: 50000, Removed: 12})
+	w.recordTable("mapregion", vcdbtree.FileCounts{Skipped: 40})
+	w.recordDir("Logs", vcdbtree.FileCounts{Written: 2, Skipped: 8})
+	w.recordDir("Mods", vcdbtree.FileCounts{Skipped: 3})
+	if got, want := w.String(), "chunk: 1243 written, 12 removed; Logs: 2 written"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestParseResticBackupOutput(t *testing.T) {
+	output := `{"message_type":"status","percent_done":0.5}
+{"message_type":"status","percent_done":1}
+not json at all
+{"message_type":"summary","files_new":2,"files_changed":5,"files_unmodified":100,"data_added":12345,"total_files_processed":107,"total_bytes_processed":3145728,"total_duration":1.2344,"snapshot_id":"abc123def456"}
+`
+	var passthrough bytes.Buffer
+	summary, err := parseResticBackupOutput(strings.NewReader(output), &passthrough)
+	if err != nil {
+		t.Fatalf("parseResticBackupOutput failed: %v", err)
+	}
+	if summary == nil || summary.DataAdded != 12345 || summary.SnapshotID != "abc123def456" || summary.FilesChanged != 5 {
+		t.Errorf("summary = %+v", summary)
+	}
+	want := "not json at all\n" +
+		"restic: snapshot abc123de saved: 2 new, 5 changed, 100 unmodified files, 12.06 KiB added to the repository; processed 107 files, 3.00 MiB in 1.234s\n"
+	if passthrough.String() != want {
+		t.Errorf("passthrough = %q, want %q", passthrough.String(), want)
+	}
+}
+
+func TestManager_PerformBackup_ReportsStats(t *testing.T) {
+	gameData := testsupport.CreateGameData(t)
+	testsupport.CreateBloatedSave(t, gameData.SavePath, 20)
+
+	var got []BackupStats
+	m := &Manager{
+		Server:        gameData.Server(),
+		GameDataDir:   gameData.Dir,
+		StagingDir:    t.TempDir(),
+		BackupTimeout: 5 * time.Second,
+		ResticRunner: func(ctx context.Context, stagingDir string) error {
+			return nil
+		},
+		OnBackupStats: func(stats BackupStats) {
+			got = append(got, stats)
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// First backup writes every chunk, the second one writes nothing
+	for i := 0; i < 2; i++ {
+		if err := m.performBackup(ctx, true); err != nil {
+			t.Fatalf("performBackup() failed: %v", err)
+		}
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("OnBackupStats called %d times, want 2", len(got))
+	}
+	if got[0].ChunksChanged != 20 || got[0].BytesAdded != -1 {
+		t.Errorf("First backup stats = %+v, want 20 chunks changed and unknown bytes", got[0])
+	}
+	// Chunks 0-15 fall into region 0,0 and chunks 16-19 into region 1,0
+	if len(got[0].TopRegions) != 2 || got[0].TopRegions[0].Chunks != 16 || got[0].TopRegions[1].RegionX != 1 {
+		t.Errorf("First backup top regions = %+v, want 16 chunks in 0,0 then 4 in 1,0", got[0].TopRegions)
+	}
+	if got[1].ChunksChanged != 0 || got[1].FilesWritten != 0 || got[1].FilesUnchanged == 0 {
+		t.Errorf("Second backup stats = %+v, want no changes", got[1])
+	}
+
+	if chunks := got[0].Staging.Tables["chunk"]; chunks.Written != 20 {
+		t.Errorf("First backup chunk files = %+v, want 20 written", chunks)
+	}
+	if chunks := got[1].Staging.Tables["chunk"]; chunks.Written != 0 || chunks.Skipped != 20 {
+		t.Errorf("Second backup chunk files = %+v, want 20 unchanged", chunks)
+	}
+	if config := got[1].Staging.Dirs["serverconfig.json"]; config.Skipped != 1 {
+		t.Errorf("Second backup serverconfig.json = %+v, want unchanged", config)
+	}
+	if last := m.Status().LastStats; last == nil || last.Staging.String() != "no changes" {
+		t.Errorf("Status().LastStats = %+v, want the second backup's stats", last)
+	}
+}
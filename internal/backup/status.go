@@ -0,0 +1,116 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// skipSummaryInterval is how often a summary is logged while every backup
+// is being skipped, so a long pause stands out from the per-backup lines.
+const skipSummaryInterval = 24 * time.Hour
+
+// Status describes the outcome of recent backup attempts.
+type Status struct {
+	// LastAttempt is when the last backup attempt finished.
+	LastAttempt time.Time
+
+	// LastSuccess is when the last backup succeeded. Zero if none has since
+	// the launcher started; see LastSuccessfulBackup for the persisted time.
+	LastSuccess time.Time
+
+	// LastError is the error from the last failed attempt, cleared on success.
+	LastError error
+
+	// ConsecutiveSkips is how many attempts in a row were skipped rather
+	// than run, e.g. because no players were online.
+	ConsecutiveSkips int
+
+	// LastSkipReason is why the last skipped attempt was skipped.
+	LastSkipReason error
+
+	// SkippingSince is when the current run of skips began. Zero if the
+	// last attempt wasn't skipped.
+	SkippingSince time.Time
+
+	// Drift is how far the live save had drifted from the last backup when
+	// DriftMeasured, as measured by MeasureDrift. A successful backup resets
+	// it to no changes. Nil if not measured since the launcher started.
+	Drift *vcdbtree.Drift
+
+	// DriftMeasured is when Drift was measured.
+	DriftMeasured time.Time
+
+	// IntegrityMismatch describes how the last snapshot's file or byte count
+	// differed from the staging tree's, or is empty if it matched.
+	IntegrityMismatch string
+
+	// LastStats describes what the last snapshot taken changed, down to the
+	// files written per synced directory and world table. Nil if no
+	// snapshot was taken since the launcher started.
+	LastStats *BackupStats
+}
+
+// isSkip reports whether err means a backup was deliberately not run.
+func isSkip(err error) bool {
+	return errors.Is(err, ErrNoPlayersOnline) || errors.Is(err, ErrServerNotBooted)
+}
+
+// Status returns the outcome of recent backup attempts.
+func (m *Manager) Status() Status {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	return m.status
+}
+
+// recordAttempt updates Status with the result of a backup attempt that
+// finished at now, and logs a summary once skips have gone on for a while.
+func (m *Manager) recordAttempt(err error, now time.Time) {
+	m.finishState(err)
+
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+
+	s := &m.status
+	s.LastAttempt = now
+
+	if !isSkip(err) {
+		s.ConsecutiveSkips = 0
+		s.SkippingSince = time.Time{}
+		m.lastSkipSummary = time.Time{}
+		s.LastError = err
+		if err == nil {
+			s.LastSuccess = now
+			s.Drift = &vcdbtree.Drift{}
+			s.DriftMeasured = now
+		}
+		return
+	}
+
+	if s.ConsecutiveSkips == 0 {
+		s.SkippingSince = now
+		m.lastSkipSummary = now
+	}
+	s.ConsecutiveSkips++
+	s.LastSkipReason = err
+
+	if now.Sub(m.lastSkipSummary) >= skipSummaryInterval {
+		m.lastSkipSummary = now
+		fmt.Printf("No backup in %v: the last %d backups were skipped (%v)\n",
+			now.Sub(m.lastBackupTime(s.SkippingSince)).Round(time.Minute), s.ConsecutiveSkips, err)
+	}
+}
+
+// lastBackupTime returns when a backup last succeeded, falling back to the
+// given time if none is known. Must be called with statusMu held.
+func (m *Manager) lastBackupTime(fallback time.Time) time.Time {
+	if !m.status.LastSuccess.IsZero() {
+		return m.status.LastSuccess
+	}
+	if t, ok := m.LastSuccessfulBackup(); ok {
+		return t
+	}
+	return fallback
+}
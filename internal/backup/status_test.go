@@ -0,0 +1,107 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestIsSkip(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{ErrNoPlayersOnline, true},
+		{ErrServerNotBooted, true},
+		{errors.New("restic failed"), false},
+	}
+	for _, tt := range tests {
+		if got := isSkip(tt.err); got != tt.want {
+			t.Errorf("isSkip(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestManager_RecordAttempt_CountsConsecutiveSkips(t *testing.T) {
+	m := &Manager{}
+	start := time.Date(2025, 12, 14, 12, 0, 0, 0, time.UTC)
+
+	m.recordAttempt(nil, start)
+	m.recordAttempt(ErrNoPlayersOnline, start.Add(time.Hour))
+	m.recordAttempt(ErrNoPlayersOnline, start.Add(2*time.Hour))
+
+	s := m.Status()
+	if s.ConsecutiveSkips != 2 {
+		t.Errorf("ConsecutiveSkips = %d, want 2", s.ConsecutiveSkips)
+	}
+	if !errors.Is(s.LastSkipReason, ErrNoPlayersOnline) {
+		t.Errorf("LastSkipReason = %v, want %v", s.LastSkipReason, ErrNoPlayersOnline)
+	}
+	if !s.SkippingSince.Equal(start.Add(time.Hour)) {
+		t.Errorf("SkippingSince = %v, want %v", s.SkippingSince, start.Add(time.Hour))
+	}
+	if !s.LastSuccess.Equal(start) {
+		t.Errorf("LastSuccess = %v, want %v", s.LastSuccess, start)
+	}
+	if !s.LastAttempt.Equal(start.Add(2 * time.Hour)) {
+		t.Errorf("LastAttempt = %v, want %v", s.LastAttempt, start.Add(2*time.Hour))
+	}
+}
+
+func TestManager_RecordAttempt_ResetsSkipsOnRun(t *testing.T) {
+	m := &Manager{}
+	now := time.Date(2025, 12, 14, 12, 0, 0, 0, time.UTC)
+	failure := errors.New("restic failed")
+
+	m.recordAttempt(ErrNoPlayersOnline, now)
+	m.recordAttempt(failure, now.Add(time.Hour))
+
+	s := m.Status()
+	if s.ConsecutiveSkips != 0 || !s.SkippingSince.IsZero() {
+		t.Errorf("ConsecutiveSkips = %d, SkippingSince = %v; want 0 and zero after a failed run", s.ConsecutiveSkips, s.SkippingSince)
+	}
+	if !errors.Is(s.LastError, failure) {
+		t.Errorf("LastError = %v, want %v", s.LastError, failure)
+	}
+
+	m.recordAttempt(nil, now.Add(2*time.Hour))
+	if s := m.Status(); s.LastError != nil {
+		t.Errorf("LastError = %v, want nil after a successful backup", s.LastError)
+	}
+}
+
+func TestManager_RecordAttempt_SummarizesLongPauses(t *testing.T) {
+	m := &Manager{}
+	start := time.Date(2025, 12, 14, 12, 0, 0, 0, time.UTC)
+
+	m.recordAttempt(nil, start)
+	for i := 1; i <= 48; i++ {
+		m.recordAttempt(ErrNoPlayersOnline, start.Add(time.Duration(i)*time.Hour))
+	}
+
+	// The streak began at hour 1, so summaries are due at hours 25 and 49
+	if got, want := m.lastSkipSummary, start.Add(25*time.Hour); !got.Equal(want) {
+		t.Errorf("lastSkipSummary = %v, want %v", got, want)
+	}
+}
+
+func TestManager_RunBackupNow_RecordsStatus(t *testing.T) {
+	m := &Manager{
+		Server:             &testsupport.Server{},
+		PlayerChecker:      testsupport.NewPlayerChecker(false),
+		PauseWhenNoPlayers: true,
+	}
+
+	err := m.RunBackupNow(context.Background(), false)
+	if !errors.Is(err, ErrNoPlayersOnline) {
+		t.Fatalf("RunBackupNow() error = %v, want %v", err, ErrNoPlayersOnline)
+	}
+
+	if s := m.Status(); s.ConsecutiveSkips != 1 {
+		t.Errorf("ConsecutiveSkips = %d, want 1", s.ConsecutiveSkips)
+	}
+}
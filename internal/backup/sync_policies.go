@@ -0,0 +1,148 @@
+package backup
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/renorris/vintagestory-restic/pkg/vcdbtree"
+)
+
+// SyncedDirs are the directories of the game data directory that are synced
+// into staging for each backup, and can be given a SyncPolicy.
+var SyncedDirs = []string{"Logs", "Playerdata", "Mods"}
+
+// Sync modes, selecting how a synced directory's files are compared with
+// their staged copies.
+const (
+	// SyncContent compares each file's content with its staged copy, and
+	// only rewrites files whose content changed.
+	SyncContent = "content"
+
+	// SyncMtime trusts size and modification time: files whose staged copy
+	// has the same are skipped without being read. Staged copies keep the
+	// modification time of their source. Cheaper for large directories of
+	// files that are written once, like rotated logs.
+	SyncMtime = "mtime"
+
+	// SyncSkip leaves the directory out of backups. A staged copy from
+	// earlier backups is removed.
+	SyncSkip = "skip"
+)
+
+// SyncPolicy is how one of SyncedDirs is synced into staging.
+type SyncPolicy struct {
+	// Mode is SyncContent, SyncMtime, or SyncSkip. Empty means SyncContent.
+	Mode string
+
+	// Exclude lists filepath.Match patterns of files to leave out. A pattern
+	// with a slash matches the path relative to the directory, one without
+	// matches the file name in any subdirectory.
+	Exclude []string
+}
+
+// excluded reports whether rel, a path relative to the directory, matches
+// one of Exclude.
+func (p SyncPolicy) excluded(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range p.Exclude {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = filepath.Base(rel)
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// syncOptions returns the vcdbtree options that sync a directory by p,
+// copying workers files at once through throttle.
+func (p SyncPolicy) syncOptions(workers int, throttle *vcdbtree.Throttle) vcdbtree.SyncOptions {
+	opts := vcdbtree.SyncOptions{Workers: workers, Metadata: p.Mode == SyncMtime, Throttle: throttle}
+	if len(p.Exclude) > 0 {
+		opts.Exclude = p.excluded
+	}
+	return opts
+}
+
+// copyFile copies src to its staged copy dst as p compares files.
+func (p SyncPolicy) copyFile(src, dst string) (bool, error) {
+	if p.Mode == SyncMtime {
+		return vcdbtree.CopyFileIfModified(src, dst)
+	}
+	return vcdbtree.CopyFileIfChanged(src, dst)
+}
+
+// ParseSyncPolicies parses sync modes, as comma-separated dir=mode pairs
+// such as "Logs=mtime,Mods=content", and exclusions, as comma-separated
+// patterns prefixed with their directory such as "Logs/*.txt,Mods/*.bak",
+// into the policies of SyncedDirs. Directories not mentioned aren't in the
+// result.
+func ParseSyncPolicies(modes, exclude string) (map[string]SyncPolicy, error) {
+	policies := make(map[string]SyncPolicy)
+	for _, pair := range strings.Split(modes, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		dir, mode, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected dir=mode, got %q", pair)
+		}
+		dir, err := syncedDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+		case SyncContent, SyncMtime, SyncSkip:
+		default:
+			return nil, fmt.Errorf("unknown sync mode %q for %s: expected %q, %q, or %q", mode, dir, SyncContent, SyncMtime, SyncSkip)
+		}
+		policy := policies[dir]
+		policy.Mode = mode
+		policies[dir] = policy
+	}
+
+	for _, entry := range strings.Split(exclude, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		dir, pattern, ok := strings.Cut(filepath.ToSlash(entry), "/")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("expected dir/pattern, got %q", entry)
+		}
+		dir, err := syncedDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", entry, err)
+		}
+		policy := policies[dir]
+		policy.Exclude = append(policy.Exclude, pattern)
+		policies[dir] = policy
+	}
+	return policies, nil
+}
+
+// syncedDir validates the name of one of SyncedDirs.
+func syncedDir(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if !slices.Contains(SyncedDirs, name) {
+		return "", fmt.Errorf("unknown directory %q: expected %s", name, strings.Join(SyncedDirs, ", "))
+	}
+	return name, nil
+}
+
+// syncPolicy returns the SyncPolicy of dir, one of SyncedDirs.
+func (m *Manager) syncPolicy(dir string) SyncPolicy {
+	policy := m.SyncPolicies[dir]
+	if policy.Mode == "" {
+		policy.Mode = SyncContent
+	}
+	return policy
+}
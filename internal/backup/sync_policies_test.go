@@ -0,0 +1,126 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSyncPolicies(t *testing.T) {
+	policies, err := ParseSyncPolicies("Logs=mtime, Mods=SKIP", "Logs/*.txt,Logs/Archive/*,Playerdata/*.bak")
+	if err != nil {
+		t.Fatalf("ParseSyncPolicies() failed: %v", err)
+	}
+	want := map[string]SyncPolicy{
+		"Logs":       {Mode: SyncMtime, Exclude: []string{"*.txt", "Archive/*"}},
+		"Mods":       {Mode: SyncSkip},
+		"Playerdata": {Exclude: []string{"*.bak"}},
+	}
+	if !reflect.DeepEqual(policies, want) {
+		t.Errorf("ParseSyncPolicies() = %+v, want %+v", policies, want)
+	}
+
+	if policies, err := ParseSyncPolicies("", ""); err != nil || len(policies) != 0 {
+		t.Errorf("ParseSyncPolicies() of nothing = %v, %v", policies, err)
+	}
+
+	for _, tc := range []struct{ modes, exclude string }{
+		{"Logs", ""},
+		{"Logs=fast", ""},
+		{"Saves=skip", ""},
+		{"", "*.txt"},
+		{"", "Logs/"},
+		{"", "Cache/*.txt"},
+		{"", "Logs/[a"},
+	} {
+		if _, err := ParseSyncPolicies(tc.modes, tc.exclude); err == nil {
+			t.Errorf("ParseSyncPolicies(%q, %q) expected an error", tc.modes, tc.exclude)
+		}
+	}
+}
+
+func TestSyncPolicy_Excluded(t *testing.T) {
+	policy := SyncPolicy{Exclude: []string{"*.txt", "Archive/*.log"}}
+	for rel, want := range map[string]bool{
+		"notes.txt":                            true,
+		filepath.Join("a", "b.txt"):            true,
+		filepath.Join("Archive", "x.log"):      true,
+		"server-main.log":                      false,
+		filepath.Join("a", "Archive", "x.log"): false,
+	} {
+		if got := policy.excluded(rel); got != want {
+			t.Errorf("excluded(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
+
+func TestManager_SyncLiveFiles_Policies(t *testing.T) {
+	gameDataDir := t.TempDir()
+	stagingDir := t.TempDir()
+	for _, file := range []string{
+		filepath.Join("Logs", "server-main.log"),
+		filepath.Join("Logs", "debug.txt"),
+		filepath.Join("Mods", "mod.zip"),
+		filepath.Join("Playerdata", "playerdata.json"),
+	} {
+		writeTestLog(t, filepath.Join(gameDataDir, file), "data")
+	}
+	// Left from a backup before Mods was skipped
+	writeTestLog(t, filepath.Join(stagingDir, "Mods", "old.zip"), "data")
+
+	m := &Manager{
+		GameDataDir: gameDataDir,
+		StagingDir:  stagingDir,
+		SyncPolicies: map[string]SyncPolicy{
+			"Logs": {Mode: SyncMtime, Exclude: []string{"*.txt"}},
+			"Mods": {Mode: SyncSkip},
+		},
+	}
+	if err := m.syncLiveFiles(); err != nil {
+		t.Fatalf("syncLiveFiles() failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(stagingDir, "Mods")); !os.IsNotExist(err) {
+		t.Error("skipped Mods is still staged")
+	}
+	if _, err := os.Stat(filepath.Join(stagingDir, "Logs", "debug.txt")); !os.IsNotExist(err) {
+		t.Error("excluded log was staged")
+	}
+	if _, err := os.Stat(filepath.Join(stagingDir, "Playerdata", "playerdata.json")); err != nil {
+		t.Errorf("Playerdata wasn't staged: %v", err)
+	}
+	src, _ := os.Stat(filepath.Join(gameDataDir, "Logs", "server-main.log"))
+	dst, err := os.Stat(filepath.Join(stagingDir, "Logs", "server-main.log"))
+	if err != nil || !dst.ModTime().Equal(src.ModTime()) {
+		t.Errorf("mtime-synced log = %v, %v, want the source's modification time %v", dst, err, src.ModTime())
+	}
+
+	// A skipped directory is deliberately not backed up
+	uncovered, err := m.UncoveredPaths()
+	if err != nil || len(uncovered) != 0 {
+		t.Errorf("UncoveredPaths() = %v, %v, want none", uncovered, err)
+	}
+}
+
+func TestManager_SyncLogs_CompressedExcluded(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "Logs")
+	dstDir := filepath.Join(t.TempDir(), "Logs")
+	writeTestLog(t, filepath.Join(srcDir, "server-main.log"), "live main log")
+	writeTestLog(t, filepath.Join(srcDir, "Archive", "server-debug.log"), "archived debug log")
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(srcDir, "server-main.log"), past, past)
+
+	m := &Manager{CompressLogs: true}
+	policy := SyncPolicy{Mode: SyncMtime, Exclude: []string{"Archive/*"}}
+	if _, err := m.syncLogs(srcDir, dstDir, policy); err != nil {
+		t.Fatalf("syncLogs failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "Archive", "server-debug.log.gz")); !os.IsNotExist(err) {
+		t.Error("excluded log was staged")
+	}
+	if info, err := os.Stat(filepath.Join(dstDir, "server-main.log")); err != nil || !info.ModTime().Equal(past) {
+		t.Errorf("live log = %v, %v, want it copied with its modification time", info, err)
+	}
+}
@@ -0,0 +1,104 @@
+package backup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeWindow is a daily window of local time, such as 02:00-06:00.
+// A window whose end is before its start wraps past midnight (e.g. 22:00-04:00).
+type TimeWindow struct {
+	// Start and End are local wall clock times, as offsets from midnight.
+	Start, End time.Duration
+}
+
+// ParseTimeWindow parses a window in the form "HH:MM-HH:MM".
+func ParseTimeWindow(s string) (*TimeWindow, error) {
+	startStr, endStr, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid time window %q: expected HH:MM-HH:MM", s)
+	}
+
+	start, err := parseClock(startStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time window %q: %w", s, err)
+	}
+	end, err := parseClock(endStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time window %q: %w", s, err)
+	}
+	if start == end {
+		return nil, fmt.Errorf("invalid time window %q: start and end are equal", s)
+	}
+
+	return &TimeWindow{Start: start, End: end}, nil
+}
+
+// parseClock parses "HH:MM" into an offset from midnight.
+func parseClock(s string) (time.Duration, error) {
+	hourStr, minStr, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q: expected HH:MM", s)
+	}
+
+	hour, err := strconv.Atoi(hourStr)
+	if err != nil || hour < 0 || hour > 24 {
+		return 0, fmt.Errorf("invalid hour in %q", s)
+	}
+	minute, err := strconv.Atoi(minStr)
+	if err != nil || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid minute in %q", s)
+	}
+
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+// Contains reports whether t falls inside the window. A nil window contains all times.
+func (w *TimeWindow) Contains(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	_, ok := w.openedAt(t)
+	return ok
+}
+
+// openedAt returns when the window occurrence containing t opened, and
+// whether t is inside the window at all. Times are compared by their wall
+// clock, so a window keeps its local hours on days with a DST change.
+func (w *TimeWindow) openedAt(t time.Time) (time.Time, bool) {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+
+	if w.Start < w.End {
+		if offset >= w.Start && offset < w.End {
+			return w.startOn(t, 0), true
+		}
+		return time.Time{}, false
+	}
+
+	// Wraps past midnight
+	if offset >= w.Start {
+		return w.startOn(t, 0), true
+	}
+	if offset < w.End {
+		return w.startOn(t, -1), true
+	}
+	return time.Time{}, false
+}
+
+// startOn returns when the window opens on the local day of t, moved by days.
+func (w *TimeWindow) startOn(t time.Time, days int) time.Time {
+	hour := int(w.Start / time.Hour)
+	minute := int(w.Start % time.Hour / time.Minute)
+	return time.Date(t.Year(), t.Month(), t.Day()+days, hour, minute, 0, 0, t.Location())
+}
+
+// String formats the window as "HH:MM-HH:MM".
+func (w *TimeWindow) String() string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return clock(w.Start) + "-" + clock(w.End)
+}
@@ -0,0 +1,145 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+// clockOffset returns t's wall clock time as an offset from midnight,
+// truncated to the minute.
+func clockOffset(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+// windowAround returns a two-hour window centred on t.
+func windowAround(t time.Time) *TimeWindow {
+	return &TimeWindow{
+		Start: clockOffset(t.Add(-time.Hour)),
+		End:   clockOffset(t.Add(time.Hour)),
+	}
+}
+
+// windowAwayFrom returns a one-minute window starting two hours after t.
+func windowAwayFrom(t time.Time) *TimeWindow {
+	start := clockOffset(t.Add(2 * time.Hour))
+	return &TimeWindow{Start: start, End: start + time.Minute}
+}
+
+func TestParseTimeWindow(t *testing.T) {
+	tests := []struct {
+		input     string
+		wantStart time.Duration
+		wantEnd   time.Duration
+		expectErr bool
+	}{
+		{input: "02:00-06:00", wantStart: 2 * time.Hour, wantEnd: 6 * time.Hour},
+		{input: " 22:30 - 04:15 ", wantStart: 22*time.Hour + 30*time.Minute, wantEnd: 4*time.Hour + 15*time.Minute},
+		{input: "00:00-24:00", wantStart: 0, wantEnd: 24 * time.Hour},
+		{input: "02:00", expectErr: true},
+		{input: "02:00-02:00", expectErr: true},
+		{input: "25:00-02:00", expectErr: true},
+		{input: "02:60-03:00", expectErr: true},
+		{input: "24:30-03:00", expectErr: true},
+		{input: "2am-6am", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			w, err := ParseTimeWindow(tt.input)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("ParseTimeWindow(%q) expected error, got %v", tt.input, w)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTimeWindow(%q) unexpected error: %v", tt.input, err)
+			}
+			if w.Start != tt.wantStart || w.End != tt.wantEnd {
+				t.Errorf("ParseTimeWindow(%q) = %v-%v, want %v-%v", tt.input, w.Start, w.End, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestTimeWindow_Contains(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 10, hour, minute, 0, 0, time.Local)
+	}
+
+	day, _ := ParseTimeWindow("02:00-06:00")
+	night, _ := ParseTimeWindow("22:00-04:00")
+
+	tests := []struct {
+		name   string
+		window *TimeWindow
+		t      time.Time
+		want   bool
+	}{
+		{"nil window", nil, at(12, 0), true},
+		{"at start", day, at(2, 0), true},
+		{"inside", day, at(5, 59), true},
+		{"at end", day, at(6, 0), false},
+		{"before", day, at(1, 59), false},
+		{"wrap evening", night, at(23, 0), true},
+		{"wrap morning", night, at(3, 30), true},
+		{"wrap outside", night, at(12, 0), false},
+		{"wrap at end", night, at(4, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.Contains(tt.t); got != tt.want {
+				t.Errorf("Contains(%v) = %v, want %v", tt.t.Format("15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeWindow_OpenedAt(t *testing.T) {
+	night, _ := ParseTimeWindow("22:00-04:00")
+
+	// After midnight, the window opened the previous evening
+	opened, ok := night.openedAt(time.Date(2024, 3, 10, 3, 0, 0, 0, time.Local))
+	if !ok || !opened.Equal(time.Date(2024, 3, 9, 22, 0, 0, 0, time.Local)) {
+		t.Errorf("openedAt(03:00) = %v, %v; want 2024-03-09 22:00", opened, ok)
+	}
+
+	opened, ok = night.openedAt(time.Date(2024, 3, 10, 23, 0, 0, 0, time.Local))
+	if !ok || !opened.Equal(time.Date(2024, 3, 10, 22, 0, 0, 0, time.Local)) {
+		t.Errorf("openedAt(23:00) = %v, %v; want 2024-03-10 22:00", opened, ok)
+	}
+
+	if _, ok := night.openedAt(time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)); ok {
+		t.Error("openedAt(12:00) reported inside the window")
+	}
+
+	if got := night.String(); got != "22:00-04:00" {
+		t.Errorf("String() = %q, want %q", got, "22:00-04:00")
+	}
+}
+
+func TestTimeWindow_DaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	early, _ := ParseTimeWindow("04:00-06:00")
+
+	// Clocks went forward at 02:00 on 2024-03-10, so the day is 23 hours long
+	at := time.Date(2024, 3, 10, 4, 30, 0, 0, loc)
+	opened, ok := early.openedAt(at)
+	if !ok || !opened.Equal(time.Date(2024, 3, 10, 4, 0, 0, 0, loc)) {
+		t.Errorf("openedAt(04:30) = %v, %v; want 2024-03-10 04:00 local", opened, ok)
+	}
+	if early.Contains(time.Date(2024, 3, 10, 6, 30, 0, 0, loc)) {
+		t.Error("Contains(06:30) = true on the day clocks went forward")
+	}
+
+	// Clocks went back at 02:00 on 2024-11-03, so the day is 25 hours long
+	night, _ := ParseTimeWindow("22:00-04:00")
+	opened, ok = night.openedAt(time.Date(2024, 11, 3, 3, 0, 0, 0, loc))
+	if !ok || !opened.Equal(time.Date(2024, 11, 2, 22, 0, 0, 0, loc)) {
+		t.Errorf("openedAt(03:00) = %v, %v; want 2024-11-02 22:00 local", opened, ok)
+	}
+}
@@ -0,0 +1,56 @@
+// Package clock abstracts the passage of time, so code that schedules work
+// can be tested with a Fake clock instead of waiting for real time to pass.
+package clock
+
+import "time"
+
+// Clock tells the time and waits for it.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTicker returns a Ticker that ticks every d. d must be positive.
+	NewTicker(d time.Duration) Ticker
+
+	// After returns a channel that receives the time once d has passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// Ticker delivers ticks at intervals, like time.Ticker.
+type Ticker interface {
+	// C returns the channel ticks are delivered on.
+	C() <-chan time.Time
+
+	// Reset stops the ticker and makes it tick every d from now.
+	Reset(d time.Duration)
+
+	// Stop turns the ticker off.
+	Stop()
+}
+
+// Real is the Clock of the time package.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+
+func (t realTicker) Reset(d time.Duration) { t.t.Reset(d) }
+
+func (t realTicker) Stop() { t.t.Stop() }
+
+// Or returns c, or Real if c is nil.
+func Or(c Clock) Clock {
+	if c != nil {
+		return c
+	}
+	return Real
+}
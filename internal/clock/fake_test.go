@@ -0,0 +1,101 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// received returns the value waiting on ch, if any.
+func received(ch <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-ch:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFake_After(t *testing.T) {
+	f := NewFake(epoch)
+	ch := f.After(time.Minute)
+
+	f.Advance(59 * time.Second)
+	if _, ok := received(ch); ok {
+		t.Fatal("After fired early")
+	}
+	f.Advance(2 * time.Second)
+	if got, ok := received(ch); !ok || !got.Equal(epoch.Add(time.Minute)) {
+		t.Errorf("After delivered %v, %v, want %v", got, ok, epoch.Add(time.Minute))
+	}
+	if got := f.Now(); !got.Equal(epoch.Add(61 * time.Second)) {
+		t.Errorf("Now() = %v, want %v", got, epoch.Add(61*time.Second))
+	}
+
+	if _, ok := received(f.After(0)); !ok {
+		t.Error("After(0) should fire at once")
+	}
+}
+
+func TestFake_Ticker(t *testing.T) {
+	f := NewFake(epoch)
+	ticker := f.NewTicker(time.Minute)
+
+	f.Advance(time.Minute)
+	if got, ok := received(ticker.C()); !ok || !got.Equal(epoch.Add(time.Minute)) {
+		t.Fatalf("tick = %v, %v, want %v", got, ok, epoch.Add(time.Minute))
+	}
+
+	// Ticks nobody received are dropped, as with time.Ticker
+	f.Advance(3 * time.Minute)
+	if _, ok := received(ticker.C()); !ok {
+		t.Fatal("expected a tick")
+	}
+	if _, ok := received(ticker.C()); ok {
+		t.Error("missed ticks should be dropped")
+	}
+
+	ticker.Reset(time.Hour)
+	f.Advance(time.Minute)
+	if _, ok := received(ticker.C()); ok {
+		t.Error("ticked at the old interval after Reset")
+	}
+	f.Advance(time.Hour)
+	if _, ok := received(ticker.C()); !ok {
+		t.Error("expected a tick at the new interval")
+	}
+
+	ticker.Stop()
+	f.Advance(2 * time.Hour)
+	if _, ok := received(ticker.C()); ok {
+		t.Error("ticked after Stop")
+	}
+}
+
+func TestFake_BlockUntil(t *testing.T) {
+	f := NewFake(epoch)
+	done := make(chan struct{})
+	go func() {
+		<-f.After(time.Second)
+		close(done)
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Second)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter wasn't woken by Advance")
+	}
+}
+
+func TestOr(t *testing.T) {
+	if Or(nil) != Real {
+		t.Error("Or(nil) should be Real")
+	}
+	f := NewFake(epoch)
+	if Or(f) != f {
+		t.Error("Or(f) should be f")
+	}
+}
@@ -0,0 +1,88 @@
+package console
+
+import (
+	"sort"
+	"strings"
+)
+
+// keyTab is the key code passed to the completion callback for the Tab key.
+const keyTab = '\t'
+
+// CommonCommands is the list of Vintage Story server commands offered for tab-completion.
+var CommonCommands = []string{
+	"/announce",
+	"/ban",
+	"/entity",
+	"/gamemode",
+	"/genbackup",
+	"/giveitem",
+	"/help",
+	"/kick",
+	"/list",
+	"/op",
+	"/player",
+	"/privilege",
+	"/role",
+	"/serverconfig",
+	"/setspawn",
+	"/stats",
+	"/stop",
+	"/time",
+	"/tp",
+	"/unban",
+	"/whitelist",
+	"/worldconfig",
+}
+
+// Complete implements tab-completion of the first word of a command line.
+// It has the signature of term.Terminal's AutoCompleteCallback.
+//
+// If exactly one command matches the typed prefix, it is completed followed by
+// a space. If several match, the line is extended to their longest common prefix.
+func Complete(line string, pos int, key rune) (newLine string, newPos int, ok bool) {
+	if key != keyTab {
+		return "", 0, false
+	}
+
+	// Only complete the command name itself, with the cursor at its end
+	prefix := line[:pos]
+	if strings.ContainsRune(prefix, ' ') {
+		return "", 0, false
+	}
+
+	var matches []string
+	for _, cmd := range CommonCommands {
+		if strings.HasPrefix(cmd, prefix) {
+			matches = append(matches, cmd)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", 0, false
+	case 1:
+		completed := matches[0] + " "
+		return completed + line[pos:], len(completed), true
+	default:
+		sort.Strings(matches)
+		common := longestCommonPrefix(matches)
+		if len(common) <= len(prefix) {
+			return "", 0, false
+		}
+		return common + line[pos:], len(common), true
+	}
+}
+
+// longestCommonPrefix returns the longest prefix shared by all strings.
+func longestCommonPrefix(strs []string) string {
+	if len(strs) == 0 {
+		return ""
+	}
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,196 @@
+// Package console provides an interactive command line for the launcher when it
+// is attached to a TTY, with line editing, persistent history, and tab-completion
+// of common Vintage Story server commands.
+package console
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/term"
+)
+
+// DefaultPrompt is the prompt shown when no Prompt is configured.
+const DefaultPrompt = "> "
+
+// keyCtrlC is the byte a terminal in raw mode sends for Ctrl+C.
+const keyCtrlC = 3
+
+// IsInteractive returns true if stdin is attached to a terminal.
+func IsInteractive() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// Console is an interactive line editor attached to the process's terminal.
+//
+// While running, the terminal is in raw mode. Output written to the Console
+// is drawn above the prompt instead of clobbering the line being typed; the
+// caller routes the output it wants shown there through Write.
+type Console struct {
+	// Prompt is shown before each input line. Defaults to DefaultPrompt.
+	Prompt string
+
+	// HistoryPath is the file command history is persisted to.
+	// If empty, history is kept in memory only.
+	HistoryPath string
+
+	// Output is the terminal the console draws on. Writes go straight to it
+	// while the console isn't running. Defaults to os.Stdout.
+	Output io.Writer
+
+	// OnLine is called for each non-empty line entered.
+	OnLine func(line string)
+
+	// OnInterrupt is called when the user presses Ctrl+C. In raw mode this
+	// doesn't generate a signal, so the caller should treat it like SIGINT.
+	// Optional.
+	OnInterrupt func()
+
+	mu       sync.Mutex
+	started  bool
+	fd       int
+	oldState *term.State
+	terminal *term.Terminal
+	done     chan struct{}
+}
+
+// Start puts the terminal into raw mode and begins reading input lines.
+func (c *Console) Start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.started {
+		return errors.New("console already started")
+	}
+
+	if c.Prompt == "" {
+		c.Prompt = DefaultPrompt
+	}
+	if c.Output == nil {
+		c.Output = os.Stdout
+	}
+
+	history := &FileHistory{Path: c.HistoryPath}
+	if err := history.Load(); err != nil {
+		fmt.Fprintf(c.Output, "Warning: failed to load command history: %v\n", err)
+	}
+
+	c.fd = int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(c.fd)
+	if err != nil {
+		return fmt.Errorf("failed to set terminal raw mode: %w", err)
+	}
+	c.oldState = oldState
+
+	c.done = make(chan struct{})
+	input := &inputReader{r: os.Stdin, done: c.done}
+	c.terminal = term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{input, c.Output}, c.Prompt)
+	c.terminal.History = history
+	c.terminal.AutoCompleteCallback = Complete
+
+	c.started = true
+
+	go c.readLoop(c.terminal, input)
+
+	return nil
+}
+
+// Write draws p above the prompt while the console is running, and writes
+// it to Output otherwise.
+func (c *Console) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.started {
+		return c.terminal.Write(p)
+	}
+	if c.Output == nil {
+		return os.Stdout.Write(p)
+	}
+	return c.Output.Write(p)
+}
+
+// Stop restores the terminal and stops reading input. A read already
+// waiting for a key is abandoned; whatever it returns isn't dispatched.
+func (c *Console) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.started {
+		return
+	}
+	c.started = false
+
+	close(c.done)
+	term.Restore(c.fd, c.oldState)
+	fmt.Fprintln(c.Output)
+}
+
+// readLoop reads lines from the terminal until the console is stopped, the
+// user presses Ctrl+C, or input ends. Ctrl+D on an empty line ends input
+// like a closed stdin: the console stops, so Ctrl+C raises SIGINT again.
+func (c *Console) readLoop(terminal *term.Terminal, input *inputReader) {
+	for {
+		line, err := terminal.ReadLine()
+		select {
+		case <-input.done:
+			return
+		default:
+		}
+
+		if err != nil && !errors.Is(err, term.ErrPasteIndicator) {
+			if input.interrupted.Load() {
+				if c.OnInterrupt != nil {
+					c.OnInterrupt()
+				}
+				return
+			}
+			c.Stop()
+			fmt.Fprintln(c.Output, "Console input closed; server commands are no longer read.")
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		if line != "" && c.OnLine != nil {
+			c.OnLine(line)
+		}
+	}
+}
+
+// inputReader reads keys for the line editor. It notes Ctrl+C, which the
+// editor reports as io.EOF just like Ctrl+D, and reports io.EOF itself once
+// done is closed.
+type inputReader struct {
+	r           io.Reader
+	done        <-chan struct{}
+	interrupted atomic.Bool
+}
+
+// Read reads from r unless the console has been stopped.
+func (r *inputReader) Read(p []byte) (int, error) {
+	select {
+	case <-r.done:
+		return 0, io.EOF
+	default:
+	}
+
+	n, err := r.r.Read(p)
+	select {
+	case <-r.done:
+		return 0, io.EOF
+	default:
+	}
+	if bytes.IndexByte(p[:n], keyCtrlC) >= 0 {
+		r.interrupted.Store(true)
+	}
+	return n, err
+}
@@ -0,0 +1,151 @@
+package console
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileHistory_AddAndAt(t *testing.T) {
+	h := &FileHistory{}
+
+	h.Add("/time")
+	h.Add("/stats")
+	h.Add("/stats") // consecutive duplicate ignored
+	h.Add("")       // empty ignored
+
+	if h.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", h.Len())
+	}
+	if h.At(0) != "/stats" || h.At(1) != "/time" {
+		t.Errorf("At(0), At(1) = %q, %q; want /stats, /time", h.At(0), h.At(1))
+	}
+}
+
+func TestFileHistory_PersistsAndLoads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".launcher_history")
+
+	h := &FileHistory{Path: path}
+	h.Add("/list clients")
+	h.Add("/announce hello")
+
+	loaded := &FileHistory{Path: path}
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if loaded.Len() != 2 || loaded.At(0) != "/announce hello" {
+		t.Errorf("Loaded history = %d entries, most recent %q", loaded.Len(), loaded.At(0))
+	}
+}
+
+func TestFileHistory_Bounded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".launcher_history")
+
+	h := &FileHistory{Path: path, Size: 3}
+	for _, cmd := range []string{"a", "b", "c", "d", "e"} {
+		h.Add(cmd)
+	}
+
+	if h.Len() != 3 || h.At(2) != "c" {
+		t.Errorf("Expected 3 entries with oldest %q, got %d entries, oldest %q", "c", h.Len(), h.At(h.Len()-1))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read history file: %v", err)
+	}
+	if got := strings.Fields(string(data)); len(got) != 3 {
+		t.Errorf("History file should be trimmed to 3 entries, got %v", got)
+	}
+}
+
+func TestFileHistory_LoadMissingFile(t *testing.T) {
+	h := &FileHistory{Path: filepath.Join(t.TempDir(), "missing")}
+	if err := h.Load(); err != nil {
+		t.Errorf("Load() of missing file should not fail: %v", err)
+	}
+}
+
+func TestComplete_CommonPrefix(t *testing.T) {
+	orig := CommonCommands
+	defer func() { CommonCommands = orig }()
+	CommonCommands = []string{"/whitelist add", "/whitelist remove", "/worldconfig"}
+
+	line, pos, ok := Complete("/wh", 3, '\t')
+	if !ok || line != "/whitelist " || pos != 11 {
+		t.Errorf("Complete() = (%q, %d, %v), want (%q, 11, true)", line, pos, ok, "/whitelist ")
+	}
+}
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		pos      int
+		key      rune
+		wantLine string
+		wantPos  int
+		wantOk   bool
+	}{
+		{"unique match", "/genb", 5, '\t', "/genbackup ", 11, true},
+		{"no match", "/zzz", 4, '\t', "", 0, false},
+		{"not tab", "/genb", 5, 'a', "", 0, false},
+		{"arguments not completed", "/tp foo", 7, '\t', "", 0, false},
+		{"ambiguous without progress", "/", 1, '\t', "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, pos, ok := Complete(tt.line, tt.pos, tt.key)
+			if ok != tt.wantOk || line != tt.wantLine || pos != tt.wantPos {
+				t.Errorf("Complete(%q, %d) = (%q, %d, %v), want (%q, %d, %v)",
+					tt.line, tt.pos, line, pos, ok, tt.wantLine, tt.wantPos, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestConsole_WriteBeforeStart(t *testing.T) {
+	var out strings.Builder
+	c := &Console{Output: &out}
+
+	if _, err := c.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	if out.String() != "hello\n" {
+		t.Errorf("Output = %q, want the write passed through", out.String())
+	}
+	c.Stop() // Not started; must not block or panic
+}
+
+func TestInputReader_NotesCtrlC(t *testing.T) {
+	done := make(chan struct{})
+	r := &inputReader{r: strings.NewReader("ab\x04"), done: done}
+	buf := make([]byte, 16)
+	if _, err := r.Read(buf); err != nil {
+		t.Fatalf("Read() failed: %v", err)
+	}
+	if r.interrupted.Load() {
+		t.Error("Ctrl+D should not count as an interrupt")
+	}
+
+	r = &inputReader{r: strings.NewReader("\x03"), done: done}
+	if _, err := r.Read(buf); err != nil {
+		t.Fatalf("Read() failed: %v", err)
+	}
+	if !r.interrupted.Load() {
+		t.Error("Expected Ctrl+C to be noted")
+	}
+}
+
+func TestInputReader_EOFOnceStopped(t *testing.T) {
+	done := make(chan struct{})
+	r := &inputReader{r: strings.NewReader("/time\r"), done: done}
+	close(done)
+
+	if n, err := r.Read(make([]byte, 16)); n != 0 || err != io.EOF {
+		t.Errorf("Read() after stop = %d, %v; want 0, io.EOF", n, err)
+	}
+}
@@ -0,0 +1,137 @@
+package console
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// DefaultHistorySize is the maximum number of history entries kept.
+const DefaultHistorySize = 1000
+
+// FileHistory is a bounded command history that is persisted to a file.
+// It implements the term.History interface.
+type FileHistory struct {
+	// Path is the file the history is persisted to. If empty, history is kept in memory only.
+	Path string
+
+	// Size is the maximum number of entries kept. Defaults to DefaultHistorySize.
+	Size int
+
+	mu      sync.Mutex
+	entries []string // oldest first
+}
+
+// Load reads existing history entries from Path.
+// A missing history file is not an error.
+func (h *FileHistory) Load() error {
+	if h.Path == "" {
+		return nil
+	}
+
+	file, err := os.Open(h.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	h.trim()
+
+	return scanner.Err()
+}
+
+// Add appends an entry to the history and persists it.
+// Consecutive duplicates are ignored.
+func (h *FileHistory) Add(entry string) {
+	if entry == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if n := len(h.entries); n > 0 && h.entries[n-1] == entry {
+		return
+	}
+
+	h.entries = append(h.entries, entry)
+	if h.trim() {
+		h.rewrite()
+	} else {
+		h.appendToFile(entry)
+	}
+}
+
+// Len returns the number of entries in the history.
+func (h *FileHistory) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.entries)
+}
+
+// At returns an entry from the history. Index 0 is the most recent entry.
+func (h *FileHistory) At(idx int) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.entries[len(h.entries)-1-idx]
+}
+
+// trim drops the oldest entries beyond Size. Returns true if anything was dropped.
+// Must be called with mu held.
+func (h *FileHistory) trim() bool {
+	size := h.Size
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	if len(h.entries) <= size {
+		return false
+	}
+	h.entries = append([]string(nil), h.entries[len(h.entries)-size:]...)
+	return true
+}
+
+// appendToFile appends a single entry to the history file.
+// Errors are ignored since history is a convenience. Must be called with mu held.
+func (h *FileHistory) appendToFile(entry string) {
+	if h.Path == "" {
+		return
+	}
+	file, err := os.OpenFile(h.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, entry)
+}
+
+// rewrite replaces the history file with the current entries.
+// Errors are ignored since history is a convenience. Must be called with mu held.
+func (h *FileHistory) rewrite() {
+	if h.Path == "" {
+		return
+	}
+	file, err := os.OpenFile(h.Path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	for _, entry := range h.entries {
+		fmt.Fprintln(w, entry)
+	}
+	w.Flush()
+}
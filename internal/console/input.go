@@ -0,0 +1,57 @@
+package console
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// Input describes what the process's stdin is connected to.
+type Input int
+
+const (
+	// InputNone means stdin is closed or the null device, as under systemd
+	// or docker run without -i. Nothing can ever be read from it.
+	InputNone Input = iota
+
+	// InputPipe means stdin is a pipe, file, or socket, read line by line.
+	InputPipe
+
+	// InputTerminal means stdin is a terminal, for the interactive Console.
+	InputTerminal
+)
+
+// String describes the input for log messages.
+func (i Input) String() string {
+	switch i {
+	case InputTerminal:
+		return "interactive console"
+	case InputPipe:
+		return "stdin"
+	default:
+		return "none"
+	}
+}
+
+// DetectInput reports what stdin is connected to.
+func DetectInput() Input {
+	return detectInput(os.Stdin)
+}
+
+// detectInput reports what f is connected to.
+func detectInput(f *os.File) Input {
+	if f == nil {
+		return InputNone
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return InputNone // Closed or invalid descriptor
+	}
+	if term.IsTerminal(int(f.Fd())) {
+		return InputTerminal
+	}
+	if devNull, err := os.Stat(os.DevNull); err == nil && os.SameFile(info, devNull) {
+		return InputNone
+	}
+	return InputPipe
+}
@@ -0,0 +1,43 @@
+package console
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectInput(t *testing.T) {
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	if got := detectInput(devNull); got != InputNone {
+		t.Errorf("detectInput(%s) = %v, want none", os.DevNull, got)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if got := detectInput(r); got != InputPipe {
+		t.Errorf("detectInput(pipe) = %v, want stdin", got)
+	}
+
+	r.Close()
+	if got := detectInput(r); got != InputNone {
+		t.Errorf("detectInput(closed pipe) = %v, want none", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "commands")
+	os.WriteFile(path, []byte("/help\n"), 0644)
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got := detectInput(f); got != InputPipe {
+		t.Errorf("detectInput(file) = %v, want stdin", got)
+	}
+}
@@ -0,0 +1,187 @@
+// Package diagnostics provides optional profiling and runtime statistics for
+// diagnosing performance issues in production containers without rebuilding.
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DefaultPprofPort is the port the pprof server listens on if none is configured.
+const DefaultPprofPort = 6060
+
+// PprofServer serves the net/http/pprof endpoints on the loopback interface only,
+// so profiles are reachable via `docker exec` but never exposed to the network.
+type PprofServer struct {
+	// Port is the loopback port to listen on. Defaults to DefaultPprofPort.
+	Port int
+
+	mu       sync.Mutex
+	server   *http.Server
+	listener net.Listener
+}
+
+// Start begins serving pprof endpoints in a background goroutine.
+func (p *PprofServer) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.server != nil {
+		return errors.New("pprof server already started")
+	}
+
+	port := p.Port
+	if port == 0 {
+		port = DefaultPprofPort
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen for pprof: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	p.listener = listener
+	p.server = &http.Server{Handler: mux}
+
+	go p.server.Serve(listener)
+
+	return nil
+}
+
+// Addr returns the address the server is listening on, or "" if not started.
+func (p *PprofServer) Addr() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.listener == nil {
+		return ""
+	}
+	return p.listener.Addr().String()
+}
+
+// Stop shuts down the pprof server.
+func (p *PprofServer) Stop() {
+	p.mu.Lock()
+	server := p.server
+	p.mu.Unlock()
+
+	if server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+}
+
+// RuntimeStats is a snapshot of Go runtime statistics.
+type RuntimeStats struct {
+	HeapAlloc    uint64
+	HeapSys      uint64
+	NumGC        uint32
+	NumGoroutine int
+}
+
+// ReadRuntimeStats captures the current runtime statistics.
+func ReadRuntimeStats() RuntimeStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return RuntimeStats{
+		HeapAlloc:    ms.HeapAlloc,
+		HeapSys:      ms.HeapSys,
+		NumGC:        ms.NumGC,
+		NumGoroutine: runtime.NumGoroutine(),
+	}
+}
+
+// String formats the stats for logging.
+func (s RuntimeStats) String() string {
+	return fmt.Sprintf("heap=%.1fMiB heap_sys=%.1fMiB gc=%d goroutines=%d",
+		float64(s.HeapAlloc)/(1<<20), float64(s.HeapSys)/(1<<20), s.NumGC, s.NumGoroutine)
+}
+
+// StatsLogger periodically logs runtime statistics.
+type StatsLogger struct {
+	// Interval is the time between log lines.
+	Interval time.Duration
+
+	// Logf is called with each formatted stats line. Defaults to printing to stdout.
+	Logf func(format string, args ...any)
+
+	mu      sync.Mutex
+	started bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// Start begins logging in a background goroutine.
+func (l *StatsLogger) Start() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.started {
+		return errors.New("stats logger already started")
+	}
+
+	if l.Interval <= 0 {
+		return errors.New("stats interval must be positive")
+	}
+
+	if l.Logf == nil {
+		l.Logf = func(format string, args ...any) {
+			fmt.Printf(format+"\n", args...)
+		}
+	}
+
+	l.done = make(chan struct{})
+	l.started = true
+
+	l.wg.Add(1)
+	go l.logLoop()
+
+	return nil
+}
+
+// Stop stops logging and waits for the background goroutine to exit.
+func (l *StatsLogger) Stop() {
+	l.mu.Lock()
+	if !l.started {
+		l.mu.Unlock()
+		return
+	}
+	l.started = false
+	l.mu.Unlock()
+
+	close(l.done)
+	l.wg.Wait()
+}
+
+// logLoop logs stats on every tick until stopped.
+func (l *StatsLogger) logLoop() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.Logf("Runtime stats: %s", ReadRuntimeStats())
+		}
+	}
+}
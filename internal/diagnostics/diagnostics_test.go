@@ -0,0 +1,102 @@
+package diagnostics
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPprofServer_ServesIndexOnLoopback(t *testing.T) {
+	p := &PprofServer{Port: freePort(t)}
+	if err := p.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer p.Stop()
+
+	if !strings.HasPrefix(p.Addr(), "127.0.0.1:") {
+		t.Errorf("pprof should listen on loopback, got %s", p.Addr())
+	}
+
+	resp, err := http.Get("http://" + p.Addr() + "/debug/pprof/")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "goroutine") {
+		t.Errorf("Unexpected pprof index response: %d %s", resp.StatusCode, body)
+	}
+
+	if err := p.Start(); err == nil {
+		t.Error("Second Start should return an error")
+	}
+}
+
+func TestPprofServer_StopBeforeStart(t *testing.T) {
+	p := &PprofServer{}
+	p.Stop() // Should not panic
+	if p.Addr() != "" {
+		t.Errorf("Addr() before Start = %q, want empty", p.Addr())
+	}
+}
+
+func TestReadRuntimeStats(t *testing.T) {
+	stats := ReadRuntimeStats()
+	if stats.NumGoroutine < 1 || stats.HeapSys == 0 {
+		t.Errorf("Unexpected runtime stats: %+v", stats)
+	}
+	if s := stats.String(); !strings.Contains(s, "goroutines=") {
+		t.Errorf("String() = %q, expected goroutine count", s)
+	}
+}
+
+func TestStatsLogger_LogsPeriodically(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+
+	l := &StatsLogger{
+		Interval: 20 * time.Millisecond,
+		Logf: func(format string, args ...any) {
+			mu.Lock()
+			lines = append(lines, fmt.Sprintf(format, args...))
+			mu.Unlock()
+		},
+	}
+	if err := l.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	l.Stop()
+	l.Stop() // Double stop is safe
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "Runtime stats: heap=") {
+		t.Errorf("Expected runtime stats lines, got %v", lines)
+	}
+}
+
+func TestStatsLogger_RequiresInterval(t *testing.T) {
+	l := &StatsLogger{}
+	if err := l.Start(); err == nil {
+		t.Error("Start with zero interval should fail")
+	}
+}
+
+// freePort returns a loopback port that is currently free.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
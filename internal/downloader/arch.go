@@ -0,0 +1,170 @@
+package downloader
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/pe"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// archPlaceholder is replaced in VS_SERVER_TARGZ_URL with the host architecture
+// as Vintage Story names it in its archive filenames (e.g. "x64", "arm64").
+const archPlaceholder = "{arch}"
+
+// hostArch is the architecture binaries are checked against.
+var hostArch = runtime.GOARCH
+
+// distArchNames maps GOARCH values to the names used in server archive filenames.
+var distArchNames = map[string]string{
+	"amd64": "x64",
+	"arm64": "arm64",
+	"arm":   "arm",
+	"386":   "x86",
+}
+
+// ResolveServerURL returns the server archive URL for goarch. A per-arch
+// variable such as VS_SERVER_TARGZ_URL_ARM64 takes precedence; otherwise
+// VS_SERVER_TARGZ_URL is used, with any {arch} placeholder filled in.
+func ResolveServerURL(goarch string, getenv func(string) string) (string, error) {
+	archVar := "VS_SERVER_TARGZ_URL_" + strings.ToUpper(goarch)
+	if url := getenv(archVar); url != "" {
+		return url, nil
+	}
+
+	url := getenv("VS_SERVER_TARGZ_URL")
+	if url == "" {
+		return "", fmt.Errorf("VS_SERVER_TARGZ_URL environment variable is not set")
+	}
+
+	if strings.Contains(url, archPlaceholder) {
+		name, ok := distArchNames[goarch]
+		if !ok {
+			return "", fmt.Errorf("VS_SERVER_TARGZ_URL contains %s but architecture %s has no known archive name; set %s instead", archPlaceholder, goarch, archVar)
+		}
+		url = strings.ReplaceAll(url, archPlaceholder, name)
+	}
+
+	return url, nil
+}
+
+// elfMachines maps GOARCH values to the ELF machine types that can run on them.
+var elfMachines = map[string]elf.Machine{
+	"amd64": elf.EM_X86_64,
+	"arm64": elf.EM_AARCH64,
+	"arm":   elf.EM_ARM,
+	"386":   elf.EM_386,
+}
+
+// peMachines maps GOARCH values to the PE machine types that can run on them.
+var peMachines = map[string]uint16{
+	"amd64": pe.IMAGE_FILE_MACHINE_AMD64,
+	"arm64": pe.IMAGE_FILE_MACHINE_ARM64,
+	"386":   pe.IMAGE_FILE_MACHINE_I386,
+}
+
+// verifyArchitecture checks that the native executables and libraries at the
+// top level of dir were built for goarch. Managed .NET assemblies are
+// architecture-neutral and skipped; subdirectories are not checked, since
+// .NET packages keep natives for other platforms under runtimes/.
+func verifyArchitecture(dir, goarch string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read server directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+
+		machine, ok, err := nativeMachine(path)
+		if err != nil {
+			return fmt.Errorf("failed to inspect %s: %w", entry.Name(), err)
+		}
+		if !ok {
+			continue
+		}
+
+		if !machineMatches(machine, goarch) {
+			return fmt.Errorf("%s is built for %s, but this host is %s; set VS_SERVER_TARGZ_URL_%s to the server archive for this architecture",
+				entry.Name(), machine, goarch, strings.ToUpper(goarch))
+		}
+	}
+
+	return nil
+}
+
+// nativeMachine returns the machine type of a native ELF or PE executable.
+// The bool is false for anything else, including managed .NET assemblies.
+func nativeMachine(path string) (fmt.Stringer, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return nil, false, nil // Too short to be an executable
+	}
+
+	switch {
+	case bytes.Equal(magic, []byte(elf.ELFMAG)):
+		ef, err := elf.NewFile(f)
+		if err != nil {
+			return nil, false, nil // Not a well-formed ELF file; leave it alone
+		}
+		return ef.Machine, true, nil
+
+	case bytes.HasPrefix(magic, []byte("MZ")) && strings.EqualFold(filepath.Ext(path), ".exe"):
+		pf, err := pe.NewFile(f)
+		if err != nil {
+			return nil, false, nil
+		}
+		if pf.OptionalHeader != nil && isManaged(pf) {
+			return nil, false, nil
+		}
+		return peMachine(pf.Machine), true, nil
+	}
+
+	return nil, false, nil
+}
+
+// isManaged reports whether a PE file is a .NET assembly, which has a CLR header.
+func isManaged(f *pe.File) bool {
+	const clrHeaderIndex = pe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return oh.NumberOfRvaAndSizes > clrHeaderIndex && oh.DataDirectory[clrHeaderIndex].VirtualAddress != 0
+	case *pe.OptionalHeader64:
+		return oh.NumberOfRvaAndSizes > clrHeaderIndex && oh.DataDirectory[clrHeaderIndex].VirtualAddress != 0
+	}
+	return false
+}
+
+// peMachine is a PE machine type that prints as hex.
+type peMachine uint16
+
+func (m peMachine) String() string {
+	return fmt.Sprintf("PE machine 0x%04x", uint16(m))
+}
+
+// machineMatches reports whether machine can run natively on goarch.
+// Unknown architectures are not checked.
+func machineMatches(machine fmt.Stringer, goarch string) bool {
+	switch m := machine.(type) {
+	case elf.Machine:
+		want, ok := elfMachines[goarch]
+		return !ok || m == want
+	case peMachine:
+		want, ok := peMachines[goarch]
+		return !ok || uint16(m) == want
+	}
+	return true
+}
@@ -0,0 +1,190 @@
+package downloader
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestResolveServerURL(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(key string) string { return vars[key] }
+	}
+
+	t.Run("plain url", func(t *testing.T) {
+		url, err := ResolveServerURL("amd64", env(map[string]string{
+			"VS_SERVER_TARGZ_URL": "https://example.com/vs_server_linux-x64.tar.gz",
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if url != "https://example.com/vs_server_linux-x64.tar.gz" {
+			t.Errorf("got %q", url)
+		}
+	})
+
+	t.Run("arch placeholder", func(t *testing.T) {
+		vars := map[string]string{"VS_SERVER_TARGZ_URL": "https://example.com/vs_server_linux-{arch}_1.21.6.tar.gz"}
+		for goarch, want := range map[string]string{
+			"amd64": "https://example.com/vs_server_linux-x64_1.21.6.tar.gz",
+			"arm64": "https://example.com/vs_server_linux-arm64_1.21.6.tar.gz",
+		} {
+			url, err := ResolveServerURL(goarch, env(vars))
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", goarch, err)
+			}
+			if url != want {
+				t.Errorf("%s: got %q, want %q", goarch, url, want)
+			}
+		}
+	})
+
+	t.Run("per-arch variable takes precedence", func(t *testing.T) {
+		url, err := ResolveServerURL("arm64", env(map[string]string{
+			"VS_SERVER_TARGZ_URL":       "https://example.com/x64.tar.gz",
+			"VS_SERVER_TARGZ_URL_ARM64": "https://example.com/arm64.tar.gz",
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if url != "https://example.com/arm64.tar.gz" {
+			t.Errorf("got %q", url)
+		}
+	})
+
+	t.Run("per-arch variable for another arch is ignored", func(t *testing.T) {
+		url, err := ResolveServerURL("amd64", env(map[string]string{
+			"VS_SERVER_TARGZ_URL":       "https://example.com/x64.tar.gz",
+			"VS_SERVER_TARGZ_URL_ARM64": "https://example.com/arm64.tar.gz",
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if url != "https://example.com/x64.tar.gz" {
+			t.Errorf("got %q", url)
+		}
+	})
+
+	t.Run("unset", func(t *testing.T) {
+		if _, err := ResolveServerURL("amd64", env(nil)); err == nil {
+			t.Error("expected error when no URL is set")
+		}
+	})
+
+	t.Run("placeholder with unknown arch", func(t *testing.T) {
+		_, err := ResolveServerURL("riscv64", env(map[string]string{
+			"VS_SERVER_TARGZ_URL": "https://example.com/{arch}.tar.gz",
+		}))
+		if err == nil || !strings.Contains(err.Error(), "VS_SERVER_TARGZ_URL_RISCV64") {
+			t.Errorf("expected error naming the per-arch variable, got %v", err)
+		}
+	})
+}
+
+// copyTestBinary copies the running test binary, a native executable for the
+// host, into dir under name.
+func copyTestBinary(t *testing.T, dir, name string) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("test binary is only guaranteed to be ELF on linux")
+	}
+	if _, ok := elfMachines[runtime.GOARCH]; !ok {
+		t.Skipf("no ELF machine known for %s", runtime.GOARCH)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failed to find test binary: %v", err)
+	}
+	src, err := os.Open(exe)
+	if err != nil {
+		t.Fatalf("failed to open test binary: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, src); err != nil {
+		t.Fatalf("failed to copy test binary: %v", err)
+	}
+}
+
+// otherArch returns an architecture with a different ELF machine than the host.
+func otherArch() string {
+	if runtime.GOARCH == "arm64" {
+		return "amd64"
+	}
+	return "arm64"
+}
+
+func TestVerifyArchitecture(t *testing.T) {
+	t.Run("matching binary", func(t *testing.T) {
+		dir := t.TempDir()
+		copyTestBinary(t, dir, "VintagestoryServer")
+
+		if err := verifyArchitecture(dir, runtime.GOARCH); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("mismatched binary", func(t *testing.T) {
+		dir := t.TempDir()
+		copyTestBinary(t, dir, "VintagestoryServer")
+
+		err := verifyArchitecture(dir, otherArch())
+		if err == nil {
+			t.Fatal("expected error for mismatched architecture")
+		}
+		if !strings.Contains(err.Error(), "VintagestoryServer") {
+			t.Errorf("error should name the offending file, got %v", err)
+		}
+	})
+
+	t.Run("non-executables ignored", func(t *testing.T) {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "VintagestoryServer.dll"), []byte("MZ not really a dll"), 0644)
+		os.WriteFile(filepath.Join(dir, "server.sh"), []byte("#!/bin/sh\n"), 0755)
+		os.WriteFile(filepath.Join(dir, "empty"), nil, 0644)
+		os.WriteFile(filepath.Join(dir, "bogus"), []byte("\x7fELF garbage"), 0644)
+
+		if err := verifyArchitecture(dir, otherArch()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("subdirectories ignored", func(t *testing.T) {
+		dir := t.TempDir()
+		runtimes := filepath.Join(dir, "runtimes", "linux-arm64", "native")
+		os.MkdirAll(runtimes, 0755)
+		copyTestBinary(t, runtimes, "libfoo.so")
+
+		if err := verifyArchitecture(dir, otherArch()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestCheckArchitecture_RemovesVersionInfo(t *testing.T) {
+	dir := t.TempDir()
+	copyTestBinary(t, dir, "VintagestoryServer")
+	if err := saveVersionInfo(dir, versionInfo{URL: "https://example.com/x.tar.gz", ETag: "abc"}); err != nil {
+		t.Fatalf("failed to save version info: %v", err)
+	}
+
+	orig := hostArch
+	hostArch = otherArch()
+	defer func() { hostArch = orig }()
+
+	if err := checkArchitecture(dir); err == nil {
+		t.Fatal("expected error for mismatched architecture")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "launcher-version.json")); !os.IsNotExist(err) {
+		t.Errorf("version info should be removed after a mismatch, stat err = %v", err)
+	}
+}
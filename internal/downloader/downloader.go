@@ -13,34 +13,148 @@ import (
 	"strings"
 )
 
-// downloadAndExtract downloads a tar.gz file from the given URL and extracts
-// it to the target directory. The extraction is done in a memory-efficient
-// streaming fashion, piping the HTTP response directly through gzip decompression
-// and tar extraction.
+// downloadAndExtract downloads the tar.gz archive at url and installs its
+// contents in targetDir, returning the number of files extracted. The
+// archive is downloaded to the update directory first, resuming a download
+// an earlier attempt left partway, and extracted there. Only once it has
+// been extracted completely and checked against the host architecture does
+// it replace the installed binaries (see installUpdate), so a failure at any
+// point before that leaves them as they were.
 func downloadAndExtract(ctx context.Context, url, targetDir string) (int, error) {
 	// Ensure target directory exists
 	if err := os.MkdirAll(targetDir, 0755); err != nil {
 		return 0, fmt.Errorf("failed to create target directory: %w", err)
 	}
+	work := filepath.Join(targetDir, updateDirName)
+	if err := os.MkdirAll(work, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create update directory: %w", err)
+	}
+
+	archivePath, etag, err := downloadArchive(ctx, url, work)
+	if err != nil {
+		return 0, err
+	}
+
+	extractDir := filepath.Join(work, extractDirName)
+	if err := os.RemoveAll(extractDir); err != nil {
+		return 0, fmt.Errorf("failed to clear %s: %w", extractDir, err)
+	}
+	extractedCount, err := extractArchive(archivePath, extractDir)
+	if err != nil {
+		// The archive was downloaded completely, so it is no use resuming
+		os.RemoveAll(work)
+		return extractedCount, err
+	}
+
+	// Save version info after successful extraction
+	if err := saveVersionInfo(extractDir, versionInfo{URL: url, ETag: etag}); err != nil {
+		return extractedCount, fmt.Errorf("failed to save version info: %w", err)
+	}
+	if err := verifyArchitecture(extractDir, hostArch); err != nil {
+		os.RemoveAll(work)
+		return extractedCount, fmt.Errorf("server binaries don't match the host architecture: %w", err)
+	}
+
+	if err := os.Rename(extractDir, filepath.Join(work, readyDirName)); err != nil {
+		return extractedCount, fmt.Errorf("failed to mark the extracted binaries ready: %w", err)
+	}
+	if err := installUpdate(targetDir); err != nil {
+		return extractedCount, err
+	}
+	return extractedCount, nil
+}
+
+// downloadArchive downloads the archive at url into work, returning its path
+// and ETag. A partial download of the same archive, as identified by its URL
+// and ETag, is resumed with a range request; if the server doesn't resume
+// it, the download starts over. A failed download leaves the partial file
+// for the next attempt.
+func downloadArchive(ctx context.Context, url, work string) (path, etag string, err error) {
+	partPath := filepath.Join(work, archivePartName)
+
+	// The partial download's version info records which archive it holds
+	var offset int64
+	partial, err := readVersionInfo(work)
+	if err == nil && partial != nil && partial.URL == url && partial.ETag != "" && !strings.HasPrefix(partial.ETag, "W/") {
+		if info, err := os.Stat(partPath); err == nil {
+			offset = info.Size()
+		}
+	}
 
 	// Download the file with context
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create request: %w", err)
+		return "", "", fmt.Errorf("failed to create request: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", "\""+partial.ETag+"\"")
 	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return 0, fmt.Errorf("failed to download file: %w", err)
+		return "", "", fmt.Errorf("failed to download file: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		offset = 0
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			os.Remove(partPath)
+			return "", "", fmt.Errorf("server resumed the download at the wrong offset: %s", resp.Header.Get("Content-Range"))
+		}
+		fmt.Printf("Resuming the download at %d bytes...\n", offset)
+	default:
+		return "", "", fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+	}
+
+	// Normalize ETag (remove quotes)
+	etag = strings.Trim(resp.Header.Get("ETag"), "\"")
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if offset == 0 {
+		// Recorded before any of the archive is written
+		if err := saveVersionInfo(work, versionInfo{URL: url, ETag: etag}); err != nil {
+			return "", "", fmt.Errorf("failed to save version info of the download: %w", err)
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
+	part, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create download file: %w", err)
+	}
+	if _, err := io.Copy(part, resp.Body); err != nil {
+		part.Close()
+		return "", "", fmt.Errorf("failed to download file: %w", err)
+	}
+	if err := part.Close(); err != nil {
+		return "", "", fmt.Errorf("failed to write download file: %w", err)
+	}
+
+	path = filepath.Join(work, archiveName)
+	if err := os.Rename(partPath, path); err != nil {
+		return "", "", fmt.Errorf("failed to move the downloaded archive into place: %w", err)
+	}
+	return path, etag, nil
+}
+
+// extractArchive extracts the tar.gz archive at archivePath into targetDir,
+// returning the number of files extracted.
+func extractArchive(archivePath, targetDir string) (int, error) {
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive: %w", err)
 	}
+	defer archive.Close()
 
 	// Create a gzip reader to decompress the stream
-	gzipReader, err := gzip.NewReader(resp.Body)
+	gzipReader, err := gzip.NewReader(archive)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create gzip reader: %w", err)
 	}
@@ -105,20 +219,6 @@ func downloadAndExtract(ctx context.Context, url, targetDir string) (int, error)
 		}
 	}
 
-	// Save version info after successful extraction
-	etag := resp.Header.Get("ETag")
-	versionInfo := versionInfo{
-		URL: url,
-	}
-	if etag != "" {
-		// Normalize ETag (remove quotes)
-		etag = strings.Trim(etag, "\"")
-		versionInfo.ETag = etag
-	}
-	if err := saveVersionInfo(targetDir, versionInfo); err != nil {
-		return extractedCount, fmt.Errorf("failed to save version info: %w", err)
-	}
-
 	return extractedCount, nil
 }
 
@@ -154,25 +254,6 @@ func extractSymlink(targetPath, linkname string) error {
 	return os.Symlink(linkname, targetPath)
 }
 
-// removeDirectoryContents removes all contents of a directory but keeps the directory itself.
-// This is useful when the directory was created with specific permissions/ownership that
-// we want to preserve.
-func removeDirectoryContents(dir string) error {
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return fmt.Errorf("failed to read directory: %w", err)
-	}
-
-	for _, entry := range entries {
-		entryPath := filepath.Join(dir, entry.Name())
-		if err := os.RemoveAll(entryPath); err != nil {
-			return fmt.Errorf("failed to remove %s: %w", entryPath, err)
-		}
-	}
-
-	return nil
-}
-
 // versionInfo represents the version information stored in launcher-version.json
 type versionInfo struct {
 	ETag string `json:"etag,omitempty"`
@@ -278,9 +359,14 @@ func NeedsDownload(ctx context.Context, url, targetDir string) (bool, error) {
 }
 
 // DoServerBinaryDownload performs the complete server binary download process:
-// checks for updates via ETag comparison, removes old binaries if needed,
-// downloads and extracts the server binaries to the target directory.
-// The URL is read from the VS_SERVER_TARGZ_URL environment variable.
+// checks for updates via ETag comparison, downloads and extracts the server
+// binaries next to the installed ones, checks that they match the host
+// architecture, and only then replaces the installed binaries with them. A
+// failed download leaves the installed binaries untouched, and the next call
+// resumes it. The target directory itself is kept, since it may have been
+// created with permissions or ownership (e.g., by root in a Dockerfile)
+// that can't be recreated as a non-root user.
+// The URL is resolved from the environment with ResolveServerURL.
 func DoServerBinaryDownload(ctx context.Context, targetDir string) error {
 	// Normalize and resolve the target directory path to handle any double slashes or other path issues
 	// This ensures we always work with a clean, absolute path
@@ -291,10 +377,16 @@ func DoServerBinaryDownload(ctx context.Context, targetDir string) error {
 	}
 	targetDir = filepath.Clean(targetDir)
 
-	// Get the URL from environment variable
-	url := os.Getenv("VS_SERVER_TARGZ_URL")
-	if url == "" {
-		return fmt.Errorf("VS_SERVER_TARGZ_URL environment variable is not set")
+	// Put the binaries of an interrupted update in order first, so their
+	// version info is where NeedsDownload looks for it
+	if err := recoverUpdate(targetDir); err != nil {
+		return err
+	}
+
+	// Get the URL for this architecture from the environment
+	url, err := ResolveServerURL(hostArch, os.Getenv)
+	if err != nil {
+		return err
 	}
 
 	// Check if download is needed by comparing ETags
@@ -312,17 +404,11 @@ func DoServerBinaryDownload(ctx context.Context, targetDir string) error {
 
 	if !needsDownload {
 		fmt.Println("Server binaries are up to date. Skipping download.")
-		return nil
-	}
-
-	// If download is needed, remove existing directory contents (but keep the directory itself)
-	// We keep the directory because it may have been created with specific permissions/ownership
-	// (e.g., by root in a Dockerfile) that we can't recreate as a non-root user
-	if _, err := os.Stat(targetDir); err == nil {
-		fmt.Println("Removing existing server binaries...")
-		if err := removeDirectoryContents(targetDir); err != nil {
-			return fmt.Errorf("failed to remove existing directory contents: %w", err)
+		// A partial download of an archive that is no longer wanted
+		if err := os.RemoveAll(filepath.Join(targetDir, updateDirName)); err != nil {
+			return fmt.Errorf("failed to remove the update directory: %w", err)
 		}
+		return checkArchitecture(targetDir)
 	}
 
 	fmt.Printf("Downloading Vintage Story server from %s...\n", url)
@@ -336,3 +422,14 @@ func DoServerBinaryDownload(ctx context.Context, targetDir string) error {
 	fmt.Printf("Successfully extracted %d files to %s\n", extractedCount, targetDir)
 	return nil
 }
+
+// checkArchitecture verifies the binaries in targetDir against the host
+// architecture. On a mismatch the version info is removed, so the archive is
+// downloaded again once the URL is fixed, even if it didn't change.
+func checkArchitecture(targetDir string) error {
+	if err := verifyArchitecture(targetDir, hostArch); err != nil {
+		os.Remove(filepath.Join(targetDir, "launcher-version.json"))
+		return fmt.Errorf("server binaries don't match the host architecture: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The update directory inside the server binaries directory holds an update
+// in progress: the archive being downloaded, the binaries extracted from it,
+// and, while the update is installed, the binaries it replaces. It lives
+// inside the binaries directory rather than next to it, since the binaries
+// directory may be a volume whose parent isn't writable, and so renames
+// between the two never cross filesystems.
+const (
+	updateDirName   = ".update"
+	archiveName     = "server.tar.gz"
+	archivePartName = archiveName + ".part"
+
+	// The extracted binaries are renamed from extractDirName to readyDirName
+	// once they are complete and checked, and to installingDirName once the
+	// binaries they replace are out of the way in replacedDirName.
+	extractDirName    = "extracted"
+	readyDirName      = "ready"
+	installingDirName = "installing"
+	replacedDirName   = "replaced"
+)
+
+// installUpdate replaces the binaries in targetDir with the ones ready in the
+// update directory, then removes the update directory. Every step is a
+// rename, and the directory names record how far the install got, so
+// recoverUpdate can finish one that was interrupted. If the old binaries
+// can't all be moved aside, they are put back and the update is discarded.
+func installUpdate(targetDir string) error {
+	work := filepath.Join(targetDir, updateDirName)
+	ready := filepath.Join(work, readyDirName)
+	installing := filepath.Join(work, installingDirName)
+	replaced := filepath.Join(work, replacedDirName)
+
+	if _, err := os.Stat(ready); err == nil {
+		if err := moveEntries(targetDir, replaced, updateDirName); err != nil {
+			moveEntries(replaced, targetDir, "")
+			os.RemoveAll(work)
+			return fmt.Errorf("failed to move the old server binaries aside: %w", err)
+		}
+		if err := os.Rename(ready, installing); err != nil {
+			return fmt.Errorf("failed to mark the new server binaries installing: %w", err)
+		}
+	}
+
+	if err := moveEntries(installing, targetDir, ""); err != nil {
+		return fmt.Errorf("failed to move the new server binaries into place: %w", err)
+	}
+	if err := os.RemoveAll(work); err != nil {
+		return fmt.Errorf("failed to remove the update directory: %w", err)
+	}
+	return nil
+}
+
+// recoverUpdate cleans up after an update of targetDir that was interrupted.
+// An install that got as far as checking the new binaries is finished;
+// binaries that were still being extracted are discarded. A partial
+// download is kept, so the next download resumes it.
+func recoverUpdate(targetDir string) error {
+	work := filepath.Join(targetDir, updateDirName)
+	for _, name := range []string{readyDirName, installingDirName} {
+		if _, err := os.Stat(filepath.Join(work, name)); err == nil {
+			fmt.Println("Finishing an interrupted server binary update...")
+			return installUpdate(targetDir)
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(work, extractDirName)); err != nil {
+		return fmt.Errorf("failed to clean up an interrupted server binary update: %w", err)
+	}
+	return nil
+}
+
+// moveEntries renames every entry of src except skip into dst, creating dst
+// if needed. Entries already moved are skipped by a retry, since they are no
+// longer in src.
+func moveEntries(src, dst, skip string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == skip {
+			continue
+		}
+		if err := os.Rename(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
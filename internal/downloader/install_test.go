@@ -0,0 +1,173 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDoServerBinaryDownload_FailedDownloadKeepsOldBinaries(t *testing.T) {
+	tarGzData := createTestTarGz(t, map[string]string{"new-file.txt": "new content"}, nil, nil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", "\"new-etag\"")
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		// The connection drops halfway through the archive
+		w.Header().Set("Content-Length", strconv.Itoa(len(tarGzData)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(tarGzData[:len(tarGzData)/2])
+	}))
+	defer server.Close()
+	t.Setenv("VS_SERVER_TARGZ_URL", server.URL)
+
+	targetDir := filepath.Join(t.TempDir(), "server")
+	os.MkdirAll(targetDir, 0755)
+	oldFile := filepath.Join(targetDir, "old-file.txt")
+	os.WriteFile(oldFile, []byte("old content"), 0644)
+	saveVersionInfo(targetDir, versionInfo{ETag: "old-etag", URL: server.URL})
+
+	if err := DoServerBinaryDownload(context.Background(), targetDir); err == nil {
+		t.Fatal("Expected error for interrupted download")
+	}
+
+	if content, err := os.ReadFile(oldFile); err != nil || string(content) != "old content" {
+		t.Errorf("Old file = %q, %v; want it untouched", content, err)
+	}
+	if info, err := readVersionInfo(targetDir); err != nil || info == nil || info.ETag != "old-etag" {
+		t.Errorf("Version info = %+v, %v; want the old version", info, err)
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "new-file.txt")); !os.IsNotExist(err) {
+		t.Error("New file was installed from an incomplete download")
+	}
+	part, err := os.Stat(filepath.Join(targetDir, updateDirName, archivePartName))
+	if err != nil || part.Size() == 0 {
+		t.Errorf("Expected the partial download to be kept for resuming, got %v", err)
+	}
+}
+
+func TestDownloadAndExtract_ResumesPartialDownload(t *testing.T) {
+	tarGzData := createTestTarGz(t, map[string]string{"file1.txt": "content1"}, nil, nil)
+	half := len(tarGzData) / 2
+
+	var rangeHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader = r.Header.Get("Range")
+		w.Header().Set("ETag", "\"etag-1\"")
+		http.ServeContent(w, r, "server.tar.gz", time.Time{}, bytes.NewReader(tarGzData))
+	}))
+	defer server.Close()
+
+	targetDir := t.TempDir()
+	work := filepath.Join(targetDir, updateDirName)
+	os.MkdirAll(work, 0755)
+	os.WriteFile(filepath.Join(work, archivePartName), tarGzData[:half], 0644)
+	saveVersionInfo(work, versionInfo{URL: server.URL, ETag: "etag-1"})
+
+	count, err := downloadAndExtract(context.Background(), server.URL, targetDir)
+	if err != nil {
+		t.Fatalf("downloadAndExtract failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 file extracted, got %d", count)
+	}
+	if want := "bytes=" + strconv.Itoa(half) + "-"; rangeHeader != want {
+		t.Errorf("Range = %q, want %q", rangeHeader, want)
+	}
+	if content, err := os.ReadFile(filepath.Join(targetDir, "file1.txt")); err != nil || string(content) != "content1" {
+		t.Errorf("file1.txt = %q, %v", content, err)
+	}
+	if _, err := os.Stat(work); !os.IsNotExist(err) {
+		t.Error("Expected the update directory to be removed")
+	}
+}
+
+func TestDownloadAndExtract_RestartsDownloadOfDifferentArchive(t *testing.T) {
+	tarGzData := createTestTarGz(t, map[string]string{"file1.txt": "content1"}, nil, nil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", "\"etag-2\"")
+		http.ServeContent(w, r, "server.tar.gz", time.Time{}, bytes.NewReader(tarGzData))
+	}))
+	defer server.Close()
+
+	targetDir := t.TempDir()
+	work := filepath.Join(targetDir, updateDirName)
+	os.MkdirAll(work, 0755)
+	os.WriteFile(filepath.Join(work, archivePartName), []byte("part of an older archive"), 0644)
+	saveVersionInfo(work, versionInfo{URL: server.URL, ETag: "etag-1"})
+
+	if _, err := downloadAndExtract(context.Background(), server.URL, targetDir); err != nil {
+		t.Fatalf("downloadAndExtract failed: %v", err)
+	}
+	info, err := readVersionInfo(targetDir)
+	if err != nil || info == nil || info.ETag != "etag-2" {
+		t.Errorf("Version info = %+v, %v; want etag-2", info, err)
+	}
+}
+
+func TestRecoverUpdate_FinishesInterruptedInstall(t *testing.T) {
+	targetDir := t.TempDir()
+	work := filepath.Join(targetDir, updateDirName)
+	ready := filepath.Join(work, readyDirName)
+	replaced := filepath.Join(work, replacedDirName)
+
+	// Interrupted while moving the old binaries aside
+	os.MkdirAll(ready, 0755)
+	os.MkdirAll(replaced, 0755)
+	os.WriteFile(filepath.Join(ready, "new-file.txt"), []byte("new"), 0644)
+	saveVersionInfo(ready, versionInfo{URL: "http://example.com", ETag: "new-etag"})
+	os.WriteFile(filepath.Join(replaced, "old-a.txt"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(targetDir, "old-b.txt"), []byte("old"), 0644)
+
+	if err := recoverUpdate(targetDir); err != nil {
+		t.Fatalf("recoverUpdate failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(targetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if len(names) != 2 || names[0] != "launcher-version.json" || names[1] != "new-file.txt" {
+		t.Errorf("Target directory holds %v, want only the new binaries", names)
+	}
+	if info, err := readVersionInfo(targetDir); err != nil || info == nil || info.ETag != "new-etag" {
+		t.Errorf("Version info = %+v, %v; want the new version", info, err)
+	}
+}
+
+func TestRecoverUpdate_DiscardsIncompleteExtraction(t *testing.T) {
+	targetDir := t.TempDir()
+	work := filepath.Join(targetDir, updateDirName)
+	extracted := filepath.Join(work, extractDirName)
+	os.MkdirAll(extracted, 0755)
+	os.WriteFile(filepath.Join(extracted, "half.txt"), []byte("half"), 0644)
+	os.WriteFile(filepath.Join(work, archivePartName), []byte("partial"), 0644)
+	os.WriteFile(filepath.Join(targetDir, "old-file.txt"), []byte("old"), 0644)
+
+	if err := recoverUpdate(targetDir); err != nil {
+		t.Fatalf("recoverUpdate failed: %v", err)
+	}
+
+	if _, err := os.Stat(extracted); !os.IsNotExist(err) {
+		t.Error("Expected the incomplete extraction to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(work, archivePartName)); err != nil {
+		t.Errorf("Expected the partial download to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "old-file.txt")); err != nil {
+		t.Errorf("Expected the installed binaries to be kept: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package downloader
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+)
+
+// Installed describes the server archive the binaries in a directory came from.
+type Installed struct {
+	// URL is the archive the binaries were extracted from.
+	URL string
+
+	// ETag is the archive's ETag at download time, if the server sent one.
+	ETag string
+
+	// Version is the game version in the archive's file name, if present.
+	Version string
+}
+
+// archiveVersionPattern matches the version at the end of a server archive
+// file name, e.g. "vs_server_linux-x64_1.21.6.tar.gz" or "..._1.22.0-rc.2.tar.gz".
+var archiveVersionPattern = regexp.MustCompile(`_v?(\d+\.\d+\.\d+(?:-[0-9A-Za-z.]+)?)\.tar\.gz$`)
+
+// ArchiveVersion returns the game version in a server archive URL's file
+// name, or "" if the name doesn't contain one.
+func ArchiveVersion(archiveURL string) string {
+	p := archiveURL
+	if u, err := url.Parse(archiveURL); err == nil && u.Path != "" {
+		p = u.Path
+	}
+	m := archiveVersionPattern.FindStringSubmatch(path.Base(p))
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// InstalledVersion returns what DoServerBinaryDownload recorded about the
+// binaries in targetDir, or nil if nothing was recorded.
+func InstalledVersion(targetDir string) (*Installed, error) {
+	info, err := readVersionInfo(targetDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read installed server version: %w", err)
+	}
+	if info == nil {
+		return nil, nil
+	}
+	return &Installed{
+		URL:     info.URL,
+		ETag:    info.ETag,
+		Version: ArchiveVersion(info.URL),
+	}, nil
+}
@@ -0,0 +1,51 @@
+package downloader
+
+import "testing"
+
+func TestArchiveVersion(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://cdn.vintagestory.at/gamefiles/stable/vs_server_linux-x64_1.21.6.tar.gz", "1.21.6"},
+		{"https://cdn.vintagestory.at/gamefiles/unstable/vs_server_linux-x64_1.22.0-rc.2.tar.gz", "1.22.0-rc.2"},
+		{"https://example.com/vs_server_linux-arm64_1.21.6.tar.gz?token=abc", "1.21.6"},
+		{"https://example.com/server.tar.gz", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ArchiveVersion(tt.url); got != tt.want {
+			t.Errorf("ArchiveVersion(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestInstalledVersion(t *testing.T) {
+	t.Run("nothing recorded", func(t *testing.T) {
+		installed, err := InstalledVersion(t.TempDir())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if installed != nil {
+			t.Errorf("expected nil, got %+v", installed)
+		}
+	})
+
+	t.Run("recorded", func(t *testing.T) {
+		dir := t.TempDir()
+		url := "https://cdn.vintagestory.at/gamefiles/stable/vs_server_linux-x64_1.21.6.tar.gz"
+		if err := saveVersionInfo(dir, versionInfo{URL: url, ETag: "abc123"}); err != nil {
+			t.Fatalf("failed to save version info: %v", err)
+		}
+
+		installed, err := InstalledVersion(dir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := Installed{URL: url, ETag: "abc123", Version: "1.21.6"}
+		if installed == nil || *installed != want {
+			t.Errorf("got %+v, want %+v", installed, want)
+		}
+	})
+}
@@ -0,0 +1,214 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UpdatePolicy selects what happens when a new server archive is published
+// at the configured URL while the server is running.
+type UpdatePolicy string
+
+const (
+	// UpdateManual never checks for updates. The binaries are updated when
+	// the launcher starts, or on request.
+	UpdateManual UpdatePolicy = "manual"
+
+	// UpdateNotify checks for updates and reports them, but doesn't install them.
+	UpdateNotify UpdatePolicy = "notify"
+
+	// UpdateAuto checks for updates and installs them.
+	UpdateAuto UpdatePolicy = "auto"
+)
+
+// DefaultUpdateCheckInterval is how often an Updater checks for updates when
+// no interval is configured.
+const DefaultUpdateCheckInterval = time.Hour
+
+// ParseUpdatePolicy parses an update policy name. An empty string is
+// UpdateManual.
+func ParseUpdatePolicy(s string) (UpdatePolicy, error) {
+	switch p := UpdatePolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return UpdateManual, nil
+	case UpdateManual, UpdateNotify, UpdateAuto:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown update policy %q: must be manual, notify, or auto", s)
+}
+
+// Update describes a server archive that differs from the installed one.
+type Update struct {
+	// URL is the archive to download.
+	URL string
+
+	// ETag is the archive's current ETag.
+	ETag string
+
+	// Version is the game version in the archive's file name, if present.
+	Version string
+}
+
+// String describes the update by version if known, otherwise by ETag.
+func (u *Update) String() string {
+	if u.Version != "" {
+		return u.Version
+	}
+	return fmt.Sprintf("archive with ETag %s", u.ETag)
+}
+
+// CheckForUpdate reports whether the archive configured in the environment
+// differs from the one installed in targetDir, by URL or ETag. It returns nil
+// if the installed binaries are current. Unlike NeedsDownload, failing to
+// check is an error rather than a reason to download.
+func CheckForUpdate(ctx context.Context, targetDir string) (*Update, error) {
+	url, err := ResolveServerURL(hostArch, os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	etag, err := GetETag(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for server update: %w", err)
+	}
+
+	installed, err := readVersionInfo(targetDir)
+	if err != nil {
+		return nil, err
+	}
+	if installed != nil && installed.URL == url && strings.EqualFold(installed.ETag, etag) {
+		return nil, nil
+	}
+
+	return &Update{URL: url, ETag: etag, Version: ArchiveVersion(url)}, nil
+}
+
+// Updater periodically checks for a new server archive and, depending on
+// Policy, reports or installs it. With UpdateManual it does nothing.
+type Updater struct {
+	// TargetDir is the directory the server binaries are installed in.
+	TargetDir string
+
+	// Policy selects what happens when an update is found.
+	Policy UpdatePolicy
+
+	// Interval is the time between checks.
+	// Defaults to DefaultUpdateCheckInterval if not set.
+	Interval time.Duration
+
+	// OnAvailable is called once for each new update found. Optional.
+	OnAvailable func(u *Update)
+
+	// Apply installs an update with UpdateAuto. If it fails, the update is
+	// tried again at the next check.
+	Apply func(ctx context.Context, u *Update) error
+
+	// check replaces CheckForUpdate in tests.
+	check func(ctx context.Context) (*Update, error)
+
+	// checkMu serializes checks; announced is the ETag of the update last
+	// passed to OnAvailable.
+	checkMu   sync.Mutex
+	announced string
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Start begins checking for updates in a background goroutine.
+func (u *Updater) Start(ctx context.Context) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.done != nil {
+		return fmt.Errorf("updater already started")
+	}
+	if u.Policy == UpdateAuto && u.Apply == nil {
+		return fmt.Errorf("automatic updates require an Apply function")
+	}
+
+	ctx, u.cancel = context.WithCancel(ctx)
+	u.done = make(chan struct{})
+	go u.runLoop(ctx)
+	return nil
+}
+
+// Stop stops checking for updates and waits for a running check or update
+// to finish.
+func (u *Updater) Stop() {
+	u.mu.Lock()
+	cancel, done := u.cancel, u.done
+	u.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// runLoop checks for updates every Interval until ctx is cancelled.
+func (u *Updater) runLoop(ctx context.Context) {
+	defer close(u.done)
+
+	if u.Policy == UpdateManual {
+		return
+	}
+
+	ticker := time.NewTicker(u.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := u.CheckNow(ctx); err != nil && ctx.Err() == nil {
+				fmt.Printf("WARNING: Server update failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// CheckNow checks for an update once and acts on it according to Policy.
+// An update is announced through OnAvailable only the first time it is seen.
+func (u *Updater) CheckNow(ctx context.Context) error {
+	u.checkMu.Lock()
+	defer u.checkMu.Unlock()
+
+	update, err := u.checkForUpdate(ctx)
+	if err != nil || update == nil {
+		return err
+	}
+
+	if update.ETag != u.announced {
+		u.announced = update.ETag
+		if u.OnAvailable != nil {
+			u.OnAvailable(update)
+		}
+	}
+
+	if u.Policy != UpdateAuto {
+		return nil
+	}
+	return u.Apply(ctx, update)
+}
+
+func (u *Updater) checkForUpdate(ctx context.Context) (*Update, error) {
+	if u.check != nil {
+		return u.check(ctx)
+	}
+	return CheckForUpdate(ctx, u.TargetDir)
+}
+
+func (u *Updater) interval() time.Duration {
+	if u.Interval > 0 {
+		return u.Interval
+	}
+	return DefaultUpdateCheckInterval
+}
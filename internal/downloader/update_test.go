@@ -0,0 +1,197 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseUpdatePolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    UpdatePolicy
+		wantErr bool
+	}{
+		{"", UpdateManual, false},
+		{"manual", UpdateManual, false},
+		{"notify", UpdateNotify, false},
+		{" Auto ", UpdateAuto, false},
+		{"always", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseUpdatePolicy(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseUpdatePolicy(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseUpdatePolicy(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCheckForUpdate(t *testing.T) {
+	etag := "v1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", "\""+etag+"\"")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	url := server.URL + "/vs_server_linux-x64_1.21.6.tar.gz"
+	os.Setenv("VS_SERVER_TARGZ_URL", url)
+	defer os.Unsetenv("VS_SERVER_TARGZ_URL")
+
+	tmpDir := t.TempDir()
+	if err := saveVersionInfo(tmpDir, versionInfo{ETag: "v1", URL: url}); err != nil {
+		t.Fatalf("saveVersionInfo failed: %v", err)
+	}
+
+	update, err := CheckForUpdate(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatalf("CheckForUpdate failed: %v", err)
+	}
+	if update != nil {
+		t.Errorf("expected no update, got %+v", update)
+	}
+
+	etag = "v2"
+	update, err = CheckForUpdate(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatalf("CheckForUpdate failed: %v", err)
+	}
+	if update == nil {
+		t.Fatal("expected an update after the ETag changed")
+	}
+	if update.ETag != "v2" || update.URL != url || update.Version != "1.21.6" {
+		t.Errorf("unexpected update: %+v", update)
+	}
+	if update.String() != "1.21.6" {
+		t.Errorf("String() = %q, want 1.21.6", update.String())
+	}
+}
+
+func TestCheckForUpdate_ServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	os.Setenv("VS_SERVER_TARGZ_URL", server.URL)
+	defer os.Unsetenv("VS_SERVER_TARGZ_URL")
+
+	update, err := CheckForUpdate(context.Background(), t.TempDir())
+	if err == nil {
+		t.Fatal("expected an error when the ETag can't be fetched")
+	}
+	if update != nil {
+		t.Errorf("expected no update on error, got %+v", update)
+	}
+}
+
+func TestUpdater_CheckNow(t *testing.T) {
+	update := &Update{URL: "https://example.com/a.tar.gz", ETag: "v2"}
+
+	t.Run("notify announces once", func(t *testing.T) {
+		var announced int
+		u := &Updater{
+			Policy:      UpdateNotify,
+			OnAvailable: func(*Update) { announced++ },
+			Apply: func(context.Context, *Update) error {
+				t.Error("Apply called with UpdateNotify")
+				return nil
+			},
+			check: func(context.Context) (*Update, error) { return update, nil },
+		}
+		for i := 0; i < 3; i++ {
+			if err := u.CheckNow(context.Background()); err != nil {
+				t.Fatalf("CheckNow failed: %v", err)
+			}
+		}
+		if announced != 1 {
+			t.Errorf("OnAvailable called %d times, want 1", announced)
+		}
+	})
+
+	t.Run("auto applies and retries", func(t *testing.T) {
+		applyErr := errors.New("download failed")
+		var applied int
+		u := &Updater{
+			Policy: UpdateAuto,
+			Apply: func(_ context.Context, got *Update) error {
+				applied++
+				if got != update {
+					t.Errorf("Apply got %+v", got)
+				}
+				return applyErr
+			},
+			check: func(context.Context) (*Update, error) { return update, nil },
+		}
+		for i := 0; i < 2; i++ {
+			if err := u.CheckNow(context.Background()); !errors.Is(err, applyErr) {
+				t.Errorf("CheckNow error = %v, want %v", err, applyErr)
+			}
+		}
+		if applied != 2 {
+			t.Errorf("Apply called %d times, want 2", applied)
+		}
+	})
+
+	t.Run("up to date", func(t *testing.T) {
+		u := &Updater{
+			Policy: UpdateAuto,
+			OnAvailable: func(*Update) {
+				t.Error("OnAvailable called without an update")
+			},
+			Apply: func(context.Context, *Update) error {
+				t.Error("Apply called without an update")
+				return nil
+			},
+			check: func(context.Context) (*Update, error) { return nil, nil },
+		}
+		if err := u.CheckNow(context.Background()); err != nil {
+			t.Fatalf("CheckNow failed: %v", err)
+		}
+	})
+}
+
+func TestUpdater_StartStop(t *testing.T) {
+	checked := make(chan struct{}, 1)
+	u := &Updater{
+		Policy:   UpdateNotify,
+		Interval: 10 * time.Millisecond,
+		check: func(context.Context) (*Update, error) {
+			select {
+			case checked <- struct{}{}:
+			default:
+			}
+			return nil, nil
+		},
+	}
+	if err := u.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := u.Start(context.Background()); err == nil {
+		t.Error("expected an error starting twice")
+	}
+
+	select {
+	case <-checked:
+	case <-time.After(2 * time.Second):
+		t.Fatal("updater never checked for updates")
+	}
+	u.Stop()
+}
+
+func TestUpdater_AutoRequiresApply(t *testing.T) {
+	u := &Updater{Policy: UpdateAuto}
+	if err := u.Start(context.Background()); err == nil {
+		u.Stop()
+		t.Fatal("expected an error without Apply")
+	}
+}
@@ -0,0 +1,59 @@
+// Package exitcode defines the exit codes the launcher and the backup agent
+// exit with. Orchestrators can use these to tell "restart me" apart from
+// "fix your configuration".
+package exitcode
+
+import "errors"
+
+const (
+	// OK means the program shut down gracefully.
+	OK = 0
+	// Unknown is used for errors without a more specific code.
+	Unknown = 1
+	// ConfigError means the environment configuration is invalid.
+	ConfigError = 2
+	// DownloadFailed means the server binaries could not be downloaded.
+	DownloadFailed = 3
+	// ServerStartFailed means the server process could not be started.
+	ServerStartFailed = 4
+	// ServerCrashed means the server process exited with an error.
+	ServerCrashed = 5
+	// BackupFatal means backups are required (BACKUP_REQUIRED) but the
+	// repository is unusable or backups keep failing.
+	BackupFatal = 6
+)
+
+// exitError pairs an error with the exit code to use for it.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// With wraps err so the program exits with code. Returns nil if err is nil.
+func With(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// For returns the exit code for err: the code it was wrapped with by With,
+// OK if err is nil, or Unknown otherwise.
+func For(err error) int {
+	if err == nil {
+		return OK
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return Unknown
+}
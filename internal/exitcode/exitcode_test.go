@@ -0,0 +1,47 @@
+package exitcode
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWith_Nil(t *testing.T) {
+	if err := With(ConfigError, nil); err != nil {
+		t.Errorf("With(ConfigError, nil) = %v, want nil", err)
+	}
+}
+
+func TestFor(t *testing.T) {
+	base := errors.New("bad config")
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, OK},
+		{"plain error", base, Unknown},
+		{"wrapped with code", With(ConfigError, base), ConfigError},
+		{"code wrapped again", fmt.Errorf("startup: %w", With(BackupFatal, base)), BackupFatal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := For(tt.err); got != tt.want {
+				t.Errorf("For(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWith_KeepsError(t *testing.T) {
+	base := errors.New("bad config")
+	err := With(ConfigError, base)
+
+	if !errors.Is(err, base) {
+		t.Error("errors.Is() should find the wrapped error")
+	}
+	if err.Error() != base.Error() {
+		t.Errorf("Error() = %q, want %q", err.Error(), base.Error())
+	}
+}
@@ -0,0 +1,35 @@
+// Package filelock provides advisory whole-file locks that work across the
+// platforms the launcher is developed on.
+//
+// Linux and the BSDs (including macOS) use flock(2), which is what the .NET
+// runtime uses for FileShare.None on those systems, so locks held by the
+// Vintage Story server are visible here. Other Unix systems fall back to
+// fcntl(2) record locks, and Windows uses LockFileEx.
+//
+// Note that fcntl locks are owned by the process, so on the fallback the
+// calling process never conflicts with its own locks.
+package filelock
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrLocked is returned by TryLock when another holder has the file locked.
+var ErrLocked = errors.New("file is locked")
+
+// Lock acquires an exclusive lock on f, blocking until it is available.
+func Lock(f *os.File) error {
+	return lock(f, true)
+}
+
+// TryLock acquires an exclusive lock on f without blocking.
+// Returns ErrLocked if the file is already locked.
+func TryLock(f *os.File) error {
+	return lock(f, false)
+}
+
+// Unlock releases a lock acquired with Lock or TryLock.
+func Unlock(f *os.File) error {
+	return unlock(f)
+}
@@ -0,0 +1,44 @@
+//go:build unix && !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package filelock
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func lock(f *os.File, block bool) error {
+	cmd := unix.F_SETLK
+	if block {
+		cmd = unix.F_SETLKW
+	}
+
+	flock := unix.Flock_t{Type: unix.F_WRLCK}
+	for {
+		err := unix.FcntlFlock(f.Fd(), cmd, &flock)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, unix.EINTR):
+			continue
+		case errors.Is(err, unix.EAGAIN), errors.Is(err, unix.EACCES):
+			return ErrLocked
+		case errors.Is(err, unix.EBADF) && flock.Type == unix.F_WRLCK:
+			// Write locks need a writable descriptor; a read lock on a
+			// read-only file still conflicts with any writer's lock.
+			flock.Type = unix.F_RDLCK
+		default:
+			return &os.PathError{Op: "fcntl", Path: f.Name(), Err: err}
+		}
+	}
+}
+
+func unlock(f *os.File) error {
+	flock := unix.Flock_t{Type: unix.F_UNLCK}
+	if err := unix.FcntlFlock(f.Fd(), unix.F_SETLK, &flock); err != nil {
+		return &os.PathError{Op: "fcntl", Path: f.Name(), Err: err}
+	}
+	return nil
+}
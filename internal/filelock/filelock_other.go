@@ -0,0 +1,16 @@
+//go:build !unix && !windows
+
+package filelock
+
+import (
+	"errors"
+	"os"
+)
+
+func lock(f *os.File, block bool) error {
+	return &os.PathError{Op: "lock", Path: f.Name(), Err: errors.ErrUnsupported}
+}
+
+func unlock(f *os.File) error {
+	return &os.PathError{Op: "unlock", Path: f.Name(), Err: errors.ErrUnsupported}
+}
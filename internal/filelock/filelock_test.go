@@ -0,0 +1,87 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd || windows
+
+package filelock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTryLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world.vcdbs")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	holder, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer holder.Close()
+
+	other, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer other.Close()
+
+	if err := TryLock(other); err != nil {
+		t.Fatalf("TryLock() on unlocked file: %v", err)
+	}
+	if err := Unlock(other); err != nil {
+		t.Fatalf("Unlock() failed: %v", err)
+	}
+
+	if err := Lock(holder); err != nil {
+		t.Fatalf("Lock() failed: %v", err)
+	}
+	if err := TryLock(other); !errors.Is(err, ErrLocked) {
+		t.Errorf("TryLock() on locked file = %v, want ErrLocked", err)
+	}
+
+	if err := Unlock(holder); err != nil {
+		t.Fatalf("Unlock() failed: %v", err)
+	}
+	if err := TryLock(other); err != nil {
+		t.Errorf("TryLock() after unlock = %v, want nil", err)
+	}
+	Unlock(other)
+}
+
+func TestLock_BlocksUntilReleased(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world.vcdbs")
+	os.WriteFile(path, []byte("data"), 0644)
+
+	holder, _ := os.Open(path)
+	defer holder.Close()
+	waiter, _ := os.Open(path)
+	defer waiter.Close()
+
+	if err := Lock(holder); err != nil {
+		t.Fatalf("Lock() failed: %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- Lock(waiter) }()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("Lock() returned %v while the file was held", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	Unlock(holder)
+
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("Lock() failed after release: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Lock() did not return after the holder released the lock")
+	}
+	Unlock(waiter)
+}
@@ -0,0 +1,264 @@
+// Package heartbeat periodically reports the state of the server to an HTTP
+// endpoint run by the operator, so a fleet of servers can be watched without
+// a separate monitoring agent. Reports carry counts and statuses only, never
+// player names, world names, or addresses.
+package heartbeat
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is the time between heartbeats if none is configured.
+const DefaultInterval = time.Minute
+
+// SignatureHeader carries the HMAC-SHA256 of the request body, keyed with
+// the shared secret, as "sha256=<hex>".
+const SignatureHeader = "X-Heartbeat-Signature"
+
+// requestTimeout bounds a single heartbeat request.
+const requestTimeout = 10 * time.Second
+
+// Report is the JSON document sent with each heartbeat.
+type Report struct {
+	// ID identifies the server to the receiver. Empty unless configured.
+	ID string `json:"id,omitempty"`
+
+	// Sent is when the report was sent. Receivers can reject old reports
+	// to guard against replays, since it is covered by the signature.
+	Sent time.Time `json:"sent"`
+
+	// ServerUp reports whether the game server is running and has booted.
+	ServerUp bool `json:"server_up"`
+
+	// PlayersOnline is the number of players online.
+	PlayersOnline int `json:"players_online"`
+
+	// Backup describes recent backups. Nil if backups are disabled.
+	Backup *BackupReport `json:"backup,omitempty"`
+
+	// Versions lists the versions of the software the server runs.
+	Versions Versions `json:"versions"`
+}
+
+// BackupReport describes the outcome of recent backups.
+type BackupReport struct {
+	// State is what the backup system is doing, e.g. "idle" or
+	// "backing-up", and Stage is the part of a running backup.
+	State string `json:"state"`
+	Stage string `json:"stage,omitempty"`
+
+	// LastAttempt and LastSuccess are when the last backup attempt finished
+	// and the last backup succeeded. Omitted if there hasn't been one.
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+
+	// LastError is the error of the last attempt, if it failed.
+	LastError string `json:"last_error,omitempty"`
+
+	// Drift is how far the live world has drifted from the last backup.
+	// Omitted if it hasn't been measured.
+	Drift *DriftReport `json:"drift,omitempty"`
+}
+
+// DriftReport is how much of the live world has changed since the last
+// backup: what would be lost if the live save were lost.
+type DriftReport struct {
+	// Measured is when the drift was measured.
+	Measured time.Time `json:"measured"`
+
+	// Rows is how many savegame rows were changed, added, or removed, and
+	// Chunks how many of them are chunks.
+	Rows   int `json:"rows"`
+	Chunks int `json:"chunks"`
+
+	// Bytes is the size of the changed and added rows.
+	Bytes int64 `json:"bytes"`
+}
+
+// Versions lists software versions. Unknown versions are omitted.
+type Versions struct {
+	Game   string `json:"game,omitempty"`
+	Restic string `json:"restic,omitempty"`
+}
+
+// Sender posts a Report to URL every Interval, starting as soon as it starts.
+type Sender struct {
+	// URL is the endpoint reports are POSTed to.
+	URL string
+
+	// Interval is the time between heartbeats. Defaults to DefaultInterval.
+	Interval time.Duration
+
+	// Secret signs each report in SignatureHeader. If empty, reports
+	// aren't signed.
+	Secret string
+
+	// ID identifies the server in reports.
+	ID string
+
+	// Collect returns the current state of the server. ID and Sent are
+	// filled in by the sender.
+	Collect func() Report
+
+	// HTTPClient sends the requests. Defaults to http.DefaultClient if nil.
+	HTTPClient *http.Client
+
+	// Logf is called when heartbeats start failing and when they recover.
+	// Defaults to printing to stdout.
+	Logf func(format string, args ...any)
+
+	// now returns the current time; tests replace it.
+	now func() time.Time
+
+	mu      sync.Mutex
+	started bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	failing bool
+}
+
+// Start begins sending heartbeats in a background goroutine.
+func (s *Sender) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return errors.New("heartbeat sender already started")
+	}
+	if s.URL == "" {
+		return errors.New("heartbeat URL is required")
+	}
+	if s.Collect == nil {
+		return errors.New("heartbeat Collect function is required")
+	}
+	if s.Interval <= 0 {
+		s.Interval = DefaultInterval
+	}
+	if s.Logf == nil {
+		s.Logf = func(format string, args ...any) {
+			fmt.Printf(format+"\n", args...)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.started = true
+
+	s.wg.Add(1)
+	go s.sendLoop(ctx)
+
+	return nil
+}
+
+// Stop stops sending heartbeats and waits for the background goroutine to
+// exit, abandoning a request in flight.
+func (s *Sender) Stop() {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = false
+	s.mu.Unlock()
+
+	s.cancel()
+	s.wg.Wait()
+}
+
+// sendLoop sends a heartbeat now and on every tick until stopped. Only
+// changes between success and failure are logged, so an unreachable
+// endpoint doesn't flood the console.
+func (s *Sender) sendLoop(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		err := s.Send(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		switch {
+		case err != nil && !s.failing:
+			s.Logf("WARNING: Failed to send heartbeat: %v", err)
+			s.failing = true
+		case err == nil && s.failing:
+			s.Logf("Heartbeats are being delivered again")
+			s.failing = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Send sends a single heartbeat. Any 2xx response counts as delivered.
+func (s *Sender) Send(ctx context.Context) error {
+	report := s.Collect()
+	report.ID = s.ID
+	report.Sent = s.timeNow().UTC()
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode heartbeat: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create heartbeat request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(s.Secret, body))
+	}
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("heartbeat endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature of body for SignatureHeader: "sha256=" and the
+// hex HMAC-SHA256 of body keyed with secret. Receivers compute the same over
+// the raw request body and compare with hmac.Equal.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Sender) timeNow() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
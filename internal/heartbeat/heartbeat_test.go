@@ -0,0 +1,183 @@
+package heartbeat
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver records the heartbeats posted to it.
+type receiver struct {
+	mu         sync.Mutex
+	bodies     [][]byte
+	signatures []string
+	status     int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bodies = append(r.bodies, body)
+	r.signatures = append(r.signatures, req.Header.Get(SignatureHeader))
+	if r.status != 0 {
+		w.WriteHeader(r.status)
+	}
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.bodies)
+}
+
+func TestSend(t *testing.T) {
+	recv := &receiver{}
+	ts := httptest.NewServer(recv)
+	defer ts.Close()
+
+	sent := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	lastSuccess := sent.Add(-time.Hour)
+	drift := &DriftReport{Measured: sent, Rows: 12, Chunks: 10, Bytes: 4096}
+	s := &Sender{
+		URL:    ts.URL,
+		Secret: "hunter2",
+		ID:     "eu-1",
+		Collect: func() Report {
+			return Report{
+				ServerUp:      true,
+				PlayersOnline: 4,
+				Backup:        &BackupReport{LastAttempt: &lastSuccess, LastSuccess: &lastSuccess, Drift: drift},
+				Versions:      Versions{Game: "1.21.5", Restic: "0.17.3"},
+			}
+		},
+		now: func() time.Time { return sent },
+	}
+
+	if err := s.Send(context.Background()); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	if len(recv.bodies) != 1 {
+		t.Fatalf("Received %d heartbeats, want 1", len(recv.bodies))
+	}
+	body := recv.bodies[0]
+	if !hmac.Equal([]byte(recv.signatures[0]), []byte(Sign("hunter2", body))) {
+		t.Errorf("Signature %q doesn't match the body", recv.signatures[0])
+	}
+
+	var got Report
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("Invalid heartbeat JSON %s: %v", body, err)
+	}
+	if got.ID != "eu-1" || !got.Sent.Equal(sent) || !got.ServerUp || got.PlayersOnline != 4 {
+		t.Errorf("Report = %+v", got)
+	}
+	if got.Backup == nil || got.Backup.LastSuccess == nil || !got.Backup.LastSuccess.Equal(lastSuccess) {
+		t.Errorf("Backup = %+v, want last success %v", got.Backup, lastSuccess)
+	}
+	if d := got.Backup.Drift; d == nil || d.Rows != 12 || d.Chunks != 10 || d.Bytes != 4096 {
+		t.Errorf("Drift = %+v", got.Backup.Drift)
+	}
+	if got.Versions.Game != "1.21.5" || got.Versions.Restic != "0.17.3" {
+		t.Errorf("Versions = %+v", got.Versions)
+	}
+}
+
+func TestSend_Unsigned(t *testing.T) {
+	recv := &receiver{}
+	ts := httptest.NewServer(recv)
+	defer ts.Close()
+
+	s := &Sender{URL: ts.URL, Collect: func() Report { return Report{} }}
+	if err := s.Send(context.Background()); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if recv.signatures[0] != "" {
+		t.Errorf("Unsigned heartbeat has signature %q", recv.signatures[0])
+	}
+	if strings.Contains(string(recv.bodies[0]), `"backup"`) {
+		t.Errorf("Heartbeat without backups includes a backup section: %s", recv.bodies[0])
+	}
+}
+
+func TestSend_ErrorStatus(t *testing.T) {
+	ts := httptest.NewServer(&receiver{status: http.StatusUnauthorized})
+	defer ts.Close()
+
+	s := &Sender{URL: ts.URL, Collect: func() Report { return Report{} }}
+	if err := s.Send(context.Background()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Send error = %v, want the 401 status", err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	// Known HMAC-SHA256 test vector (RFC 4231 test case 2)
+	got := Sign("Jefe", []byte("what do ya want for nothing?"))
+	want := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+}
+
+func TestSender_StartStop(t *testing.T) {
+	recv := &receiver{status: http.StatusServiceUnavailable}
+	ts := httptest.NewServer(recv)
+	defer ts.Close()
+
+	var mu sync.Mutex
+	var logs []string
+	s := &Sender{
+		URL:      ts.URL,
+		Interval: 10 * time.Millisecond,
+		Collect:  func() Report { return Report{} },
+		Logf: func(format string, args ...any) {
+			mu.Lock()
+			defer mu.Unlock()
+			logs = append(logs, fmt.Sprintf(format, args...))
+		},
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+	if err := s.Start(); err == nil {
+		t.Error("Second Start should return an error")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for recv.count() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	recv.mu.Lock()
+	recv.status = http.StatusOK
+	recv.mu.Unlock()
+	n := recv.count()
+	for recv.count() < n+2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	s.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logs) != 2 || !strings.Contains(logs[0], "503") || !strings.Contains(logs[1], "delivered again") {
+		t.Errorf("Logs = %q, want one failure and one recovery", logs)
+	}
+}
+
+func TestSender_StartValidates(t *testing.T) {
+	if err := (&Sender{Collect: func() Report { return Report{} }}).Start(); err == nil {
+		t.Error("Start without URL should fail")
+	}
+	if err := (&Sender{URL: "http://localhost"}).Start(); err == nil {
+		t.Error("Start without Collect should fail")
+	}
+}
@@ -0,0 +1,343 @@
+// Package logtail stands in for a Vintage Story server process the launcher
+// doesn't run, by following the server's log file instead of its output. A
+// Tail detects booting and finished backups, and passes each logged line on
+// to listeners such as the player checker, while commands go through
+// another channel, such as RCON or a named pipe.
+package logtail
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/server"
+)
+
+// DefaultPath is where the server writes its main log in /gamedata.
+const DefaultPath = "/gamedata/Logs/server-main.log"
+
+// DefaultPollInterval is how often the log file is checked for new lines
+// when PollInterval isn't set.
+const DefaultPollInterval = 500 * time.Millisecond
+
+// ErrNoCommander is returned by SendCommand when no Commander is set.
+var ErrNoCommander = errors.New("no command channel to the server")
+
+// bootRegexp matches the line the server logs once it has fully booted.
+var bootRegexp = regexp.MustCompile(regexp.QuoteMeta(server.BootPattern))
+
+// Tail follows a server's log file as it is written. The whole file is read
+// first, so a server that booted before the Tail started counts as booted
+// and the players already online are known. When the server starts again
+// and moves the file aside, the rest of the old file is read before the new
+// one; a truncated file is read again from the start. Either way, the
+// server counts as not booted until the new log shows it has.
+type Tail struct {
+	// Path is the log file. Defaults to DefaultPath if empty.
+	Path string
+
+	// PollInterval is how often the file is checked for new lines.
+	// Defaults to DefaultPollInterval if not set.
+	PollInterval time.Duration
+
+	// Commander sends commands to the server. Optional; without it,
+	// SendCommand fails with ErrNoCommander.
+	Commander server.CommandSender
+
+	// OnBoot is called each time the log shows the server has booted.
+	// Optional.
+	OnBoot func()
+
+	booted     atomic.Bool
+	lastOutput atomic.Int64
+
+	listenersMu sync.Mutex
+	listeners   []listener
+
+	waitersMu sync.Mutex
+	waiters   []chan struct{}
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// listener is an output handler registered with AddOutputListener.
+type listener struct {
+	id string
+	fn server.OutputHandler
+}
+
+// Start begins following the log file in the background, until ctx is done
+// or Stop is called. A missing file is waited for.
+func (t *Tail) Start(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cancel != nil {
+		return fmt.Errorf("log tail already started")
+	}
+	ctx, t.cancel = context.WithCancel(ctx)
+
+	t.wg.Add(1)
+	go t.run(ctx)
+	return nil
+}
+
+// Stop stops following the log file and waits for the last lines to be
+// handled.
+func (t *Tail) Stop() {
+	t.mu.Lock()
+	cancel := t.cancel
+	t.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	t.wg.Wait()
+}
+
+// run follows the log file until ctx is done.
+func (t *Tail) run(ctx context.Context) {
+	defer t.wg.Done()
+
+	interval := t.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	f := &follower{path: t.path(), handle: t.handleLine}
+	defer f.close()
+
+	for {
+		if f.poll() {
+			t.booted.Store(false)
+			continue // Read the new file right away
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Tail) path() string {
+	if t.Path != "" {
+		return t.Path
+	}
+	return DefaultPath
+}
+
+// handleLine records boots, backup completions, and the output time, and
+// passes line on to the listeners.
+func (t *Tail) handleLine(line string) {
+	t.lastOutput.Store(time.Now().UnixNano())
+
+	if bootRegexp.MatchString(line) && !t.booted.Swap(true) && t.OnBoot != nil {
+		t.OnBoot()
+	}
+	if strings.HasSuffix(line, server.BackupCompletePattern) {
+		t.waitersMu.Lock()
+		for _, w := range t.waiters {
+			close(w)
+		}
+		t.waiters = nil
+		t.waitersMu.Unlock()
+	}
+	t.dispatchToListeners(line)
+}
+
+// AddOutputListener registers fn to be called with each line of the log
+// until it returns false or is removed with RemoveOutputListener, as
+// server.Server.AddOutputListener does.
+func (t *Tail) AddOutputListener(id string, fn server.OutputHandler) {
+	t.listenersMu.Lock()
+	defer t.listenersMu.Unlock()
+
+	for i := range t.listeners {
+		if t.listeners[i].id == id {
+			t.listeners[i].fn = fn
+			return
+		}
+	}
+	t.listeners = append(t.listeners, listener{id: id, fn: fn})
+}
+
+// RemoveOutputListener unregisters the listener added with id, if any.
+func (t *Tail) RemoveOutputListener(id string) {
+	t.listenersMu.Lock()
+	defer t.listenersMu.Unlock()
+
+	t.listeners = slices.DeleteFunc(t.listeners, func(l listener) bool {
+		return l.id == id
+	})
+}
+
+// dispatchToListeners passes line to each listener, dropping those that
+// return false.
+func (t *Tail) dispatchToListeners(line string) {
+	t.listenersMu.Lock()
+	listeners := slices.Clone(t.listeners)
+	t.listenersMu.Unlock()
+
+	for _, l := range listeners {
+		if !l.fn(line) {
+			t.RemoveOutputListener(l.id)
+		}
+	}
+}
+
+// HasBooted returns true if the log shows the server has fully booted since
+// it last started.
+func (t *Tail) HasBooted() bool {
+	return t.booted.Load()
+}
+
+// LastOutputTime returns when the last line was read from the log, or the
+// zero time if none has been.
+func (t *Tail) LastOutputTime() time.Time {
+	if n := t.lastOutput.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// WaitForBackupComplete waits for the server to log that a backup is
+// complete. Only lines read after the call count.
+func (t *Tail) WaitForBackupComplete(ctx context.Context) error {
+	w := make(chan struct{})
+	t.waitersMu.Lock()
+	t.waiters = append(t.waiters, w)
+	t.waitersMu.Unlock()
+
+	select {
+	case <-w:
+		return nil
+	case <-ctx.Done():
+		t.waitersMu.Lock()
+		t.waiters = slices.DeleteFunc(t.waiters, func(c chan struct{}) bool { return c == w })
+		t.waitersMu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// SendCommand sends cmd to the server through Commander.
+func (t *Tail) SendCommand(cmd string) error {
+	if t.Commander == nil {
+		return ErrNoCommander
+	}
+	return t.Commander.SendCommand(cmd)
+}
+
+// follower reads the lines of a log file that may be rotated or truncated.
+type follower struct {
+	path   string
+	handle func(line string)
+
+	file    *os.File
+	info    os.FileInfo
+	reader  *bufio.Reader
+	offset  int64
+	partial string
+}
+
+// poll handles the lines written since the last poll. It returns true if
+// it switched to a new file, which it then hasn't read yet.
+func (f *follower) poll() bool {
+	if f.file == nil {
+		if !f.open() {
+			return false
+		}
+		f.read()
+		return false
+	}
+
+	f.read()
+	current, err := os.Stat(f.path)
+	switch {
+	case err != nil:
+		// Being rotated; keep the old file until the new one appears
+		return false
+	case !os.SameFile(current, f.info):
+		f.flush()
+		f.close()
+		return f.open()
+	case current.Size() < f.offset:
+		f.flush()
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			f.close()
+			return f.open()
+		}
+		f.reader.Reset(f.file)
+		f.offset = 0
+		return true
+	}
+	return false
+}
+
+// open opens the file at path, and reports whether it could.
+func (f *follower) open() bool {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return false
+	}
+	f.file, f.info, f.reader, f.offset, f.partial = file, info, bufio.NewReader(file), 0, ""
+	return true
+}
+
+// read handles the complete lines up to the end of the file. An incomplete
+// last line is kept until the rest of it is written.
+func (f *follower) read() {
+	for {
+		line, err := f.reader.ReadString('\n')
+		f.offset += int64(len(line))
+		f.partial += line
+		if err != nil {
+			return
+		}
+		f.handle(strings.TrimRight(f.partial, "\r\n"))
+		f.partial = ""
+	}
+}
+
+// flush handles an incomplete last line, which won't be completed once the
+// file has been replaced.
+func (f *follower) flush() {
+	if f.partial != "" {
+		f.handle(strings.TrimRight(f.partial, "\r\n"))
+		f.partial = ""
+	}
+}
+
+// close closes the file, if one is open.
+func (f *follower) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+// Ensure Tail stands in for server.Server where backups and the watchdog
+// need it.
+var (
+	_ server.CommandSender  = (*Tail)(nil)
+	_ server.ActivitySource = (*Tail)(nil)
+)
@@ -0,0 +1,216 @@
+package logtail
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder collects the lines passed to an output listener.
+type recorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (r *recorder) handle(line string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, line)
+	return true
+}
+
+// waitFor waits until the lines recorded are want.
+func (r *recorder) waitFor(t *testing.T, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r.mu.Lock()
+		got := slices.Clone(r.lines)
+		r.mu.Unlock()
+		if slices.Equal(got, want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Lines = %q, want %q", got, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func appendLog(t *testing.T, path, s string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+}
+
+func startTail(t *testing.T, path string) (*Tail, *recorder) {
+	t.Helper()
+	rec := &recorder{}
+	tail := &Tail{Path: path, PollInterval: 10 * time.Millisecond}
+	tail.AddOutputListener("test", rec.handle)
+	if err := tail.Start(context.Background()); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	t.Cleanup(tail.Stop)
+	return tail, rec
+}
+
+func TestTail_ReadsHistoryAndNewLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server-main.log")
+	appendLog(t, path, "1.3.2025 12:00:00 [Server Notification] Dedicated Server now running on Port 42420 and all ips!\n")
+
+	tail, rec := startTail(t, path)
+	rec.waitFor(t, "1.3.2025 12:00:00 [Server Notification] Dedicated Server now running on Port 42420 and all ips!")
+	if !tail.HasBooted() {
+		t.Error("HasBooted() = false after the boot line in the existing log")
+	}
+
+	// A line written in two parts is only handled once complete
+	appendLog(t, path, "1.3.2025 12:01:00 [Server Event] Tyron joins")
+	time.Sleep(50 * time.Millisecond)
+	appendLog(t, path, ".\r\n")
+	rec.waitFor(t,
+		"1.3.2025 12:00:00 [Server Notification] Dedicated Server now running on Port 42420 and all ips!",
+		"1.3.2025 12:01:00 [Server Event] Tyron joins.")
+}
+
+func TestTail_FollowsRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server-main.log")
+	appendLog(t, path, "Dedicated Server now running\n")
+
+	tail, rec := startTail(t, path)
+	rec.waitFor(t, "Dedicated Server now running")
+
+	// The server moves the old log aside on start, after its last lines
+	appendLog(t, path, "old last line\n")
+	if err := os.Rename(path, filepath.Join(dir, "server-main.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(t, path, "new first line\n")
+
+	rec.waitFor(t, "Dedicated Server now running", "old last line", "new first line")
+	if tail.HasBooted() {
+		t.Error("HasBooted() = true before the new log shows a boot")
+	}
+}
+
+func TestTail_FollowsTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server-main.log")
+	appendLog(t, path, "Dedicated Server now running\nsecond line\n")
+
+	tail, rec := startTail(t, path)
+	rec.waitFor(t, "Dedicated Server now running", "second line")
+
+	if err := os.WriteFile(path, []byte("fresh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rec.waitFor(t, "Dedicated Server now running", "second line", "fresh")
+	if tail.HasBooted() {
+		t.Error("HasBooted() = true after the log was truncated")
+	}
+}
+
+func TestTail_OnBootEachStart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server-main.log")
+	appendLog(t, path, "Dedicated Server now running\n")
+
+	boots := make(chan struct{}, 3)
+	tail := &Tail{Path: path, PollInterval: 10 * time.Millisecond, OnBoot: func() { boots <- struct{}{} }}
+	if err := tail.Start(context.Background()); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	t.Cleanup(tail.Stop)
+
+	waitBoot := func() {
+		t.Helper()
+		select {
+		case <-boots:
+		case <-time.After(2 * time.Second):
+			t.Fatal("OnBoot wasn't called")
+		}
+	}
+	waitBoot()
+
+	// A repeated boot line in the same log isn't another boot
+	appendLog(t, path, "Dedicated Server now running\n")
+
+	// The server starts again with a new log
+	if err := os.Rename(path, filepath.Join(dir, "server-main.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(t, path, "starting\n")
+	for deadline := time.Now().Add(2 * time.Second); tail.HasBooted(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("HasBooted() = true after the server started a new log")
+		}
+	}
+	appendLog(t, path, "Dedicated Server now running\n")
+	waitBoot()
+
+	if len(boots) != 0 {
+		t.Errorf("OnBoot called %d more times, want once per start", len(boots))
+	}
+}
+
+func TestTail_WaitForBackupComplete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server-main.log")
+	// Backups completed before waiting don't count
+	appendLog(t, path, "[Server Notification] Backup complete!\n")
+	tail, rec := startTail(t, path)
+	rec.waitFor(t, "[Server Notification] Backup complete!")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := tail.WaitForBackupComplete(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForBackupComplete() = %v, want a timeout", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- tail.WaitForBackupComplete(context.Background()) }()
+	time.Sleep(20 * time.Millisecond)
+	appendLog(t, path, "1.3.2025 12:05:00 [Server Notification] Backup complete!\n")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("WaitForBackupComplete() = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("WaitForBackupComplete() didn't return after the backup completed")
+	}
+}
+
+// commandRecorder records the commands sent to it.
+type commandRecorder struct {
+	commands []string
+}
+
+func (c *commandRecorder) SendCommand(cmd string) error {
+	c.commands = append(c.commands, cmd)
+	return nil
+}
+
+func TestTail_SendCommand(t *testing.T) {
+	tail := &Tail{}
+	if err := tail.SendCommand("/genbackup"); !errors.Is(err, ErrNoCommander) {
+		t.Errorf("SendCommand() without a Commander = %v, want ErrNoCommander", err)
+	}
+
+	commander := &commandRecorder{}
+	tail.Commander = commander
+	if err := tail.SendCommand("/genbackup"); err != nil || !slices.Equal(commander.commands, []string{"/genbackup"}) {
+		t.Errorf("SendCommand() = %v, sent %v; want /genbackup sent", err, commander.commands)
+	}
+}
@@ -0,0 +1,91 @@
+// Package logtime prefixes the launcher's output with timestamps, so that its
+// own messages can be lined up with the server's log and with external systems.
+package logtime
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	// Embed the timezone database so LOG_TIMEZONE works in minimal images.
+	_ "time/tzdata"
+)
+
+// Layout is the format of the timestamp prefix.
+const Layout = "2006-01-02T15:04:05.000Z07:00"
+
+// LoadLocation resolves a display timezone name. An empty name means UTC;
+// "Local" means the process's own timezone (from TZ).
+func LoadLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// Writer prefixes each line written through it with the current time.
+// Lines may arrive split across several writes; the prefix is only added
+// at the start of a line.
+type Writer struct {
+	// W receives the timestamped output.
+	W io.Writer
+
+	// Location is the timezone timestamps are shown in. Defaults to UTC.
+	Location *time.Location
+
+	mu      sync.Mutex
+	midLine bool
+
+	// now returns the current time. Defaults to time.Now; overridable in tests.
+	now func() time.Time
+}
+
+// Write writes p to W, adding a timestamp before every line.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var out bytes.Buffer
+	for rest := p; len(rest) > 0; {
+		if !w.midLine {
+			out.WriteString(w.stamp())
+			out.WriteByte(' ')
+			w.midLine = true
+		}
+
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			out.Write(rest)
+			break
+		}
+		out.Write(rest[:i+1])
+		rest = rest[i+1:]
+		w.midLine = false
+	}
+
+	if _, err := w.W.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// stamp returns the current time formatted in the configured timezone.
+func (w *Writer) stamp() string {
+	now := time.Now
+	if w.now != nil {
+		now = w.now
+	}
+	loc := w.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	return now().In(loc).Format(Layout)
+}
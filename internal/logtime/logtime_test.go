@@ -0,0 +1,64 @@
+package logtime
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func fixedClock() func() time.Time {
+	return func() time.Time { return time.Date(2025, 12, 14, 21, 32, 37, 0, time.UTC) }
+}
+
+func TestWriter_PrefixesEachLine(t *testing.T) {
+	var buf bytes.Buffer
+	w := &Writer{W: &buf, now: fixedClock()}
+
+	fmt.Fprint(w, "first\nsecond\n")
+
+	want := "2025-12-14T21:32:37.000Z first\n2025-12-14T21:32:37.000Z second\n"
+	if buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriter_SplitWrites(t *testing.T) {
+	var buf bytes.Buffer
+	w := &Writer{W: &buf, now: fixedClock()}
+
+	fmt.Fprint(w, "Backup ")
+	fmt.Fprint(w, "completed\nnext")
+
+	want := "2025-12-14T21:32:37.000Z Backup completed\n2025-12-14T21:32:37.000Z next"
+	if buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriter_Location(t *testing.T) {
+	loc, err := LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("LoadLocation() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	w := &Writer{W: &buf, Location: loc, now: fixedClock()}
+	fmt.Fprintln(w, "hello")
+
+	want := "2025-12-14T22:32:37.000+01:00 hello\n"
+	if buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestLoadLocation(t *testing.T) {
+	loc, err := LoadLocation("")
+	if err != nil || loc != time.UTC {
+		t.Errorf("LoadLocation(\"\") = %v, %v; want UTC", loc, err)
+	}
+
+	if _, err := LoadLocation("Not/AZone"); err == nil {
+		t.Error("LoadLocation(\"Not/AZone\") expected error")
+	}
+}
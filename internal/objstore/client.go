@@ -0,0 +1,154 @@
+// Package objstore uploads files to S3-compatible object storage with
+// minio-go, to keep copies of raw backup files in a bucket.
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// DefaultRegion is the signing region used when Client.Region isn't set.
+const DefaultRegion = "us-east-1"
+
+// DefaultPartSize is the size of the parts files larger than it are uploaded
+// in. A single PUT is limited to 5 GiB; a multipart upload to 10,000 parts,
+// so minio-go makes the parts of files over about 640 GiB larger.
+const DefaultPartSize = 64 << 20
+
+// Client is an S3 API client for a single bucket.
+type Client struct {
+	// Endpoint is the base URL of the S3 API, e.g.
+	// "https://s3.eu-central-1.amazonaws.com" or "http://minio:9000".
+	Endpoint string
+
+	// Region is the region requests are signed for.
+	// Defaults to DefaultRegion if empty.
+	Region string
+
+	// Bucket is the bucket objects are stored in.
+	Bucket string
+
+	// AccessKeyID and SecretAccessKey are the credentials requests are
+	// signed with.
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is sent with temporary credentials, such as those of an
+	// assumed IAM role. Optional.
+	SessionToken string
+
+	// PathStyle addresses the bucket as the first path element
+	// (endpoint/bucket/key) instead of as a subdomain (bucket.endpoint/key).
+	// Most self-hosted S3-compatible servers need it.
+	PathStyle bool
+
+	// Transport sends the requests. Defaults to minio-go's transport if nil.
+	Transport http.RoundTripper
+
+	// partSize is the size of upload parts. Defaults to DefaultPartSize if
+	// zero; tests make it smaller.
+	partSize uint64
+
+	once   sync.Once
+	client *minio.Client
+	err    error
+}
+
+// Object describes a stored object.
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// minio returns the minio-go client for the configured endpoint, creating
+// it on first use.
+func (c *Client) minio() (*minio.Client, error) {
+	c.once.Do(func() {
+		u, err := url.Parse(c.Endpoint)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			c.err = fmt.Errorf("invalid endpoint %q", c.Endpoint)
+			return
+		}
+		if u.Path != "" && u.Path != "/" {
+			c.err = fmt.Errorf("invalid endpoint %q: S3 endpoints can't have a path", c.Endpoint)
+			return
+		}
+
+		region := c.Region
+		if region == "" {
+			region = DefaultRegion
+		}
+		lookup := minio.BucketLookupDNS
+		if c.PathStyle {
+			lookup = minio.BucketLookupPath
+		}
+		c.client, c.err = minio.New(u.Host, &minio.Options{
+			Creds:        credentials.NewStaticV4(c.AccessKeyID, c.SecretAccessKey, c.SessionToken),
+			Secure:       u.Scheme == "https",
+			Region:       region,
+			BucketLookup: lookup,
+			Transport:    c.Transport,
+		})
+	})
+	return c.client, c.err
+}
+
+// PutFile uploads the file at path as key. Files larger than a part are
+// uploaded in parts, so they aren't limited to the 5 GiB a single request
+// may carry. A failed multipart upload is aborted, so its parts aren't left
+// taking up space.
+func (c *Client) PutFile(ctx context.Context, key, path string) error {
+	client, err := c.minio()
+	if err != nil {
+		return err
+	}
+
+	partSize := c.partSize
+	if partSize == 0 {
+		partSize = DefaultPartSize
+	}
+	if _, err := client.FPutObject(ctx, c.Bucket, key, path, minio.PutObjectOptions{PartSize: partSize}); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+// List returns the objects whose keys start with prefix, sorted by key.
+func (c *Client) List(ctx context.Context, prefix string) ([]Object, error) {
+	client, err := c.minio()
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []Object
+	for o := range client.ListObjects(ctx, c.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if o.Err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, o.Err)
+		}
+		objects = append(objects, Object{Key: o.Key, Size: o.Size, LastModified: o.LastModified})
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Delete removes the object stored as key.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	client, err := c.minio()
+	if err != nil {
+		return err
+	}
+	if err := client.RemoveObject(ctx, c.Bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
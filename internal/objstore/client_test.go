@@ -0,0 +1,393 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// fakeS3 is an in-memory, path-style S3 API for a single bucket. It only
+// checks that requests are signed, not that the signatures are right.
+type fakeS3 struct {
+	t      *testing.T
+	bucket string
+
+	// sessionToken is required in X-Amz-Security-Token, if set.
+	sessionToken string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	// uploads holds the parts of multipart uploads in progress, by upload ID.
+	uploads  map[string]map[int][]byte
+	uploaded int
+	// pageSize limits list results, to exercise continuation, if set.
+	pageSize int
+	// failPart makes uploads of this part number fail, if set.
+	failPart string
+}
+
+func newFakeS3(t *testing.T, bucket string) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{t: t, bucket: bucket, objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+		r.Header.Get("X-Amz-Content-Sha256") == "" || r.Header.Get("X-Amz-Date") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>AccessDenied</Code><Message>unsigned request</Message></Error>")
+		return
+	}
+	if r.Header.Get("X-Amz-Security-Token") != f.sessionToken {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>InvalidToken</Code><Message>wrong session token</Message></Error>")
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "<Error><Code>NoSuchBucket</Code><Message>no such bucket</Message></Error>")
+		return
+	}
+	key = strings.TrimPrefix(key, "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	query := r.URL.Query()
+	switch {
+	case query.Has("uploadId"):
+		f.multipart(w, r, key)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.uploaded++
+		id := strconv.Itoa(f.uploaded)
+		f.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut:
+		f.objects[key] = readBody(r)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("continuation-token"))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// multipart handles the requests that upload, complete, or abort a part of
+// a multipart upload.
+func (f *fakeS3) multipart(w http.ResponseWriter, r *http.Request, key string) {
+	id := r.URL.Query().Get("uploadId")
+	parts, ok := f.uploads[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "<Error><Code>NoSuchUpload</Code><Message>no such upload</Message></Error>")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if r.URL.Query().Get("partNumber") == f.failPart {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "<Error><Code>BadDigest</Code><Message>part failed</Message></Error>")
+			return
+		}
+		n, _ := strconv.Atoi(r.URL.Query().Get("partNumber"))
+		data := readBody(r)
+		parts[n] = data
+		w.Header().Set("ETag", fmt.Sprintf("\"etag-%d\"", n))
+	case http.MethodPost:
+		var complete struct {
+			Parts []struct {
+				PartNumber int    `xml:"PartNumber"`
+				ETag       string `xml:"ETag"`
+			} `xml:"Part"`
+		}
+		xml.NewDecoder(r.Body).Decode(&complete)
+		var data []byte
+		for _, part := range complete.Parts {
+			if strings.Trim(part.ETag, `"`) != fmt.Sprintf("etag-%d", part.PartNumber) {
+				io.WriteString(w, "<Error><Code>InvalidPart</Code><Message>wrong ETag</Message></Error>")
+				return
+			}
+			data = append(data, parts[part.PartNumber]...)
+		}
+		f.objects[key] = data
+		delete(f.uploads, id)
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key></CompleteMultipartUploadResult>", f.bucket, key)
+	case http.MethodDelete:
+		delete(f.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// readBody returns the data in r's body, decoding the aws-chunked encoding
+// minio-go streams uploads in over plain HTTP.
+func readBody(r *http.Request) []byte {
+	body, _ := io.ReadAll(r.Body)
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return body
+	}
+
+	// Each chunk is "<hex size>;chunk-signature=<sig>\r\n<data>\r\n", ending
+	// with a chunk of size zero
+	var data []byte
+	for {
+		header, rest, ok := bytes.Cut(body, []byte("\r\n"))
+		if !ok {
+			return data
+		}
+		sizeHex, _, _ := bytes.Cut(header, []byte(";"))
+		size, err := strconv.ParseInt(string(sizeHex), 16, 64)
+		if err != nil || size == 0 || int64(len(rest)) < size {
+			return data
+		}
+		data = append(data, rest[:size]...)
+		body = bytes.TrimPrefix(rest[size:], []byte("\r\n"))
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix, after string) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key  string `xml:"Key"`
+		Size int    `xml:"Size"`
+	}
+	var result struct {
+		XMLName               xml.Name  `xml:"ListBucketResult"`
+		Contents              []content `xml:"Contents"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+	}
+	if f.pageSize > 0 && len(keys) > f.pageSize {
+		keys = keys[:f.pageSize]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		result.Contents = append(result.Contents, content{Key: key, Size: len(f.objects[key])})
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newTestClient(srv *httptest.Server, bucket string) *Client {
+	return &Client{
+		Endpoint:        srv.URL,
+		Bucket:          bucket,
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+	}
+}
+
+// minPartSize is the smallest part size minio-go uploads in.
+const minPartSize = 5 << 20
+
+// multipartContent returns content that is uploaded in three parts of
+// minPartSize.
+func multipartContent() string {
+	return strings.Repeat("0123456789abcdef", (2*minPartSize+minPartSize/2)/16)
+}
+
+// s3Code returns the S3 error code of err, if it has one.
+func s3Code(err error) string {
+	var resp minio.ErrorResponse
+	if errors.As(err, &resp) {
+		return resp.Code
+	}
+	return ""
+}
+
+func writeTempFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "file.vcdbs")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	return path
+}
+
+func TestClient_PutListDelete(t *testing.T) {
+	fake, srv := newFakeS3(t, "saves")
+	fake.pageSize = 1
+	c := newTestClient(srv, "saves")
+	ctx := context.Background()
+
+	for _, key := range []string{"a/one.vcdbs", "a/two words.vcdbs", "b/three.vcdbs"} {
+		if err := c.PutFile(ctx, key, writeTempFile(t, "data:"+key)); err != nil {
+			t.Fatalf("PutFile(%q) failed: %v", key, err)
+		}
+	}
+	if got := string(fake.objects["a/two words.vcdbs"]); got != "data:a/two words.vcdbs" {
+		t.Errorf("stored content = %q", got)
+	}
+
+	objects, err := c.List(ctx, "a/")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(objects) != 2 || objects[0].Key != "a/one.vcdbs" || objects[1].Key != "a/two words.vcdbs" {
+		t.Errorf("List = %+v", objects)
+	}
+
+	if err := c.Delete(ctx, "a/one.vcdbs"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got := fake.keys(); len(got) != 2 || got[0] != "a/two words.vcdbs" {
+		t.Errorf("keys after delete = %q", got)
+	}
+}
+
+func TestClient_PutFileMultipart(t *testing.T) {
+	fake, srv := newFakeS3(t, "saves")
+	fake.sessionToken = "token"
+	c := newTestClient(srv, "saves")
+	c.SessionToken = "token"
+	c.partSize = minPartSize
+
+	content := multipartContent()
+	if err := c.PutFile(context.Background(), "world.vcdbs", writeTempFile(t, content)); err != nil {
+		t.Fatalf("PutFile failed: %v", err)
+	}
+	if got := string(fake.objects["world.vcdbs"]); got != content {
+		t.Errorf("stored content differs: %d bytes, want %d", len(got), len(content))
+	}
+	if fake.uploaded != 1 {
+		t.Errorf("%d multipart uploads started, want 1", fake.uploaded)
+	}
+	if len(fake.uploads) != 0 {
+		t.Errorf("%d multipart uploads left open", len(fake.uploads))
+	}
+}
+
+func TestClient_PutFileMultipartAbortsOnFailure(t *testing.T) {
+	fake, srv := newFakeS3(t, "saves")
+	fake.failPart = "2"
+	c := newTestClient(srv, "saves")
+	c.partSize = minPartSize
+
+	err := c.PutFile(context.Background(), "world.vcdbs", writeTempFile(t, multipartContent()))
+	if code := s3Code(err); code != "BadDigest" {
+		t.Errorf("PutFile error = %v, want the failed part's BadDigest", err)
+	}
+	if len(fake.uploads) != 0 {
+		t.Errorf("%d multipart uploads left open, want the failed one aborted", len(fake.uploads))
+	}
+	if got := fake.keys(); len(got) != 0 {
+		t.Errorf("keys = %q, want none", got)
+	}
+}
+
+func TestClient_SessionToken(t *testing.T) {
+	fake, srv := newFakeS3(t, "saves")
+	fake.sessionToken = "token"
+	c := newTestClient(srv, "saves")
+
+	err := c.PutFile(context.Background(), "x.vcdbs", writeTempFile(t, "data"))
+	if code := s3Code(err); code != "InvalidToken" {
+		t.Errorf("PutFile error without a session token = %v, want InvalidToken", err)
+	}
+
+	c = newTestClient(srv, "saves")
+	c.SessionToken = "token"
+	if err := c.PutFile(context.Background(), "x.vcdbs", writeTempFile(t, "data")); err != nil {
+		t.Errorf("PutFile with the session token failed: %v", err)
+	}
+}
+
+func TestClient_ErrorResponse(t *testing.T) {
+	_, srv := newFakeS3(t, "saves")
+	c := newTestClient(srv, "other")
+
+	err := c.PutFile(context.Background(), "x.vcdbs", writeTempFile(t, "data"))
+	if code := s3Code(err); code != "NoSuchBucket" {
+		t.Errorf("PutFile error = %v, want NoSuchBucket", err)
+	}
+}
+
+// recordingTransport answers every request with an empty object list and
+// records the URLs requested.
+type recordingTransport struct {
+	mu   sync.Mutex
+	urls []*url.URL
+}
+
+func (rt *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.urls = append(rt.urls, r.URL)
+	rt.mu.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/xml"}},
+		Body:       io.NopCloser(strings.NewReader("<ListBucketResult></ListBucketResult>")),
+		Request:    r,
+	}, nil
+}
+
+func TestClient_VirtualHostedURL(t *testing.T) {
+	rt := &recordingTransport{}
+	c := &Client{
+		Endpoint:        "https://s3.eu-central-1.amazonaws.com",
+		Region:          "eu-central-1",
+		Bucket:          "saves",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		Transport:       rt,
+	}
+
+	if _, err := c.List(context.Background(), "world/"); err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(rt.urls) == 0 {
+		t.Fatal("no request sent")
+	}
+	if got := rt.urls[0]; !strings.HasPrefix(got.Host, "saves.s3.") || got.Path != "/" {
+		t.Errorf("URL = %q, want the bucket as a subdomain", got)
+	}
+}
+
+func TestClient_InvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"", "minio:9000", "http://minio:9000/s3"} {
+		c := &Client{Endpoint: endpoint, Bucket: "saves"}
+		if err := c.Delete(context.Background(), "x.vcdbs"); err == nil || !strings.Contains(err.Error(), "invalid endpoint") {
+			t.Errorf("Delete with endpoint %q: error = %v, want invalid endpoint", endpoint, err)
+		}
+	}
+}
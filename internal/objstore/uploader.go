@@ -0,0 +1,67 @@
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Uploader stores raw backup files in a bucket under Prefix, keeping the
+// newest Keep of each save.
+type Uploader struct {
+	// Client is the bucket to upload to.
+	Client *Client
+
+	// Prefix is prepended to every key, e.g. "vintagestory/".
+	Prefix string
+
+	// Keep is how many uploads of each save are kept; older ones are
+	// deleted after each upload. Zero keeps them all, for buckets whose
+	// lifecycle rules expire old objects.
+	Keep int
+}
+
+// UploadBackup uploads the file at path as Prefix+name, then deletes the
+// oldest .vcdbs objects next to it beyond Keep. Names are expected to sort
+// chronologically within their directory. Returns the key uploaded to.
+func (u *Uploader) UploadBackup(ctx context.Context, filePath, name string) (string, error) {
+	key := u.Prefix + name
+	if err := u.Client.PutFile(ctx, key, filePath); err != nil {
+		return "", err
+	}
+
+	if u.Keep > 0 {
+		dir := ""
+		if i := strings.LastIndex(key, "/"); i >= 0 {
+			dir = key[:i+1]
+		}
+		if err := u.prune(ctx, dir); err != nil {
+			return key, fmt.Errorf("uploaded %s, but failed to remove old uploads: %w", key, err)
+		}
+	}
+	return key, nil
+}
+
+// prune deletes the oldest .vcdbs objects directly under dir beyond Keep.
+func (u *Uploader) prune(ctx context.Context, dir string) error {
+	objects, err := u.Client.List(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	var uploads []string
+	for _, o := range objects {
+		rest := strings.TrimPrefix(o.Key, dir)
+		if strings.HasSuffix(rest, ".vcdbs") && !strings.Contains(rest, "/") {
+			uploads = append(uploads, o.Key)
+		}
+	}
+
+	for len(uploads) > u.Keep {
+		if err := u.Client.Delete(ctx, uploads[0]); err != nil {
+			return err
+		}
+		uploads = uploads[1:]
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package objstore
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestUploader_KeepsNewest(t *testing.T) {
+	fake, srv := newFakeS3(t, "saves")
+	u := &Uploader{Client: newTestClient(srv, "saves"), Prefix: "vs/", Keep: 2}
+	ctx := context.Background()
+
+	// Objects in other directories or not named like uploads are left alone
+	other := newTestClient(srv, "saves")
+	other.PutFile(ctx, "vs/other/2025-01-01T00-00-00Z.vcdbs", writeTempFile(t, "x"))
+	other.PutFile(ctx, "vs/default/notes.txt", writeTempFile(t, "x"))
+
+	for _, name := range []string{
+		"default/2025-12-14T10-00-00Z.vcdbs",
+		"default/2025-12-14T11-00-00Z.vcdbs",
+		"default/2025-12-14T12-00-00Z.vcdbs",
+	} {
+		key, err := u.UploadBackup(ctx, writeTempFile(t, name), name)
+		if err != nil {
+			t.Fatalf("UploadBackup(%q) failed: %v", name, err)
+		}
+		if key != "vs/"+name {
+			t.Errorf("UploadBackup key = %q", key)
+		}
+	}
+
+	want := []string{
+		"vs/default/2025-12-14T11-00-00Z.vcdbs",
+		"vs/default/2025-12-14T12-00-00Z.vcdbs",
+		"vs/default/notes.txt",
+		"vs/other/2025-01-01T00-00-00Z.vcdbs",
+	}
+	if got := fake.keys(); !slices.Equal(got, want) {
+		t.Errorf("keys = %q, want %q", got, want)
+	}
+}
+
+func TestUploader_KeepAll(t *testing.T) {
+	fake, srv := newFakeS3(t, "saves")
+	u := &Uploader{Client: newTestClient(srv, "saves")}
+
+	for _, name := range []string{"a.vcdbs", "b.vcdbs", "c.vcdbs"} {
+		if _, err := u.UploadBackup(context.Background(), writeTempFile(t, name), name); err != nil {
+			t.Fatalf("UploadBackup(%q) failed: %v", name, err)
+		}
+	}
+	if got := fake.keys(); len(got) != 3 {
+		t.Errorf("keys = %q, want all 3 kept", got)
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAuditMaxSize is the size at which an audit log is rotated.
+	DefaultAuditMaxSize = 10 << 20
+
+	// DefaultAuditMaxFiles is how many rotated audit logs are kept.
+	DefaultAuditMaxFiles = 5
+)
+
+// Command sources recorded in the audit log.
+const (
+	SourceStdin       = "stdin"
+	SourceBackup      = "backup-manager"
+	SourceWatchdog    = "watchdog"
+	SourceCompaction  = "compaction"
+	SourceShutdown    = "shutdown"
+	SourcePlayerCheck = "player-check"
+
+	// SourceScript is followed by ":" and the script's path.
+	SourceScript = "script"
+)
+
+// AuditEntry is one line of the command audit log.
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Command string    `json:"command"`
+
+	// Result is "sent", "dropped" if the queue was full, or the send error.
+	Result string `json:"result"`
+}
+
+// AuditLog appends a JSON line for every command sent to the server. When the
+// file would grow past MaxSize, it is renamed to Path.1 (shifting older files
+// up to Path.MaxFiles) and a new one is started. It is safe for concurrent use.
+type AuditLog struct {
+	// Path is the audit log file. Its directory must exist.
+	Path string
+
+	// MaxSize is the size in bytes at which the log is rotated.
+	// Defaults to DefaultAuditMaxSize if not set.
+	MaxSize int64
+
+	// MaxFiles is how many rotated logs are kept.
+	// Defaults to DefaultAuditMaxFiles if not set.
+	MaxFiles int
+
+	// now returns the current time; tests replace it.
+	now func() time.Time
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Record appends an entry for cmd, sent on behalf of source. result is nil
+// for a command that was sent.
+func (a *AuditLog) Record(source, cmd string, result error) error {
+	entry := AuditEntry{Time: a.currentTime(), Source: source, Command: cmd, Result: "sent"}
+	if result != nil {
+		entry.Result = result.Error()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.open(); err != nil {
+		return err
+	}
+	if a.size > 0 && a.size+int64(len(line)) > a.maxSize() {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the audit log file. A later Record reopens it.
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// open opens the log for appending if it isn't open yet.
+func (a *AuditLog) open() error {
+	if a.file != nil {
+		return nil
+	}
+
+	f, err := os.OpenFile(a.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+
+	a.file = f
+	a.size = info.Size()
+	return nil
+}
+
+// rotate shifts the rotated logs up by one, dropping the oldest, moves the
+// current log to Path.1, and starts a new one.
+func (a *AuditLog) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	a.file = nil
+
+	maxFiles := a.maxFiles()
+	os.Remove(a.rotatedPath(maxFiles))
+	for i := maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(a.rotatedPath(i), a.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	}
+	if err := os.Rename(a.Path, a.rotatedPath(1)); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+
+	return a.open()
+}
+
+// rotatedPath returns the path of the n-th rotated log.
+func (a *AuditLog) rotatedPath(n int) string {
+	return a.Path + "." + strconv.Itoa(n)
+}
+
+func (a *AuditLog) maxSize() int64 {
+	if a.MaxSize > 0 {
+		return a.MaxSize
+	}
+	return DefaultAuditMaxSize
+}
+
+func (a *AuditLog) maxFiles() int {
+	if a.MaxFiles > 0 {
+		return a.MaxFiles
+	}
+	return DefaultAuditMaxFiles
+}
+
+// currentTime returns the time from the injected clock, or time.Now.
+func (a *AuditLog) currentTime() time.Time {
+	if a.now != nil {
+		return a.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readAudit returns the entries in an audit log file.
+func readAudit(t *testing.T, path string) []AuditEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestAuditLog_Record(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	a := &AuditLog{Path: path, now: func() time.Time { return at }}
+	defer a.Close()
+
+	if err := a.Record(SourceStdin, "/wipe", nil); err != nil {
+		t.Fatalf("Record() failed: %v", err)
+	}
+	if err := a.Record(SourceBackup, "/genbackup", errors.New("stdin closed")); err != nil {
+		t.Fatalf("Record() failed: %v", err)
+	}
+
+	// Appends to an existing log after reopening
+	a.Close()
+	if err := a.Record(SourceWatchdog, "/stats", nil); err != nil {
+		t.Fatalf("Record() failed: %v", err)
+	}
+
+	want := []AuditEntry{
+		{Time: at, Source: SourceStdin, Command: "/wipe", Result: "sent"},
+		{Time: at, Source: SourceBackup, Command: "/genbackup", Result: "stdin closed"},
+		{Time: at, Source: SourceWatchdog, Command: "/stats", Result: "sent"},
+	}
+	got := readAudit(t, path)
+	if len(got) != len(want) {
+		t.Fatalf("audit log has %d entries, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Source != want[i].Source ||
+			got[i].Command != want[i].Command || got[i].Result != want[i].Result {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestAuditLog_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a := &AuditLog{Path: path, MaxSize: 200, MaxFiles: 2}
+	defer a.Close()
+
+	for range 20 {
+		if err := a.Record(SourceStdin, "/giveblock game:gold 64", nil); err != nil {
+			t.Fatalf("Record() failed: %v", err)
+		}
+	}
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Errorf("expected %s: %v", filepath.Base(p), err)
+			continue
+		}
+		if info.Size() > 200 {
+			t.Errorf("%s is %d bytes, want at most MaxSize", filepath.Base(p), info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more than MaxFiles rotated logs kept")
+	}
+}
+
+func TestCommandQueue_Audit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit := &AuditLog{Path: path}
+	defer audit.Close()
+
+	sender := &mockCommandSender{}
+	cq := &CommandQueue{Sender: sender, MinDelay: time.Millisecond, Audit: audit}
+	cq.Start()
+
+	cq.SubmitFrom(SourceStdin, "/wipe")
+	cq.From(SourceBackup).SendCommand("/genbackup")
+	cq.Submit("/stats")
+	cq.Stop()
+
+	got := readAudit(t, path)
+	want := []struct{ source, cmd string }{
+		{SourceStdin, "/wipe"},
+		{SourceBackup, "/genbackup"},
+		{"unknown", "/stats"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("audit log has %d entries, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].Source != w.source || got[i].Command != w.cmd || got[i].Result != "sent" {
+			t.Errorf("entry %d = %+v, want %s from %s", i, got[i], w.cmd, w.source)
+		}
+	}
+}
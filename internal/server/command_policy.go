@@ -0,0 +1,130 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultMaxCommandLength is the longest command a channel with a
+// CommandPolicy may send, in bytes, if the policy doesn't set one.
+const DefaultMaxCommandLength = 1024
+
+// ErrCommandRejected is returned, wrapped, for commands a CommandPolicy
+// doesn't let through.
+var ErrCommandRejected = errors.New("command rejected")
+
+// CommandPolicy restricts the commands a channel, such as the console or a
+// script, may send to the server. Control characters in commands are
+// replaced with spaces, so one line can't smuggle in another, and commands
+// longer than MaxLength are rejected.
+//
+// Commands are matched by name, the first word, with or without its leading
+// slash and ignoring case: "stop" matches "/stop now". A command in Deny is
+// rejected. If Allow is set, only the commands in it are let through.
+//
+// A channel that authenticates its users can submit admins' commands under
+// a source of its own, such as "api:admin", with a more permissive policy.
+type CommandPolicy struct {
+	// Allow lists the only commands let through. Empty allows all.
+	Allow []string
+
+	// Deny lists commands that are rejected, even if allowed.
+	Deny []string
+
+	// MaxLength is the longest command let through, in bytes.
+	// Defaults to DefaultMaxCommandLength if not set.
+	MaxLength int
+}
+
+// Check returns cmd with control characters replaced, or an error wrapping
+// ErrCommandRejected if the policy doesn't let it through. A nil policy lets
+// everything through unchanged.
+func (p *CommandPolicy) Check(cmd string) (string, error) {
+	if p == nil {
+		return cmd, nil
+	}
+
+	cmd = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, cmd))
+
+	maxLength := p.MaxLength
+	if maxLength <= 0 {
+		maxLength = DefaultMaxCommandLength
+	}
+	if len(cmd) > maxLength {
+		return "", fmt.Errorf("%w: longer than %d bytes", ErrCommandRejected, maxLength)
+	}
+
+	name := commandName(cmd)
+	if name == "" {
+		return "", fmt.Errorf("%w: empty command", ErrCommandRejected)
+	}
+	if slices.ContainsFunc(p.Deny, func(denied string) bool { return commandName(denied) == name }) {
+		return "", fmt.Errorf("%w: /%s is not allowed", ErrCommandRejected, name)
+	}
+	if len(p.Allow) > 0 && !slices.ContainsFunc(p.Allow, func(allowed string) bool { return commandName(allowed) == name }) {
+		return "", fmt.Errorf("%w: /%s is not allowed", ErrCommandRejected, name)
+	}
+	return cmd, nil
+}
+
+// commandName returns the name cmd is matched by: its first word, without a
+// leading slash, in lower case.
+func commandName(cmd string) string {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(fields[0], "/"))
+}
+
+// ParseCommandPolicy parses a policy of semicolon-separated settings, such
+// as "deny=/stop,/wipe;max-length=256" or "allow=/announce,/time". The
+// settings are allow and deny, comma-separated commands, and max-length.
+func ParseCommandPolicy(s string) (*CommandPolicy, error) {
+	p := &CommandPolicy{}
+	for _, setting := range strings.Split(s, ";") {
+		setting = strings.TrimSpace(setting)
+		if setting == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(setting, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected key=value, got %q", setting)
+		}
+		switch key = strings.ToLower(strings.TrimSpace(key)); key {
+		case "allow", "deny":
+			var commands []string
+			for _, cmd := range strings.Split(value, ",") {
+				if cmd = strings.TrimSpace(cmd); cmd != "" {
+					commands = append(commands, cmd)
+				}
+			}
+			if len(commands) == 0 {
+				return nil, fmt.Errorf("no commands in %s", key)
+			}
+			if key == "allow" {
+				p.Allow = append(p.Allow, commands...)
+			} else {
+				p.Deny = append(p.Deny, commands...)
+			}
+		case "max-length":
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid max-length %q: must be a positive number of bytes", value)
+			}
+			p.MaxLength = n
+		default:
+			return nil, fmt.Errorf("unknown setting %q: expected allow, deny, or max-length", key)
+		}
+	}
+	return p, nil
+}
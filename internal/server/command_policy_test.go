@@ -0,0 +1,100 @@
+package server
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCommandPolicy_Check(t *testing.T) {
+	p := &CommandPolicy{Deny: []string{"/stop", "wipe"}, MaxLength: 20}
+	for cmd, want := range map[string]string{
+		"/announce hi":         "/announce hi",
+		"/time set\r\n/stop":   "/time set  /stop",
+		"  /say \x1b[31mred  ": "/say  [31mred",
+	} {
+		got, err := p.Check(cmd)
+		if err != nil || got != want {
+			t.Errorf("Check(%q) = %q, %v, want %q", cmd, got, err, want)
+		}
+	}
+	for _, cmd := range []string{"/stop", "STOP now", "/wipe", "\x00\r\n", "/announce this is far too long"} {
+		if _, err := p.Check(cmd); !errors.Is(err, ErrCommandRejected) {
+			t.Errorf("Check(%q) = %v, want ErrCommandRejected", cmd, err)
+		}
+	}
+
+	p = &CommandPolicy{Allow: []string{"/announce", "time"}}
+	if _, err := p.Check("/time set day"); err != nil {
+		t.Errorf("Check() of an allowed command = %v", err)
+	}
+	if _, err := p.Check("/op someone"); !errors.Is(err, ErrCommandRejected) {
+		t.Errorf("Check() of a command that isn't allowed = %v, want ErrCommandRejected", err)
+	}
+
+	var none *CommandPolicy
+	if got, err := none.Check("/stop\n"); err != nil || got != "/stop\n" {
+		t.Errorf("nil Check() = %q, %v, want the command unchanged", got, err)
+	}
+}
+
+func TestParseCommandPolicy(t *testing.T) {
+	got, err := ParseCommandPolicy("deny=/stop, /wipe ; allow=/announce;max-length=256")
+	if err != nil {
+		t.Fatalf("ParseCommandPolicy() failed: %v", err)
+	}
+	want := &CommandPolicy{Allow: []string{"/announce"}, Deny: []string{"/stop", "/wipe"}, MaxLength: 256}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseCommandPolicy() = %+v, want %+v", got, want)
+	}
+
+	for _, s := range []string{"deny", "deny=", "max-length=0", "max-length=x", "block=/stop"} {
+		if _, err := ParseCommandPolicy(s); err == nil {
+			t.Errorf("ParseCommandPolicy(%q) expected error", s)
+		}
+	}
+}
+
+func TestCommandQueue_Policies(t *testing.T) {
+	sender := &mockCommandSender{}
+	var mu sync.Mutex
+	var rejected []string
+	cq := &CommandQueue{
+		Sender:   sender,
+		MinDelay: time.Millisecond,
+		Policies: map[string]*CommandPolicy{
+			SourceStdin:  {Deny: []string{"/stop"}},
+			SourceScript: {Allow: []string{"/announce"}},
+		},
+		OnError: func(cmd string, err error) {
+			mu.Lock()
+			rejected = append(rejected, cmd)
+			mu.Unlock()
+		},
+	}
+	cq.Start()
+	defer cq.Stop()
+
+	cq.SubmitFrom(SourceStdin, "/stop")
+	cq.SubmitFrom(SourceStdin, "/announce\tbackup soon")
+	cq.SubmitFrom(SourceBackup, "/stop")
+	if err := cq.SendAndWait(SourceScript+":/gamedata/maintenance.txt", "/time set day"); !errors.Is(err, ErrCommandRejected) {
+		t.Errorf("SendAndWait() of a script command that isn't allowed = %v, want ErrCommandRejected", err)
+	}
+
+	commands := sender.waitForSent(t, 2)
+	var sent []string
+	for _, c := range commands {
+		sent = append(sent, c.cmd)
+	}
+	if want := []string{"/announce backup soon", "/stop"}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"/stop"}; !reflect.DeepEqual(rejected, want) {
+		t.Errorf("rejected %q, want %q", rejected, want)
+	}
+}
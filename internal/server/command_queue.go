@@ -1,8 +1,13 @@
 package server
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/clock"
 )
 
 const (
@@ -31,14 +36,43 @@ type CommandQueue struct {
 	// If nil, errors are silently dropped.
 	OnError func(cmd string, err error)
 
+	// Audit, if set, records every command with its source and result.
+	Audit *AuditLog
+
+	// Policies restrict the commands of untrusted channels, by source.
+	// A source such as "script:/path" is also looked up by the part before
+	// the colon. Commands from sources without a policy aren't restricted.
+	// Rejected commands are audited and reported to OnError, or returned by
+	// SendAndWait.
+	Policies map[string]*CommandPolicy
+
+	// Clock is used to space commands MinDelay apart. Defaults to
+	// clock.Real. This is primarily for testing.
+	Clock clock.Clock
+
 	mu           sync.Mutex
 	lastSentTime time.Time
 	started      bool
-	queue        chan string
+	queue        chan queuedCommand
 	done         chan struct{}
 	wg           sync.WaitGroup
 }
 
+// queuedCommand is a command waiting to be sent, with where it came from.
+// If result is set, the send error is delivered on it.
+type queuedCommand struct {
+	source string
+	cmd    string
+	result chan error
+}
+
+// ErrQueueStopped is returned by SendAndWait when the queue isn't running.
+var ErrQueueStopped = errors.New("command queue is not running")
+
+// errQueueFull is recorded in the audit log for commands dropped because the
+// queue was full.
+var errQueueFull = errors.New("dropped")
+
 // Start begins processing the command queue.
 // Must be called before submitting commands.
 func (cq *CommandQueue) Start() {
@@ -54,7 +88,7 @@ func (cq *CommandQueue) Start() {
 	}
 
 	// Buffer allows commands to be submitted without blocking
-	cq.queue = make(chan string, 100)
+	cq.queue = make(chan queuedCommand, 100)
 	cq.done = make(chan struct{})
 	cq.started = true
 
@@ -81,6 +115,12 @@ func (cq *CommandQueue) Stop() {
 // Commands are processed in order with the configured minimum delay.
 // Returns immediately without blocking (unless the queue buffer is full).
 func (cq *CommandQueue) Submit(cmd string) {
+	cq.SubmitFrom("", cmd)
+}
+
+// SubmitFrom is like Submit, recording source as the command's origin in the
+// audit log.
+func (cq *CommandQueue) SubmitFrom(source, cmd string) {
 	cq.mu.Lock()
 	if !cq.started {
 		cq.mu.Unlock()
@@ -89,16 +129,99 @@ func (cq *CommandQueue) Submit(cmd string) {
 	queue := cq.queue
 	cq.mu.Unlock()
 
+	cmd, err := cq.check(source, cmd)
+	if err != nil {
+		if cq.OnError != nil {
+			cq.OnError(cmd, err)
+		}
+		return
+	}
+
 	select {
-	case queue <- cmd:
+	case queue <- queuedCommand{source: source, cmd: cmd}:
 	default:
 		// Queue full, drop the command (shouldn't happen with reasonable usage)
+		cq.audit(source, cmd, errQueueFull)
 		if cq.OnError != nil {
 			cq.OnError(cmd, nil)
 		}
 	}
 }
 
+// SendAndWait queues a command like SubmitFrom and waits until it has been
+// sent, returning the send error. The command is dropped, and an error
+// returned, if the queue isn't running or is full.
+func (cq *CommandQueue) SendAndWait(source, cmd string) error {
+	cq.mu.Lock()
+	if !cq.started {
+		cq.mu.Unlock()
+		return ErrQueueStopped
+	}
+	queue := cq.queue
+	cq.mu.Unlock()
+
+	cmd, err := cq.check(source, cmd)
+	if err != nil {
+		return err
+	}
+
+	result := make(chan error, 1)
+	select {
+	case queue <- queuedCommand{source: source, cmd: cmd, result: result}:
+	default:
+		cq.audit(source, cmd, errQueueFull)
+		return fmt.Errorf("command queue is full")
+	}
+	return <-result
+}
+
+// From returns a CommandSender that submits commands to the queue on behalf
+// of source, for components that take a CommandSender.
+func (cq *CommandQueue) From(source string) CommandSender {
+	return sourcedSender{queue: cq, source: source}
+}
+
+// sourcedSender submits commands to a CommandQueue with a fixed source.
+type sourcedSender struct {
+	queue  *CommandQueue
+	source string
+}
+
+func (s sourcedSender) SendCommand(cmd string) error {
+	s.queue.SubmitFrom(s.source, cmd)
+	return nil
+}
+
+// check applies the policy of source to cmd, auditing rejected commands. It
+// returns the command to send, or cmd itself with the error it was rejected
+// with.
+func (cq *CommandQueue) check(source, cmd string) (string, error) {
+	policy, ok := cq.Policies[source]
+	if !ok {
+		channel, _, _ := strings.Cut(source, ":")
+		policy = cq.Policies[channel]
+	}
+	checked, err := policy.Check(cmd)
+	if err != nil {
+		cq.audit(source, cmd, err)
+		return cmd, err
+	}
+	return checked, nil
+}
+
+// audit records a command in the audit log, if one is configured.
+func (cq *CommandQueue) audit(source, cmd string, result error) {
+	if cq.Audit == nil {
+		return
+	}
+	if source == "" {
+		source = "unknown"
+	}
+	if err := cq.Audit.Record(source, cmd, result); err != nil {
+		fmt.Printf("WARNING: Failed to record command in audit log: %v\n", err)
+	}
+}
+
 // processLoop is the main loop that processes commands from the queue.
 func (cq *CommandQueue) processLoop() {
 	defer cq.wg.Done()
@@ -109,8 +232,8 @@ func (cq *CommandQueue) processLoop() {
 			// Drain remaining commands before exiting
 			cq.drainQueue()
 			return
-		case cmd := <-cq.queue:
-			cq.sendWithDelay(cmd)
+		case c := <-cq.queue:
+			cq.sendWithDelay(c)
 		}
 	}
 }
@@ -119,8 +242,8 @@ func (cq *CommandQueue) processLoop() {
 func (cq *CommandQueue) drainQueue() {
 	for {
 		select {
-		case cmd := <-cq.queue:
-			cq.sendWithDelay(cmd)
+		case c := <-cq.queue:
+			cq.sendWithDelay(c)
 		default:
 			return
 		}
@@ -128,28 +251,34 @@ func (cq *CommandQueue) drainQueue() {
 }
 
 // sendWithDelay sends a command after ensuring the minimum delay has elapsed.
-func (cq *CommandQueue) sendWithDelay(cmd string) {
+func (cq *CommandQueue) sendWithDelay(c queuedCommand) {
 	cq.mu.Lock()
 	lastSent := cq.lastSentTime
 	minDelay := cq.MinDelay
 	cq.mu.Unlock()
 
 	// Calculate how long to wait
-	elapsed := time.Since(lastSent)
+	clk := clock.Or(cq.Clock)
+	elapsed := clk.Now().Sub(lastSent)
 	if elapsed < minDelay {
-		time.Sleep(minDelay - elapsed)
+		<-clk.After(minDelay - elapsed)
 	}
 
 	// Send the command
-	err := cq.Sender.SendCommand(cmd)
+	err := cq.Sender.SendCommand(c.cmd)
+	cq.audit(c.source, c.cmd, err)
 
 	// Update last sent time
 	cq.mu.Lock()
-	cq.lastSentTime = time.Now()
+	cq.lastSentTime = clk.Now()
 	cq.mu.Unlock()
 
+	if c.result != nil {
+		c.result <- err
+		return
+	}
 	if err != nil && cq.OnError != nil {
-		cq.OnError(cmd, err)
+		cq.OnError(c.cmd, err)
 	}
 }
 
@@ -6,6 +6,8 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/renorris/vintagestory-restic/internal/clock"
 )
 
 // mockCommandSender records commands and optionally returns errors.
@@ -13,6 +15,7 @@ type mockCommandSender struct {
 	mu       sync.Mutex
 	commands []commandRecord
 	err      error
+	clock    clock.Clock
 }
 
 type commandRecord struct {
@@ -23,7 +26,7 @@ type commandRecord struct {
 func (m *mockCommandSender) SendCommand(cmd string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.commands = append(m.commands, commandRecord{cmd: cmd, time: time.Now()})
+	m.commands = append(m.commands, commandRecord{cmd: cmd, time: clock.Or(m.clock).Now()})
 	return m.err
 }
 
@@ -35,6 +38,19 @@ func (m *mockCommandSender) getCommands() []commandRecord {
 	return result
 }
 
+// waitForSent waits until the sender has received n commands.
+func (m *mockCommandSender) waitForSent(t *testing.T, n int) []commandRecord {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		commands := m.getCommands()
+		if len(commands) >= n || time.Now().After(deadline) {
+			return commands
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func TestCommandQueue_BasicSubmission(t *testing.T) {
 	sender := &mockCommandSender{}
 	cq := &CommandQueue{
@@ -60,11 +76,12 @@ func TestCommandQueue_BasicSubmission(t *testing.T) {
 }
 
 func TestCommandQueue_RateLimiting(t *testing.T) {
-	sender := &mockCommandSender{}
-	minDelay := 50 * time.Millisecond
+	clk := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	sender := &mockCommandSender{clock: clk}
 	cq := &CommandQueue{
 		Sender:   sender,
-		MinDelay: minDelay,
+		MinDelay: time.Second,
+		Clock:    clk,
 	}
 
 	cq.Start()
@@ -75,10 +92,13 @@ func TestCommandQueue_RateLimiting(t *testing.T) {
 	cq.Submit("cmd2")
 	cq.Submit("cmd3")
 
-	// Wait for all commands to be processed
-	time.Sleep(200 * time.Millisecond)
+	// The first command goes out at once; each of the others waits MinDelay
+	for i := 0; i < 2; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Second)
+	}
 
-	commands := sender.getCommands()
+	commands := sender.waitForSent(t, 3)
 	if len(commands) != 3 {
 		t.Fatalf("expected 3 commands, got %d", len(commands))
 	}
@@ -88,51 +108,47 @@ func TestCommandQueue_RateLimiting(t *testing.T) {
 		t.Errorf("commands out of order: %v", commands)
 	}
 
-	// Verify minimum delay between commands
+	// Verify the delay between commands
 	for i := 1; i < len(commands); i++ {
-		delay := commands[i].time.Sub(commands[i-1].time)
-		// Allow some tolerance for timing
-		if delay < minDelay-5*time.Millisecond {
-			t.Errorf("delay between command %d and %d was %v, expected at least %v",
-				i-1, i, delay, minDelay)
+		if delay := commands[i].time.Sub(commands[i-1].time); delay != time.Second {
+			t.Errorf("delay between command %d and %d was %v, expected %v", i-1, i, delay, time.Second)
 		}
 	}
 }
 
 func TestCommandQueue_NoDelayWhenIdle(t *testing.T) {
-	sender := &mockCommandSender{}
-	minDelay := 50 * time.Millisecond
+	clk := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	sender := &mockCommandSender{clock: clk}
 	cq := &CommandQueue{
 		Sender:   sender,
-		MinDelay: minDelay,
+		MinDelay: time.Second,
+		Clock:    clk,
 	}
 
 	cq.Start()
 	defer cq.Stop()
 
-	// Submit first command
 	cq.Submit("cmd1")
+	sender.waitForSent(t, 1)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		cq.mu.Lock()
+		sent := !cq.lastSentTime.IsZero()
+		cq.mu.Unlock()
+		if sent {
+			break
+		}
+	}
 
-	// Wait longer than minDelay for it to process
-	time.Sleep(100 * time.Millisecond)
-
-	// Now submit second command - should not be delayed
-	start := time.Now()
+	// Once MinDelay has passed, the next command isn't held back
+	clk.Advance(2 * time.Second)
 	cq.Submit("cmd2")
 
-	// Wait for processing
-	time.Sleep(50 * time.Millisecond)
-
-	commands := sender.getCommands()
+	commands := sender.waitForSent(t, 2)
 	if len(commands) != 2 {
 		t.Fatalf("expected 2 commands, got %d", len(commands))
 	}
-
-	// Second command should be processed quickly since we waited
-	elapsed := commands[1].time.Sub(start)
-	if elapsed > minDelay {
-		t.Errorf("second command took %v to process, expected less than %v since queue was idle",
-			elapsed, minDelay)
+	if delay := commands[1].time.Sub(commands[0].time); delay != 2*time.Second {
+		t.Errorf("second command was sent %v after the first, expected it at once after the idle 2s", delay)
 	}
 }
 
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ShutdownAction is one way of asking the server to stop, from the gentlest,
+// the /stop command, to the most forceful, SIGKILL.
+type ShutdownAction string
+
+const (
+	// ShutdownStop sends the /stop command.
+	ShutdownStop ShutdownAction = "stop"
+
+	// ShutdownInterrupt sends SIGINT (a Ctrl+Break event on Windows).
+	ShutdownInterrupt ShutdownAction = "sigint"
+
+	// ShutdownTerminate sends SIGTERM (on Windows, asks the process tree to
+	// close).
+	ShutdownTerminate ShutdownAction = "sigterm"
+
+	// ShutdownKill kills the server with SIGKILL (on Windows, terminates the
+	// process tree).
+	ShutdownKill ShutdownAction = "sigkill"
+)
+
+// DefaultShutdownTimeout is how long the server is given to stop before it
+// is killed.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// ShutdownStep is one step of a shutdown escalation.
+type ShutdownStep struct {
+	// Action is how the server is asked to stop.
+	Action ShutdownAction
+
+	// Wait is how long to wait for the server to exit before the next step.
+	// Zero moves on right away.
+	Wait time.Duration
+}
+
+// DefaultShutdownSteps sends /stop and SIGINT together and gives the server
+// DefaultShutdownTimeout to exit, as Stop does.
+var DefaultShutdownSteps = ShutdownTimeoutSteps(DefaultShutdownTimeout)
+
+// ShutdownTimeoutSteps returns DefaultShutdownSteps with timeout before the
+// server is killed.
+func ShutdownTimeoutSteps(timeout time.Duration) []ShutdownStep {
+	return []ShutdownStep{
+		{Action: ShutdownStop},
+		{Action: ShutdownInterrupt, Wait: timeout},
+	}
+}
+
+// ShutdownPolicy escalates from asking the server to stop to killing it,
+// one step at a time, until it exits.
+type ShutdownPolicy struct {
+	// Steps are taken in order while the server is still running. If it is
+	// still running after the last step's Wait, it is killed.
+	// Defaults to DefaultShutdownSteps if empty.
+	Steps []ShutdownStep
+
+	// OnEscalate is called before each step, including the final kill, that
+	// is taken because the server didn't exit within the previous step's
+	// Wait. Optional.
+	OnEscalate func(step ShutdownStep)
+}
+
+// Timeout returns the time the steps wait in total before the server is
+// killed.
+func (p *ShutdownPolicy) Timeout() time.Duration {
+	var total time.Duration
+	for _, step := range p.steps() {
+		total += step.Wait
+	}
+	return total
+}
+
+// steps returns Steps, or DefaultShutdownSteps if there are none.
+func (p *ShutdownPolicy) steps() []ShutdownStep {
+	if len(p.Steps) == 0 {
+		return DefaultShutdownSteps
+	}
+	return p.Steps
+}
+
+// Shutdown stops the server as policy escalates, and waits for it to exit.
+// If ctx is cancelled first, the server is killed and ctx.Err() returned.
+// A server that isn't running is left alone.
+func (s *Server) Shutdown(ctx context.Context, policy *ShutdownPolicy) error {
+	if policy == nil {
+		policy = &ShutdownPolicy{}
+	}
+	done := s.Done()
+
+	steps := slices.Concat(policy.steps(), []ShutdownStep{{Action: ShutdownKill}})
+	for i, step := range steps {
+		select {
+		case <-done:
+			return nil
+		default:
+		}
+
+		if i > 0 && steps[i-1].Wait > 0 && policy.OnEscalate != nil {
+			policy.OnEscalate(step)
+		}
+		s.shutdownAction(step.Action)
+		if step.Action == ShutdownKill {
+			break
+		}
+
+		if step.Wait > 0 {
+			timer := time.NewTimer(step.Wait)
+			select {
+			case <-done:
+				timer.Stop()
+				return nil
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				s.Kill()
+				<-done
+				return ctx.Err()
+			}
+		}
+	}
+
+	<-done
+	return nil
+}
+
+// shutdownAction takes action on the server. Errors are ignored: they mean
+// the server has already exited, or that the action can't reach it, in
+// which case the next step will.
+func (s *Server) shutdownAction(action ShutdownAction) {
+	switch action {
+	case ShutdownStop:
+		_ = s.proc.SendCommand(StopCommand)
+	case ShutdownInterrupt:
+		_ = s.Interrupt()
+	case ShutdownTerminate:
+		_ = s.Terminate()
+	case ShutdownKill:
+		s.Kill()
+	}
+}
+
+// ParseShutdownSteps parses a comma-separated list of actions, each with an
+// optional wait after a colon, such as "stop:20s,sigint:10s,sigterm:10s",
+// into shutdown steps. Actions are stop, sigint, sigterm, and sigkill.
+func ParseShutdownSteps(s string) ([]ShutdownStep, error) {
+	var steps []ShutdownStep
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, wait, hasWait := strings.Cut(field, ":")
+		step := ShutdownStep{Action: ShutdownAction(strings.ToLower(strings.TrimSpace(name)))}
+		switch step.Action {
+		case ShutdownStop, ShutdownInterrupt, ShutdownTerminate, ShutdownKill:
+		default:
+			return nil, fmt.Errorf("unknown shutdown action %q: expected %s, %s, %s, or %s",
+				name, ShutdownStop, ShutdownInterrupt, ShutdownTerminate, ShutdownKill)
+		}
+		if hasWait {
+			d, err := time.ParseDuration(strings.TrimSpace(wait))
+			if err != nil {
+				return nil, fmt.Errorf("invalid wait for %s: %w", step.Action, err)
+			}
+			if d < 0 {
+				return nil, fmt.Errorf("invalid wait for %s: must not be negative", step.Action)
+			}
+			step.Wait = d
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("no shutdown steps in %q", s)
+	}
+	return steps, nil
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startStubborn starts a server running script, which gets to set its traps,
+// and waits until it is ready.
+func startStubborn(t *testing.T, script string) *Server {
+	t.Helper()
+	s := &Server{ServerPath: "/bin/sh", Args: []string{"-c", script + `; echo ready; while true; do sleep 0.05; done`}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(s.Kill)
+	if _, err := s.WaitForPattern(ctx, "ready"); err != nil {
+		t.Fatalf("WaitForPattern failed: %v", err)
+	}
+	return s
+}
+
+func TestServer_Shutdown_Escalates(t *testing.T) {
+	s := startStubborn(t, `trap "" INT; trap "exit 7" TERM`)
+
+	var mu sync.Mutex
+	var escalated []ShutdownAction
+	policy := &ShutdownPolicy{
+		Steps: []ShutdownStep{
+			{Action: ShutdownStop},
+			{Action: ShutdownInterrupt, Wait: 100 * time.Millisecond},
+			{Action: ShutdownStop},
+			{Action: ShutdownTerminate, Wait: 5 * time.Second},
+		},
+		OnEscalate: func(step ShutdownStep) {
+			mu.Lock()
+			escalated = append(escalated, step.Action)
+			mu.Unlock()
+		},
+	}
+	if err := s.Shutdown(context.Background(), policy); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	if err := s.ExitError(); err == nil || err.Error() != "exit status 7" {
+		t.Errorf("expected exit status 7 from the TERM trap, got %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []ShutdownAction{ShutdownStop}; !slices.Equal(escalated, want) {
+		t.Errorf("escalated to %v, want %v", escalated, want)
+	}
+}
+
+func TestServer_Shutdown_Kills(t *testing.T) {
+	s := startStubborn(t, `trap "" INT TERM`)
+
+	var killed bool
+	policy := &ShutdownPolicy{
+		Steps: []ShutdownStep{{Action: ShutdownInterrupt, Wait: 50 * time.Millisecond}},
+		OnEscalate: func(step ShutdownStep) {
+			killed = step.Action == ShutdownKill
+		},
+	}
+	if err := s.Shutdown(context.Background(), policy); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if !killed || s.Running() {
+		t.Errorf("expected the server to be killed after the last step, killed = %v", killed)
+	}
+}
+
+func TestServer_Shutdown_Cancelled(t *testing.T) {
+	s := startStubborn(t, `trap "" INT TERM`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	policy := &ShutdownPolicy{Steps: []ShutdownStep{{Action: ShutdownInterrupt, Wait: time.Minute}}}
+	if err := s.Shutdown(ctx, policy); !errors.Is(err, context.Canceled) {
+		t.Errorf("Shutdown() = %v, want context.Canceled", err)
+	}
+	if s.Running() {
+		t.Error("expected a cancelled shutdown to kill the server")
+	}
+}
+
+func TestServer_Shutdown_NotRunning(t *testing.T) {
+	var s Server
+	if err := s.Shutdown(context.Background(), nil); err != nil {
+		t.Errorf("Shutdown() of a server that isn't running = %v", err)
+	}
+}
+
+func TestShutdownPolicy_Timeout(t *testing.T) {
+	if got := (&ShutdownPolicy{}).Timeout(); got != DefaultShutdownTimeout {
+		t.Errorf("default Timeout() = %v, want %v", got, DefaultShutdownTimeout)
+	}
+	policy := &ShutdownPolicy{Steps: []ShutdownStep{{ShutdownStop, 20 * time.Second}, {ShutdownTerminate, 10 * time.Second}}}
+	if got := policy.Timeout(); got != 30*time.Second {
+		t.Errorf("Timeout() = %v, want 30s", got)
+	}
+}
+
+func TestParseShutdownSteps(t *testing.T) {
+	got, err := ParseShutdownSteps("stop:20s, SIGINT ,sigterm:10s,sigkill")
+	if err != nil {
+		t.Fatalf("ParseShutdownSteps() failed: %v", err)
+	}
+	want := []ShutdownStep{
+		{ShutdownStop, 20 * time.Second},
+		{ShutdownInterrupt, 0},
+		{ShutdownTerminate, 10 * time.Second},
+		{ShutdownKill, 0},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseShutdownSteps() = %v, want %v", got, want)
+	}
+
+	for _, s := range []string{"", " , ", "stop:", "stop:5x", "stop:-1s", "sighup:1s"} {
+		if _, err := ParseShutdownSteps(s); err == nil {
+			t.Errorf("ParseShutdownSteps(%q) expected error", s)
+		}
+	}
+}
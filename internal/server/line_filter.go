@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LineFilter decides which server output lines are printed to the console.
+// It only affects what is displayed; internal subscribers still see every line.
+//
+// A line matching any Allow pattern is always printed. Otherwise, a line
+// matching any Drop pattern is suppressed. All other lines are printed.
+type LineFilter struct {
+	// Drop contains patterns for lines that should be suppressed.
+	Drop []*regexp.Regexp
+
+	// Allow contains patterns for lines that should always be printed,
+	// even if they also match a Drop pattern.
+	Allow []*regexp.Regexp
+}
+
+// NewLineFilter compiles the given drop and allow patterns into a LineFilter.
+func NewLineFilter(drop, allow []string) (*LineFilter, error) {
+	f := &LineFilter{}
+
+	for _, p := range drop {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid drop pattern %q: %w", p, err)
+		}
+		f.Drop = append(f.Drop, re)
+	}
+
+	for _, p := range allow {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow pattern %q: %w", p, err)
+		}
+		f.Allow = append(f.Allow, re)
+	}
+
+	return f, nil
+}
+
+// ShouldPrint returns true if the line should be printed to the console.
+// A nil LineFilter prints everything.
+func (f *LineFilter) ShouldPrint(line string) bool {
+	if f == nil {
+		return true
+	}
+
+	for _, re := range f.Allow {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+
+	for _, re := range f.Drop {
+		if re.MatchString(line) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParsePatternList splits a newline-separated list of patterns, ignoring
+// blank lines and surrounding whitespace.
+func ParsePatternList(s string) []string {
+	var patterns []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns
+}
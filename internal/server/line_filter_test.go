@@ -0,0 +1,60 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLineFilter_ShouldPrint(t *testing.T) {
+	f, err := NewLineFilter(
+		[]string{`\[Debug\]`, `SpammyMod`},
+		[]string{`SpammyMod.*ERROR`},
+	)
+	if err != nil {
+		t.Fatalf("NewLineFilter failed: %v", err)
+	}
+
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"12:00:00 [Server Notification] Saving world", true},
+		{"12:00:00 [Debug] chunk column loaded", false},
+		{"12:00:00 [Notification] SpammyMod: tick", false},
+		{"12:00:00 [Notification] SpammyMod: ERROR something broke", true},
+	}
+
+	for _, tt := range tests {
+		if got := f.ShouldPrint(tt.line); got != tt.want {
+			t.Errorf("ShouldPrint(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestLineFilter_NilPrintsEverything(t *testing.T) {
+	var f *LineFilter
+	if !f.ShouldPrint("anything") {
+		t.Error("nil LineFilter should print every line")
+	}
+}
+
+func TestNewLineFilter_InvalidPattern(t *testing.T) {
+	if _, err := NewLineFilter([]string{"[invalid"}, nil); err == nil {
+		t.Error("Expected error for invalid drop pattern")
+	}
+	if _, err := NewLineFilter(nil, []string{"(unclosed"}); err == nil {
+		t.Error("Expected error for invalid allow pattern")
+	}
+}
+
+func TestParsePatternList(t *testing.T) {
+	got := ParsePatternList("  \\[Debug\\]  \n\nSpammyMod\n  ")
+	want := []string{`\[Debug\]`, "SpammyMod"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParsePatternList() = %v, want %v", got, want)
+	}
+
+	if got := ParsePatternList(""); got != nil {
+		t.Errorf("ParsePatternList(\"\") = %v, want nil", got)
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultOutputBufferLines is how many lines an OutputPrinter holds while
+// stdout is slow when Limit isn't set.
+const DefaultOutputBufferLines = 10000
+
+// outputFlushTimeout bounds how long Stop waits for queued lines to be
+// printed, so a stdout that stays blocked can't hold up shutdown.
+const outputFlushTimeout = 2 * time.Second
+
+// OutputPrinter prints lines from a goroutine of its own, so a slow or
+// blocked stdout (e.g. a stalled Docker logging driver) doesn't hold up the
+// server's output handling, pattern detection, and player tracking. Once
+// Limit lines are waiting, the oldest are dropped; how many is printed when
+// output catches up. Call Start before Print and Stop when done.
+type OutputPrinter struct {
+	// W receives the lines. If nil, os.Stdout is used, looked up for each
+	// write since the console and timestamps replace it while running.
+	W io.Writer
+
+	// Limit is how many lines may wait to be printed. Defaults to
+	// DefaultOutputBufferLines.
+	Limit int
+
+	mu      sync.Mutex
+	queue   []string
+	dropped int
+	stopped bool
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+// Start starts the goroutine that prints queued lines.
+func (p *OutputPrinter) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.wake = make(chan struct{}, 1)
+	p.done = make(chan struct{})
+	go p.run()
+}
+
+// Print queues a line to be printed. It never blocks on the writer.
+// Lines printed after Stop are written directly.
+func (p *OutputPrinter) Print(line string) {
+	p.mu.Lock()
+	if p.stopped || p.wake == nil {
+		p.mu.Unlock()
+		fmt.Fprintln(p.writer(), line)
+		return
+	}
+	if len(p.queue) >= p.limit() {
+		p.queue = p.queue[1:]
+		p.dropped++
+	}
+	p.queue = append(p.queue, line)
+
+	// Sent under the lock, so Stop can't close wake in between
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	p.mu.Unlock()
+}
+
+// Stop prints the lines still queued, waiting at most a couple of seconds
+// for the writer, and stops the goroutine.
+func (p *OutputPrinter) Stop() {
+	p.mu.Lock()
+	if p.stopped || p.wake == nil {
+		p.mu.Unlock()
+		return
+	}
+	p.stopped = true
+	close(p.wake)
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+	case <-time.After(outputFlushTimeout):
+	}
+}
+
+// run writes queued lines in batches until Stop.
+func (p *OutputPrinter) run() {
+	defer close(p.done)
+	for {
+		_, ok := <-p.wake
+		p.flush()
+		if !ok {
+			return
+		}
+	}
+}
+
+// flush writes every queued line, preceded by a warning if any were dropped.
+func (p *OutputPrinter) flush() {
+	p.mu.Lock()
+	lines, dropped := p.queue, p.dropped
+	p.queue, p.dropped = nil, 0
+	p.mu.Unlock()
+
+	if len(lines) == 0 && dropped == 0 {
+		return
+	}
+	var b strings.Builder
+	if dropped > 0 {
+		fmt.Fprintf(&b, "WARNING: Dropped %d lines of server output because stdout couldn't keep up\n", dropped)
+	}
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	io.WriteString(p.writer(), b.String())
+}
+
+// writer returns W, or the current os.Stdout.
+func (p *OutputPrinter) writer() io.Writer {
+	if p.W != nil {
+		return p.W
+	}
+	return os.Stdout
+}
+
+// limit returns Limit, or its default if not set.
+func (p *OutputPrinter) limit() int {
+	if p.Limit > 0 {
+		return p.Limit
+	}
+	return DefaultOutputBufferLines
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedWriter blocks writes until its gate is opened, like a stalled stdout.
+type gatedWriter struct {
+	gate    chan struct{}
+	entered chan struct{}
+	once    sync.Once
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func newGatedWriter() *gatedWriter {
+	return &gatedWriter{gate: make(chan struct{}), entered: make(chan struct{})}
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.entered) })
+	<-w.gate
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *gatedWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestOutputPrinter_PrintsInOrder(t *testing.T) {
+	w := newGatedWriter()
+	close(w.gate)
+	p := &OutputPrinter{W: w}
+	p.Start()
+	for _, line := range []string{"one", "two", "three"} {
+		p.Print(line)
+	}
+	p.Stop()
+
+	if got := w.String(); got != "one\ntwo\nthree\n" {
+		t.Errorf("Output = %q, want the lines in order", got)
+	}
+}
+
+func TestOutputPrinter_DropsOldestWhenBlocked(t *testing.T) {
+	w := newGatedWriter()
+	p := &OutputPrinter{W: w, Limit: 3}
+	p.Start()
+
+	// The first line is taken by the writer, which then blocks
+	p.Print("first")
+	<-w.entered
+
+	printed := make(chan struct{})
+	go func() {
+		for _, line := range []string{"a", "b", "c", "d", "e"} {
+			p.Print(line)
+		}
+		close(printed)
+	}()
+	select {
+	case <-printed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Print blocked on a stalled writer")
+	}
+
+	close(w.gate)
+	p.Stop()
+
+	got := w.String()
+	want := "first\nWARNING: Dropped 2 lines of server output because stdout couldn't keep up\nc\nd\ne\n"
+	if got != want {
+		t.Errorf("Output = %q, want %q", got, want)
+	}
+}
+
+func TestOutputPrinter_StopDoesNotHangOnBlockedWriter(t *testing.T) {
+	w := newGatedWriter()
+	defer close(w.gate)
+	p := &OutputPrinter{W: w}
+	p.Start()
+	p.Print("stuck")
+	<-w.entered
+
+	start := time.Now()
+	p.Stop()
+	if elapsed := time.Since(start); elapsed > outputFlushTimeout+time.Second {
+		t.Errorf("Stop took %v with a blocked writer", elapsed)
+	}
+}
+
+func TestOutputPrinter_PrintsDirectlyWhenNotStarted(t *testing.T) {
+	var buf strings.Builder
+	p := &OutputPrinter{W: &buf}
+	p.Print("line")
+	if buf.String() != "line\n" {
+		t.Errorf("Output = %q, want %q", buf.String(), "line\n")
+	}
+}
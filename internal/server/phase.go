@@ -0,0 +1,135 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Phase is how far a server has got in starting up.
+type Phase int
+
+const (
+	// PhaseStopped means the server process isn't running.
+	PhaseStopped Phase = iota
+
+	// PhaseStarting means the process has been launched but hasn't started
+	// loading the game yet.
+	PhaseStarting
+
+	// PhaseLoading means the server is loading its mods and assets.
+	PhaseLoading
+
+	// PhaseWorldLoading means the server is loading the savegame and
+	// generating the spawn area, which can take many minutes for a new
+	// world.
+	PhaseWorldLoading
+
+	// PhaseReady means the server has fully booted (see HasBooted).
+	PhaseReady
+)
+
+// String returns the name of p as used in configuration, e.g. "loading".
+func (p Phase) String() string {
+	switch p {
+	case PhaseStopped:
+		return "stopped"
+	case PhaseStarting:
+		return "starting"
+	case PhaseLoading:
+		return "loading"
+	case PhaseWorldLoading:
+		return "world"
+	case PhaseReady:
+		return "ready"
+	}
+	return fmt.Sprintf("Phase(%d)", int(p))
+}
+
+// Description returns a short description of p for progress messages, e.g.
+// "loading the world".
+func (p Phase) Description() string {
+	switch p {
+	case PhaseStarting:
+		return "starting up"
+	case PhaseLoading:
+		return "loading mods and assets"
+	case PhaseWorldLoading:
+		return "loading the world"
+	case PhaseReady:
+		return "ready"
+	}
+	return p.String()
+}
+
+// ParsePhase parses a phase name as returned by Phase.String.
+func ParsePhase(s string) (Phase, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for p := PhaseStopped; p <= PhaseReady; p++ {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown server phase %q (expected starting, loading, world, or ready)", s)
+}
+
+// phasePatterns match the output lines that show the server entering each
+// phase before PhaseReady, latest phase first. The server logs each run
+// phase it enters; older versions only log the loading steps themselves.
+var phasePatterns = []struct {
+	phase Phase
+	re    *regexp.Regexp
+}{
+	{PhaseWorldLoading, regexp.MustCompile(`(?i)runphase (LoadGamePre|GameReady|LoadGame|WorldReady)\b|loading savegame|pregenerat|spawn chunks|world generat`)},
+	{PhaseLoading, regexp.MustCompile(`(?i)runphase (LoadAssets|AssetsFinalize)\b|loading assets|mods? (loaded|found)`)},
+}
+
+// detectPhase returns the phase line shows the server entering, if any.
+func detectPhase(line string) (Phase, bool) {
+	for _, p := range phasePatterns {
+		if p.re.MatchString(line) {
+			return p.phase, true
+		}
+	}
+	return 0, false
+}
+
+// Phase returns how far the server has got in starting up. Phases only move
+// forward until the server is started again.
+func (s *Server) Phase() Phase {
+	if !s.proc.Running() {
+		return PhaseStopped
+	}
+	if s.proc.HasBooted() {
+		return PhaseReady
+	}
+	return Phase(s.phase.Load())
+}
+
+// PhaseSince returns when the server entered its current phase, or the zero
+// time if it isn't running.
+func (s *Server) PhaseSince() time.Time {
+	if !s.proc.Running() {
+		return time.Time{}
+	}
+	return time.Unix(0, s.phaseSince.Load())
+}
+
+// enterPhase moves the server on to phase, calling OnPhase, unless it is
+// already there or further along.
+func (s *Server) enterPhase(phase Phase) {
+	for {
+		current := s.phase.Load()
+		if int32(phase) <= current {
+			return
+		}
+		if s.phase.CompareAndSwap(current, int32(phase)) {
+			break
+		}
+	}
+	s.phaseSince.Store(time.Now().UnixNano())
+	if s.OnPhase != nil {
+		s.OnPhase(phase)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDetectPhase(t *testing.T) {
+	tests := []struct {
+		line  string
+		phase Phase
+		ok    bool
+	}{
+		{"21.3.2025 12:00:00 [Server Event] Entering runphase LoadAssets", PhaseLoading, true},
+		{"[Server Notification] Loading assets...", PhaseLoading, true},
+		{"21.3.2025 12:00:05 [Server Event] Entering runphase LoadGamePre", PhaseWorldLoading, true},
+		{"[Server Notification] Loading savegame", PhaseWorldLoading, true},
+		{"[Server Event] Pregenerating spawn chunks", PhaseWorldLoading, true},
+		{"[Server Event] Entering runphase Configuration", 0, false},
+		{"[Server Notification] Player joined", 0, false},
+	}
+	for _, tt := range tests {
+		phase, ok := detectPhase(tt.line)
+		if phase != tt.phase || ok != tt.ok {
+			t.Errorf("detectPhase(%q) = %v, %v; want %v, %v", tt.line, phase, ok, tt.phase, tt.ok)
+		}
+	}
+}
+
+func TestParsePhase(t *testing.T) {
+	for p := PhaseStopped; p <= PhaseReady; p++ {
+		if got, err := ParsePhase(p.String()); err != nil || got != p {
+			t.Errorf("ParsePhase(%q) = %v, %v; want %v", p.String(), got, err, p)
+		}
+	}
+	if _, err := ParsePhase("booting"); err == nil {
+		t.Error("ParsePhase(\"booting\") expected error")
+	}
+}
+
+func TestServer_OnPhase(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "phase_test.sh")
+	scriptContent := `#!/bin/sh
+echo "Entering runphase LoadAssets"
+echo "Entering runphase LoadGamePre"
+echo "Entering runphase LoadAssets"
+echo "Dedicated Server now running"
+sleep 10
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	var mu sync.Mutex
+	var phases []Phase
+	booted := make(chan struct{})
+	s := &Server{
+		ServerPath: "/bin/sh",
+		Args:       []string{scriptPath},
+		OnPhase: func(phase Phase) {
+			mu.Lock()
+			phases = append(phases, phase)
+			mu.Unlock()
+		},
+		OnBoot: func() { close(booted) },
+	}
+
+	if s.Phase() != PhaseStopped {
+		t.Errorf("Phase() before Start = %v, want stopped", s.Phase())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() {
+		s.Kill()
+		<-s.Done()
+	}()
+
+	select {
+	case <-booted:
+	case <-ctx.Done():
+		t.Fatal("Server did not boot")
+	}
+
+	if s.Phase() != PhaseReady {
+		t.Errorf("Phase() after boot = %v, want ready", s.Phase())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// Phases only move forward
+	want := []Phase{PhaseLoading, PhaseWorldLoading, PhaseReady}
+	if !slices.Equal(phases, want) {
+		t.Errorf("OnPhase called with %v, want %v", phases, want)
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// PipeCommander sends commands to a server it doesn't run by writing them to
+// a named pipe the server reads its console input from, e.g. one created
+// with mkfifo and redirected to the server's stdin. It opens the pipe on the
+// first command, keeps it open, and reopens it after a failure.
+type PipeCommander struct {
+	// Path is the named pipe.
+	Path string
+
+	mu   sync.Mutex
+	pipe *os.File
+}
+
+// SendCommand writes cmd to the pipe, followed by a newline. If nothing is
+// reading the pipe, for example because the server isn't running, it fails
+// instead of waiting.
+func (p *PipeCommander) SendCommand(cmd string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reused := p.pipe != nil
+	err := p.write(cmd)
+	if err != nil && reused {
+		// The server may have restarted and be reading from a new open of
+		// the pipe
+		err = p.write(cmd)
+	}
+	return err
+}
+
+// Close closes the pipe, if it is open.
+func (p *PipeCommander) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pipe == nil {
+		return nil
+	}
+	err := p.pipe.Close()
+	p.pipe = nil
+	return err
+}
+
+// write writes cmd to the pipe, opening it first if needed. On failure the
+// pipe is closed, so the next command opens it afresh. Must be called with
+// mu held.
+func (p *PipeCommander) write(cmd string) error {
+	if p.pipe == nil {
+		// Without O_NONBLOCK, opening blocks until the server opens the
+		// other end
+		pipe, err := os.OpenFile(p.Path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err != nil {
+			return fmt.Errorf("failed to open command pipe %s: %w", p.Path, err)
+		}
+		p.pipe = pipe
+	}
+
+	if _, err := p.pipe.WriteString(cmd + "\n"); err != nil {
+		p.pipe.Close()
+		p.pipe = nil
+		return fmt.Errorf("failed to write to command pipe %s: %w", p.Path, err)
+	}
+	return nil
+}
+
+// Ensure PipeCommander implements CommandSender at compile time.
+var _ CommandSender = (*PipeCommander)(nil)
@@ -0,0 +1,45 @@
+//go:build !windows
+
+package server
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestPipeCommander_SendCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "console")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		t.Skipf("mkfifo not supported: %v", err)
+	}
+
+	p := &PipeCommander{Path: path}
+	defer p.Close()
+
+	// Nothing is reading the pipe yet
+	if err := p.SendCommand("/genbackup"); err == nil {
+		t.Fatal("SendCommand() succeeded with no reader")
+	}
+
+	reader, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatalf("Failed to open pipe for reading: %v", err)
+	}
+	defer reader.Close()
+
+	for _, cmd := range []string{"/genbackup", "/stats"} {
+		if err := p.SendCommand(cmd); err != nil {
+			t.Fatalf("SendCommand(%q) failed: %v", cmd, err)
+		}
+	}
+
+	scanner := bufio.NewScanner(reader)
+	for _, want := range []string{"/genbackup", "/stats"} {
+		if !scanner.Scan() || scanner.Text() != want {
+			t.Errorf("Read %q from pipe, want %q (%v)", scanner.Text(), want, scanner.Err())
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package server
+
+// runtimePath is the dotnet runtime the server DLL runs on.
+const runtimePath = "/usr/bin/dotnet"
+
+// defaultServerCommand runs the server DLL with the system dotnet runtime.
+func defaultServerCommand(args []string) (string, []string) {
+	return runtimePath, append([]string{"/serverbinaries/VintagestoryServer.dll"}, args...)
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package server
+
+import "path/filepath"
+
+// runtimePath is empty: the Windows server is a self-contained executable.
+const runtimePath = ""
+
+// defaultServerCommand runs the native Windows server executable.
+func defaultServerCommand(args []string) (string, []string) {
+	return filepath.Join(`\serverbinaries`, "VintagestoryServer.exe"), args
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultRCONTimeout is how long an RCON connection, login, or command may
+// take when RCONClient.Timeout isn't set.
+const DefaultRCONTimeout = 10 * time.Second
+
+// Source RCON packet types. The server's RCON mods speak this protocol.
+const (
+	rconTypeResponseValue = 0
+	rconTypeExecCommand   = 2
+	rconTypeAuthResponse  = 2
+	rconTypeAuth          = 3
+)
+
+// rconMaxPacketSize bounds the packets accepted from the server. Responses
+// are split into 4 KiB packets by the protocol, so this leaves plenty of room.
+const rconMaxPacketSize = 1 << 20
+
+// ErrRCONAuth is returned when the server rejects the RCON password.
+var ErrRCONAuth = errors.New("rcon authentication failed")
+
+// RCONClient sends commands to the server over a Source RCON connection
+// instead of stdin. It connects and logs in on the first command, keeps the
+// connection open, and reconnects after a failure.
+type RCONClient struct {
+	// Address is the server's RCON host and port, e.g. "127.0.0.1:42425".
+	Address string
+
+	// Password is the RCON password.
+	Password string
+
+	// Timeout bounds connecting, logging in, and each command.
+	// Defaults to DefaultRCONTimeout if not set.
+	Timeout time.Duration
+
+	// OnResponse is called with the server's response to each command, if
+	// it isn't empty. Optional.
+	OnResponse func(cmd, response string)
+
+	mu     sync.Mutex
+	conn   net.Conn
+	nextID int32
+}
+
+// SendCommand runs cmd on the server and waits for its response. If the
+// connection from an earlier command turns out to have been closed, for
+// example because the server restarted, the command is sent once more over
+// a new connection.
+func (c *RCONClient) SendCommand(cmd string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reused := c.conn != nil
+	response, err := c.exec(cmd)
+	if err != nil && reused && isConnectionClosed(err) {
+		response, err = c.exec(cmd)
+	}
+	if err != nil {
+		return err
+	}
+
+	if response != "" && c.OnResponse != nil {
+		c.OnResponse(cmd, response)
+	}
+	return nil
+}
+
+// Close closes the connection, if one is open.
+func (c *RCONClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// exec sends cmd over the open connection, connecting first if needed. On
+// failure the connection is dropped, so the next command starts afresh.
+// Must be called with mu held.
+func (c *RCONClient) exec(cmd string) (string, error) {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return "", err
+		}
+	}
+
+	response, err := c.roundTrip(rconTypeExecCommand, cmd, rconTypeResponseValue)
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return "", fmt.Errorf("rcon command failed: %w", err)
+	}
+	return response.body, nil
+}
+
+// connect opens a connection and logs in. Must be called with mu held.
+func (c *RCONClient) connect() error {
+	conn, err := net.DialTimeout("tcp", c.Address, c.timeout())
+	if err != nil {
+		return fmt.Errorf("failed to connect to rcon at %s: %w", c.Address, err)
+	}
+	c.conn = conn
+
+	// The server answers a login with an empty response value, then the
+	// auth response carrying the request ID, or -1 if the password is wrong
+	response, err := c.roundTrip(rconTypeAuth, c.Password, rconTypeAuthResponse)
+	if err == nil && response.id == -1 {
+		err = ErrRCONAuth
+	}
+	if err != nil {
+		conn.Close()
+		c.conn = nil
+		if errors.Is(err, ErrRCONAuth) {
+			return err
+		}
+		return fmt.Errorf("failed to log in to rcon at %s: %w", c.Address, err)
+	}
+	return nil
+}
+
+// Ensure RCONClient implements CommandSender at compile time.
+var _ CommandSender = (*RCONClient)(nil)
+
+// rconPacket is a single Source RCON packet.
+type rconPacket struct {
+	id   int32
+	typ  int32
+	body string
+}
+
+// roundTrip sends a packet and reads packets until one of the wanted type
+// arrives that answers it. Must be called with mu held.
+func (c *RCONClient) roundTrip(typ int32, body string, want int32) (rconPacket, error) {
+	c.nextID++
+	if c.nextID <= 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout())); err != nil {
+		return rconPacket{}, err
+	}
+	if err := writeRCONPacket(c.conn, rconPacket{id: id, typ: typ, body: body}); err != nil {
+		return rconPacket{}, err
+	}
+
+	for {
+		p, err := readRCONPacket(c.conn)
+		if err != nil {
+			return rconPacket{}, err
+		}
+		if p.typ == want && (p.id == id || (typ == rconTypeAuth && p.id == -1)) {
+			return p, nil
+		}
+	}
+}
+
+func (c *RCONClient) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultRCONTimeout
+}
+
+// writeRCONPacket writes p: its length, ID, type, and body, followed by the
+// body's terminator and an empty string, all little-endian.
+func writeRCONPacket(w io.Writer, p rconPacket) error {
+	buf := make([]byte, 12, 14+len(p.body))
+	binary.LittleEndian.PutUint32(buf[0:], uint32(10+len(p.body)))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(p.id))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(p.typ))
+	buf = append(buf, p.body...)
+	buf = append(buf, 0, 0)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readRCONPacket reads one packet written as by writeRCONPacket.
+func readRCONPacket(r io.Reader) (rconPacket, error) {
+	var size int32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return rconPacket{}, err
+	}
+	if size < 10 || size > rconMaxPacketSize {
+		return rconPacket{}, fmt.Errorf("invalid rcon packet size %d", size)
+	}
+
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return rconPacket{}, err
+	}
+	return rconPacket{
+		id:   int32(binary.LittleEndian.Uint32(buf[0:])),
+		typ:  int32(binary.LittleEndian.Uint32(buf[4:])),
+		body: string(trimNulls(buf[8:])),
+	}, nil
+}
+
+// trimNulls removes the terminators after a packet body.
+func trimNulls(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// isConnectionClosed reports whether err means the peer closed the
+// connection before answering.
+func isConnectionClosed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRCONServer accepts RCON connections, checks the password, and answers
+// each command with "ran <command>".
+type fakeRCONServer struct {
+	t        *testing.T
+	listener net.Listener
+	password string
+
+	mu          sync.Mutex
+	commands    []string
+	connections int
+	// dropAfter closes each connection after this many commands, if set.
+	dropAfter int
+}
+
+func newFakeRCONServer(t *testing.T, password string) *fakeRCONServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &fakeRCONServer{t: t, listener: l, password: password}
+	t.Cleanup(func() { l.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeRCONServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.connections++
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRCONServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	handled := 0
+	for {
+		p, err := readRCONPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p.typ {
+		case rconTypeAuth:
+			id := p.id
+			if p.body != s.password {
+				id = -1
+			}
+			writeRCONPacket(conn, rconPacket{id: p.id, typ: rconTypeResponseValue})
+			writeRCONPacket(conn, rconPacket{id: id, typ: rconTypeAuthResponse})
+		case rconTypeExecCommand:
+			s.mu.Lock()
+			s.commands = append(s.commands, p.body)
+			dropAfter := s.dropAfter
+			s.mu.Unlock()
+
+			writeRCONPacket(conn, rconPacket{id: p.id, typ: rconTypeResponseValue, body: "ran " + p.body})
+			handled++
+			if dropAfter > 0 && handled >= dropAfter {
+				return
+			}
+		}
+	}
+}
+
+func (s *fakeRCONServer) getCommands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *fakeRCONServer) getConnections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+func TestRCONClient_SendCommand(t *testing.T) {
+	srv := newFakeRCONServer(t, "secret")
+
+	var responses []string
+	c := &RCONClient{
+		Address:  srv.listener.Addr().String(),
+		Password: "secret",
+		OnResponse: func(cmd, response string) {
+			responses = append(responses, response)
+		},
+	}
+	defer c.Close()
+
+	for _, cmd := range []string{"/genbackup", "/stats"} {
+		if err := c.SendCommand(cmd); err != nil {
+			t.Fatalf("SendCommand(%q) failed: %v", cmd, err)
+		}
+	}
+
+	if got := srv.getCommands(); len(got) != 2 || got[0] != "/genbackup" || got[1] != "/stats" {
+		t.Errorf("server received %q", got)
+	}
+	if len(responses) != 2 || responses[0] != "ran /genbackup" {
+		t.Errorf("responses = %q", responses)
+	}
+	if n := srv.getConnections(); n != 1 {
+		t.Errorf("connections = %d, want the connection to be reused", n)
+	}
+}
+
+func TestRCONClient_WrongPassword(t *testing.T) {
+	srv := newFakeRCONServer(t, "secret")
+
+	c := &RCONClient{Address: srv.listener.Addr().String(), Password: "wrong"}
+	defer c.Close()
+
+	if err := c.SendCommand("/stats"); !errors.Is(err, ErrRCONAuth) {
+		t.Errorf("SendCommand error = %v, want %v", err, ErrRCONAuth)
+	}
+	if got := srv.getCommands(); len(got) != 0 {
+		t.Errorf("command was sent despite failed login: %q", got)
+	}
+}
+
+func TestRCONClient_Reconnects(t *testing.T) {
+	srv := newFakeRCONServer(t, "secret")
+	srv.dropAfter = 1
+
+	c := &RCONClient{Address: srv.listener.Addr().String(), Password: "secret"}
+	defer c.Close()
+
+	if err := c.SendCommand("/first"); err != nil {
+		t.Fatalf("first SendCommand failed: %v", err)
+	}
+	// Give the server time to close the connection
+	time.Sleep(50 * time.Millisecond)
+	if err := c.SendCommand("/second"); err != nil {
+		t.Fatalf("second SendCommand failed: %v", err)
+	}
+
+	if got := srv.getCommands(); len(got) != 2 || got[1] != "/second" {
+		t.Errorf("server received %q", got)
+	}
+	if n := srv.getConnections(); n != 2 {
+		t.Errorf("connections = %d, want 2", n)
+	}
+}
+
+func TestRCONClient_Unreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	c := &RCONClient{Address: addr, Password: "secret", Timeout: time.Second}
+	if err := c.SendCommand("/stats"); err == nil {
+		t.Error("expected an error when nothing is listening")
+	}
+}
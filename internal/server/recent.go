@@ -0,0 +1,79 @@
+package server
+
+import "sync"
+
+// DefaultRecentOutputSize is how many lines of output a Server keeps for
+// RecentOutput when RecentOutputSize isn't set.
+const DefaultRecentOutputSize = 1000
+
+// outputRing keeps the most recent lines of output in a fixed-size ring.
+type outputRing struct {
+	mu    sync.Mutex
+	lines []string
+	next  int  // index the next line is written to
+	full  bool // whether the ring has wrapped
+}
+
+// resize sets how many lines the ring keeps, keeping the newest lines.
+func (r *outputRing) resize(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if size == len(r.lines) {
+		return
+	}
+	kept := r.lastLocked(size)
+	r.lines = make([]string, size)
+	copy(r.lines, kept)
+	r.next = len(kept) % size
+	r.full = len(kept) == size
+}
+
+// add records a line, replacing the oldest one if the ring is full.
+func (r *outputRing) add(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.lines) == 0 {
+		return
+	}
+	r.lines[r.next] = line
+	r.next++
+	if r.next == len(r.lines) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// last returns up to n of the newest lines, oldest first.
+func (r *outputRing) last(n int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastLocked(n)
+}
+
+func (r *outputRing) lastLocked(n int) []string {
+	count := r.next
+	if r.full {
+		count = len(r.lines)
+	}
+	n = min(n, count)
+	if n <= 0 {
+		return nil
+	}
+
+	out := make([]string, 0, n)
+	start := r.next - n
+	if start < 0 {
+		out = append(out, r.lines[len(r.lines)+start:]...)
+		start = 0
+	}
+	return append(out, r.lines[start:r.next]...)
+}
+
+// RecentOutput returns up to the last n lines the server printed, oldest
+// first, including lines hidden from the console. Lines from before a
+// restart are kept, so the output leading up to a crash is still available.
+func (s *Server) RecentOutput(n int) []string {
+	return s.recent.last(n)
+}
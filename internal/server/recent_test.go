@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestOutputRing(t *testing.T) {
+	var r outputRing
+	r.resize(3)
+
+	if got := r.last(10); got != nil {
+		t.Errorf("empty ring: got %v", got)
+	}
+
+	r.add("a")
+	r.add("b")
+	if got := r.last(10); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("before wrapping: got %v", got)
+	}
+
+	r.add("c")
+	r.add("d")
+	r.add("e")
+	if got := r.last(10); !slices.Equal(got, []string{"c", "d", "e"}) {
+		t.Errorf("after wrapping: got %v", got)
+	}
+	if got := r.last(2); !slices.Equal(got, []string{"d", "e"}) {
+		t.Errorf("last(2): got %v", got)
+	}
+	if got := r.last(0); got != nil {
+		t.Errorf("last(0): got %v", got)
+	}
+}
+
+func TestOutputRing_Resize(t *testing.T) {
+	var r outputRing
+	r.resize(4)
+	for i := range 6 {
+		r.add(fmt.Sprint(i))
+	}
+
+	r.resize(2)
+	if got := r.last(10); !slices.Equal(got, []string{"4", "5"}) {
+		t.Errorf("after shrinking: got %v", got)
+	}
+
+	r.resize(3)
+	r.add("6")
+	r.add("7")
+	if got := r.last(10); !slices.Equal(got, []string{"5", "6", "7"}) {
+		t.Errorf("after growing: got %v", got)
+	}
+}
+
+// TestServer_RecentOutput tests that output is kept across restarts.
+func TestServer_RecentOutput(t *testing.T) {
+	s := &Server{
+		ServerPath:       "/bin/sh",
+		Args:             []string{"-c", "echo one; echo two; echo three"},
+		RecentOutputSize: 4,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	s.Wait()
+	if got := s.RecentOutput(2); !slices.Equal(got, []string{"two", "three"}) {
+		t.Errorf("RecentOutput(2) = %v", got)
+	}
+
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Second Start failed: %v", err)
+	}
+	s.Wait()
+	if got := s.RecentOutput(10); !slices.Equal(got, []string{"three", "one", "two", "three"}) {
+		t.Errorf("RecentOutput(10) after restart = %v", got)
+	}
+}
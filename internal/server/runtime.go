@@ -0,0 +1,50 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// DetectRuntime checks that the dotnet runtime used by the default server
+// command is installed and returns its path and the newest .NET runtime
+// version it provides. Both are empty on platforms where the server doesn't
+// need a separate runtime.
+func DetectRuntime(ctx context.Context) (path, version string, err error) {
+	if runtimePath == "" {
+		return "", "", nil
+	}
+
+	path, err = exec.LookPath(runtimePath)
+	if err != nil {
+		return "", "", fmt.Errorf("dotnet runtime not found: %w", err)
+	}
+
+	output, err := exec.CommandContext(ctx, path, "--list-runtimes").Output()
+	if err != nil {
+		return path, "", fmt.Errorf("failed to list dotnet runtimes: %w", err)
+	}
+
+	version = parseNETCoreVersion(string(output))
+	if version == "" {
+		return path, "", fmt.Errorf("dotnet at %s has no Microsoft.NETCore.App runtime installed", path)
+	}
+	return path, version, nil
+}
+
+// parseNETCoreVersion returns the last Microsoft.NETCore.App version in the
+// output of `dotnet --list-runtimes`, which lists versions in ascending order.
+// Lines look like "Microsoft.NETCore.App 8.0.11 [/usr/share/dotnet/shared/...]".
+func parseNETCoreVersion(output string) string {
+	var version string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "Microsoft.NETCore.App" {
+			version = fields[1]
+		}
+	}
+	return version
+}
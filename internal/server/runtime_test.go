@@ -0,0 +1,42 @@
+package server
+
+import "testing"
+
+func TestParseNETCoreVersion(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name: "single runtime",
+			output: "Microsoft.AspNetCore.App 8.0.11 [/usr/share/dotnet/shared/Microsoft.AspNetCore.App]\n" +
+				"Microsoft.NETCore.App 8.0.11 [/usr/share/dotnet/shared/Microsoft.NETCore.App]\n",
+			want: "8.0.11",
+		},
+		{
+			name: "newest of several",
+			output: "Microsoft.NETCore.App 7.0.20 [/usr/share/dotnet/shared/Microsoft.NETCore.App]\n" +
+				"Microsoft.NETCore.App 8.0.11 [/usr/share/dotnet/shared/Microsoft.NETCore.App]\n",
+			want: "8.0.11",
+		},
+		{
+			name:   "only ASP.NET",
+			output: "Microsoft.AspNetCore.App 8.0.11 [/usr/share/dotnet/shared/Microsoft.AspNetCore.App]\n",
+			want:   "",
+		},
+		{
+			name:   "empty",
+			output: "",
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseNETCoreVersion(tt.output); got != tt.want {
+				t.Errorf("parseNETCoreVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
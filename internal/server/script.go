@@ -0,0 +1,76 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ScriptLine is a command read from a script file.
+type ScriptLine struct {
+	// Line is the 1-based line number in the file.
+	Line int
+
+	// Command is the server command, without surrounding whitespace.
+	Command string
+}
+
+// ParseScript reads server commands, one per line. Blank lines and lines
+// starting with # are skipped. Launcher commands (starting with !) are
+// rejected, so scripts can't start compactions or other scripts.
+func ParseScript(r io.Reader) ([]ScriptLine, error) {
+	var lines []ScriptLine
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		cmd := strings.TrimSpace(scanner.Text())
+		if cmd == "" || strings.HasPrefix(cmd, "#") {
+			continue
+		}
+		if strings.HasPrefix(cmd, "!") {
+			return nil, fmt.Errorf("line %d: launcher command %s can't be used in a script", n, strings.Fields(cmd)[0])
+		}
+		lines = append(lines, ScriptLine{Line: n, Command: cmd})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// LoadScript reads and parses the script file at path.
+func LoadScript(path string) ([]ScriptLine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open script: %w", err)
+	}
+	defer f.Close()
+
+	lines, err := ParseScript(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return lines, nil
+}
+
+// RunScript sends each line through the queue in order, waiting for each to
+// be sent so the queue's pacing applies and failures can be attributed to
+// their line. Failed lines are reported to onError and the rest still run.
+// Returns the number of lines that failed; lines not sent because ctx was
+// cancelled count as failed.
+func (cq *CommandQueue) RunScript(ctx context.Context, source string, lines []ScriptLine, onError func(ScriptLine, error)) (failed int) {
+	for i, line := range lines {
+		if ctx.Err() != nil {
+			return failed + len(lines) - i
+		}
+		if err := cq.SendAndWait(source, line.Command); err != nil {
+			failed++
+			if onError != nil {
+				onError(line, err)
+			}
+		}
+	}
+	return failed
+}
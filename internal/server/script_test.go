@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseScript(t *testing.T) {
+	script := `# World setup
+/time set day
+
+  /worldconfig temporalStorms off  
+/whitelist add alice
+`
+	lines, err := ParseScript(strings.NewReader(script))
+	if err != nil {
+		t.Fatalf("ParseScript() failed: %v", err)
+	}
+
+	want := []ScriptLine{
+		{Line: 2, Command: "/time set day"},
+		{Line: 4, Command: "/worldconfig temporalStorms off"},
+		{Line: 5, Command: "/whitelist add alice"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("ParseScript() = %v, want %v", lines, want)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d = %+v, want %+v", i, lines[i], want[i])
+		}
+	}
+}
+
+func TestParseScript_RejectsLauncherCommands(t *testing.T) {
+	_, err := ParseScript(strings.NewReader("/time set day\n!compact\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ParseScript() error = %v, want a line 2 error", err)
+	}
+}
+
+// failingSender fails the commands in fail.
+type failingSender struct {
+	mu   sync.Mutex
+	sent []string
+	fail map[string]bool
+}
+
+func (s *failingSender) SendCommand(cmd string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, cmd)
+	if s.fail[cmd] {
+		return errors.New("broken pipe")
+	}
+	return nil
+}
+
+func TestCommandQueue_RunScript(t *testing.T) {
+	sender := &failingSender{fail: map[string]bool{"/bad": true}}
+	cq := &CommandQueue{Sender: sender, MinDelay: 10 * time.Millisecond}
+	cq.Start()
+	defer cq.Stop()
+
+	lines := []ScriptLine{{1, "/one"}, {2, "/bad"}, {4, "/two"}}
+	var failedLines []int
+	start := time.Now()
+	failed := cq.RunScript(context.Background(), SourceScript+":setup.txt", lines, func(line ScriptLine, err error) {
+		failedLines = append(failedLines, line.Line)
+	})
+
+	if failed != 1 || len(failedLines) != 1 || failedLines[0] != 2 {
+		t.Errorf("RunScript() = %d failed on lines %v, want 1 on line 2", failed, failedLines)
+	}
+	if got := strings.Join(sender.sent, " "); got != "/one /bad /two" {
+		t.Errorf("sent %q, want every line in order", got)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("RunScript() took %v, want the queue's pacing between commands", elapsed)
+	}
+}
+
+func TestCommandQueue_SendAndWait_Stopped(t *testing.T) {
+	cq := &CommandQueue{Sender: &mockCommandSender{}}
+	if err := cq.SendAndWait(SourceStdin, "/help"); !errors.Is(err, ErrQueueStopped) {
+		t.Errorf("SendAndWait() error = %v, want ErrQueueStopped", err)
+	}
+
+	// A cancelled script counts its unsent lines as failed
+	cq.Start()
+	defer cq.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if failed := cq.RunScript(ctx, SourceScript, []ScriptLine{{1, "/a"}, {2, "/b"}}, nil); failed != 2 {
+		t.Errorf("RunScript() with a cancelled context = %d failed, want 2", failed)
+	}
+}
@@ -1,48 +1,56 @@
 // Package server provides a wrapper for managing the Vintage Story server process.
-// It handles stdin/stdout pipe management, signal propagation via contexts, and
-// provides an intuitive API for sending commands and awaiting output patterns.
+// The process supervision itself (pipes, boot detection, graceful stop and
+// kill) lives in pkg/supervisor; this package adds the Vintage Story command
+// line, boot pattern, stop command, and output conventions on top of it.
 package server
 
 import (
-	"bufio"
 	"context"
-	"errors"
-	"fmt"
-	"io"
-	"os"
-	"os/exec"
 	"regexp"
-	"strings"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/supervisor"
 )
 
 // ErrServerNotRunning is returned when attempting operations on a server that isn't running.
-var ErrServerNotRunning = errors.New("server is not running")
+var ErrServerNotRunning = supervisor.ErrNotRunning
 
 // ErrPatternTimeout is returned when WaitForPattern times out.
-var ErrPatternTimeout = errors.New("timed out waiting for pattern")
+var ErrPatternTimeout = supervisor.ErrPatternTimeout
 
 // ErrServerExited is returned when the server exits unexpectedly while waiting for a pattern.
-var ErrServerExited = errors.New("server exited unexpectedly")
+var ErrServerExited = supervisor.ErrExited
 
 // OutputHandler is a callback function for handling server output lines.
 // Return false to unsubscribe from further output.
-type OutputHandler func(line string) bool
+type OutputHandler = supervisor.OutputHandler
 
 // BootPattern is the pattern that indicates the server has fully booted.
 const BootPattern = "Dedicated Server now running"
 
+// StopCommand is the console command that shuts the server down gracefully.
+const StopCommand = "/stop"
+
+// bootRegexp matches BootPattern anywhere in a line.
+var bootRegexp = regexp.MustCompile(regexp.QuoteMeta(BootPattern))
+
+// backupCompleteRegexp matches lines ending with BackupCompletePattern.
+var backupCompleteRegexp = regexp.MustCompile(regexp.QuoteMeta(BackupCompletePattern) + `$`)
+
 // Server wraps a Vintage Story server process and provides methods for
 // interacting with its stdin/stdout streams.
 type Server struct {
 	// ServerPath is the path to the server executable.
-	// If empty, defaults to using '/usr/bin/dotnet /serverbinaries/VintagestoryServer.dll'.
+	// If empty, defaults to '/usr/bin/dotnet /serverbinaries/VintagestoryServer.dll',
+	// or to '\serverbinaries\VintagestoryServer.exe' on Windows.
 	// This allows tests to override the command while production uses dotnet.
 	ServerPath string
 
 	// WorkingDir is the working directory for the server process.
-	// If empty, uses the directory containing the server executable.
+	// If empty, the server runs in the launcher's working directory.
 	WorkingDir string
 
 	// Args contains additional command-line arguments for the server.
@@ -54,27 +62,53 @@ type Server struct {
 
 	// OnOutput is called for each line of output from the server.
 	// This is useful for logging or monitoring. It runs in a separate goroutine.
+	// Its return value is ignored. Consumers that come and go, or that
+	// shouldn't know about each other, use AddOutputListener instead.
 	OnOutput OutputHandler
 
 	// OnBoot is called exactly once when the server has fully booted.
 	// This is triggered when the "Dedicated Server now running" pattern is detected.
 	OnBoot func()
 
-	cmd     *exec.Cmd
-	stdin   io.WriteCloser
-	stdout  io.ReadCloser
-	stderr  io.ReadCloser
-	done    chan struct{}
-	err     error
-	errLock sync.RWMutex
-
-	outputMu       sync.RWMutex
-	outputHandlers []OutputHandler
-
-	started   bool
-	mu        sync.Mutex
-	hasBooted atomic.Bool
-	bootOnce  sync.Once
+	// OnPhase is called each time the server enters a later phase of
+	// starting up: PhaseLoading, PhaseWorldLoading, and finally PhaseReady,
+	// just before OnBoot. Phases the server's output doesn't show are
+	// skipped. Optional.
+	OnPhase func(phase Phase)
+
+	// OnReadError is called when a line of server output is truncated or
+	// reading the output fails. See supervisor.Process.OnReadError.
+	OnReadError func(err error)
+
+	// RecentOutputSize is how many lines of output are kept for RecentOutput.
+	// Defaults to DefaultRecentOutputSize if not set.
+	RecentOutputSize int
+
+	// mu serializes Start, so the process is only reconfigured while it
+	// isn't running.
+	mu   sync.Mutex
+	proc supervisor.Process
+
+	// gameVersion holds the version from the startup banner, as a string.
+	gameVersion atomic.Value
+
+	// phase holds the startup Phase, and phaseSince when it was entered in
+	// Unix nanoseconds.
+	phase      atomic.Int32
+	phaseSince atomic.Int64
+
+	// recent holds the latest output lines.
+	recent outputRing
+
+	// listenersMu guards listeners.
+	listenersMu sync.Mutex
+	listeners   []outputListener
+}
+
+// outputListener is an output handler registered with AddOutputListener.
+type outputListener struct {
+	id string
+	fn OutputHandler
 }
 
 // Start launches the server process and begins reading its output.
@@ -83,199 +117,170 @@ type Server struct {
 //
 // Start returns immediately after the process is launched. Use WaitForPattern
 // to wait for the server to be ready.
+//
+// A server whose process has exited may be started again. The boot state is
+// reset, so OnBoot is called again once the new process has booted.
 func (s *Server) Start(ctx context.Context) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.started {
-		return errors.New("server already started")
+	// The output goroutines of a previous process have finished once it is
+	// no longer running, so its configuration is safe to replace
+	if !s.proc.Running() {
+		s.configure()
+		s.phase.Store(int32(PhaseStarting))
+		s.phaseSince.Store(time.Now().UnixNano())
 	}
+	return s.proc.Start(ctx)
+}
 
-	// Create the command
+// configure sets up the supervised process from the server's fields.
+func (s *Server) configure() {
 	// If ServerPath is set, use it (for tests/backward compatibility)
-	// Otherwise, use dotnet to run the Vintage Story server DLL
+	// Otherwise, run the Vintage Story server the platform's usual way
 	if s.ServerPath != "" {
-		s.cmd = exec.Command(s.ServerPath, s.Args...)
+		s.proc.Path, s.proc.Args = s.ServerPath, s.Args
 	} else {
-		args := append([]string{"/serverbinaries/VintagestoryServer.dll"}, s.Args...)
-		s.cmd = exec.Command("/usr/bin/dotnet", args...)
-	}
-	if s.WorkingDir != "" {
-		s.cmd.Dir = s.WorkingDir
-	}
-	if s.Env != nil {
-		s.cmd.Env = append(os.Environ(), s.Env...)
+		s.proc.Path, s.proc.Args = defaultServerCommand(s.Args)
 	}
-
-	// Set up stdin pipe
-	stdin, err := s.cmd.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stdin pipe: %w", err)
-	}
-	s.stdin = stdin
-
-	// Set up stdout pipe
-	stdout, err := s.cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	s.proc.Dir = s.WorkingDir
+	s.proc.Env = s.Env
+	s.proc.BootPattern = bootRegexp
+	s.proc.StopCommand = StopCommand
+	s.proc.OnBoot = s.handleBoot
+	s.proc.OnOutput = s.handleOutput
+	s.proc.OnReadError = s.OnReadError
+
+	size := s.RecentOutputSize
+	if size <= 0 {
+		size = DefaultRecentOutputSize
 	}
-	s.stdout = stdout
-
-	// Set up stderr pipe (merge with stdout for unified output handling)
-	stderr, err := s.cmd.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stderr pipe: %w", err)
-	}
-	s.stderr = stderr
-
-	// Initialize done channel
-	s.done = make(chan struct{})
+	s.recent.resize(size)
+}
 
-	// Start the process
-	if err := s.cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start server: %w", err)
+// handleBoot moves the server on to PhaseReady and calls OnBoot.
+func (s *Server) handleBoot() {
+	s.enterPhase(PhaseReady)
+	if s.OnBoot != nil {
+		s.OnBoot()
 	}
-
-	s.started = true
-
-	// Start goroutines for reading output
-	go s.readOutput(s.stdout, "[stdout]")
-	go s.readOutput(s.stderr, "[stderr]")
-
-	// Start goroutine to wait for process exit
-	go s.waitForExit()
-
-	// Start goroutine to handle context cancellation
-	go s.handleContextCancel(ctx)
-
-	return nil
 }
 
-// readOutput reads lines from the given reader and dispatches them to handlers.
-func (s *Server) readOutput(r io.Reader, prefix string) {
-	scanner := bufio.NewScanner(r)
-	// Increase buffer size for potentially long log lines
-	const maxScanTokenSize = 1024 * 1024 // 1MB
-	buf := make([]byte, 64*1024)
-	scanner.Buffer(buf, maxScanTokenSize)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		// Check for boot pattern and set hasBooted flag (only once)
-		if strings.Contains(line, BootPattern) {
-			s.bootOnce.Do(func() {
-				s.hasBooted.Store(true)
-				if s.OnBoot != nil {
-					s.OnBoot()
-				}
-			})
-		}
+// handleOutput records the game version, the startup phase, and the line
+// itself, and passes the line on to OnOutput.
+func (s *Server) handleOutput(line string) bool {
+	s.recent.add(line)
 
-		// Call the main output handler if set
-		if s.OnOutput != nil {
-			s.OnOutput(line)
+	// The version banner and loading steps come before the boot pattern
+	if !s.proc.HasBooted() {
+		if version, ok := parseGameVersion(line); ok {
+			s.gameVersion.Store(version)
 		}
+		if phase, ok := detectPhase(line); ok {
+			s.enterPhase(phase)
+		}
+	}
 
-		// Call registered handlers
-		s.dispatchToHandlers(line)
+	if s.OnOutput != nil {
+		s.OnOutput(line)
 	}
+	s.dispatchToListeners(line)
+	return true
 }
 
-// dispatchToHandlers sends the line to all registered output handlers.
-func (s *Server) dispatchToHandlers(line string) {
-	s.outputMu.Lock()
-	defer s.outputMu.Unlock()
-
-	// Filter handlers that return false (want to unsubscribe)
-	stillActive := s.outputHandlers[:0]
-	for _, handler := range s.outputHandlers {
-		if handler(line) {
-			stillActive = append(stillActive, handler)
+// AddOutputListener registers fn to be called with each line of output from
+// the server, after OnOutput, until it returns false or is removed with
+// RemoveOutputListener. Listeners are called in the order they were added,
+// from the same goroutine as OnOutput, and keep receiving output across
+// restarts. Adding a listener with the id of an existing one replaces it in
+// place.
+func (s *Server) AddOutputListener(id string, fn OutputHandler) {
+	s.listenersMu.Lock()
+	defer s.listenersMu.Unlock()
+
+	for i := range s.listeners {
+		if s.listeners[i].id == id {
+			s.listeners[i].fn = fn
+			return
 		}
 	}
-	s.outputHandlers = stillActive
+	s.listeners = append(s.listeners, outputListener{id: id, fn: fn})
 }
 
-// addHandler registers an output handler that will receive all output lines.
-func (s *Server) addHandler(handler OutputHandler) {
-	s.outputMu.Lock()
-	defer s.outputMu.Unlock()
-	s.outputHandlers = append(s.outputHandlers, handler)
-}
+// RemoveOutputListener unregisters the listener added with id, if any. It
+// may be called from a listener; a line already being dispatched may still
+// reach the removed listener.
+func (s *Server) RemoveOutputListener(id string) {
+	s.listenersMu.Lock()
+	defer s.listenersMu.Unlock()
 
-// waitForExit waits for the process to exit and records any error.
-func (s *Server) waitForExit() {
-	err := s.cmd.Wait()
-	s.errLock.Lock()
-	s.err = err
-	s.errLock.Unlock()
-	close(s.done)
+	s.listeners = slices.DeleteFunc(s.listeners, func(l outputListener) bool {
+		return l.id == id
+	})
 }
 
-// handleContextCancel watches for context cancellation and gracefully stops the server.
-func (s *Server) handleContextCancel(ctx context.Context) {
-	select {
-	case <-ctx.Done():
-		// Context cancelled - attempt graceful shutdown via /stop command
-		// The caller is responsible for managing timeouts and escalation to SIGKILL
-		s.Stop()
-	case <-s.done:
-		// Process exited on its own
+// dispatchToListeners passes line to each listener, dropping those that
+// return false.
+func (s *Server) dispatchToListeners(line string) {
+	s.listenersMu.Lock()
+	listeners := slices.Clone(s.listeners)
+	s.listenersMu.Unlock()
+
+	var done []string
+	for _, l := range listeners {
+		if !l.fn(line) {
+			done = append(done, l.id)
+		}
+	}
+	for _, id := range done {
+		s.RemoveOutputListener(id)
 	}
 }
 
 // Stop attempts to gracefully stop the server by sending the /stop command
-// followed by SIGINT. This does not wait for the server to exit - use Wait()
+// followed by SIGINT (a Ctrl+Break event on Windows). This does not wait for the server to exit - use Wait()
 // or Done() for that. The caller is responsible for managing timeouts and
 // escalating to Kill() if needed.
 func (s *Server) Stop() {
-	// Try sending /stop command first (Vintage Story server command)
-	_ = s.SendCommand("/stop")
+	s.proc.Stop()
+}
 
-	// Also send SIGINT for processes that don't respond to /stop
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if s.cmd != nil && s.cmd.Process != nil {
-		s.cmd.Process.Signal(os.Interrupt)
-	}
+// Interrupt sends SIGINT to the server (a Ctrl+Break event on Windows),
+// without the /stop command.
+func (s *Server) Interrupt() error {
+	return s.proc.Interrupt()
+}
+
+// Terminate asks the server to exit with SIGTERM (on Windows, the process
+// tree is asked to close, without forcing it).
+func (s *Server) Terminate() error {
+	return s.proc.Terminate()
 }
 
-// Kill forcefully terminates the server process with SIGKILL.
-// This should be used when graceful shutdown times out.
+// Kill forcefully terminates the server process with SIGKILL (on Windows,
+// the whole process tree is terminated). This should be used when graceful
+// shutdown times out.
 func (s *Server) Kill() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if s.cmd != nil && s.cmd.Process != nil {
-		s.cmd.Process.Kill()
-	}
+	s.proc.Kill()
+}
+
+// Pause suspends the server process with SIGSTOP. It returns
+// errors.ErrUnsupported on platforms without SIGSTOP.
+// The caller must ensure Resume is called, or the server will stay frozen.
+func (s *Server) Pause() error {
+	return s.proc.Pause()
+}
+
+// Resume continues a server process previously suspended with Pause.
+func (s *Server) Resume() error {
+	return s.proc.Resume()
 }
 
 // SendCommand sends a command to the server's stdin pipe.
 // The command is written followed by a newline, and the pipe is flushed.
 // Returns ErrServerNotRunning if the server is not running.
 func (s *Server) SendCommand(cmd string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if !s.started || s.stdin == nil {
-		return ErrServerNotRunning
-	}
-
-	// Check if server has already exited
-	select {
-	case <-s.done:
-		return ErrServerNotRunning
-	default:
-	}
-
-	// Write the command with newline
-	_, err := fmt.Fprintln(s.stdin, cmd)
-	if err != nil {
-		return fmt.Errorf("failed to send command: %w", err)
-	}
-
-	return nil
+	return s.proc.SendCommand(cmd)
 }
 
 // WaitForPattern waits until a line matching the given regex pattern appears in
@@ -287,12 +292,7 @@ func (s *Server) SendCommand(cmd string) error {
 // Returns the first matching line, or an error if the context expires or
 // the server exits before a match is found.
 func (s *Server) WaitForPattern(ctx context.Context, pattern string) (string, error) {
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return "", fmt.Errorf("invalid pattern: %w", err)
-	}
-
-	return s.WaitForRegex(ctx, re)
+	return s.proc.WaitForPattern(ctx, pattern)
 }
 
 // WaitForRegex waits until a line matching the given compiled regex appears in
@@ -301,181 +301,58 @@ func (s *Server) WaitForPattern(ctx context.Context, pattern string) (string, er
 // Returns the first matching line, or an error if the context expires or
 // the server exits before a match is found.
 func (s *Server) WaitForRegex(ctx context.Context, re *regexp.Regexp) (string, error) {
-	// Check if server is running
-	select {
-	case <-s.done:
-		return "", ErrServerNotRunning
-	default:
-	}
-
-	matchCh := make(chan string, 1)
-	doneCh := make(chan struct{})
-	defer close(doneCh)
-
-	// Register handler to watch for pattern
-	s.addHandler(func(line string) bool {
-		select {
-		case <-doneCh:
-			return false // Unsubscribe
-		default:
-		}
-
-		if re.MatchString(line) {
-			select {
-			case matchCh <- line:
-			default:
-			}
-			return false // Unsubscribe after match
-		}
-		return true // Keep listening
-	})
-
-	// Wait for match, context cancellation, or server exit
-	select {
-	case line := <-matchCh:
-		return line, nil
-	case <-ctx.Done():
-		if ctx.Err() == context.DeadlineExceeded {
-			return "", ErrPatternTimeout
-		}
-		return "", ctx.Err()
-	case <-s.done:
-		// Check if we got a match before the server exited
-		select {
-		case line := <-matchCh:
-			return line, nil
-		default:
-			return "", ErrServerExited
-		}
-	}
+	return s.proc.WaitForRegex(ctx, re)
 }
 
 // Wait blocks until the server process exits.
 // Returns the exit error from the process, or nil if it exited cleanly.
 func (s *Server) Wait() error {
-	s.mu.Lock()
-	if !s.started {
-		s.mu.Unlock()
-		return ErrServerNotRunning
-	}
-	s.mu.Unlock()
-
-	<-s.done
-
-	s.errLock.RLock()
-	defer s.errLock.RUnlock()
-	return s.err
+	return s.proc.Wait()
 }
 
 // Done returns a channel that is closed when the server exits.
 func (s *Server) Done() <-chan struct{} {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if s.done == nil {
-		// Return a closed channel if not started
-		ch := make(chan struct{})
-		close(ch)
-		return ch
-	}
-	return s.done
+	return s.proc.Done()
 }
 
 // Running returns true if the server is currently running.
 func (s *Server) Running() bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if !s.started || s.done == nil {
-		return false
-	}
-
-	select {
-	case <-s.done:
-		return false
-	default:
-		return true
-	}
+	return s.proc.Running()
 }
 
 // HasBooted returns true if the server has fully booted.
 // This is determined by detecting the "Dedicated Server now running" pattern
-// in the server output. Once set, this flag cannot be unset.
+// in the server output. Once set, the flag stays set until the server is
+// started again.
 func (s *Server) HasBooted() bool {
-	return s.hasBooted.Load()
+	return s.proc.HasBooted()
+}
+
+// LastOutputTime returns the time the server last produced a line of output.
+// Before any output has been seen it returns the process start time, and
+// before Start it returns the zero time.
+func (s *Server) LastOutputTime() time.Time {
+	return s.proc.LastOutputTime()
 }
 
 // ExitError returns the error from the server process exit, if any.
 // Returns nil if the server hasn't exited yet or exited cleanly.
 func (s *Server) ExitError() error {
-	s.errLock.RLock()
-	defer s.errLock.RUnlock()
-	return s.err
+	return s.proc.ExitError()
 }
 
 // PID returns the process ID of the running server, or 0 if not running.
 func (s *Server) PID() int {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if s.cmd != nil && s.cmd.Process != nil {
-		return s.cmd.Process.Pid
-	}
-	return 0
+	return s.proc.PID()
 }
 
 // BackupCompletePattern is the exact suffix that indicates a backup has completed.
 const BackupCompletePattern = "[Server Notification] Backup complete!"
 
 // WaitForBackupComplete waits for the server to send the backup completion notification.
-// It uses strings.HasSuffix to match lines ending with exactly "[Server Notification] Backup complete!".
+// It matches lines ending with exactly "[Server Notification] Backup complete!".
 // Returns nil on success, or an error if the context expires or the server exits.
 func (s *Server) WaitForBackupComplete(ctx context.Context) error {
-	// Check if server is running
-	select {
-	case <-s.Done():
-		return ErrServerNotRunning
-	default:
-	}
-
-	matchCh := make(chan struct{}, 1)
-	doneCh := make(chan struct{})
-	defer close(doneCh)
-
-	// Register handler to watch for backup complete pattern
-	s.addHandler(func(line string) bool {
-		select {
-		case <-doneCh:
-			return false // Unsubscribe
-		default:
-		}
-
-		if strings.HasSuffix(line, BackupCompletePattern) {
-			select {
-			case matchCh <- struct{}{}:
-			default:
-			}
-			return false // Unsubscribe after match
-		}
-		return true // Keep listening
-	})
-
-	// Wait for match, context cancellation, or server exit
-	select {
-	case <-matchCh:
-		return nil
-	case <-ctx.Done():
-		if ctx.Err() == context.DeadlineExceeded {
-			return ErrPatternTimeout
-		}
-		return ctx.Err()
-	case <-s.Done():
-		// Check if we got a match before the server exited
-		select {
-		case <-matchCh:
-			return nil
-		default:
-			return ErrServerExited
-		}
-	}
+	_, err := s.proc.WaitForRegex(ctx, backupCompleteRegexp)
+	return err
 }
@@ -5,7 +5,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -55,6 +57,66 @@ func TestServer_StartTwice(t *testing.T) {
 	<-s.Done()
 }
 
+// TestServer_RestartAfterExit tests that a server can be started again once its process has exited.
+func TestServer_RestartAfterExit(t *testing.T) {
+	var bootCount int
+	var mu sync.Mutex
+	booted := make(chan struct{}, 1)
+
+	// The fake server stays up until told to exit, so its boot line is read
+	// while it runs
+	s := &Server{
+		ServerPath: "/bin/sh",
+		Args:       []string{"-c", `echo "Dedicated Server now running"; read cmd; exit 3`},
+		OnBoot: func() {
+			mu.Lock()
+			bootCount++
+			mu.Unlock()
+			booted <- struct{}{}
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	waitBoot := func() {
+		t.Helper()
+		select {
+		case <-booted:
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for OnBoot")
+		}
+	}
+
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("First Start failed: %v", err)
+	}
+	waitBoot()
+	s.SendCommand("/stop")
+	if err := s.Wait(); err == nil {
+		t.Fatal("Expected exit error from first run")
+	}
+
+	s.Args = []string{"-c", `echo "Dedicated Server now running"; read cmd`}
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Restart failed: %v", err)
+	}
+	waitBoot()
+	if !s.HasBooted() {
+		t.Error("HasBooted should be true after the restarted server booted")
+	}
+	s.SendCommand("/stop")
+	if err := s.Wait(); err != nil {
+		t.Errorf("Wait after restart returned unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if bootCount != 2 {
+		t.Errorf("Expected OnBoot to be called once per run, got %d", bootCount)
+	}
+}
+
 // TestServer_SendCommand tests sending commands via stdin.
 func TestServer_SendCommand(t *testing.T) {
 	// Create a script that reads stdin and echoes it
@@ -492,6 +554,64 @@ func TestServer_OnOutput(t *testing.T) {
 	}
 }
 
+// TestServer_OutputListeners tests that each listener receives output
+// independently of OnOutput and the others.
+func TestServer_OutputListeners(t *testing.T) {
+	var mu sync.Mutex
+	got := make(map[string][]string)
+	lastLine := make(chan struct{})
+	record := func(id string, keep bool) OutputHandler {
+		return func(line string) bool {
+			mu.Lock()
+			got[id] = append(got[id], line)
+			mu.Unlock()
+			if id == "replaced" && line == "line3" {
+				close(lastLine)
+			}
+			return keep
+		}
+	}
+
+	s := &Server{
+		ServerPath: "printf",
+		Args:       []string{"line1\nline2\nline3\n"},
+		OnOutput:   record("field", true),
+	}
+	s.AddOutputListener("all", record("all", true))
+	s.AddOutputListener("once", record("once", false))
+	s.AddOutputListener("removed", record("removed", true))
+	s.RemoveOutputListener("removed")
+	s.AddOutputListener("replaced", record("old", true))
+	s.AddOutputListener("replaced", record("replaced", true))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	// Listeners get each line in the order they were added, after OnOutput
+	select {
+	case <-lastLine:
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for the last line")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	all := []string{"line1", "line2", "line3"}
+	want := map[string][]string{
+		"field":    all,
+		"all":      all,
+		"once":     {"line1"},
+		"replaced": all,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listeners received %v, want %v", got, want)
+	}
+}
+
 // TestServer_Wait tests the Wait method.
 func TestServer_Wait(t *testing.T) {
 	s := &Server{
@@ -1333,3 +1453,54 @@ echo "14.12.2025 22:33:24 [Server Notification] Backup complete!"
 		}
 	})
 }
+
+// TestServer_PauseResume tests suspending and resuming the server process.
+func TestServer_PauseResume(t *testing.T) {
+	s := &Server{
+		ServerPath: "sleep",
+		Args:       []string{"300"},
+	}
+
+	if err := s.Pause(); err != ErrServerNotRunning {
+		t.Errorf("Pause before Start: expected ErrServerNotRunning, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		s.Kill()
+		<-s.Done()
+	}()
+
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	if err := s.Pause(); err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+
+	statPath := filepath.Join("/proc", strconv.Itoa(s.PID()), "stat")
+	waitForState := func(want string) {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			data, err := os.ReadFile(statPath)
+			if err == nil {
+				// Format: pid (comm) state ...
+				fields := strings.Fields(string(data[strings.LastIndex(string(data), ")")+1:]))
+				if len(fields) > 0 && fields[0] == want {
+					return
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("Process did not reach state %q", want)
+	}
+
+	waitForState("T")
+
+	if err := s.Resume(); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	waitForState("S")
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultShutdownCountdown is when players are warned before a stop, as time
+// remaining until the server stops.
+var DefaultShutdownCountdown = []time.Duration{5 * time.Minute, time.Minute, 10 * time.Second}
+
+// PlayerLister reports which players are online.
+// *backup.PlayerChecker implements it.
+type PlayerLister interface {
+	Players() []string
+}
+
+// ShutdownNotice warns players that the server is about to stop, counting down
+// with /announce messages, and kicks whoever is still online when the
+// countdown ends. Commands go through Sender, usually a CommandQueue, so they
+// are rate limited and audited like any other command.
+type ShutdownNotice struct {
+	// Sender sends the announcements and kicks.
+	Sender CommandSender
+
+	// Players reports who is online. If set, the countdown is skipped when
+	// nobody is online, ends early once everybody has left, and the players
+	// left at the end are kicked. If nil, the whole countdown always runs
+	// and nobody is kicked.
+	Players PlayerLister
+
+	// Countdown is when to announce the stop, as time remaining. The first
+	// entry is how long the whole countdown takes.
+	// Defaults to DefaultShutdownCountdown if empty.
+	Countdown []time.Duration
+
+	// after waits for a duration; tests replace it.
+	after func(d time.Duration) <-chan time.Time
+}
+
+// Run counts down to a stop for reason, e.g. "restarting", announcing
+// "Server restarting in 5 minutes" and so on, then kicks the players still
+// online. It returns once the server can be stopped, or with ctx.Err() if ctx
+// is cancelled first, in which case the caller decides whether to stop anyway.
+func (n *ShutdownNotice) Run(ctx context.Context, reason string) error {
+	countdown := n.countdown()
+	for i, remaining := range countdown {
+		if n.nobodyOnline() {
+			return nil
+		}
+
+		n.send(fmt.Sprintf("/announce Server %s in %s", reason, formatCountdown(remaining)))
+
+		next := time.Duration(0)
+		if i+1 < len(countdown) {
+			next = countdown[i+1]
+		}
+		select {
+		case <-n.wait(remaining - next):
+		case <-ctx.Done():
+			n.send(fmt.Sprintf("/announce Server %s cancelled", reason))
+			return ctx.Err()
+		}
+	}
+
+	if n.Players == nil {
+		return nil
+	}
+	for _, name := range n.Players.Players() {
+		n.send(fmt.Sprintf("/kick %s Server %s", name, reason))
+	}
+	return nil
+}
+
+// nobodyOnline reports whether Players knows that nobody is online.
+func (n *ShutdownNotice) nobodyOnline() bool {
+	return n.Players != nil && len(n.Players.Players()) == 0
+}
+
+// send sends cmd, reporting failures without interrupting the countdown.
+func (n *ShutdownNotice) send(cmd string) {
+	if err := n.Sender.SendCommand(cmd); err != nil {
+		fmt.Printf("WARNING: Failed to send %q: %v\n", cmd, err)
+	}
+}
+
+func (n *ShutdownNotice) countdown() []time.Duration {
+	if len(n.Countdown) > 0 {
+		return n.Countdown
+	}
+	return DefaultShutdownCountdown
+}
+
+// wait returns a channel that receives after d.
+func (n *ShutdownNotice) wait(d time.Duration) <-chan time.Time {
+	if n.after != nil {
+		return n.after(d)
+	}
+	return time.After(d)
+}
+
+// ParseShutdownCountdown parses a comma-separated list of durations, such as
+// "5m,1m,10s", into a countdown sorted from longest to shortest.
+func ParseShutdownCountdown(s string) ([]time.Duration, error) {
+	var countdown []time.Duration
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q: %w", field, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid duration %q: must be positive", field)
+		}
+		countdown = append(countdown, d)
+	}
+	if len(countdown) == 0 {
+		return nil, fmt.Errorf("no durations in %q", s)
+	}
+
+	slices.Sort(countdown)
+	slices.Reverse(countdown)
+	return slices.Compact(countdown), nil
+}
+
+// formatCountdown formats the time remaining for an announcement, e.g.
+// "5 minutes", "1 minute 30 seconds", or "10 seconds".
+func formatCountdown(d time.Duration) string {
+	d = d.Round(time.Second)
+	var parts []string
+	for _, unit := range []struct {
+		size time.Duration
+		name string
+	}{
+		{time.Hour, "hour"},
+		{time.Minute, "minute"},
+		{time.Second, "second"},
+	} {
+		n := d / unit.size
+		if n == 0 {
+			continue
+		}
+		d -= n * unit.size
+		if n == 1 {
+			parts = append(parts, "1 "+unit.name)
+		} else {
+			parts = append(parts, fmt.Sprintf("%d %ss", n, unit.name))
+		}
+	}
+	if len(parts) == 0 {
+		return "a moment"
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockPlayerLister returns a fixed, changeable list of players.
+type mockPlayerLister struct {
+	mu      sync.Mutex
+	players []string
+}
+
+func (m *mockPlayerLister) Players() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.players)
+}
+
+func (m *mockPlayerLister) set(players ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.players = players
+}
+
+// commandStrings returns the commands sent to sender.
+func commandStrings(sender *mockCommandSender) []string {
+	var cmds []string
+	for _, c := range sender.getCommands() {
+		cmds = append(cmds, c.cmd)
+	}
+	return cmds
+}
+
+// instantAfter records waits and returns immediately.
+func instantAfter(waits *[]time.Duration) func(time.Duration) <-chan time.Time {
+	return func(d time.Duration) <-chan time.Time {
+		*waits = append(*waits, d)
+		ch := make(chan time.Time, 1)
+		ch <- time.Time{}
+		return ch
+	}
+}
+
+func TestShutdownNotice_CountdownAndKick(t *testing.T) {
+	sender := &mockCommandSender{}
+	players := &mockPlayerLister{players: []string{"alice", "bob"}}
+	var waits []time.Duration
+	n := &ShutdownNotice{Sender: sender, Players: players, after: instantAfter(&waits)}
+
+	if err := n.Run(context.Background(), "restarting"); err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+
+	want := []string{
+		"/announce Server restarting in 5 minutes",
+		"/announce Server restarting in 1 minute",
+		"/announce Server restarting in 10 seconds",
+		"/kick alice Server restarting",
+		"/kick bob Server restarting",
+	}
+	if got := commandStrings(sender); !slices.Equal(got, want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+	if wantWaits := []time.Duration{4 * time.Minute, 50 * time.Second, 10 * time.Second}; !slices.Equal(waits, wantWaits) {
+		t.Errorf("waits = %v, want %v", waits, wantWaits)
+	}
+}
+
+func TestShutdownNotice_NobodyOnline(t *testing.T) {
+	sender := &mockCommandSender{}
+	var waits []time.Duration
+	n := &ShutdownNotice{Sender: sender, Players: &mockPlayerLister{}, after: instantAfter(&waits)}
+
+	if err := n.Run(context.Background(), "restarting"); err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if cmds := commandStrings(sender); len(cmds) != 0 || len(waits) != 0 {
+		t.Errorf("expected no countdown with nobody online, got commands %q and waits %v", cmds, waits)
+	}
+}
+
+func TestShutdownNotice_EveryoneLeaves(t *testing.T) {
+	sender := &mockCommandSender{}
+	players := &mockPlayerLister{players: []string{"alice"}}
+	n := &ShutdownNotice{Sender: sender, Players: players}
+	n.after = func(d time.Duration) <-chan time.Time {
+		players.set()
+		ch := make(chan time.Time, 1)
+		ch <- time.Time{}
+		return ch
+	}
+
+	if err := n.Run(context.Background(), "shutting down"); err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	want := []string{"/announce Server shutting down in 5 minutes"}
+	if got := commandStrings(sender); !slices.Equal(got, want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
+
+func TestShutdownNotice_Cancelled(t *testing.T) {
+	sender := &mockCommandSender{}
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &ShutdownNotice{
+		Sender:    sender,
+		Countdown: []time.Duration{time.Hour},
+		after: func(d time.Duration) <-chan time.Time {
+			cancel()
+			return nil
+		},
+	}
+
+	if err := n.Run(ctx, "restarting"); err != context.Canceled {
+		t.Fatalf("Run() error = %v, want context.Canceled", err)
+	}
+	want := []string{"/announce Server restarting in 1 hour", "/announce Server restarting cancelled"}
+	if got := commandStrings(sender); !slices.Equal(got, want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
+
+func TestParseShutdownCountdown(t *testing.T) {
+	got, err := ParseShutdownCountdown("10s, 5m,1m,5m")
+	if err != nil {
+		t.Fatalf("ParseShutdownCountdown() failed: %v", err)
+	}
+	if want := []time.Duration{5 * time.Minute, time.Minute, 10 * time.Second}; !slices.Equal(got, want) {
+		t.Errorf("ParseShutdownCountdown() = %v, want %v", got, want)
+	}
+
+	for _, s := range []string{"", "5x", "0s", "-1m", " , "} {
+		if _, err := ParseShutdownCountdown(s); err == nil {
+			t.Errorf("ParseShutdownCountdown(%q) expected error", s)
+		}
+	}
+}
+
+func TestFormatCountdown(t *testing.T) {
+	tests := map[time.Duration]string{
+		5 * time.Minute:              "5 minutes",
+		time.Minute:                  "1 minute",
+		90 * time.Second:             "1 minute 30 seconds",
+		time.Hour + 2*time.Second:    "1 hour 2 seconds",
+		10 * time.Second:             "10 seconds",
+		100 * time.Millisecond:       "a moment",
+		2*time.Hour + 30*time.Minute: "2 hours 30 minutes",
+	}
+	for d, want := range tests {
+		if got := formatCountdown(d); got != want {
+			t.Errorf("formatCountdown(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"regexp"
+	"time"
+)
+
+// logTimestampLayout is the format of the timestamp the server puts at the
+// start of its log lines, e.g. "14.12.2025 21:32:37".
+const logTimestampLayout = "02.01.2006 15:04:05"
+
+// logTimestampPattern matches the timestamp at the start of a log line.
+var logTimestampPattern = regexp.MustCompile(`^(\d{2}\.\d{2}\.\d{4} \d{2}:\d{2}:\d{2}) `)
+
+// ParseLogTime parses the timestamp at the start of a server log line and
+// returns it in UTC, along with the rest of the line. The server writes its
+// timestamps in its own local time without a zone, so loc must be the
+// server's timezone; nil means time.Local, which the server process
+// inherits from the launcher. The bool is false if the line has no timestamp.
+func ParseLogTime(line string, loc *time.Location) (time.Time, string, bool) {
+	m := logTimestampPattern.FindStringSubmatch(line)
+	if m == nil {
+		return time.Time{}, line, false
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	t, err := time.ParseInLocation(logTimestampLayout, m[1], loc)
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return t.UTC(), line[len(m[0]):], true
+}
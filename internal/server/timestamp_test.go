@@ -0,0 +1,57 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLogTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone database unavailable: %v", err)
+	}
+
+	tests := []struct {
+		line     string
+		loc      *time.Location
+		want     time.Time
+		wantRest string
+		wantOk   bool
+	}{
+		{
+			line:     "14.12.2025 21:32:37 [Server Event] amoglaswag joins.",
+			loc:      time.UTC,
+			want:     time.Date(2025, 12, 14, 21, 32, 37, 0, time.UTC),
+			wantRest: "[Server Event] amoglaswag joins.",
+			wantOk:   true,
+		},
+		{
+			line:     "14.12.2025 21:32:37 [Server Event] amoglaswag joins.",
+			loc:      berlin,
+			want:     time.Date(2025, 12, 14, 20, 32, 37, 0, time.UTC),
+			wantRest: "[Server Event] amoglaswag joins.",
+			wantOk:   true,
+		},
+		{
+			line:     "[Server Event] amoglaswag joins.",
+			loc:      time.UTC,
+			wantRest: "[Server Event] amoglaswag joins.",
+		},
+		{
+			line:     "99.99.2025 21:32:37 garbage",
+			loc:      time.UTC,
+			wantRest: "99.99.2025 21:32:37 garbage",
+		},
+	}
+
+	for _, tt := range tests {
+		got, rest, ok := ParseLogTime(tt.line, tt.loc)
+		if ok != tt.wantOk || !got.Equal(tt.want) || rest != tt.wantRest {
+			t.Errorf("ParseLogTime(%q, %v) = %v, %q, %v; want %v, %q, %v",
+				tt.line, tt.loc, got, rest, ok, tt.want, tt.wantRest, tt.wantOk)
+		}
+		if ok && got.Location() != time.UTC {
+			t.Errorf("ParseLogTime(%q) returned a time in %v, want UTC", tt.line, got.Location())
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package server
+
+import "regexp"
+
+// gameVersionPattern matches the game version in the server's startup banner,
+// e.g. "Game Version: v1.21.6 (Stable)".
+var gameVersionPattern = regexp.MustCompile(`Game Version: v?(\d+\.\d+\.\d+\S*)`)
+
+// parseGameVersion extracts the game version from a startup banner line.
+func parseGameVersion(line string) (string, bool) {
+	m := gameVersionPattern.FindStringSubmatch(line)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// GameVersion returns the game version the server reported in its startup
+// banner, or "" if it hasn't been seen yet. The version of the last process
+// is kept across restarts until the new one reports its own.
+func (s *Server) GameVersion() string {
+	v, _ := s.gameVersion.Load().(string)
+	return v
+}
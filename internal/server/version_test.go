@@ -0,0 +1,24 @@
+package server
+
+import "testing"
+
+func TestParseGameVersion(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   string
+		wantOk bool
+	}{
+		{"16.10.2026 12:00:01 [Server Notification] Game Version: v1.21.6 (Stable)", "1.21.6", true},
+		{"[Server Event] Game Version: v1.22.0-rc.2 (Unstable)", "1.22.0-rc.2", true},
+		{"Game Version: 1.20.12", "1.20.12", true},
+		{"[Server Notification] Dedicated Server now running on Port 42420", "", false},
+		{"Game Version: unknown", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseGameVersion(tt.line)
+		if ok != tt.wantOk || got != tt.want {
+			t.Errorf("parseGameVersion(%q) = %q, %v, want %q, %v", tt.line, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWatchdogProbeCommand is a harmless command that makes the
+	// Vintage Story server print a response, proving it is still responsive.
+	DefaultWatchdogProbeCommand = "/stats"
+)
+
+// ActivitySource reports when a process last showed signs of life.
+// This is satisfied by *Server.
+type ActivitySource interface {
+	LastOutputTime() time.Time
+}
+
+// PhaseSource reports how far a server has got in starting up.
+// This is satisfied by *Server.
+type PhaseSource interface {
+	Phase() Phase
+}
+
+// ParsePhaseTimeouts parses per-phase watchdog timeouts from comma-separated
+// phase=duration pairs, e.g. "loading=5m,world=1h". A duration of "off"
+// disables the watchdog for that phase.
+func ParsePhaseTimeouts(s string) (map[Phase]time.Duration, error) {
+	timeouts := make(map[Phase]time.Duration)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected phase=duration, got %q", pair)
+		}
+		phase, err := ParsePhase(name)
+		if err != nil || phase == PhaseStopped {
+			return nil, fmt.Errorf("unknown phase %q (expected starting, loading, world, or ready)", strings.TrimSpace(name))
+		}
+		value = strings.TrimSpace(value)
+		if strings.EqualFold(value, "off") {
+			timeouts[phase] = 0
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid timeout for phase %s: must be a positive duration or off, got %q", phase, value)
+		}
+		timeouts[phase] = d
+	}
+	return timeouts, nil
+}
+
+// Watchdog monitors a server for liveness by tracking the time since its last
+// output line. If ProbeInterval is set, it sends a harmless command whenever the
+// server has been quiet for that long, so an idle-but-healthy server still
+// produces output. Once the server has been silent for longer than Timeout it is
+// marked unhealthy and OnUnhealthy is called.
+type Watchdog struct {
+	// Source provides the time of the last server output (usually *Server).
+	Source ActivitySource
+
+	// Sender is used to send probe commands. Optional; if nil, no probes are sent.
+	Sender CommandSender
+
+	// Timeout is how long the server may stay silent before it is considered hung.
+	Timeout time.Duration
+
+	// PhaseTimeouts replaces Timeout while the server is in one of its
+	// phases, if Source is also a PhaseSource, so that a server silently
+	// generating a new world isn't mistaken for a hung one. A zero timeout
+	// disables the watchdog during that phase. Optional.
+	PhaseTimeouts map[Phase]time.Duration
+
+	// ProbeInterval is how long the server may stay silent before a probe
+	// command is sent. If zero, probing is disabled.
+	ProbeInterval time.Duration
+
+	// ProbeCommand is the command sent to elicit output.
+	// Defaults to DefaultWatchdogProbeCommand if empty.
+	ProbeCommand string
+
+	// OnUnhealthy is called once when the server transitions to unhealthy.
+	// silentFor is how long the server has been silent. Optional.
+	OnUnhealthy func(silentFor time.Duration)
+
+	// OnRecovered is called once when an unhealthy server produces output again. Optional.
+	OnRecovered func()
+
+	mu        sync.Mutex
+	unhealthy bool
+	lastProbe time.Time
+	started   bool
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// Start begins monitoring in a background goroutine.
+func (w *Watchdog) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.started {
+		return
+	}
+
+	if w.ProbeCommand == "" {
+		w.ProbeCommand = DefaultWatchdogProbeCommand
+	}
+
+	w.done = make(chan struct{})
+	w.started = true
+
+	w.wg.Add(1)
+	go w.monitorLoop()
+}
+
+// Stop stops monitoring and waits for the background goroutine to exit.
+func (w *Watchdog) Stop() {
+	w.mu.Lock()
+	if !w.started {
+		w.mu.Unlock()
+		return
+	}
+	w.started = false
+	w.mu.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+}
+
+// Healthy returns false if the server is currently considered hung.
+func (w *Watchdog) Healthy() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return !w.unhealthy
+}
+
+// timeout returns how long the server may stay silent in its current phase.
+func (w *Watchdog) timeout() time.Duration {
+	if phases, ok := w.Source.(PhaseSource); ok {
+		if d, ok := w.PhaseTimeouts[phases.Phase()]; ok {
+			return d
+		}
+	}
+	return w.Timeout
+}
+
+// checkInterval returns how often the watchdog evaluates liveness.
+func (w *Watchdog) checkInterval() time.Duration {
+	interval := w.Timeout / 4
+	for _, d := range w.PhaseTimeouts {
+		if d > 0 && (interval <= 0 || d/4 < interval) {
+			interval = d / 4
+		}
+	}
+	if w.ProbeInterval > 0 && w.ProbeInterval/2 < interval {
+		interval = w.ProbeInterval / 2
+	}
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	return interval
+}
+
+// monitorLoop periodically checks liveness until stopped.
+func (w *Watchdog) monitorLoop() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.checkInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			w.check(now)
+		}
+	}
+}
+
+// check evaluates liveness at the given time, sending probes and firing
+// callbacks on health transitions.
+func (w *Watchdog) check(now time.Time) {
+	last := w.Source.LastOutputTime()
+	if last.IsZero() {
+		return // Server hasn't started yet
+	}
+	silentFor := now.Sub(last)
+	timeout := w.timeout()
+
+	w.mu.Lock()
+	sendProbe := w.Sender != nil && w.ProbeInterval > 0 &&
+		silentFor >= w.ProbeInterval && now.Sub(w.lastProbe) >= w.ProbeInterval
+	if sendProbe {
+		w.lastProbe = now
+	}
+
+	becameUnhealthy := !w.unhealthy && timeout > 0 && silentFor >= timeout
+	recovered := w.unhealthy && (timeout <= 0 || silentFor < timeout)
+	if becameUnhealthy {
+		w.unhealthy = true
+	}
+	if recovered {
+		w.unhealthy = false
+	}
+	w.mu.Unlock()
+
+	if sendProbe {
+		_ = w.Sender.SendCommand(w.ProbeCommand)
+	}
+	if becameUnhealthy && w.OnUnhealthy != nil {
+		w.OnUnhealthy(silentFor)
+	}
+	if recovered && w.OnRecovered != nil {
+		w.OnRecovered()
+	}
+}
+
+// Ensure Server implements ActivitySource and PhaseSource at compile time.
+var (
+	_ ActivitySource = (*Server)(nil)
+	_ PhaseSource    = (*Server)(nil)
+)
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockActivitySource implements ActivitySource for testing.
+type mockActivitySource struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (m *mockActivitySource) LastOutputTime() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+func (m *mockActivitySource) Touch(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.last = t
+}
+
+func TestWatchdog_Check_MarksUnhealthyAfterTimeout(t *testing.T) {
+	start := time.Now()
+	source := &mockActivitySource{last: start}
+
+	var silent time.Duration
+	unhealthyCalls := 0
+	w := &Watchdog{
+		Source:  source,
+		Timeout: time.Minute,
+		OnUnhealthy: func(silentFor time.Duration) {
+			unhealthyCalls++
+			silent = silentFor
+		},
+	}
+
+	w.check(start.Add(30 * time.Second))
+	if !w.Healthy() {
+		t.Fatal("Expected healthy before timeout")
+	}
+
+	w.check(start.Add(2 * time.Minute))
+	if w.Healthy() {
+		t.Fatal("Expected unhealthy after timeout")
+	}
+	if unhealthyCalls != 1 || silent != 2*time.Minute {
+		t.Errorf("OnUnhealthy calls = %d, silentFor = %v; want 1, 2m", unhealthyCalls, silent)
+	}
+
+	// Should only fire once per transition
+	w.check(start.Add(3 * time.Minute))
+	if unhealthyCalls != 1 {
+		t.Errorf("OnUnhealthy called %d times, want 1", unhealthyCalls)
+	}
+}
+
+func TestWatchdog_Check_Recovers(t *testing.T) {
+	start := time.Now()
+	source := &mockActivitySource{last: start}
+
+	recovered := false
+	w := &Watchdog{
+		Source:      source,
+		Timeout:     time.Minute,
+		OnRecovered: func() { recovered = true },
+	}
+
+	w.check(start.Add(2 * time.Minute))
+	if w.Healthy() {
+		t.Fatal("Expected unhealthy after timeout")
+	}
+
+	source.Touch(start.Add(2 * time.Minute))
+	w.check(start.Add(2*time.Minute + time.Second))
+	if !w.Healthy() {
+		t.Error("Expected healthy after new output")
+	}
+	if !recovered {
+		t.Error("Expected OnRecovered to be called")
+	}
+}
+
+func TestWatchdog_Check_SendsProbe(t *testing.T) {
+	start := time.Now()
+	source := &mockActivitySource{last: start}
+	sender := &mockCommandSender{}
+
+	w := &Watchdog{
+		Source:        source,
+		Sender:        sender,
+		Timeout:       time.Hour,
+		ProbeInterval: time.Minute,
+		ProbeCommand:  "/stats",
+	}
+
+	// Not quiet long enough yet
+	w.check(start.Add(30 * time.Second))
+	if got := len(sender.getCommands()); got != 0 {
+		t.Fatalf("Expected no probes yet, got %d", got)
+	}
+
+	w.check(start.Add(time.Minute))
+	// A second check shortly after shouldn't re-probe
+	w.check(start.Add(time.Minute + time.Second))
+
+	cmds := sender.getCommands()
+	if len(cmds) != 1 || cmds[0].cmd != "/stats" {
+		t.Fatalf("Expected exactly one /stats probe, got %v", cmds)
+	}
+
+	w.check(start.Add(2 * time.Minute))
+	if got := len(sender.getCommands()); got != 2 {
+		t.Errorf("Expected a second probe after another interval, got %d", got)
+	}
+}
+
+func TestWatchdog_Check_IgnoresUnstartedServer(t *testing.T) {
+	called := false
+	w := &Watchdog{
+		Source:      &mockActivitySource{},
+		Timeout:     time.Millisecond,
+		OnUnhealthy: func(time.Duration) { called = true },
+	}
+
+	w.check(time.Now())
+	if called || !w.Healthy() {
+		t.Error("Watchdog should not fire before the server has started")
+	}
+}
+
+func TestWatchdog_StartStop(t *testing.T) {
+	source := &mockActivitySource{last: time.Now()}
+
+	unhealthy := make(chan struct{}, 1)
+	w := &Watchdog{
+		Source:  source,
+		Timeout: 50 * time.Millisecond,
+		OnUnhealthy: func(time.Duration) {
+			select {
+			case unhealthy <- struct{}{}:
+			default:
+			}
+		},
+	}
+
+	w.Start()
+	defer w.Stop()
+
+	select {
+	case <-unhealthy:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for OnUnhealthy")
+	}
+
+	// Double stop should be safe
+	w.Stop()
+}
+
+func TestServer_LastOutputTime(t *testing.T) {
+	s := &Server{
+		ServerPath: "echo",
+		Args:       []string{"hello"},
+	}
+
+	if !s.LastOutputTime().IsZero() {
+		t.Error("LastOutputTime should be zero before Start")
+	}
+
+	before := time.Now()
+	if err := s.Start(t.Context()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	s.Wait()
+
+	if s.LastOutputTime().Before(before) {
+		t.Errorf("LastOutputTime %v should be after %v", s.LastOutputTime(), before)
+	}
+}
+
+// mockPhaseSource is an ActivitySource that is also a PhaseSource.
+type mockPhaseSource struct {
+	mockActivitySource
+	phase Phase
+}
+
+func (m *mockPhaseSource) Phase() Phase {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.phase
+}
+
+func TestWatchdog_Check_PhaseTimeouts(t *testing.T) {
+	start := time.Now()
+	source := &mockPhaseSource{phase: PhaseWorldLoading}
+	source.Touch(start)
+
+	unhealthy := false
+	w := &Watchdog{
+		Source:        source,
+		Timeout:       time.Minute,
+		PhaseTimeouts: map[Phase]time.Duration{PhaseWorldLoading: time.Hour, PhaseLoading: 0},
+		OnUnhealthy:   func(time.Duration) { unhealthy = true },
+	}
+
+	w.check(start.Add(30 * time.Minute))
+	if unhealthy {
+		t.Fatal("Expected the world loading timeout to apply")
+	}
+
+	source.mu.Lock()
+	source.phase = PhaseLoading
+	source.mu.Unlock()
+	w.check(start.Add(2 * time.Hour))
+	if unhealthy {
+		t.Fatal("Expected no timeout while loading")
+	}
+
+	source.mu.Lock()
+	source.phase = PhaseReady
+	source.mu.Unlock()
+	w.check(start.Add(2 * time.Hour))
+	if !unhealthy {
+		t.Error("Expected Timeout to apply once ready")
+	}
+}
+
+func TestParsePhaseTimeouts(t *testing.T) {
+	timeouts, err := ParsePhaseTimeouts("loading=10m, world=off,")
+	if err != nil {
+		t.Fatalf("ParsePhaseTimeouts() failed: %v", err)
+	}
+	if len(timeouts) != 2 || timeouts[PhaseLoading] != 10*time.Minute || timeouts[PhaseWorldLoading] != 0 {
+		t.Errorf("ParsePhaseTimeouts() = %v, want loading=10m, world=0", timeouts)
+	}
+
+	for _, s := range []string{"loading", "stopped=1m", "booting=1m", "world=-1m", "world=soon"} {
+		if _, err := ParsePhaseTimeouts(s); err == nil {
+			t.Errorf("ParsePhaseTimeouts(%q) expected error", s)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Package snapshotmeta reads the metadata.json file at the root of each
+// snapshot, which records the server that produced the save. It has no
+// dependencies on the backup manager, so tools that only inspect restored
+// snapshots can use it.
+package snapshotmeta
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileName is the name of the file at the root of the staging directory, and
+// so of every snapshot, that describes what produced it.
+const FileName = "metadata.json"
+
+// Metadata is written to FileName in each snapshot. Restoring a world into
+// an older server version than the one that saved it can corrupt it, so
+// restore tools should compare ServerVersion against the server they
+// restore into.
+type Metadata struct {
+	// ServerVersion is the game version that wrote the save: the one from the
+	// server's startup banner, or the archive version if that wasn't seen.
+	ServerVersion string `json:"server_version,omitempty"`
+
+	// ArchiveURL, ArchiveETag, and ArchiveVersion identify the downloaded
+	// server archive.
+	ArchiveURL     string `json:"archive_url,omitempty"`
+	ArchiveETag    string `json:"archive_etag,omitempty"`
+	ArchiveVersion string `json:"archive_version,omitempty"`
+
+	// TreeDigests maps the name of each world's tree under Saves to its
+	// vcdbtree.Digest, so restores can check the tree came back
+	// bit-identical before combining it.
+	TreeDigests map[string]string `json:"tree_digests,omitempty"`
+}
+
+// Read reads the metadata of a restored snapshot from dir, its root
+// directory. Returns nil without error if the snapshot predates metadata.
+func Read(dir string) (*Metadata, error) {
+	data, err := os.ReadFile(filepath.Join(dir, FileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read snapshot metadata: %w", err)
+	}
+
+	var meta Metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+// Find looks for snapshot metadata next to a restored vcdbtree. Trees live
+// at Saves/<name> in a snapshot, so the tree directory and its two parents
+// are searched. Returns nil without error if none is found.
+func Find(treeDir string) (*Metadata, error) {
+	dir, err := filepath.Abs(treeDir)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < 3; i++ {
+		meta, err := Read(dir)
+		if meta != nil || err != nil {
+			return meta, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return nil, nil
+}
@@ -0,0 +1,61 @@
+package snapshotmeta
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+
+	meta, err := Read(dir)
+	if err != nil || meta != nil {
+		t.Fatalf("Read() without metadata = %+v, %v; want nil", meta, err)
+	}
+
+	data := `{"server_version": "1.21.6", "archive_etag": "abc", "tree_digests": {"world": "sha256:00"}}`
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	meta, err = Read(dir)
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	want := Metadata{ServerVersion: "1.21.6", ArchiveETag: "abc", TreeDigests: map[string]string{"world": "sha256:00"}}
+	if meta == nil || !reflect.DeepEqual(*meta, want) {
+		t.Errorf("Read() = %+v, want %+v", meta, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(dir); err == nil {
+		t.Error("Read() expected error for malformed metadata")
+	}
+}
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	treeDir := filepath.Join(root, "Saves", "default")
+	if err := os.MkdirAll(treeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := Find(treeDir)
+	if err != nil || meta != nil {
+		t.Fatalf("Find() without metadata = %+v, %v", meta, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, FileName), []byte(`{"server_version": "1.21.6"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	meta, err = Find(treeDir)
+	if err != nil {
+		t.Fatalf("Find() error: %v", err)
+	}
+	if meta == nil || meta.ServerVersion != "1.21.6" {
+		t.Errorf("Find() = %+v", meta)
+	}
+}
@@ -0,0 +1,157 @@
+// Package startup holds the checks the launcher and the backup agent run
+// before they start backing up, so both refuse the same configurations with
+// the same exit codes.
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/renorris/vintagestory-restic/internal/backup"
+	"github.com/renorris/vintagestory-restic/internal/exitcode"
+)
+
+// ResticEnv picks up restic settings from mounted secrets and checks that
+// the restic environment is complete.
+func ResticEnv() error {
+	// Pick up Docker/Kubernetes secrets before validating the restic environment
+	applied, err := backup.ApplyResticSecrets()
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+	for _, name := range applied {
+		fmt.Printf("Using %s from mounted secret: %s\n", name, os.Getenv(name))
+	}
+
+	if err := backup.ValidateResticEnv(); err != nil {
+		return exitcode.With(exitcode.ConfigError, err)
+	}
+	return nil
+}
+
+// Restic looks up restic and prints what it found. If restic is missing,
+// backups are disabled, or an error is returned when they are required.
+func Restic(ctx context.Context, cfg *backup.Config) (backup.ResticVersion, error) {
+	var resticVersion backup.ResticVersion
+	if !cfg.Enabled {
+		fmt.Println("  restic: not needed, backups are disabled")
+		return resticVersion, nil
+	}
+
+	path, version, err := backup.DetectRestic(ctx)
+	switch {
+	case path == "":
+		fmt.Printf("  restic: missing (%v)\n", err)
+		if cfg.Required {
+			return resticVersion, exitcode.With(exitcode.BackupFatal, fmt.Errorf("backups are required but restic is not installed: %w", err))
+		}
+		fmt.Println("WARNING: restic is not installed. Periodic backups are disabled.")
+		cfg.Enabled = false
+	case err != nil:
+		fmt.Printf("  restic: %s (version unknown: %v)\n", path, err)
+	default:
+		fmt.Printf("  restic: %s (version %s)\n", path, version)
+		resticVersion = version
+	}
+	return resticVersion, nil
+}
+
+// Paths checks m's directory layout and prints any warnings, catching
+// staging/gamedata mix-ups before they snowball into recursive backups.
+func Paths(m *backup.Manager) error {
+	warnings, err := m.ValidatePaths()
+	if err != nil {
+		return exitcode.With(exitcode.ConfigError, fmt.Errorf("invalid directory layout: %w", err))
+	}
+	for _, w := range warnings {
+		fmt.Printf("Warning: %s\n", w)
+	}
+	return nil
+}
+
+// Repository makes sure the restic repository works before backups start
+// when they are required, and returns an error if it doesn't. Otherwise the
+// first backup may be hours away, so the credentials are checked in the
+// background without holding up startup.
+//
+// If ctx is done before the check finishes, Repository returns ctx's error.
+func Repository(ctx context.Context, cfg *backup.Config, m *backup.Manager) error {
+	if !cfg.Required {
+		go probeRepository(ctx, m)
+		return nil
+	}
+
+	fmt.Println("Checking restic repository before starting...")
+	if err := m.CheckRepository(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return exitcode.With(exitcode.BackupFatal, fmt.Errorf("restic repository check failed, refusing to start: %w", err))
+	}
+	return nil
+}
+
+// probeRepository reports whether the restic repository can be reached with
+// the configured credentials, so a mistyped key shows up at startup rather
+// than when the first backup fails.
+func probeRepository(ctx context.Context, m *backup.Manager) {
+	err := m.ProbeRepository(ctx)
+	switch {
+	case err == nil:
+		fmt.Println("Restic repository is reachable.")
+	case errors.Is(err, backup.ErrRepositoryNotInitialized):
+		fmt.Println("Restic repository is reachable but not initialized yet; the first backup initializes it.")
+	case ctx.Err() != nil:
+	default:
+		fmt.Printf("WARNING: Restic repository check failed; backups will fail until this is fixed: %v\n", err)
+	}
+}
+
+// RequiredBackups enforces BACKUP_REQUIRED once backups are running: after
+// RequiredMaxFailures consecutive failed backups, an error is sent on Fatal.
+// Skipped backups (no players, server still booting) don't count.
+type RequiredBackups struct {
+	cfg      *backup.Config
+	failures atomic.Int32
+	fatal    chan error
+}
+
+// NewRequiredBackups returns a RequiredBackups for cfg. If cfg.Required is
+// not set, Fatal never receives.
+func NewRequiredBackups(cfg *backup.Config) *RequiredBackups {
+	return &RequiredBackups{cfg: cfg, fatal: make(chan error, 1)}
+}
+
+// Record counts the result of a finished backup. Results after ctx is done
+// are ignored, since backups interrupted by a shutdown aren't failures.
+func (r *RequiredBackups) Record(ctx context.Context, err error) {
+	if !r.cfg.Required || ctx.Err() != nil {
+		return
+	}
+	if err == nil {
+		r.failures.Store(0)
+		return
+	}
+	if errors.Is(err, backup.ErrNoPlayersOnline) || errors.Is(err, backup.ErrServerNotBooted) {
+		return
+	}
+	if n := int(r.failures.Add(1)); n >= r.cfg.RequiredMaxFailures {
+		r.Fail(fmt.Errorf("%d consecutive backups failed, last error: %w", n, err))
+	}
+}
+
+// Fail reports err on Fatal right away, unless an error is already waiting.
+func (r *RequiredBackups) Fail(err error) {
+	select {
+	case r.fatal <- err:
+	default:
+	}
+}
+
+// Fatal receives an error once required backups have failed for good.
+func (r *RequiredBackups) Fatal() <-chan error {
+	return r.fatal
+}
@@ -0,0 +1,120 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/renorris/vintagestory-restic/internal/backup"
+	"github.com/renorris/vintagestory-restic/internal/exitcode"
+)
+
+func TestResticEnv(t *testing.T) {
+	t.Setenv("RESTIC_SECRETS_DIR", t.TempDir())
+	t.Setenv("RESTIC_REPOSITORY", "")
+	t.Setenv("RESTIC_REPOSITORY_FILE", "")
+	t.Setenv("RESTIC_PASSWORD", "")
+	t.Setenv("RESTIC_PASSWORD_FILE", "")
+	t.Setenv("RESTIC_PASSWORD_COMMAND", "")
+
+	t.Run("missing repository is a config error", func(t *testing.T) {
+		err := ResticEnv()
+		if err == nil {
+			t.Fatal("ResticEnv() expected error")
+		}
+		if code := exitcode.For(err); code != exitcode.ConfigError {
+			t.Errorf("exit code = %d, want %d", code, exitcode.ConfigError)
+		}
+	})
+
+	t.Run("complete environment", func(t *testing.T) {
+		t.Setenv("RESTIC_REPOSITORY", "/tmp/repo")
+		t.Setenv("RESTIC_PASSWORD", "secret")
+		if err := ResticEnv(); err != nil {
+			t.Errorf("ResticEnv() unexpected error: %v", err)
+		}
+	})
+}
+
+func TestPaths_NestedStaging(t *testing.T) {
+	gameDataDir := t.TempDir()
+	m := &backup.Manager{GameDataDir: gameDataDir, StagingDir: gameDataDir}
+
+	err := Paths(m)
+	if err == nil {
+		t.Fatal("Paths() expected error for staging inside the game data directory")
+	}
+	if code := exitcode.For(err); code != exitcode.ConfigError {
+		t.Errorf("exit code = %d, want %d", code, exitcode.ConfigError)
+	}
+}
+
+// fatal returns the error waiting on r's Fatal channel, if any.
+func fatal(r *RequiredBackups) error {
+	select {
+	case err := <-r.Fatal():
+		return err
+	default:
+		return nil
+	}
+}
+
+func TestRequiredBackups(t *testing.T) {
+	ctx := context.Background()
+	failed := errors.New("restic failed")
+
+	t.Run("fails after consecutive failures", func(t *testing.T) {
+		r := NewRequiredBackups(&backup.Config{Required: true, RequiredMaxFailures: 2})
+
+		r.Record(ctx, failed)
+		if err := fatal(r); err != nil {
+			t.Fatalf("Fatal() received after one failure: %v", err)
+		}
+		r.Record(ctx, failed)
+		if err := fatal(r); !errors.Is(err, failed) {
+			t.Errorf("Fatal() = %v, want the last backup error", err)
+		}
+	})
+
+	t.Run("success resets the count", func(t *testing.T) {
+		r := NewRequiredBackups(&backup.Config{Required: true, RequiredMaxFailures: 2})
+
+		r.Record(ctx, failed)
+		r.Record(ctx, nil)
+		r.Record(ctx, failed)
+		if err := fatal(r); err != nil {
+			t.Errorf("Fatal() received after a success in between: %v", err)
+		}
+	})
+
+	t.Run("skipped backups don't count", func(t *testing.T) {
+		r := NewRequiredBackups(&backup.Config{Required: true, RequiredMaxFailures: 1})
+
+		r.Record(ctx, backup.ErrNoPlayersOnline)
+		r.Record(ctx, fmt.Errorf("boot-time backup: %w", backup.ErrServerNotBooted))
+		if err := fatal(r); err != nil {
+			t.Errorf("Fatal() received for skipped backups: %v", err)
+		}
+	})
+
+	t.Run("ignored when not required", func(t *testing.T) {
+		r := NewRequiredBackups(&backup.Config{RequiredMaxFailures: 1})
+
+		r.Record(ctx, failed)
+		if err := fatal(r); err != nil {
+			t.Errorf("Fatal() received without BACKUP_REQUIRED: %v", err)
+		}
+	})
+
+	t.Run("ignored after shutdown", func(t *testing.T) {
+		r := NewRequiredBackups(&backup.Config{Required: true, RequiredMaxFailures: 1})
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		r.Record(cancelled, failed)
+		if err := fatal(r); err != nil {
+			t.Errorf("Fatal() received for a backup interrupted by shutdown: %v", err)
+		}
+	})
+}
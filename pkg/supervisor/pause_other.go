@@ -0,0 +1,15 @@
+//go:build !unix
+
+package supervisor
+
+import "errors"
+
+// Pause is not supported on this platform.
+func (p *Process) Pause() error {
+	return errors.ErrUnsupported
+}
+
+// Resume is not supported on this platform.
+func (p *Process) Resume() error {
+	return errors.ErrUnsupported
+}
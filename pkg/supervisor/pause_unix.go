@@ -0,0 +1,16 @@
+//go:build unix
+
+package supervisor
+
+import "syscall"
+
+// Pause suspends the process with SIGSTOP.
+// The caller must ensure Resume is called, or the process will stay frozen.
+func (p *Process) Pause() error {
+	return p.Signal(syscall.SIGSTOP)
+}
+
+// Resume continues a process previously suspended with Pause.
+func (p *Process) Resume() error {
+	return p.Signal(syscall.SIGCONT)
+}
@@ -0,0 +1,631 @@
+// Package supervisor runs a console-driven server process, such as a game
+// server, and manages its stdin/stdout pipes. It watches the output for a
+// boot pattern, sends commands, waits for output patterns, and stops the
+// process gracefully with a stop command and an interrupt, escalating to a
+// kill when asked.
+//
+// Nothing in this package is specific to a particular game; see
+// internal/server for the Vintage Story wrapper built on top of it.
+package supervisor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotRunning is returned when attempting operations on a process that isn't running.
+var ErrNotRunning = errors.New("server is not running")
+
+// ErrPatternTimeout is returned when WaitForPattern times out.
+var ErrPatternTimeout = errors.New("timed out waiting for pattern")
+
+// ErrExited is returned when the process exits unexpectedly while waiting for a pattern.
+var ErrExited = errors.New("server exited unexpectedly")
+
+// ErrLineTruncated is reported to OnReadError when an output line longer than
+// MaxLineSize was cut short.
+var ErrLineTruncated = errors.New("output line truncated")
+
+// OutputHandler is a callback function for handling output lines.
+// Return false to unsubscribe from further output.
+type OutputHandler func(line string) bool
+
+// outputDrainTimeout is how long to keep reading output after the process exits.
+const outputDrainTimeout = time.Second
+
+// MaxLineSize is the longest output line passed to handlers. Longer lines
+// are truncated to this many bytes and the rest is discarded.
+const MaxLineSize = 1024 * 1024
+
+// Process supervises a server process and provides methods for interacting
+// with its stdin/stdout streams. Configure it by setting its fields before
+// Start; the zero value of every field except Path is usable.
+type Process struct {
+	// Path is the executable to run.
+	Path string
+
+	// Args contains the command-line arguments for the process.
+	Args []string
+
+	// Dir is the working directory for the process.
+	// If empty, the process runs in the current directory.
+	Dir string
+
+	// Env contains additional environment variables for the process.
+	// If nil, inherits the current process environment.
+	Env []string
+
+	// BootPattern matches the output line that indicates the process has
+	// fully booted. If nil, the process is never considered booted.
+	BootPattern *regexp.Regexp
+
+	// StopCommand is written to stdin by Stop before interrupting the
+	// process. If empty, Stop only interrupts it.
+	StopCommand string
+
+	// StopSignal is sent by Stop after StopCommand. If nil, the process is
+	// interrupted the platform's usual way: SIGINT, or a Ctrl+Break event
+	// on Windows.
+	StopSignal os.Signal
+
+	// OnOutput is called for each line of output from the process, stdout
+	// and stderr alike. It runs in a separate goroutine.
+	OnOutput OutputHandler
+
+	// OnBoot is called exactly once per start, when a line matching
+	// BootPattern is seen.
+	OnBoot func()
+
+	// OnReadError is called when an output line is truncated (with an error
+	// wrapping ErrLineTruncated) and when reading stdout or stderr fails.
+	// Reading continues after a truncated line. It may be called from
+	// several goroutines at once.
+	OnReadError func(err error)
+
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  io.ReadCloser
+	stderr  io.ReadCloser
+	done    chan struct{}
+	err     error
+	errLock sync.RWMutex
+
+	// readers tracks the output reader goroutines so the process is only
+	// reaped after all of its output has been dispatched.
+	readers sync.WaitGroup
+
+	outputMu       sync.RWMutex
+	outputHandlers []OutputHandler
+
+	started   bool
+	mu        sync.Mutex
+	hasBooted atomic.Bool
+	bootOnce  sync.Once
+
+	// lastOutput holds the UnixNano timestamp of the most recent output line
+	// (or of process start, if nothing has been printed yet).
+	lastOutput atomic.Int64
+}
+
+// Start launches the process and begins reading its output.
+// The provided context controls the process lifecycle - when cancelled,
+// the process will be gracefully stopped.
+//
+// Start returns immediately after the process is launched. Use WaitForPattern
+// to wait for the process to be ready.
+//
+// A process that has exited may be started again. The boot state is reset,
+// so OnBoot is called again once the new process has booted.
+func (p *Process) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.started {
+		select {
+		case <-p.done:
+			// Previous process has exited; allow a restart
+			p.hasBooted.Store(false)
+			p.bootOnce = sync.Once{}
+			p.errLock.Lock()
+			p.err = nil
+			p.errLock.Unlock()
+		default:
+			return errors.New("server already started")
+		}
+	}
+
+	p.cmd = exec.Command(p.Path, p.Args...)
+	prepareCommand(p.cmd)
+	p.cmd.Dir = p.Dir
+	if p.Env != nil {
+		p.cmd.Env = append(os.Environ(), p.Env...)
+	}
+
+	// Set up stdin pipe
+	stdin, err := p.cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	p.stdin = stdin
+
+	// Set up stdout pipe. We create the pipes ourselves rather than using
+	// StdoutPipe so that cmd.Wait doesn't close the read ends before all
+	// output has been dispatched.
+	stdout, stdoutW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	p.stdout = stdout
+	p.cmd.Stdout = stdoutW
+
+	// Set up stderr pipe (merge with stdout for unified output handling)
+	stderr, stderrW, err := os.Pipe()
+	if err != nil {
+		stdout.Close()
+		stdoutW.Close()
+		return fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+	p.stderr = stderr
+	p.cmd.Stderr = stderrW
+
+	// Initialize done channel
+	p.done = make(chan struct{})
+
+	// Start the process
+	err = p.cmd.Start()
+
+	// The child holds its own copies of the write ends
+	stdoutW.Close()
+	stderrW.Close()
+
+	if err != nil {
+		stdout.Close()
+		stderr.Close()
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+
+	p.started = true
+	p.lastOutput.Store(time.Now().UnixNano())
+
+	// Start goroutines for reading output
+	p.readers.Add(2)
+	go p.readOutput(p.stdout)
+	go p.readOutput(p.stderr)
+
+	// Start goroutine to wait for process exit
+	go p.waitForExit()
+
+	// Start goroutine to handle context cancellation
+	go p.handleContextCancel(ctx, p.done)
+
+	return nil
+}
+
+// readOutput reads lines from the given reader and dispatches them to handlers.
+func (p *Process) readOutput(r io.Reader) {
+	defer p.readers.Done()
+
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, n, truncated, err := readLine(reader)
+		if n > 0 {
+			if truncated {
+				p.readError(fmt.Errorf("%w: kept %d of %d bytes", ErrLineTruncated, len(line), n))
+			}
+			p.handleLine(line)
+		}
+		if err != nil {
+			// The pipes are closed from under us if a child process keeps
+			// them open after the server exits
+			if err != io.EOF && !errors.Is(err, os.ErrClosed) {
+				p.readError(fmt.Errorf("failed to read output: %w", err))
+			}
+			return
+		}
+	}
+}
+
+// readLine reads the next line from r, without its line ending. Lines longer
+// than MaxLineSize are truncated and the rest is read and discarded. n is the
+// number of bytes consumed, so it is zero only when nothing was read.
+func readLine(r *bufio.Reader) (line string, n int, truncated bool, err error) {
+	// Keep room for a line ending after a line of exactly MaxLineSize
+	const keep = MaxLineSize + 2
+
+	var buf []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		n += len(chunk)
+		if room := keep - len(buf); room > 0 {
+			buf = append(buf, chunk[:min(room, len(chunk))]...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		buf = bytes.TrimSuffix(buf, []byte("\n"))
+		buf = bytes.TrimSuffix(buf, []byte("\r"))
+		if len(buf) > MaxLineSize {
+			buf, truncated = buf[:MaxLineSize], true
+		}
+		return string(buf), n, truncated, err
+	}
+}
+
+// handleLine records the output time, detects booting, and dispatches line.
+func (p *Process) handleLine(line string) {
+	p.lastOutput.Store(time.Now().UnixNano())
+
+	// Check for boot pattern and set hasBooted flag (only once)
+	if p.BootPattern != nil && p.BootPattern.MatchString(line) {
+		p.bootOnce.Do(func() {
+			p.hasBooted.Store(true)
+			if p.OnBoot != nil {
+				p.OnBoot()
+			}
+		})
+	}
+
+	// Call the main output handler if set
+	if p.OnOutput != nil {
+		p.OnOutput(line)
+	}
+
+	// Call registered handlers
+	p.dispatchToHandlers(line)
+}
+
+// readError reports err to OnReadError, if set.
+func (p *Process) readError(err error) {
+	if p.OnReadError != nil {
+		p.OnReadError(err)
+	}
+}
+
+// dispatchToHandlers sends the line to all registered output handlers.
+func (p *Process) dispatchToHandlers(line string) {
+	p.outputMu.Lock()
+	defer p.outputMu.Unlock()
+
+	// Filter handlers that return false (want to unsubscribe)
+	stillActive := p.outputHandlers[:0]
+	for _, handler := range p.outputHandlers {
+		if handler(line) {
+			stillActive = append(stillActive, handler)
+		}
+	}
+	p.outputHandlers = stillActive
+}
+
+// Subscribe registers a handler that receives every output line until it
+// returns false.
+func (p *Process) Subscribe(handler OutputHandler) {
+	p.outputMu.Lock()
+	defer p.outputMu.Unlock()
+	p.outputHandlers = append(p.outputHandlers, handler)
+}
+
+// waitForExit waits for the process to exit and records any error.
+// Remaining output is drained before Done is closed, so callers never miss
+// lines the process printed right before exiting.
+func (p *Process) waitForExit() {
+	err := p.cmd.Wait()
+
+	readersDone := make(chan struct{})
+	go func() {
+		p.readers.Wait()
+		close(readersDone)
+	}()
+
+	// A child process that outlives the server may keep the pipes open,
+	// so only wait a bounded amount of time before forcing them closed.
+	select {
+	case <-readersDone:
+	case <-time.After(outputDrainTimeout):
+		p.stdout.Close()
+		p.stderr.Close()
+		<-readersDone
+	}
+	p.stdout.Close()
+	p.stderr.Close()
+
+	p.errLock.Lock()
+	p.err = err
+	p.errLock.Unlock()
+	close(p.done)
+}
+
+// handleContextCancel watches for context cancellation and gracefully stops the process.
+func (p *Process) handleContextCancel(ctx context.Context, done <-chan struct{}) {
+	select {
+	case <-ctx.Done():
+		// Context cancelled - attempt graceful shutdown
+		// The caller is responsible for managing timeouts and escalation to Kill
+		p.Stop()
+	case <-done:
+		// Process exited on its own
+	}
+}
+
+// Stop attempts to gracefully stop the process by sending StopCommand
+// followed by StopSignal. This does not wait for the process to exit - use
+// Wait() or Done() for that. The caller is responsible for managing timeouts
+// and escalating to Kill() if needed.
+func (p *Process) Stop() {
+	if p.StopCommand != "" {
+		_ = p.SendCommand(p.StopCommand)
+	}
+
+	// Also interrupt processes that don't respond to the stop command
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd != nil && p.cmd.Process != nil {
+		if p.StopSignal != nil {
+			p.cmd.Process.Signal(p.StopSignal)
+		} else {
+			interruptProcess(p.cmd.Process)
+		}
+	}
+}
+
+// Interrupt sends SIGINT to the process (a Ctrl+Break event on Windows),
+// without the stop command. Returns ErrNotRunning if the process is not
+// running.
+func (p *Process) Interrupt() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.runningLocked() {
+		return ErrNotRunning
+	}
+	return interruptProcess(p.cmd.Process)
+}
+
+// Terminate asks the process to exit with SIGTERM (on Windows, the process
+// tree is asked to close, without forcing it). Returns ErrNotRunning if the
+// process is not running.
+func (p *Process) Terminate() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.runningLocked() {
+		return ErrNotRunning
+	}
+	return terminateProcess(p.cmd.Process)
+}
+
+// runningLocked reports whether the process has been started and hasn't
+// exited. p.mu must be held.
+func (p *Process) runningLocked() bool {
+	if !p.started || p.cmd == nil || p.cmd.Process == nil {
+		return false
+	}
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Kill forcefully terminates the process with SIGKILL (on Windows, the whole
+// process tree is terminated). This should be used when graceful shutdown
+// times out.
+func (p *Process) Kill() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd != nil && p.cmd.Process != nil {
+		killProcess(p.cmd.Process)
+	}
+}
+
+// Signal sends a signal to the running process.
+func (p *Process) Signal(sig os.Signal) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.started || p.cmd == nil || p.cmd.Process == nil {
+		return ErrNotRunning
+	}
+
+	select {
+	case <-p.done:
+		return ErrNotRunning
+	default:
+	}
+
+	return p.cmd.Process.Signal(sig)
+}
+
+// SendCommand sends a command to the process's stdin pipe.
+// The command is written followed by a newline.
+// Returns ErrNotRunning if the process is not running.
+func (p *Process) SendCommand(cmd string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.started || p.stdin == nil {
+		return ErrNotRunning
+	}
+
+	// Check if process has already exited
+	select {
+	case <-p.done:
+		return ErrNotRunning
+	default:
+	}
+
+	// Write the command with newline
+	_, err := fmt.Fprintln(p.stdin, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to send command: %w", err)
+	}
+
+	return nil
+}
+
+// WaitForPattern waits until a line matching the given regex pattern appears in
+// the output, or until the context is cancelled/times out.
+//
+// The pattern is compiled as a regular expression. Use regexp.QuoteMeta for
+// literal string matching.
+//
+// Returns the first matching line, or an error if the context expires or
+// the process exits before a match is found.
+func (p *Process) WaitForPattern(ctx context.Context, pattern string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	return p.WaitForRegex(ctx, re)
+}
+
+// WaitForRegex waits until a line matching the given compiled regex appears in
+// the output, or until the context is cancelled/times out.
+//
+// Returns the first matching line, or an error if the context expires or
+// the process exits before a match is found.
+func (p *Process) WaitForRegex(ctx context.Context, re *regexp.Regexp) (string, error) {
+	// Check if process is running
+	done := p.Done()
+	select {
+	case <-done:
+		return "", ErrNotRunning
+	default:
+	}
+
+	matchCh := make(chan string, 1)
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	// Register handler to watch for pattern
+	p.Subscribe(func(line string) bool {
+		select {
+		case <-doneCh:
+			return false // Unsubscribe
+		default:
+		}
+
+		if re.MatchString(line) {
+			select {
+			case matchCh <- line:
+			default:
+			}
+			return false // Unsubscribe after match
+		}
+		return true // Keep listening
+	})
+
+	// Wait for match, context cancellation, or process exit
+	select {
+	case line := <-matchCh:
+		return line, nil
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", ErrPatternTimeout
+		}
+		return "", ctx.Err()
+	case <-done:
+		// Check if we got a match before the process exited
+		select {
+		case line := <-matchCh:
+			return line, nil
+		default:
+			return "", ErrExited
+		}
+	}
+}
+
+// Wait blocks until the process exits.
+// Returns the exit error from the process, or nil if it exited cleanly.
+func (p *Process) Wait() error {
+	p.mu.Lock()
+	if !p.started {
+		p.mu.Unlock()
+		return ErrNotRunning
+	}
+	done := p.done
+	p.mu.Unlock()
+
+	<-done
+
+	p.errLock.RLock()
+	defer p.errLock.RUnlock()
+	return p.err
+}
+
+// Done returns a channel that is closed when the process exits.
+func (p *Process) Done() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.done == nil {
+		// Return a closed channel if not started
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}
+	return p.done
+}
+
+// Running returns true if the process is currently running.
+func (p *Process) Running() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.started || p.done == nil {
+		return false
+	}
+
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// HasBooted returns true if a line matching BootPattern has been seen since
+// the process was last started.
+func (p *Process) HasBooted() bool {
+	return p.hasBooted.Load()
+}
+
+// LastOutputTime returns the time the process last produced a line of output.
+// Before any output has been seen it returns the process start time, and
+// before Start it returns the zero time.
+func (p *Process) LastOutputTime() time.Time {
+	ns := p.lastOutput.Load()
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// ExitError returns the error from the process exit, if any.
+// Returns nil if the process hasn't exited yet or exited cleanly.
+func (p *Process) ExitError() error {
+	p.errLock.RLock()
+	defer p.errLock.RUnlock()
+	return p.err
+}
+
+// PID returns the process ID of the running process, or 0 if not running.
+func (p *Process) PID() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd != nil && p.cmd.Process != nil {
+		return p.cmd.Process.Pid
+	}
+	return 0
+}
@@ -0,0 +1,286 @@
+//go:build unix
+
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestProcess_BootPattern tests that a custom boot pattern triggers OnBoot once.
+func TestProcess_BootPattern(t *testing.T) {
+	var boots atomic.Int32
+	p := &Process{
+		Path:        "/bin/sh",
+		Args:        []string{"-c", `echo "Loading"; echo "Server ready on port 1234"; echo "Server ready on port 1234"; sleep 300`},
+		BootPattern: regexp.MustCompile(`^Server ready on port \d+$`),
+		OnBoot:      func() { boots.Add(1) },
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer p.Kill()
+
+	if _, err := p.WaitForPattern(ctx, "Server ready"); err != nil {
+		t.Fatalf("WaitForPattern failed: %v", err)
+	}
+	if !p.HasBooted() {
+		t.Error("expected HasBooted to be true")
+	}
+
+	p.Kill()
+	p.Wait()
+	if n := boots.Load(); n != 1 {
+		t.Errorf("OnBoot called %d times, want 1", n)
+	}
+}
+
+// TestProcess_NoBootPattern tests that a process without a boot pattern never boots.
+func TestProcess_NoBootPattern(t *testing.T) {
+	p := &Process{
+		Path: "/bin/sh",
+		Args: []string{"-c", `echo "Dedicated Server now running"`},
+	}
+
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	p.Wait()
+
+	if p.HasBooted() {
+		t.Error("expected HasBooted to be false without a BootPattern")
+	}
+}
+
+// TestProcess_StopCommand tests that Stop sends the configured stop command.
+func TestProcess_StopCommand(t *testing.T) {
+	p := &Process{
+		Path:        "/bin/sh",
+		Args:        []string{"-c", `trap "" INT; echo started; while read line; do if [ "$line" = "quit" ]; then exit 0; fi; done`},
+		StopCommand: "quit",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer p.Kill()
+	if _, err := p.WaitForPattern(ctx, "started"); err != nil {
+		t.Fatalf("WaitForPattern failed: %v", err)
+	}
+
+	p.Stop()
+
+	select {
+	case <-p.Done():
+	case <-ctx.Done():
+		t.Fatal("process did not exit after the stop command")
+	}
+	if err := p.ExitError(); err != nil {
+		t.Errorf("expected clean exit, got %v", err)
+	}
+}
+
+// TestProcess_StopSignal tests that Stop sends the configured signal.
+func TestProcess_StopSignal(t *testing.T) {
+	p := &Process{
+		Path:       "/bin/sh",
+		Args:       []string{"-c", `trap "exit 7" TERM; trap "" INT; echo started; while true; do sleep 0.05; done`},
+		StopSignal: syscall.SIGTERM,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer p.Kill()
+	if _, err := p.WaitForPattern(ctx, "started"); err != nil {
+		t.Fatalf("WaitForPattern failed: %v", err)
+	}
+
+	p.Stop()
+
+	select {
+	case <-p.Done():
+	case <-ctx.Done():
+		t.Fatal("process did not exit after the stop signal")
+	}
+	if err := p.ExitError(); err == nil || err.Error() != "exit status 7" {
+		t.Errorf("expected exit status 7 from the TERM trap, got %v", err)
+	}
+}
+
+// TestProcess_InterruptTerminate tests that Interrupt and Terminate send
+// their signals without the stop command.
+func TestProcess_InterruptTerminate(t *testing.T) {
+	p := &Process{
+		Path:        "/bin/sh",
+		Args:        []string{"-c", `trap "echo interrupted" INT; trap "exit 7" TERM; echo started; while true; do sleep 0.05; done`},
+		StopCommand: "quit",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer p.Kill()
+	if _, err := p.WaitForPattern(ctx, "started"); err != nil {
+		t.Fatalf("WaitForPattern failed: %v", err)
+	}
+
+	if err := p.Interrupt(); err != nil {
+		t.Fatalf("Interrupt failed: %v", err)
+	}
+	if _, err := p.WaitForPattern(ctx, "interrupted"); err != nil {
+		t.Fatalf("WaitForPattern failed: %v", err)
+	}
+	if err := p.Terminate(); err != nil {
+		t.Fatalf("Terminate failed: %v", err)
+	}
+
+	select {
+	case <-p.Done():
+	case <-ctx.Done():
+		t.Fatal("process did not exit after Terminate")
+	}
+	if err := p.ExitError(); err == nil || err.Error() != "exit status 7" {
+		t.Errorf("expected exit status 7 from the TERM trap, got %v", err)
+	}
+	if err := p.Terminate(); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Terminate after exit: expected ErrNotRunning, got %v", err)
+	}
+}
+
+// TestProcess_Subscribe tests that a subscriber receives lines until it returns false.
+func TestProcess_Subscribe(t *testing.T) {
+	// The process stays up until told to exit, so no output is in flight
+	// when it does
+	p := &Process{
+		Path: "/bin/sh",
+		Args: []string{"-c", `echo one; echo two; echo three; read cmd`},
+	}
+
+	var mu sync.Mutex
+	var lines []string
+	p.Subscribe(func(line string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, line)
+		return len(lines) < 2
+	})
+	sawLast := make(chan struct{})
+	p.Subscribe(func(line string) bool {
+		if line == "three" {
+			close(sawLast)
+			return false
+		}
+		return true
+	})
+
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	select {
+	case <-sawLast:
+	case <-time.After(5 * time.Second):
+		p.Kill()
+		t.Fatal("timed out waiting for output")
+	}
+	p.SendCommand("exit")
+	p.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lines) != 2 || lines[0] != "one" || lines[1] != "two" {
+		t.Errorf("expected [one two], got %v", lines)
+	}
+}
+
+// TestProcess_LongLine tests that an oversized line is truncated and
+// reported, and that output handling continues after it.
+func TestProcess_LongLine(t *testing.T) {
+	var readErrs atomic.Int32
+	var lengths []int
+	sawAfter := make(chan struct{})
+	p := &Process{
+		Path: "/bin/sh",
+		Args: []string{"-c", `head -c 1500000 /dev/zero | tr '\0' a; echo; echo after; sleep 5`},
+		OnOutput: func(line string) bool {
+			lengths = append(lengths, len(line))
+			if line == "after" {
+				close(sawAfter)
+			}
+			return true
+		},
+		OnReadError: func(err error) {
+			if errors.Is(err, ErrLineTruncated) {
+				readErrs.Add(1)
+			}
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	select {
+	case <-sawAfter:
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for the line after the long one")
+	}
+	p.Kill()
+	p.Wait()
+
+	if len(lengths) != 2 || lengths[0] != MaxLineSize || lengths[1] != len("after") {
+		t.Errorf("expected a truncated line and \"after\", got line lengths %v", lengths)
+	}
+	if n := readErrs.Load(); n != 1 {
+		t.Errorf("expected 1 truncation error, got %d", n)
+	}
+}
+
+// TestProcess_NotStarted tests operations on a process that was never started.
+func TestProcess_NotStarted(t *testing.T) {
+	var p Process
+
+	if err := p.SendCommand("hello"); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("SendCommand: expected ErrNotRunning, got %v", err)
+	}
+	if err := p.Wait(); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Wait: expected ErrNotRunning, got %v", err)
+	}
+	if _, err := p.WaitForPattern(context.Background(), "x"); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("WaitForPattern: expected ErrNotRunning, got %v", err)
+	}
+	if p.Running() || p.PID() != 0 || !p.LastOutputTime().IsZero() {
+		t.Error("expected an unstarted process to report not running")
+	}
+	select {
+	case <-p.Done():
+	default:
+		t.Error("expected Done to be closed before Start")
+	}
+	if err := p.Interrupt(); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Interrupt: expected ErrNotRunning, got %v", err)
+	}
+	p.Stop()
+	p.Kill()
+}
@@ -0,0 +1,42 @@
+package supervisor
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestReadLine tests line splitting, line endings, and truncation.
+func TestReadLine(t *testing.T) {
+	long := strings.Repeat("a", MaxLineSize)
+	input := "one\r\ntwo\n" + long + "\n" + long + "bc\n" + "last"
+
+	r := bufio.NewReaderSize(strings.NewReader(input), 16)
+
+	tests := []struct {
+		line      string
+		n         int
+		truncated bool
+	}{
+		{"one", 5, false},
+		{"two", 4, false},
+		{long, MaxLineSize + 1, false},
+		{long, MaxLineSize + 3, true},
+		{"last", 4, false},
+	}
+	for i, tt := range tests {
+		line, n, truncated, err := readLine(r)
+		if line != tt.line || n != tt.n || truncated != tt.truncated {
+			t.Errorf("line %d: got (%d bytes, n=%d, truncated=%v), want (%d bytes, n=%d, truncated=%v)",
+				i, len(line), n, truncated, len(tt.line), tt.n, tt.truncated)
+		}
+		if i < len(tests)-1 && err != nil {
+			t.Errorf("line %d: unexpected error %v", i, err)
+		}
+	}
+
+	if _, n, _, err := readLine(r); n != 0 || err != io.EOF {
+		t.Errorf("expected EOF after the last line, got n=%d err=%v", n, err)
+	}
+}
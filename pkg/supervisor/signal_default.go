@@ -0,0 +1,27 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// prepareCommand sets platform-specific process attributes before start.
+func prepareCommand(cmd *exec.Cmd) {}
+
+// interruptProcess asks the process to shut down with SIGINT.
+func interruptProcess(p *os.Process) error {
+	return p.Signal(os.Interrupt)
+}
+
+// terminateProcess asks the process to exit with SIGTERM.
+func terminateProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
+
+// killProcess terminates the process with SIGKILL.
+func killProcess(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,39 @@
+//go:build windows
+
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// prepareCommand starts the process in its own process group, so console
+// control events can be sent to it without also reaching the supervisor.
+func prepareCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: windows.CREATE_NEW_PROCESS_GROUP}
+}
+
+// interruptProcess sends Ctrl+Break to the process group started by
+// prepareCommand, the closest Windows equivalent of SIGINT.
+func interruptProcess(p *os.Process) error {
+	return windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, uint32(p.Pid))
+}
+
+// terminateProcess asks the process and any children it spawned to close,
+// without forcing them, the closest Windows equivalent of SIGTERM.
+func terminateProcess(p *os.Process) error {
+	return exec.Command("taskkill", "/T", "/PID", strconv.Itoa(p.Pid)).Run()
+}
+
+// killProcess terminates the process and any children it spawned.
+// Falls back to terminating just the process if taskkill is unavailable.
+func killProcess(p *os.Process) error {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(p.Pid)).Run(); err != nil {
+		return p.Kill()
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package testsupport
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// GameData is a server data directory whose serverconfig.json points the
+// server at a world save in Saves.
+type GameData struct {
+	// Dir is the data directory, as passed in the backup manager's GameDataDir.
+	Dir string
+
+	// SavePath is the world's save file. CreateGameData doesn't create it;
+	// fill it with CreateSave or CreateBloatedSave.
+	SavePath string
+}
+
+// CreateGameData creates a data directory in a temporary directory, with a
+// Saves directory and a serverconfig.json naming Saves/world.vcdbs.
+func CreateGameData(t testing.TB) *GameData {
+	t.Helper()
+
+	dir := t.TempDir()
+	g := &GameData{Dir: dir, SavePath: filepath.Join(dir, "Saves", "world.vcdbs")}
+	if err := os.MkdirAll(filepath.Dir(g.SavePath), 0755); err != nil {
+		t.Fatalf("Failed to create Saves dir: %v", err)
+	}
+
+	config := fmt.Sprintf(`{"WorldConfig": {"SaveFileLocation": %q}}`, g.SavePath)
+	if err := os.WriteFile(filepath.Join(dir, "serverconfig.json"), []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write serverconfig.json: %v", err)
+	}
+	return g
+}
+
+// GenBackup copies the save into the Backups directory as genbackup.vcdbs,
+// as the server's /genbackup command does.
+func (g *GameData) GenBackup() error {
+	backupsDir := filepath.Join(g.Dir, "Backups")
+	if err := os.MkdirAll(backupsDir, 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(g.SavePath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(filepath.Join(backupsDir, "genbackup.vcdbs"))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Server returns a mock server that answers /genbackup with GenBackup.
+func (g *GameData) Server() *Server {
+	return &Server{
+		OnCommand: func(cmd string) error {
+			if cmd != "/genbackup" {
+				return nil
+			}
+			return g.GenBackup()
+		},
+	}
+}
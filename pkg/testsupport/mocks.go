@@ -0,0 +1,139 @@
+// Package testsupport provides the mocks and fixtures this module's tests
+// share. The savegame fixtures also suit tests of code built on the vcdbtree
+// package. The mocks stand in for the server and checkers of the module's
+// internal backup package, satisfying its interfaces structurally, and are
+// safe for concurrent use.
+package testsupport
+
+import (
+	"context"
+	"sync"
+)
+
+// Server is a mock server that records the console commands sent to it.
+// It satisfies backup.ServerCommander.
+type Server struct {
+	// OnCommand, if set, is called for each command after it is recorded,
+	// and its error is returned from SendCommand.
+	OnCommand func(cmd string) error
+
+	mu       sync.Mutex
+	commands []string
+}
+
+// SendCommand records cmd and calls OnCommand.
+func (s *Server) SendCommand(cmd string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, cmd)
+	if s.OnCommand != nil {
+		return s.OnCommand(cmd)
+	}
+	return nil
+}
+
+// Commands returns a copy of the commands sent so far, in order.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.commands...)
+}
+
+// BootChecker is a mock boot checker. It satisfies backup.BootChecker.
+type BootChecker struct {
+	mu        sync.Mutex
+	hasBooted bool
+}
+
+// NewBootChecker returns a BootChecker that reports booted until changed.
+func NewBootChecker(booted bool) *BootChecker {
+	return &BootChecker{hasBooted: booted}
+}
+
+// HasBooted reports whether the mock server has booted.
+func (b *BootChecker) HasBooted() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.hasBooted
+}
+
+// SetBooted changes what HasBooted reports.
+func (b *BootChecker) SetBooted(booted bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.hasBooted = booted
+}
+
+// PlayerChecker is a mock player checker. It satisfies
+// backup.PlayerCheckerInterface and backup.PlayerCounter.
+type PlayerChecker struct {
+	mu           sync.Mutex
+	shouldBackup bool
+	players      int
+}
+
+// NewPlayerChecker returns a PlayerChecker that reports shouldBackup until changed.
+func NewPlayerChecker(shouldBackup bool) *PlayerChecker {
+	return &PlayerChecker{shouldBackup: shouldBackup}
+}
+
+// ShouldBackup reports whether a backup should run.
+func (p *PlayerChecker) ShouldBackup() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.shouldBackup
+}
+
+// SetShouldBackup changes what ShouldBackup reports.
+func (p *PlayerChecker) SetShouldBackup(shouldBackup bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.shouldBackup = shouldBackup
+}
+
+// PlayerCount reports the number of players online, zero until changed.
+func (p *PlayerChecker) PlayerCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.players
+}
+
+// SetPlayerCount changes what PlayerCount reports.
+func (p *PlayerChecker) SetPlayerCount(players int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.players = players
+}
+
+// ResticRunner is a mock restic runner that records the staging directories
+// it was asked to back up. Pass its Run method as backup.Manager.ResticRunner.
+type ResticRunner struct {
+	// Err is returned from every run.
+	Err error
+
+	// OnRun, if set, is called for each run instead of returning Err.
+	OnRun func(ctx context.Context, stagingDir string) error
+
+	mu   sync.Mutex
+	runs []string
+}
+
+// Run records stagingDir and returns OnRun's result, or Err.
+func (r *ResticRunner) Run(ctx context.Context, stagingDir string) error {
+	r.mu.Lock()
+	r.runs = append(r.runs, stagingDir)
+	onRun, err := r.OnRun, r.Err
+	r.mu.Unlock()
+
+	if onRun != nil {
+		return onRun(ctx, stagingDir)
+	}
+	return err
+}
+
+// Runs returns a copy of the staging directories passed to Run, in order.
+func (r *ResticRunner) Runs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.runs...)
+}
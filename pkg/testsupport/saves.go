@@ -0,0 +1,130 @@
+package testsupport
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// saveSchema matches the tables of a Vintage Story .vcdbs savegame.
+const saveSchema = `
+	PRAGMA page_size = 4096;
+	CREATE TABLE chunk (position integer PRIMARY KEY, data BLOB);
+	CREATE TABLE mapchunk (position integer PRIMARY KEY, data BLOB);
+	CREATE TABLE mapregion (position integer PRIMARY KEY, data BLOB);
+	CREATE TABLE gamedata (savegameid integer PRIMARY KEY, data BLOB);
+	CREATE TABLE playerdata (playerid integer PRIMARY KEY AUTOINCREMENT, playeruid TEXT, data BLOB);
+	CREATE INDEX index_playeruid ON playerdata (playeruid);
+`
+
+// Row is a row of one of the position-keyed savegame tables.
+type Row struct {
+	Position int64
+	Data     []byte
+}
+
+// Player is a row of the playerdata table.
+type Player struct {
+	UID  string
+	Data []byte
+}
+
+// Sample rows written by CreateSave.
+var (
+	SampleChunks = []Row{
+		{0, []byte("chunk_zero")},
+		{12345678901234, []byte("chunk_large_position")},
+		{0x00000012abff341c, []byte("chunk_hex_example")},
+		{0x0bff341c00005678, []byte("chunk_another")},
+	}
+	SampleMapChunks = []Row{
+		{100, []byte("mapchunk_100")},
+		{999999999, []byte("mapchunk_large")},
+	}
+	SampleMapRegions = []Row{
+		{42, []byte("mapregion_data")},
+	}
+	SampleGameData = []byte("gamedata_blob")
+
+	// SamplePlayers use base64-style UIDs containing + and /.
+	SamplePlayers = []Player{
+		{"B5fZ7vAsz3Kt+fmEV8GeK8Gu", []byte("player1_data")},
+		{"ABC123/DEF456+xyz", []byte("player2_data")},
+		{"SimplePlayer", []byte("player3_data")},
+	}
+)
+
+// CreateSave creates a .vcdbs savegame at path filled with the sample rows.
+func CreateSave(t testing.TB, path string) {
+	t.Helper()
+
+	db := createEmptySave(t, path)
+	defer db.Close()
+
+	insertRows(t, db, "chunk", SampleChunks)
+	insertRows(t, db, "mapchunk", SampleMapChunks)
+	insertRows(t, db, "mapregion", SampleMapRegions)
+	if _, err := db.Exec("INSERT INTO gamedata (savegameid, data) VALUES (?, ?)", 1, SampleGameData); err != nil {
+		t.Fatalf("Failed to insert gamedata: %v", err)
+	}
+	for _, p := range SamplePlayers {
+		if _, err := db.Exec("INSERT INTO playerdata (playeruid, data) VALUES (?, ?)", p.UID, p.Data); err != nil {
+			t.Fatalf("Failed to insert playerdata: %v", err)
+		}
+	}
+}
+
+// CreateBloatedSave creates a .vcdbs savegame at path with the given number of
+// chunks, plus free pages left behind by deleted rows, as a long-running
+// server would.
+func CreateBloatedSave(t testing.TB, path string, chunks int) {
+	t.Helper()
+
+	db := createEmptySave(t, path)
+	defer db.Close()
+
+	for i := 0; i < chunks; i++ {
+		if _, err := db.Exec("INSERT INTO chunk (position, data) VALUES (?, ?)", i, []byte(fmt.Sprintf("chunk_%d", i))); err != nil {
+			t.Fatalf("Failed to insert chunk: %v", err)
+		}
+	}
+
+	// Grow the file, then free the space again
+	garbage := make([]byte, 64*1024)
+	for i := 0; i < 32; i++ {
+		if _, err := db.Exec("INSERT INTO mapchunk (position, data) VALUES (?, ?)", i, garbage); err != nil {
+			t.Fatalf("Failed to insert mapchunk: %v", err)
+		}
+	}
+	if _, err := db.Exec("DELETE FROM mapchunk"); err != nil {
+		t.Fatalf("Failed to delete mapchunks: %v", err)
+	}
+}
+
+// createEmptySave creates a savegame with the schema and no rows.
+func createEmptySave(t testing.TB, path string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to create save: %v", err)
+	}
+	if _, err := db.Exec(saveSchema); err != nil {
+		db.Close()
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	return db
+}
+
+// insertRows inserts rows into one of the position-keyed tables.
+func insertRows(t testing.TB, db *sql.DB, table string, rows []Row) {
+	t.Helper()
+
+	for _, r := range rows {
+		if _, err := db.Exec("INSERT INTO "+table+" (position, data) VALUES (?, ?)", r.Position, r.Data); err != nil {
+			t.Fatalf("Failed to insert %s: %v", table, err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package testsupport_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/renorris/vintagestory-restic/internal/backup"
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+// The mocks must keep satisfying the interfaces they stand in for.
+var (
+	_ backup.ServerCommander        = (*testsupport.Server)(nil)
+	_ backup.BootChecker            = (*testsupport.BootChecker)(nil)
+	_ backup.PlayerCheckerInterface = (*testsupport.PlayerChecker)(nil)
+	_ backup.ResticRunner           = (*testsupport.ResticRunner)(nil).Run
+)
+
+func TestServer(t *testing.T) {
+	errRejected := errors.New("rejected")
+	s := &testsupport.Server{
+		OnCommand: func(cmd string) error {
+			if cmd == "/stop" {
+				return errRejected
+			}
+			return nil
+		},
+	}
+
+	if err := s.SendCommand("/genbackup"); err != nil {
+		t.Errorf("SendCommand() error = %v", err)
+	}
+	if err := s.SendCommand("/stop"); !errors.Is(err, errRejected) {
+		t.Errorf("SendCommand() error = %v, want %v", err, errRejected)
+	}
+
+	got := s.Commands()
+	if len(got) != 2 || got[0] != "/genbackup" || got[1] != "/stop" {
+		t.Errorf("Commands() = %v", got)
+	}
+}
+
+func TestCheckers(t *testing.T) {
+	b := testsupport.NewBootChecker(false)
+	b.SetBooted(true)
+	if !b.HasBooted() {
+		t.Error("HasBooted() = false after SetBooted(true)")
+	}
+
+	p := testsupport.NewPlayerChecker(true)
+	p.SetShouldBackup(false)
+	if p.ShouldBackup() {
+		t.Error("ShouldBackup() = true after SetShouldBackup(false)")
+	}
+	p.SetPlayerCount(3)
+	if p.PlayerCount() != 3 {
+		t.Errorf("PlayerCount() = %d after SetPlayerCount(3)", p.PlayerCount())
+	}
+}
+
+func TestResticRunner(t *testing.T) {
+	errFailed := errors.New("restic failed")
+	r := &testsupport.ResticRunner{Err: errFailed}
+
+	if err := r.Run(context.Background(), "/staging"); !errors.Is(err, errFailed) {
+		t.Errorf("Run() error = %v, want %v", err, errFailed)
+	}
+
+	r.OnRun = func(ctx context.Context, stagingDir string) error { return nil }
+	if err := r.Run(context.Background(), "/other"); err != nil {
+		t.Errorf("Run() error = %v, want OnRun's result", err)
+	}
+
+	runs := r.Runs()
+	if len(runs) != 2 || runs[0] != "/staging" || runs[1] != "/other" {
+		t.Errorf("Runs() = %v", runs)
+	}
+}
+
+func TestCreateSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.vcdbs")
+	testsupport.CreateSave(t, path)
+
+	db, err := sql.Open("sqlite3", path+"?mode=ro")
+	if err != nil {
+		t.Fatalf("Failed to open save: %v", err)
+	}
+	defer db.Close()
+
+	counts := map[string]int{
+		"chunk":      len(testsupport.SampleChunks),
+		"mapchunk":   len(testsupport.SampleMapChunks),
+		"mapregion":  len(testsupport.SampleMapRegions),
+		"gamedata":   1,
+		"playerdata": len(testsupport.SamplePlayers),
+	}
+	for table, want := range counts {
+		var got int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&got); err != nil {
+			t.Fatalf("Failed to count %s: %v", table, err)
+		}
+		if got != want {
+			t.Errorf("%s has %d rows, want %d", table, got, want)
+		}
+	}
+}
+
+func TestGameData(t *testing.T) {
+	g := testsupport.CreateGameData(t)
+	testsupport.CreateSave(t, g.SavePath)
+
+	srv := g.Server()
+	if err := srv.SendCommand("/autosavenow"); err != nil {
+		t.Fatalf("SendCommand(/autosavenow) failed: %v", err)
+	}
+	backup := filepath.Join(g.Dir, "Backups", "genbackup.vcdbs")
+	if _, err := os.Stat(backup); !os.IsNotExist(err) {
+		t.Fatalf("Backup written for /autosavenow: %v", err)
+	}
+
+	if err := srv.SendCommand("/genbackup"); err != nil {
+		t.Fatalf("SendCommand(/genbackup) failed: %v", err)
+	}
+	want, _ := os.ReadFile(g.SavePath)
+	if got, err := os.ReadFile(backup); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Backup = %d bytes, %v; want a copy of the save", len(got), err)
+	}
+
+	config, err := os.ReadFile(filepath.Join(g.Dir, "serverconfig.json"))
+	if err != nil || !bytes.Contains(config, []byte(g.SavePath)) {
+		t.Errorf("serverconfig.json = %s, %v; want it to name the save", config, err)
+	}
+}
@@ -0,0 +1,110 @@
+package vcdbtree
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TreeProblems are signs that a tree was left partly written, e.g. by a
+// crash or a full disk during a split, as found by CheckTree.
+type TreeProblems struct {
+	// MissingFormat is true if the tree has rows but no FormatFile. Trees
+	// written by this version record one once a split completes.
+	MissingFormat bool
+
+	// BadFormat is why the FormatFile can't be used, if it can't. Splits
+	// into the tree fail until it is removed.
+	BadFormat error
+
+	// EmptyFiles are zero-byte row files, relative to the tree.
+	EmptyFiles []string
+
+	// StrayFiles are files in the table directories that aren't rows, such
+	// as leftover temporary files, relative to the tree. Splits never
+	// remove them.
+	StrayFiles []string
+}
+
+// OK reports whether no problems were found.
+func (p *TreeProblems) OK() bool {
+	return !p.MissingFormat && p.BadFormat == nil && len(p.EmptyFiles) == 0 && len(p.StrayFiles) == 0
+}
+
+// String summarizes the problems, e.g. "2 empty row files, no vcdbtree.json".
+func (p *TreeProblems) String() string {
+	var parts []string
+	if p.BadFormat != nil {
+		parts = append(parts, p.BadFormat.Error())
+	}
+	if p.MissingFormat {
+		parts = append(parts, "no "+FormatFile)
+	}
+	if n := len(p.EmptyFiles); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d empty row file(s), e.g. %s", n, p.EmptyFiles[0]))
+	}
+	if n := len(p.StrayFiles); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d stray file(s), e.g. %s", n, p.StrayFiles[0]))
+	}
+	if len(parts) == 0 {
+		return "no problems"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CheckTree scans the tree at treeDir for signs that it was left partly
+// written. It only reads the tree; a missing tree has no problems.
+func CheckTree(ctx context.Context, treeDir string) (*TreeProblems, error) {
+	problems := &TreeProblems{}
+	if _, err := os.Stat(treeDir); os.IsNotExist(err) {
+		return problems, nil
+	}
+	if _, err := ReadFormat(treeDir); err != nil {
+		problems.BadFormat = err
+	}
+
+	rows := 0
+	for _, t := range treeTables {
+		err := filepath.WalkDir(filepath.Join(treeDir, t.subdir), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(treeDir, path)
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() || !strings.HasSuffix(d.Name(), ".bin") {
+				problems.StrayFiles = append(problems.StrayFiles, rel)
+				return nil
+			}
+			rows++
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if info.Size() == 0 {
+				problems.EmptyFiles = append(problems.EmptyFiles, rel)
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, &TableError{Op: "check", Table: t.table, Err: err}
+		}
+	}
+
+	if rows > 0 {
+		if _, err := os.Stat(filepath.Join(treeDir, FormatFile)); os.IsNotExist(err) {
+			problems.MissingFormat = true
+		}
+	}
+	return problems, nil
+}
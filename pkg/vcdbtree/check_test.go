@@ -0,0 +1,71 @@
+package vcdbtree
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestCheckTree(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	treeDir := filepath.Join(tmpDir, "tree")
+	if err := Split(dbPath, treeDir); err != nil {
+		t.Fatalf("Split() failed: %v", err)
+	}
+	ctx := context.Background()
+
+	problems, err := CheckTree(ctx, treeDir)
+	if err != nil || !problems.OK() {
+		t.Fatalf("CheckTree() of a complete tree = %v, %v", problems, err)
+	}
+
+	// What a split interrupted part-way through leaves behind
+	if err := os.WriteFile(filepath.Join(treeDir, "gamedata", "1.bin"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(treeDir, "playerdata", "x.bin.tmp"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(treeDir, FormatFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err = CheckTree(ctx, treeDir)
+	if err != nil {
+		t.Fatalf("CheckTree() failed: %v", err)
+	}
+	want := &TreeProblems{
+		MissingFormat: true,
+		EmptyFiles:    []string{filepath.Join("gamedata", "1.bin")},
+		StrayFiles:    []string{filepath.Join("playerdata", "x.bin.tmp")},
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("CheckTree() = %+v, want %+v", problems, want)
+	}
+	if problems.OK() {
+		t.Error("OK() = true for a damaged tree")
+	}
+
+	if err := os.WriteFile(filepath.Join(treeDir, FormatFile), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	problems, err = CheckTree(ctx, treeDir)
+	if err != nil || !errors.Is(problems.BadFormat, ErrUnsupportedFormat) || problems.MissingFormat {
+		t.Errorf("CheckTree() with a torn %s = %+v, %v", FormatFile, problems, err)
+	}
+}
+
+func TestCheckTree_Missing(t *testing.T) {
+	problems, err := CheckTree(context.Background(), filepath.Join(t.TempDir(), "missing"))
+	if err != nil || !problems.OK() {
+		t.Errorf("CheckTree() of a missing tree = %v, %v, want no problems", problems, err)
+	}
+}
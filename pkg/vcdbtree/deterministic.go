@@ -0,0 +1,83 @@
+package vcdbtree
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DeterministicModTime is the modification time given to every file and
+// directory of a tree split with Options.Deterministic.
+var DeterministicModTime = time.Unix(0, 0)
+
+const (
+	deterministicFileMode = 0644
+	deterministicDirMode  = 0755
+)
+
+// normalizeTree gives the tree root, its FormatFile, and everything in its
+// table subdirectories a fixed mode and DeterministicModTime. Entries that already
+// match are left alone, so unchanged files keep their ctime.
+func normalizeTree(ctx context.Context, treeDir string) error {
+	subdirs := []string{"gamedata", "playerdata"}
+	for _, t := range shardedTables {
+		subdirs = append(subdirs, t.subdir)
+	}
+
+	for _, subdir := range subdirs {
+		subdirPath := filepath.Join(treeDir, subdir)
+		if _, err := os.Stat(subdirPath); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.WalkDir(subdirPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return normalizeEntry(path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Lstat(filepath.Join(treeDir, FormatFile)); err == nil {
+		if err := normalizeEntry(filepath.Join(treeDir, FormatFile)); err != nil {
+			return err
+		}
+	}
+
+	return normalizeEntry(treeDir)
+}
+
+// normalizeEntry sets the mode and modification time of a single file or directory.
+// Changing a child doesn't touch its parent's mtime, so a single pass is enough.
+func normalizeEntry(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	var mode os.FileMode = deterministicFileMode
+	if info.IsDir() {
+		mode = deterministicDirMode
+	}
+
+	if info.Mode().Perm() != mode {
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+	}
+	if !info.ModTime().Equal(DeterministicModTime) {
+		if err := os.Chtimes(path, DeterministicModTime, DeterministicModTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
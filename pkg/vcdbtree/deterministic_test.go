@@ -0,0 +1,130 @@
+package vcdbtree
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+// treeManifest describes every entry of a tree: path, mode, mtime, and content.
+func treeManifest(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var entries []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		entry := fmt.Sprintf("%s %v %d", rel, info.Mode(), info.ModTime().Unix())
+		if !d.IsDir() {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			entry += fmt.Sprintf(" %x", data)
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk %s: %v", dir, err)
+	}
+	return entries
+}
+
+func TestSplitContext_Deterministic(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	var positions []int64
+	opts := &Options{
+		Deterministic: true,
+		OnRowWritten: func(table string, position int64, size int) {
+			if table == "chunk" {
+				positions = append(positions, position)
+			}
+		},
+	}
+
+	outA := filepath.Join(tmpDir, "a")
+	if err := SplitContext(context.Background(), dbPath, outA, opts); err != nil {
+		t.Fatalf("SplitContext failed: %v", err)
+	}
+
+	if !sort.SliceIsSorted(positions, func(i, j int) bool { return positions[i] < positions[j] }) {
+		t.Errorf("Chunks were not written in position order: %v", positions)
+	}
+
+	// A different split path produces an identical tree
+	outB := filepath.Join(tmpDir, "b")
+	if _, _, err := SplitWithCacheContext(context.Background(), dbPath, outB, &Options{Deterministic: true}); err != nil {
+		t.Fatalf("SplitWithCacheContext failed: %v", err)
+	}
+
+	a, b := treeManifest(t, outA), treeManifest(t, outB)
+	if fmt.Sprint(a) != fmt.Sprint(b) {
+		t.Errorf("Trees differ:\n%v\n%v", a, b)
+	}
+
+	filepath.WalkDir(outA, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, _ := d.Info()
+		if !info.ModTime().Equal(DeterministicModTime) {
+			t.Errorf("%s mtime = %v, want %v", path, info.ModTime(), DeterministicModTime)
+		}
+		want := os.FileMode(0644)
+		if d.IsDir() {
+			want = 0755
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s mode = %v, want %v", path, info.Mode().Perm(), want)
+		}
+		return nil
+	})
+}
+
+func TestSplitWithCacheContext_DeterministicNormalizesExistingFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	// A previous non-deterministic run leaves current mtimes and odd modes behind
+	cacheDir := filepath.Join(tmpDir, "cache")
+	if _, _, err := SplitWithCache(dbPath, cacheDir); err != nil {
+		t.Fatalf("SplitWithCache failed: %v", err)
+	}
+	gamedataFile := filepath.Join(cacheDir, "gamedata", "1.bin")
+	os.Chmod(gamedataFile, 0600)
+
+	written, _, err := SplitWithCacheContext(context.Background(), dbPath, cacheDir, &Options{Deterministic: true})
+	if err != nil {
+		t.Fatalf("SplitWithCacheContext failed: %v", err)
+	}
+	if written != 0 {
+		t.Errorf("Expected unchanged files to be skipped, got %d written", written)
+	}
+
+	info, err := os.Stat(gamedataFile)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0644 || !info.ModTime().Equal(DeterministicModTime) {
+		t.Errorf("gamedata file mode = %v, mtime = %v; want 0644 and %v",
+			info.Mode().Perm(), info.ModTime().Format(time.RFC3339), DeterministicModTime.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,110 @@
+package vcdbtree
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DigestPrefix starts every digest returned by Digest, naming its hash.
+const DigestPrefix = "sha256:"
+
+// ErrDigestMismatch is returned by VerifyDigest when a tree's content
+// differs from what the digest was taken of.
+var ErrDigestMismatch = errors.New("tree digest mismatch")
+
+// Digest returns a Merkle-style digest of the rows stored in the tree at
+// treeDir: each file is hashed, each directory hashes the sorted names,
+// kinds, and hashes of its entries, and the root covers the table
+// subdirectories. Trees with the same files at the same paths have the same
+// digest, whatever their modes, times, or FormatFile; any changed, added,
+// missing, or moved row changes it. The result looks like "sha256:<hex>".
+func Digest(ctx context.Context, treeDir string) (string, error) {
+	if _, err := os.Stat(treeDir); err != nil {
+		return "", fmt.Errorf("failed to open tree: %w", err)
+	}
+
+	root := sha256.New()
+	for _, t := range treeTables {
+		sum, err := digestDir(ctx, filepath.Join(treeDir, t.subdir))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", &TableError{Op: "digest", Table: t.table, Err: err}
+		}
+		fmt.Fprintf(root, "d %x %s\n", sum, t.subdir)
+	}
+	return DigestPrefix + hex.EncodeToString(root.Sum(nil)), nil
+}
+
+// VerifyDigest checks that the tree at treeDir has the digest want, as
+// returned by Digest. A different digest returns an error wrapping
+// ErrDigestMismatch.
+func VerifyDigest(ctx context.Context, treeDir, want string) error {
+	if !strings.HasPrefix(want, DigestPrefix) {
+		return fmt.Errorf("unsupported tree digest %q", want)
+	}
+	got, err := Digest(ctx, treeDir)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("%w: expected %s, got %s", ErrDigestMismatch, want, got)
+	}
+	return nil
+}
+
+// digestDir returns the hash of a directory: one line per entry, in name
+// order, with its kind ("d" or "f"), hash, and name. Other kinds of entries
+// aren't part of a tree and are skipped.
+func digestDir(ctx context.Context, dir string) ([]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, entry.Name())
+		switch {
+		case entry.IsDir():
+			sum, err := digestDir(ctx, path)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(h, "d %x %s\n", sum, entry.Name())
+		case entry.Type().IsRegular():
+			sum, err := digestFile(path)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(h, "f %x %s\n", sum, entry.Name())
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// digestFile returns the SHA-256 hash of a file's content.
+func digestFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,81 @@
+package vcdbtree
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestDigest(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	treeDir := filepath.Join(tmpDir, "tree")
+	if err := Split(dbPath, treeDir); err != nil {
+		t.Fatalf("Split() failed: %v", err)
+	}
+	want, err := Digest(context.Background(), treeDir)
+	if err != nil {
+		t.Fatalf("Digest() failed: %v", err)
+	}
+	if !strings.HasPrefix(want, DigestPrefix) {
+		t.Errorf("Digest() = %q, want a %s digest", want, DigestPrefix)
+	}
+
+	// Metadata and the FormatFile aren't part of the digest
+	other := filepath.Join(tmpDir, "other")
+	if err := SplitContext(context.Background(), dbPath, other, &Options{Deterministic: true}); err != nil {
+		t.Fatalf("SplitContext() failed: %v", err)
+	}
+	if err := os.Chtimes(filepath.Join(other, "gamedata", "1.bin"), time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyDigest(context.Background(), other, want); err != nil {
+		t.Errorf("VerifyDigest() on an identical tree failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(dir string) error
+	}{
+		{"changed row", func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "gamedata", "1.bin"), []byte("changed"), 0644)
+		}},
+		{"added row", func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "gamedata", "2.bin"), []byte("added"), 0644)
+		}},
+		{"missing row", func(dir string) error {
+			return os.Remove(filepath.Join(dir, "gamedata", "1.bin"))
+		}},
+		{"moved row", func(dir string) error {
+			return os.Rename(filepath.Join(dir, "gamedata", "1.bin"), filepath.Join(dir, "gamedata", "3.bin"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "tree")
+			if err := Split(dbPath, dir); err != nil {
+				t.Fatalf("Split() failed: %v", err)
+			}
+			if err := tt.change(dir); err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyDigest(context.Background(), dir, want); !errors.Is(err, ErrDigestMismatch) {
+				t.Errorf("VerifyDigest() error = %v, want ErrDigestMismatch", err)
+			}
+		})
+	}
+}
+
+func TestVerifyDigest_RejectsUnknownDigest(t *testing.T) {
+	if err := VerifyDigest(context.Background(), t.TempDir(), "md5:abc"); err == nil || errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("VerifyDigest() error = %v, want an unsupported digest error", err)
+	}
+}
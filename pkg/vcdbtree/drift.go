@@ -0,0 +1,204 @@
+package vcdbtree
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TableDrift counts how the rows of one table differ between a database and
+// a tree.
+type TableDrift struct {
+	// Changed is how many rows are in both, with different data.
+	Changed int
+
+	// Added is how many rows are only in the database.
+	Added int
+
+	// Removed is how many rows are only in the tree.
+	Removed int
+
+	// Bytes is the size of the changed and added rows in the database.
+	Bytes int64
+}
+
+// Rows returns how many rows differ in any way.
+func (t TableDrift) Rows() int {
+	return t.Changed + t.Added + t.Removed
+}
+
+// Drift is how a database differs from a tree, as reported by Compare.
+type Drift struct {
+	// Tables maps each table with differences to them.
+	Tables map[string]TableDrift
+}
+
+// Total returns the differences of all tables together.
+func (d *Drift) Total() TableDrift {
+	var total TableDrift
+	for _, t := range d.Tables {
+		total.Changed += t.Changed
+		total.Added += t.Added
+		total.Removed += t.Removed
+		total.Bytes += t.Bytes
+	}
+	return total
+}
+
+// String summarizes the drift per table, such as
+// "chunk: 12 changed, 3 added (1.2 MiB); playerdata: 1 changed (4.0 KiB)".
+func (d *Drift) String() string {
+	var parts []string
+	for _, t := range treeTables {
+		td, ok := d.Tables[t.table]
+		if !ok {
+			continue
+		}
+		var counts []string
+		for _, c := range []struct {
+			n    int
+			verb string
+		}{{td.Changed, "changed"}, {td.Added, "added"}, {td.Removed, "removed"}} {
+			if c.n > 0 {
+				counts = append(counts, fmt.Sprintf("%d %s", c.n, c.verb))
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s (%s)", t.table, strings.Join(counts, ", "), formatProgressBytes(float64(td.Bytes))))
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Compare reports how the database at dbPath differs from the tree at
+// treeDir, row by row, without changing either: what a split of the
+// database into the tree would write and remove. The tree's recorded layout
+// is used; opts.Filter and opts.MapSizeX apply as they do to a split.
+// Compare only reads the database, so it can be used on a live save.
+func Compare(ctx context.Context, dbPath, treeDir string, opts *Options) (*Drift, error) {
+	if _, err := os.Stat(treeDir); err != nil {
+		return nil, fmt.Errorf("failed to open tree: %w", err)
+	}
+	format, err := ReadFormat(treeDir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db, err := sql.Open("sqlite3", dbPath+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	drift := &Drift{Tables: make(map[string]TableDrift)}
+	record := func(table string, td TableDrift, found, inTree int) {
+		td.Removed = inTree - found
+		if td.Rows() > 0 {
+			drift.Tables[table] = td
+		}
+	}
+
+	for _, t := range shardedTables {
+		subdir := filepath.Join(treeDir, t.subdir)
+		td, found, err := compareRows(ctx, db, fmt.Sprintf("SELECT position, data FROM %s", t.table), func(key any) string {
+			position := key.(int64)
+			if !opts.keep(t.table, position) {
+				return ""
+			}
+			return format.Layout.path(treeDir, t.table, t.subdir, position, opts.mapSizeX())
+		})
+		if err != nil {
+			return nil, &TableError{Op: "compare", Table: t.table, Err: err}
+		}
+		inTree, err := countShardedFiles(ctx, subdir)
+		if err != nil {
+			return nil, &TableError{Op: "compare", Table: t.table, Err: err}
+		}
+		record(t.table, td, found, inTree)
+	}
+
+	td, found, err := compareRows(ctx, db, "SELECT savegameid, data FROM gamedata", func(key any) string {
+		return filepath.Join(treeDir, "gamedata", fmt.Sprintf("%d.bin", key.(int64)))
+	})
+	if err != nil {
+		return nil, &TableError{Op: "compare", Table: "gamedata", Err: err}
+	}
+	inTree, err := countFlatFiles(filepath.Join(treeDir, "gamedata"), func(name string) bool {
+		_, err := strconv.ParseInt(name, 10, 64)
+		return err == nil
+	})
+	if err != nil {
+		return nil, &TableError{Op: "compare", Table: "gamedata", Err: err}
+	}
+	record("gamedata", td, found, inTree)
+
+	td, found, err = compareRows(ctx, db, "SELECT playeruid, data FROM playerdata", func(key any) string {
+		uid := key.(string)
+		if uid == "" {
+			return ""
+		}
+		return filepath.Join(treeDir, "playerdata", sanitizePlayerUID(uid)+".bin")
+	})
+	if err != nil {
+		return nil, &TableError{Op: "compare", Table: "playerdata", Err: err}
+	}
+	inTree, err = countFlatFiles(filepath.Join(treeDir, "playerdata"), func(string) bool { return true })
+	if err != nil {
+		return nil, &TableError{Op: "compare", Table: "playerdata", Err: err}
+	}
+	record("playerdata", td, found, inTree)
+
+	return drift, nil
+}
+
+// compareRows compares the rows of query, each a key and data, with the
+// files pathFor returns for their keys; rows with no path are skipped. found
+// is how many of the rows have a file in the tree. Removed is left to the
+// caller, who knows how many files the tree has.
+func compareRows(ctx context.Context, db *sql.DB, query string, pathFor func(key any) string) (td TableDrift, found int, err error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return td, 0, fmt.Errorf("failed to query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return td, found, err
+		}
+		var key any
+		var data []byte
+		if err := rows.Scan(&key, &data); err != nil {
+			return td, found, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if data == nil {
+			continue
+		}
+		if s, ok := key.([]byte); ok {
+			key = string(s)
+		}
+		path := pathFor(key)
+		if path == "" {
+			continue
+		}
+
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			td.Added++
+			td.Bytes += int64(len(data))
+			continue
+		}
+		found++
+		if !fileMatchesContent(path, data) {
+			td.Changed++
+			td.Bytes += int64(len(data))
+		}
+	}
+	return td, found, rows.Err()
+}
@@ -0,0 +1,119 @@
+package vcdbtree
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestCompare(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	treeDir := filepath.Join(tmpDir, "tree")
+	if _, _, err := SplitWithCache(dbPath, treeDir); err != nil {
+		t.Fatalf("SplitWithCache() failed: %v", err)
+	}
+	ctx := context.Background()
+
+	drift, err := Compare(ctx, dbPath, treeDir, nil)
+	if err != nil {
+		t.Fatalf("Compare() failed: %v", err)
+	}
+	if len(drift.Tables) != 0 || drift.String() != "no changes" {
+		t.Fatalf("Compare() of a freshly split save = %v, want no changes", drift)
+	}
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"UPDATE chunk SET data = X'01020304' WHERE position = 0",
+		"INSERT INTO chunk (position, data) VALUES (7, X'0506')",
+		"DELETE FROM mapregion",
+		"UPDATE playerdata SET data = X'09' WHERE playeruid = 'SimplePlayer'",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	db.Close()
+
+	drift, err = Compare(ctx, dbPath, treeDir, nil)
+	if err != nil {
+		t.Fatalf("Compare() failed: %v", err)
+	}
+	want := map[string]TableDrift{
+		"chunk":      {Changed: 1, Added: 1, Bytes: 6},
+		"mapregion":  {Removed: 1},
+		"playerdata": {Changed: 1, Bytes: 1},
+	}
+	if len(drift.Tables) != len(want) {
+		t.Errorf("Compare() tables = %v, want %v", drift.Tables, want)
+	}
+	for table, w := range want {
+		if got := drift.Tables[table]; got != w {
+			t.Errorf("Compare() %s = %+v, want %+v", table, got, w)
+		}
+	}
+	if total := drift.Total(); total.Rows() != 4 || total.Bytes != 7 {
+		t.Errorf("Total() = %+v, want 4 rows and 7 bytes", total)
+	}
+	if s := drift.String(); !strings.HasPrefix(s, "chunk: 1 changed, 1 added") || !strings.Contains(s, "mapregion: 1 removed") {
+		t.Errorf("String() = %q", s)
+	}
+
+	// Compare only reads: a split still finds the same work to do
+	written, _, err := SplitWithCache(dbPath, treeDir)
+	if err != nil {
+		t.Fatalf("SplitWithCache() failed: %v", err)
+	}
+	if written != 3 {
+		t.Errorf("split after Compare wrote %d files, want 3", written)
+	}
+	drift, err = Compare(ctx, dbPath, treeDir, nil)
+	if err != nil || len(drift.Tables) != 0 {
+		t.Errorf("Compare() after the split = %v, %v, want no changes", drift, err)
+	}
+}
+
+func TestCompare_Filter(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	dropChunks := &Options{Filter: func(table string, position int64) bool { return table != "chunk" }}
+	treeDir := filepath.Join(tmpDir, "tree")
+	if _, _, err := SplitWithCacheContext(context.Background(), dbPath, treeDir, dropChunks); err != nil {
+		t.Fatalf("SplitWithCache() failed: %v", err)
+	}
+
+	// Filtered rows are no drift when the same filter is used
+	drift, err := Compare(context.Background(), dbPath, treeDir, dropChunks)
+	if err != nil || len(drift.Tables) != 0 {
+		t.Errorf("Compare() = %v, %v, want no changes", drift, err)
+	}
+	drift, err = Compare(context.Background(), dbPath, treeDir, nil)
+	if err != nil {
+		t.Fatalf("Compare() failed: %v", err)
+	}
+	if got := drift.Tables["chunk"].Added; got != len(testsupport.SampleChunks) {
+		t.Errorf("Compare() without the filter added %d chunks, want %d", got, len(testsupport.SampleChunks))
+	}
+}
+
+func TestCompare_NoTree(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	if _, err := Compare(context.Background(), dbPath, filepath.Join(tmpDir, "missing"), nil); err == nil {
+		t.Error("Compare() against a missing tree should fail")
+	}
+}
@@ -0,0 +1,31 @@
+package vcdbtree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidFilename is returned when a file in a vcdbtree directory does not
+// follow the naming scheme for its table.
+var ErrInvalidFilename = errors.New("invalid vcdbtree filename")
+
+// TableError records a failure while processing a single table.
+type TableError struct {
+	// Op is the operation that failed: "split", "combine", "trim", "verify",
+	// "scan", "read", "digest", "check", or "compare".
+	Op string
+
+	// Table is the SQLite table being processed (e.g. "chunk").
+	Table string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *TableError) Error() string {
+	return fmt.Sprintf("failed to %s %s table: %v", e.Op, e.Table, e.Err)
+}
+
+func (e *TableError) Unwrap() error {
+	return e.Err
+}
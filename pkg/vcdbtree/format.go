@@ -0,0 +1,179 @@
+package vcdbtree
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FormatFile is the name of the marker file at the root of a tree that
+// records its Format.
+const FormatFile = "vcdbtree.json"
+
+// FormatVersion is the tree format version written by this package:
+//
+//   - 0: no FormatFile. Geographic layout, with map chunks and map regions
+//     possibly still sharded by ChunkPos bit fields.
+//   - 1: a FormatFile recording only the layout, written for hex trees.
+//   - 2: every tree has a FormatFile with its layout, source, and creation time.
+const FormatVersion = 2
+
+// ErrUnsupportedFormat is returned for trees whose FormatFile was written by a
+// newer version of this package, or can't be understood.
+var ErrUnsupportedFormat = errors.New("unsupported vcdbtree format")
+
+// Format describes a tree, as recorded in its FormatFile.
+type Format struct {
+	// Version is the FormatVersion the tree was last written with.
+	Version int
+
+	// Layout is how position-based rows are arranged.
+	Layout Layout
+
+	// Source is the file name of the database the tree was last split from.
+	Source string
+
+	// CreatedAt is when the tree was first split. SplitWithCache keeps it.
+	CreatedAt time.Time
+
+	// WorldID is the savegame identifier of the world the tree was split
+	// from, or "" if it isn't known. See SplitWithCache.
+	WorldID string
+}
+
+// formatMarker is the content of FormatFile.
+type formatMarker struct {
+	Version   int        `json:"version"`
+	Layout    LayoutKind `json:"layout"`
+	Levels    int        `json:"levels,omitempty"`
+	Fanout    int        `json:"fanout,omitempty"`
+	Source    string     `json:"source,omitempty"`
+	CreatedAt time.Time  `json:"created_at,omitzero"`
+	WorldID   string     `json:"world_id,omitempty"`
+}
+
+// ReadFormat returns the format recorded in the tree at treeDir. A tree
+// without a FormatFile is version 0 with LayoutGeographic. Trees written by a
+// newer version return an error wrapping ErrUnsupportedFormat.
+func ReadFormat(treeDir string) (Format, error) {
+	data, err := os.ReadFile(filepath.Join(treeDir, FormatFile))
+	if os.IsNotExist(err) {
+		return Format{Layout: Layout{Kind: LayoutGeographic}}, nil
+	}
+	if err != nil {
+		return Format{}, fmt.Errorf("failed to read %s: %w", FormatFile, err)
+	}
+
+	var marker formatMarker
+	if err := json.Unmarshal(data, &marker); err != nil {
+		return Format{}, fmt.Errorf("%w: failed to parse %s: %v", ErrUnsupportedFormat, FormatFile, err)
+	}
+	if marker.Version < 1 || marker.Version > FormatVersion {
+		return Format{}, fmt.Errorf("%w: tree is format version %d, this version supports up to %d",
+			ErrUnsupportedFormat, marker.Version, FormatVersion)
+	}
+
+	layout := Layout{Kind: marker.Layout, Levels: marker.Levels, Fanout: marker.Fanout}
+	if err := layout.validate(); err != nil {
+		return Format{}, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+
+	return Format{
+		Version:   marker.Version,
+		Layout:    layout.normalize(),
+		Source:    marker.Source,
+		CreatedAt: marker.CreatedAt,
+		WorldID:   marker.WorldID,
+	}, nil
+}
+
+// ReadLayout returns the layout recorded in the tree at treeDir, or
+// LayoutGeographic if the tree has no FormatFile.
+func ReadLayout(treeDir string) (Layout, error) {
+	f, err := ReadFormat(treeDir)
+	if err != nil {
+		return Layout{}, err
+	}
+	return f.Layout, nil
+}
+
+// writeFormat records f as the current FormatVersion in the tree at
+// treeDir. An unchanged marker is left alone to keep its metadata.
+func writeFormat(treeDir string, f Format) error {
+	path := filepath.Join(treeDir, FormatFile)
+	layout := f.Layout.normalize()
+
+	marker := formatMarker{
+		Version:   FormatVersion,
+		Layout:    layout.Kind,
+		Source:    f.Source,
+		CreatedAt: f.CreatedAt.UTC().Truncate(time.Second),
+		WorldID:   f.WorldID,
+	}
+	if layout.Kind == LayoutHex {
+		marker.Levels = layout.Levels
+		marker.Fanout = layout.Fanout
+	}
+
+	data, err := json.MarshalIndent(marker, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	// Replace rather than truncate, like Throttle.writeFile
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to replace %s: %w", FormatFile, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", FormatFile, err)
+	}
+	return nil
+}
+
+// createdAt returns the creation time to record for a new tree.
+func (o *Options) createdAt() time.Time {
+	if o.deterministic() {
+		return DeterministicModTime
+	}
+	return time.Now()
+}
+
+// migration moves rows of a tree from the format it was found in to the
+// layout being written, so unchanged rows aren't rewritten.
+type migration struct {
+	from Format
+	to   Layout
+}
+
+// sources returns where the tree may hold the row that belongs at path, in
+// the order to try them. It is empty when the tree needs no migration.
+func (m migration) sources(baseDir, table, subdir string, position, mapSizeX int64) []string {
+	var paths []string
+	if m.from.Layout != m.to {
+		paths = append(paths, m.from.Layout.path(baseDir, table, subdir, position, mapSizeX))
+	}
+	// Version 0 trees may still shard map chunks and map regions by ChunkPos
+	if m.from.Version == 0 {
+		paths = append(paths, legacyShardedPath(baseDir, subdir, position))
+	}
+	return paths
+}
+
+// apply moves the first existing source file to path, if nothing exists at
+// path yet.
+func (m migration) apply(path, baseDir, table, subdir string, position, mapSizeX int64) error {
+	for _, src := range m.sources(baseDir, table, subdir, position, mapSizeX) {
+		if err := migrateLegacyPath(src, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
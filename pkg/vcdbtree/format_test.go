@@ -0,0 +1,165 @@
+package vcdbtree
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestReadFormat_MissingMarker(t *testing.T) {
+	f, err := ReadFormat(t.TempDir())
+	if err != nil {
+		t.Fatalf("ReadFormat failed: %v", err)
+	}
+	if f.Version != 0 || f.Layout.Kind != LayoutGeographic {
+		t.Errorf("ReadFormat = %+v, want version 0 with the geographic layout", f)
+	}
+}
+
+func TestSplit_WritesFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "world.vcdbs")
+	treeDir := filepath.Join(tmpDir, "tree")
+	testsupport.CreateSave(t, dbPath)
+
+	before := time.Now().Add(-time.Second)
+	if err := Split(dbPath, treeDir); err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+
+	f, err := ReadFormat(treeDir)
+	if err != nil {
+		t.Fatalf("ReadFormat failed: %v", err)
+	}
+	if f.Version != FormatVersion {
+		t.Errorf("Version = %d, want %d", f.Version, FormatVersion)
+	}
+	if f.Layout.Kind != LayoutGeographic {
+		t.Errorf("Layout = %v, want geographic", f.Layout)
+	}
+	if f.Source != "world.vcdbs" {
+		t.Errorf("Source = %q, want world.vcdbs", f.Source)
+	}
+	if f.CreatedAt.Before(before) || f.CreatedAt.After(time.Now()) {
+		t.Errorf("CreatedAt = %v, want about now", f.CreatedAt)
+	}
+}
+
+func TestSplitWithCache_KeepsCreatedAt(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "world.vcdbs")
+	cacheDir := filepath.Join(tmpDir, "cache")
+	testsupport.CreateSave(t, dbPath)
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFormat(cacheDir, Format{Layout: Layout{Kind: LayoutGeographic}, Source: "old.vcdbs", CreatedAt: created}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := SplitWithCache(dbPath, cacheDir); err != nil {
+		t.Fatalf("SplitWithCache failed: %v", err)
+	}
+
+	f, err := ReadFormat(cacheDir)
+	if err != nil {
+		t.Fatalf("ReadFormat failed: %v", err)
+	}
+	if !f.CreatedAt.Equal(created) {
+		t.Errorf("CreatedAt = %v, want %v", f.CreatedAt, created)
+	}
+	if f.Source != "world.vcdbs" {
+		t.Errorf("Source = %q, want world.vcdbs", f.Source)
+	}
+}
+
+func TestSplitWithCache_UnchangedFormatKeepsMarker(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "world.vcdbs")
+	cacheDir := filepath.Join(tmpDir, "cache")
+	testsupport.CreateSave(t, dbPath)
+
+	if _, _, err := SplitWithCache(dbPath, cacheDir); err != nil {
+		t.Fatalf("SplitWithCache failed: %v", err)
+	}
+	marker := filepath.Join(cacheDir, FormatFile)
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(marker, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := SplitWithCache(dbPath, cacheDir); err != nil {
+		t.Fatalf("SplitWithCache failed: %v", err)
+	}
+	info, err := os.Stat(marker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("%s was rewritten although nothing changed", FormatFile)
+	}
+}
+
+func TestSplitWithCache_MigratesVersion1Tree(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "world.vcdbs")
+	cacheDir := filepath.Join(tmpDir, "cache")
+	testsupport.CreateSave(t, dbPath)
+
+	hex := Layout{Kind: LayoutHex, Levels: 2, Fanout: 256}
+	if _, _, err := SplitWithCacheContext(context.Background(), dbPath, cacheDir, &Options{Layout: &hex}); err != nil {
+		t.Fatalf("SplitWithCache failed: %v", err)
+	}
+	v1 := `{"version":1,"layout":"hex","levels":2,"fanout":256}` + "\n"
+	if err := os.WriteFile(filepath.Join(cacheDir, FormatFile), []byte(v1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	written, _, err := SplitWithCache(dbPath, cacheDir)
+	if err != nil {
+		t.Fatalf("SplitWithCache failed: %v", err)
+	}
+	if written != 0 {
+		t.Errorf("SplitWithCache wrote %d files, want 0", written)
+	}
+
+	f, err := ReadFormat(cacheDir)
+	if err != nil {
+		t.Fatalf("ReadFormat failed: %v", err)
+	}
+	if f.Version != FormatVersion || f.Layout != hex {
+		t.Errorf("ReadFormat = %+v, want version %d with layout %v", f, FormatVersion, hex)
+	}
+}
+
+func TestNewerFormatIsRejected(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "world.vcdbs")
+	treeDir := filepath.Join(tmpDir, "tree")
+	testsupport.CreateSave(t, dbPath)
+
+	if err := Split(dbPath, treeDir); err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	marker := `{"version":99,"layout":"geographic"}`
+	if err := os.WriteFile(filepath.Join(treeDir, FormatFile), []byte(marker), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Combine(treeDir, filepath.Join(tmpDir, "out.vcdbs"))
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Combine error = %v, want ErrUnsupportedFormat", err)
+	}
+
+	_, _, err = SplitWithCache(dbPath, treeDir)
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("SplitWithCache error = %v, want ErrUnsupportedFormat", err)
+	}
+}
@@ -0,0 +1,160 @@
+package vcdbtree
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LayoutKind names a strategy for spreading the rows of position-based tables
+// over directories.
+type LayoutKind string
+
+const (
+	// LayoutGeographic shards rows by the z/x coordinates of their cell (see
+	// CellCoords). Nearby chunks share a directory, but a spread-out world
+	// produces a very deep and wide tree.
+	LayoutGeographic LayoutKind = "geographic"
+
+	// LayoutHex shards rows by a hex prefix of a hash of their position, giving
+	// a fixed number of directory levels with Fanout entries each, regardless
+	// of how the world is spread out.
+	LayoutHex LayoutKind = "hex"
+)
+
+// Default hex layout parameters: two levels of 256 directories.
+const (
+	DefaultHexLevels = 2
+	DefaultHexFanout = 256
+)
+
+// Layout selects how the rows of position-based tables are arranged in a tree.
+// The zero value is LayoutGeographic.
+type Layout struct {
+	Kind LayoutKind
+
+	// Levels is the number of directory levels of a LayoutHex tree, 1 to 4.
+	// Zero means DefaultHexLevels.
+	Levels int
+
+	// Fanout is the number of directories per level of a LayoutHex tree:
+	// 16, 256, or 4096. Zero means DefaultHexFanout.
+	Fanout int
+}
+
+// hexFanoutDigits maps the supported fanouts to hex digits per level.
+var hexFanoutDigits = map[int]int{16: 1, 256: 2, 4096: 3}
+
+// ParseLayout parses a layout name: "geographic" (or "geo"), "hex",
+// "hex:<levels>", or "hex:<levels>:<fanout>". An empty string is
+// LayoutGeographic.
+func ParseLayout(s string) (Layout, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), ":")
+
+	switch parts[0] {
+	case "", "geo", string(LayoutGeographic):
+		if len(parts) > 1 {
+			return Layout{}, fmt.Errorf("geographic layout takes no parameters, got %q", s)
+		}
+		return Layout{Kind: LayoutGeographic}, nil
+
+	case string(LayoutHex):
+		if len(parts) > 3 {
+			return Layout{}, fmt.Errorf("invalid hex layout %q: expected hex:<levels>:<fanout>", s)
+		}
+		l := Layout{Kind: LayoutHex}
+		var err error
+		if len(parts) > 1 {
+			if l.Levels, err = strconv.Atoi(parts[1]); err != nil {
+				return Layout{}, fmt.Errorf("invalid hex layout levels %q", parts[1])
+			}
+		}
+		if len(parts) > 2 {
+			if l.Fanout, err = strconv.Atoi(parts[2]); err != nil {
+				return Layout{}, fmt.Errorf("invalid hex layout fanout %q", parts[2])
+			}
+		}
+		if err := l.validate(); err != nil {
+			return Layout{}, err
+		}
+		return l.normalize(), nil
+	}
+
+	return Layout{}, fmt.Errorf("unknown layout %q: must be geographic or hex", s)
+}
+
+// String returns the layout in the form accepted by ParseLayout.
+func (l Layout) String() string {
+	l = l.normalize()
+	if l.Kind == LayoutHex {
+		return fmt.Sprintf("hex:%d:%d", l.Levels, l.Fanout)
+	}
+	return string(LayoutGeographic)
+}
+
+// normalize fills in defaults, so equal layouts compare equal.
+func (l Layout) normalize() Layout {
+	switch l.Kind {
+	case LayoutHex:
+		if l.Levels == 0 {
+			l.Levels = DefaultHexLevels
+		}
+		if l.Fanout == 0 {
+			l.Fanout = DefaultHexFanout
+		}
+		return l
+	default:
+		return Layout{Kind: LayoutGeographic}
+	}
+}
+
+// validate checks that the layout is supported.
+func (l Layout) validate() error {
+	switch l.Kind {
+	case "", LayoutGeographic:
+		return nil
+	case LayoutHex:
+		l = l.normalize()
+		if l.Levels < 1 || l.Levels > 4 {
+			return fmt.Errorf("invalid hex layout levels %d: must be between 1 and 4", l.Levels)
+		}
+		if _, ok := hexFanoutDigits[l.Fanout]; !ok {
+			return fmt.Errorf("invalid hex layout fanout %d: must be 16, 256, or 4096", l.Fanout)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown layout %q", l.Kind)
+}
+
+// path returns the file path of a row of table in the tree at baseDir.
+func (l Layout) path(baseDir, table, subdir string, position, mapSizeX int64) string {
+	if l.Kind != LayoutHex {
+		return shardedPath(baseDir, table, subdir, position, mapSizeX)
+	}
+	l = l.normalize()
+
+	// Positions share their high bits across a world, so a prefix of the
+	// position itself would put almost everything in one directory
+	digest := fmt.Sprintf("%016x", mix64(uint64(position)))
+
+	digits := hexFanoutDigits[l.Fanout]
+	elems := []string{baseDir, subdir}
+	for i := range l.Levels {
+		elems = append(elems, digest[i*digits:(i+1)*digits])
+	}
+	elems = append(elems, fmt.Sprintf("%016x.bin", uint64(position)))
+	return filepath.Join(elems...)
+}
+
+// mix64 is the splitmix64 finalizer. Every input bit affects every output
+// bit, so neighbouring positions get unrelated prefixes. It is part of the
+// on-disk format and must not change.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,196 @@
+package vcdbtree
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestParseLayout(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"", "geographic", false},
+		{"geo", "geographic", false},
+		{"Geographic", "geographic", false},
+		{"hex", "hex:2:256", false},
+		{"hex:3", "hex:3:256", false},
+		{"hex:1:4096", "hex:1:4096", false},
+		{"hex:0", "hex:2:256", false},
+		{"hex:5", "", true},
+		{"hex:2:100", "", true},
+		{"hex:x", "", true},
+		{"hex:2:256:1", "", true},
+		{"geo:2", "", true},
+		{"flat", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLayout(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseLayout(%q) = %v, want error", tt.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseLayout(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseLayout(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLayoutPath_Hex(t *testing.T) {
+	l := Layout{Kind: LayoutHex, Levels: 3, Fanout: 16}
+	path := l.path("/tree", "chunk", "chunks", chunkPos(16000, 15625), 0)
+
+	rel, err := filepath.Rel("/tree/chunks", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	if len(parts) != 4 {
+		t.Fatalf("path %s has %d levels below chunks, want 3 directories and a file", path, len(parts))
+	}
+	for _, dir := range parts[:3] {
+		if len(dir) != 1 {
+			t.Errorf("directory %q in %s should be a single hex digit", dir, path)
+		}
+	}
+	if want := GetShardedPath("/tree", "chunks", chunkPos(16000, 15625)); filepath.Base(path) != filepath.Base(want) {
+		t.Errorf("file name = %s, want %s", filepath.Base(path), filepath.Base(want))
+	}
+
+	// Neighbouring chunks should not all land in the same directory
+	dirs := make(map[string]bool)
+	for x := int64(0); x < 64; x++ {
+		dirs[filepath.Dir(Layout{Kind: LayoutHex}.path("/tree", "chunk", "chunks", chunkPos(x, 0), 0))] = true
+	}
+	if len(dirs) < 32 {
+		t.Errorf("64 neighbouring chunks landed in %d directories, want them spread out", len(dirs))
+	}
+}
+
+func TestSplit_HexLayoutRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	treeDir := filepath.Join(tmpDir, "tree")
+	restoredPath := filepath.Join(tmpDir, "restored.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	opts := &Options{Layout: &Layout{Kind: LayoutHex}}
+	if err := SplitContext(context.Background(), dbPath, treeDir, opts); err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+
+	layout, err := ReadLayout(treeDir)
+	if err != nil {
+		t.Fatalf("ReadLayout failed: %v", err)
+	}
+	if layout.String() != "hex:2:256" {
+		t.Errorf("recorded layout = %s, want hex:2:256", layout)
+	}
+
+	for _, row := range testsupport.SampleChunks {
+		path := layout.path(treeDir, "chunk", "chunks", row.Position, 0)
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("chunk %d not at %s: %v", row.Position, path, err)
+		}
+	}
+
+	if err := Combine(treeDir, restoredPath); err != nil {
+		t.Fatalf("Combine failed: %v", err)
+	}
+	if err := Verify(context.Background(), treeDir, restoredPath); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+}
+
+func TestSplitWithCache_ChangesLayout(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	cacheDir := filepath.Join(tmpDir, "cache")
+	testsupport.CreateSave(t, dbPath)
+
+	if _, _, err := SplitWithCache(dbPath, cacheDir); err != nil {
+		t.Fatalf("SplitWithCache failed: %v", err)
+	}
+
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, row := range testsupport.SampleChunks {
+		if err := os.Chtimes(GetShardedPath(cacheDir, "chunks", row.Position), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hex := Layout{Kind: LayoutHex, Levels: 1, Fanout: 16}
+	written, _, err := SplitWithCacheContext(context.Background(), dbPath, cacheDir, &Options{Layout: &hex})
+	if err != nil {
+		t.Fatalf("SplitWithCache failed: %v", err)
+	}
+	if written != 0 {
+		t.Errorf("SplitWithCache wrote %d files, want 0: moved files are unchanged", written)
+	}
+
+	for _, row := range testsupport.SampleChunks {
+		info, err := os.Stat(hex.path(cacheDir, "chunk", "chunks", row.Position, 0))
+		if err != nil {
+			t.Errorf("chunk %d was not moved: %v", row.Position, err)
+			continue
+		}
+		if !info.ModTime().Equal(old) {
+			t.Errorf("chunk %d mtime = %v, want %v", row.Position, info.ModTime(), old)
+		}
+		if _, err := os.Stat(GetShardedPath(cacheDir, "chunks", row.Position)); !os.IsNotExist(err) {
+			t.Errorf("chunk %d still exists at its geographic path", row.Position)
+		}
+	}
+
+	// Without a Layout, the recorded one is kept
+	if written, _, err = SplitWithCache(dbPath, cacheDir); err != nil || written != 0 {
+		t.Errorf("SplitWithCache = %d written, %v; want 0, nil", written, err)
+	}
+	if layout, err := ReadLayout(cacheDir); err != nil || layout != hex {
+		t.Errorf("ReadLayout = %v, %v; want %v", layout, err, hex)
+	}
+
+	// And switching back moves the files again
+	geo := Layout{Kind: LayoutGeographic}
+	if _, _, err := SplitWithCacheContext(context.Background(), dbPath, cacheDir, &Options{Layout: &geo}); err != nil {
+		t.Fatalf("SplitWithCache failed: %v", err)
+	}
+	if layout, err := ReadLayout(cacheDir); err != nil || layout != geo {
+		t.Errorf("ReadLayout = %v, %v; want %v", layout, err, geo)
+	}
+	for _, row := range testsupport.SampleChunks {
+		if _, err := os.Stat(GetShardedPath(cacheDir, "chunks", row.Position)); err != nil {
+			t.Errorf("chunk %d not moved back: %v", row.Position, err)
+		}
+	}
+}
+
+func TestCombine_RejectsUnknownLayout(t *testing.T) {
+	tmpDir := t.TempDir()
+	treeDir := filepath.Join(tmpDir, "tree")
+	if err := os.MkdirAll(treeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	marker := `{"version":2,"layout":"spiral"}`
+	if err := os.WriteFile(filepath.Join(treeDir, FormatFile), []byte(marker), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Combine(treeDir, filepath.Join(tmpDir, "out.vcdbs")); err == nil {
+		t.Error("Combine should fail for a tree with an unknown layout")
+	}
+}
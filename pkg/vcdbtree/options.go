@@ -0,0 +1,157 @@
+package vcdbtree
+
+import "time"
+
+// Options configures Split, SplitWithCache, and Combine operations.
+// A nil *Options is equivalent to the zero value.
+type Options struct {
+	// OnTableDone, if set, is called after each table has been processed
+	// with the table name and the number of rows handled.
+	OnTableDone func(table string, rows int)
+
+	// Filter, if set, decides which rows of the position-based tables are
+	// written. Rejected rows are skipped, and with SplitWithCache any existing
+	// files for them are removed.
+	Filter RowFilter
+
+	// OnTableFiles, if set, is called by Split and SplitWithCache once each
+	// table's files are in place, with how many were written, already up to
+	// date, and removed because their rows are gone. A tree split from
+	// scratch has every file written.
+	OnTableFiles func(table string, files FileCounts)
+
+	// OnRowWritten, if set, is called for each row of a position-based table
+	// whose file was written, with the size of its data. With SplitWithCache,
+	// rows whose file was already up to date are not reported.
+	OnRowWritten func(table string, position int64, size int)
+
+	// OnProgress, if set, is called every ProgressInterval while Split or
+	// SplitWithCache reads the database, so long splits don't run silently.
+	OnProgress func(Progress)
+
+	// ProgressInterval is how often OnProgress is called. Defaults to
+	// DefaultProgressInterval.
+	ProgressInterval time.Duration
+
+	// Deterministic makes split output reproducible across runs and machines:
+	// rows are processed in key order, and once the split finishes every file
+	// and directory gets a fixed mode (0644 or 0755) and DeterministicModTime.
+	// Identical databases then produce identical trees, including metadata.
+	Deterministic bool
+
+	// MapSizeX is the world width in blocks, needed to decode mapchunk and
+	// mapregion positions (see CellCoords). Defaults to DefaultMapSizeX.
+	MapSizeX int64
+
+	// Layout selects how position-based rows are arranged in the tree and is
+	// recorded in its FormatFile. If nil, Split uses LayoutGeographic and
+	// SplitWithCache keeps the layout the tree already has. When
+	// SplitWithCache changes a tree's layout, existing files are moved rather
+	// than rewritten.
+	Layout *Layout
+
+	// OnRebuild, if set, is called with the reason when SplitWithCache
+	// rebuilds a tree from scratch instead of updating it.
+	OnRebuild func(reason string)
+
+	// Rebuild makes SplitWithCache rebuild an existing tree from scratch
+	// without comparing its rows with the tree first, for callers that
+	// expect most of them to have changed.
+	Rebuild bool
+
+	// Throttle, if set, paces the files written and flushes them to disk in
+	// batches.
+	Throttle *Throttle
+}
+
+// FileCounts counts what a split or sync did with the files of a tree.
+type FileCounts struct {
+	// Written is the number of files written because they were new or
+	// their content changed.
+	Written int
+
+	// Skipped is the number of files that were already up to date.
+	Skipped int
+
+	// Removed is the number of files removed because their source is gone.
+	Removed int
+}
+
+// tableDone invokes the OnTableDone callback if configured.
+func (o *Options) tableDone(table string, rows int) {
+	if o != nil && o.OnTableDone != nil {
+		o.OnTableDone(table, rows)
+	}
+}
+
+// tableFiles invokes the OnTableFiles callback if configured.
+func (o *Options) tableFiles(table string, files FileCounts) {
+	if o != nil && o.OnTableFiles != nil {
+		o.OnTableFiles(table, files)
+	}
+}
+
+// rebuilding invokes the OnRebuild callback if configured.
+func (o *Options) rebuilding(reason string) {
+	if o != nil && o.OnRebuild != nil {
+		o.OnRebuild(reason)
+	}
+}
+
+// rebuild reports whether a Rebuild was requested.
+func (o *Options) rebuild() bool {
+	return o != nil && o.Rebuild
+}
+
+// throttle returns the configured Throttle, or nil.
+func (o *Options) throttle() *Throttle {
+	if o == nil {
+		return nil
+	}
+	return o.Throttle
+}
+
+// keep reports whether a position-based row passes the configured Filter.
+func (o *Options) keep(table string, position int64) bool {
+	return o == nil || o.Filter == nil || o.Filter(table, position)
+}
+
+// rowWritten invokes the OnRowWritten callback if configured.
+func (o *Options) rowWritten(table string, position int64, size int) {
+	if o != nil && o.OnRowWritten != nil {
+		o.OnRowWritten(table, position, size)
+	}
+}
+
+// deterministic reports whether Deterministic output was requested.
+func (o *Options) deterministic() bool {
+	return o != nil && o.Deterministic
+}
+
+// orderBy returns an ORDER BY clause for the given columns in deterministic
+// mode, or an empty string otherwise.
+func (o *Options) orderBy(columns string) string {
+	if !o.deterministic() {
+		return ""
+	}
+	return " ORDER BY " + columns
+}
+
+// mapSizeX returns the configured world width, or DefaultMapSizeX.
+func (o *Options) mapSizeX() int64 {
+	if o == nil || o.MapSizeX <= 0 {
+		return DefaultMapSizeX
+	}
+	return o.MapSizeX
+}
+
+// layout returns the configured Layout, or def if none is set.
+func (o *Options) layout(def Layout) (Layout, error) {
+	if o == nil || o.Layout == nil {
+		return def, nil
+	}
+	if err := o.Layout.validate(); err != nil {
+		return Layout{}, err
+	}
+	return o.Layout.normalize(), nil
+}
@@ -0,0 +1,60 @@
+package vcdbtree
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// CountPlayerRows returns how many rows of the playerdata table of the
+// savegame at dbPath belong to the player with the given UID. The savegame
+// is opened read-only.
+func CountPlayerRows(ctx context.Context, dbPath, playerUID string) (int, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return 0, fmt.Errorf("failed to open database: %w", err)
+	}
+	db, err := sql.Open("sqlite3", dbPath+"?mode=ro")
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM playerdata WHERE playeruid = ?", playerUID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count playerdata rows: %w", err)
+	}
+	return n, nil
+}
+
+// DeletePlayer removes the rows of the playerdata table of the savegame at
+// dbPath that belong to the player with the given UID, and returns how many
+// were removed. The deleted data is overwritten rather than left in free
+// pages, so it can't be recovered from the file. The server must not have
+// the savegame open.
+func DeletePlayer(ctx context.Context, dbPath, playerUID string) (int, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return 0, fmt.Errorf("failed to open database: %w", err)
+	}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	// The pragma applies to the connection, so use just one
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, "PRAGMA secure_delete = ON"); err != nil {
+		return 0, fmt.Errorf("failed to enable secure delete: %w", err)
+	}
+
+	result, err := db.ExecContext(ctx, "DELETE FROM playerdata WHERE playeruid = ?", playerUID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete playerdata rows: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete playerdata rows: %w", err)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,55 @@
+package vcdbtree
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestDeletePlayer(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "world.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+	ctx := context.Background()
+	player := testsupport.SamplePlayers[1]
+
+	n, err := CountPlayerRows(ctx, dbPath, player.UID)
+	if err != nil || n != 1 {
+		t.Fatalf("CountPlayerRows = %d, %v, want 1", n, err)
+	}
+
+	n, err = DeletePlayer(ctx, dbPath, player.UID)
+	if err != nil || n != 1 {
+		t.Fatalf("DeletePlayer = %d, %v, want 1", n, err)
+	}
+	if n, err := CountPlayerRows(ctx, dbPath, player.UID); err != nil || n != 0 {
+		t.Errorf("CountPlayerRows after delete = %d, %v, want 0", n, err)
+	}
+	for _, other := range []testsupport.Player{testsupport.SamplePlayers[0], testsupport.SamplePlayers[2]} {
+		if n, err := CountPlayerRows(ctx, dbPath, other.UID); err != nil || n != 1 {
+			t.Errorf("CountPlayerRows(%s) = %d, %v, want other players kept", other.UID, n, err)
+		}
+	}
+
+	// Secure delete leaves nothing of the row in the file
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, player.Data) {
+		t.Error("deleted player data is still in the savegame file")
+	}
+
+	if n, err := DeletePlayer(ctx, dbPath, "nobody"); err != nil || n != 0 {
+		t.Errorf("DeletePlayer(nobody) = %d, %v, want 0", n, err)
+	}
+}
+
+func TestDeletePlayer_MissingDatabase(t *testing.T) {
+	if _, err := DeletePlayer(context.Background(), filepath.Join(t.TempDir(), "missing.vcdbs"), "x"); err == nil {
+		t.Error("expected an error for a missing savegame")
+	}
+}
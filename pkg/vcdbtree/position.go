@@ -0,0 +1,80 @@
+package vcdbtree
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// DefaultMapSizeX is the width in blocks of a world created with Vintage
+// Story's default world size.
+const DefaultMapSizeX = 1024000
+
+// CellCoords returns the coordinates of the cell a row of a position-based
+// table covers: chunk coordinates for chunk and mapchunk rows, and region
+// coordinates for mapregion rows.
+//
+// The tables pack positions differently. chunk uses the ChunkPos bit fields
+// described in the package documentation. mapchunk and mapregion use a 2D
+// index, z*width + x, where width is the world width in cells, so decoding
+// them needs the world width in blocks; mapSizeX <= 0 means DefaultMapSizeX.
+// Rows of other tables are decoded as ChunkPos.
+func CellCoords(table string, position, mapSizeX int64) (x, z int32) {
+	switch table {
+	case "mapchunk":
+		return index2DCoords(position, mapSizeX, chunkSizeBlocks)
+	case "mapregion":
+		return index2DCoords(position, mapSizeX, mapRegionSizeBlocks)
+	default:
+		return extractChunkX(position), extractChunkZ(position)
+	}
+}
+
+// index2DCoords decodes a z*width + x index for cells of cellSize blocks in a
+// world mapSizeX blocks wide.
+func index2DCoords(position, mapSizeX, cellSize int64) (x, z int32) {
+	if mapSizeX <= 0 {
+		mapSizeX = DefaultMapSizeX
+	}
+	width := max(mapSizeX/cellSize, 1)
+
+	zz := position / width
+	xx := position % width
+	if xx < 0 {
+		xx += width
+		zz--
+	}
+	return int32(xx), int32(zz)
+}
+
+// shardedPath returns the file path of a row of table in the tree at baseDir:
+// <baseDir>/<subdir>/<z>/<x>/<position_hex>.bin, with the cell coordinates
+// decoded as CellCoords does.
+func shardedPath(baseDir, table, subdir string, position, mapSizeX int64) string {
+	x, z := CellCoords(table, position, mapSizeX)
+	return cellPath(baseDir, subdir, x, z, position)
+}
+
+// legacyShardedPath returns where earlier versions put a row: every table was
+// sharded by ChunkPos bit fields, which scatters mapchunk and mapregion rows.
+func legacyShardedPath(baseDir, subdir string, position int64) string {
+	return cellPath(baseDir, subdir, extractChunkX(position), extractChunkZ(position), position)
+}
+
+// cellPath joins the sharded path of a row in cell (x, z).
+func cellPath(baseDir, subdir string, x, z int32, position int64) string {
+	zDir := strconv.FormatInt(int64(z), 10)
+	xDir := strconv.FormatInt(int64(x), 10)
+	filename := fmt.Sprintf("%016x.bin", uint64(position))
+	return filepath.Join(baseDir, subdir, zDir, xDir, filename)
+}
+
+// tableForSubdir returns the table stored in a tree subdirectory.
+func tableForSubdir(subdir string) string {
+	for _, t := range shardedTables {
+		if t.subdir == subdir {
+			return t.table
+		}
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package vcdbtree
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestCellCoords(t *testing.T) {
+	tests := []struct {
+		table    string
+		position int64
+		mapSizeX int64
+		wantX    int32
+		wantZ    int32
+	}{
+		{"chunk", chunkPos(16000, 15625), 0, 16000, 15625},
+		{"chunk", 0x00000012abff341c, 0, -52196, 597},
+		{"mapchunk", 15625*32000 + 16000, 0, 16000, 15625},
+		{"mapchunk", 15625*32000 + 16000, DefaultMapSizeX, 16000, 15625},
+		{"mapregion", 1000*2000 + 999, 0, 999, 1000},
+		// A 256000-block world is 8000 chunks and 500 regions wide
+		{"mapchunk", 3*8000 + 7, 256000, 7, 3},
+		{"mapregion", 250*500 + 249, 256000, 249, 250},
+		{"mapchunk", 0, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		x, z := CellCoords(tt.table, tt.position, tt.mapSizeX)
+		if x != tt.wantX || z != tt.wantZ {
+			t.Errorf("CellCoords(%s, %d, %d) = %d,%d, want %d,%d",
+				tt.table, tt.position, tt.mapSizeX, x, z, tt.wantX, tt.wantZ)
+		}
+	}
+}
+
+func TestSplitWithCache_MigratesLegacyShards(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+	cacheDir := filepath.Join(tmpDir, "cache")
+
+	// Lay out the tree the way earlier versions did, without a format marker
+	if err := SplitContext(context.Background(), dbPath, cacheDir, nil); err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	if err := os.Remove(filepath.Join(cacheDir, FormatFile)); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, row := range testsupport.SampleMapChunks {
+		newPath := GetShardedPath(cacheDir, "mapchunks", row.Position)
+		legacyPath := legacyShardedPath(cacheDir, "mapchunks", row.Position)
+		if newPath == legacyPath {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(legacyPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(newPath, legacyPath); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(legacyPath, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	written, _, err := SplitWithCache(dbPath, cacheDir)
+	if err != nil {
+		t.Fatalf("SplitWithCache failed: %v", err)
+	}
+	if written != 0 {
+		t.Errorf("SplitWithCache wrote %d files, want 0: migrated files are unchanged", written)
+	}
+
+	for _, row := range testsupport.SampleMapChunks {
+		newPath := GetShardedPath(cacheDir, "mapchunks", row.Position)
+		info, err := os.Stat(newPath)
+		if err != nil {
+			t.Errorf("Mapchunk %d not at %s: %v", row.Position, newPath, err)
+			continue
+		}
+		legacyPath := legacyShardedPath(cacheDir, "mapchunks", row.Position)
+		if legacyPath != newPath {
+			if !info.ModTime().Equal(old) {
+				t.Errorf("Migrated mapchunk %d has mtime %v, want it preserved (%v)", row.Position, info.ModTime(), old)
+			}
+			if _, err := os.Stat(legacyPath); !os.IsNotExist(err) {
+				t.Errorf("Legacy file %s still exists, stat err = %v", legacyPath, err)
+			}
+		}
+	}
+
+	// The round trip is unaffected by where files live
+	outPath := filepath.Join(tmpDir, "out.vcdbs")
+	if err := Combine(cacheDir, outPath); err != nil {
+		t.Fatalf("Combine failed: %v", err)
+	}
+	if err := Verify(context.Background(), cacheDir, outPath); err != nil {
+		t.Errorf("Verify failed after migration: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package vcdbtree
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultProgressInterval is how often Options.OnProgress is called when
+// Options.ProgressInterval isn't set.
+const DefaultProgressInterval = 10 * time.Second
+
+// Progress reports how far a split has got.
+type Progress struct {
+	// Table is the table being read.
+	Table string
+
+	// Rows and Bytes are the rows read so far, from every table, and the
+	// size of their data.
+	Rows  int64
+	Bytes int64
+
+	// TotalBytes is the size of the input database. Row data is most of it,
+	// so Bytes approaches TotalBytes as the split nears its end.
+	TotalBytes int64
+
+	// Elapsed is how long the split has been running.
+	Elapsed time.Duration
+}
+
+// RowsPerSecond returns the average rate rows were read at.
+func (p Progress) RowsPerSecond() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Rows) / p.Elapsed.Seconds()
+}
+
+// BytesPerSecond returns the average rate row data was read at.
+func (p Progress) BytesPerSecond() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Bytes) / p.Elapsed.Seconds()
+}
+
+// ETA estimates the time left from the data still to be read at the average
+// rate so far. The bool is false if there is nothing to go on yet. As the
+// database also holds indexes and free pages, the estimate errs long.
+func (p Progress) ETA() (time.Duration, bool) {
+	rate := p.BytesPerSecond()
+	if rate <= 0 || p.TotalBytes <= 0 {
+		return 0, false
+	}
+	left := p.TotalBytes - p.Bytes
+	if left < 0 {
+		left = 0
+	}
+	return time.Duration(float64(left) / rate * float64(time.Second)), true
+}
+
+// String formats the progress for a log line, e.g. "chunk: 120000 rows,
+// 812.4 MiB of 2.1 GiB (4000 rows/s, 27.1 MiB/s, ETA 48s)".
+func (p Progress) String() string {
+	s := fmt.Sprintf("%s: %d rows, %s", p.Table, p.Rows, formatProgressBytes(float64(p.Bytes)))
+	if p.TotalBytes > 0 {
+		s += " of " + formatProgressBytes(float64(p.TotalBytes))
+	}
+	s += fmt.Sprintf(" (%.0f rows/s, %s/s", p.RowsPerSecond(), formatProgressBytes(p.BytesPerSecond()))
+	if eta, ok := p.ETA(); ok {
+		s += fmt.Sprintf(", ETA %v", eta.Round(time.Second))
+	}
+	return s + ")"
+}
+
+// formatProgressBytes formats a byte count using binary units.
+func formatProgressBytes(n float64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", n/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", n/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", n/(1<<10))
+	default:
+		return fmt.Sprintf("%.0f B", n)
+	}
+}
+
+// progressTracker counts the rows a split reads and calls OnProgress every
+// ProgressInterval. A nil *progressTracker ignores all rows.
+type progressTracker struct {
+	onProgress func(Progress)
+	interval   time.Duration
+	start      time.Time
+	next       time.Time
+	progress   Progress
+}
+
+// newProgressTracker returns a tracker for a split of inputDBPath, or nil if
+// opts has no OnProgress.
+func (o *Options) newProgressTracker(inputDBPath string) *progressTracker {
+	if o == nil || o.OnProgress == nil {
+		return nil
+	}
+	interval := o.ProgressInterval
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	start := time.Now()
+	t := &progressTracker{onProgress: o.OnProgress, interval: interval, start: start, next: start.Add(interval)}
+	if info, err := os.Stat(inputDBPath); err == nil {
+		t.progress.TotalBytes = info.Size()
+	}
+	return t
+}
+
+// row counts a row read from table, reporting progress if it is due.
+func (t *progressTracker) row(table string, size int) {
+	if t == nil {
+		return
+	}
+	t.progress.Table = table
+	t.progress.Rows++
+	t.progress.Bytes += int64(size)
+
+	// Checking the time is cheap next to writing the row's file
+	if now := time.Now(); !now.Before(t.next) {
+		t.progress.Elapsed = now.Sub(t.start)
+		t.onProgress(t.progress)
+		t.next = now.Add(t.interval)
+	}
+}
@@ -0,0 +1,81 @@
+package vcdbtree
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestProgress_String(t *testing.T) {
+	p := Progress{Table: "chunk", Rows: 4000, Bytes: 100 << 20, TotalBytes: 300 << 20, Elapsed: 10 * time.Second}
+
+	if got := p.RowsPerSecond(); got != 400 {
+		t.Errorf("RowsPerSecond = %v, want 400", got)
+	}
+	if got := p.BytesPerSecond(); got != 10<<20 {
+		t.Errorf("BytesPerSecond = %v, want 10 MiB", got)
+	}
+	if eta, ok := p.ETA(); !ok || eta != 20*time.Second {
+		t.Errorf("ETA = %v, %v, want 20s", eta, ok)
+	}
+	want := "chunk: 4000 rows, 100.0 MiB of 300.0 MiB (400 rows/s, 10.0 MiB/s, ETA 20s)"
+	if got := p.String(); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+
+	// Nothing to estimate from before any time has passed
+	if _, ok := (Progress{TotalBytes: 1 << 20}).ETA(); ok {
+		t.Error("expected no ETA without elapsed time")
+	}
+}
+
+func TestSplit_ReportsProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "world.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	for _, tt := range []struct {
+		name  string
+		split func(opts *Options) error
+	}{
+		{"Split", func(opts *Options) error {
+			return SplitContext(context.Background(), dbPath, filepath.Join(tmpDir, "split"), opts)
+		}},
+		{"SplitWithCache", func(opts *Options) error {
+			_, _, err := SplitWithCacheContext(context.Background(), dbPath, filepath.Join(tmpDir, "cache"), opts)
+			return err
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var reports []Progress
+			tableRows := 0
+			opts := &Options{
+				ProgressInterval: time.Nanosecond, // Report every row
+				OnProgress:       func(p Progress) { reports = append(reports, p) },
+				OnTableDone:      func(table string, rows int) { tableRows += rows },
+			}
+			if err := tt.split(opts); err != nil {
+				t.Fatalf("split failed: %v", err)
+			}
+
+			if len(reports) == 0 {
+				t.Fatal("expected progress to be reported")
+			}
+			for i := 1; i < len(reports); i++ {
+				if reports[i].Rows <= reports[i-1].Rows || reports[i].Bytes < reports[i-1].Bytes {
+					t.Fatalf("progress went backwards: %+v after %+v", reports[i], reports[i-1])
+				}
+			}
+			last := reports[len(reports)-1]
+			if last.Rows != int64(tableRows) {
+				t.Errorf("last report has %d rows, want %d", last.Rows, tableRows)
+			}
+			if last.TotalBytes <= 0 || last.Table != "playerdata" {
+				t.Errorf("unexpected last report: %+v", last)
+			}
+		})
+	}
+}
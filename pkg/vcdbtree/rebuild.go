@@ -0,0 +1,207 @@
+package vcdbtree
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Suffixes of the directories next to a tree that SplitWithCache uses while
+// it rebuilds the tree. Left over from an interrupted rebuild, they are
+// cleaned up by the next SplitWithCache of the tree.
+const (
+	// RebuildSuffix names the directory the tree is rebuilt in.
+	RebuildSuffix = ".rebuild"
+
+	// ReplacedSuffix names the directory the old tree is moved to while the
+	// rebuilt one takes its place.
+	ReplacedSuffix = ".replaced"
+)
+
+// minMigratedVersion is the oldest FormatVersion SplitWithCache migrates in
+// place. Older trees are rebuilt. Raise it when a format change can't be
+// migrated by moving files.
+var minMigratedVersion = 0
+
+// Rebuilding a tree whose rows mostly differ from the database costs about
+// the same as updating it file by file, without visiting every stale file.
+// Before updating a tree, SplitWithCache compares up to rebuildSampleRows
+// rows with it, and rebuilds it if at least rebuildMismatchRatio of them
+// differ, given at least rebuildMinSample rows to judge by.
+const (
+	rebuildSampleRows    = 1000
+	rebuildMinSample     = 100
+	rebuildMismatchRatio = 0.9
+)
+
+// rebuildReason returns why the tree at cacheDir, in format previous, should
+// be rebuilt from db rather than updated to layout, or "" if it shouldn't.
+func rebuildReason(ctx context.Context, db *sql.DB, cacheDir string, previous Format, layout Layout, worldID string, opts *Options) (string, error) {
+	if entries, err := os.ReadDir(cacheDir); err != nil || len(entries) == 0 {
+		// Nothing to rebuild
+		return "", nil
+	}
+	if previous.Version < minMigratedVersion {
+		return fmt.Sprintf("tree is format version %d, which can't be migrated to version %d", previous.Version, FormatVersion), nil
+	}
+	if previous.WorldID != "" && worldID != "" && previous.WorldID != worldID {
+		return fmt.Sprintf("tree was split from world %s, not %s", previous.WorldID, worldID), nil
+	}
+	if opts.rebuild() {
+		return "rebuild requested", nil
+	}
+
+	// Rows of a tree being migrated are moved into place, which is cheaper
+	// than a rebuild
+	if previous.Layout != layout || previous.Version == 0 {
+		return "", nil
+	}
+
+	sampled, mismatched := 0, 0
+	for _, t := range shardedTables {
+		if sampled >= rebuildSampleRows {
+			break
+		}
+		rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT position, data FROM %s LIMIT %d", t.table, rebuildSampleRows-sampled))
+		if err != nil {
+			return "", fmt.Errorf("failed to sample %s: %w", t.table, err)
+		}
+		for rows.Next() {
+			var position int64
+			var data []byte
+			if err := rows.Scan(&position, &data); err != nil {
+				rows.Close()
+				return "", fmt.Errorf("failed to sample %s: %w", t.table, err)
+			}
+			if data == nil || !opts.keep(t.table, position) {
+				continue
+			}
+			sampled++
+			if !fileMatchesContent(layout.path(cacheDir, t.table, t.subdir, position, opts.mapSizeX()), data) {
+				mismatched++
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to sample %s: %w", t.table, err)
+		}
+	}
+	if sampled >= rebuildMinSample && float64(mismatched) >= rebuildMismatchRatio*float64(sampled) {
+		return fmt.Sprintf("%d of %d sampled rows differ from the tree", mismatched, sampled), nil
+	}
+	return "", nil
+}
+
+// rebuildTree splits inputDBPath into a fresh tree with layout next to
+// cacheDir and swaps it in, returning the number of files written.
+func rebuildTree(ctx context.Context, inputDBPath, cacheDir string, opts *Options, layout Layout) (int, error) {
+	fresh := cacheDir + RebuildSuffix
+	replaced := cacheDir + ReplacedSuffix
+	if err := os.RemoveAll(fresh); err != nil {
+		return 0, fmt.Errorf("failed to clear %s: %w", fresh, err)
+	}
+
+	rebuildOpts := Options{}
+	if opts != nil {
+		rebuildOpts = *opts
+	}
+	rebuildOpts.Layout = &layout
+	written, err := split(ctx, inputDBPath, fresh, &rebuildOpts)
+	if err != nil {
+		os.RemoveAll(fresh)
+		return 0, err
+	}
+
+	if err := os.RemoveAll(replaced); err != nil {
+		return 0, fmt.Errorf("failed to clear %s: %w", replaced, err)
+	}
+	if err := os.Rename(cacheDir, replaced); err != nil {
+		return 0, fmt.Errorf("failed to move old tree aside: %w", err)
+	}
+	if err := os.Rename(fresh, cacheDir); err != nil {
+		os.Rename(replaced, cacheDir)
+		return 0, fmt.Errorf("failed to move rebuilt tree into place: %w", err)
+	}
+	if err := os.RemoveAll(replaced); err != nil {
+		return written, fmt.Errorf("failed to remove old tree: %w", err)
+	}
+	return written, nil
+}
+
+// recoverRebuild cleans up after a rebuild of the tree at cacheDir that was
+// interrupted. If it was interrupted while the trees were being swapped,
+// the old tree is put back, to be updated or rebuilt again.
+func recoverRebuild(cacheDir string) error {
+	replaced := cacheDir + ReplacedSuffix
+	if _, err := os.Stat(replaced); err == nil {
+		if _, err := os.Stat(cacheDir); os.IsNotExist(err) {
+			if err := os.Rename(replaced, cacheDir); err != nil {
+				return fmt.Errorf("failed to restore tree from interrupted rebuild: %w", err)
+			}
+		}
+	}
+	for _, dir := range []string{replaced, cacheDir + RebuildSuffix} {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to clean up interrupted rebuild: %w", err)
+		}
+	}
+	return nil
+}
+
+// uuidRegexp matches a GUID in its usual text form.
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// readWorldID returns the savegame identifier of the world in db, or "" if
+// it can't be found. Vintage Story generates a GUID for each world and
+// keeps it in the gamedata row, a serialized protobuf message; the first
+// top-level string field holding a GUID is taken, without decoding the
+// rest of the message.
+func readWorldID(ctx context.Context, db *sql.DB) (string, error) {
+	var data []byte
+	err := db.QueryRowContext(ctx, "SELECT data FROM gamedata ORDER BY savegameid LIMIT 1").Scan(&data)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read gamedata: %w", err)
+	}
+
+	for offset := 0; offset < len(data); {
+		key, n := binary.Uvarint(data[offset:])
+		if n <= 0 {
+			return "", nil
+		}
+		offset += n
+
+		switch key & 7 {
+		case 0: // varint
+			_, n := binary.Uvarint(data[offset:])
+			if n <= 0 {
+				return "", nil
+			}
+			offset += n
+		case 1: // 64-bit
+			offset += 8
+		case 2: // length-delimited
+			length, n := binary.Uvarint(data[offset:])
+			if n <= 0 || length > uint64(len(data)-offset-n) {
+				return "", nil
+			}
+			offset += n
+			if value := string(data[offset : offset+int(length)]); uuidRegexp.MatchString(value) {
+				return strings.ToLower(value), nil
+			}
+			offset += int(length)
+		case 5: // 32-bit
+			offset += 4
+		default:
+			return "", nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,218 @@
+package vcdbtree
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+const (
+	testWorldID      = "0c6f1a2e-3b4d-4e5f-8a9b-0c1d2e3f4a5b"
+	otherTestWorldID = "9f8e7d6c-5b4a-4321-8fed-cba987654321"
+)
+
+// gamedataWithWorldID returns a protobuf message like Vintage Story's
+// savegame, with a few fields around the world's identifier.
+func gamedataWithWorldID(id string) []byte {
+	data := []byte{1 << 3, 0x80, 0x40} // field 1, varint 8192
+	data = append(data, 2<<3|2, 3)     // field 2, a short string
+	data = append(data, "abc"...)
+	data = append(data, 7<<3|2, byte(len(id)))
+	return append(data, id...)
+}
+
+// execSave runs statements on the save at path.
+func execSave(t *testing.T, path string, statements ...string) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+}
+
+// setWorldID replaces the gamedata of the save at path with one naming id.
+func setWorldID(t *testing.T, path, id string) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("INSERT OR REPLACE INTO gamedata (savegameid, data) VALUES (1, ?)", gamedataWithWorldID(id)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// verifyTree checks that the tree at treeDir holds what the save at dbPath
+// does.
+func verifyTree(t *testing.T, dbPath, treeDir string) {
+	t.Helper()
+	drift, err := Compare(context.Background(), dbPath, treeDir, nil)
+	if err != nil {
+		t.Fatalf("Compare() failed: %v", err)
+	}
+	if drift.Total().Rows() != 0 {
+		t.Errorf("tree differs from the save: %v", drift)
+	}
+}
+
+// splitRecordingRebuilds runs SplitWithCacheContext, returning why the tree
+// was rebuilt, if it was.
+func splitRecordingRebuilds(t *testing.T, dbPath, treeDir string) (written, skipped int, reason string) {
+	t.Helper()
+	opts := &Options{OnRebuild: func(r string) { reason = r }}
+	written, skipped, err := SplitWithCacheContext(context.Background(), dbPath, treeDir, opts)
+	if err != nil {
+		t.Fatalf("SplitWithCacheContext() failed: %v", err)
+	}
+	for _, suffix := range []string{RebuildSuffix, ReplacedSuffix} {
+		if _, err := os.Stat(treeDir + suffix); !os.IsNotExist(err) {
+			t.Errorf("%s left behind", treeDir+suffix)
+		}
+	}
+	return written, skipped, reason
+}
+
+func TestReadWorldID(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// The sample gamedata isn't a savegame message
+	if id, err := readWorldID(context.Background(), db); err != nil || id != "" {
+		t.Errorf("readWorldID() of sample gamedata = %q, %v, want none", id, err)
+	}
+
+	if _, err := db.Exec("UPDATE gamedata SET data = ?", gamedataWithWorldID("0C6F1A2E-3B4D-4E5F-8A9B-0C1D2E3F4A5B")); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := readWorldID(context.Background(), db); err != nil || id != testWorldID {
+		t.Errorf("readWorldID() = %q, %v, want %q", id, err, testWorldID)
+	}
+}
+
+func TestSplitWithCache_RebuildsOtherWorld(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+	setWorldID(t, dbPath, testWorldID)
+	treeDir := filepath.Join(tmpDir, "tree")
+
+	if _, _, reason := splitRecordingRebuilds(t, dbPath, treeDir); reason != "" {
+		t.Errorf("first split rebuilt the tree: %s", reason)
+	}
+	if format, err := ReadFormat(treeDir); err != nil || format.WorldID != testWorldID {
+		t.Fatalf("ReadFormat() = %+v, %v, want world %s", format, err, testWorldID)
+	}
+	if _, skipped, reason := splitRecordingRebuilds(t, dbPath, treeDir); reason != "" || skipped == 0 {
+		t.Errorf("split of the same world = %d skipped, rebuilt: %q, want it updated", skipped, reason)
+	}
+
+	// Another world in the same place
+	setWorldID(t, dbPath, otherTestWorldID)
+	written, skipped, reason := splitRecordingRebuilds(t, dbPath, treeDir)
+	if reason == "" || skipped != 0 || written == 0 {
+		t.Errorf("split of another world = %d written, %d skipped, rebuilt: %q, want it rebuilt", written, skipped, reason)
+	}
+	if format, err := ReadFormat(treeDir); err != nil || format.WorldID != otherTestWorldID {
+		t.Errorf("ReadFormat() = %+v, %v, want world %s", format, err, otherTestWorldID)
+	}
+	verifyTree(t, dbPath, treeDir)
+}
+
+func TestSplitWithCache_RebuildsMismatchedTree(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateBloatedSave(t, dbPath, 200)
+	treeDir := filepath.Join(tmpDir, "tree")
+	splitRecordingRebuilds(t, dbPath, treeDir)
+
+	// A few changed rows are updated in place
+	execSave(t, dbPath, "UPDATE chunk SET data = 'changed' WHERE position < 10")
+	if written, _, reason := splitRecordingRebuilds(t, dbPath, treeDir); reason != "" || written != 10 {
+		t.Errorf("split with 10 changed rows = %d written, rebuilt: %q, want 10 written in place", written, reason)
+	}
+
+	// Nearly all of them are rebuilt
+	execSave(t, dbPath, "UPDATE chunk SET data = 'rewritten' || position WHERE position >= 10")
+	if written, _, reason := splitRecordingRebuilds(t, dbPath, treeDir); reason == "" || written != 200 {
+		t.Errorf("split with 190 changed rows = %d written, rebuilt: %q, want a rebuild", written, reason)
+	}
+	verifyTree(t, dbPath, treeDir)
+}
+
+func TestSplitWithCache_RebuildsUnmigratableFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+	treeDir := filepath.Join(tmpDir, "tree")
+	splitRecordingRebuilds(t, dbPath, treeDir)
+
+	defer func(v int) { minMigratedVersion = v }(minMigratedVersion)
+	minMigratedVersion = FormatVersion + 1
+	if _, _, reason := splitRecordingRebuilds(t, dbPath, treeDir); reason == "" {
+		t.Error("tree in a format that can't be migrated wasn't rebuilt")
+	}
+}
+
+func TestSplitWithCache_RebuildRequested(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+	treeDir := filepath.Join(tmpDir, "tree")
+
+	// A new tree is split as usual
+	var reason string
+	opts := &Options{Rebuild: true, OnRebuild: func(r string) { reason = r }}
+	if _, _, err := SplitWithCacheContext(context.Background(), dbPath, treeDir, opts); err != nil {
+		t.Fatalf("SplitWithCacheContext() failed: %v", err)
+	}
+	if reason != "" {
+		t.Errorf("new tree was rebuilt: %s", reason)
+	}
+
+	written, skipped, err := SplitWithCacheContext(context.Background(), dbPath, treeDir, opts)
+	if err != nil {
+		t.Fatalf("SplitWithCacheContext() failed: %v", err)
+	}
+	if reason == "" || skipped != 0 || written == 0 {
+		t.Errorf("split with Rebuild = %d written, %d skipped, rebuilt: %q, want it rebuilt", written, skipped, reason)
+	}
+	verifyTree(t, dbPath, treeDir)
+}
+
+func TestSplitWithCache_RecoversInterruptedRebuild(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+	treeDir := filepath.Join(tmpDir, "tree")
+	splitRecordingRebuilds(t, dbPath, treeDir)
+
+	// Interrupted between moving the old tree aside and the new one in
+	if err := os.Rename(treeDir, treeDir+ReplacedSuffix); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(treeDir+RebuildSuffix, "chunks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The old tree is put back and updated
+	if written, _, reason := splitRecordingRebuilds(t, dbPath, treeDir); written != 0 || reason != "" {
+		t.Errorf("split after an interrupted rebuild = %d written, rebuilt: %q, want the old tree reused", written, reason)
+	}
+	verifyTree(t, dbPath, treeDir)
+}
@@ -0,0 +1,192 @@
+package vcdbtree
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Chunk Y in a ChunkPos position; see the package documentation.
+const (
+	chunkYShift = 54
+	chunkYMask  = 0x1FF
+)
+
+// Problem describes a row of a position-based table whose data looks corrupt.
+type Problem struct {
+	// Table is the table the row is in: "chunk", "mapchunk", or "mapregion".
+	Table string
+
+	// Position is the row's position.
+	Position int64
+
+	// X and Z are the cell coordinates, as returned by CellCoords. Y is the
+	// chunk's height index, for chunk rows only.
+	X, Y, Z int32
+
+	// Reason says what is wrong with the data.
+	Reason string
+}
+
+// BlockCoords returns the block coordinates of the cell's corner.
+func (p Problem) BlockCoords() (x, y, z int64) {
+	size := int64(chunkSizeBlocks)
+	if p.Table == "mapregion" {
+		size = mapRegionSizeBlocks
+	}
+	return int64(p.X) * size, int64(p.Y) * chunkSizeBlocks, int64(p.Z) * size
+}
+
+func (p Problem) String() string {
+	x, y, z := p.BlockCoords()
+	if p.Table == "chunk" {
+		return fmt.Sprintf("chunk %d,%d,%d (blocks %d,%d,%d, position %016x): %s", p.X, p.Y, p.Z, x, y, z, uint64(p.Position), p.Reason)
+	}
+	return fmt.Sprintf("%s %d,%d (blocks %d,%d, position %016x): %s", p.Table, p.X, p.Z, x, z, uint64(p.Position), p.Reason)
+}
+
+// ScanResult is the outcome of Scan.
+type ScanResult struct {
+	// Rows is how many rows of each position-based table were checked.
+	Rows map[string]int
+
+	// Problems lists the rows that look corrupt.
+	Problems []Problem
+}
+
+// Scan checks every row of the chunk, mapchunk, and mapregion tables of the
+// database at dbPath without modifying it. Vintage Story stores each of them
+// as a serialized protobuf message, so a row is reported if it has no data
+// or its data isn't a well-formed message: a field with an invalid tag or a
+// length running past the end of the data. This doesn't decode the game's
+// data, so it finds truncated and overwritten rows, not every kind of damage.
+// Only MapSizeX is used from opts, to locate mapchunk and mapregion rows.
+func Scan(ctx context.Context, dbPath string, opts *Options) (*ScanResult, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", dbPath+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	result := &ScanResult{Rows: make(map[string]int)}
+	for _, t := range shardedTables {
+		n, err := scanTable(ctx, db, t.table, opts.mapSizeX(), result)
+		if err != nil {
+			return nil, &TableError{Op: "scan", Table: t.table, Err: err}
+		}
+		result.Rows[t.table] = n
+		opts.tableDone(t.table, n)
+	}
+	return result, nil
+}
+
+// scanTable checks each row of a position-based table, adding problems to
+// result, and returns the number of rows checked.
+func scanTable(ctx context.Context, db *sql.DB, table string, mapSizeX int64, result *ScanResult) (int, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT position, data FROM %s ORDER BY position", table))
+	if err != nil {
+		return 0, fmt.Errorf("failed to query %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		var position int64
+		var data []byte
+		if err := rows.Scan(&position, &data); err != nil {
+			return count, fmt.Errorf("failed to scan row: %w", err)
+		}
+		count++
+
+		reason := ""
+		if len(data) == 0 {
+			reason = "no data"
+		} else if err := checkProtobuf(data); err != nil {
+			reason = err.Error()
+		}
+		if reason == "" {
+			continue
+		}
+
+		p := Problem{Table: table, Position: position, Reason: reason}
+		p.X, p.Z = CellCoords(table, position, mapSizeX)
+		if table == "chunk" {
+			p.Y = int32((position >> chunkYShift) & chunkYMask)
+		}
+		result.Problems = append(result.Problems, p)
+	}
+	return count, rows.Err()
+}
+
+// errTruncated means a field runs past the end of the data.
+var errTruncated = errors.New("truncated")
+
+// checkProtobuf checks that data is a sequence of well-formed protobuf
+// fields, with groups balanced. Nested messages are not inspected.
+func checkProtobuf(data []byte) error {
+	var groups []uint64
+	for offset := 0; offset < len(data); {
+		key, n := binary.Uvarint(data[offset:])
+		if n <= 0 {
+			return fmt.Errorf("invalid field tag at byte %d", offset)
+		}
+		field, wireType := key>>3, key&7
+		if field == 0 {
+			return fmt.Errorf("invalid field number 0 at byte %d", offset)
+		}
+		start := offset
+		offset += n
+
+		switch wireType {
+		case 0: // varint
+			_, n := binary.Uvarint(data[offset:])
+			if n <= 0 {
+				return fmt.Errorf("field %d at byte %d: %w varint", field, start, errTruncated)
+			}
+			offset += n
+		case 1: // 64-bit
+			offset += 8
+		case 2: // length-delimited
+			length, n := binary.Uvarint(data[offset:])
+			if n <= 0 {
+				return fmt.Errorf("field %d at byte %d: %w length", field, start, errTruncated)
+			}
+			offset += n
+			if length > uint64(len(data)-offset) {
+				return fmt.Errorf("field %d at byte %d: length %d runs past the end of the data (%d bytes)", field, start, length, len(data))
+			}
+			offset += int(length)
+		case 3: // start group
+			groups = append(groups, field)
+		case 4: // end group
+			if len(groups) == 0 || groups[len(groups)-1] != field {
+				return fmt.Errorf("unexpected end of group %d at byte %d", field, start)
+			}
+			groups = groups[:len(groups)-1]
+		case 5: // 32-bit
+			offset += 4
+		default:
+			return fmt.Errorf("invalid wire type %d at byte %d", wireType, start)
+		}
+
+		if offset > len(data) {
+			return fmt.Errorf("field %d at byte %d: %w", field, start, errTruncated)
+		}
+	}
+
+	if len(groups) > 0 {
+		return fmt.Errorf("group %d is never closed", groups[len(groups)-1])
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package vcdbtree
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+// protobufMessage is a well-formed message with a varint, a 32-bit, a
+// 64-bit, a length-delimited, and a group field.
+var protobufMessage = []byte{
+	0x08, 0x96, 0x01, // field 1, varint 150
+	0x15, 1, 2, 3, 4, // field 2, 32-bit
+	0x19, 1, 2, 3, 4, 5, 6, 7, 8, // field 3, 64-bit
+	0x22, 0x03, 'a', 'b', 'c', // field 4, 3 bytes
+	0x2b, 0x08, 0x01, 0x2c, // field 5, group holding field 1 = 1
+}
+
+func TestCheckProtobuf(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"valid", protobufMessage, ""},
+		{"truncated length-delimited", []byte{0x22, 0x05, 'a', 'b'}, "runs past the end"},
+		{"truncated fixed", []byte{0x19, 1, 2, 3}, "truncated"},
+		{"truncated varint", []byte{0x08, 0x96}, "truncated varint"},
+		{"field zero", []byte{0x00, 0x01}, "field number 0"},
+		{"invalid wire type", []byte{0x0e}, "invalid wire type 6"},
+		{"unclosed group", []byte{0x2b, 0x08, 0x01}, "never closed"},
+		{"mismatched group", []byte{0x2b, 0x34}, "unexpected end of group 6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkProtobuf(tt.data)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkProtobuf() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkProtobuf() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	// Give every row well-formed data, then damage a few
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"chunk", "mapchunk", "mapregion"} {
+		if _, err := db.Exec("UPDATE "+table+" SET data = ?", protobufMessage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var chunkPos, regionPos int64
+	if err := db.QueryRow("SELECT MAX(position) FROM chunk").Scan(&chunkPos); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("SELECT MIN(position) FROM mapregion").Scan(&regionPos); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE chunk SET data = ? WHERE position = ?", protobufMessage[:len(protobufMessage)-3], chunkPos); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE mapregion SET data = NULL WHERE position = ?", regionPos); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	result, err := Scan(context.Background(), dbPath, nil)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	if result.Rows["chunk"] != len(testsupport.SampleChunks) {
+		t.Errorf("Rows[chunk] = %d, want %d", result.Rows["chunk"], len(testsupport.SampleChunks))
+	}
+	if len(result.Problems) != 2 {
+		t.Fatalf("Problems = %v, want 2", result.Problems)
+	}
+
+	chunk := result.Problems[0]
+	x, z := ChunkCoords(chunkPos)
+	if chunk.Table != "chunk" || chunk.Position != chunkPos || chunk.X != x || chunk.Z != z {
+		t.Errorf("chunk problem = %+v, want position %x at %d,%d", chunk, chunkPos, x, z)
+	}
+	if !strings.Contains(chunk.String(), "chunk ") || !strings.Contains(chunk.Reason, "group") {
+		t.Errorf("chunk problem = %q", chunk.String())
+	}
+
+	region := result.Problems[1]
+	if region.Table != "mapregion" || region.Position != regionPos || region.Reason != "no data" {
+		t.Errorf("mapregion problem = %+v", region)
+	}
+}
+
+func TestProblem_BlockCoords(t *testing.T) {
+	p := Problem{Table: "chunk", X: 2, Y: 3, Z: -1}
+	if x, y, z := p.BlockCoords(); x != 64 || y != 96 || z != -32 {
+		t.Errorf("chunk BlockCoords() = %d,%d,%d", x, y, z)
+	}
+	p = Problem{Table: "mapregion", X: 2, Z: 1}
+	if x, _, z := p.BlockCoords(); x != 1024 || z != 512 {
+		t.Errorf("mapregion BlockCoords() = %d,%d", x, z)
+	}
+}
@@ -0,0 +1,267 @@
+package vcdbtree
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Record is one row of a savegame table, as stored in a tree.
+type Record struct {
+	// Table is the table the row belongs to: "chunk", "mapchunk",
+	// "mapregion", "gamedata", or "playerdata".
+	Table string
+
+	// Position is the row's position in a position-based table, or its
+	// savegameid in gamedata. Unused for playerdata.
+	Position int64
+
+	// PlayerUID is the player's UID in playerdata, as the game stores it
+	// (standard base64). Unused for other tables.
+	PlayerUID string
+
+	// Data is the row's blob.
+	Data []byte
+}
+
+// treeTables lists every table of a tree with its subdirectory, in the order
+// TreeReader returns them.
+var treeTables = []struct {
+	table  string
+	subdir string
+}{
+	{"chunk", "chunks"},
+	{"mapchunk", "mapchunks"},
+	{"mapregion", "mapregions"},
+	{"gamedata", "gamedata"},
+	{"playerdata", "playerdata"},
+}
+
+// TreeWriter writes records to a new tree, without going through a SQLite
+// database, so other programs can produce trees that Combine and the backup
+// manager understand. Records may be written in any order; a record for a row
+// that was already written replaces it.
+type TreeWriter struct {
+	// Source is recorded in the tree's FormatFile as the name of the
+	// database the tree was made from. Optional.
+	Source string
+
+	// WorldID is recorded in the tree's FormatFile as the savegame
+	// identifier of the world the tree was made from. Optional.
+	WorldID string
+
+	dir    string
+	layout Layout
+	opts   *Options
+}
+
+// NewTreeWriter starts a tree at dir, creating it. Of opts, Layout,
+// MapSizeX, OnRowWritten, Deterministic, and Throttle apply; Filter is left to the
+// caller, who decides what to write.
+func NewTreeWriter(dir string, opts *Options) (*TreeWriter, error) {
+	layout, err := opts.layout(Layout{Kind: LayoutGeographic})
+	if err != nil {
+		return nil, err
+	}
+	for _, subdir := range []string{"gamedata", "playerdata"} {
+		if err := os.MkdirAll(filepath.Join(dir, subdir), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create %s directory: %w", subdir, err)
+		}
+	}
+	return &TreeWriter{dir: dir, layout: layout, opts: opts}, nil
+}
+
+// Write writes a record to the tree.
+func (w *TreeWriter) Write(rec Record) error {
+	var path string
+	switch rec.Table {
+	case "chunk", "mapchunk", "mapregion":
+		path = w.layout.path(w.dir, rec.Table, subdirForTable(rec.Table), rec.Position, w.opts.mapSizeX())
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(path), err)
+		}
+	case "gamedata":
+		path = filepath.Join(w.dir, "gamedata", fmt.Sprintf("%d.bin", rec.Position))
+	case "playerdata":
+		if rec.PlayerUID == "" {
+			return fmt.Errorf("playerdata record has no player UID")
+		}
+		// Sanitize playeruid for filesystem (base64 to base64url)
+		path = filepath.Join(w.dir, "playerdata", sanitizePlayerUID(rec.PlayerUID)+".bin")
+	default:
+		return fmt.Errorf("unknown table %q", rec.Table)
+	}
+
+	if err := w.opts.throttle().writeFile(path, rec.Data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if subdirForTable(rec.Table) != "" {
+		w.opts.rowWritten(rec.Table, rec.Position, len(rec.Data))
+	}
+	return nil
+}
+
+// Close finishes the tree by writing its FormatFile and, with
+// Options.Deterministic, normalizing its metadata.
+func (w *TreeWriter) Close() error {
+	return w.CloseContext(context.Background())
+}
+
+// CloseContext is like Close but honors context cancellation.
+func (w *TreeWriter) CloseContext(ctx context.Context) error {
+	if err := w.opts.throttle().Flush(); err != nil {
+		return err
+	}
+	format := Format{Layout: w.layout, Source: w.Source, CreatedAt: w.opts.createdAt(), WorldID: w.WorldID}
+	if err := writeFormat(w.dir, format); err != nil {
+		return err
+	}
+
+	if w.opts.deterministic() {
+		if err := normalizeTree(ctx, w.dir); err != nil {
+			return fmt.Errorf("failed to normalize output: %w", err)
+		}
+	}
+	return nil
+}
+
+// TreeReader returns the records of a tree one at a time, table by table in
+// the order chunk, mapchunk, mapregion, gamedata, playerdata, and within a
+// table in path order. Only the file names of the current table are held in
+// memory.
+type TreeReader struct {
+	dir    string
+	format Format
+
+	// next is the index in treeTables of the table to list next; paths
+	// are the files of the current table still to be read.
+	next  int
+	table string
+	paths []string
+}
+
+// OpenTree opens the tree at dir for reading. Trees written by a newer
+// version return an error wrapping ErrUnsupportedFormat.
+func OpenTree(dir string) (*TreeReader, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to open tree: %w", err)
+	}
+	// Files are found by walking the tree, so any known layout can be read
+	format, err := ReadFormat(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &TreeReader{dir: dir, format: format}, nil
+}
+
+// Format returns the format recorded in the tree.
+func (r *TreeReader) Format() Format {
+	return r.format
+}
+
+// Next returns the next record, or io.EOF once every record was returned.
+// Files of a position-based table whose names aren't positions return an
+// error wrapping ErrInvalidFilename; stray files elsewhere are skipped, as
+// Combine does.
+func (r *TreeReader) Next(ctx context.Context) (Record, error) {
+	for {
+		for len(r.paths) == 0 {
+			if r.next == len(treeTables) {
+				return Record{}, io.EOF
+			}
+			t := treeTables[r.next]
+			paths, err := listTableFiles(ctx, filepath.Join(r.dir, t.subdir), subdirForTable(t.table) != "")
+			if err != nil {
+				return Record{}, &TableError{Op: "read", Table: t.table, Err: err}
+			}
+			r.next++
+			r.table, r.paths = t.table, paths
+		}
+		if err := ctx.Err(); err != nil {
+			return Record{}, err
+		}
+
+		path := r.paths[0]
+		r.paths = r.paths[1:]
+
+		rec := Record{Table: r.table}
+		name := strings.TrimSuffix(filepath.Base(path), ".bin")
+		switch r.table {
+		case "gamedata":
+			savegameid, err := strconv.ParseInt(name, 10, 64)
+			if err != nil {
+				continue // Skip invalid filenames
+			}
+			rec.Position = savegameid
+		case "playerdata":
+			rec.PlayerUID = unsanitizePlayerUID(name)
+		default:
+			position, err := reconstructPositionFromPath(path)
+			if err != nil {
+				return Record{}, &TableError{Op: "read", Table: r.table,
+					Err: fmt.Errorf("failed to reconstruct position from %s: %w", path, err)}
+			}
+			rec.Position = position
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Record{}, &TableError{Op: "read", Table: r.table, Err: fmt.Errorf("failed to read %s: %w", path, err)}
+		}
+		rec.Data = data
+		return rec, nil
+	}
+}
+
+// listTableFiles returns the .bin files of a table's subdirectory, walking
+// it if sharded. A missing subdirectory has none.
+func listTableFiles(ctx context.Context, dir string, sharded bool) ([]string, error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if !sharded {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+		var paths []string
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".bin") {
+				paths = append(paths, filepath.Join(dir, entry.Name()))
+			}
+		}
+		return paths, nil
+	}
+
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), ".bin") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// subdirForTable returns the subdirectory of a position-based table, or ""
+// for other tables.
+func subdirForTable(table string) string {
+	for _, t := range shardedTables {
+		if t.table == table {
+			return t.subdir
+		}
+	}
+	return ""
+}
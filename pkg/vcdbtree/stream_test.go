@@ -0,0 +1,173 @@
+package vcdbtree
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+// readAll returns every record of the tree at dir.
+func readAll(t *testing.T, dir string) []Record {
+	t.Helper()
+	r, err := OpenTree(dir)
+	if err != nil {
+		t.Fatalf("OpenTree() failed: %v", err)
+	}
+	var records []Record
+	for {
+		rec, err := r.Next(context.Background())
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("Next() failed: %v", err)
+		}
+		records = append(records, rec)
+	}
+}
+
+func TestTreeWriter_CombinesToDatabase(t *testing.T) {
+	tmpDir := t.TempDir()
+	treeDir := filepath.Join(tmpDir, "tree")
+	dbPath := filepath.Join(tmpDir, "world.vcdbs")
+
+	w, err := NewTreeWriter(treeDir, &Options{Layout: &Layout{Kind: LayoutHex}})
+	if err != nil {
+		t.Fatalf("NewTreeWriter() failed: %v", err)
+	}
+	w.Source = "exported.vcdbs"
+	records := []Record{
+		{Table: "chunk", Position: 0x00000012abff341c, Data: []byte("chunk")},
+		{Table: "mapchunk", Position: 42, Data: []byte("mapchunk")},
+		{Table: "mapregion", Position: 7, Data: []byte("mapregion")},
+		{Table: "gamedata", Position: 1, Data: []byte("gamedata")},
+		{Table: "playerdata", PlayerUID: "ABC123/DEF456+xyz", Data: []byte("player")},
+	}
+	for _, rec := range records {
+		if err := w.Write(rec); err != nil {
+			t.Fatalf("Write(%s) failed: %v", rec.Table, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	format, err := ReadFormat(treeDir)
+	if err != nil {
+		t.Fatalf("ReadFormat() failed: %v", err)
+	}
+	if format.Layout.Kind != LayoutHex || format.Source != "exported.vcdbs" {
+		t.Errorf("Format = %+v, want a hex tree from exported.vcdbs", format)
+	}
+
+	if err := Combine(treeDir, dbPath); err != nil {
+		t.Fatalf("Combine() failed: %v", err)
+	}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var data []byte
+	if err := db.QueryRow("SELECT data FROM chunk WHERE position = ?", 0x00000012abff341c).Scan(&data); err != nil || string(data) != "chunk" {
+		t.Errorf("chunk data = %q, %v, want %q", data, err, "chunk")
+	}
+	if err := db.QueryRow("SELECT data FROM playerdata WHERE playeruid = ?", "ABC123/DEF456+xyz").Scan(&data); err != nil || string(data) != "player" {
+		t.Errorf("playerdata = %q, %v, want %q", data, err, "player")
+	}
+}
+
+func TestTreeWriter_RejectsInvalidRecords(t *testing.T) {
+	w, err := NewTreeWriter(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewTreeWriter() failed: %v", err)
+	}
+	for _, rec := range []Record{
+		{Table: "chunks", Data: []byte("x")},
+		{Table: "playerdata", Data: []byte("x")},
+	} {
+		if err := w.Write(rec); err == nil {
+			t.Errorf("Write(%+v) succeeded, want error", rec)
+		}
+	}
+}
+
+func TestTreeReader_ReadsSplitTree(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	treeDir := filepath.Join(tmpDir, "tree")
+	testsupport.CreateSave(t, dbPath)
+	if err := Split(dbPath, treeDir); err != nil {
+		t.Fatalf("Split() failed: %v", err)
+	}
+
+	counts := make(map[string]int)
+	var order []string
+	for _, rec := range readAll(t, treeDir) {
+		counts[rec.Table]++
+		if len(order) == 0 || order[len(order)-1] != rec.Table {
+			order = append(order, rec.Table)
+		}
+		if rec.Table == "chunk" && rec.Position == 0x00000012abff341c && string(rec.Data) != "chunk_hex_example" {
+			t.Errorf("Chunk data = %q, want %q", rec.Data, "chunk_hex_example")
+		}
+		if rec.Table == "playerdata" && rec.PlayerUID == "" {
+			t.Error("playerdata record has no PlayerUID")
+		}
+	}
+
+	want := map[string]int{"chunk": 4, "mapchunk": 2, "mapregion": 1, "gamedata": 1, "playerdata": 3}
+	for table, n := range want {
+		if counts[table] != n {
+			t.Errorf("%s records = %d, want %d", table, counts[table], n)
+		}
+	}
+	wantOrder := []string{"chunk", "mapchunk", "mapregion", "gamedata", "playerdata"}
+	if len(order) != len(wantOrder) {
+		t.Fatalf("Table order = %v, want %v", order, wantOrder)
+	}
+	for i := range order {
+		if order[i] != wantOrder[i] {
+			t.Errorf("Table order = %v, want %v", order, wantOrder)
+			break
+		}
+	}
+}
+
+func TestTreeReader_InvalidFilename(t *testing.T) {
+	treeDir := t.TempDir()
+	bad := filepath.Join(treeDir, "chunks", "0", "0", "not-a-position.bin")
+	if err := os.MkdirAll(filepath.Dir(bad), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bad, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenTree(treeDir)
+	if err != nil {
+		t.Fatalf("OpenTree() failed: %v", err)
+	}
+	_, err = r.Next(context.Background())
+	var tableErr *TableError
+	if !errors.Is(err, ErrInvalidFilename) || !errors.As(err, &tableErr) || tableErr.Table != "chunk" {
+		t.Errorf("Next() error = %v, want an invalid chunk filename", err)
+	}
+}
+
+func TestOpenTree_RejectsNewerFormat(t *testing.T) {
+	treeDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(treeDir, FormatFile), []byte(`{"version": 99, "layout": "geographic"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenTree(treeDir); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("OpenTree() error = %v, want ErrUnsupportedFormat", err)
+	}
+}
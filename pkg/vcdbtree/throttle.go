@@ -0,0 +1,117 @@
+package vcdbtree
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Throttle paces the files a split or sync writes, so a burst of writes
+// doesn't starve a game server sharing the disk. One Throttle may be shared
+// by several splits and syncs, and is safe for concurrent use. A nil
+// *Throttle doesn't limit anything.
+type Throttle struct {
+	// BytesPerSecond is the most data written per second. Writes beyond it
+	// are delayed. Zero means unlimited.
+	BytesPerSecond int64
+
+	// SyncBytes flushes written files to disk each time this much has been
+	// written since the last flush, so dirty pages don't pile up and get
+	// written back all at once. Zero leaves write-back to the system.
+	SyncBytes int64
+
+	mu      sync.Mutex
+	next    time.Time
+	pending []string
+	unsaved int64
+}
+
+// writeFile writes data to path, as os.WriteFile does, once t allows it. An
+// existing file is replaced rather than truncated, so hard links to it, such
+// as from an earlier generation of a staging directory, keep their content.
+func (t *Throttle) writeFile(path string, data []byte) error {
+	t.wait(len(data))
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	return t.written(path, len(data))
+}
+
+// wait delays a write of n bytes until the writes before it have taken
+// the time BytesPerSecond allows them.
+func (t *Throttle) wait(n int) {
+	if t == nil || t.BytesPerSecond <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	delay := t.next.Sub(now)
+	t.next = t.next.Add(time.Duration(float64(n) / float64(t.BytesPerSecond) * float64(time.Second)))
+	t.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// written records that n bytes were written to path, and flushes the
+// files written so far once they add up to SyncBytes.
+func (t *Throttle) written(path string, n int) error {
+	if t == nil || t.SyncBytes <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	t.pending = append(t.pending, path)
+	t.unsaved += int64(n)
+	if t.unsaved < t.SyncBytes {
+		t.mu.Unlock()
+		return nil
+	}
+	pending := t.pending
+	t.pending, t.unsaved = nil, 0
+	t.mu.Unlock()
+
+	return syncFiles(pending)
+}
+
+// Flush flushes the files written since the last flush to disk.
+func (t *Throttle) Flush() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	pending := t.pending
+	t.pending, t.unsaved = nil, 0
+	t.mu.Unlock()
+
+	return syncFiles(pending)
+}
+
+// syncFiles flushes each of paths to disk. Files removed since they were
+// written are skipped.
+func syncFiles(paths []string) error {
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to flush %s: %w", path, err)
+		}
+		err = f.Sync()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to flush %s: %w", path, err)
+		}
+	}
+	return nil
+}
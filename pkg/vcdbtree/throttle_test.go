@@ -0,0 +1,106 @@
+package vcdbtree
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+func TestThrottle_LimitsRate(t *testing.T) {
+	dir := t.TempDir()
+	th := &Throttle{BytesPerSecond: 10000}
+	data := make([]byte, 1000)
+
+	// The first write goes through at once; the next four wait 100ms each
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := th.writeFile(filepath.Join(dir, "f"), data); err != nil {
+			t.Fatalf("writeFile() failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Errorf("5 KB at 10 KB/s took %v, want about 400ms", elapsed)
+	}
+}
+
+func TestThrottle_BatchesSyncs(t *testing.T) {
+	dir := t.TempDir()
+	th := &Throttle{SyncBytes: 250}
+	data := make([]byte, 100)
+
+	for i, name := range []string{"a", "b", "c"} {
+		if err := th.writeFile(filepath.Join(dir, name), data); err != nil {
+			t.Fatalf("writeFile() failed: %v", err)
+		}
+		wantPending := []int{1, 2, 0}[i]
+		if len(th.pending) != wantPending {
+			t.Errorf("after %d writes, %d files pending, want %d", i+1, len(th.pending), wantPending)
+		}
+	}
+
+	// Removed files are skipped when flushing
+	th.writeFile(filepath.Join(dir, "d"), data)
+	os.Remove(filepath.Join(dir, "d"))
+	if err := th.Flush(); err != nil || len(th.pending) != 0 {
+		t.Errorf("Flush() = %v with %d files pending", err, len(th.pending))
+	}
+}
+
+func TestThrottle_Nil(t *testing.T) {
+	var th *Throttle
+	path := filepath.Join(t.TempDir(), "f")
+	if err := th.writeFile(path, []byte("x")); err != nil {
+		t.Fatalf("writeFile() on nil Throttle failed: %v", err)
+	}
+	if err := th.Flush(); err != nil {
+		t.Errorf("Flush() on nil Throttle failed: %v", err)
+	}
+}
+
+func TestThrottle_WriteFileKeepsHardLinks(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.bin")
+	link := filepath.Join(dir, "link.bin")
+	os.WriteFile(path, []byte("old"), 0644)
+	if err := os.Link(path, link); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+
+	var throttle *Throttle
+	if err := throttle.writeFile(path, []byte("new")); err != nil {
+		t.Fatalf("writeFile() error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("file = %q, want new", data)
+	}
+	if data, _ := os.ReadFile(link); string(data) != "old" {
+		t.Errorf("hard link = %q, want its old content kept", data)
+	}
+}
+
+func TestSplitWithCache_Throttled(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "world.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	th := &Throttle{BytesPerSecond: 1 << 30, SyncBytes: 1}
+	written, _, err := SplitWithCacheContext(context.Background(), dbPath, filepath.Join(tmpDir, "tree"), &Options{Throttle: th})
+	if err != nil {
+		t.Fatalf("SplitWithCacheContext() failed: %v", err)
+	}
+	if written == 0 {
+		t.Error("SplitWithCacheContext() wrote nothing")
+	}
+	if len(th.pending) != 0 {
+		t.Errorf("%d files left unflushed after the split", len(th.pending))
+	}
+
+	src := filepath.Join(tmpDir, "tree")
+	if _, _, _, err := SyncDirOptions(src, filepath.Join(tmpDir, "copy"), SyncOptions{Throttle: th}); err != nil {
+		t.Fatalf("SyncDirOptions() failed: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package vcdbtree
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// transientSuffixes are the name endings of files that only exist while
+// something is writing: SQLite's rollback journal, write-ahead log, and
+// shared-memory index, and editor and download temp files.
+var transientSuffixes = []string{"-journal", "-wal", "-shm", ".tmp", ".temp", ".part", ".swp", "~"}
+
+// IsTransientFile reports whether the file at path is a side file of a live
+// write, such as "world.vcdbs-wal" or "config.json.tmp", judged by its name.
+// A copy of one is never consistent with the file it belongs to, so the
+// directory sync functions skip them.
+func IsTransientFile(path string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	if strings.HasPrefix(name, ".#") {
+		return true
+	}
+	for _, suffix := range transientSuffixes {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package vcdbtree
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsTransientFile(t *testing.T) {
+	tests := map[string]bool{
+		"default.vcdbs":          false,
+		"default.vcdbs-wal":      true,
+		"default.vcdbs-shm":      true,
+		"default.vcdbs-journal":  true,
+		"moddata.db-WAL":         true,
+		"serverconfig.json.tmp":  true,
+		"download.part":          true,
+		".config.json.swp":       true,
+		"notes.txt~":             true,
+		".#notes.txt":            true,
+		"server-main.log":        false,
+		"wal":                    false,
+		"journal.json":           false,
+		"Playerdata/player.json": false,
+	}
+	for path, want := range tests {
+		if got := IsTransientFile(path); got != want {
+			t.Errorf("IsTransientFile(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestSyncDirSkipsTransientFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := filepath.Join(t.TempDir(), "dst")
+
+	files := map[string]string{
+		"moddata.db":              "db",
+		"moddata.db-wal":          "wal",
+		"moddata.db-shm":          "shm",
+		"sub/settings.json":       "settings",
+		"sub/settings.json.tmp":   "partial settings",
+		"sub/world.vcdbs-journal": "journal",
+	}
+	for name, content := range files {
+		path := filepath.Join(srcDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A side file staged by an earlier version is removed
+	os.MkdirAll(dstDir, 0755)
+	if err := os.WriteFile(filepath.Join(dstDir, "moddata.db-wal"), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	written, _, removed, err := SyncDir(srcDir, dstDir)
+	if err != nil {
+		t.Fatalf("SyncDir failed: %v", err)
+	}
+	if written != 2 || removed != 1 {
+		t.Errorf("SyncDir wrote %d and removed %d files, want 2 and 1", written, removed)
+	}
+
+	for name := range files {
+		_, err := os.Stat(filepath.Join(dstDir, name))
+		if IsTransientFile(name) {
+			if !os.IsNotExist(err) {
+				t.Errorf("Transient file %s was synced: %v", name, err)
+			}
+		} else if err != nil {
+			t.Errorf("File %s was not synced: %v", name, err)
+		}
+	}
+}
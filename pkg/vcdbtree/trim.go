@@ -0,0 +1,166 @@
+package vcdbtree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Block sizes of the cells addressed by each position-based table.
+const (
+	chunkSizeBlocks     = 32
+	mapRegionSizeBlocks = 512
+)
+
+// RowFilter decides whether a row of a position-based table (chunk, mapchunk,
+// mapregion) is kept. Returning false drops the row from the output.
+type RowFilter func(table string, position int64) bool
+
+// Area is a circular area of the world in absolute block coordinates.
+type Area struct {
+	X, Z   int64
+	Radius int64
+}
+
+// ParseArea parses an area in the form "x,z,radius" (block coordinates).
+func ParseArea(s string) (Area, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return Area{}, fmt.Errorf("invalid area %q: expected x,z,radius", s)
+	}
+
+	var vals [3]int64
+	for i, p := range parts {
+		v, err := strconv.ParseInt(strings.TrimSpace(p), 10, 64)
+		if err != nil {
+			return Area{}, fmt.Errorf("invalid area %q: %w", s, err)
+		}
+		vals[i] = v
+	}
+
+	if vals[2] < 0 {
+		return Area{}, fmt.Errorf("invalid area %q: radius cannot be negative", s)
+	}
+
+	return Area{X: vals[0], Z: vals[1], Radius: vals[2]}, nil
+}
+
+// ParseAreas parses a semicolon-separated list of areas.
+func ParseAreas(s string) ([]Area, error) {
+	var areas []Area
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		area, err := ParseArea(part)
+		if err != nil {
+			return nil, err
+		}
+		areas = append(areas, area)
+	}
+	return areas, nil
+}
+
+// intersectsCell reports whether any part of the square cell starting at
+// (minX, minZ) with the given size lies within the area.
+func (a Area) intersectsCell(minX, minZ, size int64) bool {
+	nearestX := clamp(a.X, minX, minX+size-1)
+	nearestZ := clamp(a.Z, minZ, minZ+size-1)
+	dx := a.X - nearestX
+	dz := a.Z - nearestZ
+	return dx*dx+dz*dz <= a.Radius*a.Radius
+}
+
+// clamp restricts v to the range [lo, hi].
+func clamp(v, lo, hi int64) int64 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// KeepWithin returns a RowFilter that keeps only rows whose cell intersects at
+// least one of the given areas, for a world of DefaultMapSizeX.
+// Rows of unknown tables are always kept.
+func KeepWithin(areas []Area) RowFilter {
+	return KeepWithinMap(areas, DefaultMapSizeX)
+}
+
+// KeepWithinMap is like KeepWithin for a world mapSizeX blocks wide.
+func KeepWithinMap(areas []Area, mapSizeX int64) RowFilter {
+	return func(table string, position int64) bool {
+		var size int64
+		switch table {
+		case "chunk", "mapchunk":
+			size = chunkSizeBlocks
+		case "mapregion":
+			size = mapRegionSizeBlocks
+		default:
+			return true
+		}
+
+		x, z := CellCoords(table, position, mapSizeX)
+		minX := int64(x) * size
+		minZ := int64(z) * size
+		for _, area := range areas {
+			if area.intersectsCell(minX, minZ, size) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Trim removes files from an existing vcdbtree directory whose rows are rejected
+// by the filter. Returns the number of files removed.
+func Trim(ctx context.Context, treeDir string, filter RowFilter) (removed int, err error) {
+	for _, t := range shardedTables {
+		subdirPath := filepath.Join(treeDir, t.subdir)
+		if _, err := os.Stat(subdirPath); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.Walk(subdirPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if info.IsDir() || !strings.HasSuffix(info.Name(), ".bin") {
+				return nil
+			}
+
+			position, err := reconstructPositionFromPath(path)
+			if err != nil {
+				return err
+			}
+
+			if !filter(t.table, position) {
+				if err := os.Remove(path); err != nil {
+					return fmt.Errorf("failed to remove %s: %w", path, err)
+				}
+				removed++
+			}
+			return nil
+		})
+		if err != nil {
+			return removed, &TableError{Op: "trim", Table: t.table, Err: err}
+		}
+
+		if err := cleanupEmptyDirs(subdirPath); err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,163 @@
+package vcdbtree
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+// chunkPos packs non-negative cell coordinates into a position value.
+func chunkPos(x, z int64) int64 {
+	return z<<chunkZShift | x
+}
+
+// mapPos packs cell coordinates into the 2D index used by mapchunk and
+// mapregion rows in a world of DefaultMapSizeX.
+func mapPos(x, z, cellSize int64) int64 {
+	return z*(DefaultMapSizeX/cellSize) + x
+}
+
+func TestParseArea(t *testing.T) {
+	area, err := ParseArea(" 512000, -20 ,300")
+	if err != nil {
+		t.Fatalf("ParseArea failed: %v", err)
+	}
+	if area != (Area{X: 512000, Z: -20, Radius: 300}) {
+		t.Errorf("ParseArea = %+v", area)
+	}
+
+	for _, bad := range []string{"", "1,2", "1,2,3,4", "a,2,3", "1,2,-3"} {
+		if _, err := ParseArea(bad); err == nil {
+			t.Errorf("ParseArea(%q) should fail", bad)
+		}
+	}
+}
+
+func TestParseAreas(t *testing.T) {
+	areas, err := ParseAreas("0,0,10; 100,200,5;")
+	if err != nil {
+		t.Fatalf("ParseAreas failed: %v", err)
+	}
+	if len(areas) != 2 || areas[1] != (Area{X: 100, Z: 200, Radius: 5}) {
+		t.Errorf("ParseAreas = %+v", areas)
+	}
+
+	areas, err = ParseAreas("")
+	if err != nil || len(areas) != 0 {
+		t.Errorf("ParseAreas(\"\") = %v, %v; want empty", areas, err)
+	}
+
+	if _, err := ParseAreas("0,0,10;bogus"); err == nil {
+		t.Error("ParseAreas with an invalid entry should fail")
+	}
+}
+
+func TestKeepWithin(t *testing.T) {
+	keep := KeepWithin([]Area{{X: 1000, Z: 1000, Radius: 100}})
+
+	tests := []struct {
+		table    string
+		position int64
+		want     bool
+	}{
+		{"chunk", chunkPos(31, 31), true},                   // blocks 992-1023, contains the center
+		{"chunk", chunkPos(34, 31), true},                   // starts at 1088, 88 blocks away
+		{"chunk", chunkPos(35, 31), false},                  // starts at 1120, 120 blocks away
+		{"chunk", chunkPos(34, 34), false},                  // corner is ~124 blocks away
+		{"mapchunk", mapPos(28, 31, chunkSizeBlocks), true}, // ends at 927, 73 blocks away
+		{"mapchunk", mapPos(0, 0, chunkSizeBlocks), false},
+		{"mapchunk", chunkPos(28, 31), false},                  // ChunkPos packing means a different cell
+		{"mapregion", mapPos(1, 1, mapRegionSizeBlocks), true}, // blocks 512-1023
+		{"mapregion", mapPos(3, 3, mapRegionSizeBlocks), false},
+		{"gamedata", 0, true},
+	}
+
+	for _, tt := range tests {
+		if got := keep(tt.table, tt.position); got != tt.want {
+			x, z := CellCoords(tt.table, tt.position, DefaultMapSizeX)
+			t.Errorf("keep(%s, %d,%d) = %v, want %v", tt.table, x, z, got, tt.want)
+		}
+	}
+}
+
+func TestSplitWithCache_FilterRemovesTrimmedRows(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+	cacheDir := filepath.Join(tmpDir, "cache")
+
+	if _, _, err := SplitWithCache(dbPath, cacheDir); err != nil {
+		t.Fatalf("SplitWithCache failed: %v", err)
+	}
+
+	opts := &Options{Filter: KeepWithin([]Area{{X: 0, Z: 0, Radius: 10}})}
+	if _, _, err := SplitWithCacheContext(context.Background(), dbPath, cacheDir, opts); err != nil {
+		t.Fatalf("SplitWithCacheContext failed: %v", err)
+	}
+
+	if _, err := os.Stat(GetShardedPath(cacheDir, "chunks", 0)); err != nil {
+		t.Errorf("Chunk at origin should be kept: %v", err)
+	}
+	if _, err := os.Stat(GetShardedPath(cacheDir, "mapchunks", 100)); !os.IsNotExist(err) {
+		t.Errorf("Far mapchunk should have been removed, stat err = %v", err)
+	}
+	if _, err := os.Stat(GetShardedPath(cacheDir, "mapregions", 42)); !os.IsNotExist(err) {
+		t.Errorf("Far mapregion should have been removed, stat err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "gamedata")); err != nil {
+		t.Errorf("Gamedata should be untouched: %v", err)
+	}
+}
+
+func TestTrim(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+	treeDir := filepath.Join(tmpDir, "tree")
+
+	if err := Split(dbPath, treeDir); err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+
+	removed, err := Trim(context.Background(), treeDir, KeepWithin([]Area{{X: 0, Z: 0, Radius: 10}}))
+	if err != nil {
+		t.Fatalf("Trim failed: %v", err)
+	}
+
+	// Everything except the chunk at the origin lies outside the area.
+	if removed != 6 {
+		t.Errorf("Trim removed %d files, want 6", removed)
+	}
+	if _, err := os.Stat(GetShardedPath(treeDir, "chunks", 0)); err != nil {
+		t.Errorf("Chunk at origin should be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(treeDir, "mapregions", "0")); !os.IsNotExist(err) {
+		t.Errorf("Empty shard directories should be cleaned up, stat err = %v", err)
+	}
+
+	outPath := filepath.Join(tmpDir, "trimmed.vcdbs")
+	if err := Combine(treeDir, outPath); err != nil {
+		t.Fatalf("Combine of trimmed tree failed: %v", err)
+	}
+}
+
+func TestTrim_Cancelled(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+	treeDir := filepath.Join(tmpDir, "tree")
+
+	if err := Split(dbPath, treeDir); err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := Trim(ctx, treeDir, KeepWithin(nil)); err == nil {
+		t.Error("Trim with cancelled context should fail")
+	}
+}
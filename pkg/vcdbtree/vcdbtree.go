@@ -0,0 +1,1264 @@
+// Package vcdbtree provides functionality to convert Vintage Story .vcdbs savegame files
+// (SQLite databases) into a directory tree format optimized for deduplication algorithms.
+//
+// The format is called "vcdbtree" (Vintage Story Chunked Database Tree) and uses:
+//   - 2-level coordinate-based subdirectories for position-based tables (chunk, mapchunk, mapregion)
+//     organized by the z/x coordinates of the cell each row covers
+//   - Flat directories for small tables (gamedata, playerdata)
+//
+// Chunk positions use the ChunkPos format (64 bits, MSB first):
+// | reserved(1) | chunkY(9) | dimHigh(5) | guard(1) | chunkZ(21) | dimLow(5) | guard(1) | chunkX(21) |
+//
+// Mapchunk and mapregion positions are 2D indexes, z*width + x, with width the
+// world width in chunks or regions; see CellCoords.
+//
+// This format maximizes Restic's deduplication efficiency by ensuring unchanged BLOBs
+// produce identical byte sequences, unlike SQLite's non-deterministic serialization.
+// Geographic sharding by chunkZ/chunkX groups nearby chunks together, improving
+// deduplication for geographically clustered changes.
+// Trees may instead use a hex layout that shards by a hash of the position,
+// which keeps the tree shallow for spread-out worlds; see Layout.
+//
+// # API stability
+//
+// This package is part of the public API of github.com/renorris/vintagestory-restic
+// and follows the module's semantic versioning: exported identifiers will not be
+// removed or changed incompatibly within a major version. Functions without a
+// Context suffix are shorthands for their Context variants with a background
+// context and default Options.
+package vcdbtree
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ChunkPos bit field constants for extracting coordinates from position values.
+// ChunkPos format (64 bits, MSB first):
+// | reserved(1) | chunkY(9) | dimHigh(5) | guard(1) | chunkZ(21) | dimLow(5) | guard(1) | chunkX(21) |
+const (
+	chunkXMask   = 0x1FFFFF         // 21 bits for chunkX (bits 0-20)
+	chunkZShift  = 27               // chunkZ starts at bit 27
+	chunkZMask   = 0x1FFFFF         // 21 bits for chunkZ (bits 27-47)
+	signBit21    = 0x100000         // Sign bit for 21-bit signed integer
+	signExtend21 = ^int64(0x1FFFFF) // Mask for sign extension from 21 bits
+)
+
+// ChunkCoords returns the signed X and Z coordinates encoded in a chunk
+// table position. Use CellCoords for mapchunk and mapregion positions.
+func ChunkCoords(position int64) (x, z int32) {
+	return extractChunkX(position), extractChunkZ(position)
+}
+
+// extractChunkX extracts the signed chunkX coordinate from a ChunkPos position.
+func extractChunkX(position int64) int32 {
+	raw := position & chunkXMask
+	if raw&signBit21 != 0 {
+		raw |= signExtend21
+	}
+	return int32(raw)
+}
+
+// extractChunkZ extracts the signed chunkZ coordinate from a ChunkPos position.
+func extractChunkZ(position int64) int32 {
+	raw := (position >> chunkZShift) & chunkZMask
+	if raw&signBit21 != 0 {
+		raw |= signExtend21
+	}
+	return int32(raw)
+}
+
+// Split converts a .vcdbs SQLite database into a vcdbtree directory structure.
+// The output directory will contain:
+//   - chunks/     - 2-level coordinate-sharded directory for chunk table (chunkZ/chunkX)
+//   - mapchunks/  - 2-level coordinate-sharded directory for mapchunk table (chunkZ/chunkX)
+//   - mapregions/ - 2-level coordinate-sharded directory for mapregion table (chunkZ/chunkX)
+//   - gamedata/   - flat directory for gamedata table
+//   - playerdata/ - flat directory for playerdata table
+//
+// The tree root also contains a FormatFile recording the tree's Format.
+func Split(inputDBPath, outputDir string) error {
+	return SplitContext(context.Background(), inputDBPath, outputDir, nil)
+}
+
+// SplitContext is like Split but honors context cancellation and accepts Options.
+// Table failures are returned as *TableError.
+func SplitContext(ctx context.Context, inputDBPath, outputDir string, opts *Options) error {
+	_, err := split(ctx, inputDBPath, outputDir, opts)
+	return err
+}
+
+// split is SplitContext, returning the number of files written.
+func split(ctx context.Context, inputDBPath, outputDir string, opts *Options) (written int, err error) {
+	// Create output directory
+	w, err := NewTreeWriter(outputDir, opts)
+	if err != nil {
+		return 0, err
+	}
+	w.Source = filepath.Base(inputDBPath)
+
+	// Open the SQLite database
+	db, err := sql.Open("sqlite3", inputDBPath+"?mode=ro")
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	progress := opts.newProgressTracker(inputDBPath)
+
+	// Process each table
+	for _, t := range shardedTables {
+		rows, err := splitShardedTable(ctx, db, w, t.table, opts, progress)
+		if err != nil {
+			return written, &TableError{Op: "split", Table: t.table, Err: err}
+		}
+		written += rows
+		opts.tableDone(t.table, rows)
+		opts.tableFiles(t.table, FileCounts{Written: rows})
+	}
+
+	rows, err := splitGamedata(ctx, db, w, opts, progress)
+	if err != nil {
+		return written, &TableError{Op: "split", Table: "gamedata", Err: err}
+	}
+	if w.WorldID, err = readWorldID(ctx, db); err != nil {
+		return written, &TableError{Op: "split", Table: "gamedata", Err: err}
+	}
+	written += rows
+	opts.tableDone("gamedata", rows)
+	opts.tableFiles("gamedata", FileCounts{Written: rows})
+
+	rows, err = splitPlayerdata(ctx, db, w, opts, progress)
+	if err != nil {
+		return written, &TableError{Op: "split", Table: "playerdata", Err: err}
+	}
+	written += rows
+	opts.tableDone("playerdata", rows)
+	opts.tableFiles("playerdata", FileCounts{Written: rows})
+
+	return written, w.CloseContext(ctx)
+}
+
+// shardedTables lists the position-based tables and their vcdbtree subdirectories.
+var shardedTables = []struct {
+	table  string
+	subdir string
+}{
+	{"chunk", "chunks"},
+	{"mapchunk", "mapchunks"},
+	{"mapregion", "mapregions"},
+}
+
+// splitShardedTable extracts data from a position-based table into a sharded directory.
+// With the geographic layout, the sharding uses the cell coordinates decoded from the
+// position value by CellCoords: <subdir>/<z>/<x>/<position_hex>.bin
+func splitShardedTable(ctx context.Context, db *sql.DB, w *TreeWriter, tableName string, opts *Options, progress *progressTracker) (count int, err error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT position, data FROM %s", tableName)+opts.orderBy("position"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to query %s: %w", tableName, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		var position int64
+		var data []byte
+
+		if err := rows.Scan(&position, &data); err != nil {
+			return count, fmt.Errorf("failed to scan row: %w", err)
+		}
+		progress.row(tableName, len(data))
+
+		if data == nil || !opts.keep(tableName, position) {
+			continue
+		}
+
+		if err := w.Write(Record{Table: tableName, Position: position, Data: data}); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, rows.Err()
+}
+
+// splitGamedata extracts data from the gamedata table into a flat directory.
+func splitGamedata(ctx context.Context, db *sql.DB, w *TreeWriter, opts *Options, progress *progressTracker) (count int, err error) {
+	rows, err := db.QueryContext(ctx, "SELECT savegameid, data FROM gamedata"+opts.orderBy("savegameid"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to query gamedata: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		var savegameid int64
+		var data []byte
+
+		if err := rows.Scan(&savegameid, &data); err != nil {
+			return count, fmt.Errorf("failed to scan row: %w", err)
+		}
+		progress.row("gamedata", len(data))
+
+		if data == nil {
+			continue
+		}
+
+		if err := w.Write(Record{Table: "gamedata", Position: savegameid, Data: data}); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, rows.Err()
+}
+
+// splitPlayerdata extracts data from the playerdata table into a flat directory.
+// Player UIDs are converted to base64url format (replacing + with -, / with _) for filesystem safety.
+func splitPlayerdata(ctx context.Context, db *sql.DB, w *TreeWriter, opts *Options, progress *progressTracker) (count int, err error) {
+	rows, err := db.QueryContext(ctx, "SELECT playeruid, data FROM playerdata"+opts.orderBy("playeruid, playerid"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to query playerdata: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		var playeruid string
+		var data []byte
+
+		if err := rows.Scan(&playeruid, &data); err != nil {
+			return count, fmt.Errorf("failed to scan row: %w", err)
+		}
+		progress.row("playerdata", len(data))
+
+		if playeruid == "" || data == nil {
+			continue
+		}
+
+		if err := w.Write(Record{Table: "playerdata", PlayerUID: playeruid, Data: data}); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, rows.Err()
+}
+
+// sanitizePlayerUID converts a base64 playeruid to filesystem-safe base64url format.
+// Replaces + with -, / with _, and removes padding =.
+func sanitizePlayerUID(playeruid string) string {
+	s := strings.ReplaceAll(playeruid, "+", "-")
+	s = strings.ReplaceAll(s, "/", "_")
+	s = strings.TrimRight(s, "=")
+	return s
+}
+
+// unsanitizePlayerUID converts a base64url-safe string back to original base64 format.
+func unsanitizePlayerUID(safeUID string) string {
+	s := strings.ReplaceAll(safeUID, "-", "+")
+	s = strings.ReplaceAll(s, "_", "/")
+	return s
+}
+
+// Combine reconstructs a .vcdbs SQLite database from a vcdbtree directory structure.
+func Combine(inputDir, outputDBPath string) error {
+	return CombineContext(context.Background(), inputDir, outputDBPath, nil)
+}
+
+// CombineContext is like Combine but honors context cancellation and accepts Options.
+// Table failures are returned as *TableError.
+func CombineContext(ctx context.Context, inputDir, outputDBPath string, opts *Options) error {
+	// Files are found by walking the tree, so any known layout can be read;
+	// a newer format may store rows somewhere this version doesn't look
+	if _, err := ReadFormat(inputDir); err != nil {
+		return err
+	}
+
+	// Remove existing output file if present
+	os.Remove(outputDBPath)
+
+	// Create the new database
+	db, err := sql.Open("sqlite3", outputDBPath)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+	defer db.Close()
+
+	// Set page size and create schema
+	if _, err := db.ExecContext(ctx, "PRAGMA page_size = 4096"); err != nil {
+		return fmt.Errorf("failed to set page size: %w", err)
+	}
+
+	schema := `
+		CREATE TABLE chunk (position integer PRIMARY KEY, data BLOB);
+		CREATE TABLE mapchunk (position integer PRIMARY KEY, data BLOB);
+		CREATE TABLE mapregion (position integer PRIMARY KEY, data BLOB);
+		CREATE TABLE gamedata (savegameid integer PRIMARY KEY, data BLOB);
+		CREATE TABLE playerdata (playerid integer PRIMARY KEY AUTOINCREMENT, playeruid TEXT, data BLOB);
+		CREATE INDEX index_playeruid ON playerdata (playeruid);
+	`
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	// Combine each table
+	for _, t := range shardedTables {
+		rows, err := combineShardedTable(ctx, db, inputDir, t.table, t.subdir)
+		if err != nil {
+			return &TableError{Op: "combine", Table: t.table, Err: err}
+		}
+		opts.tableDone(t.table, rows)
+	}
+
+	rows, err := combineGamedata(ctx, db, inputDir)
+	if err != nil {
+		return &TableError{Op: "combine", Table: "gamedata", Err: err}
+	}
+	opts.tableDone("gamedata", rows)
+
+	rows, err = combinePlayerdata(ctx, db, inputDir)
+	if err != nil {
+		return &TableError{Op: "combine", Table: "playerdata", Err: err}
+	}
+	opts.tableDone("playerdata", rows)
+
+	// VACUUM for compactness and determinism
+	if _, err := db.ExecContext(ctx, "VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+
+	return nil
+}
+
+// combineShardedTable reconstructs a position-based table from a sharded directory of any layout.
+func combineShardedTable(ctx context.Context, db *sql.DB, inputDir, tableName, subdir string) (count int, err error) {
+	subdirPath := filepath.Join(inputDir, subdir)
+
+	// Check if directory exists
+	if _, err := os.Stat(subdirPath); os.IsNotExist(err) {
+		return 0, nil // Directory doesn't exist, skip
+	}
+
+	// Use a transaction for better performance
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT OR REPLACE INTO %s (position, data) VALUES (?, ?)", tableName))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	// Walk the sharded directory
+	err = filepath.Walk(subdirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".bin") {
+			return nil
+		}
+
+		// Reconstruct position from filename (the full position is stored in the filename)
+		position, err := reconstructPositionFromPath(path)
+		if err != nil {
+			return fmt.Errorf("failed to reconstruct position from %s: %w", path, err)
+		}
+
+		// Read the blob
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		// Insert into database
+		if _, err := stmt.Exec(position, data); err != nil {
+			return fmt.Errorf("failed to insert position %d: %w", position, err)
+		}
+		count++
+
+		return nil
+	})
+
+	if err != nil {
+		return count, err
+	}
+
+	return count, tx.Commit()
+}
+
+// reconstructPositionFromPath extracts the position integer from a file path.
+// Path structure: <subdir>/<chunkZ>/<chunkX>/<position_hex>.bin
+// The full position is stored in the filename as a 16-digit hex value.
+func reconstructPositionFromPath(path string) (int64, error) {
+	filename := filepath.Base(path)
+
+	if !strings.HasSuffix(filename, ".bin") {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidFilename, filename)
+	}
+
+	hexStr := strings.TrimSuffix(filename, ".bin")
+	if len(hexStr) != 16 {
+		return 0, fmt.Errorf("%w: invalid hex length: expected 16, got %d", ErrInvalidFilename, len(hexStr))
+	}
+
+	position, err := strconv.ParseUint(hexStr, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to parse hex %s: %v", ErrInvalidFilename, hexStr, err)
+	}
+
+	return int64(position), nil
+}
+
+// combineGamedata reconstructs the gamedata table from a flat directory.
+func combineGamedata(ctx context.Context, db *sql.DB, inputDir string) (count int, err error) {
+	subdirPath := filepath.Join(inputDir, "gamedata")
+
+	if _, err := os.Stat(subdirPath); os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	entries, err := os.ReadDir(subdirPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read gamedata directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".bin") {
+			continue
+		}
+
+		// Parse savegameid from filename
+		idStr := strings.TrimSuffix(entry.Name(), ".bin")
+		savegameid, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			continue // Skip invalid filenames
+		}
+
+		// Read data
+		data, err := os.ReadFile(filepath.Join(subdirPath, entry.Name()))
+		if err != nil {
+			return count, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+
+		// Insert
+		if _, err := db.ExecContext(ctx, "INSERT OR REPLACE INTO gamedata (savegameid, data) VALUES (?, ?)", savegameid, data); err != nil {
+			return count, fmt.Errorf("failed to insert savegameid %d: %w", savegameid, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// combinePlayerdata reconstructs the playerdata table from a flat directory.
+func combinePlayerdata(ctx context.Context, db *sql.DB, inputDir string) (count int, err error) {
+	subdirPath := filepath.Join(inputDir, "playerdata")
+
+	if _, err := os.Stat(subdirPath); os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	entries, err := os.ReadDir(subdirPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read playerdata directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".bin") {
+			continue
+		}
+
+		// Extract safe UID from filename and unsanitize
+		safeUID := strings.TrimSuffix(entry.Name(), ".bin")
+		playeruid := unsanitizePlayerUID(safeUID)
+
+		// Read data
+		data, err := os.ReadFile(filepath.Join(subdirPath, entry.Name()))
+		if err != nil {
+			return count, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+
+		// Insert
+		if _, err := db.ExecContext(ctx, "INSERT INTO playerdata (playeruid, data) VALUES (?, ?)", playeruid, data); err != nil {
+			return count, fmt.Errorf("failed to insert playeruid %s: %w", playeruid, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// GetShardedPath returns the sharded file path for a given position.
+// This is useful for the backup manager to write directly to the staging directory.
+// Path structure: <baseDir>/<tablePlural>/<z>/<x>/<position_hex>.bin, where z and
+// x are the cell coordinates from CellCoords for a world of DefaultMapSizeX.
+func GetShardedPath(baseDir, tablePlural string, position int64) string {
+	return shardedPath(baseDir, tableForSubdir(tablePlural), tablePlural, position, DefaultMapSizeX)
+}
+
+// SplitWithCache converts a .vcdbs SQLite database into a vcdbtree directory structure,
+// preserving files that haven't changed to maintain their metadata (mtime, ctime).
+// This optimizes for Restic efficiency - unchanged files produce zero diff.
+//
+// The function also removes files from the cache that no longer exist in the database,
+// ensuring the cache stays in sync with the current state.
+//
+// Returns the number of files written (changed) and the number of files skipped (unchanged).
+func SplitWithCache(inputDBPath, cacheDir string) (written, skipped int, err error) {
+	return SplitWithCacheContext(context.Background(), inputDBPath, cacheDir, nil)
+}
+
+// SplitWithCacheContext is like SplitWithCache but honors context cancellation
+// and accepts Options. Table failures are returned as *TableError.
+//
+// If the context is cancelled part-way through, stale files are not cleaned up,
+// so the cache may contain a mix of old and new files until the next run.
+//
+// A tree that would mostly be rewritten is instead rebuilt: split from
+// scratch next to cacheDir, with RebuildSuffix, and swapped in once
+// complete. That happens when the tree was split from a different world, as
+// recorded in its FormatFile, when its format is too old to migrate, or when
+// most of a sample of rows differ from the tree, or when Options.Rebuild
+// asks for it. Options.OnRebuild is told why, and all files count as
+// written.
+func SplitWithCacheContext(ctx context.Context, inputDBPath, cacheDir string, opts *Options) (written, skipped int, err error) {
+	if err := recoverRebuild(cacheDir); err != nil {
+		return 0, 0, err
+	}
+	previous, err := ReadFormat(cacheDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	layout, err := opts.layout(previous.Layout)
+	if err != nil {
+		return 0, 0, err
+	}
+	migrate := migration{from: previous, to: layout}
+
+	// Open the SQLite database
+	db, err := sql.Open("sqlite3", inputDBPath+"?mode=ro")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	worldID, err := readWorldID(ctx, db)
+	if err != nil {
+		return 0, 0, &TableError{Op: "split", Table: "gamedata", Err: err}
+	}
+	reason, err := rebuildReason(ctx, db, cacheDir, previous, layout, worldID, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+	if reason != "" {
+		opts.rebuilding(reason)
+		written, err := rebuildTree(ctx, inputDBPath, cacheDir, opts, layout)
+		return written, 0, err
+	}
+
+	// Create output directory
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return 0, 0, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	// Track all files that should exist in the cache
+	expectedFiles := make(map[string]bool)
+	var tables []string
+	files := make(map[string]FileCounts)
+	progress := opts.newProgressTracker(inputDBPath)
+
+	// Process each table
+	for _, t := range shardedTables {
+		w, s, err := splitShardedTableWithCache(ctx, db, cacheDir, t.table, t.subdir, migrate, expectedFiles, opts, progress)
+		if err != nil {
+			return 0, 0, &TableError{Op: "split", Table: t.table, Err: err}
+		}
+		written += w
+		skipped += s
+		opts.tableDone(t.table, w+s)
+		tables = append(tables, t.table)
+		files[t.table] = FileCounts{Written: w, Skipped: s}
+	}
+
+	w, s, err := splitGamedataWithCache(ctx, db, cacheDir, expectedFiles, opts, progress)
+	if err != nil {
+		return 0, 0, &TableError{Op: "split", Table: "gamedata", Err: err}
+	}
+	written += w
+	skipped += s
+	opts.tableDone("gamedata", w+s)
+	tables = append(tables, "gamedata")
+	files["gamedata"] = FileCounts{Written: w, Skipped: s}
+
+	w, s, err = splitPlayerdataWithCache(ctx, db, cacheDir, expectedFiles, opts, progress)
+	if err != nil {
+		return 0, 0, &TableError{Op: "split", Table: "playerdata", Err: err}
+	}
+	written += w
+	skipped += s
+	opts.tableDone("playerdata", w+s)
+	tables = append(tables, "playerdata")
+	files["playerdata"] = FileCounts{Written: w, Skipped: s}
+
+	// Clean up files that no longer exist in the database
+	removed, err := cleanupStaleFiles(cacheDir, expectedFiles)
+	if err != nil {
+		return written, skipped, fmt.Errorf("failed to cleanup stale files: %w", err)
+	}
+	for _, table := range tables {
+		counts := files[table]
+		counts.Removed = removed[table]
+		opts.tableFiles(table, counts)
+	}
+
+	// Recorded last, so an interrupted migration is picked up again from
+	// the previous format next time
+	format := Format{Layout: layout, Source: filepath.Base(inputDBPath), CreatedAt: previous.CreatedAt, WorldID: worldID}
+	if format.CreatedAt.IsZero() || opts.deterministic() {
+		format.CreatedAt = opts.createdAt()
+	}
+	if err := writeFormat(cacheDir, format); err != nil {
+		return written, skipped, err
+	}
+
+	if err := opts.throttle().Flush(); err != nil {
+		return written, skipped, err
+	}
+
+	if opts.deterministic() {
+		if err := normalizeTree(ctx, cacheDir); err != nil {
+			return written, skipped, fmt.Errorf("failed to normalize output: %w", err)
+		}
+	}
+
+	return written, skipped, nil
+}
+
+// splitShardedTableWithCache extracts data with caching support. Files
+// found where the tree's previous format put them are moved into place.
+func splitShardedTableWithCache(ctx context.Context, db *sql.DB, outputDir, tableName, subdir string, migrate migration, expectedFiles map[string]bool, opts *Options, progress *progressTracker) (written, skipped int, err error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT position, data FROM %s", tableName)+opts.orderBy("position"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query %s: %w", tableName, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return written, skipped, err
+		}
+
+		var position int64
+		var data []byte
+
+		if err := rows.Scan(&position, &data); err != nil {
+			return written, skipped, fmt.Errorf("failed to scan row: %w", err)
+		}
+		progress.row(tableName, len(data))
+
+		if data == nil || !opts.keep(tableName, position) {
+			continue
+		}
+
+		// Get the file path
+		filePath := migrate.to.path(outputDir, tableName, subdir, position, opts.mapSizeX())
+		expectedFiles[filePath] = true
+
+		if err := migrate.apply(filePath, outputDir, tableName, subdir, position, opts.mapSizeX()); err != nil {
+			return written, skipped, err
+		}
+
+		// Check if file exists and has same content
+		if fileMatchesContent(filePath, data) {
+			skipped++
+			continue
+		}
+
+		// Create directory and write file
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return written, skipped, fmt.Errorf("failed to create directory: %w", err)
+		}
+
+		if err := opts.throttle().writeFile(filePath, data); err != nil {
+			return written, skipped, fmt.Errorf("failed to write %s: %w", filePath, err)
+		}
+		written++
+		opts.rowWritten(tableName, position, len(data))
+	}
+
+	return written, skipped, rows.Err()
+}
+
+// migrateLegacyPath moves a file from legacy to path if it exists there and
+// nothing exists at path yet. The file keeps its metadata.
+func migrateLegacyPath(legacy, path string) error {
+	if legacy == path {
+		return nil
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Lstat(legacy); err != nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.Rename(legacy, path); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", legacy, path, err)
+	}
+	return nil
+}
+
+// splitGamedataWithCache extracts gamedata with caching support.
+func splitGamedataWithCache(ctx context.Context, db *sql.DB, outputDir string, expectedFiles map[string]bool, opts *Options, progress *progressTracker) (written, skipped int, err error) {
+	subdir := filepath.Join(outputDir, "gamedata")
+	if err := os.MkdirAll(subdir, 0755); err != nil {
+		return 0, 0, fmt.Errorf("failed to create gamedata directory: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT savegameid, data FROM gamedata"+opts.orderBy("savegameid"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query gamedata: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return written, skipped, err
+		}
+
+		var savegameid int64
+		var data []byte
+
+		if err := rows.Scan(&savegameid, &data); err != nil {
+			return written, skipped, fmt.Errorf("failed to scan row: %w", err)
+		}
+		progress.row("gamedata", len(data))
+
+		if data == nil {
+			continue
+		}
+
+		filename := fmt.Sprintf("%d.bin", savegameid)
+		filePath := filepath.Join(subdir, filename)
+		expectedFiles[filePath] = true
+
+		if fileMatchesContent(filePath, data) {
+			skipped++
+			continue
+		}
+
+		if err := opts.throttle().writeFile(filePath, data); err != nil {
+			return written, skipped, fmt.Errorf("failed to write %s: %w", filePath, err)
+		}
+		written++
+	}
+
+	return written, skipped, rows.Err()
+}
+
+// splitPlayerdataWithCache extracts playerdata with caching support.
+func splitPlayerdataWithCache(ctx context.Context, db *sql.DB, outputDir string, expectedFiles map[string]bool, opts *Options, progress *progressTracker) (written, skipped int, err error) {
+	subdir := filepath.Join(outputDir, "playerdata")
+	if err := os.MkdirAll(subdir, 0755); err != nil {
+		return 0, 0, fmt.Errorf("failed to create playerdata directory: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT playeruid, data FROM playerdata"+opts.orderBy("playeruid, playerid"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query playerdata: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return written, skipped, err
+		}
+
+		var playeruid string
+		var data []byte
+
+		if err := rows.Scan(&playeruid, &data); err != nil {
+			return written, skipped, fmt.Errorf("failed to scan row: %w", err)
+		}
+		progress.row("playerdata", len(data))
+
+		if playeruid == "" || data == nil {
+			continue
+		}
+
+		safeUID := sanitizePlayerUID(playeruid)
+		filename := safeUID + ".bin"
+		filePath := filepath.Join(subdir, filename)
+		expectedFiles[filePath] = true
+
+		if fileMatchesContent(filePath, data) {
+			skipped++
+			continue
+		}
+
+		if err := opts.throttle().writeFile(filePath, data); err != nil {
+			return written, skipped, fmt.Errorf("failed to write %s: %w", filePath, err)
+		}
+		written++
+	}
+
+	return written, skipped, rows.Err()
+}
+
+// fileMatchesContent checks if a file exists and has the exact same content as data.
+// Uses size comparison first for efficiency, then compares content.
+func fileMatchesContent(filePath string, data []byte) bool {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return false // File doesn't exist or can't be read
+	}
+
+	// Quick size check first
+	if info.Size() != int64(len(data)) {
+		return false
+	}
+
+	// Read and compare content
+	existing, err := os.ReadFile(filePath)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(existing, data)
+}
+
+// cleanupStaleFiles removes files from the cache that are no longer in the database.
+// This handles cases where chunks are deleted from the game world. Returns
+// the number of files removed for each table.
+func cleanupStaleFiles(cacheDir string, expectedFiles map[string]bool) (map[string]int, error) {
+	// Define the subdirectories to scan, by table
+	subdirs := []struct {
+		table  string
+		subdir string
+	}{
+		{"chunk", "chunks"},
+		{"mapchunk", "mapchunks"},
+		{"mapregion", "mapregions"},
+		{"gamedata", "gamedata"},
+		{"playerdata", "playerdata"},
+	}
+
+	removed := make(map[string]int)
+	for _, t := range subdirs {
+		subdirPath := filepath.Join(cacheDir, t.subdir)
+
+		if _, err := os.Stat(subdirPath); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.Walk(subdirPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			if !strings.HasSuffix(info.Name(), ".bin") {
+				return nil
+			}
+
+			// If file is not in expected set, remove it
+			if !expectedFiles[path] {
+				if err := os.Remove(path); err != nil {
+					return fmt.Errorf("failed to remove stale file %s: %w", path, err)
+				}
+				removed[t.table]++
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return removed, err
+		}
+
+		// Clean up empty directories
+		if err := cleanupEmptyDirs(subdirPath); err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+// cleanupEmptyDirs removes empty directories recursively.
+func cleanupEmptyDirs(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			subdir := filepath.Join(dir, entry.Name())
+			if err := cleanupEmptyDirs(subdir); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Re-read after cleaning subdirs
+	entries, err = os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// Don't remove the root subdirs (chunks, mapchunks, etc.)
+	// Only remove the coordinate-based subdirectories
+	if len(entries) == 0 && !isRootSubdir(dir) {
+		return os.Remove(dir)
+	}
+
+	return nil
+}
+
+// isRootSubdir checks if a directory is one of the root subdirectories.
+func isRootSubdir(dir string) bool {
+	base := filepath.Base(dir)
+	rootDirs := []string{"chunks", "mapchunks", "mapregions", "gamedata", "playerdata"}
+	for _, rd := range rootDirs {
+		if base == rd {
+			return true
+		}
+	}
+	return false
+}
+
+// CopyFileIfChanged copies a file only if the destination doesn't exist or has different content.
+// Returns true if the file was written, false if skipped.
+func CopyFileIfChanged(src, dst string) (bool, error) {
+	return copyFileIfChanged(src, dst, nil)
+}
+
+// copyFileIfChanged is CopyFileIfChanged, writing through throttle.
+func copyFileIfChanged(src, dst string, throttle *Throttle) (bool, error) {
+	// Read source file
+	srcData, err := os.ReadFile(src)
+	if err != nil {
+		return false, fmt.Errorf("failed to read source file: %w", err)
+	}
+
+	// Check if destination matches
+	if fileMatchesContent(dst, srcData) {
+		return false, nil
+	}
+
+	// Ensure destination directory exists
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return false, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// Write destination file
+	if err := throttle.writeFile(dst, srcData); err != nil {
+		return false, fmt.Errorf("failed to write destination file: %w", err)
+	}
+
+	return true, nil
+}
+
+// CopyFileIfModified is like CopyFileIfChanged, but trusts size and
+// modification time: a destination with the same size and modification time
+// as the source is skipped without reading either. Otherwise the content is
+// compared, and the destination is given the source's modification time, so
+// the next call can skip it. Returns true if the content was written.
+func CopyFileIfModified(src, dst string) (bool, error) {
+	return copyFileIfModified(src, dst, nil)
+}
+
+// copyFileIfModified is CopyFileIfModified, writing through throttle.
+func copyFileIfModified(src, dst string, throttle *Throttle) (bool, error) {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat source file: %w", err)
+	}
+	if dstInfo, err := os.Stat(dst); err == nil && dstInfo.Size() == srcInfo.Size() && dstInfo.ModTime().Equal(srcInfo.ModTime()) {
+		return false, nil
+	}
+
+	written, err := copyFileIfChanged(src, dst, throttle)
+	if err != nil {
+		return false, err
+	}
+	if err := os.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime()); err != nil {
+		return written, fmt.Errorf("failed to set modification time: %w", err)
+	}
+	return written, nil
+}
+
+// SyncOptions tunes SyncDirOptions.
+type SyncOptions struct {
+	// Workers is how many files are copied at once. If <= 0, GOMAXPROCS is
+	// used.
+	Workers int
+
+	// Metadata compares files by size and modification time only, as
+	// CopyFileIfModified does, instead of by content.
+	Metadata bool
+
+	// Exclude, if set, reports whether the file at rel, a path relative to
+	// the source, is left out. Excluded files are removed from the
+	// destination like files that no longer exist.
+	Exclude func(rel string) bool
+
+	// Throttle, if set, paces the files copied and flushes them to disk in
+	// batches.
+	Throttle *Throttle
+}
+
+// copyFile copies src to dst as opts compares files.
+func (o SyncOptions) copyFile(src, dst string) (bool, error) {
+	if o.Metadata {
+		return copyFileIfModified(src, dst, o.Throttle)
+	}
+	return copyFileIfChanged(src, dst, o.Throttle)
+}
+
+// CopyDirIfChanged recursively copies a directory, only writing files that have changed.
+// Transient files (see IsTransientFile) are left out.
+// Returns the number of files written and skipped.
+func CopyDirIfChanged(src, dst string) (written, skipped int, err error) {
+	return copyDirIfChangedWithTracking(src, dst, nil, SyncOptions{})
+}
+
+// copyDirIfChangedWithTracking is the internal implementation that tracks expected files.
+// Files are copied by up to opts.Workers goroutines.
+// The walk itself, and so directory creation and expectedFiles, stays on the
+// calling goroutine.
+func copyDirIfChangedWithTracking(src, dst string, expectedFiles map[string]bool, opts SyncOptions) (written, skipped int, err error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	type copyJob struct{ src, dst string }
+	jobs := make(chan copyJob)
+
+	var (
+		mu      sync.Mutex
+		copyErr error
+		failed  atomic.Bool
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if failed.Load() {
+					continue // Drain remaining jobs after a failure
+				}
+				changed, err := opts.copyFile(job.src, job.dst)
+
+				mu.Lock()
+				switch {
+				case err != nil:
+					if copyErr == nil {
+						copyErr = err
+					}
+					failed.Store(true)
+				case changed:
+					written++
+				default:
+					skipped++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if failed.Load() {
+			return filepath.SkipAll
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(dst, relPath)
+
+		if info.IsDir() {
+			return os.MkdirAll(dstPath, info.Mode())
+		}
+		if IsTransientFile(path) || (opts.Exclude != nil && opts.Exclude(relPath)) {
+			return nil
+		}
+
+		if expectedFiles != nil {
+			expectedFiles[dstPath] = true
+		}
+
+		jobs <- copyJob{path, dstPath}
+		return nil
+	})
+
+	close(jobs)
+	wg.Wait()
+
+	if err == nil {
+		err = copyErr
+	}
+	return written, skipped, err
+}
+
+// SyncDir synchronizes a source directory to a destination, copying changed files
+// and removing files in the destination that don't exist in the source.
+// Transient files (see IsTransientFile) are neither copied nor kept.
+// Files are copied concurrently, up to GOMAXPROCS at a time.
+// Returns the number of files written, skipped, and removed.
+func SyncDir(src, dst string) (written, skipped, removed int, err error) {
+	return SyncDirWorkers(src, dst, 0)
+}
+
+// SyncDirWorkers is like SyncDir but copies up to workers files at a time.
+// If workers <= 0, GOMAXPROCS is used. Removal of stale files in dst starts
+// only after every copy has finished, so a failed copy never removes anything.
+func SyncDirWorkers(src, dst string, workers int) (written, skipped, removed int, err error) {
+	return SyncDirOptions(src, dst, SyncOptions{Workers: workers})
+}
+
+// SyncDirOptions is like SyncDirWorkers, with files compared and excluded
+// as opts configures.
+func SyncDirOptions(src, dst string, opts SyncOptions) (written, skipped, removed int, err error) {
+	// Track expected files
+	expectedFiles := make(map[string]bool)
+
+	// Copy changed files
+	written, skipped, err = copyDirIfChangedWithTracking(src, dst, expectedFiles, opts)
+	if err == nil {
+		err = opts.Throttle.Flush()
+	}
+	if err != nil {
+		return written, skipped, 0, err
+	}
+
+	// Remove files in dst that don't exist in src
+	if _, statErr := os.Stat(dst); !os.IsNotExist(statErr) {
+		err = filepath.Walk(dst, func(path string, info os.FileInfo, walkErr error) error {
+			if walkErr != nil {
+				return walkErr
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			if !expectedFiles[path] {
+				if rmErr := os.Remove(path); rmErr != nil {
+					return rmErr
+				}
+				removed++
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return written, skipped, removed, err
+		}
+
+		// Clean up empty directories
+		cleanupEmptyDirsInPath(dst)
+	}
+
+	return written, skipped, removed, nil
+}
+
+// cleanupEmptyDirsInPath removes empty directories within a path.
+func cleanupEmptyDirsInPath(root string) {
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() || path == root {
+			return nil
+		}
+
+		entries, err := os.ReadDir(path)
+		if err == nil && len(entries) == 0 {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// SyncFile copies a single file if changed, or removes the destination if source doesn't exist.
+// Returns: written (1 if written, 0 otherwise), removed (1 if removed, 0 otherwise), error
+func SyncFile(src, dst string) (written, removed int, err error) {
+	_, srcErr := os.Stat(src)
+	if os.IsNotExist(srcErr) {
+		// Source doesn't exist, remove destination if it exists
+		if _, dstErr := os.Stat(dst); dstErr == nil {
+			if err := os.Remove(dst); err != nil {
+				return 0, 0, err
+			}
+			return 0, 1, nil
+		}
+		return 0, 0, nil
+	}
+
+	if srcErr != nil {
+		return 0, 0, srcErr
+	}
+
+	// Source exists, copy if changed
+	changed, err := CopyFileIfChanged(src, dst)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if changed {
+		return 1, 0, nil
+	}
+	return 0, 0, nil
+}
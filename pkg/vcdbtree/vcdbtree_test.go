@@ -1,102 +1,25 @@
 package vcdbtree
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
 )
 
-// createTestDatabase creates a test .vcdbs database with sample data.
-func createTestDatabase(t *testing.T, dbPath string) {
-	t.Helper()
-
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		t.Fatalf("Failed to create test database: %v", err)
-	}
-	defer db.Close()
-
-	// Create schema matching Vintage Story format
-	schema := `
-		PRAGMA page_size = 4096;
-		CREATE TABLE chunk (position integer PRIMARY KEY, data BLOB);
-		CREATE TABLE mapchunk (position integer PRIMARY KEY, data BLOB);
-		CREATE TABLE mapregion (position integer PRIMARY KEY, data BLOB);
-		CREATE TABLE gamedata (savegameid integer PRIMARY KEY, data BLOB);
-		CREATE TABLE playerdata (playerid integer PRIMARY KEY AUTOINCREMENT, playeruid TEXT, data BLOB);
-		CREATE INDEX index_playeruid ON playerdata (playeruid);
-	`
-	if _, err := db.Exec(schema); err != nil {
-		t.Fatalf("Failed to create schema: %v", err)
-	}
-
-	// Insert test data
-
-	// Chunks with various position values
-	chunks := []struct {
-		position int64
-		data     []byte
-	}{
-		{0, []byte("chunk_zero")},
-		{12345678901234, []byte("chunk_large_position")},
-		{0x00000012abff341c, []byte("chunk_hex_example")}, // 78988977180
-		{0x0bff341c00005678, []byte("chunk_another")},     // fits in int64
-	}
-	for _, c := range chunks {
-		if _, err := db.Exec("INSERT INTO chunk (position, data) VALUES (?, ?)", c.position, c.data); err != nil {
-			t.Fatalf("Failed to insert chunk: %v", err)
-		}
-	}
-
-	// Mapchunks
-	mapchunks := []struct {
-		position int64
-		data     []byte
-	}{
-		{100, []byte("mapchunk_100")},
-		{999999999, []byte("mapchunk_large")},
-	}
-	for _, mc := range mapchunks {
-		if _, err := db.Exec("INSERT INTO mapchunk (position, data) VALUES (?, ?)", mc.position, mc.data); err != nil {
-			t.Fatalf("Failed to insert mapchunk: %v", err)
-		}
-	}
-
-	// Mapregions
-	if _, err := db.Exec("INSERT INTO mapregion (position, data) VALUES (?, ?)", 42, []byte("mapregion_data")); err != nil {
-		t.Fatalf("Failed to insert mapregion: %v", err)
-	}
-
-	// Gamedata
-	if _, err := db.Exec("INSERT INTO gamedata (savegameid, data) VALUES (?, ?)", 1, []byte("gamedata_blob")); err != nil {
-		t.Fatalf("Failed to insert gamedata: %v", err)
-	}
-
-	// Playerdata with base64-like UIDs (containing + and /)
-	players := []struct {
-		playeruid string
-		data      []byte
-	}{
-		{"B5fZ7vAsz3Kt+fmEV8GeK8Gu", []byte("player1_data")},
-		{"ABC123/DEF456+xyz", []byte("player2_data")},
-		{"SimplePlayer", []byte("player3_data")},
-	}
-	for _, p := range players {
-		if _, err := db.Exec("INSERT INTO playerdata (playeruid, data) VALUES (?, ?)", p.playeruid, p.data); err != nil {
-			t.Fatalf("Failed to insert playerdata: %v", err)
-		}
-	}
-}
-
 func TestSplit_CreatesCorrectStructure(t *testing.T) {
 	tmpDir := t.TempDir()
 	dbPath := filepath.Join(tmpDir, "test.vcdbs")
 	outputDir := filepath.Join(tmpDir, "output")
 
-	createTestDatabase(t, dbPath)
+	testsupport.CreateSave(t, dbPath)
 
 	if err := Split(dbPath, outputDir); err != nil {
 		t.Fatalf("Split() failed: %v", err)
@@ -128,7 +51,7 @@ func TestSplit_CreatesShardedChunkFiles(t *testing.T) {
 	dbPath := filepath.Join(tmpDir, "test.vcdbs")
 	outputDir := filepath.Join(tmpDir, "output")
 
-	createTestDatabase(t, dbPath)
+	testsupport.CreateSave(t, dbPath)
 
 	if err := Split(dbPath, outputDir); err != nil {
 		t.Fatalf("Split() failed: %v", err)
@@ -153,7 +76,7 @@ func TestSplit_CreatesPlayerDataWithSanitizedFilenames(t *testing.T) {
 	dbPath := filepath.Join(tmpDir, "test.vcdbs")
 	outputDir := filepath.Join(tmpDir, "output")
 
-	createTestDatabase(t, dbPath)
+	testsupport.CreateSave(t, dbPath)
 
 	if err := Split(dbPath, outputDir); err != nil {
 		t.Fatalf("Split() failed: %v", err)
@@ -185,7 +108,7 @@ func TestSplit_CreatesGameDataFiles(t *testing.T) {
 	dbPath := filepath.Join(tmpDir, "test.vcdbs")
 	outputDir := filepath.Join(tmpDir, "output")
 
-	createTestDatabase(t, dbPath)
+	testsupport.CreateSave(t, dbPath)
 
 	if err := Split(dbPath, outputDir); err != nil {
 		t.Fatalf("Split() failed: %v", err)
@@ -207,7 +130,7 @@ func TestCombine_ReconstructsDatabase(t *testing.T) {
 	outputDir := filepath.Join(tmpDir, "split")
 	restoredPath := filepath.Join(tmpDir, "restored.vcdbs")
 
-	createTestDatabase(t, dbPath)
+	testsupport.CreateSave(t, dbPath)
 
 	// Split the database
 	if err := Split(dbPath, outputDir); err != nil {
@@ -287,7 +210,7 @@ func TestRoundTrip_PreservesAllData(t *testing.T) {
 	outputDir := filepath.Join(tmpDir, "split")
 	restoredPath := filepath.Join(tmpDir, "restored.vcdbs")
 
-	createTestDatabase(t, dbPath)
+	testsupport.CreateSave(t, dbPath)
 
 	// Split and combine
 	if err := Split(dbPath, outputDir); err != nil {
@@ -458,8 +381,12 @@ func TestGetShardedPath(t *testing.T) {
 		// Position 0x00000012abff341c: chunkZ=597, chunkX=-52196
 		{"/tmp/backup", "chunks", 0x00000012abff341c, "/tmp/backup/chunks/597/-52196/00000012abff341c.bin"},
 		// Position 0x0bff341c00005678: chunkZ=426880, chunkX=22136
-		{"/tmp/backup", "mapchunks", 0x0bff341c00005678, "/tmp/backup/mapchunks/426880/22136/0bff341c00005678.bin"},
-		// Position 42: chunkZ=0, chunkX=42
+		{"/tmp/backup", "chunks", 0x0bff341c00005678, "/tmp/backup/chunks/426880/22136/0bff341c00005678.bin"},
+		// Mapchunk 2D index 15625*32000+16000: chunkZ=15625, chunkX=16000
+		{"/tmp/backup", "mapchunks", 500016000, "/tmp/backup/mapchunks/15625/16000/000000001dcda380.bin"},
+		// Mapregion 2D index 1000*2000+999: regionZ=1000, regionX=999
+		{"/data", "mapregions", 2000999, "/data/mapregions/1000/999/00000000001e8867.bin"},
+		// Position 42: z=0, x=42 in every layout
 		{"/data", "mapregions", 42, "/data/mapregions/0/42/000000000000002a.bin"},
 	}
 
@@ -511,6 +438,9 @@ func TestReconstructPositionFromPath_InvalidPaths(t *testing.T) {
 		if err == nil {
 			t.Errorf("reconstructPositionFromPath(%q) expected error for %s",
 				tc.path, tc.desc)
+		} else if !errors.Is(err, ErrInvalidFilename) {
+			t.Errorf("reconstructPositionFromPath(%q) error should wrap ErrInvalidFilename, got %v",
+				tc.path, err)
 		}
 	}
 }
@@ -652,7 +582,7 @@ func TestSplitWithCache_FirstRun(t *testing.T) {
 	dbPath := filepath.Join(tmpDir, "test.vcdbs")
 	cacheDir := filepath.Join(tmpDir, "cache")
 
-	createTestDatabase(t, dbPath)
+	testsupport.CreateSave(t, dbPath)
 
 	written, skipped, err := SplitWithCache(dbPath, cacheDir)
 	if err != nil {
@@ -687,7 +617,7 @@ func TestSplitWithCache_SecondRunNoChanges(t *testing.T) {
 	dbPath := filepath.Join(tmpDir, "test.vcdbs")
 	cacheDir := filepath.Join(tmpDir, "cache")
 
-	createTestDatabase(t, dbPath)
+	testsupport.CreateSave(t, dbPath)
 
 	// First run
 	written1, skipped1, err := SplitWithCache(dbPath, cacheDir)
@@ -735,7 +665,7 @@ func TestSplitWithCache_ChangedData(t *testing.T) {
 	dbPath := filepath.Join(tmpDir, "test.vcdbs")
 	cacheDir := filepath.Join(tmpDir, "cache")
 
-	createTestDatabase(t, dbPath)
+	testsupport.CreateSave(t, dbPath)
 
 	// First run
 	_, _, err := SplitWithCache(dbPath, cacheDir)
@@ -785,7 +715,7 @@ func TestSplitWithCache_DeletedChunks(t *testing.T) {
 	dbPath := filepath.Join(tmpDir, "test.vcdbs")
 	cacheDir := filepath.Join(tmpDir, "cache")
 
-	createTestDatabase(t, dbPath)
+	testsupport.CreateSave(t, dbPath)
 
 	// First run
 	_, _, err := SplitWithCache(dbPath, cacheDir)
@@ -830,7 +760,7 @@ func TestSplitWithCache_NewChunks(t *testing.T) {
 	dbPath := filepath.Join(tmpDir, "test.vcdbs")
 	cacheDir := filepath.Join(tmpDir, "cache")
 
-	createTestDatabase(t, dbPath)
+	testsupport.CreateSave(t, dbPath)
 
 	// First run
 	written1, _, err := SplitWithCache(dbPath, cacheDir)
@@ -1041,6 +971,128 @@ func TestSyncDir(t *testing.T) {
 	})
 }
 
+func TestSyncDirWorkers(t *testing.T) {
+	for _, workers := range []int{1, 4, 16} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			srcDir := filepath.Join(tmpDir, "src")
+			dstDir := filepath.Join(tmpDir, "dst")
+
+			// Enough files across enough directories to keep every worker busy
+			for i := 0; i < 200; i++ {
+				path := filepath.Join(srcDir, fmt.Sprintf("dir%d", i%7), fmt.Sprintf("file%d.json", i))
+				os.MkdirAll(filepath.Dir(path), 0755)
+				os.WriteFile(path, []byte(fmt.Sprintf("content %d", i)), 0644)
+			}
+
+			written, skipped, removed, err := SyncDirWorkers(srcDir, dstDir, workers)
+			if err != nil {
+				t.Fatalf("SyncDirWorkers failed: %v", err)
+			}
+			if written != 200 || skipped != 0 || removed != 0 {
+				t.Errorf("initial sync = (%d, %d, %d), want (200, 0, 0)", written, skipped, removed)
+			}
+
+			// Change 10 files and delete 5
+			for i := 0; i < 10; i++ {
+				path := filepath.Join(srcDir, fmt.Sprintf("dir%d", i%7), fmt.Sprintf("file%d.json", i))
+				os.WriteFile(path, []byte("changed"), 0644)
+			}
+			for i := 100; i < 105; i++ {
+				os.Remove(filepath.Join(srcDir, fmt.Sprintf("dir%d", i%7), fmt.Sprintf("file%d.json", i)))
+			}
+
+			written, skipped, removed, err = SyncDirWorkers(srcDir, dstDir, workers)
+			if err != nil {
+				t.Fatalf("SyncDirWorkers failed: %v", err)
+			}
+			if written != 10 || skipped != 185 || removed != 5 {
+				t.Errorf("second sync = (%d, %d, %d), want (10, 185, 5)", written, skipped, removed)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dstDir, "dir3", "file3.json"))
+			if err != nil || string(data) != "changed" {
+				t.Errorf("changed file not copied: %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestSyncDirWorkers_CopyErrorSkipsRemoval(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	dstDir := filepath.Join(tmpDir, "dst")
+
+	os.MkdirAll(srcDir, 0755)
+	os.WriteFile(filepath.Join(srcDir, "blocked"), []byte("data"), 0644)
+	for i := 0; i < 20; i++ {
+		os.WriteFile(filepath.Join(srcDir, fmt.Sprintf("file%d", i)), []byte("data"), 0644)
+	}
+
+	// A directory where a file should go makes that copy fail
+	os.MkdirAll(filepath.Join(dstDir, "blocked", "inner"), 0755)
+	stale := filepath.Join(dstDir, "stale")
+	os.WriteFile(stale, []byte("old"), 0644)
+
+	_, _, removed, err := SyncDirWorkers(srcDir, dstDir, 4)
+	if err == nil {
+		t.Fatal("SyncDirWorkers expected error when a copy fails")
+	}
+	if removed != 0 {
+		t.Errorf("removed = %d, want 0 after a failed copy", removed)
+	}
+	if _, err := os.Stat(stale); err != nil {
+		t.Errorf("stale file should survive a failed sync: %v", err)
+	}
+}
+
+func TestSyncDirOptions(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	dstDir := filepath.Join(tmpDir, "dst")
+	os.MkdirAll(filepath.Join(srcDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(srcDir, "a.log"), []byte("aaaa"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("bbbb"), 0644)
+
+	opts := SyncOptions{Metadata: true}
+	if written, _, _, err := SyncDirOptions(srcDir, dstDir, opts); err != nil || written != 2 {
+		t.Fatalf("SyncDirOptions() = %d written, %v, want 2", written, err)
+	}
+	srcInfo, _ := os.Stat(filepath.Join(srcDir, "a.log"))
+	dstInfo, _ := os.Stat(filepath.Join(dstDir, "a.log"))
+	if !dstInfo.ModTime().Equal(srcInfo.ModTime()) {
+		t.Errorf("copy has modification time %v, want the source's %v", dstInfo.ModTime(), srcInfo.ModTime())
+	}
+
+	// Same size and modification time: trusted without reading
+	os.WriteFile(filepath.Join(srcDir, "a.log"), []byte("zzzz"), 0644)
+	os.Chtimes(filepath.Join(srcDir, "a.log"), srcInfo.ModTime(), srcInfo.ModTime())
+	if written, skipped, _, err := SyncDirOptions(srcDir, dstDir, opts); err != nil || written != 0 || skipped != 2 {
+		t.Errorf("SyncDirOptions() = %d written, %d skipped, %v, want 0 and 2", written, skipped, err)
+	}
+
+	// A new modification time with the same content only updates metadata
+	later := srcInfo.ModTime().Add(time.Hour)
+	os.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("bbbb"), 0644)
+	os.Chtimes(filepath.Join(srcDir, "sub", "b.txt"), later, later)
+	if written, _, _, err := SyncDirOptions(srcDir, dstDir, opts); err != nil || written != 0 {
+		t.Errorf("SyncDirOptions() = %d written, %v, want 0", written, err)
+	}
+	if info, _ := os.Stat(filepath.Join(dstDir, "sub", "b.txt")); !info.ModTime().Equal(later) {
+		t.Errorf("copy has modification time %v, want %v", info.ModTime(), later)
+	}
+
+	// Excluded files are removed from the destination
+	opts.Exclude = func(rel string) bool { return filepath.Ext(rel) == ".txt" }
+	_, _, removed, err := SyncDirOptions(srcDir, dstDir, opts)
+	if err != nil || removed != 1 {
+		t.Errorf("SyncDirOptions() = %d removed, %v, want 1", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "sub", "b.txt")); !os.IsNotExist(err) {
+		t.Error("excluded file is still in the destination")
+	}
+}
+
 func TestSyncFile(t *testing.T) {
 	tmpDir := t.TempDir()
 	srcPath := filepath.Join(tmpDir, "src.txt")
@@ -1148,3 +1200,119 @@ func TestCopyDirIfChanged(t *testing.T) {
 		}
 	})
 }
+
+func TestSplitContext_ReportsTableProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	counts := make(map[string]int)
+	opts := &Options{
+		OnTableDone: func(table string, rows int) {
+			counts[table] = rows
+		},
+	}
+
+	if err := SplitContext(context.Background(), dbPath, filepath.Join(tmpDir, "out"), opts); err != nil {
+		t.Fatalf("SplitContext failed: %v", err)
+	}
+
+	want := map[string]int{"chunk": 4, "mapchunk": 2, "mapregion": 1, "gamedata": 1, "playerdata": 3}
+	for table, n := range want {
+		if counts[table] != n {
+			t.Errorf("OnTableDone(%q) rows = %d, want %d", table, counts[table], n)
+		}
+	}
+}
+
+func TestSplitWithCacheContext_ReportsTableFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	cacheDir := filepath.Join(tmpDir, "cache")
+	testsupport.CreateSave(t, dbPath)
+
+	files := make(map[string]FileCounts)
+	opts := &Options{
+		OnTableFiles: func(table string, counts FileCounts) {
+			files[table] = counts
+		},
+	}
+	if _, _, err := SplitWithCacheContext(context.Background(), dbPath, cacheDir, opts); err != nil {
+		t.Fatalf("first SplitWithCacheContext failed: %v", err)
+	}
+	if want := (FileCounts{Written: 4}); files["chunk"] != want {
+		t.Errorf("first split chunk files = %+v, want %+v", files["chunk"], want)
+	}
+
+	execSave(t, dbPath,
+		"UPDATE chunk SET data = X'01020304' WHERE position = 0",
+		"DELETE FROM chunk WHERE position = (SELECT MAX(position) FROM chunk)")
+	if _, _, err := SplitWithCacheContext(context.Background(), dbPath, cacheDir, opts); err != nil {
+		t.Fatalf("second SplitWithCacheContext failed: %v", err)
+	}
+	if want := (FileCounts{Written: 1, Skipped: 2, Removed: 1}); files["chunk"] != want {
+		t.Errorf("second split chunk files = %+v, want %+v", files["chunk"], want)
+	}
+	if want := (FileCounts{Skipped: 3}); files["playerdata"] != want {
+		t.Errorf("second split playerdata files = %+v, want %+v", files["playerdata"], want)
+	}
+}
+
+func TestSplitContext_Cancelled(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := SplitContext(ctx, dbPath, filepath.Join(tmpDir, "out"), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("SplitContext error = %v, want context.Canceled", err)
+	}
+
+	var tableErr *TableError
+	if !errors.As(err, &tableErr) || tableErr.Op != "split" || tableErr.Table != "chunk" {
+		t.Errorf("Expected *TableError for chunk split, got %#v", err)
+	}
+}
+
+func TestCombineContext_Cancelled(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	treeDir := filepath.Join(tmpDir, "tree")
+	if err := Split(dbPath, treeDir); err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := CombineContext(ctx, treeDir, filepath.Join(tmpDir, "out.vcdbs"), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("CombineContext error = %v, want context.Canceled", err)
+	}
+}
+
+func TestSplitWithCacheContext_Cancelled(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, dbPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := SplitWithCacheContext(ctx, dbPath, filepath.Join(tmpDir, "cache"), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("SplitWithCacheContext error = %v, want context.Canceled", err)
+	}
+}
+
+func TestTableError_Error(t *testing.T) {
+	err := &TableError{Op: "combine", Table: "mapregion", Err: errors.New("disk full")}
+	if got := err.Error(); got != "failed to combine mapregion table: disk full" {
+		t.Errorf("TableError.Error() = %q", got)
+	}
+}
@@ -0,0 +1,145 @@
+package vcdbtree
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrVerifyFailed is returned by Verify when a combined database is corrupt
+// or doesn't match the tree it was built from.
+var ErrVerifyFailed = errors.New("verification failed")
+
+// Verify checks a database produced by Combine against the tree it was built
+// from. It runs SQLite's integrity check and compares the row count of each
+// table with the number of files Combine reads for it. Mismatches are
+// reported as *TableError wrapping ErrVerifyFailed.
+func Verify(ctx context.Context, treeDir, dbPath string) error {
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", dbPath+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := integrityCheck(ctx, db); err != nil {
+		return err
+	}
+
+	for _, t := range shardedTables {
+		want, err := countShardedFiles(ctx, filepath.Join(treeDir, t.subdir))
+		if err != nil {
+			return &TableError{Op: "verify", Table: t.table, Err: err}
+		}
+		if err := checkRowCount(ctx, db, t.table, want); err != nil {
+			return err
+		}
+	}
+
+	want, err := countFlatFiles(filepath.Join(treeDir, "gamedata"), func(name string) bool {
+		_, err := strconv.ParseInt(name, 10, 64)
+		return err == nil
+	})
+	if err != nil {
+		return &TableError{Op: "verify", Table: "gamedata", Err: err}
+	}
+	if err := checkRowCount(ctx, db, "gamedata", want); err != nil {
+		return err
+	}
+
+	want, err = countFlatFiles(filepath.Join(treeDir, "playerdata"), func(string) bool { return true })
+	if err != nil {
+		return &TableError{Op: "verify", Table: "playerdata", Err: err}
+	}
+	return checkRowCount(ctx, db, "playerdata", want)
+}
+
+// integrityCheck runs PRAGMA integrity_check, which returns a single "ok" row
+// for a sound database and one row per problem otherwise.
+func integrityCheck(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, "PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("failed to run integrity check: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return fmt.Errorf("failed to read integrity check result: %w", err)
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to run integrity check: %w", err)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: integrity check: %s", ErrVerifyFailed, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkRowCount compares the number of rows in table with want.
+func checkRowCount(ctx context.Context, db *sql.DB, table string, want int) error {
+	var got int
+	if err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&got); err != nil {
+		return &TableError{Op: "verify", Table: table, Err: fmt.Errorf("failed to count rows: %w", err)}
+	}
+	if got != want {
+		return &TableError{Op: "verify", Table: table, Err: fmt.Errorf("%w: database has %d rows, tree has %d files", ErrVerifyFailed, got, want)}
+	}
+	return nil
+}
+
+// countShardedFiles counts the .bin files in a sharded table directory.
+func countShardedFiles(ctx context.Context, dir string) (count int, err error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".bin") {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// countFlatFiles counts the .bin files in a flat table directory whose names,
+// without the extension, are accepted by valid.
+func countFlatFiles(dir string, valid func(name string) bool) (count int, err error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".bin")
+		if !entry.IsDir() && ok && valid(name) {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,105 @@
+package vcdbtree
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/renorris/vintagestory-restic/pkg/testsupport"
+)
+
+// combinedTree splits a sample save and combines it again, returning the
+// tree and database paths.
+func combinedTree(t *testing.T) (treeDir, dbPath string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "test.vcdbs")
+	testsupport.CreateSave(t, srcPath)
+
+	treeDir = filepath.Join(tmpDir, "tree")
+	if err := Split(srcPath, treeDir); err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	dbPath = filepath.Join(tmpDir, "combined.vcdbs")
+	if err := Combine(treeDir, dbPath); err != nil {
+		t.Fatalf("Combine failed: %v", err)
+	}
+	return treeDir, dbPath
+}
+
+func TestVerify_Passes(t *testing.T) {
+	treeDir, dbPath := combinedTree(t)
+
+	if err := Verify(context.Background(), treeDir, dbPath); err != nil {
+		t.Errorf("Verify failed on a freshly combined database: %v", err)
+	}
+}
+
+func TestVerify_DetectsMissingRows(t *testing.T) {
+	treeDir, dbPath := combinedTree(t)
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM chunk WHERE position = (SELECT MAX(position) FROM chunk)"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	err = Verify(context.Background(), treeDir, dbPath)
+	if !errors.Is(err, ErrVerifyFailed) {
+		t.Fatalf("Verify() error = %v, want ErrVerifyFailed", err)
+	}
+	var tableErr *TableError
+	if !errors.As(err, &tableErr) || tableErr.Table != "chunk" || tableErr.Op != "verify" {
+		t.Errorf("Verify() error = %v, want a verify TableError for the chunk table", err)
+	}
+}
+
+func TestVerify_DetectsExtraTreeFiles(t *testing.T) {
+	treeDir, dbPath := combinedTree(t)
+
+	// A player file that appeared in the tree after the database was built
+	path := filepath.Join(treeDir, "playerdata", "late-joiner.bin")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Verify(context.Background(), treeDir, dbPath)
+	var tableErr *TableError
+	if !errors.As(err, &tableErr) || tableErr.Table != "playerdata" || !errors.Is(err, ErrVerifyFailed) {
+		t.Errorf("Verify() error = %v, want a verify failure for the playerdata table", err)
+	}
+}
+
+func TestVerify_DetectsCorruption(t *testing.T) {
+	treeDir, dbPath := combinedTree(t)
+
+	// Overwrite everything after the header page with garbage
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 4096; i < len(data); i++ {
+		data[i] = 0xA5
+	}
+	if err := os.WriteFile(dbPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Verify(context.Background(), treeDir, dbPath); err == nil {
+		t.Error("Verify() succeeded on a corrupted database")
+	}
+}
+
+func TestVerify_MissingDatabase(t *testing.T) {
+	treeDir, _ := combinedTree(t)
+
+	if err := Verify(context.Background(), treeDir, filepath.Join(t.TempDir(), "missing.vcdbs")); err == nil {
+		t.Error("Verify() succeeded without a database")
+	}
+}